@@ -0,0 +1,385 @@
+// Package client queries the server of goval-dictionary, e.g. for the scanners not to hand-roll the requests and the decoding of the responses.
+// The lookups mirror the ones of db.DB, decoding the definitions into models.Definition, and the ones of GET are conditional on the ETag
+// of the last response of the same URL, reusing its body on 304 until the OVAL is refreshed.
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// DefaultCacheSize is the number of the responses cached by their ETag at most by default
+const DefaultCacheSize = 1024
+
+// Client queries the server at its base URL, safe for the concurrent use
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	timeout    time.Duration
+	authToken  string
+	userAgent  string
+	cache      *etagCache
+}
+
+// Option configures Client of New
+type Option func(*Client)
+
+// WithHTTPClient sends the requests by hc instead of http.DefaultClient, e.g. of the proxy or the TLS config
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithTimeout bounds each request, including reading its response, by timeout, not bounded but by the context if 0
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithAuthToken sends token as the bearer token in Authorization, for the server of --auth-token or --auth-tokens-file
+func WithAuthToken(token string) Option {
+	return func(c *Client) {
+		c.authToken = token
+	}
+}
+
+// WithUserAgent sends userAgent as User-Agent instead of goval-dictionary-client/<version>
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithCacheSize caches the responses of size URLs at most by their ETag, evicting the least recently used one, and none if 0
+func WithCacheSize(size int) Option {
+	return func(c *Client) {
+		c.cache = newETagCache(size)
+	}
+}
+
+// New returns the client of the server at baseURL, e.g. http://127.0.0.1:1324, failing if it is not the absolute URL of http or https
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to parse the base URL. err: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, xerrors.Errorf("Failed to parse the base URL, expected the absolute URL of http or https. URL: %s", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		userAgent:  fmt.Sprintf("goval-dictionary-client/%s", config.DisplayVersion()),
+		cache:      newETagCache(DefaultCacheSize),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Error is the error responded by the server, e.g. 401 of the token missing and 400 of the family not supported
+type Error struct {
+	StatusCode int
+	Message    string // the error of the JSON body, or the status text if it has none
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server responded %d: %s", e.StatusCode, e.Message)
+}
+
+// IsStatus reports whether err is Error of the status code, e.g. http.StatusUnauthorized
+func IsStatus(err error, code int) bool {
+	var e *Error
+	return xerrors.As(err, &e) && e.StatusCode == code
+}
+
+// packsResponse is the JSON body of GET /packs
+type packsResponse struct {
+	Definitions []models.Definition `json:"definitions"`
+	Total       int64               `json:"total"`
+	NextOffset  *int                `json:"nextOffset,omitempty"`
+}
+
+// cvesResponse is the JSON body of GET /cves
+type cvesResponse struct {
+	Definitions []models.Definition `json:"definitions"`
+	Total       int64               `json:"total"`
+	NextOffset  *int                `json:"nextOffset,omitempty"`
+}
+
+// cpesResponse is the JSON body of GET /cpes
+type cpesResponse struct {
+	Definitions []models.Definition `json:"definitions"`
+}
+
+// packsBatchRequest is the JSON body of POST /packs
+type packsBatchRequest struct {
+	Packages []string `json:"packages"`
+}
+
+// packsBatchResponse is the JSON body responded by POST /packs
+type packsBatchResponse struct {
+	Packages map[string][]models.Definition `json:"packages"`
+}
+
+// GetByPackName returns the definitions affecting the package of the family and the release, only of the arch if not empty,
+// and only of the classes if given, e.g. patch, following the pages of the server limited by --max-limit
+func (c *Client) GetByPackName(ctx context.Context, family, release, pack, arch string, classes ...string) ([]models.Definition, error) {
+	q := url.Values{}
+	if arch != "" {
+		q.Set("arch", arch)
+	}
+	for _, class := range classes {
+		q.Add("class", class)
+	}
+	defs := []models.Definition{}
+	for {
+		var res packsResponse
+		if err := c.get(ctx, []string{"packs", family, release, pack}, q, &res); err != nil {
+			return nil, xerrors.Errorf("Failed to get by Package Name. family: %s, release: %s, pack: %s, err: %w", family, release, pack, err)
+		}
+		defs = append(defs, res.Definitions...)
+		if res.NextOffset == nil {
+			return defs, nil
+		}
+		q.Set("offset", fmt.Sprint(*res.NextOffset))
+	}
+}
+
+// GetByPackNames returns the definitions affecting each of the packages of the family and the release by package, looked up at once
+// by POST /packs, with an empty slice for the package affected by none
+func (c *Client) GetByPackNames(ctx context.Context, family, release string, packs []string, arch string, classes ...string) (map[string][]models.Definition, error) {
+	q := url.Values{}
+	if arch != "" {
+		q.Set("arch", arch)
+	}
+	for _, class := range classes {
+		q.Add("class", class)
+	}
+	body, err := json.Marshal(packsBatchRequest{Packages: packs})
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to marshal the packages. err: %w", err)
+	}
+	var res packsBatchResponse
+	if err := c.do(ctx, http.MethodPost, []string{"packs", family, release}, q, body, &res); err != nil {
+		return nil, xerrors.Errorf("Failed to get by Package Names. family: %s, release: %s, err: %w", family, release, err)
+	}
+	if res.Packages == nil {
+		res.Packages = map[string][]models.Definition{}
+	}
+	return res.Packages, nil
+}
+
+// GetByCveID returns the definitions of the CVE of the family and the release, only of the arch if not empty,
+// following the pages of the server limited by --max-limit
+func (c *Client) GetByCveID(ctx context.Context, family, release, cveID, arch string) ([]models.Definition, error) {
+	q := url.Values{}
+	if arch != "" {
+		q.Set("arch", arch)
+	}
+	defs := []models.Definition{}
+	for {
+		var res cvesResponse
+		if err := c.get(ctx, []string{"cves", family, release, cveID}, q, &res); err != nil {
+			return nil, xerrors.Errorf("Failed to get by CveID. family: %s, release: %s, cveID: %s, err: %w", family, release, cveID, err)
+		}
+		defs = append(defs, res.Definitions...)
+		if res.NextOffset == nil {
+			return defs, nil
+		}
+		q.Set("offset", fmt.Sprint(*res.NextOffset))
+	}
+}
+
+// GetByCpe returns the definitions affecting the CPE of the family and the release, e.g. cpe:/o:redhat:enterprise_linux:8
+func (c *Client) GetByCpe(ctx context.Context, family, release, cpe string) ([]models.Definition, error) {
+	var res cpesResponse
+	if err := c.get(ctx, []string{"cpes", family, release, cpe}, nil, &res); err != nil {
+		return nil, xerrors.Errorf("Failed to get by CPE. family: %s, release: %s, cpe: %s, err: %w", family, release, cpe, err)
+	}
+	if res.Definitions == nil {
+		return []models.Definition{}, nil
+	}
+	return res.Definitions, nil
+}
+
+// get requests GET of the path segments and the query, decoding the response into v, or the cached one if the server responds 304
+func (c *Client) get(ctx context.Context, segments []string, q url.Values, v any) error {
+	return c.do(ctx, http.MethodGet, segments, q, nil, v)
+}
+
+// do requests method of the path segments, each escaped, e.g. libstdc%2B%2B and cpe:%2Fo:redhat, and the query with body in JSON if not nil,
+// decoding the JSON response into v. The requests of GET send If-None-Match of the ETag of the cached response of the URL,
+// which is decoded instead if the server responds 304, and the new response is cached by its ETag.
+func (c *Client) do(ctx context.Context, method string, segments []string, q url.Values, body []byte, v any) error {
+	u := *c.baseURL
+	escaped := make([]string, 0, len(segments))
+	for _, s := range segments {
+		escaped = append(escaped, url.PathEscape(s))
+	}
+	u.RawPath = u.Path + "/" + strings.Join(escaped, "/")
+	u.Path = u.Path + "/" + strings.Join(segments, "/")
+	u.RawQuery = q.Encode()
+	key := u.String()
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, key, reqBody)
+	if err != nil {
+		return xerrors.Errorf("Failed to create the request. err: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+	var cached *cachedResponse
+	if method == http.MethodGet {
+		if cached = c.cache.get(key); cached != nil {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return xerrors.Errorf("Failed to request. URL: %s, err: %w", key, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		if err := json.Unmarshal(cached.body, v); err != nil {
+			return xerrors.Errorf("Failed to decode the cached response. URL: %s, err: %w", key, err)
+		}
+		return nil
+	}
+
+	bs, err := readBody(res)
+	if err != nil {
+		return xerrors.Errorf("Failed to read the response. URL: %s, err: %w", key, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(bs, &e); err != nil || e.Error == "" {
+			e.Error = http.StatusText(res.StatusCode)
+		}
+		return &Error{StatusCode: res.StatusCode, Message: e.Error}
+	}
+	if err := json.Unmarshal(bs, v); err != nil {
+		return xerrors.Errorf("Failed to decode the response. URL: %s, err: %w", key, err)
+	}
+	if etag := res.Header.Get("ETag"); method == http.MethodGet && etag != "" {
+		c.cache.put(key, &cachedResponse{etag: etag, body: bs})
+	}
+	return nil
+}
+
+// readBody returns the body of res, decompressed if the server compressed it in gzip
+func readBody(res *http.Response) ([]byte, error) {
+	var r io.Reader = res.Body
+	if strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		gr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to open gzip. err: %w", err)
+		}
+		defer gr.Close()
+		r = gr
+	}
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to read. err: %w", err)
+	}
+	return bs, nil
+}
+
+// cachedResponse is the body of the response of a URL with its ETag, decoded again when the server responds 304
+type cachedResponse struct {
+	etag string
+	body []byte
+}
+
+// etagCache is the LRU cache of the responses by URL up to size, where nil or of size 0 caches none
+type etagCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *etagEntry, the most recently used first
+	entries map[string]*list.Element
+}
+
+type etagEntry struct {
+	key string
+	res *cachedResponse
+}
+
+func newETagCache(size int) *etagCache {
+	if size <= 0 {
+		return nil
+	}
+	return &etagCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *etagCache) get(key string) *cachedResponse {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*etagEntry).res
+}
+
+func (c *etagCache) put(key string, res *cachedResponse) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*etagEntry).res = res
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&etagEntry{key: key, res: res})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*etagEntry).key)
+	}
+}
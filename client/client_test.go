@@ -0,0 +1,302 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/server"
+)
+
+// statusRecorder records the statuses of the responses of the handler
+type statusRecorder struct {
+	mu       sync.Mutex
+	statuses []int
+}
+
+func (r *statusRecorder) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, req)
+		r.mu.Lock()
+		r.statuses = append(r.statuses, rec.status)
+		r.mu.Unlock()
+	})
+}
+
+func (r *statusRecorder) last() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.statuses) == 0 {
+		return 0
+	}
+	return r.statuses[len(r.statuses)-1]
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// newTestServer serves the real handlers of the server over the DB of redhat 8 with a definition of libstdc++ and python3.11,
+// recording the statuses of the responses
+func newTestServer(t *testing.T) (*httptest.Server, *statusRecorder) {
+	t.Helper()
+
+	viper.Set("batch-size", 10)
+	t.Cleanup(func() { viper.Set("batch-size", nil) })
+
+	dbPath := filepath.Join(t.TempDir(), "oval.sqlite3")
+	driver, err := db.NewDB("sqlite3", dbPath, false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	t.Cleanup(func() { _ = driver.CloseDB() })
+	root := &models.Root{
+		Family:    c.RedHat,
+		OSVersion: "8",
+		Timestamp: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC),
+		Definitions: []models.Definition{{
+			DefinitionID: "oval:com.redhat.rhsa:def:20230001",
+			Advisory: models.Advisory{
+				Cves:            []models.Cve{{CveID: "CVE-2023-0001"}},
+				AffectedCPEList: []models.Cpe{{Cpe: "cpe:/o:redhat:enterprise_linux:8::baseos"}},
+			},
+			AffectedPacks: []models.Package{
+				{Name: "libstdc++", Version: "0:8.5.0-18.el8"},
+				{Name: "python3.11", Version: "0:3.11.2-2.el8"},
+			},
+		}},
+	}
+	if _, err := driver.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	h, err := server.NewHandler(driver)
+	if err != nil {
+		t.Fatalf("Failed to NewHandler. err: %s", err)
+	}
+	rec := &statusRecorder{}
+	ts := httptest.NewServer(rec.wrap(h))
+	t.Cleanup(ts.Close)
+	return ts, rec
+}
+
+func definitionIDs(defs []models.Definition) []string {
+	ids := []string{}
+	for _, d := range defs {
+		ids = append(ids, d.DefinitionID)
+	}
+	return ids
+}
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"127.0.0.1:1324", "ftp://127.0.0.1", "/packs", "http://"} {
+		if _, err := New(baseURL); err == nil {
+			t.Errorf("New(%q): expected error, actual nil", baseURL)
+		}
+	}
+	if _, err := New("http://127.0.0.1:1324/"); err != nil {
+		t.Errorf("New: unexpected error: %s", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	ts, _ := newTestServer(t)
+	cl, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to New. err: %s", err)
+	}
+	ctx := context.Background()
+	want := []string{"oval:com.redhat.rhsa:def:20230001"}
+
+	defs, err := cl.GetByPackName(ctx, "RedHat", "8.7", "libstdc++", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	if ids := definitionIDs(defs); !reflect.DeepEqual(ids, want) {
+		t.Errorf("GetByPackName: expected: %q, actual: %q", want, ids)
+	}
+	if defs, err = cl.GetByPackName(ctx, "redhat", "8", "libc6", ""); err != nil || defs == nil || len(defs) != 0 {
+		t.Errorf("GetByPackName of libc6: expected: [], actual: %v, err: %v", defs, err)
+	}
+
+	if defs, err = cl.GetByCveID(ctx, "redhat", "8", "cve-2023-0001", ""); err != nil {
+		t.Fatalf("Failed to GetByCveID. err: %s", err)
+	}
+	if ids := definitionIDs(defs); !reflect.DeepEqual(ids, want) {
+		t.Errorf("GetByCveID: expected: %q, actual: %q", want, ids)
+	}
+
+	if defs, err = cl.GetByCpe(ctx, "redhat", "8", "cpe:/o:redhat:enterprise_linux:8::baseos"); err != nil {
+		t.Fatalf("Failed to GetByCpe. err: %s", err)
+	}
+	if ids := definitionIDs(defs); !reflect.DeepEqual(ids, want) {
+		t.Errorf("GetByCpe: expected: %q, actual: %q", want, ids)
+	}
+
+	byPack, err := cl.GetByPackNames(ctx, "redhat", "8", []string{"libstdc++", "python3.11", "libc6"}, "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackNames. err: %s", err)
+	}
+	for pack, wantIDs := range map[string][]string{"libstdc++": want, "python3.11": want, "libc6": {}} {
+		if ids := definitionIDs(byPack[pack]); !reflect.DeepEqual(ids, wantIDs) {
+			t.Errorf("GetByPackNames of %s: expected: %q, actual: %q", pack, wantIDs, ids)
+		}
+	}
+
+	// the family not supported
+	_, err = cl.GetByPackName(ctx, "windows", "11", "libstdc++", "")
+	if !IsStatus(err, http.StatusBadRequest) {
+		t.Errorf("GetByPackName of windows: expected: 400, actual: %v", err)
+	}
+}
+
+func TestClientNotModified(t *testing.T) {
+	ts, rec := newTestServer(t)
+	cl, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to New. err: %s", err)
+	}
+	ctx := context.Background()
+
+	first, err := cl.GetByPackName(ctx, "redhat", "8", "libstdc++", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	if status := rec.last(); status != http.StatusOK {
+		t.Fatalf("expected: %d, actual: %d", http.StatusOK, status)
+	}
+
+	// the same URL is conditional on the ETag of the first response, answered from the cache
+	second, err := cl.GetByPackName(ctx, "redhat", "8", "libstdc++", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	if status := rec.last(); status != http.StatusNotModified {
+		t.Fatalf("expected: %d, actual: %d", http.StatusNotModified, status)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("expected: %v, actual: %v", first, second)
+	}
+
+	// none cached
+	cl, err = New(ts.URL, WithCacheSize(0))
+	if err != nil {
+		t.Fatalf("Failed to New. err: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cl.GetByPackName(ctx, "redhat", "8", "libstdc++", ""); err != nil {
+			t.Fatalf("Failed to GetByPackName. err: %s", err)
+		}
+		if status := rec.last(); status != http.StatusOK {
+			t.Fatalf("expected: %d, actual: %d", http.StatusOK, status)
+		}
+	}
+}
+
+func TestClientAuthToken(t *testing.T) {
+	viper.Set("auth-token", "secret")
+	defer viper.Set("auth-token", nil)
+	ts, _ := newTestServer(t)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name       string
+		opts       []Option
+		wantStatus int
+	}{
+		{name: "no token", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", opts: []Option{WithAuthToken("wrong")}, wantStatus: http.StatusUnauthorized},
+		{name: "token", opts: []Option{WithAuthToken("secret")}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cl, err := New(ts.URL, tt.opts...)
+			if err != nil {
+				t.Fatalf("Failed to New. err: %s", err)
+			}
+			_, err = cl.GetByCveID(ctx, "redhat", "8", "CVE-2023-0001", "")
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Errorf("unexpected error: %s", err)
+			case tt.wantStatus != 0 && !IsStatus(err, tt.wantStatus):
+				t.Errorf("expected: %d, actual: %v", tt.wantStatus, err)
+			}
+		})
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	cl, err := New(ts.URL, WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to New. err: %s", err)
+	}
+	start := time.Now()
+	if _, err := cl.GetByPackName(context.Background(), "redhat", "8", "libstdc++", ""); err == nil {
+		t.Fatalf("expected error, actual nil")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected to time out in 50ms, actual: %s", elapsed)
+	}
+
+	// the context canceled
+	cl, err = New(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to New. err: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cl.GetByCveID(ctx, "redhat", "8", "CVE-2023-0001", ""); err == nil {
+		t.Errorf("expected error, actual nil")
+	}
+}
+
+func TestClientGzip(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("expected Accept-Encoding: gzip, actual: %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		_, _ = gz.Write([]byte(`{"definitions": [{"definitionID": "oval:com.redhat.rhsa:def:20230001"}]}`))
+		_ = gz.Close()
+	}))
+	defer ts.Close()
+
+	cl, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to New. err: %s", err)
+	}
+	defs, err := cl.GetByCpe(context.Background(), "redhat", "8", "cpe:/o:redhat:enterprise_linux:8")
+	if err != nil {
+		t.Fatalf("Failed to GetByCpe. err: %s", err)
+	}
+	if ids, want := definitionIDs(defs), []string{"oval:com.redhat.rhsa:def:20230001"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected: %q, actual: %q", want, ids)
+	}
+}
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	RootCmd.AddCommand(completionCmd)
+}
+
+// completionCmd generates the completion script of the subcommands and the flags registered at runtime,
+// replacing the default completion command of cobra
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh]",
+	Short: "Generate the completion script",
+	Long: `Generate the completion script of bash or zsh, completing the subcommands, the flags,
+the choices of the flags, e.g. --dbtype and --suse-type, and the static versions of the fetch subcommands, e.g. Debian releases.`,
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"bash", "zsh"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "bash":
+			if err := RootCmd.GenBashCompletion(cmd.OutOrStdout()); err != nil {
+				return xerrors.Errorf("Failed to generate bash completion. err: %w", err)
+			}
+		case "zsh":
+			if err := RootCmd.GenZshCompletion(cmd.OutOrStdout()); err != nil {
+				return xerrors.Errorf("Failed to generate zsh completion. err: %w", err)
+			}
+		}
+		return nil
+	},
+	Example: `$ source <(goval-dictionary completion bash)
+$ goval-dictionary completion zsh > "${fpath[1]}/_goval-dictionary"`,
+}
+
+// versionCompletions completes the version args of the fetch subcommand by the static versions of list, without the ones already given
+func versionCompletions(list func() ([]string, error)) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+		vs, err := list()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		comps := []string{}
+		for _, v := range vs {
+			if !slices.Contains(args, v) {
+				comps = append(comps, v)
+			}
+		}
+		return comps, cobra.ShellCompDirectiveNoFileComp
+	}
+}
@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCompletionScript(t *testing.T) {
+	defer RootCmd.SetOut(nil)
+
+	var out bytes.Buffer
+	RootCmd.SetOut(&out)
+	RootCmd.SetArgs([]string{"completion", "bash"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// every subcommand registered, so that the new ones are completed without editing the script
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		for _, sub := range cmd.Commands() {
+			if !sub.IsAvailableCommand() {
+				continue
+			}
+			if !strings.Contains(out.String(), `commands+=("`+sub.Name()+`")`) {
+				t.Errorf("expected: the subcommand %s in the script", sub.CommandPath())
+			}
+			walk(sub)
+		}
+	}
+	walk(RootCmd)
+
+	for _, flag := range []string{"--dbtype=", "--dbpath=", "--suse-type=", "--versions-file=", "--since-year=", "--dry-run"} {
+		if !strings.Contains(out.String(), `flags+=("`+flag) {
+			t.Errorf("expected: the flag %s in the script", flag)
+		}
+	}
+
+	out.Reset()
+	RootCmd.SetArgs([]string{"completion", "zsh"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(out.String(), "#compdef goval-dictionary") {
+		t.Errorf("expected: the zsh script, actual: %q", out.String())
+	}
+
+	RootCmd.SetArgs([]string{"completion", "fish"})
+	if err := RootCmd.Execute(); err == nil {
+		t.Errorf("expected the error of the unsupported shell")
+	}
+}
+
+func TestCompletionValues(t *testing.T) {
+	defer RootCmd.SetOut(nil)
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "dbtype",
+			args: []string{"select", "--dbtype", ""},
+			want: []string{"sqlite3", "mysql", "postgres", "redis"},
+		},
+		{
+			name: "suse-type",
+			args: []string{"fetch", "suse", "--suse-type", ""},
+			want: []string{"opensuse", "opensuse-leap", "suse-enterprise-server", "suse-enterprise-desktop"},
+		},
+		{
+			name: "debian versions without the given ones",
+			args: []string{"fetch", "debian", "11", ""},
+			want: []string{"7", "8", "9", "10", "12"},
+		},
+		{
+			name: "oracle versions",
+			args: []string{"fetch", "oracle", ""},
+			want: []string{"5", "6", "7", "8", "9"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			RootCmd.SetOut(&out)
+			RootCmd.SetArgs(append([]string{cobra.ShellCompNoDescRequestCmd}, tt.args...))
+			if err := RootCmd.Execute(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			// the completions one per line, followed by the directive as ":4"
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			got := lines[:len(lines)-1]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected: %q, actual: %q", tt.want, out.String())
+			}
+		})
+	}
+}
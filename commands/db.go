@@ -0,0 +1,197 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/db"
+)
+
+// dbCmd is Subcommand for the maintenance of DB
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Maintain DB",
+	Long: `Maintain DB by --action:
+  check:    report the orphaned rows, whose parent definition, advisory or root is gone, the duplicate roots of the same family and OS version
+            and the cache validators in FetchMeta of the OS versions with no root, and delete the orphaned rows with --fix
+  vacuum:   reclaim the space of the deleted rows, by VACUUM of SQLite and PostgreSQL and OPTIMIZE TABLE of MySQL
+  optimize: update the statistics of the tables for the query planner
+  storage:  check the sqlite3 DB file is not corrupted by PRAGMA integrity_check, as fetch does by --integrity-check, and ping MySQL and PostgreSQL
+  source:   extract the source file of --file stored by fetch --store-source to --dir, as it was fetched decompressed`,
+	Args: cobra.NoArgs,
+	RunE: executeDB,
+	Example: `$ goval-dictionary db --action check
+$ goval-dictionary db --action check --fix
+$ goval-dictionary db --action vacuum
+$ goval-dictionary db --action storage
+$ goval-dictionary db --action source --file rhel-8.oval.xml --dir /tmp/provenance`,
+
+	PersistentPreRunE: setLogger,
+}
+
+func init() {
+	RootCmd.AddCommand(dbCmd)
+
+	dbCmd.PersistentFlags().String("action", "check", "the maintenance of DB (choices: check, vacuum, optimize, storage, source)")
+	bindFlag("action", dbCmd.PersistentFlags().Lookup("action"))
+
+	dbCmd.PersistentFlags().Bool("fix", false, "delete the orphaned rows found by --action check")
+	bindFlag("fix", dbCmd.PersistentFlags().Lookup("fix"))
+
+	dbCmd.PersistentFlags().String("file", "", "the name of the source file to extract by --action source, e.g. rhel-8.oval.xml")
+	bindFlag("db.file", dbCmd.PersistentFlags().Lookup("file"))
+
+	dbCmd.PersistentFlags().String("dir", ".", "the directory to extract the source file to by --action source, created if missing")
+	bindFlag("db.dir", dbCmd.PersistentFlags().Lookup("dir"))
+}
+
+func executeDB(cmd *cobra.Command, _ []string) error {
+	action := viper.GetString("action")
+	fix := viper.GetBool("fix")
+	switch action {
+	case "check":
+	case "vacuum", "optimize", "storage", "source":
+		if fix {
+			return xerrors.Errorf("Failed to maintain DB. err: --fix is only for --action check, not %s", action)
+		}
+		if action == "source" && viper.GetString("db.file") == "" {
+			return xerrors.New("Failed to maintain DB. err: --action source requires --file")
+		}
+	default:
+		return xerrors.Errorf("Unknown action: %s. Available action: check, vacuum, optimize, storage, source", action)
+	}
+
+	// only the checks without --fix and the extraction read DB, and the others are locked against the fetches
+	readOnly := action == "check" && !fix || action == "storage" || action == "source"
+	path, err := resolveDBPath(readOnly)
+	if err != nil {
+		return err
+	}
+	var driver db.DB
+	if readOnly {
+		// the storage is checked even of the pending migrations, as the file is checked rather than the tables
+		driver, err = openDB(path, db.Option{ReadOnly: true, SkipSchemaCheck: action == "storage"})
+	} else {
+		driver, err = openLockedDB(cmd.Context(), path, db.Option{})
+	}
+	if err != nil {
+		return err
+	}
+	defer driver.CloseDB()
+
+	switch action {
+	case "vacuum":
+		log15.Info("Vacuuming DB...")
+		if err := driver.Vacuum(); err != nil {
+			return xerrors.Errorf("Failed to vacuum DB. err: %w", err)
+		}
+	case "optimize":
+		log15.Info("Optimizing DB...")
+		if err := driver.Optimize(); err != nil {
+			return xerrors.Errorf("Failed to optimize DB. err: %w", err)
+		}
+	case "storage":
+		log15.Info("Checking the storage of DB...")
+		if err := driver.CheckStorage(true); err != nil {
+			if xerrors.Is(err, db.ErrCorrupted) {
+				return xerrors.Errorf("Failed to check the storage of DB. Restore DB from the backup, or remove it and fetch all the families again to rebuild it. err: %w", err)
+			}
+			return xerrors.Errorf("Failed to check the storage of DB. err: %w", err)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "No corruption found")
+	case "source":
+		path, err := extractSourceFile(driver, viper.GetString("db.file"), viper.GetString("db.dir"))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Extracted %s\n", path)
+	case "check":
+		if fix {
+			report, err := driver.FixIntegrity()
+			if err != nil {
+				return xerrors.Errorf("Failed to fix integrity of DB. err: %w", err)
+			}
+			printReport(cmd.OutOrStdout(), fmt.Sprintf("Deleted %d orphaned rows", report.Total()), report, false)
+			return nil
+		}
+		report, err := driver.CheckIntegrity()
+		if err != nil {
+			return xerrors.Errorf("Failed to check integrity of DB. err: %w", err)
+		}
+		printReport(cmd.OutOrStdout(), fmt.Sprintf("Found %d problems", report.Total()), report, true)
+		if report.Total() > 0 {
+			return xerrors.Errorf("Failed to check integrity of DB. err: %d problems found, %s", report.Total(), integrityHint(report))
+		}
+	}
+	return nil
+}
+
+// extractSourceFile writes the source file of fileName stored by fetch --store-source to dir, returning its path
+func extractSourceFile(driver db.DB, fileName, dir string) (string, error) {
+	// the name is the base name of the URL fetched, which must not escape dir
+	if fileName != filepath.Base(fileName) {
+		return "", xerrors.Errorf("Failed to extract source file. err: invalid file name: %s", fileName)
+	}
+	body, err := driver.GetSourceFile(fileName)
+	if err != nil {
+		return "", xerrors.Errorf("Failed to extract source file. err: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", xerrors.Errorf("Failed to create dir. dir: %s, err: %w", dir, err)
+	}
+	path := filepath.Join(dir, fileName)
+	if err := os.WriteFile(path, body, 0644); err != nil {
+		return "", xerrors.Errorf("Failed to write source file. path: %s, err: %w", path, err)
+	}
+	return path, nil
+}
+
+// integrityHint returns how to fix the problems in report: --fix deletes the orphaned rows, while the OVAL of the duplicate roots and the stale cache validators
+// is to be purged and fetched again
+func integrityHint(report db.Report) string {
+	hints := []string{}
+	if report.Total()-report.DuplicateRoots-report.StaleFetchMeta > 0 {
+		hints = append(hints, "delete the orphaned rows with --fix")
+	}
+	if report.DuplicateRoots+report.StaleFetchMeta > 0 {
+		hints = append(hints, "purge and fetch again the OS versions of the duplicate roots and the stale fetch meta")
+	}
+	return strings.Join(hints, ", and ")
+}
+
+// printReport prints the title and the table of the numbers of the orphaned rows by table, and of the other problems if checked, with their samples
+func printReport(w io.Writer, title string, report db.Report, checked bool) {
+	fmt.Fprintf(w, "%s\n", title)
+	tables := make([]string, 0, len(report.Orphans))
+	for t := range report.Orphans {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+
+	samples := func(key string) string {
+		if len(report.Samples[key]) == 0 {
+			return "-"
+		}
+		return strings.Join(report.Samples[key], ", ")
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tCOUNT\tSAMPLES")
+	for _, t := range tables {
+		fmt.Fprintf(tw, "orphaned %s\t%d\t%s\n", t, report.Orphans[t], samples(t))
+	}
+	if checked {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", db.SampleDuplicateRoots, report.DuplicateRoots, samples(db.SampleDuplicateRoots))
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", db.SampleStaleFetchMeta, report.StaleFetchMeta, samples(db.SampleStaleFetchMeta))
+	}
+	_ = tw.Flush()
+}
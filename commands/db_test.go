@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+)
+
+func TestDB(t *testing.T) {
+	dbpath := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), statusTestRoots()...)
+
+	tests := []struct {
+		name      string
+		args      []string
+		orphan    bool
+		wantTitle string
+		wantErr   string
+	}{
+		{
+			name:      "check",
+			args:      []string{"--action", "check"},
+			wantTitle: "Found 0 problems",
+		},
+		{
+			name:      "check orphans",
+			args:      []string{"--action", "check"},
+			orphan:    true,
+			wantTitle: "Found 2 problems",
+			wantErr:   "2 problems found, delete the orphaned rows with --fix",
+		},
+		{
+			name:      "fix",
+			args:      []string{"--action", "check", "--fix"},
+			wantTitle: "Deleted 3 orphaned rows",
+		},
+		{
+			name:      "check after fix",
+			args:      []string{"--action", "check"},
+			wantTitle: "Found 0 problems",
+		},
+		{
+			name: "vacuum",
+			args: []string{"--action", "vacuum"},
+		},
+		{
+			name: "optimize",
+			args: []string{"--action", "optimize"},
+		},
+		{
+			name:      "storage",
+			args:      []string{"--action", "storage"},
+			wantTitle: "No corruption found",
+		},
+		{
+			name:    "fix without check",
+			args:    []string{"--action", "vacuum", "--fix"},
+			wantErr: "--fix is only for --action check",
+		},
+		{
+			name:    "source without file",
+			args:    []string{"--action", "source"},
+			wantErr: "--action source requires --file",
+		},
+		{
+			name:    "unknown action",
+			args:    []string{"--action", "reindex"},
+			wantErr: "Unknown action: reindex",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				_ = dbCmd.PersistentFlags().Set("action", "check")
+				_ = dbCmd.PersistentFlags().Set("fix", "false")
+				RootCmd.SetOut(nil)
+			}()
+
+			// the definition of redhat deleted alone orphans its advisory and package, and then the cve of the advisory
+			if tt.orphan {
+				conn, err := gorm.Open(sqlite.Open(dbpath), &gorm.Config{})
+				if err != nil {
+					t.Fatalf("Failed to open DB. err: %s", err)
+				}
+				if err := conn.Exec("DELETE FROM definitions WHERE definition_id = ?", "oval:com.redhat.rhsa:def:20170933").Error; err != nil {
+					t.Fatalf("Failed to delete definition. err: %s", err)
+				}
+				sqlDB, err := conn.DB()
+				if err != nil {
+					t.Fatalf("Failed to get DB. err: %s", err)
+				}
+				_ = sqlDB.Close()
+			}
+
+			var out bytes.Buffer
+			RootCmd.SetOut(&out)
+			RootCmd.SetArgs(append([]string{"db", "--dbpath", dbpath}, tt.args...))
+			err := RootCmd.Execute()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected: %s, actual: %v", tt.wantErr, err)
+			}
+			if tt.wantTitle != "" {
+				if title := strings.SplitN(out.String(), "\n", 2)[0]; title != tt.wantTitle {
+					t.Errorf("expected: %q, actual: %q", tt.wantTitle, title)
+				}
+			}
+		})
+	}
+}
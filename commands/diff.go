@@ -0,0 +1,337 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// diffCmd is Subcommand to compare the OVAL of two DBs
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the OVAL of two DBs",
+	Long: `Compare the OVAL of each family and version of two DBs of --dbtype, e.g. the one freshly built and the one in production,
+and report the definitions added, removed and changed by DefinitionID, with the fixed versions changed of each package in JSON.
+The definitions of both DBs are streamed in the order of DefinitionID, so that the OVAL of the big family is not held in memory.`,
+	Args: cobra.NoArgs,
+	RunE: executeDiff,
+	Example: `$ goval-dictionary diff --old /var/lib/goval-dictionary/oval.sqlite3 --new ./oval.sqlite3
+$ goval-dictionary diff --old old.sqlite3 --new new.sqlite3 --family redhat --release 7 --format json`,
+
+	PersistentPreRunE: setLogger,
+}
+
+// diffFormats are the formats of diff --format
+var diffFormats = []string{"text", "json"}
+
+func init() {
+	RootCmd.AddCommand(diffCmd)
+
+	// bound to "diff.*", as "family", "release" and "format" are bound to the ones of the other subcommands
+	diffCmd.PersistentFlags().String("old", "", "the path of the DB to compare from, of --dbtype")
+	bindFlag("diff.old", diffCmd.PersistentFlags().Lookup("old"))
+
+	diffCmd.PersistentFlags().String("new", "", "the path of the DB to compare to, of --dbtype")
+	bindFlag("diff.new", diffCmd.PersistentFlags().Lookup("new"))
+
+	diffCmd.PersistentFlags().String("family", "", "the family to compare as shown by status, e.g. redhat, all the families if empty")
+	bindFlag("diff.family", diffCmd.PersistentFlags().Lookup("family"))
+
+	diffCmd.PersistentFlags().String("release", "", "the version of --family to compare as shown by status, all the versions if empty")
+	bindFlag("diff.release", diffCmd.PersistentFlags().Lookup("release"))
+
+	diffCmd.PersistentFlags().String("format", "text", "output format of the differences (choices: text of the summary and the DefinitionIDs, json with the packages changed)")
+	bindFlag("diff.format", diffCmd.PersistentFlags().Lookup("format"))
+	_ = diffCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(diffFormats, cobra.ShellCompDirectiveNoFileComp))
+}
+
+// dbDiff is the differences of the OVAL of the new DB from the old one
+type dbDiff struct {
+	Old   string     `json:"old"`
+	New   string     `json:"new"`
+	Roots []rootDiff `json:"roots"`
+}
+
+// rootDiff is the differences of the OVAL of a family and a version, of which the definitions are all added if only in the new DB,
+// and all removed if only in the old one
+type rootDiff struct {
+	Family    string             `json:"family"`
+	OSVersion string             `json:"osVersion"`
+	Added     []string           `json:"added"`   // DefinitionIDs
+	Removed   []string           `json:"removed"` // DefinitionIDs
+	Changed   []definitionChange `json:"changed"`
+	Unchanged int                `json:"unchanged"`
+}
+
+// definitionChange is the definition of the same DefinitionID of another ContentHash, with the affected packages changed,
+// none if only the others are, e.g. the description
+type definitionChange struct {
+	DefinitionID string          `json:"definitionID"`
+	Packages     []packageChange `json:"packages,omitempty"`
+}
+
+// packageChange is the affected package added, removed, or of the fixed version changed, keyed by the name, the arch and the modularity label
+type packageChange struct {
+	Name            string `json:"name"`
+	Arch            string `json:"arch,omitempty"`
+	ModularityLabel string `json:"modularityLabel,omitempty"`
+	Change          string `json:"change"` // added, removed or changed
+	OldVersion      string `json:"oldVersion,omitempty"`
+	NewVersion      string `json:"newVersion,omitempty"`
+	OldNotFixedYet  bool   `json:"oldNotFixedYet,omitempty"`
+	NewNotFixedYet  bool   `json:"newNotFixedYet,omitempty"`
+}
+
+func executeDiff(cmd *cobra.Command, _ []string) error {
+	format := viper.GetString("diff.format")
+	switch format {
+	case "text", "json":
+	default:
+		return xerrors.Errorf("Unknown format: %s. Available format: text, json", format)
+	}
+	oldPath, newPath := viper.GetString("diff.old"), viper.GetString("diff.new")
+	if oldPath == "" || newPath == "" {
+		return xerrors.New("Failed to diff. err: specify --old and --new")
+	}
+	family, err := familyFlag("diff.family")
+	if err != nil {
+		return xerrors.Errorf("Failed to diff. err: %w", err)
+	}
+	release := viper.GetString("diff.release")
+	if family == "" && release != "" {
+		return xerrors.New("Failed to diff. err: --release requires --family")
+	}
+
+	oldDB, err := openDiffDB(oldPath)
+	if err != nil {
+		return xerrors.Errorf("Failed to open --old. err: %w", err)
+	}
+	defer oldDB.CloseDB()
+	newDB, err := openDiffDB(newPath)
+	if err != nil {
+		return xerrors.Errorf("Failed to open --new. err: %w", err)
+	}
+	defer newDB.CloseDB()
+
+	targets, err := diffTargets(oldDB, newDB, family, release)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return xerrors.Errorf("Failed to find OVAL in either DB. family: %q, release: %q", family, release)
+	}
+
+	d := dbDiff{Old: oldPath, New: newPath, Roots: []rootDiff{}}
+	for _, t := range targets {
+		rd, err := diffRoot(cmd.Context(), oldDB, newDB, t.Family, t.OSVersion)
+		if err != nil {
+			return xerrors.Errorf("Failed to diff OVAL. family: %s, osVer: %s, err: %w", t.Family, t.OSVersion, err)
+		}
+		log15.Info("Compared", "Family", rd.Family, "Version", rd.OSVersion, "Added", len(rd.Added), "Removed", len(rd.Removed), "Changed", len(rd.Changed), "Unchanged", rd.Unchanged)
+		d.Roots = append(d.Roots, rd)
+	}
+	if err := printDiff(cmd.OutOrStdout(), format, d); err != nil {
+		return xerrors.Errorf("Failed to print diff. err: %w", err)
+	}
+	return nil
+}
+
+// openDiffDB opens the DB of --dbtype at path read-only, failing if its schema is not the latest one, whose definitions may be read wrong
+func openDiffDB(path string) (db.DB, error) {
+	driver, err := openDB(path, db.Option{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		_ = driver.CloseDB()
+		return nil, xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+	}
+	if fetchMeta.OutDated() {
+		_ = driver.CloseDB()
+		return nil, xerrors.Errorf("SchemaVersion is old. SchemaVersion: %+v", map[string]uint{"latest": models.LatestSchemaVersion, "DB": fetchMeta.SchemaVersion})
+	}
+	return driver, nil
+}
+
+// diffTargets returns the family and the version of the OVAL in either DB of family and release, all of them if empty,
+// sorted by the family and the version
+func diffTargets(oldDB, newDB db.DB, family, release string) ([]models.RootStat, error) {
+	seen := map[[2]string]struct{}{}
+	targets := []models.RootStat{}
+	for _, driver := range []db.DB{oldDB, newDB} {
+		stats, err := driver.GetRootStats()
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to get the stats of OVAL. err: %w", err)
+		}
+		for _, s := range stats {
+			key := [2]string{s.Family, s.OSVersion}
+			if _, ok := seen[key]; ok || !matchRoot(s, family, release) {
+				continue
+			}
+			seen[key] = struct{}{}
+			targets = append(targets, models.RootStat{Family: s.Family, OSVersion: s.OSVersion})
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Family != targets[j].Family {
+			return targets[i].Family < targets[j].Family
+		}
+		return targets[i].OSVersion < targets[j].OSVersion
+	})
+	return targets, nil
+}
+
+// diffRoot compares the definitions of family and osVer of oldDB and newDB, merging both of them streamed in the order of DefinitionID,
+// so that only the IDs of the changes are held
+func diffRoot(ctx context.Context, oldDB, newDB db.DB, family, osVer string) (rootDiff, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	olds, oldErr := streamDefinitions(ctx, oldDB, family, osVer)
+	news, newErr := streamDefinitions(ctx, newDB, family, osVer)
+
+	rd := rootDiff{Family: family, OSVersion: osVer, Added: []string{}, Removed: []string{}, Changed: []definitionChange{}}
+	o, oOK := <-olds
+	n, nOK := <-news
+	for oOK || nOK {
+		switch {
+		case !nOK || oOK && o.DefinitionID < n.DefinitionID:
+			rd.Removed = append(rd.Removed, o.DefinitionID)
+			o, oOK = <-olds
+		case !oOK || n.DefinitionID < o.DefinitionID:
+			rd.Added = append(rd.Added, n.DefinitionID)
+			n, nOK = <-news
+		default:
+			if o.ContentHash() == n.ContentHash() {
+				rd.Unchanged++
+			} else {
+				rd.Changed = append(rd.Changed, definitionChange{DefinitionID: n.DefinitionID, Packages: diffPackages(o.AffectedPacks, n.AffectedPacks)})
+			}
+			o, oOK = <-olds
+			n, nOK = <-news
+		}
+	}
+	if err := <-oldErr; err != nil {
+		return rootDiff{}, xerrors.Errorf("Failed to iterate the definitions of --old. err: %w", err)
+	}
+	if err := <-newErr; err != nil {
+		return rootDiff{}, xerrors.Errorf("Failed to iterate the definitions of --new. err: %w", err)
+	}
+	return rd, nil
+}
+
+// streamDefinitions sends the definitions of family and osVer of driver in the order of DefinitionID until ctx is done, and then the error
+// of the iteration, failing if the DB returns them out of the byte order, e.g. of the case-insensitive collation, which the merge relies on
+func streamDefinitions(ctx context.Context, driver db.DB, family, osVer string) (<-chan models.Definition, <-chan error) {
+	defs := make(chan models.Definition, 64)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(defs)
+		last := ""
+		errc <- driver.IterateDefinitions(ctx, family, osVer, func(d models.Definition) error {
+			if d.DefinitionID < last {
+				return xerrors.Errorf("Failed to stream the definitions in the order of DefinitionID. err: %s after %s", d.DefinitionID, last)
+			}
+			last = d.DefinitionID
+			select {
+			case defs <- d:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return defs, errc
+}
+
+// diffPackages returns the changes of the affected packages from olds to news, sorted by the name, the arch and the modularity label
+func diffPackages(olds, news []models.Package) []packageChange {
+	type key struct{ name, arch, label string }
+	keyOf := func(p models.Package) key { return key{name: p.Name, arch: p.Arch, label: p.ModularityLabel} }
+	byKey := map[key]models.Package{}
+	for _, p := range olds {
+		byKey[keyOf(p)] = p
+	}
+
+	changes := []packageChange{}
+	seen := map[key]struct{}{}
+	for _, p := range news {
+		k := keyOf(p)
+		seen[k] = struct{}{}
+		c := packageChange{Name: p.Name, Arch: p.Arch, ModularityLabel: p.ModularityLabel, NewVersion: p.Version, NewNotFixedYet: p.NotFixedYet}
+		o, ok := byKey[k]
+		switch {
+		case !ok:
+			c.Change = "added"
+		case o.Version != p.Version || o.NotFixedYet != p.NotFixedYet:
+			c.Change, c.OldVersion, c.OldNotFixedYet = "changed", o.Version, o.NotFixedYet
+		default:
+			continue
+		}
+		changes = append(changes, c)
+	}
+	for _, p := range olds {
+		if _, ok := seen[keyOf(p)]; ok {
+			continue
+		}
+		seen[keyOf(p)] = struct{}{}
+		changes = append(changes, packageChange{Name: p.Name, Arch: p.Arch, ModularityLabel: p.ModularityLabel, Change: "removed", OldVersion: p.Version, OldNotFixedYet: p.NotFixedYet})
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Name != changes[j].Name {
+			return changes[i].Name < changes[j].Name
+		}
+		if changes[i].Arch != changes[j].Arch {
+			return changes[i].Arch < changes[j].Arch
+		}
+		return changes[i].ModularityLabel < changes[j].ModularityLabel
+	})
+	return changes
+}
+
+// printDiff prints d in JSON, or in the table of the numbers of the changes of each family and version followed by the DefinitionIDs
+// added (+), removed (-) and changed (~)
+func printDiff(w io.Writer, format string, d dbDiff) error {
+	if format == "json" {
+		if err := json.NewEncoder(w).Encode(d); err != nil {
+			return xerrors.Errorf("Failed to encode diff. err: %w", err)
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FAMILY\tVERSION\tADDED\tREMOVED\tCHANGED\tUNCHANGED")
+	for _, r := range d.Roots {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\n", r.Family, r.OSVersion, len(r.Added), len(r.Removed), len(r.Changed), r.Unchanged)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, r := range d.Roots {
+		if len(r.Added)+len(r.Removed)+len(r.Changed) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s %s\n", r.Family, r.OSVersion)
+		for _, id := range r.Added {
+			fmt.Fprintf(w, "+ %s\n", id)
+		}
+		for _, id := range r.Removed {
+			fmt.Fprintf(w, "- %s\n", id)
+		}
+		for _, c := range r.Changed {
+			fmt.Fprintf(w, "~ %s\n", c.DefinitionID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// newDiffTestDBs returns the old DB and the new one of redhat 7, where 20170001 is removed, 20170002 is unchanged,
+// 20170003 is changed of the fixed version of kernel and the arch of python, and 20170004 is added, and of debian 12 only in the new DB
+func newDiffTestDBs(t *testing.T) (string, string) {
+	t.Helper()
+
+	def := func(id, cveID string, packs ...models.Package) models.Definition {
+		return models.Definition{DefinitionID: id, Title: id, Advisory: models.Advisory{Cves: []models.Cve{{CveID: cveID}}}, AffectedPacks: packs}
+	}
+	timestamp := time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)
+	oldPath := testdb.File(t, filepath.Join(t.TempDir(), "old.sqlite3"), &models.Root{
+		Family:    c.RedHat,
+		OSVersion: "7",
+		Timestamp: timestamp,
+		Definitions: []models.Definition{
+			def("oval:com.redhat.rhsa:def:20170001", "CVE-2017-0001", models.Package{Name: "openssl", Version: "1:1.0.2k-8.el7"}),
+			def("oval:com.redhat.rhsa:def:20170002", "CVE-2017-0002", models.Package{Name: "bash", Version: "0:4.2.46-29.el7"}),
+			def("oval:com.redhat.rhsa:def:20170003", "CVE-2017-0003",
+				models.Package{Name: "kernel", Version: "0:3.10.0-514.16.1.el7"},
+				models.Package{Name: "python", Version: "0:2.7.5-58.el7", Arch: "x86_64"},
+				models.Package{Name: "perf", Version: "0:3.10.0-514.16.1.el7"},
+			),
+		},
+	})
+	newPath := testdb.File(t, filepath.Join(t.TempDir(), "new.sqlite3"),
+		&models.Root{
+			Family:    c.RedHat,
+			OSVersion: "7",
+			Timestamp: timestamp.Add(24 * time.Hour),
+			Definitions: []models.Definition{
+				def("oval:com.redhat.rhsa:def:20170002", "CVE-2017-0002", models.Package{Name: "bash", Version: "0:4.2.46-29.el7"}),
+				def("oval:com.redhat.rhsa:def:20170003", "CVE-2017-0003",
+					models.Package{Name: "kernel", Version: "0:3.10.0-514.21.1.el7"},
+					models.Package{Name: "python", Version: "0:2.7.5-58.el7", Arch: "aarch64"},
+					models.Package{Name: "perf", Version: "0:3.10.0-514.16.1.el7"},
+				),
+				def("oval:com.redhat.rhsa:def:20170004", "CVE-2017-0004", models.Package{Name: "curl", NotFixedYet: true}),
+			},
+		},
+		&models.Root{
+			Family:      c.Debian,
+			OSVersion:   "12",
+			Timestamp:   timestamp,
+			Definitions: []models.Definition{def("oval:org.debian:def:20231234", "CVE-2023-1234", models.Package{Name: "openssl", Version: "3.0.9-1"})},
+		},
+	)
+	return oldPath, newPath
+}
+
+func TestDiff(t *testing.T) {
+	oldPath, newPath := newDiffTestDBs(t)
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "all",
+			want: `FAMILY  VERSION  ADDED  REMOVED  CHANGED  UNCHANGED
+debian  12       1      0        0        0
+redhat  7        1      1        1        1
+
+debian 12
++ oval:org.debian:def:20231234
+
+redhat 7
++ oval:com.redhat.rhsa:def:20170004
+- oval:com.redhat.rhsa:def:20170001
+~ oval:com.redhat.rhsa:def:20170003
+`,
+		},
+		{
+			name: "family and release",
+			args: []string{"--family", "RedHat", "--release", "7"},
+			want: `FAMILY  VERSION  ADDED  REMOVED  CHANGED  UNCHANGED
+redhat  7        1      1        1        1
+
+redhat 7
++ oval:com.redhat.rhsa:def:20170004
+- oval:com.redhat.rhsa:def:20170001
+~ oval:com.redhat.rhsa:def:20170003
+`,
+		},
+		{
+			name:    "no OVAL",
+			args:    []string{"--family", "ubuntu"},
+			wantErr: "Failed to find OVAL in either DB",
+		},
+		{
+			name:    "release without family",
+			args:    []string{"--release", "7"},
+			wantErr: "--release requires --family",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				for _, name := range []string{"family", "release"} {
+					_ = diffCmd.PersistentFlags().Set(name, "")
+				}
+				RootCmd.SetOut(nil)
+			}()
+
+			var out bytes.Buffer
+			RootCmd.SetOut(&out)
+			RootCmd.SetArgs(append([]string{"diff", "--old", oldPath, "--new", newPath}, tt.args...))
+			err := RootCmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected: %s, actual: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("expected: %q, actual: %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	oldPath, newPath := newDiffTestDBs(t)
+	defer func() {
+		for name, v := range map[string]string{"family": "", "release": "", "format": "text"} {
+			_ = diffCmd.PersistentFlags().Set(name, v)
+		}
+		RootCmd.SetOut(nil)
+	}()
+
+	var out bytes.Buffer
+	RootCmd.SetOut(&out)
+	RootCmd.SetArgs([]string{"diff", "--old", oldPath, "--new", newPath, "--family", "redhat", "--release", "7", "--format", "json"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var d dbDiff
+	if err := json.Unmarshal(out.Bytes(), &d); err != nil {
+		t.Fatalf("Failed to unmarshal %s. err: %s", out.Bytes(), err)
+	}
+	want := []rootDiff{{
+		Family:    c.RedHat,
+		OSVersion: "7",
+		Added:     []string{"oval:com.redhat.rhsa:def:20170004"},
+		Removed:   []string{"oval:com.redhat.rhsa:def:20170001"},
+		Changed: []definitionChange{{
+			DefinitionID: "oval:com.redhat.rhsa:def:20170003",
+			Packages: []packageChange{
+				{Name: "kernel", Change: "changed", OldVersion: "0:3.10.0-514.16.1.el7", NewVersion: "0:3.10.0-514.21.1.el7"},
+				{Name: "python", Arch: "aarch64", Change: "added", NewVersion: "0:2.7.5-58.el7"},
+				{Name: "python", Arch: "x86_64", Change: "removed", OldVersion: "0:2.7.5-58.el7"},
+			},
+		}},
+		Unchanged: 1,
+	}}
+	if d.Old != oldPath || d.New != newPath || !reflect.DeepEqual(d.Roots, want) {
+		t.Errorf("expected: %+v, actual: %+v", want, d)
+	}
+}
@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/vulsio/goval-dictionary/db"
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// The exit statuses by the class of the failure, so that the automation retries the failures of the mirror or DB but not of the usage
+const (
+	// ExitUsage is the status on the usage error, e.g. the unknown flag or version, and on the failures not classified below
+	ExitUsage = 1
+	// ExitFetch is the status on the failure of the download which may succeed if retried, e.g. the network error or 503 of the mirror
+	ExitFetch = 2
+	// ExitParse is the status on the fetched file failed to parse or the converted OVAL failed to validate
+	ExitParse = 3
+	// ExitDB is the status on the failure of DB, e.g. connecting, migrating, locking or inserting
+	ExitDB = 4
+	// ExitTimedOut is the status on exceeding --run-timeout, as timeout(1) exits with
+	ExitTimedOut = 124
+)
+
+// ExitCode returns the exit status of err returned by Execute, 0 if nil.
+// Of the versions failed in a run for the different classes, the first class in the order of DB, fetch and parse wins.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case someError(err, func(e error) bool { return e == context.DeadlineExceeded }):
+		return ExitTimedOut
+	case someError(err, func(e error) bool {
+		_, ok := e.(*db.Error)
+		return ok || e == db.ErrLocked
+	}):
+		return ExitDB
+	case someError(err, func(e error) bool {
+		fe, ok := e.(*fetcherutil.FetchError)
+		return ok && fe.Temporary()
+	}):
+		return ExitFetch
+	case someError(err, func(e error) bool {
+		_, ok := e.(*fetcherutil.ParseError)
+		return ok || e == models.ErrInvalidOVAL
+	}):
+		return ExitParse
+	default:
+		return ExitUsage
+	}
+}
+
+// someError reports whether any error in the tree of err satisfies f, following the errors wrapped by Unwrap() error and Unwrap() []error
+func someError(err error, f func(error) bool) bool {
+	if err == nil {
+		return false
+	}
+	if f(err) {
+		return true
+	}
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		return someError(u.Unwrap(), f)
+	case interface{ Unwrap() []error }:
+		for _, e := range u.Unwrap() {
+			if someError(e, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchCmd.PersistentFlags().Set("retry", "3")
+		// unset, not to take precedence over GOVAL_DICTIONARY_RETRY in the other tests
+		fetchCmd.PersistentFlags().Lookup("retry").Changed = false
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		_ = fetchSUSECmd.Flags().Set("base-url", "")
+	}()
+
+	// 15 is down for maintenance while 12 is not on the mirror
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/suse.linux.enterprise.server.15.xml" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"suse.linux.enterprise.server.15.xml": localSUSEOVAL,
+		"suse.linux.enterprise.server.12.xml": localSUSEOVAL[:len(localSUSEOVAL)/2],
+		"garbage.sqlite3":                     "not a database",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0600); err != nil {
+			t.Fatalf("Failed to write fixture. err: %s", err)
+		}
+	}
+	remote := []string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--base-url", ts.URL + "/", "--retry", "0", "--dbpath", filepath.Join(t.TempDir(), "oval.sqlite3")}
+	local := []string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{
+			name: "unknown flag",
+			args: []string{"fetch", "suse", "--no-such-flag", "15"},
+			want: ExitUsage,
+		},
+		{
+			name: "mirror unavailable",
+			args: append(remote, "15"),
+			want: ExitFetch,
+		},
+		{
+			name: "unknown version",
+			args: append(remote, "12"),
+			want: ExitUsage,
+		},
+		{
+			name: "unknown version and mirror unavailable",
+			args: append(remote, "12", "15"),
+			want: ExitFetch,
+		},
+		{
+			name: "broken XML",
+			args: append(local, "--dbpath", filepath.Join(t.TempDir(), "oval.sqlite3"), "12"),
+			want: ExitParse,
+		},
+		{
+			name: "broken DB",
+			args: append(local, "--dbpath", filepath.Join(dir, "garbage.sqlite3"), "15"),
+			want: ExitDB,
+		},
+		{
+			name: "success",
+			args: append(local, "--dbpath", filepath.Join(t.TempDir(), "oval.sqlite3"), "15"),
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+				_ = fetchSUSECmd.Flags().Set("base-url", "")
+			}()
+
+			RootCmd.SetArgs(tt.args)
+			err := RootCmd.Execute()
+			if got := ExitCode(err); got != tt.want {
+				t.Errorf("expected: %d, actual: %d, err: %v", tt.want, got, err)
+			}
+		})
+	}
+}
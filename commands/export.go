@@ -0,0 +1,214 @@
+package commands
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// exportCmd is Subcommand to dump the stored OVAL to files
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the OVAL in DB to JSON files",
+	Long: `Export the OVAL of each family and version in DB to the gzipped JSON file of the Root with its definitions, sorted by the definition ID,
+and the manifest of the export, e.g. to ship them to the site where fetch is impossible.`,
+	Args: cobra.NoArgs,
+	RunE: executeExport,
+	Example: `$ goval-dictionary export --dir ./dump
+$ goval-dictionary export --dir ./dump --family redhat --release 7`,
+
+	PersistentPreRunE: setLogger,
+}
+
+// exportManifestName is the file name of the manifest of the export
+const exportManifestName = "manifest.json"
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+
+	// bound to "export.*", as "family" and "release" are bound to the ones of purge
+	exportCmd.PersistentFlags().String("dir", "", "the directory to export the OVAL to, created if missing")
+	bindFlag("export.dir", exportCmd.PersistentFlags().Lookup("dir"))
+
+	exportCmd.PersistentFlags().String("family", "", "the family to export as shown by status, e.g. redhat, all the families if empty")
+	bindFlag("export.family", exportCmd.PersistentFlags().Lookup("family"))
+
+	exportCmd.PersistentFlags().String("release", "", "the version of --family to export as shown by status, all the versions if empty")
+	bindFlag("export.release", exportCmd.PersistentFlags().Lookup("release"))
+}
+
+// exportManifest is the manifest of the export, with the FetchMeta of DB and the exported files
+type exportManifest struct {
+	GovalDictRevision string            `json:"govalDictRevision"`
+	SchemaVersion     uint              `json:"schemaVersion"`
+	LastFetchedAt     time.Time         `json:"lastFetchedAt"`
+	SHA256            map[string]string `json:"sha256"` // SHA-256 of the fetched files by URL, as in FetchMeta
+	Files             []exportFile      `json:"files"`
+}
+
+// exportFile is the file of the OVAL of a family and a version in the export
+type exportFile struct {
+	Name        string    `json:"name"`
+	Family      string    `json:"family"`
+	OSVersion   string    `json:"osVersion"`
+	Timestamp   time.Time `json:"timestamp"`
+	Definitions int       `json:"definitions"`
+	Packages    int       `json:"packages"`
+	SHA256      string    `json:"sha256"` // SHA-256 of the gzipped file
+}
+
+func executeExport(cmd *cobra.Command, _ []string) error {
+	dir := viper.GetString("export.dir")
+	if dir == "" {
+		return xerrors.New("Failed to export. err: specify --dir")
+	}
+	family, err := familyFlag("export.family")
+	if err != nil {
+		return xerrors.Errorf("Failed to export. err: %w", err)
+	}
+	release := viper.GetString("export.release")
+	if family == "" && release != "" {
+		return xerrors.New("Failed to export. err: --release requires --family")
+	}
+
+	path, err := resolveDBPath(true)
+	if err != nil {
+		return err
+	}
+	driver, err := openDB(path, db.Option{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer driver.CloseDB()
+
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+	}
+	if fetchMeta.OutDated() {
+		return xerrors.Errorf("Failed to export. err: SchemaVersion is old. SchemaVersion: %+v", map[string]uint{"latest": models.LatestSchemaVersion, "DB": fetchMeta.SchemaVersion})
+	}
+	stats, err := driver.GetRootStats()
+	if err != nil {
+		return xerrors.Errorf("Failed to get the stats of OVAL. err: %w", err)
+	}
+	targets := []models.RootStat{}
+	for _, s := range stats {
+		if matchRoot(s, family, release) {
+			targets = append(targets, s)
+		}
+	}
+	if len(targets) == 0 {
+		return xerrors.Errorf("Failed to find OVAL in DB. family: %q, release: %q", family, release)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return xerrors.Errorf("Failed to create directory. dir: %s, err: %w", dir, err)
+	}
+	manifest := exportManifest{
+		GovalDictRevision: fetchMeta.GovalDictRevision,
+		SchemaVersion:     fetchMeta.SchemaVersion,
+		LastFetchedAt:     fetchMeta.LastFetchedAt.UTC(),
+		SHA256:            fetchMeta.SHA256,
+		Files:             []exportFile{},
+	}
+	for _, t := range targets {
+		f, err := exportRoot(cmd.Context(), driver, dir, t)
+		if err != nil {
+			return xerrors.Errorf("Failed to export OVAL. family: %s, osVer: %s, err: %w", t.Family, t.OSVersion, err)
+		}
+		log15.Info("Exported", "Family", f.Family, "Version", f.OSVersion, "Definitions", f.Definitions, "Packages", f.Packages, "File", f.Name)
+		manifest.Files = append(manifest.Files, f)
+	}
+
+	bs, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal manifest. err: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, exportManifestName), append(bs, '\n'), 0644); err != nil {
+		return xerrors.Errorf("Failed to write manifest. err: %w", err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Exported %d OVAL to %s\n", len(manifest.Files), dir)
+	return nil
+}
+
+// exportRoot writes the OVAL of stat to the gzipped JSON file of the Root in dir, encoding the definitions one by one as they are iterated,
+// and returns the file with the numbers of the written definitions and packages
+func exportRoot(ctx context.Context, driver db.DB, dir string, stat models.RootStat) (ef exportFile, err error) {
+	ef = exportFile{Name: fmt.Sprintf("%s-%s.json.gz", stat.Family, stat.OSVersion), Family: stat.Family, OSVersion: stat.OSVersion, Timestamp: stat.Timestamp.UTC()}
+	path := filepath.Join(dir, ef.Name)
+	f, err := os.Create(path)
+	if err != nil {
+		return exportFile{}, xerrors.Errorf("Failed to create file. path: %s, err: %w", path, err)
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = xerrors.Errorf("Failed to close file. path: %s, err: %w", path, cerr)
+		}
+		if err != nil {
+			_ = os.Remove(path)
+		}
+	}()
+
+	h := sha256.New()
+	// the header of gzip has no name and no modification time, so that the same OVAL is exported to the same bytes
+	gz := gzip.NewWriter(io.MultiWriter(f, h))
+
+	// the Root without the definitions, which are written after it
+	head, err := json.Marshal(struct {
+		Family    string    `json:"family"`
+		OSVersion string    `json:"osVersion"`
+		Timestamp time.Time `json:"timestamp"`
+		FileSize  int64     `json:"fileSize"`
+		SHA256    string    `json:"sha256"`
+	}{Family: ef.Family, OSVersion: ef.OSVersion, Timestamp: ef.Timestamp, FileSize: stat.FileSize, SHA256: stat.SHA256})
+	if err != nil {
+		return exportFile{}, xerrors.Errorf("Failed to marshal root. err: %w", err)
+	}
+	if _, err := fmt.Fprintf(gz, `%s,"definitions":[`, head[:len(head)-1]); err != nil {
+		return exportFile{}, xerrors.Errorf("Failed to write root. err: %w", err)
+	}
+	if err := driver.IterateDefinitions(ctx, stat.Family, stat.OSVersion, func(d models.Definition) error {
+		if ef.Definitions > 0 {
+			if _, err := io.WriteString(gz, ","); err != nil {
+				return xerrors.Errorf("Failed to write definition. err: %w", err)
+			}
+		}
+		bs, err := json.Marshal(d)
+		if err != nil {
+			return xerrors.Errorf("Failed to marshal definition. defID: %s, err: %w", d.DefinitionID, err)
+		}
+		if _, err := gz.Write(bs); err != nil {
+			return xerrors.Errorf("Failed to write definition. err: %w", err)
+		}
+		ef.Definitions++
+		ef.Packages += len(d.AffectedPacks)
+		return nil
+	}); err != nil {
+		return exportFile{}, xerrors.Errorf("Failed to iterate definitions. err: %w", err)
+	}
+	if _, err := io.WriteString(gz, "]}\n"); err != nil {
+		return exportFile{}, xerrors.Errorf("Failed to write root. err: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return exportFile{}, xerrors.Errorf("Failed to close gzip. err: %w", err)
+	}
+
+	ef.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return ef, nil
+}
@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+func TestExport(t *testing.T) {
+	dbpath := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), statusTestRoots()...)
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantFiles []string
+		wantErr   string
+	}{
+		{
+			name:      "all",
+			wantFiles: []string{"debian-12.json.gz", "redhat-7.json.gz"},
+		},
+		{
+			name:      "family and release",
+			args:      []string{"--family", "RedHat", "--release", "7"},
+			wantFiles: []string{"redhat-7.json.gz"},
+		},
+		{
+			name:    "release not stored",
+			args:    []string{"--family", "redhat", "--release", "8"},
+			wantErr: "Failed to find OVAL in DB",
+		},
+		{
+			name:    "release without family",
+			args:    []string{"--release", "7"},
+			wantErr: "--release requires --family",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				for _, name := range []string{"dir", "family", "release"} {
+					_ = exportCmd.PersistentFlags().Set(name, "")
+				}
+				RootCmd.SetOut(nil)
+			}()
+
+			dir := filepath.Join(t.TempDir(), "dump")
+			var out bytes.Buffer
+			RootCmd.SetOut(&out)
+			RootCmd.SetArgs(append([]string{"export", "--dbpath", dbpath, "--dir", dir}, tt.args...))
+			err := RootCmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected: %s, actual: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var manifest exportManifest
+			bs, err := os.ReadFile(filepath.Join(dir, exportManifestName))
+			if err != nil {
+				t.Fatalf("Failed to read manifest. err: %s", err)
+			}
+			if err := json.Unmarshal(bs, &manifest); err != nil {
+				t.Fatalf("Failed to unmarshal manifest. err: %s", err)
+			}
+			if manifest.SchemaVersion != models.LatestSchemaVersion {
+				t.Errorf("expected: schema version %d, actual: %d", models.LatestSchemaVersion, manifest.SchemaVersion)
+			}
+			names := []string{}
+			for _, f := range manifest.Files {
+				names = append(names, f.Name)
+				bs, err := os.ReadFile(filepath.Join(dir, f.Name))
+				if err != nil {
+					t.Fatalf("Failed to read %s. err: %s", f.Name, err)
+				}
+				if sum := sha256.Sum256(bs); hex.EncodeToString(sum[:]) != f.SHA256 {
+					t.Errorf("%s expected: sha256 %s, actual: %x", f.Name, f.SHA256, sum)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.wantFiles) {
+				t.Errorf("expected: %q, actual: %q", tt.wantFiles, names)
+			}
+		})
+	}
+}
+
+func TestExportRoot(t *testing.T) {
+	dbpath := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), statusTestRoots()...)
+	defer func() {
+		_ = exportCmd.PersistentFlags().Set("dir", "")
+		RootCmd.SetOut(nil)
+	}()
+
+	// exported twice to the same bytes
+	dirs := []string{filepath.Join(t.TempDir(), "1"), filepath.Join(t.TempDir(), "2")}
+	for _, dir := range dirs {
+		RootCmd.SetOut(&bytes.Buffer{})
+		RootCmd.SetArgs([]string{"export", "--dbpath", dbpath, "--dir", dir})
+		if err := RootCmd.Execute(); err != nil {
+			t.Fatalf("Failed to export. err: %s", err)
+		}
+	}
+	for _, name := range []string{exportManifestName, "debian-12.json.gz", "redhat-7.json.gz"} {
+		bs1, err := os.ReadFile(filepath.Join(dirs[0], name))
+		if err != nil {
+			t.Fatalf("Failed to read %s. err: %s", name, err)
+		}
+		bs2, err := os.ReadFile(filepath.Join(dirs[1], name))
+		if err != nil {
+			t.Fatalf("Failed to read %s. err: %s", name, err)
+		}
+		if !bytes.Equal(bs1, bs2) {
+			t.Errorf("expected: %s exported to the same bytes", name)
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dirs[0], "debian-12.json.gz"))
+	if err != nil {
+		t.Fatalf("Failed to open. err: %s", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Failed to read gzip. err: %s", err)
+	}
+	var root models.Root
+	if err := json.NewDecoder(gz).Decode(&root); err != nil {
+		t.Fatalf("Failed to decode root. err: %s", err)
+	}
+	if root.Family != c.Debian || root.OSVersion != "12" || len(root.Definitions) != 1 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	d := root.Definitions[0]
+	if d.DefinitionID != "oval:org.debian:def:20231234" || len(d.Advisory.Cves) != 1 || d.Advisory.Cves[0].CveID != "CVE-2023-1234" {
+		t.Errorf("unexpected definition: %+v", d)
+	}
+	packs := []string{}
+	for _, p := range d.AffectedPacks {
+		packs = append(packs, p.Name+" "+p.Version)
+	}
+	if want := []string{"openssl 3.0.9-1", "libssl3 3.0.9-1"}; !reflect.DeepEqual(packs, want) {
+		t.Errorf("expected: %q, actual: %q", want, packs)
+	}
+}
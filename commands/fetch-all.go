@@ -0,0 +1,207 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/goval"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// fetchAllCmd is Subcommand for fetch the families configured in the config file
+var fetchAllCmd = &cobra.Command{
+	Use:   "all [family]",
+	Short: "Fetch Vulnerability dictionary of the families in the config file",
+	Long: `Fetch Vulnerability dictionary of the families in the config file, e.g. [debian] versions = ["11", "12"], one after another.
+The failed family does not stop the others, unless --fail-fast.`,
+	Args:      cobra.OnlyValidArgs,
+	ValidArgs: fetchAllFamilies,
+	RunE:      fetchAll,
+	Example: `$ goval-dictionary fetch all --config /etc/goval-dictionary/config.toml
+$ goval-dictionary fetch all --config /etc/goval-dictionary/config.toml debian redhat`,
+}
+
+// fetchAllFamilies are the sections of the config file fetched by fetch all, in the order of the fetches
+var fetchAllFamilies = []string{c.Alpine, c.Amazon, c.Debian, c.Fedora, c.Oracle, c.RedHat, "suse", c.Ubuntu}
+
+func init() {
+	fetchCmd.AddCommand(fetchAllCmd)
+}
+
+// familyFetch is the fetch of a family by fetch all, of the section family loading load, e.g. the SUSE type of [suse] type
+type familyFetch struct {
+	family   string
+	load     string
+	versions []string
+}
+
+// familySummary is the result of a family by fetch all, err is the one stopping the family, e.g. failing to open the DB
+type familySummary struct {
+	family  string
+	summary goval.Summary
+	err     error
+}
+
+func fetchAll(cmd *cobra.Command, args []string) (err error) {
+	ctx, cancel := fetchContext(cmd)
+	defer cancel()
+
+	if viper.GetBool("list") {
+		return xerrors.New("--list is not supported for fetch all, list the versions by the fetch subcommand of the family")
+	}
+
+	conf, err := c.Load(viper.GetViper())
+	if err != nil {
+		return xerrors.Errorf("Failed to load config. err: %w", err)
+	}
+	fetches, err := familyFetches(conf, args)
+	if err != nil {
+		return err
+	}
+
+	summaries, err := runFetchAll(ctx, fetches)
+	if err != nil {
+		return err
+	}
+	return finishAll(cmd.OutOrStdout(), summaries)
+}
+
+// runFetchAll runs fetches one after another, as each of them updates the FetchMeta shared in the DB, continuing with the other families
+// on the failure of a family unless --fail-fast or ctx is done
+func runFetchAll(ctx context.Context, fetches []familyFetch) ([]familySummary, error) {
+	summaries := []familySummary{}
+	for _, f := range fetches {
+		log15.Info("Fetching", "Family", f.family, "Versions", f.versions)
+		summary, err := runFetch(ctx, f.load, f.versions)
+		s := familySummary{family: f.family, summary: summary}
+		if err != nil {
+			if viper.GetBool("fail-fast") || ctx.Err() != nil {
+				return nil, xerrors.Errorf("Failed to fetch %s. err: %w", f.family, err)
+			}
+			log15.Error("Failed to fetch, continue with the other families", "Family", f.family, "err", err)
+			s.err = err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
+
+// familyFetches returns the fetches of families, or of all the families whose versions are in the config file if none
+func familyFetches(conf c.Conf, families []string) ([]familyFetch, error) {
+	versions := map[string][]string{
+		c.Alpine: conf.Alpine.Versions,
+		c.Amazon: conf.Amazon.Versions,
+		c.Debian: conf.Debian.Versions,
+		c.Fedora: conf.Fedora.Versions,
+		c.Oracle: conf.Oracle.Versions,
+		c.RedHat: conf.RedHat.Versions,
+		"suse":   conf.SUSE.Versions,
+		c.Ubuntu: conf.Ubuntu.Versions,
+	}
+	configured := func(family string) bool {
+		// [debian] all = true detects the versions instead
+		return len(versions[family]) > 0 || (family == c.Debian && conf.Debian.All)
+	}
+
+	if len(families) == 0 {
+		for _, family := range fetchAllFamilies {
+			if configured(family) {
+				families = append(families, family)
+			}
+		}
+		if len(families) == 0 {
+			return nil, xerrors.New(`Failed to find the families to fetch. err: no versions in the config file, e.g. [debian] versions = ["11", "12"]`)
+		}
+	}
+
+	fetches := []familyFetch{}
+	for _, family := range uniqueFamilies(families) {
+		if !configured(family) {
+			return nil, xerrors.Errorf(`Failed to find the versions of %s. err: no versions in the config file, e.g. [%s] versions = ["..."]`, family, family)
+		}
+		f := familyFetch{family: family, load: family, versions: versions[family]}
+		if family == "suse" {
+			name := conf.SUSE.Type
+			if name == "" {
+				name = conf.SUSEType
+			}
+			suseType, err := parseSUSEType(name)
+			if err != nil {
+				return nil, xerrors.Errorf("Failed to parse [suse] type. err: %w", err)
+			}
+			f.load = suseType
+		}
+		fetches = append(fetches, f)
+	}
+	return fetches, nil
+}
+
+// uniqueFamilies returns families in the order of fetchAllFamilies, without the duplicates
+func uniqueFamilies(families []string) []string {
+	unique := []string{}
+	for _, family := range fetchAllFamilies {
+		for _, f := range families {
+			if f == family {
+				unique = append(unique, family)
+				break
+			}
+		}
+	}
+	return unique
+}
+
+// finishAll prints the summary of all the families with their new advisories by their severity, writes it to --summary-file if given, and returns the error of the failed ones, where the failed versions are ignored by --ignore-errors
+func finishAll(w io.Writer, summaries []familySummary) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FAMILY\tVERSION\tSTATUS\tDEFINITIONS\tPACKAGES\tCVES\tNEW\tUPDATED\tUNCHANGED\tREMOVED\tERROR")
+	msgs, errs := []string{}, []error{}
+	failed := 0
+	change := models.ChangeStat{}
+	for _, s := range summaries {
+		change = change.Add(s.summary.Change())
+		n := len(msgs)
+		for _, v := range s.summary.Versions {
+			msg := "-"
+			if v.Err != nil {
+				msg = v.Err.Error()
+				if !viper.GetBool("ignore-errors") {
+					msgs = append(msgs, fmt.Sprintf("%s %s: %s", s.family, v.Version, v.Err))
+					errs = append(errs, v.Err)
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", s.family, v.Version, v.Status, v.Definitions, v.Packages, v.CVEs, v.Change.New, v.Change.Updated, v.Change.Unchanged, v.Change.Removed, msg)
+		}
+		if s.err != nil {
+			fmt.Fprintf(tw, "%s\t-\t%s\t0\t0\t0\t0\t0\t0\t0\t%s\n", s.family, goval.StatusFailed, s.err)
+			msgs = append(msgs, fmt.Sprintf("%s: %s", s.family, s.err))
+			errs = append(errs, s.err)
+		}
+		if len(msgs) > n {
+			failed++
+		}
+	}
+	_ = tw.Flush()
+	printNewAdvisories(w, summaries, true)
+	printSourceChanges(w, summaries, true)
+	printClockSkews(w, summaries, true)
+	log15.Info("Summary", "Families", len(summaries), "Failed", failed, "New", change.New, "Updated", change.Updated, "Unchanged", change.Unchanged, "Removed", change.Removed)
+	logConnStats()
+	if err := writeSummaryFile(summaries); err != nil {
+		return err
+	}
+	pushSummary(summaries)
+
+	if len(msgs) == 0 {
+		return nil
+	}
+	return &multiError{msg: fmt.Sprintf("Failed to fetch %d of %d family(s). err: [%s]", failed, len(summaries), strings.Join(msgs, ", ")), errs: errs}
+}
@@ -1,84 +1,49 @@
 package commands
 
 import (
-	"time"
-
-	"github.com/inconshreveable/log15"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"golang.org/x/xerrors"
 
 	c "github.com/vulsio/goval-dictionary/config"
-	"github.com/vulsio/goval-dictionary/db"
 	fetcher "github.com/vulsio/goval-dictionary/fetcher/amazon"
-	"github.com/vulsio/goval-dictionary/log"
-	"github.com/vulsio/goval-dictionary/models"
-	"github.com/vulsio/goval-dictionary/models/amazon"
-	"github.com/vulsio/goval-dictionary/util"
 )
 
 // fetchAmazonCmd is Subcommand for fetch Amazon ALAS RSS
 // https://alas.aws.amazon.com/alas.rss
 var fetchAmazonCmd = &cobra.Command{
-	Use:     "amazon [version]",
-	Short:   "Fetch Vulnerability dictionary from Amazon ALAS",
-	Long:    `Fetch Vulnerability dictionary from Amazon ALAS`,
-	Args:    cobra.MinimumNArgs(1),
-	RunE:    fetchAmazon,
-	Example: "$ goval-dictionary fetch amazon 1 2 2022 2023",
+	Use:   "amazon [version]",
+	Short: "Fetch Vulnerability dictionary from Amazon ALAS",
+	Long:  `Fetch Vulnerability dictionary from Amazon ALAS`,
+	Args:  fetchArgs,
+	RunE:  fetchAmazon,
+	Example: `$ goval-dictionary fetch amazon 1 2 2022 2023
+$ goval-dictionary fetch amazon --since-year 2020 2
+$ goval-dictionary fetch amazon --base-url https://mirror.example.com/amazonlinux/ 2 2023`,
 }
 
 func init() {
 	fetchCmd.AddCommand(fetchAmazonCmd)
+	fetchAmazonCmd.ValidArgsFunction = versionCompletions(fetcher.ListVersions)
+	addBaseURLFlag(fetchAmazonCmd, c.Amazon)
+	addIssuedYearFlags(fetchAmazonCmd, c.Amazon)
 }
 
-func fetchAmazon(_ *cobra.Command, args []string) (err error) {
-	if err := log.SetLogger(viper.GetBool("log-to-file"), viper.GetString("log-dir"), viper.GetBool("debug"), viper.GetBool("log-json")); err != nil {
-		return xerrors.Errorf("Failed to SetLogger. err: %w", err)
-	}
+func fetchAmazon(cmd *cobra.Command, args []string) (err error) {
+	ctx, cancel := fetchContext(cmd)
+	defer cancel()
 
-	driver, err := db.NewDB(viper.GetString("dbtype"), viper.GetString("dbpath"), viper.GetBool("debug-sql"), db.Option{})
-	if err != nil {
-		if xerrors.Is(err, db.ErrDBLocked) {
-			return xerrors.Errorf("Failed to open DB. Close DB connection before fetching. err: %w", err)
-		}
-		return xerrors.Errorf("Failed to open DB. err: %w", err)
+	if viper.GetBool("list") {
+		return printVersions(cmd.OutOrStdout(), c.Amazon, fetcher.ListVersions)
 	}
 
-	fetchMeta, err := driver.GetFetchMeta()
+	versions, err := fetchVersions(cmd, args)
 	if err != nil {
-		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
-	}
-	if fetchMeta.OutDated() {
-		return xerrors.Errorf("Failed to Insert CVEs into DB. SchemaVersion is old. SchemaVersion: %+v", map[string]uint{"latest": models.LatestSchemaVersion, "DB": fetchMeta.SchemaVersion})
-	}
-	// If the fetch fails the first time (without SchemaVersion), the DB needs to be cleaned every time, so insert SchemaVersion.
-	if err := driver.UpsertFetchMeta(fetchMeta); err != nil {
-		return xerrors.Errorf("Failed to upsert FetchMeta to DB. err: %w", err)
+		return err
 	}
 
-	m, err := fetcher.FetchFiles(util.Unique(args))
+	summary, err := runFetch(ctx, c.Amazon, versions)
 	if err != nil {
-		return xerrors.Errorf("Failed to fetch files. err: %w", err)
+		return err
 	}
-	for ver, us := range m {
-		root := models.Root{
-			Family:      c.Amazon,
-			OSVersion:   ver,
-			Definitions: amazon.ConvertToModel(us),
-			Timestamp:   time.Now(),
-		}
-
-		if err := driver.InsertOval(&root); err != nil {
-			return xerrors.Errorf("Failed to insert OVAL. err: %w", err)
-		}
-		log15.Info("Finish", "Updated", len(root.Definitions))
-	}
-
-	fetchMeta.LastFetchedAt = time.Now()
-	if err := driver.UpsertFetchMeta(fetchMeta); err != nil {
-		return xerrors.Errorf("Failed to upsert FetchMeta to DB. err: %w", err)
-	}
-
-	return nil
+	return finish(cmd.OutOrStdout(), summary)
 }
@@ -1,105 +1,58 @@
 package commands
 
 import (
-	"bytes"
-	"encoding/xml"
-	"strings"
-	"time"
-
-	"github.com/inconshreveable/log15"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"golang.org/x/net/html/charset"
-	"golang.org/x/xerrors"
 
 	c "github.com/vulsio/goval-dictionary/config"
-	"github.com/vulsio/goval-dictionary/db"
 	fetcher "github.com/vulsio/goval-dictionary/fetcher/debian"
-	"github.com/vulsio/goval-dictionary/log"
-	"github.com/vulsio/goval-dictionary/models"
-	"github.com/vulsio/goval-dictionary/models/debian"
-	"github.com/vulsio/goval-dictionary/util"
 )
 
 // fetchDebianCmd is Subcommand for fetch Debian OVAL
 var fetchDebianCmd = &cobra.Command{
-	Use:     "debian [version]",
-	Short:   "Fetch Vulnerability dictionary from Debian",
-	Long:    `Fetch Vulnerability dictionary from Debian`,
-	Args:    cobra.MinimumNArgs(1),
-	RunE:    fetchDebian,
-	Example: "$ goval-dictionary fetch debian 10 11",
+	Use:   "debian [version]",
+	Short: "Fetch Vulnerability dictionary from Debian",
+	Long:  `Fetch Vulnerability dictionary from Debian`,
+	Args:  fetchDebianArgs,
+	RunE:  fetchDebian,
+	Example: `$ goval-dictionary fetch debian 10 11
+$ goval-dictionary fetch debian --all
+$ goval-dictionary fetch debian --base-url https://mirror.example.com/debian/oval/ 10 11`,
 }
 
 func init() {
 	fetchCmd.AddCommand(fetchDebianCmd)
+	fetchDebianCmd.ValidArgsFunction = versionCompletions(fetcher.KnownVersions)
+	addBaseURLFlag(fetchDebianCmd, c.Debian)
+
+	fetchDebianCmd.Flags().Bool("all", false, "fetch all the releases whose OVAL is currently published, detected from the OVAL directory, unless the versions are given")
+	bindFlag("debian.all", fetchDebianCmd.Flags().Lookup("all"))
 }
 
-func fetchDebian(_ *cobra.Command, args []string) (err error) {
-	if err := log.SetLogger(viper.GetBool("log-to-file"), viper.GetString("log-dir"), viper.GetBool("debug"), viper.GetBool("log-json")); err != nil {
-		return xerrors.Errorf("Failed to SetLogger. err: %w", err)
+// fetchDebianArgs requires the versions to fetch, unless --all or --list
+func fetchDebianArgs(cmd *cobra.Command, args []string) error {
+	if viper.GetBool("debian.all") {
+		return nil
 	}
+	return fetchArgs(cmd, args)
+}
 
-	driver, err := db.NewDB(viper.GetString("dbtype"), viper.GetString("dbpath"), viper.GetBool("debug-sql"), db.Option{})
-	if err != nil {
-		if xerrors.Is(err, db.ErrDBLocked) {
-			return xerrors.Errorf("Failed to open DB. Close DB connection before fetching. err: %w", err)
-		}
-		return xerrors.Errorf("Failed to open DB. err: %w", err)
-	}
+func fetchDebian(cmd *cobra.Command, args []string) (err error) {
+	ctx, cancel := fetchContext(cmd)
+	defer cancel()
 
-	fetchMeta, err := driver.GetFetchMeta()
-	if err != nil {
-		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
-	}
-	if fetchMeta.OutDated() {
-		return xerrors.Errorf("Failed to Insert CVEs into DB. SchemaVersion is old. SchemaVersion: %+v", map[string]uint{"latest": models.LatestSchemaVersion, "DB": fetchMeta.SchemaVersion})
-	}
-	// If the fetch fails the first time (without SchemaVersion), the DB needs to be cleaned every time, so insert SchemaVersion.
-	if err := driver.UpsertFetchMeta(fetchMeta); err != nil {
-		return xerrors.Errorf("Failed to upsert FetchMeta to DB. err: %w", err)
+	if viper.GetBool("list") {
+		return printVersions(cmd.OutOrStdout(), c.Debian, func() ([]string, error) { return fetcher.ListVersions(ctx) })
 	}
 
-	results, err := fetcher.FetchFiles(util.Unique(args))
+	versions, err := fetchVersions(cmd, args)
 	if err != nil {
-		return xerrors.Errorf("Failed to fetch files. err: %w", err)
+		return err
 	}
 
-	for _, r := range results {
-		ovalroot := debian.Root{}
-
-		decoder := xml.NewDecoder(bytes.NewReader(r.Body))
-		decoder.CharsetReader = charset.NewReaderLabel
-		if err := decoder.Decode(&ovalroot); err != nil {
-			return xerrors.Errorf("Failed to unmarshal xml. url: %s, err: %w", r.URL, err)
-		}
-
-		log15.Info("Fetched", "File", r.URL[strings.LastIndex(r.URL, "/")+1:], "Count", len(ovalroot.Definitions.Definitions), "Timestamp", ovalroot.Generator.Timestamp)
-		ts, err := time.Parse("2006-01-02T15:04:05.999-07:00", ovalroot.Generator.Timestamp)
-		if err != nil {
-			return xerrors.Errorf("Failed to parse timestamp. url: %s, timestamp: %s, err: %w", r.URL, ovalroot.Generator.Timestamp, err)
-		}
-		if ts.Before(time.Now().AddDate(0, 0, -3)) {
-			log15.Warn("The fetched OVAL has not been updated for 3 days, the OVAL URL may have changed, please register a GitHub issue.", "GitHub", "https://github.com/vulsio/goval-dictionary/issues", "OVAL", r.URL, "Timestamp", ovalroot.Generator.Timestamp)
-		}
-
-		root := models.Root{
-			Family:      c.Debian,
-			OSVersion:   r.Target,
-			Definitions: debian.ConvertToModel(&ovalroot),
-			Timestamp:   time.Now(),
-		}
-
-		if err := driver.InsertOval(&root); err != nil {
-			return xerrors.Errorf("Failed to insert OVAL. err: %w", err)
-		}
-		log15.Info("Finish", "Updated", len(root.Definitions))
-	}
-
-	fetchMeta.LastFetchedAt = time.Now()
-	if err := driver.UpsertFetchMeta(fetchMeta); err != nil {
-		return xerrors.Errorf("Failed to upsert FetchMeta to DB. err: %w", err)
+	summary, err := runFetch(ctx, c.Debian, versions)
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return finish(cmd.OutOrStdout(), summary)
 }
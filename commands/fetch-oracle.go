@@ -1,108 +1,64 @@
 package commands
 
 import (
-	"encoding/xml"
-	"strings"
-	"time"
-
-	"github.com/inconshreveable/log15"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"golang.org/x/exp/slices"
 	"golang.org/x/xerrors"
 
 	c "github.com/vulsio/goval-dictionary/config"
-	"github.com/vulsio/goval-dictionary/db"
 	fetcher "github.com/vulsio/goval-dictionary/fetcher/oracle"
-	"github.com/vulsio/goval-dictionary/log"
-	"github.com/vulsio/goval-dictionary/models"
-	"github.com/vulsio/goval-dictionary/models/oracle"
 )
 
 // fetchOracleCmd is Subcommand for fetch Oracle OVAL
 var fetchOracleCmd = &cobra.Command{
-	Use:     "oracle [version]",
-	Short:   "Fetch Vulnerability dictionary from Oracle",
-	Long:    `Fetch Vulnerability dictionary from Oracle`,
-	Args:    cobra.MinimumNArgs(1),
-	RunE:    fetchOracle,
-	Example: "$ goval-dictionary fetch oracle 8 9",
+	Use:   "oracle [version]",
+	Short: "Fetch Vulnerability dictionary from Oracle",
+	Long: `Fetch Vulnerability dictionary from Oracle.
+Without the version args, fetch all the major versions of which Oracle provides the OVAL, unless --no-default-versions.`,
+	Args: fetchArgsOrDefault(c.Oracle),
+	RunE: fetchOracle,
+	Example: `$ goval-dictionary fetch oracle
+$ goval-dictionary fetch oracle 8 9
+$ goval-dictionary fetch oracle --years 2022,2023 8 9
+$ goval-dictionary fetch oracle --since-year 2015 7
+$ goval-dictionary fetch oracle --issued-years 2015-2018 7
+$ goval-dictionary fetch oracle --base-url https://mirror.example.com/oracle/oval/ 8 9`,
 }
 
 func init() {
 	fetchCmd.AddCommand(fetchOracleCmd)
+	fetchOracleCmd.ValidArgsFunction = versionCompletions(fetcher.ListVersions)
+	addBaseURLFlag(fetchOracleCmd, c.Oracle)
+	addIssuedYearFlags(fetchOracleCmd, c.Oracle)
+	addDefaultVersionsFlag(fetchOracleCmd, c.Oracle)
+
+	fetchOracleCmd.Flags().IntSlice("years", nil, "fetch only the OVAL of the years, e.g. 2022,2023, and merge it into the stored one instead of refreshing")
+	bindFlag("years", fetchOracleCmd.Flags().Lookup("years"))
 }
 
-func fetchOracle(_ *cobra.Command, args []string) (err error) {
-	if err := log.SetLogger(viper.GetBool("log-to-file"), viper.GetString("log-dir"), viper.GetBool("debug"), viper.GetBool("log-json")); err != nil {
-		return xerrors.Errorf("Failed to SetLogger. err: %w", err)
-	}
+func fetchOracle(cmd *cobra.Command, args []string) (err error) {
+	ctx, cancel := fetchContext(cmd)
+	defer cancel()
 
-	driver, err := db.NewDB(viper.GetString("dbtype"), viper.GetString("dbpath"), viper.GetBool("debug-sql"), db.Option{})
-	if err != nil {
-		if xerrors.Is(err, db.ErrDBLocked) {
-			return xerrors.Errorf("Failed to open DB. Close DB connection before fetching. err: %w", err)
-		}
-		return xerrors.Errorf("Failed to open DB. err: %w", err)
+	if viper.GetBool("list") {
+		return printVersions(cmd.OutOrStdout(), c.Oracle, fetcher.ListVersions)
 	}
 
-	fetchMeta, err := driver.GetFetchMeta()
+	versions, err := fetchVersions(cmd, args)
 	if err != nil {
-		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+		return err
 	}
-	if fetchMeta.OutDated() {
-		return xerrors.Errorf("Failed to Insert CVEs into DB. SchemaVersion is old. SchemaVersion: %+v", map[string]uint{"latest": models.LatestSchemaVersion, "DB": fetchMeta.SchemaVersion})
-	}
-	// If the fetch fails the first time (without SchemaVersion), the DB needs to be cleaned every time, so insert SchemaVersion.
-	if err := driver.UpsertFetchMeta(fetchMeta); err != nil {
-		return xerrors.Errorf("Failed to upsert FetchMeta to DB. err: %w", err)
-	}
-
-	results, err := fetcher.FetchFiles()
+	defaults, err := fetcher.ListVersions()
 	if err != nil {
-		return xerrors.Errorf("Failed to fetch files. err: %w", err)
+		return xerrors.Errorf("Failed to list versions. err: %w", err)
 	}
-
-	osVerDefs := map[string][]models.Definition{}
-	for _, r := range results {
-		ovalroot := oracle.Root{}
-		if err = xml.Unmarshal(r.Body, &ovalroot); err != nil {
-			return xerrors.Errorf("Failed to unmarshal xml. url: %s, err: %w", r.URL, err)
-		}
-		log15.Info("Fetched", "File", r.URL[strings.LastIndex(r.URL, "/")+1:], "Count", len(ovalroot.Definitions.Definitions), "Timestamp", ovalroot.Generator.Timestamp)
-		ts, err := time.Parse("2006-01-02T15:04:05", ovalroot.Generator.Timestamp)
-		if err != nil {
-			return xerrors.Errorf("Failed to parse timestamp. url: %s, timestamp: %s, err: %w", r.URL, ovalroot.Generator.Timestamp, err)
-		}
-		if ts.Before(time.Now().AddDate(0, 0, -3)) {
-			log15.Warn("The fetched OVAL has not been updated for 3 days, the OVAL URL may have changed, please register a GitHub issue.", "GitHub", "https://github.com/vulsio/goval-dictionary/issues", "OVAL", r.URL, "Timestamp", ovalroot.Generator.Timestamp)
-		}
-
-		for osVer, defs := range oracle.ConvertToModel(&ovalroot) {
-			if slices.Contains(args, osVer) {
-				osVerDefs[osVer] = append(osVerDefs[osVer], defs...)
-			}
-		}
+	if versions, err = defaultVersions(c.Oracle, versions, defaults, viper.GetBool(c.Oracle+".no-default-versions")); err != nil {
+		return err
 	}
 
-	for osVer, defs := range osVerDefs {
-		root := models.Root{
-			Family:      c.Oracle,
-			OSVersion:   osVer,
-			Definitions: defs,
-			Timestamp:   time.Now(),
-		}
-
-		if err := driver.InsertOval(&root); err != nil {
-			return xerrors.Errorf("Failed to insert OVAL. err: %w", err)
-		}
-		log15.Info("Finish", "Updated", len(root.Definitions))
-	}
-
-	fetchMeta.LastFetchedAt = time.Now()
-	if err := driver.UpsertFetchMeta(fetchMeta); err != nil {
-		return xerrors.Errorf("Failed to upsert FetchMeta to DB. err: %w", err)
+	summary, err := runFetch(ctx, c.Oracle, versions)
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return finish(cmd.OutOrStdout(), summary)
 }
@@ -1,8 +1,27 @@
 package commands
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/inconshreveable/log15"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/goval"
+	modelsutil "github.com/vulsio/goval-dictionary/models/util"
+	"github.com/vulsio/goval-dictionary/util"
 )
 
 // fetchCmd represents the fetch command
@@ -10,14 +29,466 @@ var fetchCmd = &cobra.Command{
 	Use:   "fetch",
 	Short: "Fetch Vulnerability dictionary",
 	Long:  `Fetch Vulnerability dictionary`,
+	// the logger and the flags of all the fetch subcommands
+	PersistentPreRunE: preFetch,
+}
+
+// preFetch sets the logger, and rejects the combinations of the flags shared by the fetch subcommands which do nothing
+func preFetch(cmd *cobra.Command, args []string) error {
+	if err := setLogger(cmd, args); err != nil {
+		return err
+	}
+	if viper.GetBool("no-insert") && viper.GetString("download-dir") == "" {
+		return xerrors.New("--no-insert requires --download-dir")
+	}
+	if viper.GetBool("store-source") && viper.GetString("dbtype") == "redis" {
+		return xerrors.New("--store-source is not supported for redis")
+	}
+	return nil
 }
 
 func init() {
 	RootCmd.AddCommand(fetchCmd)
 
 	fetchCmd.PersistentFlags().Bool("no-details", false, "without vulnerability details")
-	_ = viper.BindPFlag("no-details", fetchCmd.PersistentFlags().Lookup("no-details"))
+	bindFlag("no-details", fetchCmd.PersistentFlags().Lookup("no-details"))
 
 	fetchCmd.PersistentFlags().Int("batch-size", 25, "The number of batch size to insert.")
-	_ = viper.BindPFlag("batch-size", fetchCmd.PersistentFlags().Lookup("batch-size"))
+	bindFlag("batch-size", fetchCmd.PersistentFlags().Lookup("batch-size"))
+
+	fetchCmd.PersistentFlags().Int("retry", 3, "The number of retries on transient download failures")
+	bindFlag("retry", fetchCmd.PersistentFlags().Lookup("retry"))
+
+	fetchCmd.PersistentFlags().Duration("timeout", 10*time.Minute, "The timeout of each HTTP request including reading the body, no timeout if 0")
+	bindFlag("timeout", fetchCmd.PersistentFlags().Lookup("timeout"))
+
+	fetchCmd.PersistentFlags().Duration("run-timeout", 0, "The deadline of the whole run including fetching and inserting, no deadline if 0")
+	bindFlag("run-timeout", fetchCmd.PersistentFlags().Lookup("run-timeout"))
+
+	fetchCmd.PersistentFlags().Duration("dial-timeout", 30*time.Second, "The timeout of connecting to the server")
+	bindFlag("dial-timeout", fetchCmd.PersistentFlags().Lookup("dial-timeout"))
+
+	fetchCmd.PersistentFlags().Duration("tls-handshake-timeout", 10*time.Second, "The timeout of the TLS handshake")
+	bindFlag("tls-handshake-timeout", fetchCmd.PersistentFlags().Lookup("tls-handshake-timeout"))
+
+	fetchCmd.PersistentFlags().Int("threads", 3, "The number of files to download concurrently")
+	bindFlag("threads", fetchCmd.PersistentFlags().Lookup("threads"))
+
+	fetchCmd.PersistentFlags().Int("parse-workers", 0, "The number of files to decode and convert concurrently, GOMAXPROCS if 0")
+	bindFlag("parse-workers", fetchCmd.PersistentFlags().Lookup("parse-workers"))
+
+	fetchCmd.PersistentFlags().Float64("requests-per-second", 0, "The maximum number of requests per second to the mirror across all the downloads, no limit if 0")
+	bindFlag("requests-per-second", fetchCmd.PersistentFlags().Lookup("requests-per-second"))
+
+	fetchCmd.PersistentFlags().Duration("wait", 0, "The minimum interval between requests to the mirror across all the downloads, no wait if 0")
+	bindFlag("wait", fetchCmd.PersistentFlags().Lookup("wait"))
+
+	fetchCmd.PersistentFlags().Bool("fail-fast", false, "stop fetching and inserting on the first failed version")
+	bindFlag("fail-fast", fetchCmd.PersistentFlags().Lookup("fail-fast"))
+
+	fetchCmd.PersistentFlags().Bool("ignore-errors", false, "exit successfully even if some versions failed, the others are inserted anyway")
+	bindFlag("ignore-errors", fetchCmd.PersistentFlags().Lookup("ignore-errors"))
+
+	fetchCmd.PersistentFlags().Int("min-definitions", 1, "The minimum number of definitions per OS version to accept the fetched OVAL")
+	bindFlag("min-definitions", fetchCmd.PersistentFlags().Lookup("min-definitions"))
+
+	fetchCmd.PersistentFlags().Bool("force-empty", false, "replace the stored OVAL even if the fetched one has no definitions")
+	bindFlag("force-empty", fetchCmd.PersistentFlags().Lookup("force-empty"))
+
+	fetchCmd.PersistentFlags().Bool("allow-source-change", false, "replace the stored OVAL even if loaded from another source file, e.g. of the OVAL including the unpatched definitions, with a warning")
+	bindFlag("allow-source-change", fetchCmd.PersistentFlags().Lookup("allow-source-change"))
+
+	fetchCmd.PersistentFlags().Bool("force", false, "download and refresh the OVAL even if not modified since the previous fetch, e.g. to repair the stored OVAL")
+	bindFlag("force", fetchCmd.PersistentFlags().Lookup("force"))
+
+	fetchCmd.PersistentFlags().Duration("max-clock-skew", time.Hour, "clamp the timestamps of the fetched files more than the duration in the future to now, e.g. Last-Modified of the mirror of the skewed clock, and refresh the OVAL stored with them rather than skipping it, never if 0")
+	bindFlag("max-clock-skew", fetchCmd.PersistentFlags().Lookup("max-clock-skew"))
+
+	fetchCmd.PersistentFlags().Bool("skip-checksum", false, "do not verify the downloaded files against the published checksum files")
+	bindFlag("skip-checksum", fetchCmd.PersistentFlags().Lookup("skip-checksum"))
+
+	fetchCmd.PersistentFlags().String("local-dir", "", "/path/to/dir to read the OVAL files of the same names from instead of downloading them")
+	bindFlag("local-dir", fetchCmd.PersistentFlags().Lookup("local-dir"))
+
+	fetchCmd.PersistentFlags().String("cache-dir", "", "/path/to/dir to cache the downloaded files in, revalidated with a conditional request and reused if not modified across the runs")
+	bindFlag("cache-dir", fetchCmd.PersistentFlags().Lookup("cache-dir"))
+
+	fetchCmd.PersistentFlags().Duration("cache-max-age", 7*24*time.Hour, "The cached files not revalidated for the duration are pruned, no limit if 0")
+	bindFlag("cache-max-age", fetchCmd.PersistentFlags().Lookup("cache-max-age"))
+
+	fetchCmd.PersistentFlags().Int64("cache-max-size", 0, "The maximum total size of the cached files in MiB, the least recently revalidated ones are pruned over it, no limit if 0")
+	bindFlag("cache-max-size", fetchCmd.PersistentFlags().Lookup("cache-max-size"))
+
+	fetchCmd.PersistentFlags().String("summary-file", "", "/path/to/file to write the summary of the run to in JSON, with the IDs of the advisories of the new definitions by their severity")
+	bindFlag("summary-file", fetchCmd.PersistentFlags().Lookup("summary-file"))
+
+	fetchCmd.PersistentFlags().String("pushgateway-url", "", "http://host:port of Pushgateway to push the summary of the run to as the metrics of job goval-dictionary-fetch, e.g. to alert on the failed fetches")
+	bindFlag("pushgateway-url", fetchCmd.PersistentFlags().Lookup("pushgateway-url"))
+
+	fetchCmd.PersistentFlags().Bool("list", false, "list the versions available on the mirror without fetching")
+	bindFlag("list", fetchCmd.PersistentFlags().Lookup("list"))
+
+	fetchCmd.PersistentFlags().String("format", "text", "output format of --list (choices: text, json)")
+	bindFlag("format", fetchCmd.PersistentFlags().Lookup("format"))
+	_ = fetchCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"text", "json"}, cobra.ShellCompDirectiveNoFileComp))
+
+	fetchCmd.PersistentFlags().Duration("lock-timeout", 0, "The time to wait for another fetch into the same sqlite3 DB to finish, fail at once if 0")
+	bindFlag("lock-timeout", fetchCmd.PersistentFlags().Lookup("lock-timeout"))
+
+	fetchCmd.PersistentFlags().String("integrity-check", "quick", "check the sqlite3 DB before replacing the stored OVAL, not to make the corrupted DB worse (choices: quick of PRAGMA quick_check, full of PRAGMA integrity_check, none)")
+	bindFlag("integrity-check", fetchCmd.PersistentFlags().Lookup("integrity-check"))
+
+	fetchCmd.PersistentFlags().Bool("create-db-dir", false, "create the missing directory of the sqlite3 DB of --dbpath instead of failing")
+	bindFlag("create-db-dir", fetchCmd.PersistentFlags().Lookup("create-db-dir"))
+
+	fetchCmd.PersistentFlags().Bool("auto-migrate", false, "apply the pending migrations of the existing tables before fetching, instead of failing until the migrate subcommand applies them")
+	bindFlag("auto-migrate", fetchCmd.PersistentFlags().Lookup("auto-migrate"))
+
+	fetchCmd.PersistentFlags().Bool("dry-run", false, "fetch, convert and validate the OVAL without opening the DB, and print the summary of what would be inserted")
+	bindFlag("dry-run", fetchCmd.PersistentFlags().Lookup("dry-run"))
+
+	fetchCmd.PersistentFlags().String("download-dir", "", "/path/to/dir to write the fetched files to, decompressed, with their upstream names and index.json of their URLs, SHA-256 and fetch timestamps")
+	bindFlag("download-dir", fetchCmd.PersistentFlags().Lookup("download-dir"))
+
+	fetchCmd.PersistentFlags().Bool("no-insert", false, "only write the fetched files to --download-dir without opening the DB")
+	bindFlag("no-insert", fetchCmd.PersistentFlags().Lookup("no-insert"))
+
+	fetchCmd.PersistentFlags().Duration("history-retention", 365*24*time.Hour, "The records of the refreshes of each OVAL older than the duration are deleted by the next refresh of it, kept forever if 0, not recorded for redis")
+	bindFlag("history-retention", fetchCmd.PersistentFlags().Lookup("history-retention"))
+
+	fetchCmd.PersistentFlags().Bool("store-source", false, "store the fetched OVAL files of redhat, debian, ubuntu, suse and oracle in DB compressed, to be extracted by db --action source, not supported for redis")
+	bindFlag("store-source", fetchCmd.PersistentFlags().Lookup("store-source"))
+
+	fetchCmd.PersistentFlags().Int64("store-source-max-size", 64, "The maximum size of each file compressed stored by --store-source in MiB, only the SHA-256 of the larger one is stored, no limit if 0")
+	bindFlag("store-source-max-size", fetchCmd.PersistentFlags().Lookup("store-source-max-size"))
+
+	fetchCmd.PersistentFlags().Duration("store-source-retention", 0, "The files stored by --store-source neither fetched nor found not modified for the duration are deleted, never if 0")
+	bindFlag("store-source-retention", fetchCmd.PersistentFlags().Lookup("store-source-retention"))
+
+	fetchCmd.PersistentFlags().String("versions-file", "", "/path/to/file of the versions to fetch, one per line with # comments, merged with the args, or - to read them from stdin")
+	bindFlag("versions-file", fetchCmd.PersistentFlags().Lookup("versions-file"))
+}
+
+// lockedDB is the sqlite3 DB locked against the other fetches until CloseDB
+type lockedDB struct {
+	db.DB
+	lock *db.FileLock
+}
+
+// CloseDB closes the DB, and then releases the lock
+func (l lockedDB) CloseDB() error {
+	err := l.DB.CloseDB()
+	if uerr := l.lock.Unlock(); uerr != nil {
+		log15.Warn("Failed to unlock DB", "err", uerr)
+	}
+	return err
+}
+
+// openFetchDB opens the DB to insert the OVAL into, or none with --dry-run or --no-insert, which insert nothing.
+// The sqlite3 DB is locked by the lock file next to it until CloseDB, waiting up to "lock-timeout" for another fetch, e.g. of the overlapping cron job,
+// while MySQL, PostgreSQL and Redis are not locked. It is checked and migrated by goval.Load or goval.OpenDB.
+func openFetchDB(ctx context.Context) (db.DB, error) {
+	if viper.GetBool("dry-run") || viper.GetBool("no-insert") {
+		log15.Info("Not inserting, the DB is not opened", "dry-run", viper.GetBool("dry-run"), "no-insert", viper.GetBool("no-insert"))
+		return nil, nil
+	}
+	path, err := resolveDBPath(false)
+	if err != nil {
+		return nil, err
+	}
+	return openLockedDB(ctx, path, db.Option{SkipMigration: true})
+}
+
+// runFetch fetches the OVAL of family and versions into the DB by goval.Load with the flags and the config file, e.g. family of the SUSE type
+// of --suse-type, returning the summary of the versions finished, with the error stopping the fetch
+func runFetch(ctx context.Context, family string, versions []string) (goval.Summary, error) {
+	conf, err := c.Load(viper.GetViper())
+	if err != nil {
+		return goval.Summary{Family: family}, xerrors.Errorf("Failed to load config. err: %w", err)
+	}
+	opts := goval.Options{Family: family, Versions: versions, Logger: log15.Root(), Conf: conf}
+	switch family {
+	case c.Amazon, c.Oracle:
+		if opts.IssuedYears, err = issuedYearRange(family); err != nil {
+			return goval.Summary{Family: family}, err
+		}
+	}
+
+	driver, err := openFetchDB(ctx)
+	if err != nil {
+		return goval.Summary{Family: family}, err
+	}
+	if driver != nil {
+		defer driver.CloseDB()
+	}
+	opts.DB = driver
+	return goval.Load(ctx, opts)
+}
+
+// openLockedDB opens the DB at path to write, locking the sqlite3 DB until CloseDB as openFetchDB does
+func openLockedDB(ctx context.Context, path string, option db.Option) (db.DB, error) {
+	var lock *db.FileLock
+	if viper.GetString("dbtype") == "sqlite3" {
+		l, err := db.Lock(ctx, db.LockPath(path), viper.GetDuration("lock-timeout"))
+		if err != nil {
+			if xerrors.Is(err, db.ErrLocked) {
+				return nil, xerrors.Errorf("Failed to lock DB. Another fetch is running, wait for it or increase --lock-timeout. err: %w", err)
+			}
+			return nil, xerrors.Errorf("Failed to lock DB. err: %w", err)
+		}
+		lock = l
+	}
+
+	driver, err := openDB(path, option)
+	if err != nil {
+		if lock != nil {
+			_ = lock.Unlock()
+		}
+		return nil, err
+	}
+	if lock != nil {
+		driver = lockedDB{DB: driver, lock: lock}
+	}
+	return driver, nil
+}
+
+// fetchContext returns the context of the fetch subcommand, cancelled by SIGINT/SIGTERM through the context of Execute and bounded by "run-timeout"
+func fetchContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if d := viper.GetDuration("run-timeout"); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// fetchArgs requires the versions to fetch, unless --list or --versions-file, whose versions are required by fetchVersions instead
+func fetchArgs(cmd *cobra.Command, args []string) error {
+	if viper.GetBool("list") || viper.GetString("versions-file") != "" {
+		return nil
+	}
+	return cobra.MinimumNArgs(1)(cmd, args)
+}
+
+// fetchArgsOrDefault is fetchArgs of the fetch subcommand of family fetching the default versions without the version args,
+// which requires them only by --no-default-versions
+func fetchArgsOrDefault(family string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if !viper.GetBool(family + ".no-default-versions") {
+			return nil
+		}
+		return fetchArgs(cmd, args)
+	}
+}
+
+// addDefaultVersionsFlag adds --no-default-versions to the fetch subcommand fetching the default versions of family without the version args
+func addDefaultVersionsFlag(cmd *cobra.Command, family string) {
+	cmd.Flags().Bool("no-default-versions", false, "fail without the version args instead of fetching the default versions")
+	bindFlag(family+".no-default-versions", cmd.Flags().Lookup("no-default-versions"))
+}
+
+// defaultVersions returns versions as is if any, otherwise the default versions of family, or the error of the missing args if noDefault
+func defaultVersions(family string, versions, defaults []string, noDefault bool) ([]string, error) {
+	if len(versions) > 0 {
+		return versions, nil
+	}
+	if noDefault || len(defaults) == 0 {
+		return nil, xerrors.New("requires at least 1 arg(s), only received 0")
+	}
+	log15.Info("No versions given, fetching the default versions", "family", family, "versions", defaults)
+	return defaults, nil
+}
+
+// fetchVersions returns the versions of args merged with those read from --versions-file, and from stdin by "-" in either of them,
+// deduplicated in the order of their first appearance
+func fetchVersions(cmd *cobra.Command, args []string) ([]string, error) {
+	paths := []string{}
+	if p := viper.GetString("versions-file"); p != "" {
+		paths = append(paths, p)
+	}
+	versions := []string{}
+	for _, arg := range args {
+		if arg == "-" {
+			paths = append(paths, arg)
+			continue
+		}
+		versions = append(versions, arg)
+	}
+
+	for _, p := range util.Unique(paths) {
+		vs, err := readVersions(cmd.InOrStdin(), p)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, vs...)
+	}
+	// the empty file without args fails as the missing args do
+	if len(paths) > 0 && len(versions) == 0 {
+		return nil, cobra.MinimumNArgs(1)(cmd, nil)
+	}
+	return util.Unique(versions), nil
+}
+
+// readVersions reads the versions one per line from the file of path, or from stdin if "-", skipping the blank lines and the comments after #
+func readVersions(stdin io.Reader, path string) ([]string, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to open versions file. err: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	vs := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if v := strings.TrimSpace(line); v != "" {
+			vs = append(vs, v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, xerrors.Errorf("Failed to read versions. path: %s, err: %w", path, err)
+	}
+	return vs, nil
+}
+
+// printVersions prints the versions of family available on the mirror for --list, one per line or in JSON
+func printVersions(w io.Writer, family string, list func() ([]string, error)) error {
+	if viper.GetString("local-dir") != "" {
+		return xerrors.New("--list is not supported with --local-dir")
+	}
+	vs, err := list()
+	if err != nil {
+		return xerrors.Errorf("Failed to list versions. err: %w", err)
+	}
+	if vs == nil {
+		vs = []string{}
+	}
+
+	switch viper.GetString("format") {
+	case "text":
+		for _, v := range vs {
+			fmt.Fprintln(w, v)
+		}
+	case "json":
+		if err := json.NewEncoder(w).Encode(struct {
+			Family   string   `json:"family"`
+			Versions []string `json:"versions"`
+		}{Family: family, Versions: vs}); err != nil {
+			return xerrors.Errorf("Failed to encode versions. err: %w", err)
+		}
+	default:
+		return xerrors.Errorf("Unknown format: %s. Available format: text, json", viper.GetString("format"))
+	}
+	return nil
+}
+
+// addBaseURLFlag adds --base-url to the fetch subcommand to fetch from a mirror, also set by "<name>.base-url" in the config file or GOVAL_DICTIONARY_<NAME>_BASE_URL
+func addBaseURLFlag(cmd *cobra.Command, name string) {
+	key := name + ".base-url"
+	env := fmt.Sprintf("GOVAL_DICTIONARY_%s_BASE_URL", strings.ToUpper(name))
+	cmd.Flags().String("base-url", "", fmt.Sprintf("base URL of the mirror to fetch from instead of the upstream, keeping the file names (env: %s)", env))
+	bindFlag(key, cmd.Flags().Lookup("base-url"))
+	_ = viper.BindEnv(key, env)
+}
+
+// addIssuedYearFlags adds --since-year and --issued-years to the fetch subcommand to convert only the advisories issued in the years,
+// also set by "<name>.since-year" and "<name>.issued-years" in the config file
+func addIssuedYearFlags(cmd *cobra.Command, name string) {
+	cmd.Flags().Int("since-year", 0, "convert only the advisories issued in or after the year, e.g. 2015, the stored OVAL is still refreshed with them")
+	bindFlag(name+".since-year", cmd.Flags().Lookup("since-year"))
+
+	cmd.Flags().String("issued-years", "", "convert only the advisories issued in the range of years, e.g. 2015-2018, the stored OVAL is still refreshed with them")
+	bindFlag(name+".issued-years", cmd.Flags().Lookup("issued-years"))
+}
+
+// issuedYearRange returns the range of the years of the advisories of family to convert by --since-year and --issued-years, unbounded if neither
+func issuedYearRange(family string) (modelsutil.YearRange, error) {
+	r, err := modelsutil.ParseYearRange(viper.GetString(family + ".issued-years"))
+	if err != nil {
+		return modelsutil.YearRange{}, xerrors.Errorf("Failed to parse --issued-years. err: %w", err)
+	}
+	since := viper.GetInt(family + ".since-year")
+	if since < 0 {
+		return modelsutil.YearRange{}, xerrors.Errorf("Invalid --since-year: %d", since)
+	}
+	if since > r.From {
+		r.From = since
+	}
+	if r.To != 0 && r.From > r.To {
+		return modelsutil.YearRange{}, xerrors.Errorf("--since-year %d is after the last year of --issued-years %d", since, r.To)
+	}
+	return r, nil
+}
+
+// logConnStats logs the numbers of the connections opened and reused by the run, e.g. to see the connections kept alive across the files
+func logConnStats() {
+	created, reused := fetcherutil.ConnStats()
+	log15.Debug("Connections", "New", created, "Reused", reused)
+}
+
+// printSummary prints the summary table of the run
+func printSummary(w io.Writer, s goval.Summary) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tSTATUS\tDEFINITIONS\tPACKAGES\tCVES\tNEW\tUPDATED\tUNCHANGED\tREMOVED\tERROR")
+	for _, v := range s.Versions {
+		msg := "-"
+		if v.Err != nil {
+			msg = v.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", v.Version, v.Status, v.Definitions, v.Packages, v.CVEs, v.Change.New, v.Change.Updated, v.Change.Unchanged, v.Change.Removed, msg)
+	}
+	_ = tw.Flush()
+}
+
+// finish prints the summary with the new advisories by their severity, writes it to --summary-file if given,
+// and returns the error of the failed versions, unless --ignore-errors
+func finish(w io.Writer, s goval.Summary) error {
+	printSummary(w, s)
+	summaries := []familySummary{{family: s.Family, summary: s}}
+	printNewAdvisories(w, summaries, false)
+	printSourceChanges(w, summaries, false)
+	printClockSkews(w, summaries, false)
+	change := s.Change()
+	log15.Info("Summary", "Family", s.Family, "Versions", len(s.Versions), "Failed", s.Failed(), "New", change.New, "Updated", change.Updated, "Unchanged", change.Unchanged, "Removed", change.Removed)
+	logConnStats()
+	if err := writeSummaryFile(summaries); err != nil {
+		return err
+	}
+	pushSummary(summaries)
+
+	msgs, errs := []string{}, []error{}
+	for _, v := range s.Versions {
+		if v.Err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", v.Version, v.Err))
+			errs = append(errs, v.Err)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	if viper.GetBool("ignore-errors") {
+		log15.Warn("Some versions failed, ignored by --ignore-errors", "Family", s.Family, "Failed", len(msgs))
+		return nil
+	}
+	return &multiError{msg: fmt.Sprintf("Failed to fetch %d of %d version(s). err: [%s]", len(msgs), len(s.Versions), strings.Join(msgs, ", ")), errs: errs}
+}
+
+// multiError is the error of the versions or the families failed in a run, wrapping the error of each of them to be classified by ExitCode
+type multiError struct {
+	msg  string
+	errs []error
+}
+
+func (e *multiError) Error() string {
+	return e.msg
+}
+
+func (e *multiError) Unwrap() []error {
+	return e.errs
 }
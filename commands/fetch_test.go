@@ -0,0 +1,1220 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/goval"
+)
+
+const localSUSEOVAL = `<oval_definitions>
+  <generator>
+    <timestamp>2023-07-06T04:00:10</timestamp>
+  </generator>
+  <definitions>
+    <definition id="oval:org.opensuse.security:def:20210857" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2 (Important)</title>
+        <reference ref_id="SUSE-SU-2021:0857-1" ref_url="https://lists.suse.com/pipermail/sle-security-updates/2021-March/008520.html" source="SUSE-SU"/>
+        <advisory from="security@suse.de">
+          <severity>Important</severity>
+          <cve impact="important" href="https://www.suse.com/security/cve/CVE-2021-27218/">CVE-2021-27218</cve>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+  </definitions>
+  <tests>
+    <rpminfo_test id="oval:org.opensuse.security:tst:2009000002" version="1" comment="glib2-tools is &lt;2.54.3-4.24.1" check="at least one">
+      <object object_ref="oval:org.opensuse.security:obj:2009000002"/>
+      <state state_ref="oval:org.opensuse.security:ste:2009000002"/>
+    </rpminfo_test>
+  </tests>
+  <objects>
+    <rpminfo_object id="oval:org.opensuse.security:obj:2009000002" version="1">
+      <name>glib2-tools</name>
+    </rpminfo_object>
+  </objects>
+  <states>
+    <rpminfo_state id="oval:org.opensuse.security:ste:2009000002" version="1">
+      <evr datatype="evr_string" operation="less than">0:2.54.3-4.24.1</evr>
+    </rpminfo_state>
+  </states>
+</oval_definitions>`
+
+func TestFetchSUSELocalDir(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+	}()
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "suse.linux.enterprise.server.15.xml")
+	if err := os.WriteFile(p, []byte(localSUSEOVAL), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	mtime := time.Date(2023, time.July, 6, 4, 0, 10, 0, time.UTC)
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatalf("Failed to change mtime. err: %s", err)
+	}
+	dbpath := filepath.Join(dir, "oval.sqlite3")
+
+	// the OVAL of 12 is not mirrored, which fails only the version
+	RootCmd.SetArgs([]string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dbpath", dbpath, "15", "12"})
+	err := RootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "suse.linux.enterprise.server.12.xml") {
+		t.Errorf("expected the error of the missing file, actual: %v", err)
+	}
+
+	driver, err := db.NewDB("sqlite3", dbpath, false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to open DB. err: %s", err)
+	}
+	defer driver.CloseDB()
+
+	defs, err := driver.GetByPackName(context.Background(), c.SUSEEnterpriseServer, "15.1", "glib2-tools", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	if len(defs) != 1 || defs[0].DefinitionID != "oval:org.opensuse.security:def:20210857" {
+		t.Errorf("expected: the definition loaded from the local file, actual: %+v", defs)
+	}
+	lastModified, err := driver.GetLastModified(c.SUSEEnterpriseServer, "15.1")
+	if err != nil {
+		t.Fatalf("Failed to GetLastModified. err: %s", err)
+	}
+	if !lastModified.Equal(mtime) {
+		t.Errorf("expected: %s, actual: %s", mtime, lastModified)
+	}
+}
+
+func TestFetchSUSETumbleweed(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		_ = fetchSUSECmd.PersistentFlags().Set("opensuse-tumbleweed", "false")
+	}()
+
+	dir := t.TempDir()
+	oval := strings.Replace(localSUSEOVAL, "SUSE Linux Enterprise Server 15 SP1 is installed", "openSUSE Tumbleweed is installed", 1)
+	if err := os.WriteFile(filepath.Join(dir, "opensuse.tumbleweed.xml"), []byte(oval), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	dbpath := filepath.Join(dir, "oval.sqlite3")
+
+	// --suse-type is overridden by --opensuse-tumbleweed, needing no version
+	RootCmd.SetArgs([]string{"fetch", "suse", "--opensuse-tumbleweed", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dbpath", dbpath})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	driver, err := db.NewDB("sqlite3", dbpath, false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to open DB. err: %s", err)
+	}
+	defer driver.CloseDB()
+
+	// the snapshot of Tumbleweed of os-release is looked up as tumbleweed
+	for _, osVer := range []string{"tumbleweed", "Tumbleweed", "20231015"} {
+		defs, err := driver.GetByPackName(context.Background(), "openSUSE Tumbleweed", osVer, "glib2-tools", "")
+		if err != nil {
+			t.Fatalf("Failed to GetByPackName. err: %s", err)
+		}
+		if len(defs) != 1 || defs[0].DefinitionID != "oval:org.opensuse.security:def:20210857" {
+			t.Errorf("%s: expected: the definition of tumbleweed, actual: %+v", osVer, defs)
+		}
+	}
+
+	// the freshness is of the timestamp of the generator
+	snapshot := time.Date(2023, time.July, 6, 4, 0, 10, 0, time.UTC)
+	lastModified, err := driver.GetLastModified(c.OpenSUSE, c.OpenSUSETumbleweed)
+	if err != nil {
+		t.Fatalf("Failed to GetLastModified. err: %s", err)
+	}
+	if !lastModified.Equal(snapshot) {
+		t.Errorf("expected: %s, actual: %s", snapshot, lastModified)
+	}
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		t.Fatalf("Failed to GetFetchMeta. err: %s", err)
+	}
+	if len(fetchMeta.Snapshots) != 1 {
+		t.Fatalf("expected: the snapshot of tumbleweed, actual: %v", fetchMeta.Snapshots)
+	}
+	for url, ts := range fetchMeta.Snapshots {
+		if !strings.Contains(url, "opensuse.tumbleweed.xml") || !ts.Equal(snapshot) {
+			t.Errorf("expected: %s of opensuse.tumbleweed.xml, actual: %s of %s", snapshot, ts, url)
+		}
+	}
+}
+
+func TestFetchSUSELocked(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchCmd.PersistentFlags().Set("lock-timeout", "0s")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+	}()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "suse.linux.enterprise.server.15.xml"), []byte(localSUSEOVAL), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	dbpath := filepath.Join(dir, "oval.sqlite3")
+	args := []string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dbpath", dbpath, "--lock-timeout", "100ms", "15"}
+
+	// another fetch holds the lock beyond --lock-timeout
+	lock, err := db.Lock(context.Background(), db.LockPath(dbpath), 0)
+	if err != nil {
+		t.Fatalf("Failed to Lock. err: %s", err)
+	}
+	RootCmd.SetArgs(args)
+	if err := RootCmd.Execute(); !xerrors.Is(err, db.ErrLocked) {
+		t.Errorf("expected error: %v, actual: %v", db.ErrLocked, err)
+	}
+
+	// and releases it
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Failed to Unlock. err: %s", err)
+	}
+	RootCmd.SetArgs(args)
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("Failed to fetch. err: %s", err)
+	}
+	if _, err := os.Stat(db.LockPath(dbpath)); !xerrors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the lock file removed after the fetch, actual: %v", err)
+	}
+}
+
+func TestFetchSUSECorruptedDB(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchCmd.PersistentFlags().Set("integrity-check", "quick")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		_ = dbCmd.PersistentFlags().Set("action", "check")
+		RootCmd.SetOut(nil)
+	}()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "suse.linux.enterprise.server.15.xml"), []byte(localSUSEOVAL), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	dbpath := filepath.Join(dir, "oval.sqlite3")
+	args := []string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dbpath", dbpath, "--force", "15"}
+
+	// the healthy DB passes the check of both modes
+	for _, mode := range []string{"quick", "full"} {
+		RootCmd.SetArgs(append(args, "--integrity-check", mode))
+		if err := RootCmd.Execute(); err != nil {
+			t.Fatalf("Failed to fetch with --integrity-check %s. err: %s", mode, err)
+		}
+	}
+
+	// the DB file cut in half, as the write of the full disk does
+	fi, err := os.Stat(dbpath)
+	if err != nil {
+		t.Fatalf("Failed to stat DB. err: %s", err)
+	}
+	if err := os.Truncate(dbpath, fi.Size()/2); err != nil {
+		t.Fatalf("Failed to truncate DB. err: %s", err)
+	}
+
+	for _, mode := range []string{"quick", "full"} {
+		RootCmd.SetArgs(append(args, "--integrity-check", mode))
+		err := RootCmd.Execute()
+		if !xerrors.Is(err, db.ErrCorrupted) || !strings.Contains(err.Error(), "Restore DB from the backup") {
+			t.Errorf("expected the refusal of the corrupted DB with --integrity-check %s, actual: %v", mode, err)
+		}
+	}
+
+	RootCmd.SetOut(io.Discard)
+	RootCmd.SetArgs([]string{"db", "--dbpath", dbpath, "--action", "storage"})
+	if err := RootCmd.Execute(); !xerrors.Is(err, db.ErrCorrupted) {
+		t.Errorf("expected error: %v, actual: %v", db.ErrCorrupted, err)
+	}
+}
+
+func TestFetchSUSEDBDir(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchCmd.PersistentFlags().Set("create-db-dir", "false")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		RootCmd.SetOut(nil)
+	}()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "suse.linux.enterprise.server.15.xml"), []byte(localSUSEOVAL), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	// relative to the working directory, not to $PWD
+	t.Setenv("PWD", "")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory. err: %s", err)
+	}
+	dbpath, err := filepath.Rel(wd, filepath.Join(dir, "db", "oval.sqlite3"))
+	if err != nil {
+		t.Fatalf("Failed to get relative path. err: %s", err)
+	}
+	args := []string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dbpath", dbpath, "15"}
+
+	RootCmd.SetOut(io.Discard)
+	RootCmd.SetArgs(args)
+	if err := RootCmd.Execute(); !xerrors.Is(err, c.ErrNoDBDir) {
+		t.Errorf("expected error: %v, actual: %v", c.ErrNoDBDir, err)
+	}
+
+	RootCmd.SetArgs(append(args, "--create-db-dir"))
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("Failed to fetch. err: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "db", "oval.sqlite3")); err != nil {
+		t.Errorf("expected the DB in the created directory, actual: %s", err)
+	}
+}
+
+func TestFetchDebianList(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("list", "false")
+		_ = fetchCmd.PersistentFlags().Set("format", "text")
+		_ = fetchDebianCmd.Flags().Set("base-url", "")
+		RootCmd.SetOut(nil)
+	}()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<a href="oval-definitions-bullseye.xml.bz2">oval-definitions-bullseye.xml.bz2</a>
+<a href="oval-definitions-bookworm.xml.bz2">oval-definitions-bookworm.xml.bz2</a>`))
+	}))
+	defer ts.Close()
+
+	var out bytes.Buffer
+	RootCmd.SetOut(&out)
+	RootCmd.SetArgs([]string{"fetch", "debian", "--list", "--format", "json", "--base-url", ts.URL + "/"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := `{"family":"debian","versions":["11","12"]}` + "\n"; out.String() != expected {
+		t.Errorf("expected: %s, actual: %s", expected, out.String())
+	}
+}
+
+func TestFetchSUSEContinueOnError(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchCmd.PersistentFlags().Set("ignore-errors", "false")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		RootCmd.SetOut(nil)
+	}()
+
+	tests := []struct {
+		name         string
+		ignoreErrors bool
+		wantErr      bool
+	}{
+		{
+			name:    "fail",
+			wantErr: true,
+		},
+		{
+			name:         "ignore errors",
+			ignoreErrors: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// 15 is good, while 12 is broken in the middle of the download
+			for name, body := range map[string]string{
+				"suse.linux.enterprise.server.15.xml": localSUSEOVAL,
+				"suse.linux.enterprise.server.12.xml": localSUSEOVAL[:len(localSUSEOVAL)/2],
+			} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0600); err != nil {
+					t.Fatalf("Failed to write fixture. err: %s", err)
+				}
+			}
+			dbpath := filepath.Join(dir, "oval.sqlite3")
+
+			var out bytes.Buffer
+			RootCmd.SetOut(&out)
+			RootCmd.SetArgs([]string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dbpath", dbpath, fmt.Sprintf("--ignore-errors=%t", tt.ignoreErrors), "12", "15"})
+			err := RootCmd.Execute()
+			switch {
+			case tt.wantErr && (err == nil || !strings.Contains(err.Error(), "Failed to fetch 1 of 2 version(s)")):
+				t.Errorf("expected the error of the failed version, actual: %v", err)
+			case !tt.wantErr && err != nil:
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			rows := map[string][]string{}
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				fields := strings.Fields(line)
+				rows[fields[0]] = fields
+			}
+			if r := rows["12"]; len(r) < 10 || r[1] != "failed" || r[2] != "0" || !strings.HasPrefix(strings.Join(r[9:], " "), "Failed to parse XML.") {
+				t.Errorf("expected: the failed row of 12, actual: %q", out.String())
+			}
+			if r := rows["15.1"]; strings.Join(r, " ") != "15.1 inserted 1 1 1 1 0 0 0 -" {
+				t.Errorf("expected: the inserted row of 15.1, actual: %q", out.String())
+			}
+
+			driver, err := db.NewDB("sqlite3", dbpath, false, db.Option{})
+			if err != nil {
+				t.Fatalf("Failed to open DB. err: %s", err)
+			}
+			defer driver.CloseDB()
+			defs, err := driver.GetByPackName(context.Background(), c.SUSEEnterpriseServer, "15.1", "glib2-tools", "")
+			if err != nil {
+				t.Fatalf("Failed to GetByPackName. err: %s", err)
+			}
+			if len(defs) != 1 {
+				t.Errorf("expected: the definition of the good version inserted, actual: %+v", defs)
+			}
+		})
+	}
+}
+
+func TestFetchSUSEUpToDate(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("force", "false")
+		_ = fetchCmd.PersistentFlags().Set("retry", "3")
+		fetchCmd.PersistentFlags().Lookup("retry").Changed = false
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		_ = fetchSUSECmd.Flags().Set("base-url", "")
+		RootCmd.SetOut(nil)
+	}()
+
+	// the mirror ignoring If-Modified-Since, but of Last-Modified and Content-Length on HEAD, of the OVAL of 15 rather than 15.1,
+	// as the cache validators are sent only if the previous fetch has inserted the version of the target
+	oval := strings.Replace(localSUSEOVAL, "Server 15 SP1 is installed", "Server 15 is installed", 1)
+	var mu sync.Mutex
+	gets := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/suse.linux.enterprise.server.15.xml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			gets++
+			mu.Unlock()
+		}
+		w.Header().Set("Last-Modified", "Thu, 06 Jul 2023 04:00:10 GMT")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(oval))
+	}))
+	defer ts.Close()
+
+	dbpath := filepath.Join(t.TempDir(), "oval.sqlite3")
+	fetch := func(args ...string) string {
+		var out bytes.Buffer
+		RootCmd.SetOut(&out)
+		RootCmd.SetArgs(append([]string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--base-url", ts.URL + "/", "--retry", "0", "--dbpath", dbpath}, append(args, "15")...))
+		if err := RootCmd.Execute(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return out.String()
+	}
+	status := func(out string) string {
+		for _, line := range strings.Split(out, "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "15" {
+				return strings.Join(fields[1:len(fields)-8], " ")
+			}
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     string
+		wantGets int
+	}{
+		{name: "first", args: []string{"--force=false"}, want: goval.StatusInserted, wantGets: 1},
+		{name: "unchanged", args: []string{"--force=false"}, want: goval.StatusUpToDate},
+		{name: "force", args: []string{"--force"}, want: goval.StatusInserted, wantGets: 1},
+	}
+	for _, tt := range tests {
+		gets = 0
+		out := fetch(tt.args...)
+		if got := status(out); got != tt.want || gets != tt.wantGets {
+			t.Errorf("%s: expected: %q of %d GET, actual: %q of %d GET, out: %s", tt.name, tt.want, tt.wantGets, got, gets, out)
+		}
+	}
+}
+
+func TestFetchSUSEClockSkew(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("retry", "3")
+		fetchCmd.PersistentFlags().Lookup("retry").Changed = false
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		_ = fetchSUSECmd.Flags().Set("base-url", "")
+		RootCmd.SetOut(nil)
+	}()
+
+	// the mirror honoring If-Modified-Since of the OVAL of 15, whose Last-Modified is of modTime
+	oval := strings.Replace(localSUSEOVAL, "Server 15 SP1 is installed", "Server 15 is installed", 1)
+	var mu sync.Mutex
+	var modTime time.Time
+	body := oval
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/suse.linux.enterprise.server.15.xml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		http.ServeContent(w, r, "", modTime, strings.NewReader(body))
+	}))
+	defer ts.Close()
+
+	dbpath := filepath.Join(t.TempDir(), "oval.sqlite3")
+	fetch := func() string {
+		var out bytes.Buffer
+		RootCmd.SetOut(&out)
+		RootCmd.SetArgs([]string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--base-url", ts.URL + "/", "--retry", "0", "--dbpath", dbpath, "15"})
+		if err := RootCmd.Execute(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return out.String()
+	}
+	status := func(out string) string {
+		for _, line := range strings.Split(out, "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "15" {
+				return strings.Join(fields[1:len(fields)-8], " ")
+			}
+		}
+		return ""
+	}
+	serve := func(mod time.Time, fixed string) {
+		mu.Lock()
+		defer mu.Unlock()
+		modTime, body = mod, strings.Replace(oval, "0:2.54.3-4.24.1", fixed, 1)
+	}
+
+	// the mirror of the clock two days ahead, whose Last-Modified is not recorded
+	serve(time.Now().Add(48*time.Hour), "0:2.54.3-4.24.1")
+	if out := fetch(); status(out) != goval.StatusInserted || !strings.Contains(out, "Last-Modified not recorded") {
+		t.Errorf("future: expected: %q with the clock skew, actual: %s", goval.StatusInserted, out)
+	}
+
+	// the mirror of the right clock, modified before now, is refreshed rather than told not modified since the future
+	serve(time.Now().Add(-time.Hour), "0:2.54.3-4.25.1")
+	if out := fetch(); status(out) != goval.StatusInserted || strings.Contains(out, "TIMESTAMP IN FUTURE") {
+		t.Errorf("right: expected: %q without the clock skew, actual: %s", goval.StatusInserted, out)
+	}
+	if out := fetch(); status(out) != goval.StatusNotModified {
+		t.Errorf("unchanged: expected: %q, actual: %s", goval.StatusNotModified, out)
+	}
+
+	// the future Last-Modified stored before is not sent, refreshing the file
+	driver, err := db.NewDB("sqlite3", dbpath, false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to open DB. err: %s", err)
+	}
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		t.Fatalf("Failed to GetFetchMeta. err: %s", err)
+	}
+	url := ts.URL + "/suse.linux.enterprise.server.15.xml"
+	v := fetchMeta.CacheValidators[url]
+	v.LastModified = time.Now().Add(48 * time.Hour).UTC().Format(http.TimeFormat)
+	fetchMeta.CacheValidators[url] = v
+	if err := driver.UpsertFetchMeta(fetchMeta); err != nil {
+		t.Fatalf("Failed to UpsertFetchMeta. err: %s", err)
+	}
+	_ = driver.CloseDB()
+
+	serve(time.Now().Add(-time.Hour), "0:2.54.3-4.26.1")
+	if out := fetch(); status(out) != goval.StatusInserted || !strings.Contains(out, "stored one not sent, refreshing") {
+		t.Errorf("stored: expected: %q with the clock skew, actual: %s", goval.StatusInserted, out)
+	}
+}
+
+func TestFetchSUSEStoreSource(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchCmd.PersistentFlags().Set("store-source", "false")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		_ = dbCmd.PersistentFlags().Set("action", "check")
+		_ = dbCmd.PersistentFlags().Set("file", "")
+		_ = dbCmd.PersistentFlags().Set("dir", ".")
+		RootCmd.SetOut(nil)
+	}()
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "suse.linux.enterprise.server.15.xml")
+	if err := os.WriteFile(p, []byte(localSUSEOVAL), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	sum := sha256.Sum256([]byte(localSUSEOVAL))
+	if err := os.WriteFile(p+".sha256", []byte(fmt.Sprintf("%x  suse.linux.enterprise.server.15.xml\n", sum)), 0600); err != nil {
+		t.Fatalf("Failed to write checksum. err: %s", err)
+	}
+	dbpath := filepath.Join(dir, "oval.sqlite3")
+
+	RootCmd.SetArgs([]string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--store-source", "--dbpath", dbpath, "15"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("Failed to fetch. err: %s", err)
+	}
+
+	out := filepath.Join(t.TempDir(), "source")
+	var stdout bytes.Buffer
+	RootCmd.SetOut(&stdout)
+	RootCmd.SetArgs([]string{"db", "--action", "source", "--file", "suse.linux.enterprise.server.15.xml", "--dir", out, "--dbpath", dbpath})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("Failed to extract source file. err: %s", err)
+	}
+	extracted := filepath.Join(out, "suse.linux.enterprise.server.15.xml")
+	if !strings.Contains(stdout.String(), extracted) {
+		t.Errorf("expected: the path of the extracted file, actual: %q", stdout.String())
+	}
+	bs, err := os.ReadFile(extracted)
+	if err != nil {
+		t.Fatalf("Failed to read extracted file. err: %s", err)
+	}
+
+	driver, err := db.NewDB("sqlite3", dbpath, false, db.Option{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to open DB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		t.Fatalf("Failed to get FetchMeta. err: %s", err)
+	}
+	got := sha256.Sum256(bs)
+	if want := fmt.Sprintf("%x", sum); fmt.Sprintf("%x", got) != want || len(fetchMeta.SHA256) != 1 {
+		t.Errorf("expected: the file of SHA-256 %s of FetchMeta, actual: %x, FetchMeta: %v", want, got, fetchMeta.SHA256)
+	}
+	for _, v := range fetchMeta.SHA256 {
+		if v != fmt.Sprintf("%x", got) {
+			t.Errorf("expected: %s, actual: %x", v, got)
+		}
+	}
+
+	// the file not stored
+	RootCmd.SetArgs([]string{"db", "--action", "source", "--file", "suse.linux.enterprise.server.12.xml", "--dir", out, "--dbpath", dbpath})
+	if err := RootCmd.Execute(); !xerrors.Is(err, db.ErrNoSourceFile) {
+		t.Errorf("expected: ErrNoSourceFile, actual: %v", err)
+	}
+}
+
+func TestFetchSUSEDryRun(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("dry-run", "false")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		_ = fetchSUSECmd.Flags().Set("base-url", "")
+		RootCmd.SetOut(nil)
+	}()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/suse.linux.enterprise.server.15.xml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(localSUSEOVAL))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		versions []string
+		wantErr  bool
+	}{
+		{
+			name:     "dry run",
+			versions: []string{"15"},
+		},
+		{
+			name:     "fail as a real run",
+			versions: []string{"12", "15"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the directory of the DB does not exist, which fails to open the DB if opened
+			dbpath := filepath.Join(t.TempDir(), "missing", "oval.sqlite3")
+
+			var out bytes.Buffer
+			RootCmd.SetOut(&out)
+			RootCmd.SetArgs(append([]string{"fetch", "suse", "--dry-run", "--suse-type", "suse-enterprise-server", "--base-url", ts.URL + "/", "--dbpath", dbpath}, tt.versions...))
+			err := RootCmd.Execute()
+			switch {
+			case tt.wantErr && (err == nil || !strings.Contains(err.Error(), "Failed to fetch 1 of 2 version(s)")):
+				t.Errorf("expected the error of the failed version, actual: %v", err)
+			case !tt.wantErr && err != nil:
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			found := false
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				// VERSION STATUS DEFINITIONS PACKAGES CVES NEW UPDATED UNCHANGED REMOVED ERROR
+				if strings.Join(strings.Fields(line), " ") == "15.1 dry run 1 1 1 1 0 0 0 -" {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected: the dry run row of 15.1, actual: %q", out.String())
+			}
+			if _, err := os.Stat(filepath.Dir(dbpath)); !os.IsNotExist(err) {
+				t.Errorf("expected: no DB created, actual: %v", err)
+			}
+		})
+	}
+}
+
+func TestFetchSummaryFile(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchCmd.PersistentFlags().Set("summary-file", "")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		RootCmd.SetOut(nil)
+	}()
+
+	// v2 adds a Critical advisory to v1, and a rejected one skipped by the conversion
+	v2 := strings.Replace(localSUSEOVAL, "  </definitions>", `    <definition id="oval:org.opensuse.security:def:20230002" version="1" class="vulnerability">
+      <metadata>
+        <title>CVE-2023-0002</title>
+        <description>** REJECT ** DO NOT USE THIS CANDIDATE NUMBER.</description>
+      </metadata>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20230001" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2 (Critical)</title>
+        <reference ref_id="CVE-2023-0001" ref_url="https://www.suse.com/security/cve/CVE-2023-0001/" source="CVE"/>
+        <reference ref_id="SUSE-SU-2023:0001-1" ref_url="https://lists.suse.com/pipermail/sle-security-updates/2023-January/013337.html" source="SUSE-SU"/>
+        <advisory from="security@suse.de">
+          <severity>Critical</severity>
+          <cve impact="critical" href="https://www.suse.com/security/cve/CVE-2023-0001/">CVE-2023-0001</cve>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+  </definitions>`, 1)
+
+	dir := t.TempDir()
+	dbpath := filepath.Join(dir, "oval.sqlite3")
+	summaryFile := filepath.Join(dir, "summary.json")
+	fetch := func(oval string) (string, string) {
+		if err := os.WriteFile(filepath.Join(dir, "suse.linux.enterprise.server.15.xml"), []byte(oval), 0600); err != nil {
+			t.Fatalf("Failed to write fixture. err: %s", err)
+		}
+		var out bytes.Buffer
+		RootCmd.SetOut(&out)
+		RootCmd.SetArgs([]string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dbpath", dbpath, "--summary-file", summaryFile, "15"})
+		if err := RootCmd.Execute(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		bs, err := os.ReadFile(summaryFile)
+		if err != nil {
+			t.Fatalf("Failed to read summary file. err: %s", err)
+		}
+		return out.String(), string(bs)
+	}
+
+	// every definition of v1 is new
+	if _, summary := fetch(localSUSEOVAL); !strings.Contains(summary, `"Important": [
+          "SUSE-SU-2021:0857-1"
+        ]`) {
+		t.Errorf("expected: the new advisory of v1, actual: %s", summary)
+	}
+
+	out, summary := fetch(v2)
+	if want := "SEVERITY  NEW  ADVISORIES\nCritical  1    SUSE-SU-2023:0001-1\n"; !strings.HasSuffix(out, want) {
+		t.Errorf("expected: %q, actual: %q", want, out)
+	}
+	want := `{
+  "families": [
+    {
+      "family": "suse.linux.enterprise.server",
+      "versions": [
+        {
+          "version": "15.1",
+          "status": "inserted",
+          "definitions": 2,
+          "packages": 2,
+          "cves": 2,
+          "new": 1,
+          "updated": 0,
+          "unchanged": 1,
+          "removed": 0,
+          "newAdvisories": {
+            "Critical": [
+              "SUSE-SU-2023:0001-1"
+            ]
+          }
+        }
+      ],
+      "newAdvisories": {
+        "Critical": [
+          "SUSE-SU-2023:0001-1"
+        ]
+      },
+      "conversion": {
+        "seen": 3,
+        "converted": 2,
+        "skipped": {
+          "rejected": 1
+        },
+        "skippedIDs": [
+          "oval:org.opensuse.security:def:20230002"
+        ]
+      },
+      "conversions": {
+        "15": {
+          "seen": 3,
+          "converted": 2,
+          "skipped": {
+            "rejected": 1
+          },
+          "skippedIDs": [
+            "oval:org.opensuse.security:def:20230002"
+          ]
+        }
+      }
+    }
+  ]
+}
+`
+	if summary != want {
+		t.Errorf("expected: %s, actual: %s", want, summary)
+	}
+}
+
+func TestFetchPushgateway(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchCmd.PersistentFlags().Set("pushgateway-url", "")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+	}()
+
+	var path, body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		bs, _ := io.ReadAll(req.Body)
+		path, body = req.URL.Path, string(bs)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "suse.linux.enterprise.server.15.xml"), []byte(localSUSEOVAL), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	RootCmd.SetArgs([]string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dbpath", filepath.Join(dir, "oval.sqlite3"), "--pushgateway-url", ts.URL, "15"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if path != "/metrics/job/goval-dictionary-fetch" {
+		t.Errorf("expected: /metrics/job/goval-dictionary-fetch, actual: %s", path)
+	}
+	for _, want := range []string{
+		`goval_dictionary_fetch_definitions{family="suse.linux.enterprise.server",release="15.1"} 1`,
+		`goval_dictionary_fetch_changes{family="suse.linux.enterprise.server",release="15.1",change="new"} 1`,
+		`goval_dictionary_fetch_failed{family="suse.linux.enterprise.server",release="15.1"} 0`,
+		"# TYPE goval_dictionary_fetch_last_run_timestamp_seconds gauge\ngoval_dictionary_fetch_last_run_timestamp_seconds ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected: %s, actual: %s", want, body)
+		}
+	}
+}
+
+func TestFetchSUSENoInsert(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("no-insert", "false")
+		_ = fetchCmd.PersistentFlags().Set("download-dir", "")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		_ = fetchSUSECmd.Flags().Set("base-url", "")
+		RootCmd.SetOut(nil)
+	}()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/suse.linux.enterprise.server.15.xml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(localSUSEOVAL))
+	}))
+	defer ts.Close()
+
+	// the directory of the DB does not exist, which fails to open the DB if opened
+	dbpath := filepath.Join(t.TempDir(), "missing", "oval.sqlite3")
+	args := []string{"fetch", "suse", "--no-insert", "--suse-type", "suse-enterprise-server", "--base-url", ts.URL + "/", "--dbpath", dbpath, "15"}
+
+	RootCmd.SetArgs(args)
+	if err := RootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--no-insert requires --download-dir") {
+		t.Errorf("expected the error of the missing --download-dir, actual: %v", err)
+	}
+
+	dir := t.TempDir()
+	var out bytes.Buffer
+	RootCmd.SetOut(&out)
+	RootCmd.SetArgs(append(args, "--download-dir", dir))
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(out.String(), "downloaded") {
+		t.Errorf("expected: the downloaded row of 15.1, actual: %q", out.String())
+	}
+	bs, err := os.ReadFile(filepath.Join(dir, "suse.linux.enterprise.server.15.xml"))
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file. err: %s", err)
+	}
+	if string(bs) != localSUSEOVAL {
+		t.Errorf("expected: the file as fetched, actual: %q", bs)
+	}
+	if _, err := os.Stat(filepath.Dir(dbpath)); !os.IsNotExist(err) {
+		t.Errorf("expected: no DB created, actual: %v", err)
+	}
+}
+
+func TestFetchSUSETypes(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("dry-run", "false")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		_ = fetchSUSECmd.Flags().Set("base-url", "")
+		RootCmd.SetOut(nil)
+	}()
+
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		suseType string
+		wantPath string
+		wantErr  string
+	}{
+		{suseType: "opensuse", wantPath: "/opensuse.15.xml.gz"},
+		{suseType: "opensuse-leap", wantPath: "/opensuse.leap.15.xml.gz"},
+		{suseType: "suse-enterprise-server", wantPath: "/suse.linux.enterprise.server.15.xml.gz"},
+		{suseType: "suse-enterprise-desktop", wantPath: "/suse.linux.enterprise.desktop.15.xml.gz"},
+		{suseType: "", wantErr: "Specify SUSE type to fetch. Available SUSE Type: opensuse, opensuse-leap, suse-enterprise-server, suse-enterprise-desktop"},
+		{suseType: "suse-openstack-cloud", wantErr: `Unknown SUSE type: "suse-openstack-cloud". Available SUSE Type: opensuse, opensuse-leap, suse-enterprise-server, suse-enterprise-desktop`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.suseType, func(t *testing.T) {
+			mu.Lock()
+			paths = nil
+			mu.Unlock()
+
+			RootCmd.SetOut(io.Discard)
+			RootCmd.SetArgs([]string{"fetch", "suse", "--dry-run", "--suse-type", tt.suseType, "--base-url", ts.URL + "/", "--dbpath", filepath.Join(t.TempDir(), "oval.sqlite3"), "15"})
+			err := RootCmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("expected: %s, actual: %v", tt.wantErr, err)
+				}
+				if len(paths) > 0 {
+					t.Errorf("expected: no requests, actual: %q", paths)
+				}
+				return
+			}
+
+			// the file is not found, which fails the version after requesting it
+			if err == nil {
+				t.Errorf("expected the error of the missing file")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			found := false
+			for _, p := range paths {
+				found = found || p == tt.wantPath
+				if strings.HasSuffix(p, ".xml.gz") && p != tt.wantPath {
+					t.Errorf("expected: only %s, actual: %s", tt.wantPath, p)
+				}
+			}
+			if !found {
+				t.Errorf("expected: %s, actual: %q", tt.wantPath, paths)
+			}
+		})
+	}
+}
+
+func TestFetchVersionsFile(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("dry-run", "false")
+		_ = fetchCmd.PersistentFlags().Set("versions-file", "")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+		_ = fetchSUSECmd.Flags().Set("base-url", "")
+		RootCmd.SetOut(nil)
+		RootCmd.SetIn(nil)
+	}()
+
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if strings.HasSuffix(r.URL.Path, ".xml.gz") {
+			paths = append(paths, r.URL.Path)
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	versionsFile := filepath.Join(t.TempDir(), "versions.txt")
+	if err := os.WriteFile(versionsFile, []byte("# SLES\n12\n15 # the latest\n\n12\n"), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+
+	tests := []struct {
+		name         string
+		versionsFile string
+		stdin        string
+		args         []string
+		wantVersions []string
+		wantErr      string
+	}{
+		{
+			name:         "file merged with the args",
+			versionsFile: versionsFile,
+			args:         []string{"15", "11"},
+			wantVersions: []string{"11", "12", "15"},
+		},
+		{
+			name:         "stdin by the flag",
+			versionsFile: "-",
+			stdin:        "12\n12.1\n",
+			wantVersions: []string{"12", "12.1"},
+		},
+		{
+			name:         "stdin by the arg",
+			stdin:        "15\n# 12\n",
+			args:         []string{"11", "-", "15"},
+			wantVersions: []string{"11", "15"},
+		},
+		{
+			name:         "empty",
+			versionsFile: "-",
+			stdin:        "# nothing to fetch\n\n",
+			wantErr:      "requires at least 1 arg(s), only received 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			paths = nil
+			mu.Unlock()
+
+			RootCmd.SetOut(io.Discard)
+			RootCmd.SetIn(strings.NewReader(tt.stdin))
+			RootCmd.SetArgs(append([]string{"fetch", "suse", "--dry-run", "--suse-type", "suse-enterprise-server", "--base-url", ts.URL + "/", "--versions-file=" + tt.versionsFile}, tt.args...))
+			err := RootCmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected: %s, actual: %v", tt.wantErr, err)
+				}
+				if len(paths) > 0 {
+					t.Errorf("expected: no requests, actual: %q", paths)
+				}
+				return
+			}
+
+			// the files are not found, which fails the versions after requesting each of them once
+			if err == nil {
+				t.Errorf("expected the error of the missing files")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			want := []string{}
+			for _, v := range tt.wantVersions {
+				want = append(want, fmt.Sprintf("/suse.linux.enterprise.server.%s.xml.gz", v))
+			}
+			// the files are requested concurrently, in any order
+			sort.Strings(paths)
+			sort.Strings(want)
+			if !reflect.DeepEqual(paths, want) {
+				t.Errorf("expected: %q, actual: %q", want, paths)
+			}
+		})
+	}
+}
+
+func TestDefaultVersions(t *testing.T) {
+	tests := []struct {
+		name      string
+		versions  []string
+		defaults  []string
+		noDefault bool
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:     "versions given",
+			versions: []string{"8"},
+			defaults: []string{"5", "6", "7", "8", "9"},
+			want:     []string{"8"},
+		},
+		{
+			name:     "defaults",
+			defaults: []string{"5", "6", "7", "8", "9"},
+			want:     []string{"5", "6", "7", "8", "9"},
+		},
+		{
+			name:      "versions given without defaults",
+			versions:  []string{"8"},
+			defaults:  []string{"5", "6", "7", "8", "9"},
+			noDefault: true,
+			want:      []string{"8"},
+		},
+		{
+			name:      "no defaults",
+			defaults:  []string{"5", "6", "7", "8", "9"},
+			noDefault: true,
+			wantErr:   true,
+		},
+		{
+			name:    "no default versions of the family",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := defaultVersions(c.RedHat, tt.versions, tt.defaults, tt.noDefault)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %t, actual: %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected: %q, actual: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFetchNoDefaultVersions(t *testing.T) {
+	defer func() {
+		_ = fetchOracleCmd.Flags().Set("no-default-versions", "false")
+	}()
+
+	RootCmd.SetArgs([]string{"fetch", "oracle", "--no-default-versions"})
+	if err := RootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "requires at least 1 arg(s)") {
+		t.Errorf("expected the error of the missing args, actual: %v", err)
+	}
+}
+
+func TestFetchAll(t *testing.T) {
+	// --base-url set by the other tests takes precedence over the config file as given, even if empty
+	for _, cmd := range []*cobra.Command{fetchAlpineCmd, fetchSUSECmd} {
+		cmd.Flags().Lookup("base-url").Changed = false
+	}
+	viper.SetConfigType("toml")
+	defer func() {
+		_ = viper.ReadConfig(strings.NewReader(""))
+		RootCmd.SetOut(nil)
+	}()
+
+	files := map[string]string{
+		"/alpine/v3.18/main.yaml":                   "distroversion: v3.18\nreponame: main\npackages:\n  - pkg:\n      name: openssl\n      secfixes:\n        3.1.1-r0:\n          - CVE-2023-2650\n",
+		"/alpine/v3.18/community.yaml":              "distroversion: v3.18\nreponame: community\npackages:\n  - pkg:\n      name: go\n      secfixes:\n        1.20.5-r0:\n          - CVE-2023-29402\n",
+		"/suse/suse.linux.enterprise.server.15.xml": localSUSEOVAL,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name           string
+		alpineVersions string
+		args           []string
+		wantRows       []string
+		wantErr        string
+	}{
+		{
+			name:           "all the families in the config file",
+			alpineVersions: `["3.18"]`,
+			wantRows:       []string{"alpine 3.18 inserted 2 2 2 2 0 0 0 -", "suse 15.1 inserted 1 1 1 1 0 0 0 -"},
+		},
+		{
+			name:           "the failed family does not stop the others",
+			alpineVersions: `["3.18", "3.99"]`,
+			wantRows:       []string{"alpine 3.18 inserted 2 2 2 2 0 0 0 -", "suse 15.1 inserted 1 1 1 1 0 0 0 -"},
+			wantErr:        "Failed to fetch 1 of 2 family(s)",
+		},
+		{
+			name:           "the families given",
+			alpineVersions: `["3.18"]`,
+			args:           []string{"suse"},
+			wantRows:       []string{"suse 15.1 inserted 1 1 1 1 0 0 0 -"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := fmt.Sprintf(`[alpine]
+base-url = "%[1]s/alpine/"
+versions = %[2]s
+
+[suse]
+base-url = "%[1]s/suse/"
+type = "suse-enterprise-server"
+versions = ["15"]
+`, ts.URL, tt.alpineVersions)
+			if err := viper.ReadConfig(strings.NewReader(conf)); err != nil {
+				t.Fatalf("Failed to read config. err: %s", err)
+			}
+
+			var out bytes.Buffer
+			RootCmd.SetOut(&out)
+			RootCmd.SetArgs(append([]string{"fetch", "all", "--dbpath", filepath.Join(t.TempDir(), "oval.sqlite3")}, tt.args...))
+			err := RootCmd.Execute()
+			switch {
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("expected: %s, actual: %v", tt.wantErr, err)
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			rows := []string{}
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+				// FAMILY VERSION STATUS DEFINITIONS PACKAGES CVES NEW UPDATED UNCHANGED REMOVED ERROR
+				if row := strings.Join(strings.Fields(line), " "); strings.HasSuffix(row, " -") {
+					rows = append(rows, row)
+				}
+			}
+			if !reflect.DeepEqual(rows, tt.wantRows) {
+				t.Errorf("expected: %q, actual: %q", tt.wantRows, out.String())
+			}
+		})
+	}
+}
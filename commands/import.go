@@ -0,0 +1,183 @@
+package commands
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/goval"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// importCmd is Subcommand to load the OVAL exported by the export subcommand
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import the OVAL exported by export into DB",
+	Long: `Import the OVAL of each file in the manifest of the export into DB as fetch inserts it, e.g. at the site where fetch is impossible.
+The file failed to be verified or decoded is reported and skipped, and the others are imported.`,
+	Args:    cobra.NoArgs,
+	RunE:    executeImport,
+	Example: `$ goval-dictionary import --dir ./dump`,
+
+	PersistentPreRunE: setLogger,
+}
+
+func init() {
+	RootCmd.AddCommand(importCmd)
+
+	// bound to "import.dir", as the one of export is bound to "export.dir"
+	importCmd.PersistentFlags().String("dir", "", "the directory exported by export to import the OVAL from")
+	bindFlag("import.dir", importCmd.PersistentFlags().Lookup("dir"))
+}
+
+// importResult is the result of importing a file of the export
+type importResult struct {
+	file exportFile
+	err  error
+}
+
+func executeImport(cmd *cobra.Command, _ []string) error {
+	dir := viper.GetString("import.dir")
+	if dir == "" {
+		return xerrors.New("Failed to import. err: specify --dir")
+	}
+	manifest, err := readExportManifest(dir)
+	if err != nil {
+		return xerrors.Errorf("Failed to read manifest. err: %w", err)
+	}
+	if manifest.SchemaVersion != models.LatestSchemaVersion {
+		return xerrors.Errorf("Failed to import. err: SchemaVersion of the export is incompatible, export it by the same version of goval-dictionary. SchemaVersion: %+v", map[string]uint{"latest": models.LatestSchemaVersion, "export": manifest.SchemaVersion})
+	}
+
+	conf, err := config.Load(viper.GetViper())
+	if err != nil {
+		return xerrors.Errorf("Failed to load config. err: %w", err)
+	}
+	ctx := cmd.Context()
+	opened, err := openFetchDB(ctx)
+	if err != nil {
+		return err
+	}
+	if opened != nil {
+		defer opened.CloseDB()
+	}
+	opts := goval.Options{DB: opened, Logger: log15.Root(), Conf: conf}
+	driver, fetchMeta, err := goval.OpenDB(opts)
+	if err != nil {
+		return err
+	}
+
+	results := make([]importResult, 0, len(manifest.Files))
+	imported := 0
+	for _, f := range manifest.Files {
+		root, err := readExportFile(dir, f)
+		if err == nil {
+			err = goval.Validate(&root, opts)
+		}
+		if err != nil {
+			log15.Error("Failed to import, continue with the other files", "File", f.Name, "err", err)
+			results = append(results, importResult{file: f, err: err})
+			continue
+		}
+		if _, err := driver.InsertOval(ctx, &root); err != nil {
+			return xerrors.Errorf("Failed to insert OVAL. err: %w", err)
+		}
+		log15.Info("Imported", "Family", f.Family, "Version", f.OSVersion, "Definitions", f.Definitions, "Packages", f.Packages, "File", f.Name)
+		results = append(results, importResult{file: f})
+		imported++
+	}
+
+	// recorded as fetched when exported, with the SHA-256 verified by the fetch
+	if imported > 0 {
+		if fetchMeta.SHA256 == nil {
+			fetchMeta.SHA256 = map[string]string{}
+		}
+		for url, sum := range manifest.SHA256 {
+			fetchMeta.SHA256[url] = sum
+		}
+		fetchMeta.LastFetchedAt = manifest.LastFetchedAt
+		if err := driver.UpsertFetchMeta(fetchMeta); err != nil {
+			return xerrors.Errorf("Failed to upsert FetchMeta to DB. err: %w", err)
+		}
+	}
+
+	printImported(cmd.OutOrStdout(), results)
+	msgs := []string{}
+	for _, r := range results {
+		if r.err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", r.file.Name, r.err))
+		}
+	}
+	if len(msgs) > 0 {
+		return xerrors.Errorf("Failed to import %d of %d file(s). err: [%s]", len(msgs), len(results), strings.Join(msgs, ", "))
+	}
+	return nil
+}
+
+// readExportManifest reads the manifest of the export in dir
+func readExportManifest(dir string) (exportManifest, error) {
+	bs, err := os.ReadFile(filepath.Join(dir, exportManifestName))
+	if err != nil {
+		return exportManifest{}, xerrors.Errorf("Failed to read file. err: %w", err)
+	}
+	var manifest exportManifest
+	if err := json.Unmarshal(bs, &manifest); err != nil {
+		return exportManifest{}, xerrors.Errorf("Failed to unmarshal manifest. err: %w", err)
+	}
+	return manifest, nil
+}
+
+// readExportFile reads the Root of f in dir, verified against the SHA-256 and the family and the version in the manifest
+func readExportFile(dir string, f exportFile) (models.Root, error) {
+	if f.Name != filepath.Base(f.Name) {
+		return models.Root{}, xerrors.Errorf("invalid file name: %s", f.Name)
+	}
+	bs, err := os.ReadFile(filepath.Join(dir, f.Name))
+	if err != nil {
+		return models.Root{}, xerrors.Errorf("Failed to read file. err: %w", err)
+	}
+	if sum := sha256.Sum256(bs); hex.EncodeToString(sum[:]) != f.SHA256 {
+		return models.Root{}, xerrors.Errorf("Failed to verify file. err: SHA-256 mismatch. expected: %s, actual: %x", f.SHA256, sum)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(bs))
+	if err != nil {
+		return models.Root{}, xerrors.Errorf("Failed to read gzip. err: %w", err)
+	}
+	var root models.Root
+	if err := json.NewDecoder(gz).Decode(&root); err != nil {
+		return models.Root{}, xerrors.Errorf("Failed to decode root. err: %w", err)
+	}
+	if root.Family != f.Family || root.OSVersion != f.OSVersion {
+		return models.Root{}, xerrors.Errorf("Failed to verify file. err: the OVAL of %s %s, expected: %s %s", root.Family, root.OSVersion, f.Family, f.OSVersion)
+	}
+	return root, nil
+}
+
+// printImported prints the table of the files of the export with the result of each
+func printImported(w io.Writer, results []importResult) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tSTATUS\tDEFINITIONS\tPACKAGES\tERROR")
+	for _, r := range results {
+		status, msg := "imported", "-"
+		if r.err != nil {
+			status, msg = goval.StatusFailed, r.err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", r.file.Name, status, r.file.Definitions, r.file.Packages, msg)
+	}
+	_ = tw.Flush()
+}
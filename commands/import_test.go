@@ -0,0 +1,176 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// exportTestDB exports the DB at dbpath to the directory returned
+func exportTestDB(t *testing.T, dbpath string) string {
+	t.Helper()
+	defer func() {
+		_ = exportCmd.PersistentFlags().Set("dir", "")
+		RootCmd.SetOut(nil)
+	}()
+
+	dir := filepath.Join(t.TempDir(), "dump")
+	RootCmd.SetOut(&bytes.Buffer{})
+	RootCmd.SetArgs([]string{"export", "--dbpath", dbpath, "--dir", dir})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("Failed to export. err: %s", err)
+	}
+	return dir
+}
+
+// importTestDB imports the export in dir to the new DB, and returns its path with the error of import
+func importTestDB(t *testing.T, dir string) (string, error) {
+	t.Helper()
+	defer func() {
+		_ = importCmd.PersistentFlags().Set("dir", "")
+		RootCmd.SetOut(nil)
+	}()
+
+	dbpath := filepath.Join(t.TempDir(), "oval.sqlite3")
+	RootCmd.SetOut(&bytes.Buffer{})
+	RootCmd.SetArgs([]string{"import", "--dbpath", dbpath, "--dir", dir})
+	return dbpath, RootCmd.Execute()
+}
+
+func TestImportRoundTrip(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+	}()
+
+	// fetch the fixture into DB A
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "suse.linux.enterprise.server.15.xml"), []byte(localSUSEOVAL), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	dbpathA := filepath.Join(dir, "oval.sqlite3")
+	RootCmd.SetArgs([]string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dbpath", dbpathA, "15"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("Failed to fetch. err: %s", err)
+	}
+
+	dbpathB, err := importTestDB(t, exportTestDB(t, dbpathA))
+	if err != nil {
+		t.Fatalf("Failed to import. err: %s", err)
+	}
+
+	dbs := []db.DB{}
+	for _, dbpath := range []string{dbpathA, dbpathB} {
+		driver, err := db.NewDB("sqlite3", dbpath, false, db.Option{ReadOnly: true})
+		if err != nil {
+			t.Fatalf("Failed to open DB. err: %s", err)
+		}
+		defer driver.CloseDB()
+		dbs = append(dbs, driver)
+	}
+
+	for pack, want := range map[string]int{"glib2-tools": 1, "openssl": 0} {
+		defsA, err := dbs[0].GetByPackName(context.Background(), c.SUSEEnterpriseServer, "15.1", pack, "")
+		if err != nil {
+			t.Fatalf("Failed to GetByPackName. err: %s", err)
+		}
+		defsB, err := dbs[1].GetByPackName(context.Background(), c.SUSEEnterpriseServer, "15.1", pack, "")
+		if err != nil {
+			t.Fatalf("Failed to GetByPackName. err: %s", err)
+		}
+		if len(defsA) != want {
+			t.Errorf("%s expected: %d definitions, actual: %d", pack, want, len(defsA))
+		}
+		ja, _ := json.Marshal(defsA)
+		jb, _ := json.Marshal(defsB)
+		if !bytes.Equal(ja, jb) {
+			t.Errorf("%s expected: %s, actual: %s", pack, ja, jb)
+		}
+	}
+
+	statsA, err := dbs[0].GetRootStats()
+	if err != nil {
+		t.Fatalf("Failed to GetRootStats. err: %s", err)
+	}
+	statsB, err := dbs[1].GetRootStats()
+	if err != nil {
+		t.Fatalf("Failed to GetRootStats. err: %s", err)
+	}
+	for _, stats := range [][]models.RootStat{statsA, statsB} {
+		for i := range stats {
+			stats[i].Timestamp = stats[i].Timestamp.UTC()
+		}
+	}
+	if len(statsA) != 1 || !reflect.DeepEqual(statsA, statsB) {
+		t.Errorf("expected: %+v, actual: %+v", statsA, statsB)
+	}
+
+	fetchMetaA, err := dbs[0].GetFetchMeta()
+	if err != nil {
+		t.Fatalf("Failed to GetFetchMeta. err: %s", err)
+	}
+	fetchMetaB, err := dbs[1].GetFetchMeta()
+	if err != nil {
+		t.Fatalf("Failed to GetFetchMeta. err: %s", err)
+	}
+	if !fetchMetaA.LastFetchedAt.Equal(fetchMetaB.LastFetchedAt) {
+		t.Errorf("expected: last fetched at %s, actual: %s", fetchMetaA.LastFetchedAt, fetchMetaB.LastFetchedAt)
+	}
+}
+
+func TestImportPartial(t *testing.T) {
+	dir := exportTestDB(t, testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), statusTestRoots()...))
+	if err := os.WriteFile(filepath.Join(dir, "debian-12.json.gz"), []byte("corrupt"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt file. err: %s", err)
+	}
+
+	dbpath, err := importTestDB(t, dir)
+	if err == nil || !strings.Contains(err.Error(), "Failed to import 1 of 2 file(s)") || !strings.Contains(err.Error(), "debian-12.json.gz: Failed to verify file") {
+		t.Errorf("expected the error of the corrupt file, actual: %v", err)
+	}
+
+	driver, err := db.NewDB("sqlite3", dbpath, false, db.Option{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to open DB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	stats, err := driver.GetRootStats()
+	if err != nil {
+		t.Fatalf("Failed to GetRootStats. err: %s", err)
+	}
+	if len(stats) != 1 || stats[0].Family != c.RedHat || stats[0].Definitions != 1 {
+		t.Errorf("expected: only redhat imported, actual: %+v", stats)
+	}
+}
+
+func TestImportSchemaVersion(t *testing.T) {
+	dir := exportTestDB(t, testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), statusTestRoots()...))
+	manifest, err := readExportManifest(dir)
+	if err != nil {
+		t.Fatalf("Failed to read manifest. err: %s", err)
+	}
+	manifest.SchemaVersion = models.LatestSchemaVersion - 1
+	manifest.LastFetchedAt = time.Time{}
+	bs, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Failed to marshal manifest. err: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, exportManifestName), bs, 0644); err != nil {
+		t.Fatalf("Failed to write manifest. err: %s", err)
+	}
+
+	if _, err := importTestDB(t, dir); err == nil || !strings.Contains(err.Error(), "SchemaVersion of the export is incompatible") {
+		t.Errorf("expected the error of the schema version, actual: %v", err)
+	}
+}
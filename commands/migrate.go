@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// migrateCmd is Subcommand to migrate the schema of DB without fetching
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the schema of DB",
+	Long: `Report the schema version of DB and the pending migrations, i.e. the missing tables, columns and indexes, and apply them with --apply.
+The fetch subcommands refuse the pending migrations of the existing tables, which may take long on the big DB, unless --auto-migrate,
+so that they are applied in the maintenance window instead of the cron job.`,
+	Args: cobra.NoArgs,
+	RunE: executeMigrate,
+	Example: `$ goval-dictionary migrate
+$ goval-dictionary migrate --dry-run
+$ goval-dictionary migrate --apply`,
+
+	PersistentPreRunE: setLogger,
+}
+
+func init() {
+	RootCmd.AddCommand(migrateCmd)
+
+	migrateCmd.PersistentFlags().Bool("apply", false, "apply the pending migrations")
+	bindFlag("apply", migrateCmd.PersistentFlags().Lookup("apply"))
+
+	// bound to "migrate.dry-run", as "dry-run" is bound to the one of fetch
+	migrateCmd.PersistentFlags().Bool("dry-run", false, "print the DDL of the pending migrations without applying them, where the DB type tells it")
+	bindFlag("migrate.dry-run", migrateCmd.PersistentFlags().Lookup("dry-run"))
+
+	migrateCmd.MarkFlagsMutuallyExclusive("apply", "dry-run")
+}
+
+func executeMigrate(cmd *cobra.Command, _ []string) error {
+	apply := viper.GetBool("apply")
+
+	// only --apply writes DB, locked against the fetches
+	path, err := resolveDBPath(!apply)
+	if err != nil {
+		return err
+	}
+	var driver db.DB
+	if apply {
+		driver, err = openLockedDB(cmd.Context(), path, db.Option{SkipMigration: true})
+	} else {
+		driver, err = openDB(path, db.Option{ReadOnly: true, SkipSchemaCheck: true})
+	}
+	if err != nil {
+		return err
+	}
+	defer driver.CloseDB()
+
+	pending, err := driver.PendingMigrations()
+	if err != nil {
+		return xerrors.Errorf("Failed to get pending migrations. err: %w", err)
+	}
+	w := cmd.OutOrStdout()
+	if err := printSchemaVersion(w, driver, pending); err != nil {
+		return err
+	}
+	printMigrations(w, pending, viper.GetBool("migrate.dry-run"))
+
+	if !apply {
+		return nil
+	}
+	log15.Info("Migrating DB...")
+	if err := driver.MigrateDB(); err != nil {
+		return xerrors.Errorf("Failed to migrate DB. err: %w", err)
+	}
+	fmt.Fprintf(w, "Applied %d migrations\n", len(pending))
+	return nil
+}
+
+// printSchemaVersion prints the schema version of DB stored in FetchMeta, none until the table of FetchMeta is created
+func printSchemaVersion(w io.Writer, driver db.DB, pending []db.Migration) error {
+	for _, m := range pending {
+		if m.Table == "fetch_metas" && !m.Alter {
+			fmt.Fprintf(w, "Schema version: none (latest: %d)\n", models.LatestSchemaVersion)
+			return nil
+		}
+	}
+
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+	}
+	fmt.Fprintf(w, "Schema version: %d (latest: %d)\n", fetchMeta.SchemaVersion, models.LatestSchemaVersion)
+	if fetchMeta.OutDated() {
+		fmt.Fprintln(w, "The OVAL of the old schema version is not converted by the migrations, delete DB and fetch again")
+	}
+	return nil
+}
+
+// printMigrations prints the pending migrations, with their DDL if ddl
+func printMigrations(w io.Writer, pending []db.Migration, ddl bool) {
+	fmt.Fprintf(w, "Pending migrations: %d\n", len(pending))
+	for _, m := range pending {
+		fmt.Fprintf(w, "  %s\n", m.Description)
+		if !ddl {
+			continue
+		}
+		for _, stmt := range m.DDL {
+			fmt.Fprintf(w, "    %s;\n", stmt)
+		}
+	}
+}
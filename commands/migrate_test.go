@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+)
+
+// newOldSchemaTestDB returns the DB of statusTestRoots in the schema of the older release, without the column of the state of advisories
+func newOldSchemaTestDB(t *testing.T) string {
+	t.Helper()
+
+	dbpath := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), statusTestRoots()...)
+	conn, err := gorm.Open(sqlite.Open(dbpath), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open DB. err: %s", err)
+	}
+	if err := conn.Exec("ALTER TABLE advisories DROP COLUMN state").Error; err != nil {
+		t.Fatalf("Failed to drop column. err: %s", err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatalf("Failed to get DB. err: %s", err)
+	}
+	_ = sqlDB.Close()
+	return dbpath
+}
+
+func TestMigrate(t *testing.T) {
+	dbpath := newOldSchemaTestDB(t)
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "report",
+			want: []string{"Schema version: 3 (latest: 3)", "Pending migrations: 1", "  add column advisories.state"},
+		},
+		{
+			name: "dry run",
+			args: []string{"--dry-run"},
+			want: []string{"Pending migrations: 1", "  add column advisories.state", "    ALTER TABLE `advisories` ADD `state` varchar(255);"},
+		},
+		{
+			name:    "apply and dry run",
+			args:    []string{"--apply", "--dry-run"},
+			wantErr: "none of the others can be",
+		},
+		{
+			name: "apply",
+			args: []string{"--apply"},
+			want: []string{"Pending migrations: 1", "Applied 1 migrations"},
+		},
+		{
+			name: "report after apply",
+			want: []string{"Schema version: 3 (latest: 3)", "Pending migrations: 0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				// unset rather than false, as the mutually exclusive flags are told by whether they are set
+				for _, name := range []string{"apply", "dry-run"} {
+					_ = migrateCmd.PersistentFlags().Set(name, "false")
+					migrateCmd.PersistentFlags().Lookup(name).Changed = false
+				}
+				RootCmd.SetOut(nil)
+			}()
+
+			var out bytes.Buffer
+			RootCmd.SetOut(&out)
+			RootCmd.SetArgs(append([]string{"migrate", "--dbpath", dbpath}, tt.args...))
+			err := RootCmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected: %s, actual: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(out.String(), line+"\n") {
+					t.Errorf("expected: %q in the output, actual: %q", line, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestOpenPendingMigrations(t *testing.T) {
+	dbpath := newOldSchemaTestDB(t)
+	want := "The schema of DB is older than the binary expects: 1 migrations are pending, e.g. add column advisories.state. Schema version: 3 (latest: 3). Apply them by `goval-dictionary migrate --apply` first"
+
+	// the query path of select refuses to query the missing column
+	RootCmd.SetArgs([]string{"select", "--by-cveid", "--dbpath", dbpath, "redhat", "7", "CVE-2017-0001"})
+	err := RootCmd.Execute()
+	_ = selectCmd.PersistentFlags().Set("by-cveid", "false")
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("select: expected: %s, actual: %v", want, err)
+	}
+	if code := ExitCode(err); code != ExitDB {
+		t.Errorf("select: expected exit status: %d, actual: %d", ExitDB, code)
+	}
+
+	// and the server refuses to start
+	if _, err := openServedDB(dbpath, db.Option{ReadOnly: true}); err == nil || !strings.Contains(err.Error(), want) || !errors.Is(err, db.ErrSchemaOutdated) {
+		t.Errorf("server: expected: %s, actual: %v", want, err)
+	}
+
+	// migrated, both open it
+	RootCmd.SetArgs([]string{"migrate", "--apply", "--dbpath", dbpath})
+	err = RootCmd.Execute()
+	_ = migrateCmd.PersistentFlags().Set("apply", "false")
+	migrateCmd.PersistentFlags().Lookup("apply").Changed = false
+	if err != nil {
+		t.Fatalf("Failed to migrate. err: %s", err)
+	}
+	driver, err := openServedDB(dbpath, db.Option{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("server: unexpected error: %s", err)
+	}
+	_ = driver.CloseDB()
+}
+
+func TestFetchPendingMigrations(t *testing.T) {
+	defer func() {
+		_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+		_ = fetchCmd.PersistentFlags().Set("auto-migrate", "false")
+		_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+	}()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "suse.linux.enterprise.server.15.xml"), []byte(localSUSEOVAL), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	dbpath := newOldSchemaTestDB(t)
+	args := []string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dbpath", dbpath, "15"}
+
+	RootCmd.SetArgs(args)
+	if err := RootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "migrate --apply") {
+		t.Errorf("expected the error of the pending migrations, actual: %v", err)
+	}
+
+	RootCmd.SetArgs(append(args, "--auto-migrate"))
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the new DB is created without --auto-migrate
+	RootCmd.SetArgs([]string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dbpath", filepath.Join(t.TempDir(), "oval.sqlite3"), "15"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
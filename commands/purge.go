@@ -0,0 +1,216 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// purgeCmd is Subcommand to delete the stored OVAL
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete the OVAL of families and versions from DB",
+	Long: `Delete the OVAL of a family and a version, of all the versions of a family without --release, or of those older than --all-older-than.
+Deleting requires --yes, and --dry-run prints what would be deleted without deleting it.`,
+	Args: cobra.NoArgs,
+	RunE: executePurge,
+	Example: `$ goval-dictionary purge --family redhat --release 5 --dry-run
+$ goval-dictionary purge --family redhat --release 5 --yes
+$ goval-dictionary purge --all-older-than 180d --yes`,
+
+	PersistentPreRunE: setLogger,
+}
+
+func init() {
+	RootCmd.AddCommand(purgeCmd)
+
+	purgeCmd.PersistentFlags().String("family", "", "the family to purge as shown by status, e.g. redhat")
+	bindFlag("family", purgeCmd.PersistentFlags().Lookup("family"))
+
+	purgeCmd.PersistentFlags().String("release", "", "the version of --family to purge as shown by status, all the versions if empty")
+	bindFlag("release", purgeCmd.PersistentFlags().Lookup("release"))
+
+	purgeCmd.PersistentFlags().String("all-older-than", "", "purge the OVAL whose timestamp is older than the age, in days or as a duration, e.g. 180d or 720h")
+	bindFlag("all-older-than", purgeCmd.PersistentFlags().Lookup("all-older-than"))
+
+	purgeCmd.PersistentFlags().Bool("yes", false, "confirm to delete the OVAL")
+	bindFlag("yes", purgeCmd.PersistentFlags().Lookup("yes"))
+
+	// bound to "purge.dry-run", as "dry-run" is bound to the one of fetch
+	purgeCmd.PersistentFlags().Bool("dry-run", false, "print the OVAL which would be purged without deleting it")
+	bindFlag("purge.dry-run", purgeCmd.PersistentFlags().Lookup("dry-run"))
+}
+
+func executePurge(cmd *cobra.Command, _ []string) error {
+	family, err := familyFlag("family")
+	if err != nil {
+		return xerrors.Errorf("Failed to purge. err: %w", err)
+	}
+	release := viper.GetString("release")
+	if family == "" && release != "" {
+		return xerrors.New("Failed to purge. err: --release requires --family")
+	}
+	var maxAge time.Duration
+	if s := viper.GetString("all-older-than"); s != "" {
+		d, err := parseAge(s)
+		if err != nil {
+			return xerrors.Errorf("Failed to parse --all-older-than. err: %w", err)
+		}
+		maxAge = d
+	} else if family == "" {
+		return xerrors.New("Failed to purge. err: specify --family or --all-older-than")
+	}
+
+	// without --yes, the OVAL to purge is only printed as --dry-run
+	dryRun := viper.GetBool("purge.dry-run") || !viper.GetBool("yes")
+
+	path, err := resolveDBPath(dryRun)
+	if err != nil {
+		return err
+	}
+	var driver db.DB
+	if dryRun {
+		driver, err = openDB(path, db.Option{ReadOnly: true})
+	} else {
+		driver, err = openLockedDB(cmd.Context(), path, db.Option{})
+	}
+	if err != nil {
+		return err
+	}
+	defer driver.CloseDB()
+
+	stats, err := driver.GetRootStats()
+	if err != nil {
+		return xerrors.Errorf("Failed to get the stats of OVAL. err: %w", err)
+	}
+	targets := selectPurgeTargets(stats, family, release, maxAge, time.Now())
+
+	if dryRun {
+		printPurged(cmd.OutOrStdout(), fmt.Sprintf("Would purge %d OVAL", len(targets)), targets)
+		if !viper.GetBool("purge.dry-run") && len(targets) > 0 {
+			return xerrors.New("Failed to purge. err: deleting OVAL requires --yes")
+		}
+		return nil
+	}
+
+	purged := []models.RootStat{}
+	for _, t := range targets {
+		stat, err := driver.PurgeOval(cmd.Context(), t.Family, t.OSVersion)
+		if err != nil {
+			printPurged(cmd.OutOrStdout(), fmt.Sprintf("Purged %d of %d OVAL", len(purged), len(targets)), purged)
+			return xerrors.Errorf("Failed to purge OVAL. family: %s, osVer: %s, err: %w", t.Family, t.OSVersion, err)
+		}
+		purged = append(purged, stat)
+	}
+	printPurged(cmd.OutOrStdout(), fmt.Sprintf("Purged %d OVAL", len(purged)), purged)
+	if len(purged) == 0 {
+		return nil
+	}
+
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+	}
+	if forgetCacheValidators(fetchMeta, purged) {
+		if err := driver.UpsertFetchMeta(fetchMeta); err != nil {
+			return xerrors.Errorf("Failed to upsert FetchMeta to DB. err: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseAge parses the age in days, e.g. 180d, or as the duration of Go, e.g. 720h
+func parseAge(s string) (time.Duration, error) {
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		days, err := strconv.Atoi(n)
+		if err != nil || days < 0 {
+			return 0, xerrors.Errorf("invalid number of days: %s", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, xerrors.Errorf("Failed to parse duration: %s. err: %w", s, err)
+	}
+	if d < 0 {
+		return 0, xerrors.Errorf("negative duration: %s", s)
+	}
+	return d, nil
+}
+
+// familyFlag returns the family of the flag of key normalized by config.NormalizeFamily, e.g. redhat of "Red Hat", or empty if not given
+func familyFlag(key string) (string, error) {
+	s := viper.GetString(key)
+	if s == "" {
+		return "", nil
+	}
+	family, err := config.NormalizeFamily(s)
+	if err != nil {
+		return "", xerrors.Errorf("--family: %w", err)
+	}
+	return family, nil
+}
+
+// selectPurgeTargets returns the stats of the OVAL of family and release, all the releases if empty, and older than maxAge at now if not zero
+func selectPurgeTargets(stats []models.RootStat, family, release string, maxAge time.Duration, now time.Time) []models.RootStat {
+	targets := []models.RootStat{}
+	for _, s := range stats {
+		if !matchRoot(s, family, release) {
+			continue
+		}
+		if maxAge > 0 && now.Sub(s.Timestamp) <= maxAge {
+			continue
+		}
+		targets = append(targets, s)
+	}
+	return targets
+}
+
+// matchRoot returns whether the stats are of the OVAL of family, if not empty, and of release, if not empty
+func matchRoot(stat models.RootStat, family, release string) bool {
+	return (family == "" || stat.Family == family) && (release == "" || stat.OSVersion == release)
+}
+
+// forgetCacheValidators drops the cache validators of the files which the purged OVAL may have been inserted from,
+// so that the next fetch downloads them again instead of skipping them as not modified, and returns whether any is dropped
+func forgetCacheValidators(fetchMeta *models.FetchMeta, purged []models.RootStat) bool {
+	dropped := false
+	for url, v := range fetchMeta.CacheValidators {
+		for _, p := range purged {
+			if slices.Contains(v.OSVersions, p.OSVersion) {
+				log15.Debug("Forgetting the cache validators of the purged OVAL", "URL", url, "Family", p.Family, "Version", p.OSVersion)
+				delete(fetchMeta.CacheValidators, url)
+				dropped = true
+				break
+			}
+		}
+	}
+	return dropped
+}
+
+// printPurged prints the title and the table of the purged OVAL
+func printPurged(w io.Writer, title string, stats []models.RootStat) {
+	fmt.Fprintf(w, "%s\n", title)
+	if len(stats) == 0 {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FAMILY\tVERSION\tTIMESTAMP\tDEFINITIONS\tPACKAGES")
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n", s.Family, s.OSVersion, s.Timestamp.UTC().Format(time.RFC3339), s.Definitions, s.Packages)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+func TestPurge(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		wantTitle      string
+		wantRows       []string
+		wantErr        string
+		wantRemaining  []string
+		wantValidators []string
+	}{
+		{
+			name:           "dry run",
+			args:           []string{"--family", "redhat", "--release", "7", "--dry-run"},
+			wantTitle:      "Would purge 1 OVAL",
+			wantRows:       []string{"redhat 7 1 1"},
+			wantRemaining:  []string{"debian 12", "redhat 7"},
+			wantValidators: []string{"debian.xml", "redhat.xml"},
+		},
+		{
+			name:           "without yes",
+			args:           []string{"--family", "redhat"},
+			wantTitle:      "Would purge 1 OVAL",
+			wantRows:       []string{"redhat 7 1 1"},
+			wantErr:        "deleting OVAL requires --yes",
+			wantRemaining:  []string{"debian 12", "redhat 7"},
+			wantValidators: []string{"debian.xml", "redhat.xml"},
+		},
+		{
+			name:           "family",
+			args:           []string{"--family", "RedHat", "--yes"},
+			wantTitle:      "Purged 1 OVAL",
+			wantRows:       []string{"redhat 7 1 1"},
+			wantRemaining:  []string{"debian 12"},
+			wantValidators: []string{"debian.xml"},
+		},
+		{
+			name:           "release not stored",
+			args:           []string{"--family", "debian", "--release", "11", "--yes"},
+			wantTitle:      "Purged 0 OVAL",
+			wantRemaining:  []string{"debian 12", "redhat 7"},
+			wantValidators: []string{"debian.xml", "redhat.xml"},
+		},
+		{
+			name:           "all older than",
+			args:           []string{"--all-older-than", "7d", "--yes"},
+			wantTitle:      "Purged 1 OVAL",
+			wantRows:       []string{"redhat 7 1 1"},
+			wantRemaining:  []string{"debian 12"},
+			wantValidators: []string{"debian.xml"},
+		},
+		{
+			name:           "all older than in hours",
+			args:           []string{"--all-older-than", "1h", "--yes"},
+			wantTitle:      "Purged 2 OVAL",
+			wantRows:       []string{"debian 12 1 2", "redhat 7 1 1"},
+			wantRemaining:  []string{},
+			wantValidators: []string{},
+		},
+		{
+			name:           "no target",
+			args:           []string{"--yes"},
+			wantErr:        "specify --family or --all-older-than",
+			wantRemaining:  []string{"debian 12", "redhat 7"},
+			wantValidators: []string{"debian.xml", "redhat.xml"},
+		},
+		{
+			name:           "release without family",
+			args:           []string{"--release", "7", "--yes"},
+			wantErr:        "--release requires --family",
+			wantRemaining:  []string{"debian 12", "redhat 7"},
+			wantValidators: []string{"debian.xml", "redhat.xml"},
+		},
+		{
+			name:           "invalid age",
+			args:           []string{"--all-older-than", "180x", "--yes"},
+			wantErr:        "Failed to parse --all-older-than",
+			wantRemaining:  []string{"debian 12", "redhat 7"},
+			wantValidators: []string{"debian.xml", "redhat.xml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				for name, value := range map[string]string{"family": "", "release": "", "all-older-than": "", "yes": "false", "dry-run": "false"} {
+					_ = purgeCmd.PersistentFlags().Set(name, value)
+				}
+				RootCmd.SetOut(nil)
+			}()
+
+			dbpath := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), statusTestRoots()...)
+			driver, err := db.NewDB("sqlite3", dbpath, false, db.Option{})
+			if err != nil {
+				t.Fatalf("Failed to open DB. err: %s", err)
+			}
+			fetchMeta, err := driver.GetFetchMeta()
+			if err != nil {
+				t.Fatalf("Failed to get FetchMeta. err: %s", err)
+			}
+			fetchMeta.CacheValidators = map[string]models.CacheValidator{
+				"debian.xml": {ETag: `"debian"`, OSVersions: []string{"12"}},
+				"redhat.xml": {ETag: `"redhat"`, OSVersions: []string{"7"}},
+			}
+			if err := driver.UpsertFetchMeta(fetchMeta); err != nil {
+				t.Fatalf("Failed to upsert FetchMeta. err: %s", err)
+			}
+			_ = driver.CloseDB()
+
+			var out bytes.Buffer
+			RootCmd.SetOut(&out)
+			RootCmd.SetArgs(append([]string{"purge", "--dbpath", dbpath}, tt.args...))
+			err = RootCmd.Execute()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected: %s, actual: %v", tt.wantErr, err)
+			}
+
+			if tt.wantTitle != "" {
+				lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+				if lines[0] != tt.wantTitle {
+					t.Errorf("expected: %q, actual: %q", tt.wantTitle, lines[0])
+				}
+				// without the header and the timestamps
+				rows := []string{}
+				if len(lines) > 2 {
+					for _, line := range lines[2:] {
+						fields := strings.Fields(line)
+						rows = append(rows, strings.Join(append(fields[:2:2], fields[3:]...), " "))
+					}
+				}
+				if strings.Join(rows, "\n") != strings.Join(tt.wantRows, "\n") {
+					t.Errorf("expected: %q, actual: %q", tt.wantRows, rows)
+				}
+			}
+
+			driver, err = db.NewDB("sqlite3", dbpath, false, db.Option{ReadOnly: true})
+			if err != nil {
+				t.Fatalf("Failed to open DB. err: %s", err)
+			}
+			defer driver.CloseDB()
+			stats, err := driver.GetRootStats()
+			if err != nil {
+				t.Fatalf("Failed to GetRootStats. err: %s", err)
+			}
+			remaining := []string{}
+			for _, s := range stats {
+				remaining = append(remaining, s.Family+" "+s.OSVersion)
+			}
+			if !reflect.DeepEqual(remaining, tt.wantRemaining) {
+				t.Errorf("expected: %q, actual: %q", tt.wantRemaining, remaining)
+			}
+			fetchMeta, err = driver.GetFetchMeta()
+			if err != nil {
+				t.Fatalf("Failed to get FetchMeta. err: %s", err)
+			}
+			validators := []string{}
+			for url := range fetchMeta.CacheValidators {
+				validators = append(validators, url)
+			}
+			sort.Strings(validators)
+			if !reflect.DeepEqual(validators, tt.wantValidators) {
+				t.Errorf("expected: %q, actual: %q", tt.wantValidators, validators)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/server"
+)
+
+// the statuses of a refresh and of its families reported by /health
+const (
+	refreshSucceeded = "succeeded"
+	refreshFailed    = "failed"
+)
+
+// refresher refreshes the OVAL of the families in the config file as fetch all does, every interval while the server is serving,
+// keeping the result of the last refresh for /health. The failure of a refresh is recorded and retried at the next interval.
+type refresher struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	last  *server.Refresh
+	count int
+}
+
+// lastRefresh returns the result of the last refresh, nil until the first one finishes
+func (r *refresher) lastRefresh() *server.Refresh {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last == nil {
+		return nil
+	}
+	last := *r.last
+	return &last
+}
+
+// run refreshes at once, and then every interval after the previous one starts, until ctx is done
+func (r *refresher) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh fetches the families in the config file into DB, bounded by "run-timeout", and records the result
+func (r *refresher) refresh(ctx context.Context) {
+	if d := viper.GetDuration("run-timeout"); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	log15.Info("Refreshing...")
+	result := server.Refresh{StartedAt: time.Now().UTC(), Status: refreshSucceeded, Families: []server.RefreshFamily{}}
+	summaries, err := fetchConfiguredFamilies(ctx)
+	if err != nil {
+		result.Status, result.Error = refreshFailed, err.Error()
+	}
+	for _, s := range summaries {
+		f := server.RefreshFamily{Family: s.family, Status: refreshSucceeded}
+		msgs := []string{}
+		if s.err != nil {
+			msgs = append(msgs, s.err.Error())
+		}
+		for _, v := range s.summary.Versions {
+			if v.Err != nil {
+				msgs = append(msgs, v.Version+": "+v.Err.Error())
+			}
+		}
+		if len(msgs) > 0 {
+			f.Status, f.Error = refreshFailed, strings.Join(msgs, ", ")
+			result.Status = refreshFailed
+		}
+		result.Families = append(result.Families, f)
+	}
+	result.FinishedAt = time.Now().UTC()
+
+	r.mu.Lock()
+	r.count++
+	result.Count = r.count
+	r.last = &result
+	r.mu.Unlock()
+
+	if result.Status == refreshFailed {
+		log15.Error("Failed to refresh, retrying at the next interval", "Count", result.Count, "Elapsed", result.FinishedAt.Sub(result.StartedAt), "Interval", r.interval)
+		return
+	}
+	log15.Info("Refreshed", "Count", result.Count, "Elapsed", result.FinishedAt.Sub(result.StartedAt), "Interval", r.interval)
+}
+
+// fetchConfiguredFamilies fetches all the families whose versions are in the config file, as fetch all without args does
+func fetchConfiguredFamilies(ctx context.Context) ([]familySummary, error) {
+	conf, err := c.Load(viper.GetViper())
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to load config. err: %w", err)
+	}
+	fetches, err := familyFetches(conf, nil)
+	if err != nil {
+		return nil, err
+	}
+	return runFetchAll(ctx, fetches)
+}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+)
+
+func TestRefresher(t *testing.T) {
+	// --base-url set by the other tests takes precedence over the config file as given, even if empty
+	fetchSUSECmd.Flags().Lookup("base-url").Changed = false
+	viper.SetConfigType("toml")
+	defer func() {
+		_ = viper.ReadConfig(strings.NewReader(""))
+		viper.Set("dbpath", nil)
+		viper.Set("retry", nil)
+	}()
+
+	// every other download fails, so that the second refresh fails and the third one succeeds again
+	var downloads int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/suse.linux.enterprise.server.15.xml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet && atomic.AddInt32(&downloads, 1)%2 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(localSUSEOVAL))
+	}))
+	defer ts.Close()
+
+	conf := fmt.Sprintf(`[suse]
+base-url = "%s/"
+type = "suse-enterprise-server"
+versions = ["15"]
+`, ts.URL)
+	if err := viper.ReadConfig(strings.NewReader(conf)); err != nil {
+		t.Fatalf("Failed to read config. err: %s", err)
+	}
+	dbpath := filepath.Join(t.TempDir(), "oval.sqlite3")
+	viper.Set("dbpath", dbpath)
+	viper.Set("retry", 0)
+
+	// the DB served while refreshing, as the server opens it
+	driver, err := db.NewDB("sqlite3", dbpath, false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to open DB. err: %s", err)
+	}
+	defer driver.CloseDB()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &refresher{interval: 200 * time.Millisecond}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.run(ctx)
+	}()
+
+	statuses := map[int]string{}
+	deadline := time.Now().Add(10 * time.Second)
+	for len(statuses) < 3 && time.Now().Before(deadline) {
+		if last := r.lastRefresh(); last != nil {
+			statuses[last.Count] = last.Status
+			if last.Status == refreshFailed && (len(last.Families) != 1 || last.Families[0].Error == "") {
+				t.Errorf("expected: the error of the failed family, actual: %+v", last)
+			}
+			// the queries are served during and after the failed refresh
+			defs, err := driver.GetByPackName(context.Background(), c.SUSEEnterpriseServer, "15.1", "glib2-tools", "")
+			if err != nil {
+				t.Fatalf("Failed to GetByPackName. err: %s", err)
+			}
+			if len(defs) != 1 {
+				t.Errorf("expected: the definition of the first refresh, actual: %+v", defs)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	want := map[int]string{1: refreshSucceeded, 2: refreshFailed, 3: refreshSucceeded}
+	for count, status := range want {
+		if statuses[count] != status {
+			t.Errorf("expected: the refresh %d %s, actual: %v", count, status, statuses)
+		}
+	}
+}
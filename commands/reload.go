@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// openServedDB opens the DB to serve, failing if its schema is older than the server's, e.g. of the sqlite3 file built by the old binary
+func openServedDB(path string, option db.Option) (db.DB, error) {
+	driver, err := openDB(path, option)
+	if err != nil {
+		return nil, err
+	}
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		_ = driver.CloseDB()
+		return nil, xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+	}
+	if fetchMeta.OutDated() {
+		_ = driver.CloseDB()
+		return nil, xerrors.Errorf("Failed to serve DB. err: SchemaVersion is old. SchemaVersion: %+v", map[string]uint{"latest": models.LatestSchemaVersion, "DB": fetchMeta.SchemaVersion})
+	}
+	return driver, nil
+}
+
+// dbWatcher reopens the sqlite3 DB served when its file is replaced, e.g. renamed over by the job building it apart, which the open
+// handle never sees, as it reads the old file until closed. The file is checked every interval, if positive, for another file or
+// the modified one, and reopened on SIGHUP anyway. The other DB types are pinged on SIGHUP instead, as their connections are reconnected
+// by themselves.
+type dbWatcher struct {
+	driver   db.DB
+	path     string
+	interval time.Duration
+
+	last os.FileInfo
+}
+
+// run reloads the DB on hup and on the replaced file until ctx is done
+func (w *dbWatcher) run(ctx context.Context, hup <-chan os.Signal) {
+	reloader, ok := w.driver.(*db.ReloadDB)
+	var tick <-chan time.Time
+	if ok && w.interval > 0 {
+		w.last, _ = os.Stat(w.path)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if !ok {
+				if err := w.driver.Ping(); err != nil {
+					log15.Error("Failed to ping DB on SIGHUP", "err", err)
+					continue
+				}
+				log15.Info("Pinged DB on SIGHUP")
+				continue
+			}
+			w.last, _ = os.Stat(w.path)
+			w.reload(reloader, "SIGHUP")
+		case <-tick:
+			fi, err := os.Stat(w.path)
+			if err != nil || !w.replaced(fi) {
+				// the file missing for a moment while being replaced is checked again at the next interval
+				continue
+			}
+			w.last = fi
+			w.reload(reloader, "replaced")
+		}
+	}
+}
+
+// replaced reports whether fi is of another file than the last one, or of the one modified since
+func (w *dbWatcher) replaced(fi os.FileInfo) bool {
+	return w.last == nil || !os.SameFile(w.last, fi) || !fi.ModTime().Equal(w.last.ModTime())
+}
+
+// reload reopens the DB, keeping the current one if it fails, e.g. of the file not built completely, until the file is replaced again
+func (w *dbWatcher) reload(reloader *db.ReloadDB, reason string) {
+	if err := reloader.Reload(); err != nil {
+		log15.Error("Failed to reload DB", "Path", w.path, "Reason", reason, "err", err)
+		return
+	}
+	log15.Info("Reloaded DB", "Path", w.path, "Reason", reason)
+}
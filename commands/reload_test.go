@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/server"
+)
+
+// reloadTestRoot returns the OVAL of RedHat 7 of the definition of defID affecting kernel
+func reloadTestRoot(defID string) *models.Root {
+	return &models.Root{
+		Family:    c.RedHat,
+		OSVersion: "7",
+		Timestamp: time.Now(),
+		Definitions: []models.Definition{{
+			DefinitionID:  defID,
+			AffectedPacks: []models.Package{{Name: "kernel", Version: "0:3.10.0-514.16.1.el7"}},
+		}},
+	}
+}
+
+func TestDBWatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		// replaced tells the watcher the file is replaced, if not by itself
+		replaced func(hup chan<- os.Signal)
+	}{
+		{name: "interval", interval: 20 * time.Millisecond, replaced: func(chan<- os.Signal) {}},
+		{name: "SIGHUP", replaced: func(hup chan<- os.Signal) { hup <- os.Interrupt }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			served := filepath.Join(dir, "oval.sqlite3")
+			if err := os.Rename(testdb.File(t, filepath.Join(dir, "first.sqlite3"), reloadTestRoot("first")), served); err != nil {
+				t.Fatalf("Failed to rename DB. err: %s", err)
+			}
+
+			option := db.Option{ReadOnly: true}
+			driver, err := openServedDB(served, option)
+			if err != nil {
+				t.Fatalf("Failed to open DB. err: %s", err)
+			}
+			reloader := db.NewReloadDB(driver, func() (db.DB, error) { return openServedDB(served, option) })
+			defer reloader.CloseDB()
+
+			socket := filepath.Join(dir, "goval-dictionary.sock")
+			for k, v := range map[string]any{"listen": "unix://" + socket, "socket-mode": "0600", "quiet": true, "access-log": false} {
+				viper.Set(k, v)
+				defer viper.Set(k, nil)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errc := make(chan error, 1)
+			go func() { errc <- server.Start(ctx, reloader, nil) }()
+			defer func() {
+				cancel()
+				if err := <-errc; err != nil {
+					t.Errorf("Failed to serve. err: %s", err)
+				}
+			}()
+
+			hup := make(chan os.Signal, 1)
+			go (&dbWatcher{driver: reloader, path: served, interval: tt.interval}).run(ctx, hup)
+
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+				},
+			}}
+			// lookup returns the definition served for kernel, waiting up to 10 seconds for it to be want, beyond the 5 seconds
+			// the timestamps of the OVAL are cached for, until which the lookups cached of the DB reloaded are still served
+			lookup := func(want string) string {
+				t.Helper()
+				got := ""
+				for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+					res, err := client.Get("http://unix/packs/redhat/7/kernel")
+					if err != nil {
+						continue
+					}
+					var body struct {
+						Definitions []models.Definition `json:"definitions"`
+					}
+					err = json.NewDecoder(res.Body).Decode(&body)
+					res.Body.Close()
+					if err != nil || len(body.Definitions) != 1 {
+						t.Fatalf("expected: a definition, actual: %+v, err: %v", body.Definitions, err)
+					}
+					if got = body.Definitions[0].DefinitionID; got == want {
+						break
+					}
+				}
+				return got
+			}
+
+			if got := lookup("first"); got != "first" {
+				t.Fatalf("expected: first, actual: %s", got)
+			}
+
+			// renamed over by the DB built apart, as the refresh job does
+			if err := os.Rename(testdb.File(t, filepath.Join(dir, "second.sqlite3"), reloadTestRoot("second")), served); err != nil {
+				t.Fatalf("Failed to rename DB. err: %s", err)
+			}
+			tt.replaced(hup)
+			if got := lookup("second"); got != "second" {
+				t.Errorf("replaced: expected: second, actual: %s", got)
+			}
+
+			// the broken file keeps the DB served
+			broken := filepath.Join(dir, "broken.sqlite3")
+			if err := os.WriteFile(broken, []byte("not a DB"), 0600); err != nil {
+				t.Fatalf("Failed to write file. err: %s", err)
+			}
+			if err := os.Rename(broken, served); err != nil {
+				t.Fatalf("Failed to rename file. err: %s", err)
+			}
+			tt.replaced(hup)
+			time.Sleep(100 * time.Millisecond)
+			if got := lookup("second"); got != "second" {
+				t.Errorf("broken: expected: second, actual: %s", got)
+			}
+		})
+	}
+}
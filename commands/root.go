@@ -4,17 +4,40 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/inconshreveable/log15"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
 
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
 	"github.com/vulsio/goval-dictionary/log"
 )
 
 var cfgFile string
 
+// envPrefix is the prefix of the environment variables of the flags, e.g. GOVAL_DICTIONARY_DBPATH of --dbpath
+const envPrefix = "GOVAL_DICTIONARY"
+
+// envKeyReplacer replaces the key of viper into the environment variable without the prefix, e.g. debian.base-url into DEBIAN_BASE_URL
+var envKeyReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+// envName returns the environment variable of the key of viper, e.g. GOVAL_DICTIONARY_DEBIAN_BASE_URL of debian.base-url
+func envName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(envKeyReplacer.Replace(key))
+}
+
+// bindFlag binds flag to the key of viper, which is read from the environment variable envName(key) as well unless the flag is given,
+// and shows the environment variable in the usage of the flag
+func bindFlag(key string, flag *pflag.Flag) {
+	_ = viper.BindPFlag(key, flag)
+	flag.Usage = fmt.Sprintf("%s (env: %s)", flag.Usage, envName(key))
+}
+
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:           "goval-dictionary",
@@ -27,38 +50,172 @@ var RootCmd = &cobra.Command{
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.oval.yaml)")
+	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file in TOML, YAML or JSON by the extension (default is $HOME/.goval-dictionary.{toml,yaml,json}) (env: "+envName("config")+")")
 
 	RootCmd.PersistentFlags().Bool("log-to-file", false, "output log to file")
-	_ = viper.BindPFlag("log-to-file", RootCmd.PersistentFlags().Lookup("log-to-file"))
+	bindFlag("log-to-file", RootCmd.PersistentFlags().Lookup("log-to-file"))
+
+	RootCmd.PersistentFlags().String("log-dir", "", "/path/to/log (default: "+log.GetDefaultLogDir()+", or $XDG_STATE_HOME/goval-dictionary or the temporary directory if not writable)")
+	bindFlag("log-dir", RootCmd.PersistentFlags().Lookup("log-dir"))
 
-	RootCmd.PersistentFlags().String("log-dir", log.GetDefaultLogDir(), "/path/to/log")
-	_ = viper.BindPFlag("log-dir", RootCmd.PersistentFlags().Lookup("log-dir"))
+	RootCmd.PersistentFlags().Int("log-max-size", 100, "rotate the log file when it reaches the size in megabytes, never if 0")
+	bindFlag("log-max-size", RootCmd.PersistentFlags().Lookup("log-max-size"))
+
+	RootCmd.PersistentFlags().Int("log-max-backups", 5, "number of the rotated log files kept")
+	bindFlag("log-max-backups", RootCmd.PersistentFlags().Lookup("log-max-backups"))
+
+	RootCmd.PersistentFlags().Duration("log-max-age", 0, "remove the rotated log files older than the duration, e.g. 720h, never by age if 0")
+	bindFlag("log-max-age", RootCmd.PersistentFlags().Lookup("log-max-age"))
+
+	RootCmd.PersistentFlags().Bool("log-compress", false, "gzip the rotated log files")
+	bindFlag("log-compress", RootCmd.PersistentFlags().Lookup("log-compress"))
+
+	RootCmd.PersistentFlags().Bool("log-sql-to-file", false, "log the SQL of --debug-sql and --slow-query-threshold to sql.log apart in the directory of --log-to-file")
+	bindFlag("log-sql-to-file", RootCmd.PersistentFlags().Lookup("log-sql-to-file"))
 
 	RootCmd.PersistentFlags().Bool("log-json", false, "output log as JSON")
-	_ = viper.BindPFlag("log-json", RootCmd.PersistentFlags().Lookup("log-json"))
+	bindFlag("log-json", RootCmd.PersistentFlags().Lookup("log-json"))
+
+	RootCmd.PersistentFlags().Bool("log-to-stderr", true, "output log to stderr, where stdout is reserved for the data, e.g. of select")
+	bindFlag("log-to-stderr", RootCmd.PersistentFlags().Lookup("log-to-stderr"))
+
+	RootCmd.PersistentFlags().Bool("quiet", false, "output only the warnings and the errors to stderr, without the progress bars")
+	bindFlag("quiet", RootCmd.PersistentFlags().Lookup("quiet"))
 
 	RootCmd.PersistentFlags().Bool("debug", false, "debug mode (default: false)")
-	_ = viper.BindPFlag("debug", RootCmd.PersistentFlags().Lookup("debug"))
+	bindFlag("debug", RootCmd.PersistentFlags().Lookup("debug"))
 
 	RootCmd.PersistentFlags().Bool("debug-sql", false, "SQL debug mode")
-	_ = viper.BindPFlag("debug-sql", RootCmd.PersistentFlags().Lookup("debug-sql"))
+	bindFlag("debug-sql", RootCmd.PersistentFlags().Lookup("debug-sql"))
+
+	RootCmd.PersistentFlags().Duration("slow-query-threshold", 0, "log the SQL taking the duration or longer at the info level even without --debug-sql, e.g. 500ms, never if 0")
+	bindFlag("slow-query-threshold", RootCmd.PersistentFlags().Lookup("slow-query-threshold"))
 
-	pwd := os.Getenv("PWD")
-	RootCmd.PersistentFlags().String("dbpath", filepath.Join(pwd, "oval.sqlite3"), "/path/to/sqlite3 or SQL connection string")
-	_ = viper.BindPFlag("dbpath", RootCmd.PersistentFlags().Lookup("dbpath"))
+	RootCmd.PersistentFlags().Bool("no-wal-checkpoint", false, "skip the checkpoint of the WAL of sqlite3 after inserting the OVAL of each family and version, still checkpointed when the DB is closed")
+	bindFlag("no-wal-checkpoint", RootCmd.PersistentFlags().Lookup("no-wal-checkpoint"))
+
+	// $PWD is empty under cron, while the relative path is resolved from the working directory anyway
+	wd, _ := os.Getwd()
+	RootCmd.PersistentFlags().String("dbpath", filepath.Join(wd, "oval.sqlite3"), "/path/to/sqlite3 or SQL connection string")
+	bindFlag("dbpath", RootCmd.PersistentFlags().Lookup("dbpath"))
 
 	RootCmd.PersistentFlags().String("dbtype", "sqlite3", "Database type to store data in (sqlite3, mysql, postgres or redis supported)")
-	_ = viper.BindPFlag("dbtype", RootCmd.PersistentFlags().Lookup("dbtype"))
+	bindFlag("dbtype", RootCmd.PersistentFlags().Lookup("dbtype"))
+	_ = RootCmd.RegisterFlagCompletionFunc("dbtype", cobra.FixedCompletions(db.Types(), cobra.ShellCompDirectiveNoFileComp))
+
+	RootCmd.PersistentFlags().String("read-dbpath", "", "/path/to/sqlite3 or SQL connection string of the DB to look up the OVAL in apart, e.g. the read replica of MySQL, while written to --dbpath (default: empty, --dbpath for both)")
+	bindFlag("read-dbpath", RootCmd.PersistentFlags().Lookup("read-dbpath"))
+
+	RootCmd.PersistentFlags().String("read-dbtype", "", "Database type of --read-dbpath (default: empty, --dbtype)")
+	bindFlag("read-dbtype", RootCmd.PersistentFlags().Lookup("read-dbtype"))
+	_ = RootCmd.RegisterFlagCompletionFunc("read-dbtype", cobra.FixedCompletions(db.Types(), cobra.ShellCompDirectiveNoFileComp))
+
+	RootCmd.PersistentFlags().String("http-proxy", "", "http://[user:password@]proxy-url:port or socks5://[user:password@]proxy-url:port for both of http and https (default: empty, HTTP_PROXY and HTTPS_PROXY)")
+	bindFlag("http-proxy", RootCmd.PersistentFlags().Lookup("http-proxy"))
+
+	RootCmd.PersistentFlags().String("no-proxy", "", "comma-separated hosts, domains and CIDRs to bypass the proxy (default: empty, NO_PROXY)")
+	bindFlag("no-proxy", RootCmd.PersistentFlags().Lookup("no-proxy"))
+
+	RootCmd.PersistentFlags().StringArray("http-header", nil, "extra \"Name: value\" header to send with every request, repeatable (default User-Agent: goval-dictionary/<version>)")
+	bindFlag("http-header", RootCmd.PersistentFlags().Lookup("http-header"))
+
+	RootCmd.PersistentFlags().String("cacert", "", "/path/to/ca.pem to trust in addition to the system CAs, e.g. of the TLS intercepting proxy")
+	bindFlag("cacert", RootCmd.PersistentFlags().Lookup("cacert"))
 
-	RootCmd.PersistentFlags().String("http-proxy", "", "http://proxy-url:port (default: empty)")
-	_ = viper.BindPFlag("http-proxy", RootCmd.PersistentFlags().Lookup("http-proxy"))
+	RootCmd.PersistentFlags().Bool("insecure-skip-verify", false, "skip the TLS certificate verification (insecure, prefer --cacert)")
+	bindFlag("insecure-skip-verify", RootCmd.PersistentFlags().Lookup("insecure-skip-verify"))
+}
+
+// setLogger is PersistentPreRunE of the subcommands, which validates the config shared by them and sets the logger by their flags,
+// e.g. --log-json and --quiet, logging to the file of the subcommand with --log-to-file, e.g. fetch-redhat.log of fetch redhat
+func setLogger(cmd *cobra.Command, _ []string) error {
+	conf, err := config.Load(viper.GetViper())
+	if err != nil {
+		return err
+	}
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	file := log.FileOption{
+		Name:       logFileName(cmd),
+		MaxSize:    int64(conf.LogMaxSize) * 1024 * 1024,
+		MaxBackups: conf.LogMaxBackups,
+		MaxAge:     conf.LogMaxAge,
+		Compress:   conf.LogCompress,
+		SQL:        conf.LogSQLToFile,
+	}
+	if err := log.SetLogger(conf.LogToFile, conf.LogDir, conf.Debug, conf.DebugSQL, conf.LogJSON, conf.Quiet, conf.LogToStderr, file); err != nil {
+		return xerrors.Errorf("Failed to SetLogger. err: %w", err)
+	}
+	return nil
+}
+
+// logFileName returns the name of the log file of cmd, its path without the root command joined by -, e.g. fetch-redhat
+func logFileName(cmd *cobra.Command) string {
+	path := strings.Fields(cmd.CommandPath())
+	if len(path) < 2 {
+		return ""
+	}
+	return strings.Join(path[1:], "-")
+}
+
+// resolveDBPath returns the dbpath of the sqlite3 DB as the absolute path, checking its directory is writable unless readOnly,
+// or the connection string of the others as it is
+func resolveDBPath(readOnly bool) (string, error) {
+	dbType := viper.GetString("dbtype")
+	path, err := config.ResolveDBPath(dbType, viper.GetString("dbpath"))
+	if err != nil {
+		return "", xerrors.Errorf("Failed to resolve dbpath. err: %w", err)
+	}
+	if dbType != "sqlite3" {
+		return path, nil
+	}
+	if !readOnly {
+		if err := config.PrepareDBDir(path, viper.GetBool("create-db-dir")); err != nil {
+			if xerrors.Is(err, config.ErrNoDBDir) {
+				return "", xerrors.Errorf("Failed to prepare dbpath. Create the directory, or use --create-db-dir. err: %w", err)
+			}
+			return "", xerrors.Errorf("Failed to prepare dbpath. err: %w", err)
+		}
+	}
+	log15.Info("Using DB", "Type", dbType, "Path", path)
+	return path, nil
+}
+
+// openDB opens the DB at path resolved by resolveDBPath, of the flags shared by the subcommands, i.e. --dbtype, --debug-sql, --slow-query-threshold
+// and --no-wal-checkpoint, and the DB of --read-dbpath and --read-dbtype apart for the lookups if given
+func openDB(path string, option db.Option) (db.DB, error) {
+	option.SlowQueryThreshold = viper.GetDuration("slow-query-threshold")
+	option.NoWALCheckpoint = viper.GetBool("no-wal-checkpoint")
+	if readPath := viper.GetString("read-dbpath"); readPath != "" {
+		option.ReadDBType = viper.GetString("read-dbtype")
+		if option.ReadDBType == "" {
+			option.ReadDBType = viper.GetString("dbtype")
+		}
+		p, err := config.ResolveDBPath(option.ReadDBType, readPath)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to resolve read-dbpath. err: %w", err)
+		}
+		option.ReadDBPath = p
+	}
+	driver, err := db.NewDB(viper.GetString("dbtype"), path, viper.GetBool("debug-sql"), option)
+	if err != nil {
+		if xerrors.Is(err, db.ErrDBLocked) {
+			return nil, xerrors.Errorf("Failed to open DB. Close DB connection before fetching. err: %w", err)
+		}
+		return nil, xerrors.Errorf("Failed to open DB. err: %w", err)
+	}
+	return driver, nil
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
-	if cfgFile != "" {
-		viper.SetConfigFile(cfgFile)
+	path := cfgFile
+	if path == "" {
+		path = os.Getenv(envName("config"))
+	}
+	if path != "" {
+		viper.SetConfigFile(path)
 	} else {
 		// Find home directory.
 		home, err := homedir.Dir()
@@ -72,10 +229,42 @@ func initConfig() {
 		viper.SetConfigName(".goval-dictionary")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	if err := readConfig(viper.GetViper()); err != nil {
+		// the config file given explicitly must be read, while the default one is optional
+		var notFound viper.ConfigFileNotFoundError
+		if path == "" && xerrors.As(err, &notFound) {
+			return
+		}
+		log15.Error("Failed to read config file.", "err", err)
+		os.Exit(1)
+	}
+}
+
+// readConfig reads the config file of v, in TOML, YAML or JSON by the extension, and the environment variables GOVAL_DICTIONARY_<KEY>,
+// e.g. GOVAL_DICTIONARY_DBPATH and GOVAL_DICTIONARY_DEBIAN_BASE_URL, in the order of precedence: flag > env > config file > default.
+// The unknown keys in the config file are warned, not failed.
+func readConfig(v *viper.Viper) error {
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(envKeyReplacer)
+	v.AutomaticEnv()
+	// the keys without the flags, e.g. debian.versions, are known to viper only if bound
+	for _, k := range config.Keys() {
+		_ = v.BindEnv(k)
+	}
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	if err := v.ReadInConfig(); err != nil {
+		return xerrors.Errorf("Failed to read config file. err: %w", err)
+	}
+	log15.Info("Using config file", "path", v.ConfigFileUsed())
+
+	// the keys of the config file only, without the ones of the flags and the environment variables
+	file := viper.New()
+	file.SetConfigFile(v.ConfigFileUsed())
+	if err := file.ReadInConfig(); err != nil {
+		return xerrors.Errorf("Failed to read config file. err: %w", err)
+	}
+	for _, k := range config.UnknownKeys(file.AllKeys()) {
+		log15.Warn("Unknown key in the config file", "key", k, "path", v.ConfigFileUsed())
 	}
+	return nil
 }
@@ -0,0 +1,366 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+)
+
+func TestReadConfig(t *testing.T) {
+	const toml = `dbtype = "mysql"
+dbpath = "user:pass@tcp(127.0.0.1:3306)/oval"
+retry = 5
+timeout = "5m"
+unknown-key = true
+
+[debian]
+base-url = "https://mirror.example.com/debian/oval/"
+versions = ["11", "12"]
+all = true
+
+[redhat]
+versions = ["8", "9"]
+typo = "x"
+`
+	p := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(p, []byte(toml), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+
+	type want struct {
+		dbType   string
+		retry    int
+		timeout  time.Duration
+		threads  int
+		baseURL  string
+		versions []string
+	}
+	tests := []struct {
+		name  string
+		env   map[string]string
+		flags []string
+		want  want
+	}{
+		{
+			name: "config file over default",
+			want: want{dbType: "mysql", retry: 5, timeout: 5 * time.Minute, threads: 3, baseURL: "https://mirror.example.com/debian/oval/", versions: []string{"11", "12"}},
+		},
+		{
+			name: "env over config file",
+			env: map[string]string{
+				"GOVAL_DICTIONARY_RETRY":           "7",
+				"GOVAL_DICTIONARY_THREADS":         "4",
+				"GOVAL_DICTIONARY_DEBIAN_BASE_URL": "https://env.example.com/debian/oval/",
+				"GOVAL_DICTIONARY_DEBIAN_VERSIONS": "10,11",
+			},
+			want: want{dbType: "mysql", retry: 7, timeout: 5 * time.Minute, threads: 4, baseURL: "https://env.example.com/debian/oval/", versions: []string{"10", "11"}},
+		},
+		{
+			name: "flag over env",
+			env: map[string]string{
+				"GOVAL_DICTIONARY_RETRY":  "7",
+				"GOVAL_DICTIONARY_DBTYPE": "postgres",
+			},
+			flags: []string{"--retry", "9", "--base-url", "https://flag.example.com/debian/oval/"},
+			want:  want{dbType: "postgres", retry: 9, timeout: 5 * time.Minute, threads: 3, baseURL: "https://flag.example.com/debian/oval/", versions: []string{"11", "12"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			v := viper.New()
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			fs.String("dbtype", "sqlite3", "")
+			fs.Int("retry", 3, "")
+			fs.Duration("timeout", 10*time.Minute, "")
+			fs.Int("threads", 3, "")
+			fs.String("base-url", "", "")
+			for key, name := range map[string]string{"dbtype": "dbtype", "retry": "retry", "timeout": "timeout", "threads": "threads", "debian.base-url": "base-url"} {
+				if err := v.BindPFlag(key, fs.Lookup(name)); err != nil {
+					t.Fatalf("Failed to bind flag. err: %s", err)
+				}
+			}
+			if err := fs.Parse(tt.flags); err != nil {
+				t.Fatalf("Failed to parse flags. err: %s", err)
+			}
+			v.SetConfigFile(p)
+
+			if err := readConfig(v); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			conf, err := config.Load(v)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got := want{dbType: conf.DBType, retry: conf.Retry, timeout: conf.Timeout, threads: conf.Threads, baseURL: conf.Debian.BaseURL, versions: conf.Debian.Versions}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, got)
+			}
+			if !conf.Debian.All || !reflect.DeepEqual(conf.RedHat.Versions, []string{"8", "9"}) {
+				t.Errorf("expected: the family sections of the config file, actual: %+v, %+v", conf.Debian, conf.RedHat)
+			}
+		})
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	keys := []string{"dbpath", "debian.base-url", "debian.all", "redhat.all", "redhat.typo", "unknown-key", "Retry"}
+	if expected, actual := []string{"redhat.all", "redhat.typo", "unknown-key"}, config.UnknownKeys(keys); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %q, actual: %q", expected, actual)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	defer func() {
+		wd, _ := os.Getwd()
+		_ = RootCmd.PersistentFlags().Set("dbpath", filepath.Join(wd, "oval.sqlite3"))
+		RootCmd.PersistentFlags().Lookup("dbpath").Changed = false
+		RootCmd.SetOut(nil)
+	}()
+	// --base-url set by the other tests takes precedence over the env as given, even if empty
+	fetchDebianCmd.Flags().Lookup("base-url").Changed = false
+	// no config file in $HOME
+	t.Setenv("HOME", t.TempDir())
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want func(config.Conf) bool
+	}{
+		{
+			name: "env over default",
+			env: map[string]string{
+				"GOVAL_DICTIONARY_DBTYPE":          "mysql",
+				"GOVAL_DICTIONARY_HTTP_PROXY":      "http://proxy.example.com:8080",
+				"GOVAL_DICTIONARY_LOG_DIR":         "/tmp/goval-dictionary",
+				"GOVAL_DICTIONARY_RETRY":           "5",
+				"GOVAL_DICTIONARY_DEBIAN_BASE_URL": "https://env.example.com/debian/oval/",
+			},
+			args: []string{"version"},
+			want: func(conf config.Conf) bool {
+				return conf.DBType == "mysql" && conf.HTTPProxy == "http://proxy.example.com:8080" && conf.LogDir == "/tmp/goval-dictionary" && conf.Retry == 5 && conf.Debian.BaseURL == "https://env.example.com/debian/oval/"
+			},
+		},
+		{
+			name: "flag over env",
+			env: map[string]string{
+				"GOVAL_DICTIONARY_DBTYPE": "mysql",
+				"GOVAL_DICTIONARY_DBPATH": "user:pass@tcp(127.0.0.1:3306)/oval",
+			},
+			args: []string{"version", "--dbpath", "/tmp/oval.sqlite3"},
+			want: func(conf config.Conf) bool {
+				return conf.DBType == "mysql" && conf.DBPath == "/tmp/oval.sqlite3"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			RootCmd.SetOut(io.Discard)
+			RootCmd.SetArgs(tt.args)
+			if err := RootCmd.Execute(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			conf, err := config.Load(viper.GetViper())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !tt.want(conf) {
+				t.Errorf("unexpected conf: %+v", conf)
+			}
+		})
+	}
+}
+
+func TestEnvUsage(t *testing.T) {
+	for _, tt := range []struct {
+		flag *pflag.Flag
+		want string
+	}{
+		{flag: RootCmd.PersistentFlags().Lookup("dbpath"), want: "(env: GOVAL_DICTIONARY_DBPATH)"},
+		{flag: RootCmd.PersistentFlags().Lookup("config"), want: "(env: GOVAL_DICTIONARY_CONFIG)"},
+		{flag: fetchCmd.PersistentFlags().Lookup("retry"), want: "(env: GOVAL_DICTIONARY_RETRY)"},
+		{flag: fetchDebianCmd.Flags().Lookup("base-url"), want: "(env: GOVAL_DICTIONARY_DEBIAN_BASE_URL)"},
+		{flag: selectCmd.PersistentFlags().Lookup("format"), want: "(env: GOVAL_DICTIONARY_SELECT_FORMAT)"},
+	} {
+		if tt.flag == nil {
+			t.Fatalf("flag not found: %s", tt.want)
+		}
+		if !strings.HasSuffix(tt.flag.Usage, tt.want) {
+			t.Errorf("expected: the usage of --%s ending with %s, actual: %s", tt.flag.Name, tt.want, tt.flag.Usage)
+		}
+	}
+}
+
+// TestSharedFlags checks the flags shared by the subcommands are declared once and inherited by every one of them
+func TestSharedFlags(t *testing.T) {
+	root := []string{"dbtype", "dbpath", "debug", "debug-sql", "log-dir", "log-json", "quiet", "http-proxy"}
+	fetch := []string{"batch-size", "retry", "timeout", "run-timeout", "force", "dry-run", "lock-timeout"}
+
+	cmds := append([]*cobra.Command{selectCmd, serverCmd, statusCmd, purgeCmd, exportCmd, importCmd, dbCmd}, fetchCmd.Commands()...)
+	for _, cmd := range cmds {
+		names := root
+		if cmd.Parent() == fetchCmd {
+			names = append(append([]string{}, root...), fetch...)
+		}
+		for _, name := range names {
+			if cmd.InheritedFlags().Lookup(name) == nil {
+				t.Errorf("expected: --%s inherited by %s", name, cmd.CommandPath())
+			}
+		}
+	}
+}
+
+// TestSharedLogger runs the subcommands with --log-json and --debug, and checks the logger is set by the shared flags for each of them
+func TestSharedLogger(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "suse.linux.enterprise.server.15.xml"), []byte(localSUSEOVAL), 0600); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	dbpath := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), selectTestRoots()...)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{
+			name: "fetch",
+			args: []string{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dry-run", "--log-json", "--debug", "15"},
+		},
+		{
+			name: "select",
+			args: []string{"select", "--by-package", "--dbpath", dbpath, "--log-json", "--debug", "redhat", "7", "kernel"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr := os.Stderr
+			defer func() {
+				os.Stderr = stderr
+				for _, name := range []string{"log-json", "debug"} {
+					_ = RootCmd.PersistentFlags().Set(name, "false")
+				}
+				_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+				_ = fetchCmd.PersistentFlags().Set("dry-run", "false")
+				_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+				_ = selectCmd.PersistentFlags().Set("by-package", "false")
+				log15.Root().SetHandler(log15.StderrHandler)
+				RootCmd.SetOut(nil)
+			}()
+			f, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+			if err != nil {
+				t.Fatalf("Failed to create stderr. err: %s", err)
+			}
+			defer f.Close()
+			os.Stderr = f
+
+			RootCmd.SetOut(io.Discard)
+			RootCmd.SetArgs(tt.args)
+			if err := RootCmd.Execute(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			log15.Debug("Set by the shared flags")
+
+			bs, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatalf("Failed to read stderr. err: %s", err)
+			}
+			if want := `"lvl":"dbug","msg":"Set by the shared flags"`; !strings.Contains(string(bs), want) {
+				t.Errorf("expected: %s in stderr, actual: %s", want, bs)
+			}
+		})
+	}
+}
+
+// TestValidateConfig runs the subcommands with the config of several problems, and checks all of them are returned before running
+func TestValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "file")
+	if err := os.WriteFile(logDir, nil, 0600); err != nil {
+		t.Fatalf("Failed to write file. err: %s", err)
+	}
+	flags := []string{"--dbtype", "mysql", "--dbpath", "user:secret@tcp(127.0.0.1:3306", "--http-proxy", "ftp://proxy.example.com", "--log-to-file", "--log-dir", logDir}
+	defaults := map[string]string{}
+	for _, name := range []string{"dbtype", "dbpath", "http-proxy", "log-to-file", "log-dir"} {
+		defaults[name] = RootCmd.PersistentFlags().Lookup(name).DefValue
+	}
+
+	for _, args := range [][]string{
+		{"status"},
+		{"select", "--by-package", "redhat", "7", "kernel"},
+		{"fetch", "suse", "--suse-type", "suse-enterprise-server", "--local-dir", dir, "--dry-run", "15"},
+	} {
+		t.Run(args[0], func(t *testing.T) {
+			defer func() {
+				for name, v := range defaults {
+					_ = RootCmd.PersistentFlags().Set(name, v)
+				}
+				_ = fetchCmd.PersistentFlags().Set("local-dir", "")
+				_ = fetchCmd.PersistentFlags().Set("dry-run", "false")
+				_ = fetchSUSECmd.PersistentFlags().Set("suse-type", "opensuse-leap")
+				_ = selectCmd.PersistentFlags().Set("by-package", "false")
+				RootCmd.SetOut(nil)
+			}()
+
+			RootCmd.SetOut(io.Discard)
+			RootCmd.SetArgs(append(args, flags...))
+			err := RootCmd.Execute()
+			var ve *config.ValidationError
+			if !xerrors.As(err, &ve) || len(ve.Errs) != 3 {
+				t.Fatalf("expected: the errors of the 3 problems, actual: %v", err)
+			}
+			for _, want := range []string{"--dbpath: invalid DSN of MySQL", "--http-proxy: invalid proxy URL", "--log-dir: not a directory"} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected: %q in the error, actual: %s", want, err)
+				}
+			}
+			if strings.Contains(err.Error(), "secret") {
+				t.Errorf("expected: the password redacted, actual: %s", err)
+			}
+			if code := ExitCode(err); code != ExitUsage {
+				t.Errorf("exit code: expected: %d, actual: %d", ExitUsage, code)
+			}
+		})
+	}
+}
+
+func TestLogFileName(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"fetch", "redhat"}, want: "fetch-redhat"},
+		{args: []string{"fetch", "debian"}, want: "fetch-debian"},
+		{args: []string{"server"}, want: "server"},
+		{args: nil, want: ""},
+	}
+	for _, tt := range tests {
+		cmd, _, err := RootCmd.Find(tt.args)
+		if err != nil {
+			t.Fatalf("Failed to find %q. err: %s", tt.args, err)
+		}
+		if got := logFileName(cmd); got != tt.want {
+			t.Errorf("%q: expected: %q, actual: %q", tt.args, tt.want, got)
+		}
+	}
+}
@@ -1,16 +1,23 @@
 package commands
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
 
-	"github.com/k0kubun/pp"
+	"github.com/inconshreveable/log15"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
 	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
 
 	"github.com/vulsio/goval-dictionary/config"
 	"github.com/vulsio/goval-dictionary/db"
-	"github.com/vulsio/goval-dictionary/log"
+	"github.com/vulsio/goval-dictionary/goval"
 	"github.com/vulsio/goval-dictionary/models"
 )
 
@@ -20,46 +27,72 @@ var selectCmd = &cobra.Command{
 	Short: "Select from DB",
 	Long:  `Select from DB`,
 	RunE:  executeSelect,
+
+	PersistentPreRunE: setLogger,
 }
 
 func init() {
 	RootCmd.AddCommand(selectCmd)
 
 	selectCmd.PersistentFlags().Bool("by-package", false, "select OVAL by package name")
-	_ = viper.BindPFlag("by-package", selectCmd.PersistentFlags().Lookup("by-package"))
+	bindFlag("by-package", selectCmd.PersistentFlags().Lookup("by-package"))
 
 	selectCmd.PersistentFlags().Bool("by-cveid", false, "select OVAL by CVE-ID")
-	_ = viper.BindPFlag("by-cveid", selectCmd.PersistentFlags().Lookup("by-cveid"))
-}
+	bindFlag("by-cveid", selectCmd.PersistentFlags().Lookup("by-cveid"))
 
-func executeSelect(_ *cobra.Command, args []string) error {
-	if err := log.SetLogger(viper.GetBool("log-to-file"), viper.GetString("log-dir"), viper.GetBool("debug"), viper.GetBool("log-json")); err != nil {
-		return xerrors.Errorf("Failed to SetLogger. err: %w", err)
-	}
+	selectCmd.PersistentFlags().Bool("by-cpe", false, "select OVAL by CPE, matching the affected CPEs starting with it")
+	bindFlag("by-cpe", selectCmd.PersistentFlags().Lookup("by-cpe"))
+
+	selectCmd.PersistentFlags().Bool("by-advisory", false, "select OVAL by advisory ID, e.g. DSA-3981-1, RHSA-2017:0933, of all its revisions if without the revision")
+	bindFlag("by-advisory", selectCmd.PersistentFlags().Lookup("by-advisory"))
+
+	selectCmd.PersistentFlags().Bool("list-packages", false, "list the distinct names of the affected packages of the release, sorted")
+	bindFlag("list-packages", selectCmd.PersistentFlags().Lookup("list-packages"))
+
+	selectCmd.PersistentFlags().StringSlice("class", nil, "select OVAL by package name of the definition classes only, e.g. patch, vulnerability")
+	bindFlag("class", selectCmd.PersistentFlags().Lookup("class"))
+
+	// bound to "select.format", as "format" is bound to the one of fetch --list
+	selectCmd.PersistentFlags().String("format", "text", "output format of the definitions (choices: text, json as the server responds, yaml, table, csv of the packages and the CVEs)")
+	bindFlag("select.format", selectCmd.PersistentFlags().Lookup("format"))
+	_ = selectCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(selectFormats, cobra.ShellCompDirectiveNoFileComp))
 
+	selectCmd.PersistentFlags().Bool("fail-on-empty", false, "exit with the error if no definitions are found")
+	bindFlag("fail-on-empty", selectCmd.PersistentFlags().Lookup("fail-on-empty"))
+}
+
+func executeSelect(cmd *cobra.Command, args []string) error {
 	flagPkg := viper.GetBool("by-package")
 	flagCveID := viper.GetBool("by-cveid")
+	flagCpe := viper.GetBool("by-cpe")
+	flagAdvisory := viper.GetBool("by-advisory")
+	flagList := viper.GetBool("list-packages")
 
-	if (!flagPkg && !flagCveID) || (flagPkg && flagCveID) {
-		return xerrors.New("Failed to select command. err: specify --by-package or --by-cveid")
+	n := 0
+	for _, f := range []bool{flagPkg, flagCveID, flagCpe, flagAdvisory, flagList} {
+		if f {
+			n++
+		}
+	}
+	if n != 1 {
+		return xerrors.New("Failed to select command. err: specify --by-package, --by-cveid, --by-cpe, --by-advisory or --list-packages")
 	}
 
-	if len(args) < 3 {
-		if flagPkg {
-			return xerrors.Errorf(`
+	if flagList && len(args) != 2 {
+		return xerrors.Errorf(`
 			Usage:
-			select OVAL by package name
-			$ goval-dictionary select --by-package [osFamily] [osVersion] [Package Name] [Optional: Architecture (Oracle, Amazon Only)]
+			list the affected packages
+			$ goval-dictionary select --list-packages [osFamily] [osVersion]
 			`)
-		}
-		if flagCveID {
-			return xerrors.Errorf(`
+	}
+	if flagCpe && len(args) != 3 {
+		return xerrors.Errorf(`
 			Usage:
-			select OVAL by CVE-ID
-			$ goval-dictionary select --by-cveid [osFamily] [osVersion] [CVE-ID] [Optional: Architecture (Oracle, Amazon Only)]
+			select OVAL by CPE
+			$ goval-dictionary select --by-cpe [osFamily] [osVersion] [CPE or its prefix]
 			`)
-		}
-	} else if len(args) > 4 {
+	}
+	if !flagList && (len(args) < 3 || len(args) > 4) {
 		if flagPkg {
 			return xerrors.Errorf(`
 			Usage:
@@ -67,35 +100,46 @@ func executeSelect(_ *cobra.Command, args []string) error {
 			$ goval-dictionary select --by-package [osFamily] [osVersion] [Package Name] [Optional: Architecture (Oracle, Amazon Only)]
 			`)
 		}
-		if flagCveID {
+		if flagAdvisory {
 			return xerrors.Errorf(`
+			Usage:
+			select OVAL by advisory ID
+			$ goval-dictionary select --by-advisory [osFamily] [osVersion] [Advisory ID] [Optional: Architecture (Oracle, Amazon Only)]
+			`)
+		}
+		return xerrors.Errorf(`
 			Usage:
 			select OVAL by CVE-ID
 			$ goval-dictionary select --by-cveid [osFamily] [osVersion] [CVE-ID] [Optional: Architecture (Oracle, Amazon Only)]
 			`)
-		}
 	}
 
-	family := args[0]
+	if !slices.Contains(selectFormats, viper.GetString("select.format")) {
+		return xerrors.Errorf("Unknown format: %s. Available format: %s", viper.GetString("select.format"), strings.Join(selectFormats, ", "))
+	}
+
+	family, err := config.NormalizeFamily(args[0])
+	if err != nil {
+		return xerrors.Errorf("Failed to select. err: %w", err)
+	}
 	release := args[1]
-	arg := args[2]
-	arch := ""
+	arg, arch := "", ""
+	if len(args) > 2 {
+		arg = args[2]
+	}
 	if len(args) == 4 {
-		switch family {
-		case config.Amazon, config.Oracle, config.Fedora:
-			arch = args[3]
-		default:
-			return xerrors.Errorf("Family: %s cannot use the Architecture argument.", family)
-		}
+		arch = args[3]
 	}
 
-	driver, err := db.NewDB(viper.GetString("dbtype"), viper.GetString("dbpath"), viper.GetBool("debug-sql"), db.Option{})
+	path, err := resolveDBPath(true)
 	if err != nil {
-		if xerrors.Is(err, db.ErrDBLocked) {
-			return xerrors.Errorf("Failed to open DB. Close DB connection before fetching. err: %w", err)
-		}
-		return xerrors.Errorf("Failed to open DB. err: %w", err)
+		return err
+	}
+	driver, err := openDB(path, db.Option{ReadOnly: true})
+	if err != nil {
+		return err
 	}
+	defer driver.CloseDB()
 
 	fetchMeta, err := driver.GetFetchMeta()
 	if err != nil {
@@ -105,38 +149,259 @@ func executeSelect(_ *cobra.Command, args []string) error {
 		return xerrors.Errorf("Failed to select command. err: SchemaVersion is old. SchemaVersion: %+v", map[string]uint{"latest": models.LatestSchemaVersion, "DB": fetchMeta.SchemaVersion})
 	}
 
-	if flagPkg {
-		dfs, err := driver.GetByPackName(family, release, arg, arch)
+	if flagList {
+		names, err := driver.ListPackages(cmd.Context(), family, release)
+		if err := warnNoSuchRelease(err); err != nil {
+			return xerrors.Errorf("Failed to list packages. err: %w", err)
+		}
+		if err := printPackageNames(cmd.OutOrStdout(), names); err != nil {
+			return xerrors.Errorf("Failed to print packages. err: %w", err)
+		}
+		if len(names) == 0 && viper.GetBool("fail-on-empty") {
+			return xerrors.Errorf("No packages found. family: %s, release: %s", family, release)
+		}
+		return nil
+	}
+
+	by := goval.ByCveID
+	switch {
+	case flagPkg:
+		by = goval.ByPackage
+	case flagCpe:
+		by = goval.ByCpe
+	case flagAdvisory:
+		by = goval.ByAdvisory
+	}
+	dfs, err := goval.Query(cmd.Context(), goval.QueryOptions{DB: driver, Family: family, Release: release, By: by, Arg: arg, Arch: arch, Classes: viper.GetStringSlice("class")})
+	if err := warnNoSuchRelease(err); err != nil {
+		return err
+	}
+
+	if err := printDefinitions(cmd.OutOrStdout(), dfs); err != nil {
+		return xerrors.Errorf("Failed to print definitions. err: %w", err)
+	}
+	if len(dfs) == 0 && viper.GetBool("fail-on-empty") {
+		return xerrors.Errorf("No OVAL definitions found. family: %s, release: %s, query: %s", family, release, arg)
+	}
+	return nil
+}
+
+// warnNoSuchRelease warns of err of the lookup of the release not fetched into DB, printing nothing found as of the release affected by nothing
+// but telling them apart on stderr, or returns err as is of the other errors
+func warnNoSuchRelease(err error) error {
+	if xerrors.Is(err, db.ErrNoSuchRelease) {
+		log15.Warn(err.Error())
+		return nil
+	}
+	return err
+}
+
+// selectFormats are the choices of select --format
+var selectFormats = []string{"text", "json", "yaml", "table", "csv"}
+
+// printPackageNames prints the names of --list-packages in the format of "select.format": the JSON array, the YAML sequence,
+// or a name per line of the others
+func printPackageNames(w io.Writer, names []string) error {
+	if names == nil {
+		names = []string{}
+	}
+	switch viper.GetString("select.format") {
+	case "json":
+		if err := json.NewEncoder(w).Encode(names); err != nil {
+			return xerrors.Errorf("Failed to encode packages. err: %w", err)
+		}
+		return nil
+	case "yaml":
+		bs, err := yaml.Marshal(names)
 		if err != nil {
-			return xerrors.Errorf("Failed to get cve by package. err: %w", err)
+			return xerrors.Errorf("Failed to marshal packages. err: %w", err)
 		}
+		_, err = w.Write(bs)
+		return err
+	}
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+	return nil
+}
 
-		for _, d := range dfs {
-			for _, cve := range d.Advisory.Cves {
-				fmt.Printf("%s\n", cve.CveID)
-				for _, pack := range d.AffectedPacks {
-					fmt.Printf("    %v\n", pack)
-				}
-			}
+// maxTitleWidth is the width of the titles in the table, truncated beyond it
+const maxTitleWidth = 60
+
+// printDefinitions prints the definitions in the format of "select.format": JSON as the server responds, YAML of the same keys,
+// the table of one definition per row, CSV of one package and CVE per row, or the advisory, the severity, the CVEs and
+// the fixed versions of each for the humans
+func printDefinitions(w io.Writer, dfs []models.Definition) error {
+	if dfs == nil {
+		dfs = []models.Definition{}
+	}
+
+	switch viper.GetString("select.format") {
+	case "json":
+		if err := json.NewEncoder(w).Encode(dfs); err != nil {
+			return xerrors.Errorf("Failed to encode definitions. err: %w", err)
 		}
-		fmt.Println("------------------")
-		pp.ColoringEnabled = false
-		_, _ = pp.Println(dfs)
+		return nil
+	case "yaml":
+		return printDefinitionsYAML(w, dfs)
+	case "table":
+		return printDefinitionsTable(w, dfs)
+	case "csv":
+		return printDefinitionsCSV(w, dfs)
 	}
 
-	if flagCveID {
-		dfs, err := driver.GetByCveID(family, release, arg, arch)
-		if err != nil {
-			return xerrors.Errorf("Failed to get cve by cveID. err: %w", err)
+	if len(dfs) == 0 {
+		fmt.Fprintln(w, "No OVAL definitions found")
+		return nil
+	}
+	for i, d := range dfs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, d.DefinitionID)
+		fmt.Fprintf(w, "  Title:    %s\n", d.Title)
+		if d.Advisory.AdvisoryID != "" {
+			fmt.Fprintf(w, "  Advisory: %s\n", d.Advisory.AdvisoryID)
+		}
+		if d.Advisory.AdvisoryURL != "" {
+			fmt.Fprintf(w, "  URL:      %s\n", d.Advisory.AdvisoryURL)
+		}
+		if d.Advisory.Severity != "" {
+			fmt.Fprintf(w, "  Severity: %s\n", d.Advisory.Severity)
+		}
+		if d.Severity != "" {
+			fmt.Fprintf(w, "  Severity: %s (definition)\n", d.Severity)
+		}
+		cveIDs := make([]string, 0, len(d.Advisory.Cves))
+		for _, c := range d.Advisory.Cves {
+			cveIDs = append(cveIDs, c.CveID)
 		}
-		for _, d := range dfs {
-			fmt.Printf("%s\n", d.Title)
-			fmt.Printf("%v\n", d.Advisory.Cves)
+		if len(cveIDs) > 0 {
+			fmt.Fprintf(w, "  CVEs:     %s\n", strings.Join(cveIDs, ", "))
+		}
+		if d.Advisory.State != "" {
+			fmt.Fprintf(w, "  State:    %s\n", d.Advisory.State)
+		}
+		if hint := restartHint(d.Advisory); hint != "" {
+			fmt.Fprintf(w, "  Restart:  %s\n", hint)
+		}
+		if len(d.AffectedPacks) > 0 {
+			fmt.Fprintln(w, "  Packages:")
+		}
+		for _, p := range d.AffectedPacks {
+			name := p.Name
+			if p.Arch != "" {
+				name = fmt.Sprintf("%s.%s", name, p.Arch)
+			}
+			if p.ModularityLabel != "" {
+				name = fmt.Sprintf("%s (%s)", name, p.ModularityLabel)
+			}
+			if p.NotFixedYet {
+				fmt.Fprintf(w, "    %s: not fixed yet\n", name)
+				continue
+			}
+			fmt.Fprintf(w, "    %s: fixed in %s\n", name, p.Version)
+		}
+	}
+	return nil
+}
+
+// restartHint returns the hint of applying the patch of SUSE, e.g. "reboot required" or "restart suggested: sshd", or empty if none
+func restartHint(a models.Advisory) string {
+	hints := []string{}
+	if a.RebootRequired {
+		hints = append(hints, "reboot required")
+	}
+	switch a.RestartSuggested {
+	case "":
+	case "true":
+		hints = append(hints, "restart suggested")
+	default:
+		hints = append(hints, "restart suggested: "+a.RestartSuggested)
+	}
+	return strings.Join(hints, ", ")
+}
+
+// printDefinitionsYAML prints the definitions in YAML of the same keys as JSON, converted through JSON for the json tags of the models
+func printDefinitionsYAML(w io.Writer, dfs []models.Definition) error {
+	bs, err := json.Marshal(dfs)
+	if err != nil {
+		return xerrors.Errorf("Failed to encode definitions. err: %w", err)
+	}
+	var v interface{}
+	if err := yaml.Unmarshal(bs, &v); err != nil {
+		return xerrors.Errorf("Failed to decode definitions. err: %w", err)
+	}
+	if err := yaml.NewEncoder(w).Encode(v); err != nil {
+		return xerrors.Errorf("Failed to encode definitions. err: %w", err)
+	}
+	return nil
+}
+
+// printDefinitionsTable prints the definitions one per row, truncating the titles beyond maxTitleWidth
+func printDefinitionsTable(w io.Writer, dfs []models.Definition) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEFINITION\tADVISORY\tSEVERITY\tCVES\tPACKAGES\tTITLE")
+	for _, d := range dfs {
+		cveIDs := make([]string, 0, len(d.Advisory.Cves))
+		for _, c := range d.Advisory.Cves {
+			cveIDs = append(cveIDs, c.CveID)
 		}
-		fmt.Println("------------------")
-		pp.ColoringEnabled = false
-		_, _ = pp.Println(dfs)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", d.DefinitionID, orDash(d.Advisory.AdvisoryID), orDash(d.Advisory.Severity), orDash(strings.Join(cveIDs, ",")), len(d.AffectedPacks), truncate(d.Title, maxTitleWidth))
+	}
+	if err := tw.Flush(); err != nil {
+		return xerrors.Errorf("Failed to print table. err: %w", err)
 	}
+	return nil
+}
 
+// printDefinitionsCSV prints the header and a row per affected package and CVE of the definitions, or per package of the definitions without CVEs,
+// where the fixed version is empty if not fixed yet
+func printDefinitionsCSV(w io.Writer, dfs []models.Definition) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"definition", "advisory", "package", "cve", "fixed version", "severity"})
+	for _, d := range dfs {
+		cveIDs := make([]string, 0, len(d.Advisory.Cves))
+		for _, c := range d.Advisory.Cves {
+			cveIDs = append(cveIDs, c.CveID)
+		}
+		if len(cveIDs) == 0 {
+			cveIDs = append(cveIDs, "")
+		}
+		for _, p := range d.AffectedPacks {
+			name := p.Name
+			if p.Arch != "" {
+				name = fmt.Sprintf("%s.%s", name, p.Arch)
+			}
+			version := p.Version
+			if p.NotFixedYet {
+				version = ""
+			}
+			for _, cveID := range cveIDs {
+				_ = cw.Write([]string{d.DefinitionID, d.Advisory.AdvisoryID, name, cveID, version, d.Advisory.Severity})
+			}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return xerrors.Errorf("Failed to print CSV. err: %w", err)
+	}
 	return nil
 }
+
+// orDash returns s, or "-" if empty, for the empty cells of the table
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// truncate returns s truncated to width runes with "..." if longer
+func truncate(s string, width int) string {
+	rs := []rune(s)
+	if len(rs) <= width {
+		return s
+	}
+	return string(rs[:width-3]) + "..."
+}
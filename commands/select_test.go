@@ -0,0 +1,360 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// selectTestRoots returns the OVAL of redhat 7, debian 8 and SUSE Linux Enterprise Server 15.5 the select tests look up
+func selectTestRoots() []*models.Root {
+	return []*models.Root{
+		{
+			Family:    c.RedHat,
+			OSVersion: "7",
+			Timestamp: time.Date(2017, time.April, 12, 0, 0, 0, 0, time.UTC),
+			Definitions: []models.Definition{
+				{
+					DefinitionID: "oval:com.redhat.rhsa:def:20170933",
+					Class:        models.ClassPatch,
+					Title:        "RHSA-2017:0933: kernel security update (Important)",
+					Advisory: models.Advisory{
+						AdvisoryID:  "RHSA-2017:0933",
+						AdvisoryURL: "https://access.redhat.com/errata/RHSA-2017:0933",
+						Severity:    "Important",
+						Cves:        []models.Cve{{CveID: "CVE-2016-8650"}, {CveID: "CVE-2016-9793"}},
+						AffectedCPEList: []models.Cpe{
+							{Cpe: "cpe:/o:redhat:enterprise_linux:7::server"},
+							{Cpe: "cpe:/o:redhat:enterprise_linux:7::workstation"},
+						},
+					},
+					AffectedPacks: []models.Package{
+						{Name: "kernel", Version: "0:3.10.0-514.16.1.el7"},
+						{Name: "perf", Version: "0:3.10.0-514.16.1.el7"},
+					},
+				},
+				{
+					DefinitionID: "oval:com.redhat.unaffected:def:20171000364",
+					Class:        models.ClassVulnerability,
+					Title:        "CVE-2017-1000364 kernel: heap/stack gap jumping via unbounded stack allocations (Important)",
+					// the severity of the definition apart from the one of the advisory, both of which are output
+					Severity: "Important",
+					Advisory: models.Advisory{
+						Severity: "Moderate",
+						Cves:     []models.Cve{{CveID: "CVE-2017-1000364"}},
+						State:    models.StateAffected,
+					},
+					AffectedPacks: []models.Package{{Name: "kernel", NotFixedYet: true}},
+				},
+			},
+		},
+		{
+			Family:    c.Debian,
+			OSVersion: "8",
+			Timestamp: time.Date(2017, time.June, 19, 0, 0, 0, 0, time.UTC),
+			Definitions: []models.Definition{
+				{
+					DefinitionID: "oval:org.debian:def:20171000364",
+					Class:        models.ClassVulnerability,
+					Title:        "CVE-2017-1000364",
+					Advisory:     models.Advisory{Cves: []models.Cve{{CveID: "CVE-2017-1000364"}}},
+					AffectedPacks: []models.Package{
+						{Name: "linux", Version: "3.16.43-2+deb8u1"},
+					},
+				},
+			},
+		},
+		{
+			Family:    c.SUSEEnterpriseServer,
+			OSVersion: "15.5",
+			Timestamp: time.Date(2023, time.October, 2, 0, 0, 0, 0, time.UTC),
+			Definitions: []models.Definition{
+				{
+					DefinitionID: "oval:org.opensuse.security:def:20233850",
+					Class:        models.ClassPatch,
+					Title:        "Security update for the Linux Kernel (Important)",
+					Advisory: models.Advisory{
+						AdvisoryID:     "SUSE-SU-2023:3850-1",
+						Severity:       "Important",
+						Cves:           []models.Cve{{CveID: "CVE-2023-4622"}},
+						RebootRequired: true,
+					},
+					AffectedPacks: []models.Package{{Name: "kernel-default", Version: "0:5.14.21-150500.55.28.1"}},
+				},
+				{
+					DefinitionID: "oval:org.opensuse.security:def:20233871",
+					Class:        models.ClassPatch,
+					Title:        "Security update for openssh (Moderate)",
+					Advisory: models.Advisory{
+						AdvisoryID:       "SUSE-SU-2023:3871-1",
+						Severity:         "Moderate",
+						Cves:             []models.Cve{{CveID: "CVE-2023-38408"}},
+						RestartSuggested: "sshd",
+					},
+					AffectedPacks: []models.Package{{Name: "openssh", Version: "0:9.3p2-150500.3.3.1"}},
+				},
+			},
+		},
+	}
+}
+
+func TestSelect(t *testing.T) {
+	dbpath := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), selectTestRoots()...)
+
+	tests := []struct {
+		name    string
+		args    []string
+		golden  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "by package",
+			args:   []string{"--by-package", "RedHat", "7", "kernel"},
+			golden: "select-by-package.txt",
+		},
+		{
+			name:   "by package in json",
+			args:   []string{"--by-package", "--format", "json", "redhat", "7", "kernel"},
+			golden: "select-by-package.json",
+		},
+		{
+			name:   "by package in yaml",
+			args:   []string{"--by-package", "--format", "yaml", "redhat", "7", "kernel"},
+			golden: "select-by-package.yaml",
+		},
+		{
+			name:   "by package in table",
+			args:   []string{"--by-package", "--format", "table", "redhat", "7", "kernel"},
+			golden: "select-by-package.table.txt",
+		},
+		{
+			name:   "by package in csv",
+			args:   []string{"--by-package", "--format", "csv", "redhat", "7", "kernel"},
+			golden: "select-by-package.csv",
+		},
+		{
+			name:    "unknown format",
+			args:    []string{"--by-package", "--format", "xml", "redhat", "7", "kernel"},
+			wantErr: true,
+		},
+		{
+			name:   "by cveid",
+			args:   []string{"--by-cveid", "Debian", "8", "CVE-2017-1000364"},
+			golden: "select-by-cveid.txt",
+		},
+		{
+			name: "by cpe prefix",
+			args: []string{"--by-cpe", "redhat", "7", "cpe:/o:redhat:enterprise_linux:7"},
+			want: `oval:com.redhat.rhsa:def:20170933
+  Title:    RHSA-2017:0933: kernel security update (Important)
+  Advisory: RHSA-2017:0933
+  URL:      https://access.redhat.com/errata/RHSA-2017:0933
+  Severity: Important
+  CVEs:     CVE-2016-8650, CVE-2016-9793
+  Packages:
+    kernel: fixed in 0:3.10.0-514.16.1.el7
+    perf: fixed in 0:3.10.0-514.16.1.el7
+`,
+		},
+		{
+			name: "by advisory",
+			args: []string{"--by-advisory", "redhat", "7", "rhsa-2017:0933"},
+			want: `oval:com.redhat.rhsa:def:20170933
+  Title:    RHSA-2017:0933: kernel security update (Important)
+  Advisory: RHSA-2017:0933
+  URL:      https://access.redhat.com/errata/RHSA-2017:0933
+  Severity: Important
+  CVEs:     CVE-2016-8650, CVE-2016-9793
+  Packages:
+    kernel: fixed in 0:3.10.0-514.16.1.el7
+    perf: fixed in 0:3.10.0-514.16.1.el7
+`,
+		},
+		{
+			name: "by advisory not found",
+			args: []string{"--by-advisory", "--format", "json", "debian", "8", "DSA-3981-1"},
+			want: "[]\n",
+		},
+		{
+			name:    "by cpe and cveid",
+			args:    []string{"--by-cpe", "--by-cveid", "redhat", "7", "cpe:/o:redhat:enterprise_linux:7"},
+			wantErr: true,
+		},
+		{
+			name: "not found",
+			args: []string{"--by-package", "redhat", "7", "bash"},
+			want: "No OVAL definitions found\n",
+		},
+		{
+			name: "not found in json",
+			args: []string{"--by-cveid", "--format", "json", "debian", "8", "CVE-2017-0001"},
+			want: "[]\n",
+		},
+		{
+			name: "list packages",
+			args: []string{"--list-packages", "RedHat", "7"},
+			want: "kernel\nperf\n",
+		},
+		{
+			name: "list packages in json",
+			args: []string{"--list-packages", "--format", "json", "debian", "8"},
+			want: "[\"linux\"]\n",
+		},
+		{
+			name: "list packages not found",
+			args: []string{"--list-packages", "--format", "json", "ubuntu", "22.04"},
+			want: "[]\n",
+		},
+		{
+			name:    "list packages with package name",
+			args:    []string{"--list-packages", "redhat", "7", "kernel"},
+			wantErr: true,
+		},
+		{
+			name: "by advisory of the patch requiring a reboot",
+			args: []string{"--by-advisory", "sles", "15.5", "SUSE-SU-2023:3850-1"},
+			want: `oval:org.opensuse.security:def:20233850
+  Title:    Security update for the Linux Kernel (Important)
+  Advisory: SUSE-SU-2023:3850-1
+  Severity: Important
+  CVEs:     CVE-2023-4622
+  Restart:  reboot required
+  Packages:
+    kernel-default: fixed in 0:5.14.21-150500.55.28.1
+`,
+		},
+		{
+			name: "by package of the patch suggesting a restart",
+			args: []string{"--by-package", "sles", "15.5", "openssh"},
+			want: `oval:org.opensuse.security:def:20233871
+  Title:    Security update for openssh (Moderate)
+  Advisory: SUSE-SU-2023:3871-1
+  Severity: Moderate
+  CVEs:     CVE-2023-38408
+  Restart:  restart suggested: sshd
+  Packages:
+    openssh: fixed in 0:9.3p2-150500.3.3.1
+`,
+		},
+		{
+			name:    "fail on empty",
+			args:    []string{"--by-package", "--fail-on-empty", "redhat", "7", "bash"},
+			want:    "No OVAL definitions found\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				for name, value := range map[string]string{"by-package": "false", "by-cveid": "false", "by-cpe": "false", "by-advisory": "false", "list-packages": "false", "format": "text", "fail-on-empty": "false"} {
+					_ = selectCmd.PersistentFlags().Set(name, value)
+				}
+				RootCmd.SetOut(nil)
+			}()
+
+			var out bytes.Buffer
+			RootCmd.SetOut(&out)
+			RootCmd.SetArgs(append([]string{"select", "--dbpath", dbpath}, tt.args...))
+			if err := RootCmd.Execute(); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %t, actual: %v", tt.wantErr, err)
+			}
+
+			want := tt.want
+			if tt.golden != "" {
+				golden := filepath.Join("testdata", tt.golden)
+				if *update {
+					if err := os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+						t.Fatalf("Failed to update golden file. err: %s", err)
+					}
+				}
+				bs, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("Failed to read golden file. err: %s", err)
+				}
+				want = string(bs)
+			}
+			if out.String() != want {
+				t.Errorf("expected: %s\n  actual: %s\n", want, out.String())
+			}
+		})
+	}
+}
+
+// TestSelectStdout runs select with the SQL logs, and checks stdout is only the data while the logs are on stderr
+func TestSelectStdout(t *testing.T) {
+	dbpath := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), selectTestRoots()...)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantSQL bool
+	}{
+		{
+			name: "by package",
+			args: []string{"--by-package", "--format", "json", "redhat", "7", "kernel"},
+		},
+		{
+			name:    "by package with debug-sql",
+			args:    []string{"--by-package", "--format", "json", "--debug-sql", "--log-json", "redhat", "7", "kernel"},
+			wantSQL: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := os.Stdout, os.Stderr
+			defer func() {
+				os.Stdout, os.Stderr = stdout, stderr
+				for name, value := range map[string]string{"by-package": "false", "format": "text"} {
+					_ = selectCmd.PersistentFlags().Set(name, value)
+				}
+				for name, value := range map[string]string{"debug-sql": "false", "log-json": "false"} {
+					_ = RootCmd.PersistentFlags().Set(name, value)
+				}
+				log15.Root().SetHandler(log15.StderrHandler)
+			}()
+
+			var err error
+			if os.Stdout, err = os.Create(filepath.Join(t.TempDir(), "stdout")); err != nil {
+				t.Fatalf("Failed to create stdout. err: %s", err)
+			}
+			defer os.Stdout.Close()
+			if os.Stderr, err = os.Create(filepath.Join(t.TempDir(), "stderr")); err != nil {
+				t.Fatalf("Failed to create stderr. err: %s", err)
+			}
+			defer os.Stderr.Close()
+
+			RootCmd.SetArgs(append([]string{"select", "--dbpath", dbpath}, tt.args...))
+			if err := RootCmd.Execute(); err != nil {
+				t.Fatalf("Failed to select. err: %s", err)
+			}
+
+			out, err := os.ReadFile(os.Stdout.Name())
+			if err != nil {
+				t.Fatalf("Failed to read stdout. err: %s", err)
+			}
+			if !json.Valid(out) {
+				t.Errorf("expected: JSON in stdout, actual: %s", out)
+			}
+			logs, err := os.ReadFile(os.Stderr.Name())
+			if err != nil {
+				t.Fatalf("Failed to read stderr. err: %s", err)
+			}
+			if got := bytes.Contains(logs, []byte("SELECT")); got != tt.wantSQL {
+				t.Errorf("expected SQL in stderr: %t, actual: %s", tt.wantSQL, logs)
+			}
+		})
+	}
+}
@@ -1,14 +1,18 @@
 package commands
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/inconshreveable/log15"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"golang.org/x/xerrors"
 
 	"github.com/vulsio/goval-dictionary/db"
-	"github.com/vulsio/goval-dictionary/log"
-	"github.com/vulsio/goval-dictionary/models"
 	"github.com/vulsio/goval-dictionary/server"
 )
 
@@ -16,44 +20,132 @@ import (
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start OVAL dictionary HTTP server",
-	Long:  `Start OVAL dictionary HTTP server`,
-	RunE:  executeServer,
+	Long: `Start OVAL dictionary HTTP server.
+With --refresh-interval, refresh the OVAL of the families in the config file as fetch all does at once and every interval while serving,
+reporting the result of the last refresh by /health.`,
+	RunE: executeServer,
+	Example: `$ goval-dictionary server
+$ goval-dictionary server --config /etc/goval-dictionary/config.toml --refresh-interval 24h`,
+
+	PersistentPreRunE: setLogger,
 }
 
 func init() {
 	RootCmd.AddCommand(serverCmd)
 
-	serverCmd.PersistentFlags().String("bind", "127.0.0.1", "HTTP server bind to IP address")
-	_ = viper.BindPFlag("bind", serverCmd.PersistentFlags().Lookup("bind"))
+	serverCmd.PersistentFlags().String("bind", "127.0.0.1", "HTTP server bind to IP address, e.g. :: or [::1] of IPv6")
+	bindFlag("bind", serverCmd.PersistentFlags().Lookup("bind"))
 
 	serverCmd.PersistentFlags().String("port", "1324", "HTTP server port number")
-	_ = viper.BindPFlag("port", serverCmd.PersistentFlags().Lookup("port"))
+	bindFlag("port", serverCmd.PersistentFlags().Lookup("port"))
+
+	serverCmd.PersistentFlags().Duration("refresh-interval", 0, "refresh the OVAL of the families in the config file every interval while serving, e.g. 24h, no refresh if 0")
+	bindFlag("refresh-interval", serverCmd.PersistentFlags().Lookup("refresh-interval"))
+
+	serverCmd.PersistentFlags().Duration("stale-age", 7*24*time.Hour, "The age of the OVAL reported as stale by /health, which responds 503 with ?strict=true, never stale if 0")
+	bindFlag("stale-age", serverCmd.PersistentFlags().Lookup("stale-age"))
+
+	serverCmd.PersistentFlags().String("cors-allow-origins", "", "comma-separated origins allowed to query the server from the browser, e.g. https://ui.example.com, any if \"*\" (default: none)")
+	bindFlag("cors-allow-origins", serverCmd.PersistentFlags().Lookup("cors-allow-origins"))
+
+	serverCmd.PersistentFlags().String("tls-cert", "", "/path/to/cert.pem to serve HTTPS, with --tls-key")
+	bindFlag("tls-cert", serverCmd.PersistentFlags().Lookup("tls-cert"))
+
+	serverCmd.PersistentFlags().String("tls-key", "", "/path/to/key.pem of --tls-cert")
+	bindFlag("tls-key", serverCmd.PersistentFlags().Lookup("tls-key"))
+
+	serverCmd.PersistentFlags().String("tls-client-ca", "", "/path/to/ca.pem to require the client certificates signed by, i.e. mutual TLS")
+	bindFlag("tls-client-ca", serverCmd.PersistentFlags().Lookup("tls-client-ca"))
+
+	serverCmd.PersistentFlags().String("listen", "", "comma-separated unix:///path/to/socket and tcp://host:port to listen on instead of --bind and --port, e.g. unix:///var/run/goval-dictionary.sock,tcp://[::1]:1324")
+	bindFlag("listen", serverCmd.PersistentFlags().Lookup("listen"))
+
+	serverCmd.PersistentFlags().String("socket-mode", "0660", "The permissions of the socket of --listen in octal")
+	bindFlag("socket-mode", serverCmd.PersistentFlags().Lookup("socket-mode"))
+
+	serverCmd.PersistentFlags().Duration("shutdown-timeout", 30*time.Second, "how long to wait for the requests in progress to finish on SIGINT/SIGTERM before closing them, at once if 0")
+	bindFlag("shutdown-timeout", serverCmd.PersistentFlags().Lookup("shutdown-timeout"))
+
+	serverCmd.PersistentFlags().Duration("query-timeout", 30*time.Second, "how long a lookup of DB of a request may take before it is abandoned, responding 503, no timeout if 0")
+	bindFlag("query-timeout", serverCmd.PersistentFlags().Lookup("query-timeout"))
+
+	serverCmd.PersistentFlags().Bool("access-log", true, "log a line per request with the method, the path, the status, the bytes and the latency, in the format of the other logs")
+	bindFlag("access-log", serverCmd.PersistentFlags().Lookup("access-log"))
+
+	serverCmd.PersistentFlags().String("profile", "", "host:port to serve pprof and expvar under /debug apart from the lookups, e.g. 127.0.0.1:6060 (default: off)")
+	bindFlag("profile", serverCmd.PersistentFlags().Lookup("profile"))
+
+	serverCmd.PersistentFlags().Int("max-limit", 0, "The maximum number of the definitions responded by /packs and /cves at once, paged by ?offset= beyond it, no maximum if 0")
+	bindFlag("max-limit", serverCmd.PersistentFlags().Lookup("max-limit"))
+
+	serverCmd.PersistentFlags().Bool("metrics", false, "serve the metrics of the requests, the queries of DB and the stored OVAL on /metrics for Prometheus")
+	bindFlag("metrics", serverCmd.PersistentFlags().Lookup("metrics"))
+
+	serverCmd.PersistentFlags().Float64("rate-limit", 0, "The maximum number of requests per second of each client IP, responding 429 over it, no limit if 0")
+	bindFlag("rate-limit", serverCmd.PersistentFlags().Lookup("rate-limit"))
+
+	serverCmd.PersistentFlags().Int("rate-burst", 0, "The number of requests of each client IP allowed at once over --rate-limit (default: --rate-limit rounded up)")
+	bindFlag("rate-burst", serverCmd.PersistentFlags().Lookup("rate-burst"))
+
+	serverCmd.PersistentFlags().Bool("trust-proxy-headers", false, "tell the client IP from X-Forwarded-For set by the proxies in the loopback and the private networks, e.g. for --rate-limit behind a load balancer")
+	bindFlag("trust-proxy-headers", serverCmd.PersistentFlags().Lookup("trust-proxy-headers"))
+
+	serverCmd.PersistentFlags().String("auth-token", "", "The bearer token required in Authorization of the requests but /health, named default in the access log (default: no authentication)")
+	bindFlag("auth-token", serverCmd.PersistentFlags().Lookup("auth-token"))
+
+	serverCmd.PersistentFlags().String("auth-tokens-file", "", "/path/to/file of the lines of name:token of the bearer tokens, whose name is logged in the access log instead of the token")
+	bindFlag("auth-tokens-file", serverCmd.PersistentFlags().Lookup("auth-tokens-file"))
+
+	serverCmd.PersistentFlags().Int("pack-cache-size", 10000, "The number of the lookups of /packs/:family/:release/:pack cached, the least recently used dropped over it, dropped all once the OVAL is refreshed, no cache if 0")
+	bindFlag("pack-cache-size", serverCmd.PersistentFlags().Lookup("pack-cache-size"))
+
+	serverCmd.PersistentFlags().Duration("pack-cache-ttl", time.Hour, "how long a lookup of /packs/:family/:release/:pack is cached by --pack-cache-size")
+	bindFlag("pack-cache-ttl", serverCmd.PersistentFlags().Lookup("pack-cache-ttl"))
+
+	serverCmd.PersistentFlags().Duration("reload-interval", 0, "check the sqlite3 file of --dbpath every interval to reopen it once replaced, e.g. renamed over by the DB built apart, no check if 0 (SIGHUP reopens it anyway)")
+	bindFlag("reload-interval", serverCmd.PersistentFlags().Lookup("reload-interval"))
 }
 
-func executeServer(_ *cobra.Command, _ []string) (err error) {
-	if err := log.SetLogger(viper.GetBool("log-to-file"), viper.GetString("log-dir"), viper.GetBool("debug"), viper.GetBool("log-json")); err != nil {
-		return xerrors.Errorf("Failed to SetLogger. err: %w", err)
-	}
+func executeServer(cmd *cobra.Command, _ []string) (err error) {
+	interval := viper.GetDuration("refresh-interval")
 
-	driver, err := db.NewDB(viper.GetString("dbtype"), viper.GetString("dbpath"), viper.GetBool("debug-sql"), db.Option{})
+	// refreshing creates the missing DB to serve until the first refresh finishes
+	path, err := resolveDBPath(interval <= 0)
 	if err != nil {
-		if xerrors.Is(err, db.ErrDBLocked) {
-			return xerrors.Errorf("Failed to open DB. Close DB connection before fetching. err: %w", err)
-		}
-		return xerrors.Errorf("Failed to open DB. err: %w", err)
+		return err
 	}
-
-	fetchMeta, err := driver.GetFetchMeta()
+	option := db.Option{ReadOnly: interval <= 0, QueryTimeout: viper.GetDuration("query-timeout")}
+	driver, err := openServedDB(path, option)
 	if err != nil {
-		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+		return err
+	}
+	if viper.GetString("dbtype") == "sqlite3" {
+		driver = db.NewReloadDB(driver, func() (db.DB, error) { return openServedDB(path, option) })
 	}
-	if fetchMeta.OutDated() {
-		return xerrors.Errorf("Failed to start server. err: SchemaVersion is old. SchemaVersion: %+v", map[string]uint{"latest": models.LatestSchemaVersion, "DB": fetchMeta.SchemaVersion})
+	defer driver.CloseDB()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	// the server refreshing the file by itself modifies it, so that it is reopened only on SIGHUP
+	w := &dbWatcher{driver: driver, path: path}
+	if interval <= 0 {
+		w.interval = viper.GetDuration("reload-interval")
+	}
+	go w.run(ctx, hup)
+
+	var lastRefresh func() *server.Refresh
+	if interval > 0 {
+		r := &refresher{interval: interval}
+		go r.run(ctx)
+		lastRefresh = r.lastRefresh
 	}
 
 	log15.Info("Starting HTTP Server...")
-	if err = server.Start(viper.GetBool("log-to-file"), viper.GetString("log-dir"), driver); err != nil {
-		return xerrors.Errorf("Failed to start server. err: %w", err)
+	if err = server.Start(cmd.Context(), driver, lastRefresh); err != nil {
+		return xerrors.Errorf("Failed to serve. err: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// statusCmd is Subcommand for the freshness of the stored OVAL
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the freshness of the OVAL in DB",
+	Long: `Show the timestamp, the age and the numbers of the definitions and the packages of the OVAL of each family and version in DB.
+Exit with the error if any of them is older than --warn-age, e.g. for the health check of cron.`,
+	Args:    cobra.NoArgs,
+	RunE:    executeStatus,
+	Example: `$ goval-dictionary status --warn-age 72h`,
+
+	PersistentPreRunE: setLogger,
+}
+
+func init() {
+	RootCmd.AddCommand(statusCmd)
+
+	statusCmd.PersistentFlags().Duration("warn-age", 7*24*time.Hour, "The age of the OVAL to warn as stale and exit with the error")
+	bindFlag("warn-age", statusCmd.PersistentFlags().Lookup("warn-age"))
+
+	// bound to "status.format", as "format" is bound to the one of fetch --list
+	statusCmd.PersistentFlags().String("format", "text", "output format of the status (choices: text, json, capabilities of the scanners)")
+	bindFlag("status.format", statusCmd.PersistentFlags().Lookup("format"))
+}
+
+// dbStatus is the status of DB printed by the status subcommand
+type dbStatus struct {
+	LastFetchedAt time.Time    `json:"lastFetchedAt"`
+	WarnAge       string       `json:"warnAge"`
+	Roots         []rootStatus `json:"roots"`
+}
+
+// rootStatus is the status of the OVAL of a family and a version, stale if older than --warn-age
+type rootStatus struct {
+	models.RootStat
+	Age   string `json:"age"`
+	Stale bool   `json:"stale"`
+}
+
+func executeStatus(cmd *cobra.Command, _ []string) error {
+	format := viper.GetString("status.format")
+	switch format {
+	case "text", "json", "capabilities":
+	default:
+		return xerrors.Errorf("Unknown format: %s. Available format: text, json, capabilities", format)
+	}
+
+	path, err := resolveDBPath(true)
+	if err != nil {
+		return err
+	}
+	driver, err := openDB(path, db.Option{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer driver.CloseDB()
+
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+	}
+	if fetchMeta.OutDated() {
+		return xerrors.Errorf("Failed to show status. err: SchemaVersion is old. SchemaVersion: %+v", map[string]uint{"latest": models.LatestSchemaVersion, "DB": fetchMeta.SchemaVersion})
+	}
+	stats, err := driver.GetRootStats()
+	if err != nil {
+		return xerrors.Errorf("Failed to get the stats of OVAL. err: %w", err)
+	}
+
+	// the capabilities are what the server responds on /capabilities, e.g. for the scanner to read the DB without the server,
+	// which neither warns the stale OVAL nor the empty DB
+	if format == "capabilities" {
+		if err := json.NewEncoder(cmd.OutOrStdout()).Encode(db.NewCapabilities(stats)); err != nil {
+			return xerrors.Errorf("Failed to encode capabilities. err: %w", err)
+		}
+		return nil
+	}
+
+	warnAge := viper.GetDuration("warn-age")
+	status := newDBStatus(fetchMeta.LastFetchedAt, stats, warnAge, time.Now())
+	if err := printStatus(cmd.OutOrStdout(), format, status); err != nil {
+		return xerrors.Errorf("Failed to print status. err: %w", err)
+	}
+
+	if len(status.Roots) == 0 {
+		return xerrors.New("Failed to find OVAL in DB. err: no family fetched")
+	}
+	stale := []string{}
+	for _, r := range status.Roots {
+		if r.Stale {
+			stale = append(stale, fmt.Sprintf("%s %s", r.Family, r.OSVersion))
+		}
+	}
+	if len(stale) > 0 {
+		return xerrors.Errorf("Failed to find the fresh OVAL. err: %d of %d older than %s: [%s]", len(stale), len(status.Roots), warnAge, strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+// newDBStatus returns the status of stats at now, where the OVAL older than warnAge is stale
+func newDBStatus(lastFetchedAt time.Time, stats []models.RootStat, warnAge time.Duration, now time.Time) dbStatus {
+	status := dbStatus{LastFetchedAt: lastFetchedAt, WarnAge: warnAge.String(), Roots: []rootStatus{}}
+	for _, s := range stats {
+		age := now.Sub(s.Timestamp)
+		status.Roots = append(status.Roots, rootStatus{RootStat: s, Age: formatAge(age), Stale: age > warnAge})
+	}
+	return status
+}
+
+// formatAge formats the age in days, or in hours within a day, e.g. 3d and 5h
+func formatAge(age time.Duration) string {
+	if age < 24*time.Hour {
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(age.Hours()/24))
+}
+
+// printStatus prints status in JSON, or in the table of the families and the versions with WARN on the stale ones
+func printStatus(w io.Writer, format string, status dbStatus) error {
+	if format == "json" {
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			return xerrors.Errorf("Failed to encode status. err: %w", err)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(w, "Last fetched at: %s\n", status.LastFetchedAt.UTC().Format(time.RFC3339))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FAMILY\tVERSION\tTIMESTAMP\tAGE\tDEFINITIONS\tPACKAGES\tSTATUS")
+	for _, r := range status.Roots {
+		mark := "OK"
+		if r.Stale {
+			mark = "WARN"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n", r.Family, r.OSVersion, r.Timestamp.UTC().Format(time.RFC3339), r.Age, r.Definitions, r.Packages, mark)
+	}
+	return tw.Flush()
+}
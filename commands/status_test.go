@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// statusTestRoots returns the fresh OVAL of debian 12 and the stale one of redhat 7
+func statusTestRoots() []*models.Root {
+	return []*models.Root{
+		{
+			Family:    c.Debian,
+			OSVersion: "12",
+			Timestamp: time.Now().Add(-5 * time.Hour),
+			Definitions: []models.Definition{{
+				DefinitionID:  "oval:org.debian:def:20231234",
+				Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2023-1234"}}},
+				AffectedPacks: []models.Package{{Name: "openssl", Version: "3.0.9-1"}, {Name: "libssl3", Version: "3.0.9-1"}},
+			}},
+		},
+		{
+			Family:    c.RedHat,
+			OSVersion: "7",
+			Timestamp: time.Now().Add(-30 * 24 * time.Hour),
+			Definitions: []models.Definition{{
+				DefinitionID:  "oval:com.redhat.rhsa:def:20170933",
+				Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2016-8650"}}},
+				AffectedPacks: []models.Package{{Name: "kernel", Version: "0:3.10.0-514.16.1.el7"}},
+			}},
+		},
+	}
+}
+
+func TestStatus(t *testing.T) {
+	dbpath := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), statusTestRoots()...)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantRows []string
+		wantErr  string
+	}{
+		{
+			name:     "stale",
+			wantRows: []string{"debian 12 5h 1 2 OK", "redhat 7 30d 1 1 WARN"},
+			wantErr:  "1 of 2 older than 168h0m0s: [redhat 7]",
+		},
+		{
+			name:     "fresh within warn-age",
+			args:     []string{"--warn-age", "720h1m"},
+			wantRows: []string{"debian 12 5h 1 2 OK", "redhat 7 30d 1 1 OK"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				_ = statusCmd.PersistentFlags().Set("warn-age", "168h")
+				RootCmd.SetOut(nil)
+			}()
+
+			var out bytes.Buffer
+			RootCmd.SetOut(&out)
+			RootCmd.SetArgs(append([]string{"status", "--dbpath", dbpath}, tt.args...))
+			err := RootCmd.Execute()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected: %s, actual: %v", tt.wantErr, err)
+			}
+
+			// without the timestamps, which are relative to now
+			rows := []string{}
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[2:] {
+				fields := strings.Fields(line)
+				rows = append(rows, strings.Join(append(fields[:2:2], fields[3:]...), " "))
+			}
+			if strings.Join(rows, "\n") != strings.Join(tt.wantRows, "\n") {
+				t.Errorf("expected: %q, actual: %q", tt.wantRows, rows)
+			}
+		})
+	}
+}
+
+func TestStatusJSON(t *testing.T) {
+	dbpath := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), statusTestRoots()...)
+	defer func() {
+		_ = statusCmd.PersistentFlags().Set("format", "text")
+		RootCmd.SetOut(nil)
+	}()
+
+	var out bytes.Buffer
+	RootCmd.SetOut(&out)
+	RootCmd.SetArgs([]string{"status", "--dbpath", dbpath, "--format", "json"})
+	if err := RootCmd.Execute(); err == nil {
+		t.Errorf("expected the error of the stale OVAL")
+	}
+
+	var status dbStatus
+	if err := json.Unmarshal(out.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to unmarshal %s. err: %s", out.Bytes(), err)
+	}
+	if status.WarnAge != "168h0m0s" || len(status.Roots) != 2 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	for i, want := range []struct {
+		family string
+		stale  bool
+	}{{family: c.Debian, stale: false}, {family: c.RedHat, stale: true}} {
+		if r := status.Roots[i]; r.Family != want.family || r.Stale != want.stale {
+			t.Errorf("expected: %s stale: %t, actual: %+v", want.family, want.stale, r)
+		}
+	}
+}
+
+func TestStatusCapabilities(t *testing.T) {
+	dbpath := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), statusTestRoots()...)
+	defer func() {
+		_ = statusCmd.PersistentFlags().Set("format", "text")
+		RootCmd.SetOut(nil)
+	}()
+
+	var out bytes.Buffer
+	RootCmd.SetOut(&out)
+	RootCmd.SetArgs([]string{"status", "--dbpath", dbpath, "--format", "capabilities"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error even of the stale OVAL: %s", err)
+	}
+
+	var capabilities db.Capabilities
+	if err := json.Unmarshal(out.Bytes(), &capabilities); err != nil {
+		t.Fatalf("Failed to unmarshal %s. err: %s", out.Bytes(), err)
+	}
+	if capabilities.ContractVersion != db.CapabilitiesVersion || capabilities.SchemaVersion != models.LatestSchemaVersion || len(capabilities.Families) == 0 {
+		t.Errorf("unexpected capabilities: %+v", capabilities)
+	}
+	if len(capabilities.Roots) != 2 {
+		t.Fatalf("expected: 2 roots, actual: %+v", capabilities.Roots)
+	}
+	for i, want := range []struct {
+		family, release string
+		packages        int
+	}{{family: c.Debian, release: "12", packages: 2}, {family: c.RedHat, release: "7", packages: 1}} {
+		if r := capabilities.Roots[i]; r.Family != want.family || r.Release != want.release || r.Definitions != 1 || r.Packages != want.packages {
+			t.Errorf("expected: %s %s of 1 definition and %d packages, actual: %+v", want.family, want.release, want.packages, r)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/goval"
+	"github.com/vulsio/goval-dictionary/metrics"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// severityOrder is the order of the severities of the families in the summary, from the most severe, followed by the others alphabetically
+var severityOrder = []string{"critical", "high", "important", "moderate", "medium", "low", "negligible", "none", goval.SeverityUnknown}
+
+// maxPrintedAdvisories is the number of the new advisories of a severity printed in the summary, all of which are written to --summary-file
+const maxPrintedAdvisories = 10
+
+// sortedSeverities returns the severities of m in severityOrder
+func sortedSeverities(m map[string][]string) []string {
+	rank := func(s string) int {
+		if i := slices.Index(severityOrder, strings.ToLower(s)); i >= 0 {
+			return i
+		}
+		return len(severityOrder)
+	}
+	ss := make([]string, 0, len(m))
+	for s := range m {
+		ss = append(ss, s)
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		if ri, rj := rank(ss[i]), rank(ss[j]); ri != rj {
+			return ri < rj
+		}
+		return ss[i] < ss[j]
+	})
+	return ss
+}
+
+// printNewAdvisories prints the numbers and the IDs of the new advisories of each family by their severity following the summary table,
+// without a blank line not to break the scripts reading it line by line, and nothing if none is new
+func printNewAdvisories(w io.Writer, summaries []familySummary, withFamily bool) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := false
+	for _, s := range summaries {
+		m := s.summary.NewAdvisories()
+		for _, severity := range sortedSeverities(m) {
+			if !header {
+				if withFamily {
+					fmt.Fprint(tw, "FAMILY\t")
+				}
+				fmt.Fprintln(tw, "SEVERITY\tNEW\tADVISORIES")
+				header = true
+			}
+			ids := m[severity]
+			printed := strings.Join(ids, ", ")
+			if len(ids) > maxPrintedAdvisories {
+				printed = fmt.Sprintf("%s, ... and %d more", strings.Join(ids[:maxPrintedAdvisories], ", "), len(ids)-maxPrintedAdvisories)
+			}
+			if withFamily {
+				fmt.Fprintf(tw, "%s\t", s.family)
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", severity, len(ids), printed)
+		}
+	}
+	_ = tw.Flush()
+}
+
+// printSourceChanges prints the versions of the OVAL replaced by the one of another source file by --allow-source-change,
+// with the numbers of the definitions of both, e.g. to notice the OVAL loaded from the wrong file, nothing if none
+func printSourceChanges(w io.Writer, summaries []familySummary, withFamily bool) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := false
+	for _, s := range summaries {
+		for _, v := range s.summary.Versions {
+			sc := v.Change.SourceChange
+			if sc == nil {
+				continue
+			}
+			if !header {
+				if withFamily {
+					fmt.Fprint(tw, "FAMILY\t")
+				}
+				fmt.Fprintln(tw, "VERSION\tSOURCE CHANGED FROM\tTO")
+				header = true
+			}
+			if withFamily {
+				fmt.Fprintf(tw, "%s\t", s.family)
+			}
+			fmt.Fprintf(tw, "%s\t%s (%d definitions)\t%s (%d definitions)\n", v.Version, sc.From, sc.FromDefinitions, sc.To, sc.ToDefinitions)
+		}
+	}
+	_ = tw.Flush()
+}
+
+// printClockSkews prints the timestamps of the fetched files more than --max-clock-skew in the future and the actions taken on them,
+// e.g. to notice the mirror of the skewed clock, nothing if none
+func printClockSkews(w io.Writer, summaries []familySummary, withFamily bool) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := false
+	for _, s := range summaries {
+		for _, skew := range s.summary.ClockSkews {
+			if !header {
+				if withFamily {
+					fmt.Fprint(tw, "FAMILY\t")
+				}
+				fmt.Fprintln(tw, "URL\tTIMESTAMP IN FUTURE\tACTION")
+				header = true
+			}
+			if withFamily {
+				fmt.Fprintf(tw, "%s\t", s.family)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", skew.URL, skew.Timestamp.UTC().Format(time.RFC3339), skew.Action)
+		}
+	}
+	_ = tw.Flush()
+}
+
+// summaryFile is the JSON of the summary of a run written to --summary-file
+type summaryFile struct {
+	Families []summaryFileFamily `json:"families"`
+}
+
+type summaryFileFamily struct {
+	Family        string               `json:"family"`
+	Versions      []summaryFileVersion `json:"versions"`
+	NewAdvisories map[string][]string  `json:"newAdvisories"` // the IDs of the advisories of the new definitions of all the versions by their severity
+	// the stat of the conversion of all the converted files, and of those of each version, or of each file of all the versions, e.g. of Oracle
+	Conversion  *models.ConvertStat           `json:"conversion,omitempty"`
+	Conversions map[string]models.ConvertStat `json:"conversions,omitempty"`
+	// ClockSkews is of the timestamps of the fetched files more than --max-clock-skew in the future
+	ClockSkews []summaryFileClockSkew `json:"clockSkews,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type summaryFileClockSkew struct {
+	URL       string    `json:"url"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"` // e.g. clamped to now
+}
+
+type summaryFileVersion struct {
+	Version       string              `json:"version"`
+	Status        string              `json:"status"`
+	Definitions   int                 `json:"definitions"`
+	Packages      int                 `json:"packages"`
+	CVEs          int                 `json:"cves"`
+	New           int                 `json:"new"`
+	Updated       int                 `json:"updated"`
+	Unchanged     int                 `json:"unchanged"`
+	Removed       int                 `json:"removed"`
+	NewAdvisories map[string][]string `json:"newAdvisories,omitempty"`
+	// SourceChange is of the OVAL replaced by the one of another source file by --allow-source-change
+	SourceChange *models.SourceChange `json:"sourceChange,omitempty"`
+	Error        string               `json:"error,omitempty"`
+}
+
+// writeSummaryFile writes the summary of the families to --summary-file in JSON, nothing without it
+func writeSummaryFile(summaries []familySummary) error {
+	path := viper.GetString("summary-file")
+	if path == "" {
+		return nil
+	}
+	f := summaryFile{Families: make([]summaryFileFamily, 0, len(summaries))}
+	for _, s := range summaries {
+		ff := summaryFileFamily{Family: s.family, Versions: make([]summaryFileVersion, 0, len(s.summary.Versions)), NewAdvisories: s.summary.NewAdvisories()}
+		if len(s.summary.Conversions) > 0 {
+			stat := s.summary.ConvertStat()
+			ff.Conversion, ff.Conversions = &stat, s.summary.Conversions
+		}
+		for _, skew := range s.summary.ClockSkews {
+			ff.ClockSkews = append(ff.ClockSkews, summaryFileClockSkew{URL: skew.URL, Timestamp: skew.Timestamp, Action: skew.Action})
+		}
+		if s.err != nil {
+			ff.Error = s.err.Error()
+		}
+		for _, v := range s.summary.Versions {
+			fv := summaryFileVersion{
+				Version:       v.Version,
+				Status:        v.Status,
+				Definitions:   v.Definitions,
+				Packages:      v.Packages,
+				CVEs:          v.CVEs,
+				New:           v.Change.New,
+				Updated:       v.Change.Updated,
+				Unchanged:     v.Change.Unchanged,
+				Removed:       v.Change.Removed,
+				NewAdvisories: v.NewAdvisories,
+				SourceChange:  v.Change.SourceChange,
+			}
+			if v.Err != nil {
+				fv.Error = v.Err.Error()
+			}
+			ff.Versions = append(ff.Versions, fv)
+		}
+		f.Families = append(f.Families, ff)
+	}
+
+	bs, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal summary. err: %w", err)
+	}
+	if err := os.WriteFile(path, append(bs, '\n'), 0644); err != nil {
+		return xerrors.Errorf("Failed to write summary file. path: %s, err: %w", path, err)
+	}
+	return nil
+}
+
+// pushgatewayJob is the job of the metrics of the summary pushed to --pushgateway-url
+const pushgatewayJob = "goval-dictionary-fetch"
+
+// newSummaryMetrics returns the registry of the metrics of the summary of the families, where the family failed before its versions
+// has the release of "-" as in the summary table
+func newSummaryMetrics(summaries []familySummary, finishedAt time.Time) *metrics.Registry {
+	r := metrics.NewRegistry()
+	definitions := r.NewGauge("goval_dictionary_fetch_definitions", "The definitions fetched by the family and the release.", "family", "release")
+	changes := r.NewGauge("goval_dictionary_fetch_changes", "The definitions new, updated, unchanged and removed by the fetch by the family and the release.", "family", "release", "change")
+	failed := r.NewGauge("goval_dictionary_fetch_failed", "1 if the fetch of the family and the release failed, 0 otherwise.", "family", "release")
+	r.NewGauge("goval_dictionary_fetch_last_run_timestamp_seconds", "The time the run of the fetch finished in the Unix time.").Set(float64(finishedAt.Unix()))
+	for _, s := range summaries {
+		for _, v := range s.summary.Versions {
+			definitions.Set(float64(v.Definitions), s.family, v.Version)
+			for change, n := range map[string]int{"new": v.Change.New, "updated": v.Change.Updated, "unchanged": v.Change.Unchanged, "removed": v.Change.Removed} {
+				changes.Set(float64(n), s.family, v.Version, change)
+			}
+			if v.Err != nil {
+				failed.Set(1, s.family, v.Version)
+			} else {
+				failed.Set(0, s.family, v.Version)
+			}
+		}
+		if s.err != nil {
+			failed.Set(1, s.family, "-")
+		}
+	}
+	return r
+}
+
+// pushSummary pushes the metrics of the summary of the families to --pushgateway-url, nothing without it. The failure to push is logged
+// without failing the fetch, whose data is stored, and alerted on by the stale goval_dictionary_fetch_last_run_timestamp_seconds.
+func pushSummary(summaries []familySummary) {
+	u := viper.GetString("pushgateway-url")
+	if u == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := newSummaryMetrics(summaries, time.Now()).Push(ctx, u, pushgatewayJob); err != nil {
+		log15.Error("Failed to push the summary to Pushgateway", "URL", u, "err", err)
+		return
+	}
+	log15.Info("Pushed the summary to Pushgateway", "URL", u, "Job", pushgatewayJob)
+}
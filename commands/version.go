@@ -1,22 +1,75 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
 
 	"github.com/vulsio/goval-dictionary/config"
 )
 
 func init() {
 	RootCmd.AddCommand(versionCmd)
+
+	// bound to "version.format", as "format" is bound to the one of fetch --list
+	versionCmd.PersistentFlags().String("format", "text", "output format of the version (choices: text, json)")
+	bindFlag("version.format", versionCmd.PersistentFlags().Lookup("format"))
+
+	// --version on the root prints the same as the version subcommand in text
+	RootCmd.Version = config.DisplayVersion()
+	cobra.AddTemplateFunc("versionText", func() string {
+		var b strings.Builder
+		_ = printVersion(&b, "text")
+		return b.String()
+	})
+	RootCmd.SetVersionTemplate("{{versionText}}")
 }
 
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Show version",
-	Long:  `Show version`,
-	Run: func(_ *cobra.Command, _ []string) {
-		fmt.Printf("goval-dictionary %s %s\n", config.Version, config.Revision)
+	Long:  `Show version, git commit, build date and the supported families of this binary`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return printVersion(cmd.OutOrStdout(), viper.GetString("version.format"))
 	},
 }
+
+// buildInfo is the build metadata injected by -ldflags, see GNUmakefile
+type buildInfo struct {
+	Version   string   `json:"version"`
+	Revision  string   `json:"revision"`
+	BuildDate string   `json:"build_date"`
+	Families  []string `json:"families"`
+}
+
+// supportedFamilies returns the families of the fetch subcommands compiled into this binary
+func supportedFamilies() []string {
+	families := append([]string{}, fetchAllFamilies...)
+	sort.Strings(families)
+	return families
+}
+
+// printVersion prints the build metadata, in the first line of "goval-dictionary <version> <revision>" for text, or in JSON
+func printVersion(w io.Writer, format string) error {
+	info := buildInfo{Version: config.DisplayVersion(), Revision: config.Revision, BuildDate: config.BuildDate, Families: supportedFamilies()}
+	switch format {
+	case "text":
+		fmt.Fprintf(w, "goval-dictionary %s %s\n", info.Version, info.Revision)
+		fmt.Fprintf(w, "Build date: %s\n", info.BuildDate)
+		fmt.Fprintf(w, "Families:   %s\n", strings.Join(info.Families, ", "))
+	case "json":
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			return xerrors.Errorf("Failed to encode version. err: %w", err)
+		}
+	default:
+		return xerrors.Errorf("Unknown format: %s. Available format: text, json", format)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	c "github.com/vulsio/goval-dictionary/config"
+)
+
+func TestPrintVersion(t *testing.T) {
+	version, revision, buildDate := c.Version, c.Revision, c.BuildDate
+	c.Version, c.Revision, c.BuildDate = "v1.2.3", "abc1234", "2023-07-06T00:00:00Z"
+	t.Cleanup(func() { c.Version, c.Revision, c.BuildDate = version, revision, buildDate })
+
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			format: "text",
+			want: `goval-dictionary v1.2.3 abc1234
+Build date: 2023-07-06T00:00:00Z
+Families:   alpine, amazon, debian, fedora, oracle, redhat, suse, ubuntu
+`,
+		},
+		{
+			format: "json",
+			want:   `{"version":"v1.2.3","revision":"abc1234","build_date":"2023-07-06T00:00:00Z","families":["alpine","amazon","debian","fedora","oracle","redhat","suse","ubuntu"]}` + "\n",
+		},
+		{
+			format:  "yaml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := printVersion(&out, tt.format); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %t, actual: %v", tt.wantErr, err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("expected: %q, actual: %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestRootVersionFlag(t *testing.T) {
+	version, revision, buildDate := c.Version, c.Revision, c.BuildDate
+	c.Version, c.Revision, c.BuildDate = "v1.2.3", "abc1234", "2023-07-06T00:00:00Z"
+	t.Cleanup(func() { c.Version, c.Revision, c.BuildDate = version, revision, buildDate })
+	defer func() {
+		RootCmd.SetOut(nil)
+		_ = RootCmd.Flags().Set("version", "false")
+	}()
+
+	var out, want bytes.Buffer
+	RootCmd.SetOut(&out)
+	RootCmd.SetArgs([]string{"--version"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := printVersion(&want, "text"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != want.String() {
+		t.Errorf("expected: %q, actual: %q", want.String(), out.String())
+	}
+}
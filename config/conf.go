@@ -0,0 +1,181 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+// Conf is the configuration shared by the subcommands, resolved from the flags, the environment variables GOVAL_DICTIONARY_<KEY>,
+// the config file and the defaults in the order of precedence. The keys are the names of the flags, e.g. dbpath, and the ones of the
+// family sections, e.g. debian.base-url for [debian] base-url in TOML.
+type Conf struct {
+	DBType             string        `mapstructure:"dbtype"`
+	DBPath             string        `mapstructure:"dbpath"`
+	ReadDBType         string        `mapstructure:"read-dbtype"`
+	ReadDBPath         string        `mapstructure:"read-dbpath"`
+	DebugSQL           bool          `mapstructure:"debug-sql"`
+	SlowQueryThreshold time.Duration `mapstructure:"slow-query-threshold"`
+	NoWALCheckpoint    bool          `mapstructure:"no-wal-checkpoint"`
+	Debug              bool          `mapstructure:"debug"`
+	LogToFile          bool          `mapstructure:"log-to-file"`
+	LogDir             string        `mapstructure:"log-dir"`
+	LogMaxSize         int           `mapstructure:"log-max-size"`
+	LogMaxBackups      int           `mapstructure:"log-max-backups"`
+	LogMaxAge          time.Duration `mapstructure:"log-max-age"`
+	LogCompress        bool          `mapstructure:"log-compress"`
+	LogSQLToFile       bool          `mapstructure:"log-sql-to-file"`
+	LogJSON            bool          `mapstructure:"log-json"`
+	LogToStderr        bool          `mapstructure:"log-to-stderr"`
+	Quiet              bool          `mapstructure:"quiet"`
+	HTTPProxy          string        `mapstructure:"http-proxy"`
+	NoProxy            string        `mapstructure:"no-proxy"`
+	HTTPHeader         []string      `mapstructure:"http-header"`
+	CACert             string        `mapstructure:"cacert"`
+	InsecureSkipVerify bool          `mapstructure:"insecure-skip-verify"`
+
+	// fetch
+	NoDetails            bool          `mapstructure:"no-details"`
+	BatchSize            int           `mapstructure:"batch-size"`
+	Retry                int           `mapstructure:"retry"`
+	Timeout              time.Duration `mapstructure:"timeout"`
+	RunTimeout           time.Duration `mapstructure:"run-timeout"`
+	DialTimeout          time.Duration `mapstructure:"dial-timeout"`
+	TLSHandshakeTimeout  time.Duration `mapstructure:"tls-handshake-timeout"`
+	Threads              int           `mapstructure:"threads"`
+	ParseWorkers         int           `mapstructure:"parse-workers"`
+	RequestsPerSecond    float64       `mapstructure:"requests-per-second"`
+	Wait                 time.Duration `mapstructure:"wait"`
+	FailFast             bool          `mapstructure:"fail-fast"`
+	IgnoreErrors         bool          `mapstructure:"ignore-errors"`
+	MinDefinitions       int           `mapstructure:"min-definitions"`
+	Force                bool          `mapstructure:"force"`
+	ForceEmpty           bool          `mapstructure:"force-empty"`
+	AllowSourceChange    bool          `mapstructure:"allow-source-change"`
+	SkipChecksum         bool          `mapstructure:"skip-checksum"`
+	MaxClockSkew         time.Duration `mapstructure:"max-clock-skew"`
+	LocalDir             string        `mapstructure:"local-dir"`
+	CacheDir             string        `mapstructure:"cache-dir"`
+	CacheMaxAge          time.Duration `mapstructure:"cache-max-age"`
+	CacheMaxSize         int64         `mapstructure:"cache-max-size"`
+	StoreSource          bool          `mapstructure:"store-source"`
+	StoreSourceMaxSize   int64         `mapstructure:"store-source-max-size"`
+	StoreSourceRetention time.Duration `mapstructure:"store-source-retention"`
+	HistoryRetention     time.Duration `mapstructure:"history-retention"`
+	DryRun               bool          `mapstructure:"dry-run"`
+	NoInsert             bool          `mapstructure:"no-insert"`
+	DownloadDir          string        `mapstructure:"download-dir"`
+	LockTimeout          time.Duration `mapstructure:"lock-timeout"`
+	IntegrityCheck       string        `mapstructure:"integrity-check"`
+	CreateDBDir          bool          `mapstructure:"create-db-dir"`
+	AutoMigrate          bool          `mapstructure:"auto-migrate"`
+	SUSEType             string        `mapstructure:"suse-type"`
+	OpenSUSETumbleweed   bool          `mapstructure:"opensuse-tumbleweed"`
+	Years                []int         `mapstructure:"years"`
+
+	// status
+	WarnAge time.Duration `mapstructure:"warn-age"`
+
+	// server
+	Bind              string        `mapstructure:"bind"`
+	Port              string        `mapstructure:"port"`
+	RefreshInterval   time.Duration `mapstructure:"refresh-interval"`
+	StaleAge          time.Duration `mapstructure:"stale-age"`
+	CORSAllowOrigins  string        `mapstructure:"cors-allow-origins"`
+	TLSCert           string        `mapstructure:"tls-cert"`
+	TLSKey            string        `mapstructure:"tls-key"`
+	TLSClientCA       string        `mapstructure:"tls-client-ca"`
+	Listen            string        `mapstructure:"listen"`
+	SocketMode        string        `mapstructure:"socket-mode"`
+	ShutdownTimeout   time.Duration `mapstructure:"shutdown-timeout"`
+	QueryTimeout      time.Duration `mapstructure:"query-timeout"`
+	AccessLog         bool          `mapstructure:"access-log"`
+	Profile           string        `mapstructure:"profile"`
+	MaxLimit          int           `mapstructure:"max-limit"`
+	Metrics           bool          `mapstructure:"metrics"`
+	RateLimit         float64       `mapstructure:"rate-limit"`
+	RateBurst         int           `mapstructure:"rate-burst"`
+	TrustProxyHeaders bool          `mapstructure:"trust-proxy-headers"`
+	AuthToken         string        `mapstructure:"auth-token"`
+	AuthTokensFile    string        `mapstructure:"auth-tokens-file"`
+	ReloadInterval    time.Duration `mapstructure:"reload-interval"`
+
+	Alpine FamilyConf `mapstructure:"alpine"`
+	Amazon FamilyConf `mapstructure:"amazon"`
+	Debian DebianConf `mapstructure:"debian"`
+	Fedora FamilyConf `mapstructure:"fedora"`
+	Oracle FamilyConf `mapstructure:"oracle"`
+	RedHat FamilyConf `mapstructure:"redhat"`
+	SUSE   SUSEConf   `mapstructure:"suse"`
+	Ubuntu FamilyConf `mapstructure:"ubuntu"`
+}
+
+// FamilyConf is the section of a fetch subcommand
+type FamilyConf struct {
+	BaseURL  string   `mapstructure:"base-url"`
+	Versions []string `mapstructure:"versions"` // the versions fetched by fetch all
+}
+
+// DebianConf is the section of fetch debian
+type DebianConf struct {
+	FamilyConf `mapstructure:",squash"`
+	All        bool `mapstructure:"all"`
+}
+
+// SUSEConf is the section of fetch suse
+type SUSEConf struct {
+	FamilyConf `mapstructure:",squash"`
+	Type       string `mapstructure:"type"` // the SUSE type to fetch the versions of, suse-type if empty
+}
+
+// Keys returns the keys of Conf, e.g. dbpath and debian.base-url
+func Keys() []string {
+	keys := appendKeys(nil, "", reflect.TypeOf(Conf{}))
+	sort.Strings(keys)
+	return keys
+}
+
+func appendKeys(keys []string, prefix string, t reflect.Type) []string {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opt, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		switch {
+		case opt == "squash":
+			keys = appendKeys(keys, prefix, f.Type)
+		case f.Type.Kind() == reflect.Struct:
+			keys = appendKeys(keys, prefix+name+".", f.Type)
+		default:
+			keys = append(keys, prefix+name)
+		}
+	}
+	return keys
+}
+
+// UnknownKeys returns the sorted keys of the config file not in Conf, e.g. the typos
+func UnknownKeys(keys []string) []string {
+	known := map[string]struct{}{}
+	for _, k := range Keys() {
+		known[k] = struct{}{}
+	}
+	unknown := []string{}
+	for _, k := range keys {
+		if _, ok := known[strings.ToLower(k)]; !ok {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// Load returns the configuration resolved by v
+func Load(v *viper.Viper) (Conf, error) {
+	var conf Conf
+	if err := v.Unmarshal(&conf); err != nil {
+		return Conf{}, xerrors.Errorf("Failed to unmarshal config. err: %w", err)
+	}
+	return conf, nil
+}
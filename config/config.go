@@ -1,11 +1,24 @@
 package config
 
+import "strings"
+
 // Version ... Version
 var Version = ""
 
 // Revision of Git
 var Revision string
 
+// BuildDate is the date of the build, e.g. 2023-07-06T00:00:00Z
+var BuildDate string
+
+// DisplayVersion returns Version, or "dev" for the builds without it, e.g. by go run
+func DisplayVersion() string {
+	if Version == "" {
+		return "dev"
+	}
+	return Version
+}
+
 const (
 	// RedHat is
 	RedHat = "redhat"
@@ -76,6 +89,9 @@ const (
 	// OpenSUSE is
 	OpenSUSE = "opensuse"
 
+	// OpenSUSETumbleweed is the OS version of openSUSE Tumbleweed, the rolling release of no version number, stored as it is
+	OpenSUSETumbleweed = "tumbleweed"
+
 	// OpenSUSELeap is
 	OpenSUSELeap = "opensuse.leap"
 
@@ -97,3 +113,39 @@ const (
 	// Fedora is
 	Fedora = "fedora"
 )
+
+// codenames are the releases of the codenames of Debian and Ubuntu, which Raspbian shares with Debian
+var codenames = map[string]map[string]string{
+	Debian: {
+		Debian7:  "7",
+		Debian8:  "8",
+		Debian9:  "9",
+		Debian10: "10",
+		Debian11: "11",
+		Debian12: "12",
+	},
+	Ubuntu: {
+		Ubuntu1404: "14.04",
+		Ubuntu1604: "16.04",
+		Ubuntu1804: "18.04",
+		Ubuntu1910: "19.10",
+		Ubuntu2004: "20.04",
+		Ubuntu2010: "20.10",
+		Ubuntu2104: "21.04",
+		Ubuntu2110: "21.10",
+		Ubuntu2204: "22.04",
+		Ubuntu2210: "22.10",
+		Ubuntu2304: "23.04",
+	},
+}
+
+// ReleaseOfCodename returns the release of the codename of family, e.g. 12 of bookworm of debian, or release as it is if not a codename
+func ReleaseOfCodename(family, release string) string {
+	if family == Raspbian {
+		family = Debian
+	}
+	if r, ok := codenames[family][strings.ToLower(release)]; ok {
+		return r
+	}
+	return release
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"context"
+
+	"github.com/spf13/viper"
+)
+
+type confKey struct{}
+
+// NewContext returns ctx carrying conf, which the fetchers and the DB read by FromContext instead of the global viper,
+// e.g. for goval.Load of the programs embedding goval-dictionary, which have neither the flags nor the config file of the CLI
+func NewContext(ctx context.Context, conf Conf) context.Context {
+	return context.WithValue(ctx, confKey{}, conf)
+}
+
+// FromContext returns the Conf of ctx, or the one resolved by the global viper of the CLI if none, e.g. of the flags of the subcommand
+func FromContext(ctx context.Context) Conf {
+	if ctx != nil {
+		if conf, ok := ctx.Value(confKey{}).(Conf); ok {
+			return conf
+		}
+	}
+	conf, _ := Load(viper.GetViper())
+	return conf
+}
+
+// BaseURL returns the base URL of the mirror of the section of the fetch subcommand of name, e.g. suse of [suse] base-url, or empty if none
+func (c Conf) BaseURL(name string) string {
+	switch name {
+	case Alpine:
+		return c.Alpine.BaseURL
+	case Amazon:
+		return c.Amazon.BaseURL
+	case Debian:
+		return c.Debian.BaseURL
+	case Fedora:
+		return c.Fedora.BaseURL
+	case Oracle:
+		return c.Oracle.BaseURL
+	case RedHat:
+		return c.RedHat.BaseURL
+	case "suse":
+		return c.SUSE.BaseURL
+	case Ubuntu:
+		return c.Ubuntu.BaseURL
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+// ErrNoDBDir is the error of the missing directory of the sqlite3 DB
+var ErrNoDBDir = xerrors.New("no such directory")
+
+// ResolveDBPath returns the absolute path of the sqlite3 DB at dbPath, expanding ~ to the home directory and the relative path from the
+// working directory, not from $PWD which is empty under cron. The other DB types are returned as they are, i.e. the connection strings.
+func ResolveDBPath(dbType, dbPath string) (string, error) {
+	if dbType != "sqlite3" {
+		return dbPath, nil
+	}
+	if dbPath == "" {
+		return "", xerrors.New("Failed to resolve dbpath. err: empty dbpath")
+	}
+	p, err := homedir.Expand(dbPath)
+	if err != nil {
+		return "", xerrors.Errorf("Failed to expand dbpath. dbpath: %s, err: %w", dbPath, err)
+	}
+	p, err = filepath.Abs(p)
+	if err != nil {
+		return "", xerrors.Errorf("Failed to resolve dbpath. dbpath: %s, err: %w", dbPath, err)
+	}
+	return p, nil
+}
+
+// PrepareDBDir checks the directory of the sqlite3 DB at path exists, or creates it with create, and that the DB and its journal are
+// writable there, so that a fetch fails before downloading rather than after
+func PrepareDBDir(path string, create bool) error {
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	switch {
+	case err == nil:
+		if !info.IsDir() {
+			return xerrors.Errorf("Failed to prepare the directory of dbpath. dir: %s, err: not a directory", dir)
+		}
+	case xerrors.Is(err, os.ErrNotExist) && create:
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return xerrors.Errorf("Failed to create the directory of dbpath. dir: %s, err: %w", dir, err)
+		}
+	case xerrors.Is(err, os.ErrNotExist):
+		return xerrors.Errorf("Failed to prepare the directory of dbpath. dir: %s, err: %w", dir, ErrNoDBDir)
+	default:
+		return xerrors.Errorf("Failed to prepare the directory of dbpath. dir: %s, err: %w", dir, err)
+	}
+
+	// the journal of sqlite3 is created next to the DB
+	f, err := os.CreateTemp(dir, ".goval-dictionary-*")
+	if err != nil {
+		return xerrors.Errorf("Failed to write in the directory of dbpath. dir: %s, err: %w", dir, err)
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+
+	f, err = os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		if xerrors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return xerrors.Errorf("Failed to write dbpath. dbpath: %s, err: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestResolveDBPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory. err: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		dbType  string
+		dbPath  string
+		pwd     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "absolute",
+			dbType: "sqlite3",
+			dbPath: "/var/lib/goval-dictionary/oval.sqlite3",
+			want:   "/var/lib/goval-dictionary/oval.sqlite3",
+		},
+		{
+			name:   "relative",
+			dbType: "sqlite3",
+			dbPath: "data/oval.sqlite3",
+			want:   filepath.Join(wd, "data", "oval.sqlite3"),
+		},
+		{
+			name:   "relative with empty PWD as under cron",
+			dbType: "sqlite3",
+			dbPath: "oval.sqlite3",
+			pwd:    "",
+			want:   filepath.Join(wd, "oval.sqlite3"),
+		},
+		{
+			name:   "relative with PWD elsewhere",
+			dbType: "sqlite3",
+			dbPath: "./oval.sqlite3",
+			pwd:    "/nonexistent",
+			want:   filepath.Join(wd, "oval.sqlite3"),
+		},
+		{
+			name:   "home",
+			dbType: "sqlite3",
+			dbPath: "~/oval.sqlite3",
+			want:   filepath.Join(home, "oval.sqlite3"),
+		},
+		{
+			name:   "cleaned",
+			dbType: "sqlite3",
+			dbPath: "/var/lib/../lib/goval-dictionary//oval.sqlite3",
+			want:   "/var/lib/goval-dictionary/oval.sqlite3",
+		},
+		{
+			name:    "empty",
+			dbType:  "sqlite3",
+			dbPath:  "",
+			wantErr: true,
+		},
+		{
+			name:   "connection string as it is",
+			dbType: "mysql",
+			dbPath: "user:pass@tcp(127.0.0.1:3306)/oval?parseTime=true",
+			want:   "user:pass@tcp(127.0.0.1:3306)/oval?parseTime=true",
+		},
+		{
+			name:   "redis URL as it is",
+			dbType: "redis",
+			dbPath: "redis://localhost/0",
+			want:   "redis://localhost/0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PWD", tt.pwd)
+			got, err := ResolveDBPath(tt.dbType, tt.dbPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %t, actual: %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected: %s, actual: %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPrepareDBDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    func(dir string) string
+		create  bool
+		wantErr error
+	}{
+		{
+			name: "existing directory",
+			path: func(dir string) string { return filepath.Join(dir, "oval.sqlite3") },
+		},
+		{
+			name:    "missing directory",
+			path:    func(dir string) string { return filepath.Join(dir, "missing", "oval.sqlite3") },
+			wantErr: ErrNoDBDir,
+		},
+		{
+			name:   "missing directory created",
+			path:   func(dir string) string { return filepath.Join(dir, "missing", "oval.sqlite3") },
+			create: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path(t.TempDir())
+			err := PrepareDBDir(path, tt.create)
+			if tt.wantErr != nil {
+				if !xerrors.Is(err, tt.wantErr) {
+					t.Fatalf("expected: %v, actual: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if _, err := os.Stat(filepath.Dir(path)); err != nil {
+				t.Errorf("expected the directory of %s, actual: %s", path, err)
+			}
+			entries, err := os.ReadDir(filepath.Dir(path))
+			if err != nil {
+				t.Fatalf("Failed to read directory. err: %s", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("expected: nothing left in the directory, actual: %d entries", len(entries))
+			}
+		})
+	}
+}
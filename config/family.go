@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrUnknownFamily is the error of the OS family not supported, which *UnknownFamilyError is
+var ErrUnknownFamily = xerrors.New("unknown os family")
+
+// UnknownFamilyError is the error of NormalizeFamily for the family neither a constant nor an alias of one
+type UnknownFamilyError struct {
+	Family string
+}
+
+func (e *UnknownFamilyError) Error() string {
+	return fmt.Sprintf("%s: %q", ErrUnknownFamily, e.Family)
+}
+
+// Is reports the error is ErrUnknownFamily, e.g. for xerrors.Is(err, ErrUnknownFamily)
+func (e *UnknownFamilyError) Is(target error) bool {
+	return target == ErrUnknownFamily
+}
+
+// families are the families of NormalizeFamily by the names canonicalized by canonicalFamily: the constants and their aliases
+var families = map[string]string{
+	Alpine:                     Alpine,
+	Amazon:                     Amazon,
+	"amazon.linux":             Amazon,
+	"amzn":                     Amazon,
+	CentOS:                     RedHat,
+	Debian:                     Debian,
+	Fedora:                     Fedora,
+	OpenSUSE:                   OpenSUSE,
+	"opensuse.tumbleweed":      OpenSUSE,
+	OpenSUSELeap:               OpenSUSELeap,
+	Oracle:                     Oracle,
+	"oracle.linux":             Oracle,
+	"ol":                       Oracle,
+	Raspbian:                   Raspbian,
+	RedHat:                     RedHat,
+	"red.hat":                  RedHat,
+	"rhel":                     RedHat,
+	"red.hat.enterprise.linux": RedHat,
+	SUSEEnterpriseDesktop:      SUSEEnterpriseDesktop,
+	"sled":                     SUSEEnterpriseDesktop,
+	"suse.enterprise.desktop":  SUSEEnterpriseDesktop,
+	SUSEEnterpriseServer:       SUSEEnterpriseServer,
+	"sles":                     SUSEEnterpriseServer,
+	"suse.enterprise.server":   SUSEEnterpriseServer,
+	Ubuntu:                     Ubuntu,
+}
+
+// NormalizeFamily returns the constant of the family of s, in any case and with the words separated by the spaces, _, - or ., e.g. redhat of "Red Hat",
+// or of its alias, e.g. redhat of centos and rhel, and suse.linux.enterprise.server of "SUSE Enterprise Server" and sles.
+// The family not supported is *UnknownFamilyError.
+func NormalizeFamily(s string) (string, error) {
+	if family, ok := families[canonicalFamily(s)]; ok {
+		return family, nil
+	}
+	return "", &UnknownFamilyError{Family: s}
+}
+
+// SupportedFamilies returns the constants of the families this binary can serve, sorted, whether or not their OVAL is stored,
+// e.g. for the clients to fall back to another source for the others. The aliases, e.g. centos, are looked up as their constant.
+func SupportedFamilies() []string {
+	seen := map[string]struct{}{}
+	supported := []string{}
+	for _, family := range families {
+		if _, ok := seen[family]; ok {
+			continue
+		}
+		seen[family] = struct{}{}
+		supported = append(supported, family)
+	}
+	sort.Strings(supported)
+	return supported
+}
+
+// canonicalFamily returns s in lowercase with the words separated by ., e.g. suse.linux.enterprise.server of "SUSE Linux Enterprise-Server"
+func canonicalFamily(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '_' || r == '-' || r == '.'
+	}), ".")
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestNormalizeFamily(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		// the constants
+		{in: Alpine, want: Alpine},
+		{in: Amazon, want: Amazon},
+		{in: CentOS, want: RedHat},
+		{in: Debian, want: Debian},
+		{in: Fedora, want: Fedora},
+		{in: OpenSUSE, want: OpenSUSE},
+		{in: OpenSUSELeap, want: OpenSUSELeap},
+		{in: Oracle, want: Oracle},
+		{in: Raspbian, want: Raspbian},
+		{in: RedHat, want: RedHat},
+		{in: SUSEEnterpriseDesktop, want: SUSEEnterpriseDesktop},
+		{in: SUSEEnterpriseServer, want: SUSEEnterpriseServer},
+		{in: Ubuntu, want: Ubuntu},
+		// the case and the separators
+		{in: "RedHat", want: RedHat},
+		{in: "REDHAT", want: RedHat},
+		{in: "Red Hat", want: RedHat},
+		{in: " red_hat ", want: RedHat},
+		{in: "Debian", want: Debian},
+		{in: "CentOS", want: RedHat},
+		{in: "openSUSE Leap", want: OpenSUSELeap},
+		{in: "opensuse-leap", want: OpenSUSELeap},
+		{in: "SUSE Linux Enterprise Server", want: SUSEEnterpriseServer},
+		{in: "suse_linux_enterprise_desktop", want: SUSEEnterpriseDesktop},
+		// the aliases
+		{in: "rhel", want: RedHat},
+		{in: "Red Hat Enterprise Linux", want: RedHat},
+		{in: "Amazon Linux", want: Amazon},
+		{in: "amzn", want: Amazon},
+		{in: "Oracle Linux", want: Oracle},
+		{in: "ol", want: Oracle},
+		{in: "openSUSE Tumbleweed", want: OpenSUSE},
+		{in: "SUSE Enterprise Server", want: SUSEEnterpriseServer},
+		{in: "sles", want: SUSEEnterpriseServer},
+		{in: "SUSE Enterprise Desktop", want: SUSEEnterpriseDesktop},
+		{in: "sled", want: SUSEEnterpriseDesktop},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeFamily(tt.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: expected: %s, actual: %s", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestNormalizeFamilyUnknown(t *testing.T) {
+	for _, in := range []string{"", " ", "unknown", "suse", "windows", Debian12, Ubuntu2204, "red hat hat"} {
+		got, err := NormalizeFamily(in)
+		if err == nil {
+			t.Errorf("%q: expected: the error, actual: %s", in, got)
+			continue
+		}
+		var ue *UnknownFamilyError
+		if !xerrors.As(err, &ue) || ue.Family != in {
+			t.Errorf("%q: expected: *UnknownFamilyError of it, actual: %#v", in, err)
+		}
+		if !xerrors.Is(err, ErrUnknownFamily) {
+			t.Errorf("%q: expected: ErrUnknownFamily, actual: %s", in, err)
+		}
+	}
+}
+
+func TestSupportedFamilies(t *testing.T) {
+	want := []string{Alpine, Amazon, Debian, Fedora, OpenSUSE, OpenSUSELeap, Oracle, Raspbian, RedHat, SUSEEnterpriseDesktop, SUSEEnterpriseServer, Ubuntu}
+	got := SupportedFamilies()
+	if len(got) != len(want) {
+		t.Fatalf("expected: %q, actual: %q", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected: %q, actual: %q", want, got)
+			break
+		}
+	}
+	for _, family := range got {
+		if normalized, err := NormalizeFamily(family); err != nil || normalized != family {
+			t.Errorf("NormalizeFamily(%q): expected: %q, actual: %q, err: %v", family, family, normalized, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReleaseKey returns the OS version of the OVAL of family stored for osVer, the installed one looked up, e.g. 8 of redhat 8.4.
+// family is the constant, e.g. of NormalizeFamily. Only the version before the first space is taken, e.g. 22.04 of "22.04.3 LTS",
+// and its leading numeric components separated by ., e.g. 8 of 8-stream. The key is by family:
+//   - debian, raspbian, redhat, centos, oracle and fedora: the major version, e.g. 12 of 12.1, 7 of 7.9.2009 and 38 of 38
+//   - ubuntu and alpine: the major and the minor versions, e.g. 16.04 of 16.04.7 and 3.18 of 3.18.2
+//   - opensuse and opensuse.leap: the major and the minor versions, e.g. 42.3 of 42.3 and 15.5 of 15.5
+//   - opensuse: tumbleweed of tumbleweed in any case and of the snapshots of Tumbleweed, e.g. 20231015 of VERSION_ID of its os-release
+//   - suse.linux.enterprise.server and .desktop: the major version and the service pack, e.g. 12.1 of 12-SP1, "12 SP1" and 12.1, or 15 of 15
+//   - amazon: 1 of the releases of Amazon Linux AMI by the year, e.g. 2017.09 and 2018.03, 2 of 2, and the year of 2022 and later, e.g. 2023 of 2023.1.20230719
+//
+// The codename of Debian, Raspbian and Ubuntu is taken as its release first, e.g. 9 of stretch and 22.04 of jammy.
+// osVer of no version number, e.g. sid, edge and tumbleweed, is returned as it is.
+func ReleaseKey(family, osVer string) string {
+	fields := strings.Fields(osVer)
+	if len(fields) == 0 {
+		return ""
+	}
+	v := ReleaseOfCodename(family, fields[0])
+	comps := numericComponents(v)
+
+	switch family {
+	case Amazon:
+		switch {
+		case len(comps) == 0:
+			return "1"
+		case comps[0] == "2":
+			return "2"
+		case len(comps[0]) == 4 && comps[0] >= "2022":
+			return comps[0]
+		default:
+			return "1"
+		}
+	case SUSEEnterpriseServer, SUSEEnterpriseDesktop:
+		if len(comps) == 0 {
+			return v
+		}
+		// the service pack, e.g. 12-SP1, 12SP1 and "12 SP1", of which the version stored is 12.1
+		if m := servicePack.FindStringSubmatch(strings.ToUpper(strings.Join(fields, " "))); m != nil {
+			sp, _ := strconv.Atoi(m[1])
+			return comps[0] + "." + strconv.Itoa(sp)
+		}
+		return majorMinor(comps)
+	case OpenSUSE:
+		if strings.EqualFold(v, OpenSUSETumbleweed) || tumbleweedSnapshot.MatchString(v) {
+			return OpenSUSETumbleweed
+		}
+		if len(comps) == 0 {
+			return v
+		}
+		return majorMinor(comps)
+	case Ubuntu, Alpine, OpenSUSELeap:
+		if len(comps) == 0 {
+			return v
+		}
+		return majorMinor(comps)
+	default:
+		if len(comps) == 0 {
+			return v
+		}
+		return comps[0]
+	}
+}
+
+// majorMinor returns the major and the minor versions of comps of numericComponents, or only the major one if no minor
+func majorMinor(comps []string) string {
+	if len(comps) > 2 {
+		comps = comps[:2]
+	}
+	return strings.Join(comps, ".")
+}
+
+// servicePack matches the service pack of SUSE Linux Enterprise right after the major version, e.g. SP1 of 12-SP1, 12SP1 and "12 SP1"
+var servicePack = regexp.MustCompile(`^\d+[- ]?SP(\d+)`)
+
+// tumbleweedSnapshot matches the snapshot of openSUSE Tumbleweed, the date of it, e.g. 20231015
+var tumbleweedSnapshot = regexp.MustCompile(`^20\d{6}$`)
+
+// numericComponents returns the leading components of the digits of v separated by ., e.g. 7, 9 and 2009 of 7.9.2009, 8 of 8-stream,
+// and none of tumbleweed
+func numericComponents(v string) []string {
+	var comps []string
+	for {
+		i := 0
+		for i < len(v) && '0' <= v[i] && v[i] <= '9' {
+			i++
+		}
+		if i == 0 {
+			return comps
+		}
+		comps = append(comps, v[:i])
+		if i+1 >= len(v) || v[i] != '.' {
+			return comps
+		}
+		v = v[i+1:]
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import "testing"
+
+func TestReleaseKey(t *testing.T) {
+	tests := []struct {
+		family string
+		osVer  string
+		want   string
+	}{
+		// the major version
+		{family: Debian, osVer: "12", want: "12"},
+		{family: Debian, osVer: "12.1", want: "12"},
+		{family: Debian, osVer: "11.7 (bullseye)", want: "11"},
+		{family: Debian, osVer: "sid", want: "sid"},
+		{family: Raspbian, osVer: "10.13", want: "10"},
+		{family: RedHat, osVer: "8", want: "8"},
+		{family: RedHat, osVer: "8.4", want: "8"},
+		{family: RedHat, osVer: "8-stream", want: "8"},
+		{family: CentOS, osVer: "7.9.2009", want: "7"},
+		{family: Oracle, osVer: "9.2", want: "9"},
+		{family: Fedora, osVer: "38", want: "38"},
+		// the major and the minor versions, not 16 of 16.04 of Ubuntu
+		{family: Ubuntu, osVer: "16.04", want: "16.04"},
+		{family: Ubuntu, osVer: "16.04.7", want: "16.04"},
+		{family: Ubuntu, osVer: "22.04.3 LTS", want: "22.04"},
+		{family: Alpine, osVer: "3.18", want: "3.18"},
+		{family: Alpine, osVer: "3.18.2", want: "3.18"},
+		{family: Alpine, osVer: "3.19.0_alpha20230901", want: "3.19"},
+		{family: Alpine, osVer: "edge", want: "edge"},
+		// the codenames of Debian, Raspbian and Ubuntu
+		{family: Debian, osVer: "stretch", want: "9"},
+		{family: Debian, osVer: "Bookworm", want: "12"},
+		{family: Raspbian, osVer: "bookworm", want: "12"},
+		{family: Ubuntu, osVer: "jammy", want: "22.04"},
+		{family: Ubuntu, osVer: "Jammy Jellyfish", want: "22.04"},
+		{family: OpenSUSE, osVer: "42.3", want: "42.3"},
+		{family: OpenSUSE, osVer: "13.2", want: "13.2"},
+		{family: OpenSUSE, osVer: "tumbleweed", want: "tumbleweed"},
+		{family: OpenSUSE, osVer: "Tumbleweed", want: "tumbleweed"},
+		// the snapshot of Tumbleweed, VERSION_ID of its os-release
+		{family: OpenSUSE, osVer: "20231015", want: "tumbleweed"},
+		{family: OpenSUSELeap, osVer: "15.5", want: "15.5"},
+		{family: OpenSUSELeap, osVer: "15.5.1", want: "15.5"},
+		// the service pack of SUSE Linux Enterprise as the minor version
+		{family: SUSEEnterpriseServer, osVer: "15", want: "15"},
+		{family: SUSEEnterpriseServer, osVer: "15.5", want: "15.5"},
+		{family: SUSEEnterpriseServer, osVer: "12-SP1", want: "12.1"},
+		{family: SUSEEnterpriseServer, osVer: "12 SP1", want: "12.1"},
+		{family: SUSEEnterpriseServer, osVer: "12SP1", want: "12.1"},
+		{family: SUSEEnterpriseServer, osVer: "12-sp5-LTSS", want: "12.5"},
+		{family: SUSEEnterpriseServer, osVer: "12 SP0", want: "12.0"},
+		{family: SUSEEnterpriseDesktop, osVer: "15-SP4", want: "15.4"},
+		// the releases of Amazon Linux
+		{family: Amazon, osVer: "1", want: "1"},
+		{family: Amazon, osVer: "2017.09", want: "1"},
+		{family: Amazon, osVer: "2018.03", want: "1"},
+		{family: Amazon, osVer: "2", want: "2"},
+		{family: Amazon, osVer: "2 (Karoo)", want: "2"},
+		{family: Amazon, osVer: "2022", want: "2022"},
+		{family: Amazon, osVer: "2023", want: "2023"},
+		{family: Amazon, osVer: "2023.1.20230719", want: "2023"},
+		// no version
+		{family: RedHat, osVer: "", want: ""},
+		{family: Amazon, osVer: " ", want: ""},
+	}
+	for _, tt := range tests {
+		if got := ReleaseKey(tt.family, tt.osVer); got != tt.want {
+			t.Errorf("ReleaseKey(%q, %q): expected: %q, actual: %q", tt.family, tt.osVer, tt.want, got)
+		}
+	}
+}
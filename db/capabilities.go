@@ -0,0 +1,71 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// CapabilitiesVersion is the version of the JSON of Capabilities, incremented on its incompatible changes, e.g. of a field renamed or removed,
+// for the clients to detect the upgrade they do not understand
+const CapabilitiesVersion = 1
+
+// Capabilities is what the dictionary can answer: the families this binary can serve and the OVAL stored of them,
+// e.g. for the scanner to fall back to another source for the family or the release not stored at once
+type Capabilities struct {
+	ContractVersion int    `json:"contractVersion"` // CapabilitiesVersion
+	SchemaVersion   uint   `json:"schemaVersion"`   // models.LatestSchemaVersion of the DB this binary reads
+	Version         string `json:"version"`
+	Revision        string `json:"revision"`
+	// Families are of config.SupportedFamilies, whether or not their OVAL is stored
+	Families []string `json:"families"`
+	Roots    []Root   `json:"roots"`
+}
+
+// Root is the OVAL of a family and a release stored in DB, as it is stored, e.g. debian 12 of raspbian 12.1
+type Root struct {
+	Family      string    `json:"family"`
+	Release     string    `json:"release"`
+	Definitions int       `json:"definitions"`
+	Packages    int       `json:"packages"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// ListRoots returns the OVAL stored in driver sorted by the family and the release
+func ListRoots(driver DB) ([]Root, error) {
+	stats, err := driver.GetRootStats()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get the stats of OVAL. err: %w", err)
+	}
+	return rootsOf(stats), nil
+}
+
+// NewCapabilities returns the capabilities of this binary with the OVAL of stats, e.g. of GetRootStats cached by the server
+func NewCapabilities(stats []models.RootStat) Capabilities {
+	return Capabilities{
+		ContractVersion: CapabilitiesVersion,
+		SchemaVersion:   models.LatestSchemaVersion,
+		Version:         c.DisplayVersion(),
+		Revision:        c.Revision,
+		Families:        c.SupportedFamilies(),
+		Roots:           rootsOf(stats),
+	}
+}
+
+func rootsOf(stats []models.RootStat) []Root {
+	roots := make([]Root, 0, len(stats))
+	for _, s := range stats {
+		roots = append(roots, Root{Family: s.Family, Release: s.OSVersion, Definitions: s.Definitions, Packages: s.Packages, Timestamp: s.Timestamp.UTC()})
+	}
+	sort.SliceStable(roots, func(i, j int) bool {
+		if roots[i].Family != roots[j].Family {
+			return roots[i].Family < roots[j].Family
+		}
+		return roots[i].Release < roots[j].Release
+	})
+	return roots
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/internal/testutil"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+func TestListRoots(t *testing.T) {
+	r := newTestRDB(t)
+	expected := []Root{}
+	for _, root := range testutil.Load(t, r) {
+		packs := 0
+		for _, d := range root.Definitions {
+			packs += len(d.AffectedPacks)
+		}
+		expected = append(expected, Root{Family: root.Family, Release: root.OSVersion, Definitions: len(root.Definitions), Packages: packs, Timestamp: root.Timestamp.UTC()})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Family != expected[j].Family {
+			return expected[i].Family < expected[j].Family
+		}
+		return expected[i].Release < expected[j].Release
+	})
+
+	roots, err := ListRoots(r)
+	if err != nil {
+		t.Fatalf("Failed to ListRoots. err: %s", err)
+	}
+	if !reflect.DeepEqual(roots, expected) {
+		t.Errorf("expected: %+v, actual: %+v", expected, roots)
+	}
+
+	empty, err := ListRoots(newTestRDB(t))
+	if err != nil {
+		t.Fatalf("Failed to ListRoots. err: %s", err)
+	}
+	if empty == nil || len(empty) != 0 {
+		t.Errorf("expected: no roots, actual: %+v", empty)
+	}
+}
+
+func TestNewCapabilities(t *testing.T) {
+	stats := []models.RootStat{
+		{Family: c.RedHat, OSVersion: "8", Timestamp: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.FixedZone("JST", 9*60*60)), Definitions: 4, Packages: 8},
+		{Family: c.Debian, OSVersion: "12", Timestamp: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC), Definitions: 3, Packages: 2},
+	}
+	caps := NewCapabilities(stats)
+	if caps.ContractVersion != CapabilitiesVersion || caps.SchemaVersion != models.LatestSchemaVersion {
+		t.Errorf("expected: the contract version %d and the schema version %d, actual: %d and %d", CapabilitiesVersion, models.LatestSchemaVersion, caps.ContractVersion, caps.SchemaVersion)
+	}
+	if !reflect.DeepEqual(caps.Families, c.SupportedFamilies()) {
+		t.Errorf("expected: %q, actual: %q", c.SupportedFamilies(), caps.Families)
+	}
+	expected := []Root{
+		{Family: c.Debian, Release: "12", Definitions: 3, Packages: 2, Timestamp: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)},
+		{Family: c.RedHat, Release: "8", Definitions: 4, Packages: 8, Timestamp: time.Date(2023, time.July, 5, 15, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(caps.Roots, expected) {
+		t.Errorf("expected: %+v, actual: %+v", expected, caps.Roots)
+	}
+}
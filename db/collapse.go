@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+type collapseArchKey struct{}
+
+// WithCollapseArch returns ctx whose lookups without the arch collapse the affected packages of the same name and version of more than one arch,
+// e.g. of Oracle Linux, Amazon Linux and Fedora, into one if collapse, which they do by default for the callers not telling the arches apart,
+// or return the package of each arch if not, as the lookups of the arch return the packages of it only either way
+func WithCollapseArch(ctx context.Context, collapse bool) context.Context {
+	return context.WithValue(ctx, collapseArchKey{}, collapse)
+}
+
+func collapseArchFrom(ctx context.Context) bool {
+	if ctx == nil {
+		return true
+	}
+	collapse, ok := ctx.Value(collapseArchKey{}).(bool)
+	return !ok || collapse
+}
+
+// collapseArch returns packs with the packages of the same name and version, and the same other fields but the arch, collapsed into the first of them,
+// whose arch is emptied if they are of more than one arch, keeping the order of packs. It is done after the lookups, the same for RDB and Redis,
+// as the packages of Redis are in the JSON of the definitions.
+func collapseArch(packs []models.Package) []models.Package {
+	if len(packs) < 2 {
+		return packs
+	}
+	key := func(p models.Package) models.Package {
+		p.ID, p.DefinitionID, p.Arch = 0, 0, ""
+		return p
+	}
+	index := make(map[models.Package]int, len(packs))
+	collapsed := make([]models.Package, 0, len(packs))
+	for _, p := range packs {
+		k := key(p)
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(collapsed)
+			collapsed = append(collapsed, p)
+			continue
+		}
+		if collapsed[i].Arch != p.Arch {
+			collapsed[i].Arch = ""
+		}
+	}
+	return collapsed
+}
+
+// collapseArchOf collapses the affected packages of defs by collapseArch unless arch is given or ctx tells not to
+func collapseArchOf(ctx context.Context, defs []models.Definition, arch string) {
+	if arch != "" || !collapseArchFrom(ctx) {
+		return
+	}
+	for i := range defs {
+		defs[i].AffectedPacks = collapseArch(defs[i].AffectedPacks)
+	}
+}
+
+// collapseRepeats returns defs of GetByPackName, where the definition is repeated adjacently for each of its packages of packName as joined by RDB,
+// or for each arch of packName as the keys of Redis, with the repeats for the packages collapsed by collapseArch dropped,
+// i.e. repeated as many times as its packages of packName left, once at least
+func collapseRepeats(defs []models.Definition, packName string) []models.Definition {
+	collapsed := make([]models.Definition, 0, len(defs))
+	for i := 0; i < len(defs); {
+		j := i + 1
+		for j < len(defs) && defs[j].DefinitionID == defs[i].DefinitionID {
+			j++
+		}
+		n := 0
+		for _, p := range defs[i].AffectedPacks {
+			if p.Name == packName {
+				n++
+			}
+		}
+		if n > j-i {
+			n = j - i
+		}
+		if n < 1 {
+			n = 1
+		}
+		collapsed = append(collapsed, defs[i:i+n]...)
+		i = j
+	}
+	return collapsed
+}
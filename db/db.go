@@ -1,12 +1,21 @@
 package db
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/cheggaaa/pb/v3"
+	"github.com/inconshreveable/log15"
+	"golang.org/x/exp/slices"
 	"golang.org/x/xerrors"
 
 	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/log"
 	"github.com/vulsio/goval-dictionary/models"
 )
 
@@ -15,29 +24,215 @@ type DB interface {
 	Name() string
 	OpenDB(string, string, bool, Option) error
 	CloseDB() error
+	Ping() error
 	MigrateDB() error
+	PendingMigrations() ([]Migration, error)
 
 	IsGovalDictModelV1() (bool, error)
 	GetFetchMeta() (*models.FetchMeta, error)
 	UpsertFetchMeta(*models.FetchMeta) error
 
-	GetByPackName(family string, osVer string, packName string, arch string) ([]models.Definition, error)
-	GetByCveID(family string, osVer string, cveID string, arch string) ([]models.Definition, error)
-	InsertOval(*models.Root) error
+	// the fetched files stored by --store-source, not supported by Redis
+	StoreSourceFile(*models.FetchFile) error
+	TouchSourceFile(fileName string, fetchedAt time.Time) error
+	GetSourceFile(fileName string) ([]byte, error)
+	PruneSourceFiles(before time.Time) (int64, error)
+
+	// GetFetchHistory returns the refreshes of the OVAL of family and osVer since since, in the order of them
+	GetFetchHistory(ctx context.Context, family string, osVer string, since time.Time) ([]models.FetchHistory, error)
+
+	// the lookups stop once ctx is done, e.g. of the request of the server timed out, returning the error of ctx
+	// and return the definitions of the latest issued advisory first and then by DefinitionID, except the pages ordered by DefinitionID
+	GetByPackName(ctx context.Context, family string, osVer string, packName string, arch string, classes ...string) ([]models.Definition, error)
+	GetByPackNames(ctx context.Context, family string, osVer string, packNames []string, arch string, classes ...string) (map[string][]models.Definition, error)
+	GetByPackNamePage(ctx context.Context, family string, osVer string, packName string, arch string, page Page, classes ...string) ([]models.Definition, int64, error)
+	GetByCveID(ctx context.Context, family string, osVer string, cveID string, arch string) ([]models.Definition, error)
+	GetByCveIDPage(ctx context.Context, family string, osVer string, cveID string, arch string, page Page) ([]models.Definition, int64, error)
+	GetByCpe(ctx context.Context, family string, osVer string, cpe string, arch string) ([]models.Definition, error)
+	// GetByAdvisoryID returns the definitions of the advisory of advisoryID, e.g. DSA-3981-1, RHSA-2017:0933 or SUSE-SU-2021:0857-1,
+	// case-insensitively and of all its revisions if advisoryID is without the revision, e.g. DSA-3981 of DSA-3981-1 and DSA-3981-2
+	GetByAdvisoryID(ctx context.Context, family string, osVer string, advisoryID string, arch string) ([]models.Definition, error)
+	GetPackInfo(ctx context.Context, family string, osVer string, packName string) ([]models.PackInfo, error)
+	// ListPackages returns the distinct names of the affected packages of the family and osVer, sorted, e.g. for the scanner to skip the installed
+	// packages affected by no definitions without looking them up
+	ListPackages(ctx context.Context, family string, osVer string) ([]string, error)
+	InsertOval(context.Context, *models.Root) (models.ChangeStat, error)
+	MergeOval(context.Context, *models.Root) (models.ChangeStat, error)
+	PurgeOval(ctx context.Context, family string, osVer string) (models.RootStat, error)
 	CountDefs(string, string) (int, error)
+	IterateDefinitions(ctx context.Context, family string, osVer string, fn func(models.Definition) error) error
+	GetRootStats() ([]models.RootStat, error)
+	GetRootTimestamps() ([]models.RootTimestamp, error)
 	GetLastModified(string, string) (time.Time, error)
+	UpdateLastModified(string, string, time.Time) error
+
+	CheckStorage(full bool) error
+	CheckIntegrity() (Report, error)
+	FixIntegrity() (Report, error)
+	Vacuum() error
+	Optimize() error
 }
 
 // Option :
 type Option struct {
 	RedisTimeout time.Duration
+	// ReadOnly opens the DB without migrating it, and the SQLite file in the read-only mode, e.g. for the server
+	ReadOnly bool
+	// SkipMigration opens the DB without migrating it, e.g. to check the pending migrations before applying them
+	SkipMigration bool
+	// SkipSchemaCheck opens the DB of ReadOnly even of the pending migrations, which NewDB refuses otherwise by ErrSchemaOutdated,
+	// e.g. for the migrate subcommand reporting them
+	SkipSchemaCheck bool
+	// SlowQueryThreshold logs the SQL and the lookups, with the family, the release and the package, CVE or CPE looked up,
+	// taking it or longer at the info level even without debugSQL, never if 0
+	SlowQueryThreshold time.Duration
+	// QueryTimeout bounds each lookup, which returns the error matching ErrQueryTimeout beyond, not bounded if 0.
+	// MySQL also aborts the SELECT taking longer by max_execution_time of the session.
+	QueryTimeout time.Duration
+	// NoWALCheckpoint skips the checkpoint of the WAL of SQLite after each insert of the OVAL of a family and a version,
+	// which is still checkpointed on CloseDB and Optimize
+	NoWALCheckpoint bool
+	// ReadDBPath opens the DB of it read-only apart, e.g. the read replica of MySQL, for the lookups of the OVAL, and the DB of dbPath for the writes,
+	// or the one of dbPath for both if empty. ReadDBType is its type, the one of dbPath if empty.
+	ReadDBType string
+	ReadDBPath string
+}
+
+// Page is the page of the definitions of the lookups, up to Limit of them from Offset in the order of DefinitionID, all of them if Limit is 0
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// Migration is the change of the schema pending in DB, applied by MigrateDB
+type Migration struct {
+	Table       string `json:"table"`
+	Description string `json:"description"`
+	// DDL is the statements to apply it, empty if the dialect does not tell them in advance
+	DDL []string `json:"ddl,omitempty"`
+	// Alter is true for the change of the existing table, which may take long on the big one, unlike the creation of the new table
+	Alter bool `json:"alter"`
+}
+
+// MaxSamples is the maximum number of the samples of each problem in Report
+const MaxSamples = 10
+
+// the keys of Samples of Report of the problems other than the orphaned rows, which are keyed by table
+const (
+	SampleDuplicateRoots = "duplicate roots"
+	SampleStaleFetchMeta = "stale fetch meta"
+)
+
+// Report is the report of the consistency of DB, with the numbers of the orphaned rows, whose parent row is gone, by table.
+// CheckIntegrity also reports the other problems, with up to MaxSamples of each of them to look into.
+type Report struct {
+	Orphans map[string]int64 `json:"orphans"`
+	// DuplicateRoots is the number of the pairs of family and OS version stored in more than one root
+	DuplicateRoots int64 `json:"duplicateRoots"`
+	// StaleFetchMeta is the number of the cache validators in FetchMeta of the OS versions with no root, which skip downloading the missing OVAL
+	StaleFetchMeta int64 `json:"staleFetchMeta"`
+	// Samples are the IDs of the orphaned rows by table, the family and OS version of the duplicate roots, and the URLs of the stale cache validators
+	Samples map[string][]string `json:"samples,omitempty"`
+}
+
+// Total returns the number of the problems found: the orphaned rows of all the tables, the duplicate roots and the stale cache validators
+func (r Report) Total() int64 {
+	n := r.DuplicateRoots + r.StaleFetchMeta
+	for _, c := range r.Orphans {
+		n += c
+	}
+	return n
+}
+
+// ErrCorrupted is returned by CheckStorage for the DB found corrupted, e.g. the SQLite file by the full disk, to be restored from the backup or rebuilt
+var ErrCorrupted = xerrors.New("database is corrupted")
+
+// ErrSchemaOutdated is returned by NewDB opening the DB read-only, e.g. for the server and select, of the pending migrations,
+// which the migrate subcommand applies
+var ErrSchemaOutdated = xerrors.New("schema of DB is outdated")
+
+// ErrNoSuchRelease is matched by the error of the lookup finding nothing of the release whose OVAL is not fetched into DB,
+// told from the release fetched and affected by nothing looked up, whose lookup returns nothing without error
+var ErrNoSuchRelease = xerrors.New("release not fetched")
+
+// NoSuchReleaseError is the error of the lookup of the release not fetched, matching ErrNoSuchRelease, with the releases of the family fetched
+type NoSuchReleaseError struct {
+	Family  string
+	Release string
+	// Fetched is the releases of Family in DB, sorted
+	Fetched []string
+}
+
+func (e *NoSuchReleaseError) Error() string {
+	if len(e.Fetched) == 0 {
+		return fmt.Sprintf("%s: %s %s is not in DB, fetch it first. No releases of %s in DB", ErrNoSuchRelease, e.Family, e.Release, e.Family)
+	}
+	return fmt.Sprintf("%s: %s %s is not in DB, fetch it first. Releases of %s in DB: %s", ErrNoSuchRelease, e.Family, e.Release, e.Family, strings.Join(e.Fetched, ", "))
+}
+
+// Is reports the error is ErrNoSuchRelease, e.g. for xerrors.Is(err, ErrNoSuchRelease)
+func (e *NoSuchReleaseError) Is(target error) bool {
+	return target == ErrNoSuchRelease
 }
 
+// checkRelease returns *NoSuchReleaseError if the OVAL of family and osVer is not in roots, e.g. of GetRootTimestamps, or nil if it is
+func checkRelease(roots []models.RootTimestamp, family, osVer string) error {
+	normalized, key, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return nil
+	}
+	fetched := []string{}
+	for _, r := range roots {
+		if r.Family != normalized {
+			continue
+		}
+		if c.ReleaseKey(r.Family, r.OSVersion) == key {
+			return nil
+		}
+		fetched = append(fetched, r.OSVersion)
+	}
+	sort.Strings(fetched)
+	return &NoSuchReleaseError{Family: normalized, Release: osVer, Fetched: fetched}
+}
+
+// ErrNotSupported is returned for the maintenance not supported by the DB type, e.g. VACUUM of Redis
+var ErrNotSupported = xerrors.New("not supported")
+
+// ErrNoSourceFile is returned by GetSourceFile for the file not stored, e.g. fetched without --store-source or larger than --store-source-max-size
+var ErrNoSourceFile = xerrors.New("source file not stored")
+
+// ErrSourceChanged is returned by InsertOval refusing to replace the stored OVAL with the one of another source file without --allow-source-change,
+// e.g. RedHat 7 of rhel-7.oval.xml.bz2 with the one of the file including the unpatched definitions, which is likely loaded by mistake
+var ErrSourceChanged = xerrors.New("source changed")
+
+// checkSourceChange returns the change of the source of the OVAL of family and osVer from oldSource of oldDefs definitions stored to root,
+// nil if either is unknown or they are the same. The change is refused with the error matching ErrSourceChanged without --allow-source-change,
+// and warned otherwise.
+func checkSourceChange(logger log15.Logger, allow bool, family, osVer, oldSource string, oldDefs int, root *models.Root) (*models.SourceChange, error) {
+	if oldSource == "" || root.Source == "" || oldSource == root.Source {
+		return nil, nil
+	}
+	change := &models.SourceChange{From: oldSource, To: root.Source, FromDefinitions: oldDefs, ToDefinitions: len(root.Definitions)}
+	if !allow {
+		return nil, xerrors.Errorf("Failed to refresh OVAL. err: refuse to replace %d definitions of %s with %d definitions of %s, use --allow-source-change to override. family: %s, osVer: %s, err: %w",
+			change.FromDefinitions, change.From, change.ToDefinitions, change.To, family, osVer, ErrSourceChanged)
+	}
+	logger.Warn("Replacing the OVAL loaded from another source file, as allowed by --allow-source-change", "From", change.From, "To", change.To, "FromDefinitions", change.FromDefinitions, "ToDefinitions", change.ToDefinitions)
+	return change, nil
+}
+
+// ErrUnknownFamily is returned for the OS family not supported, e.g. by the lookups of the server, which is the one of config.NormalizeFamily
+var ErrUnknownFamily = c.ErrUnknownFamily
+
 // NewDB return DB accessor.
 func NewDB(dbType, dbPath string, debugSQL bool, option Option) (driver DB, err error) {
+	if option.ReadDBPath != "" {
+		return newReplicaDB(dbType, dbPath, debugSQL, option)
+	}
 	if driver, err = newDB(dbType); err != nil {
 		return driver, xerrors.Errorf("Failed to new db. err: %w", err)
 	}
+	driver = errorDB{DB: driver, queryTimeout: option.QueryTimeout, slowThreshold: option.SlowQueryThreshold}
 
 	if err := driver.OpenDB(dbType, dbPath, debugSQL, option); err != nil {
 		return nil, xerrors.Errorf("Failed to open db. err: %w", err)
@@ -48,15 +243,52 @@ func NewDB(dbType, dbPath string, debugSQL bool, option Option) (driver DB, err
 		return nil, xerrors.Errorf("Failed to IsGovalDictModelV1. err: %w", err)
 	}
 	if isV1 {
-		return nil, xerrors.New("Failed to NewDB. Since SchemaVersion is incompatible, delete Database and fetch again.")
+		return nil, &Error{Err: xerrors.New("Failed to NewDB. Since SchemaVersion is incompatible, delete Database and fetch again.")}
 	}
 
+	if option.ReadOnly && !option.SkipSchemaCheck {
+		if err := checkSchema(driver); err != nil {
+			_ = driver.CloseDB()
+			return nil, err
+		}
+	}
+	if option.ReadOnly || option.SkipMigration {
+		return driver, nil
+	}
 	if err := driver.MigrateDB(); err != nil {
 		return driver, xerrors.Errorf("Failed to migrate db. err: %w", err)
 	}
 	return driver, nil
 }
 
+// checkSchema returns the error matching ErrSchemaOutdated for the DB opened without migrating it of the pending migrations,
+// telling the found and the latest schema versions and the first migration, e.g. of the column of the newer binary, so that the queries
+// do not fail deep in gorm by "no such column: packages.arch" but the operator is told to migrate it. The columns, the tables and
+// the indexes are probed themselves, as the schema version is not bumped by the additive migrations, even of the legacy DB.
+func checkSchema(driver DB) error {
+	pending, err := driver.PendingMigrations()
+	if err != nil {
+		return xerrors.Errorf("Failed to get pending migrations. err: %w", err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	found := "none"
+	if !slices.ContainsFunc(pending, func(m Migration) bool { return m.Table == "fetch_metas" && !m.Alter }) {
+		if fetchMeta, err := driver.GetFetchMeta(); err == nil {
+			found = fmt.Sprint(fetchMeta.SchemaVersion)
+		}
+	}
+	return &Error{Err: xerrors.Errorf("Failed to open DB. The schema of DB is older than the binary expects: %d migrations are pending, e.g. %s. Schema version: %s (latest: %d). Apply them by `goval-dictionary migrate --apply` first. err: %w",
+		len(pending), pending[0].Description, found, models.LatestSchemaVersion, ErrSchemaOutdated)}
+}
+
+// Types returns the supported types of DB, the choices of --dbtype
+func Types() []string {
+	return []string{dialectSqlite3, dialectMysql, dialectPostgreSQL, dialectRedis}
+}
+
 func newDB(dbType string) (DB, error) {
 	switch dbType {
 	case dialectSqlite3, dialectMysql, dialectPostgreSQL:
@@ -67,66 +299,55 @@ func newDB(dbType string) (DB, error) {
 	return nil, xerrors.Errorf("Invalid database dialect. dbType: %s", dbType)
 }
 
-func formatFamilyAndOSVer(family, osVer string) (string, string, error) {
-	switch family {
-	case c.Debian:
-		osVer = major(osVer)
-	case c.Ubuntu:
-		osVer = majorDotMinor(osVer)
-	case c.Raspbian:
-		family = c.Debian
-		osVer = major(osVer)
-	case c.RedHat:
-		osVer = major(osVer)
-	case c.CentOS:
-		family = c.RedHat
-		osVer = major(osVer)
-	case c.Oracle:
-		osVer = major(osVer)
-	case c.Amazon:
-		osVer = getAmazonLinuxVer(osVer)
-	case c.Alpine:
-		osVer = majorDotMinor(osVer)
-	case c.Fedora:
-		osVer = major(osVer)
-	case c.OpenSUSE:
-		if osVer != "tumbleweed" {
-			osVer = majorDotMinor(osVer)
-		}
-	case c.OpenSUSELeap, c.SUSEEnterpriseDesktop, c.SUSEEnterpriseServer:
-		osVer = majorDotMinor(osVer)
-	default:
-		return "", "", xerrors.Errorf("Failed to detect family. err: unknown os family(%s)", family)
+// uniqueDefinitions returns the definitions without the duplicates of DefinitionID, where the first one wins
+func uniqueDefinitions(defs []models.Definition) []models.Definition {
+	seen := make(map[string]struct{}, len(defs))
+	uniq := make([]models.Definition, 0, len(defs))
+	for _, d := range defs {
+		if _, ok := seen[d.DefinitionID]; ok {
+			continue
+		}
+		seen[d.DefinitionID] = struct{}{}
+		uniq = append(uniq, d)
 	}
-
-	return family, osVer, nil
+	return uniq
 }
 
-func major(osVer string) (majorVersion string) {
-	return strings.Split(osVer, ".")[0]
+// countChange counts def into stat as new if not stored, or as updated or unchanged by the content hash of the stored one
+func countChange(stat *models.ChangeStat, def models.Definition, storedHash string, stored bool) {
+	switch {
+	case !stored:
+		stat.New++
+		stat.NewIDs = append(stat.NewIDs, def.DefinitionID)
+	case def.ContentHash() == storedHash:
+		stat.Unchanged++
+	default:
+		stat.Updated++
+	}
 }
 
-func majorDotMinor(osVer string) (majorMinorVersion string) {
-	ss := strings.Split(osVer, ".")
-	if len(ss) < 3 {
-		return osVer
-	}
-	return strings.Join(ss[:2], ".")
+// FormatFamilyAndOSVer returns the family and the OS version of the OVAL stored for the ones looked up, e.g. debian 12 of raspbian 12.1,
+// where the family is normalized by config.NormalizeFamily, e.g. redhat of "Red Hat" and of centos
+func FormatFamilyAndOSVer(family, osVer string) (string, string, error) {
+	return formatFamilyAndOSVer(family, osVer)
 }
 
-// getAmazonLinuxVer returns AmazonLinux 1, 2, 2022, 2023
-func getAmazonLinuxVer(osVersion string) string {
-	ss := strings.Fields(osVersion)
-	if ss[0] == "2023" {
-		return "2023"
-	}
-	if ss[0] == "2022" {
-		return "2022"
+func formatFamilyAndOSVer(family, osVer string) (string, string, error) {
+	normalized, err := c.NormalizeFamily(family)
+	if err != nil {
+		return "", "", xerrors.Errorf("Failed to detect family. family: %s, err: %w", family, ErrUnknownFamily)
 	}
-	if ss[0] == "2" {
-		return "2"
+	family = normalized
+	// the OVAL of Raspbian is the one of Debian
+	if family == c.Raspbian {
+		family = c.Debian
 	}
-	return "1"
+	return family, c.ReleaseKey(family, osVer), nil
+}
+
+// familyLogger returns the logger of ctx tagging every line with the family and the OS version of the OVAL being written
+func familyLogger(ctx context.Context, family, osVer string) log15.Logger {
+	return log.FromContext(log.NewContext(ctx, log.Fields{"Family": family, "Version": osVer}))
 }
 
 // IndexChunk has a starting point and an ending point for Chunk
@@ -134,6 +355,15 @@ type IndexChunk struct {
 	From, To int
 }
 
+// startProgressBar starts the progress bar of count to stderr, or to nowhere with --quiet or --log-to-stderr=false of the Conf of ctx
+func startProgressBar(ctx context.Context, count int) *pb.ProgressBar {
+	bar := pb.New(count)
+	if conf := c.FromContext(ctx); conf.Quiet || !conf.LogToStderr {
+		bar.SetWriter(io.Discard)
+	}
+	return bar.Start()
+}
+
 func chunkSlice(length int, chunkSize int) <-chan IndexChunk {
 	ch := make(chan IndexChunk)
 
@@ -152,8 +382,143 @@ func chunkSlice(length int, chunkSize int) <-chan IndexChunk {
 	return ch
 }
 
+// groupByPackName returns defs by the names of their affected packages in packNames, with an empty slice for the package affected by none,
+// filtering the affected packages of each of them after grouped, as GetByPackName selects the definition by any of its packages
+func groupByPackName(defs []models.Definition, packNames []string, filter func([]models.Package) []models.Package) map[string][]models.Definition {
+	m := make(map[string][]models.Definition, len(packNames))
+	for _, name := range packNames {
+		m[name] = []models.Definition{}
+	}
+	for _, def := range defs {
+		names := make([]string, 0, len(def.AffectedPacks))
+		for _, p := range def.AffectedPacks {
+			if _, ok := m[p.Name]; ok && !slices.Contains(names, p.Name) {
+				names = append(names, p.Name)
+			}
+		}
+		def.AffectedPacks = filter(def.AffectedPacks)
+		for _, name := range names {
+			m[name] = append(m[name], def)
+		}
+	}
+	return m
+}
+
+// sortDefinitions sorts defs in definitionOrder of RDB, the latest issued advisory first and then by DefinitionID, for the DB types
+// selecting them in no order, e.g. of the members of the sets of Redis
+func sortDefinitions(defs []models.Definition) {
+	sort.SliceStable(defs, func(i, j int) bool {
+		if a, b := defs[i].Advisory.Issued, defs[j].Advisory.Issued; !a.Equal(b) {
+			return a.After(b)
+		}
+		return defs[i].DefinitionID < defs[j].DefinitionID
+	})
+}
+
+// pageOf returns the page of defs sorted by DefinitionID, for the DB types selecting all of them, with the number of them
+func pageOf(defs []models.Definition, page Page) ([]models.Definition, int64) {
+	sort.SliceStable(defs, func(i, j int) bool { return defs[i].DefinitionID < defs[j].DefinitionID })
+	total := int64(len(defs))
+	if page.Offset >= len(defs) {
+		return []models.Definition{}, total
+	}
+	defs = defs[page.Offset:]
+	if page.Limit > 0 && page.Limit < len(defs) {
+		defs = defs[:page.Limit]
+	}
+	return defs, total
+}
+
+// advisoryRevisionPattern matches the advisory ID with its revision, of which the first submatch is the ID without it,
+// e.g. DSA-3981-1, ELSA-2017-0933-1 and SUSE-SU-2021:0857-1
+var advisoryRevisionPattern = regexp.MustCompile(`^(DSA-\d+|ELSA-\d{4}-\d+|[A-Z]*SUSE-[A-Z]+-\d{4}:\d+)-\d+$`)
+
+// matchAdvisoryID reports whether the stored advisory ID is advisoryID case-insensitively or of one of its revisions,
+// e.g. DSA-3981-1 of DSA-3981
+func matchAdvisoryID(stored, advisoryID string) bool {
+	if advisoryID == "" {
+		return false
+	}
+	stored, advisoryID = strings.ToUpper(stored), strings.ToUpper(advisoryID)
+	if stored == advisoryID {
+		return true
+	}
+	m := advisoryRevisionPattern.FindStringSubmatch(stored)
+	return m != nil && m[1] == advisoryID
+}
+
+// packageNames returns the distinct names of packs, sorted
+func packageNames(packs []models.Package) []string {
+	seen := map[string]struct{}{}
+	names := []string{}
+	for _, p := range packs {
+		if _, ok := seen[p.Name]; ok {
+			continue
+		}
+		seen[p.Name] = struct{}{}
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// toPackInfos flattens the definitions into PackInfo of packName, sorted by DefinitionID, CveID and FixedVersion
+func toPackInfos(defs []models.Definition, packName string) []models.PackInfo {
+	infos := []models.PackInfo{}
+	seen := map[models.PackInfo]struct{}{}
+	for _, d := range defs {
+		cveIDs := []string{}
+		for _, cve := range d.Advisory.Cves {
+			cveIDs = append(cveIDs, cve.CveID)
+		}
+		if len(cveIDs) == 0 {
+			cveIDs = append(cveIDs, "")
+		}
+
+		for _, p := range d.AffectedPacks {
+			if p.Name != packName {
+				continue
+			}
+			for _, cveID := range cveIDs {
+				info := models.PackInfo{
+					CveID:        cveID,
+					DefinitionID: d.DefinitionID,
+					AdvisoryID:   d.Advisory.AdvisoryID,
+					FixedVersion: p.Version,
+					NotFixedYet:  p.NotFixedYet,
+					Severity:     d.Advisory.Severity,
+				}
+				if _, ok := seen[info]; ok {
+					continue
+				}
+				seen[info] = struct{}{}
+				infos = append(infos, info)
+			}
+		}
+	}
+	sortPackInfos(infos)
+	return infos
+}
+
+func sortPackInfos(infos []models.PackInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].DefinitionID != infos[j].DefinitionID {
+			return infos[i].DefinitionID < infos[j].DefinitionID
+		}
+		if infos[i].CveID != infos[j].CveID {
+			return infos[i].CveID < infos[j].CveID
+		}
+		return infos[i].FixedVersion < infos[j].FixedVersion
+	})
+}
+
 func filterByRedHatMajor(packs []models.Package, majorVer string) (filtered []models.Package) {
 	for _, p := range packs {
+		// packages of unpatched definitions have no version to tell the major version
+		if p.NotFixedYet && p.Version == "" {
+			filtered = append(filtered, p)
+			continue
+		}
 		if strings.Contains(p.Version, ".el"+majorVer) ||
 			strings.Contains(p.Version, ".module+el"+majorVer) {
 			filtered = append(filtered, p)
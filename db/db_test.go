@@ -228,6 +228,16 @@ func Test_formatFamilyAndOSVer(t *testing.T) {
 				osVer:  "tumbleweed",
 			},
 		},
+		{
+			in: args{
+				family: "openSUSE Tumbleweed",
+				osVer:  "20231015",
+			},
+			expected: args{
+				family: config.OpenSUSE,
+				osVer:  "tumbleweed",
+			},
+		},
 		{
 			in: args{
 				family: config.OpenSUSELeap,
@@ -268,12 +278,52 @@ func Test_formatFamilyAndOSVer(t *testing.T) {
 				osVer:  "35",
 			},
 		},
+		{
+			in: args{
+				family: config.SUSEEnterpriseServer,
+				osVer:  "12-SP1",
+			},
+			expected: args{
+				family: config.SUSEEnterpriseServer,
+				osVer:  "12.1",
+			},
+		},
+		{
+			in: args{
+				family: config.Amazon,
+				osVer:  "2017.09",
+			},
+			expected: args{
+				family: config.Amazon,
+				osVer:  "1",
+			},
+		},
+		{
+			in: args{
+				family: config.Amazon,
+				osVer:  "2023.1.20230719",
+			},
+			expected: args{
+				family: config.Amazon,
+				osVer:  "2023",
+			},
+		},
+		{
+			in: args{
+				family: config.OpenSUSE,
+				osVer:  "42.3",
+			},
+			expected: args{
+				family: config.OpenSUSE,
+				osVer:  "42.3",
+			},
+		},
 		{
 			in: args{
 				family: "unknown",
 				osVer:  "unknown",
 			},
-			wantErr: "Failed to detect family. err: unknown os family(unknown)",
+			wantErr: "Failed to detect family. family: unknown, err: unknown os family",
 		},
 	}
 	for i, tt := range tests {
@@ -373,6 +423,27 @@ func Test_filterByRedHatMajor(t *testing.T) {
 				},
 			},
 		},
+		{
+			in: args{
+				packs: []models.Package{
+					{
+						Name:    "name-el7",
+						Version: "0:0.0.1-0.0.1.el7",
+					},
+					{
+						Name:        "name-unpatched",
+						NotFixedYet: true,
+					},
+				},
+				majorVer: "8",
+			},
+			expected: []models.Package{
+				{
+					Name:        "name-unpatched",
+					NotFixedYet: true,
+				},
+			},
+		},
 	}
 
 	for i, tt := range tests {
@@ -381,3 +452,27 @@ func Test_filterByRedHatMajor(t *testing.T) {
 		}
 	}
 }
+
+func Test_collapseRepeats(t *testing.T) {
+	packs := []models.Package{
+		{Name: "openssl", Version: "1:1.1.1k-9.el8_7"},
+		{Name: "openssl", Version: "1:1.1.1k-7.el8_6"},
+	}
+	def := func(id string, packs []models.Package) models.Definition {
+		return models.Definition{DefinitionID: id, AffectedPacks: packs}
+	}
+	// as Redis returns them, repeated for the keys of x86_64, aarch64 and i686 of openssl, without the IDs
+	defs := []models.Definition{
+		def("oval:com.oracle.elsa:def:20233349", packs), def("oval:com.oracle.elsa:def:20233349", packs), def("oval:com.oracle.elsa:def:20233349", packs),
+		def("oval:com.oracle.elsa:def:20230333", packs[:1]), def("oval:com.oracle.elsa:def:20230333", packs[:1]),
+		def("oval:com.oracle.elsa:def:20230001", nil),
+	}
+	var ids []string
+	for _, d := range collapseRepeats(defs, "openssl") {
+		ids = append(ids, d.DefinitionID)
+	}
+	want := []string{"oval:com.oracle.elsa:def:20233349", "oval:com.oracle.elsa:def:20233349", "oval:com.oracle.elsa:def:20230333", "oval:com.oracle.elsa:def:20230001"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected: %q, actual: %q", want, ids)
+	}
+}
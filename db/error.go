@@ -0,0 +1,484 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/log"
+	"github.com/vulsio/goval-dictionary/metrics"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// Error is the error of the operation of DB, e.g. connecting, migrating, querying or inserting,
+// to be told from the errors of the fetches, e.g. for the exit code
+type Error struct {
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// InsertError is the error of inserting a batch of the definitions of an OVAL, telling the family, the OS version and the definitions of the batch
+// instead of dumping them, which are hundreds of MB for the OVAL of the big family
+type InsertError struct {
+	Family    string
+	OSVersion string
+	// What is of the rows failed, e.g. definitions or affected packages
+	What string
+	// DefinitionID and Title are of the definition failed, or of the first one of the batch if Count is more than 1
+	DefinitionID string
+	Title        string
+	// LastDefinitionID is of the last one of the batch if Count is more than 1
+	LastDefinitionID string
+	Count            int
+	Err              error
+}
+
+// maxInsertErrorTitle is the length the title of InsertError is truncated to
+const maxInsertErrorTitle = 80
+
+// maxInsertErrorDump is the size of the batch dumped by --debug on the error of inserting it, truncated beyond
+const maxInsertErrorDump = 4 * 1024
+
+// newInsertError returns the error of inserting batch, logging the batch as JSON of maxInsertErrorDump bytes at most by --debug of the Conf of ctx
+func newInsertError(ctx context.Context, family, osVer, what string, batch []models.Definition, err error) *InsertError {
+	e := &InsertError{Family: family, OSVersion: osVer, What: what, Count: len(batch), Err: err}
+	if len(batch) > 0 {
+		e.DefinitionID, e.Title = batch[0].DefinitionID, truncate(batch[0].Title, maxInsertErrorTitle)
+		e.LastDefinitionID = batch[len(batch)-1].DefinitionID
+	}
+	if c.FromContext(ctx).Debug {
+		familyLogger(ctx, family, osVer).Debug("The batch failed to insert", "Dump", dumpDefinitions(batch, maxInsertErrorDump))
+	}
+	return e
+}
+
+func (e *InsertError) Error() string {
+	if e.Count > 1 {
+		return fmt.Sprintf("Failed to insert %s. family: %s, osVer: %s, definitions: %s to %s (%d), err: %s", e.What, e.Family, e.OSVersion, e.DefinitionID, e.LastDefinitionID, e.Count, e.Err)
+	}
+	return fmt.Sprintf("Failed to insert %s. family: %s, osVer: %s, definition: %s %q, err: %s", e.What, e.Family, e.OSVersion, e.DefinitionID, e.Title, e.Err)
+}
+
+func (e *InsertError) Unwrap() error {
+	return e.Err
+}
+
+// dumpDefinitions returns defs in JSON truncated to n bytes
+func dumpDefinitions(defs []models.Definition, n int) string {
+	bs, err := json.Marshal(defs)
+	if err != nil {
+		return fmt.Sprintf("Failed to marshal json. err: %s", err)
+	}
+	return truncate(string(bs), n)
+}
+
+// truncate returns s cut to n bytes at most at the boundary of the runes with the number of the bytes cut, e.g. "abc... (10 bytes truncated)"
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return fmt.Sprintf("%s... (%d bytes truncated)", s[:n], len(s)-n)
+}
+
+// wrapError returns err as *Error, except nil and the errors of the usage, e.g. the unknown family, the release not fetched,
+// the maintenance not supported by the DB type or the source file not stored
+func wrapError(err error) error {
+	if err == nil || xerrors.Is(err, ErrUnknownFamily) || xerrors.Is(err, ErrNoSuchRelease) || xerrors.Is(err, ErrNotSupported) || xerrors.Is(err, ErrNoSourceFile) {
+		return err
+	}
+	var e *Error
+	if xerrors.As(err, &e) {
+		return err
+	}
+	return &Error{Err: err}
+}
+
+// Queries counts the lookups of DB by the method, e.g. GetByPackName, and the failed ones as e.g. GetByPackNameErrors, published as db.queries by expvar
+var Queries = expvar.NewMap("db.queries")
+
+var (
+	queryDuration = metrics.Default.NewHistogram("goval_dictionary_db_query_duration_seconds", "The durations of the lookups of DB by the method.", metrics.DefaultBuckets, "method")
+	queryErrors   = metrics.Default.NewCounter("goval_dictionary_db_query_errors_total", "The failed lookups of DB by the method.", "method")
+)
+
+// countQuery counts the lookup of method started at start in Queries and the metrics, failed if err is not nil
+func countQuery(method string, start time.Time, err error) {
+	queryDuration.Observe(time.Since(start).Seconds(), method)
+	Queries.Add(method, 1)
+	if err != nil {
+		Queries.Add(method+"Errors", 1)
+		queryErrors.Inc(method)
+	}
+}
+
+// lookup runs fn, the lookup of method with ctx bounded by the query timeout of d, counting it in Queries and logging it with params,
+// e.g. the family and the package, if it takes the slow threshold of d or longer. The deadline is watched apart from fn, which may not
+// return on it, e.g. of SQLite waiting for the lock by busy_timeout, not interrupted by ctx, in which case fn is left to return
+// in the background and its result is dropped. The lookup timed out returns the error matching ErrQueryTimeout.
+func lookup[T any](ctx context.Context, d errorDB, method string, params []interface{}, fn func(context.Context) (T, error)) (T, error) {
+	start := time.Now()
+	if d.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.queryTimeout)
+		defer cancel()
+	}
+
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := fn(ctx)
+		done <- result{v: v, err: err}
+	}()
+	var r result
+	select {
+	case r = <-done:
+	case <-ctx.Done():
+		// the lookup returned at the same time is taken rather than dropped
+		select {
+		case r = <-done:
+		default:
+			r.err = xerrors.Errorf("Failed to %s. err: %w", method, ctx.Err())
+		}
+	}
+	r.err = timeoutError(ctx, r.err)
+
+	countQuery(method, start, r.err)
+	if elapsed := time.Since(start); d.slowThreshold > 0 && elapsed >= d.slowThreshold {
+		logCtx := append([]interface{}{"Method", method}, params...)
+		logCtx = append(logCtx, "Elapsed", elapsed, "Threshold", d.slowThreshold)
+		if r.err != nil {
+			logCtx = append(logCtx, "err", r.err)
+		}
+		log.FromContext(ctx).Info("Slow lookup", logCtx...)
+	}
+	return r.v, r.err
+}
+
+// ErrQueryTimeout is matched by the error of the lookup timed out, by Option.QueryTimeout or by the deadline of its context,
+// e.g. of the request of the server, which matches context.DeadlineExceeded as well
+var ErrQueryTimeout = xerrors.New("query timed out")
+
+// errMySQLQueryTimeout is the error number of MySQL of the statement aborted by max_execution_time, ER_QUERY_TIMEOUT
+const errMySQLQueryTimeout = 3024
+
+// QueryTimeoutError is the error of the lookup timed out, matching ErrQueryTimeout and context.DeadlineExceeded
+type QueryTimeoutError struct {
+	Err error
+}
+
+func (e *QueryTimeoutError) Error() string {
+	return fmt.Sprintf("%s. err: %s", ErrQueryTimeout, e.Err)
+}
+
+func (e *QueryTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrQueryTimeout or context.DeadlineExceeded, e.g. for the server to respond 503 for either
+func (e *QueryTimeoutError) Is(target error) bool {
+	return target == ErrQueryTimeout || target == context.DeadlineExceeded
+}
+
+// timeoutError returns err of the lookup with ctx as *QueryTimeoutError if it timed out: ctx past its deadline, e.g. of SQLite interrupted,
+// or MySQL aborting it by max_execution_time, and err as is otherwise
+func timeoutError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var mysqlErr *mysqldriver.MySQLError
+	if xerrors.Is(ctx.Err(), context.DeadlineExceeded) || xerrors.As(err, &mysqlErr) && mysqlErr.Number == errMySQLQueryTimeout {
+		return &QueryTimeoutError{Err: err}
+	}
+	return err
+}
+
+// errorDB is the DB returning the errors of every operation as *Error, counting the lookups in Queries
+type errorDB struct {
+	DB
+	// queryTimeout bounds each lookup, not bounded if 0
+	queryTimeout time.Duration
+	// slowThreshold logs the lookup taking it or longer, never if 0
+	slowThreshold time.Duration
+}
+
+func (d errorDB) OpenDB(dbType, dbPath string, debugSQL bool, option Option) error {
+	return wrapError(d.DB.OpenDB(dbType, dbPath, debugSQL, option))
+}
+
+func (d errorDB) CloseDB() error {
+	return wrapError(d.DB.CloseDB())
+}
+
+func (d errorDB) Ping() error {
+	return wrapError(d.DB.Ping())
+}
+
+func (d errorDB) MigrateDB() error {
+	return wrapError(d.DB.MigrateDB())
+}
+
+func (d errorDB) PendingMigrations() ([]Migration, error) {
+	ms, err := d.DB.PendingMigrations()
+	return ms, wrapError(err)
+}
+
+func (d errorDB) IsGovalDictModelV1() (bool, error) {
+	isV1, err := d.DB.IsGovalDictModelV1()
+	return isV1, wrapError(err)
+}
+
+func (d errorDB) GetFetchMeta() (*models.FetchMeta, error) {
+	fetchMeta, err := d.DB.GetFetchMeta()
+	return fetchMeta, wrapError(err)
+}
+
+func (d errorDB) UpsertFetchMeta(fetchMeta *models.FetchMeta) error {
+	return wrapError(d.DB.UpsertFetchMeta(fetchMeta))
+}
+
+func (d errorDB) StoreSourceFile(file *models.FetchFile) error {
+	return wrapError(d.DB.StoreSourceFile(file))
+}
+
+func (d errorDB) TouchSourceFile(fileName string, fetchedAt time.Time) error {
+	return wrapError(d.DB.TouchSourceFile(fileName, fetchedAt))
+}
+
+func (d errorDB) GetSourceFile(fileName string) ([]byte, error) {
+	bs, err := d.DB.GetSourceFile(fileName)
+	return bs, wrapError(err)
+}
+
+func (d errorDB) GetFetchHistory(ctx context.Context, family, osVer string, since time.Time) ([]models.FetchHistory, error) {
+	hs, err := lookup(ctx, d, "GetFetchHistory", []interface{}{"Family", family, "Release", osVer}, func(ctx context.Context) ([]models.FetchHistory, error) {
+		return d.DB.GetFetchHistory(ctx, family, osVer, since)
+	})
+	return hs, wrapError(err)
+}
+
+func (d errorDB) PruneSourceFiles(before time.Time) (int64, error) {
+	n, err := d.DB.PruneSourceFiles(before)
+	return n, wrapError(err)
+}
+
+func (d errorDB) GetByPackName(ctx context.Context, family, osVer, packName, arch string, classes ...string) ([]models.Definition, error) {
+	defs, err := lookup(ctx, d, "GetByPackName", []interface{}{"Family", family, "Release", osVer, "Package", packName}, func(ctx context.Context) ([]models.Definition, error) {
+		return d.DB.GetByPackName(ctx, family, osVer, packName, arch, classes...)
+	})
+	if err == nil && len(defs) == 0 {
+		err = d.noSuchRelease(family, osVer)
+	}
+	return defs, wrapError(err)
+}
+
+func (d errorDB) GetByPackNames(ctx context.Context, family, osVer string, packNames []string, arch string, classes ...string) (map[string][]models.Definition, error) {
+	defs, err := lookup(ctx, d, "GetByPackNames", []interface{}{"Family", family, "Release", osVer, "Packages", len(packNames)}, func(ctx context.Context) (map[string][]models.Definition, error) {
+		return d.DB.GetByPackNames(ctx, family, osVer, packNames, arch, classes...)
+	})
+	if err == nil && noDefinitions(defs) {
+		err = d.noSuchRelease(family, osVer)
+	}
+	return defs, wrapError(err)
+}
+
+// definitionsPage is the page of the definitions and the total of the lookup of the page
+type definitionsPage struct {
+	defs  []models.Definition
+	total int64
+}
+
+func (d errorDB) GetByPackNamePage(ctx context.Context, family, osVer, packName, arch string, page Page, classes ...string) ([]models.Definition, int64, error) {
+	p, err := lookup(ctx, d, "GetByPackNamePage", []interface{}{"Family", family, "Release", osVer, "Package", packName}, func(ctx context.Context) (definitionsPage, error) {
+		defs, total, err := d.DB.GetByPackNamePage(ctx, family, osVer, packName, arch, page, classes...)
+		return definitionsPage{defs: defs, total: total}, err
+	})
+	if err == nil && p.total == 0 {
+		err = d.noSuchRelease(family, osVer)
+	}
+	return p.defs, p.total, wrapError(err)
+}
+
+func (d errorDB) GetByCveIDPage(ctx context.Context, family, osVer, cveID, arch string, page Page) ([]models.Definition, int64, error) {
+	p, err := lookup(ctx, d, "GetByCveIDPage", []interface{}{"Family", family, "Release", osVer, "CVE", cveID}, func(ctx context.Context) (definitionsPage, error) {
+		defs, total, err := d.DB.GetByCveIDPage(ctx, family, osVer, cveID, arch, page)
+		return definitionsPage{defs: defs, total: total}, err
+	})
+	if err == nil && p.total == 0 {
+		err = d.noSuchRelease(family, osVer)
+	}
+	return p.defs, p.total, wrapError(err)
+}
+
+func (d errorDB) GetByCveID(ctx context.Context, family, osVer, cveID, arch string) ([]models.Definition, error) {
+	defs, err := lookup(ctx, d, "GetByCveID", []interface{}{"Family", family, "Release", osVer, "CVE", cveID}, func(ctx context.Context) ([]models.Definition, error) {
+		return d.DB.GetByCveID(ctx, family, osVer, cveID, arch)
+	})
+	if err == nil && len(defs) == 0 {
+		err = d.noSuchRelease(family, osVer)
+	}
+	return defs, wrapError(err)
+}
+
+func (d errorDB) GetByAdvisoryID(ctx context.Context, family, osVer, advisoryID, arch string) ([]models.Definition, error) {
+	defs, err := lookup(ctx, d, "GetByAdvisoryID", []interface{}{"Family", family, "Release", osVer, "Advisory", advisoryID}, func(ctx context.Context) ([]models.Definition, error) {
+		return d.DB.GetByAdvisoryID(ctx, family, osVer, advisoryID, arch)
+	})
+	if err == nil && len(defs) == 0 {
+		err = d.noSuchRelease(family, osVer)
+	}
+	return defs, wrapError(err)
+}
+
+func (d errorDB) GetByCpe(ctx context.Context, family, osVer, cpe, arch string) ([]models.Definition, error) {
+	defs, err := lookup(ctx, d, "GetByCpe", []interface{}{"Family", family, "Release", osVer, "CPE", cpe, "arch", arch}, func(ctx context.Context) ([]models.Definition, error) {
+		return d.DB.GetByCpe(ctx, family, osVer, cpe, arch)
+	})
+	if err == nil && len(defs) == 0 {
+		err = d.noSuchRelease(family, osVer)
+	}
+	return defs, wrapError(err)
+}
+
+func (d errorDB) GetPackInfo(ctx context.Context, family, osVer, packName string) ([]models.PackInfo, error) {
+	infos, err := lookup(ctx, d, "GetPackInfo", []interface{}{"Family", family, "Release", osVer, "Package", packName}, func(ctx context.Context) ([]models.PackInfo, error) {
+		return d.DB.GetPackInfo(ctx, family, osVer, packName)
+	})
+	if err == nil && len(infos) == 0 {
+		err = d.noSuchRelease(family, osVer)
+	}
+	return infos, wrapError(err)
+}
+
+func (d errorDB) ListPackages(ctx context.Context, family, osVer string) ([]string, error) {
+	names, err := lookup(ctx, d, "ListPackages", []interface{}{"Family", family, "Release", osVer}, func(ctx context.Context) ([]string, error) {
+		return d.DB.ListPackages(ctx, family, osVer)
+	})
+	if err == nil && len(names) == 0 {
+		err = d.noSuchRelease(family, osVer)
+	}
+	return names, wrapError(err)
+}
+
+// noSuchRelease returns *NoSuchReleaseError for the lookup of family and osVer finding nothing if the release is not fetched,
+// checked by the roots only, or nil if it is fetched, or if the roots fail to get, leaving nothing found as it is
+func (d errorDB) noSuchRelease(family, osVer string) error {
+	roots, err := d.DB.GetRootTimestamps()
+	if err != nil {
+		log15.Debug("Failed to get the timestamps of OVAL to check the release", "Family", family, "Release", osVer, "err", err)
+		return nil
+	}
+	return checkRelease(roots, family, osVer)
+}
+
+// noDefinitions reports whether defs of GetByPackNames has no definitions of any package
+func noDefinitions(defs map[string][]models.Definition) bool {
+	for _, ds := range defs {
+		if len(ds) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (d errorDB) InsertOval(ctx context.Context, root *models.Root) (models.ChangeStat, error) {
+	stat, err := d.DB.InsertOval(ctx, root)
+	return stat, wrapError(err)
+}
+
+func (d errorDB) MergeOval(ctx context.Context, root *models.Root) (models.ChangeStat, error) {
+	stat, err := d.DB.MergeOval(ctx, root)
+	return stat, wrapError(err)
+}
+
+func (d errorDB) PurgeOval(ctx context.Context, family, osVer string) (models.RootStat, error) {
+	stat, err := d.DB.PurgeOval(ctx, family, osVer)
+	return stat, wrapError(err)
+}
+
+func (d errorDB) CountDefs(family, osVer string) (int, error) {
+	start := time.Now()
+	n, err := d.DB.CountDefs(family, osVer)
+	countQuery("CountDefs", start, err)
+	return n, wrapError(err)
+}
+
+// IterateDefinitions returns the error of fn as is, e.g. of writing the export file, which is not of DB
+func (d errorDB) IterateDefinitions(ctx context.Context, family, osVer string, fn func(models.Definition) error) error {
+	var fnErr error
+	err := d.DB.IterateDefinitions(ctx, family, osVer, func(def models.Definition) error {
+		fnErr = fn(def)
+		return fnErr
+	})
+	if err != nil && fnErr != nil {
+		return err
+	}
+	return wrapError(err)
+}
+
+func (d errorDB) GetRootStats() ([]models.RootStat, error) {
+	start := time.Now()
+	stats, err := d.DB.GetRootStats()
+	countQuery("GetRootStats", start, err)
+	return stats, wrapError(err)
+}
+
+func (d errorDB) GetRootTimestamps() ([]models.RootTimestamp, error) {
+	start := time.Now()
+	ts, err := d.DB.GetRootTimestamps()
+	countQuery("GetRootTimestamps", start, err)
+	return ts, wrapError(err)
+}
+
+func (d errorDB) GetLastModified(family, osVer string) (time.Time, error) {
+	start := time.Now()
+	t, err := d.DB.GetLastModified(family, osVer)
+	countQuery("GetLastModified", start, err)
+	return t, wrapError(err)
+}
+
+func (d errorDB) UpdateLastModified(family, osVer string, t time.Time) error {
+	return wrapError(d.DB.UpdateLastModified(family, osVer, t))
+}
+
+func (d errorDB) CheckStorage(full bool) error {
+	return wrapError(d.DB.CheckStorage(full))
+}
+
+func (d errorDB) CheckIntegrity() (Report, error) {
+	report, err := d.DB.CheckIntegrity()
+	return report, wrapError(err)
+}
+
+func (d errorDB) FixIntegrity() (Report, error) {
+	report, err := d.DB.FixIntegrity()
+	return report, wrapError(err)
+}
+
+func (d errorDB) Vacuum() error {
+	return wrapError(d.DB.Vacuum())
+}
+
+func (d errorDB) Optimize() error {
+	return wrapError(d.DB.Optimize())
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+func TestLookupQueryTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oval.sqlite3")
+	// busy_timeout keeps the lookup waiting for the lock held below far beyond the query timeout, not interrupted by the context
+	d, err := NewDB(dialectSqlite3, path+"?_pragma=busy_timeout(10000)", false, Option{QueryTimeout: 100 * time.Millisecond, SlowQueryThreshold: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	t.Cleanup(func() { _ = d.CloseDB() })
+
+	other, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open. err: %s", err)
+	}
+	defer other.Close()
+	conn, err := other.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get the connection. err: %s", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(context.Background(), "BEGIN EXCLUSIVE"); err != nil {
+		t.Fatalf("Failed to lock. err: %s", err)
+	}
+	defer func() { _, _ = conn.ExecContext(context.Background(), "ROLLBACK") }()
+
+	var records []*log15.Record
+	h := log15.Root().GetHandler()
+	log15.Root().SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	defer log15.Root().SetHandler(h)
+
+	start := time.Now()
+	_, err = d.GetByPackName(context.Background(), "redhat", "8", "kernel", "")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected: timed out in 100ms, actual: %s", elapsed)
+	}
+	if !xerrors.Is(err, ErrQueryTimeout) || !xerrors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected: ErrQueryTimeout and context.DeadlineExceeded, actual: %v", err)
+	}
+
+	if len(records) != 1 || records[0].Msg != "Slow lookup" {
+		t.Fatalf("expected: Slow lookup, actual: %v", records)
+	}
+	ctx := map[interface{}]interface{}{}
+	for i := 0; i+1 < len(records[0].Ctx); i += 2 {
+		ctx[records[0].Ctx[i]] = records[0].Ctx[i+1]
+	}
+	for k, v := range map[string]string{"Method": "GetByPackName", "Family": "redhat", "Release": "8", "Package": "kernel"} {
+		if ctx[k] != v {
+			t.Errorf("%s expected: %q, actual: %v", k, v, ctx[k])
+		}
+	}
+	if ctx["err"] == nil {
+		t.Errorf("expected: err, actual: %v", records[0].Ctx)
+	}
+}
+
+func TestLookupNotTimedOut(t *testing.T) {
+	d, err := NewDB(dialectSqlite3, filepath.Join(t.TempDir(), "oval.sqlite3"), false, Option{QueryTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	t.Cleanup(func() { _ = d.CloseDB() })
+
+	// nothing is fetched into the empty DB, which is not timed out
+	if _, err := d.GetByPackName(context.Background(), "redhat", "8", "kernel", ""); !xerrors.Is(err, ErrNoSuchRelease) {
+		t.Errorf("expected: ErrNoSuchRelease, actual: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.GetByPackName(ctx, "redhat", "8", "kernel", ""); !xerrors.Is(err, context.Canceled) || xerrors.Is(err, ErrQueryTimeout) {
+		t.Errorf("expected: context.Canceled, not ErrQueryTimeout, actual: %v", err)
+	}
+}
+
+func TestLookupNoSuchRelease(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	d, err := NewDB(dialectSqlite3, filepath.Join(t.TempDir(), "oval.sqlite3"), false, Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	t.Cleanup(func() { _ = d.CloseDB() })
+	if _, err := d.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	tests := []struct {
+		name      string
+		family    string
+		osVer     string
+		pack      string
+		wantDefs  int
+		wantError string
+	}{
+		{name: "not fetched", family: "redhat", osVer: "8", pack: "kernel", wantError: "release not fetched: redhat 8 is not in DB, fetch it first. Releases of redhat in DB: 7"},
+		{name: "no family fetched", family: "debian", osVer: "12", pack: "kernel", wantError: "release not fetched: debian 12 is not in DB, fetch it first. No releases of debian in DB"},
+		{name: "fetched without findings", family: "redhat", osVer: "7", pack: "bash"},
+		{name: "fetched with findings", family: "redhat", osVer: "7.9", pack: "kernel", wantDefs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs, err := d.GetByPackName(context.Background(), tt.family, tt.osVer, tt.pack, "")
+			if tt.wantError == "" {
+				if err != nil || len(defs) != tt.wantDefs {
+					t.Errorf("expected: %d definitions, actual: %d, err: %v", tt.wantDefs, len(defs), err)
+				}
+				return
+			}
+			if !xerrors.Is(err, ErrNoSuchRelease) || err.Error() != tt.wantError || len(defs) != 0 {
+				t.Errorf("expected: %s, actual: %v, %d definitions", tt.wantError, err, len(defs))
+			}
+			// the lookups finding nothing of the release not fetched fail the same
+			if _, err := d.ListPackages(context.Background(), tt.family, tt.osVer); !xerrors.Is(err, ErrNoSuchRelease) {
+				t.Errorf("expected: ErrNoSuchRelease of ListPackages, actual: %v", err)
+			}
+			if _, err := d.GetByPackNames(context.Background(), tt.family, tt.osVer, []string{tt.pack}, ""); !xerrors.Is(err, ErrNoSuchRelease) {
+				t.Errorf("expected: ErrNoSuchRelease of GetByPackNames, actual: %v", err)
+			}
+		})
+	}
+}
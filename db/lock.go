@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+)
+
+// ErrLocked is the error of the lock held by another process beyond the lock timeout
+var ErrLocked = xerrors.New("locked by another process")
+
+// lockPollInterval is the interval of retrying the lock held by another process
+const lockPollInterval = 500 * time.Millisecond
+
+// FileLock is the advisory lock of the sqlite3 DB, the lock file next to the DB of the PID and the hostname of the holder
+type FileLock struct {
+	path string
+}
+
+// LockPath returns the path of the lock file of the sqlite3 DB at dbPath
+func LockPath(dbPath string) string {
+	return dbPath + ".lock"
+}
+
+// Lock creates the lock file at path, waiting up to timeout for the other process to remove it, or fails at once if timeout is 0.
+// The lock file left by a dead process of this host, e.g. killed by SIGKILL, is taken over as stale by takeOverStaleLock.
+func Lock(ctx context.Context, path string, timeout time.Duration) (*FileLock, error) {
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		err := createLockFile(path)
+		if err == nil {
+			return &FileLock{path: path}, nil
+		}
+		if !xerrors.Is(err, fs.ErrExist) {
+			return nil, xerrors.Errorf("Failed to create lock file. path: %s, err: %w", path, err)
+		}
+
+		holder, stale := readLockFile(path)
+		if stale {
+			if err := takeOverStaleLock(path, holder); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, xerrors.Errorf("Failed to lock %s held by %s within %s. err: %w", path, holder, timeout, ErrLocked)
+		}
+		if !waiting {
+			log15.Info("Waiting for the lock held by another process", "Path", path, "Holder", holder, "Timeout", timeout)
+			waiting = true
+		}
+		if wait > lockPollInterval {
+			wait = lockPollInterval
+		}
+		select {
+		case <-ctx.Done():
+			return nil, xerrors.Errorf("Failed to lock %s. err: %w", path, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Unlock removes the lock file
+func (l *FileLock) Unlock() error {
+	if err := os.Remove(l.path); err != nil && !xerrors.Is(err, fs.ErrNotExist) {
+		return xerrors.Errorf("Failed to remove lock file. path: %s, err: %w", l.path, err)
+	}
+	return nil
+}
+
+// takeOverStaleLock removes the stale lock file at path of holder for the retry of createLockFile. The lock file is renamed to the unique path
+// first, so that only one of the processes finding it stale moves it, and verified stale there again, as it may be the new one of another
+// process taking it over meanwhile, which is linked back to path then. Removing path after the check could remove the new one instead.
+func takeOverStaleLock(path, holder string) error {
+	stalePath := fmt.Sprintf("%s.stale.%d.%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, stalePath); err != nil {
+		if xerrors.Is(err, fs.ErrNotExist) {
+			// taken over by another process
+			return nil
+		}
+		return xerrors.Errorf("Failed to move stale lock file. path: %s, err: %w", path, err)
+	}
+	if _, stale := readLockFile(stalePath); !stale {
+		if err := os.Link(stalePath, path); err != nil {
+			return xerrors.Errorf("Failed to restore lock file of another process moved as stale. path: %s, err: %w", path, err)
+		}
+		if err := os.Remove(stalePath); err != nil {
+			return xerrors.Errorf("Failed to remove lock file moved. path: %s, err: %w", stalePath, err)
+		}
+		return nil
+	}
+	log15.Warn("Removing the stale lock file of the dead process", "Path", path, "Holder", holder)
+	if err := os.Remove(stalePath); err != nil {
+		return xerrors.Errorf("Failed to remove stale lock file. path: %s, err: %w", stalePath, err)
+	}
+	return nil
+}
+
+// createLockFile creates the lock file of the PID and the hostname, failing with fs.ErrExist if held by another
+func createLockFile(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	if _, err := fmt.Fprintf(f, "%d\n%s\n", os.Getpid(), hostname); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// readLockFile returns the holder of the lock file, and whether it is stale, i.e. the holder is a dead process of this host.
+// The lock file being written, or of another host, is not stale.
+func readLockFile(path string) (holder string, stale bool) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return "unknown", false
+	}
+	pidStr, hostname, _ := strings.Cut(strings.TrimSpace(string(bs)), "\n")
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return "unknown", false
+	}
+	holder = fmt.Sprintf("PID %d on %s", pid, hostname)
+	if h, _ := os.Hostname(); h != hostname {
+		return holder, false
+	}
+	return holder, !processAlive(pid)
+}
+
+// processAlive returns whether the process of pid is running, or may be, e.g. of another user, or on Windows
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	defer p.Release()
+	return !xerrors.Is(p.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
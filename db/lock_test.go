@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestLock(t *testing.T) {
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		name    string
+		held    string // the content of the lock file of the other process
+		release time.Duration
+		timeout time.Duration
+		wantErr error
+	}{
+		{
+			name:    "unlocked",
+			timeout: 0,
+		},
+		{
+			name:    "held without timeout",
+			held:    fmt.Sprintf("%d\n%s\n", os.Getpid(), hostname),
+			timeout: 0,
+			wantErr: ErrLocked,
+		},
+		{
+			name:    "held beyond timeout",
+			held:    fmt.Sprintf("%d\n%s\n", os.Getpid(), hostname),
+			timeout: 200 * time.Millisecond,
+			wantErr: ErrLocked,
+		},
+		{
+			name:    "released within timeout",
+			held:    fmt.Sprintf("%d\n%s\n", os.Getpid(), hostname),
+			release: 100 * time.Millisecond,
+			timeout: 5 * time.Second,
+		},
+		{
+			name:    "held by dead process",
+			held:    fmt.Sprintf("%d\n%s\n", math.MaxInt32, hostname),
+			timeout: 0,
+		},
+		{
+			name:    "held by process of another host",
+			held:    fmt.Sprintf("%d\n%s\n", math.MaxInt32, "another-"+hostname),
+			timeout: 0,
+			wantErr: ErrLocked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := LockPath(filepath.Join(t.TempDir(), "oval.sqlite3"))
+			if tt.held != "" {
+				if err := os.WriteFile(path, []byte(tt.held), 0644); err != nil {
+					t.Fatalf("Failed to write lock file. err: %s", err)
+				}
+			}
+			if tt.release > 0 {
+				time.AfterFunc(tt.release, func() { _ = os.Remove(path) })
+			}
+
+			start := time.Now()
+			lock, err := Lock(context.Background(), path, tt.timeout)
+			if !xerrors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error: %v, actual: %v", tt.wantErr, err)
+			}
+			if err != nil {
+				if elapsed := time.Since(start); elapsed < tt.timeout {
+					t.Errorf("expected to wait for %s, actual: %s", tt.timeout, elapsed)
+				}
+				return
+			}
+
+			bs, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read lock file. err: %s", err)
+			}
+			if want := fmt.Sprintf("%d\n%s\n", os.Getpid(), hostname); string(bs) != want {
+				t.Errorf("expected: %q, actual: %q", want, bs)
+			}
+			if err := lock.Unlock(); err != nil {
+				t.Fatalf("Failed to Unlock. err: %s", err)
+			}
+			if _, err := os.Stat(path); !xerrors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected the lock file removed, actual: %v", err)
+			}
+		})
+	}
+}
+
+func TestLockConcurrent(t *testing.T) {
+	path := LockPath(filepath.Join(t.TempDir(), "oval.sqlite3"))
+
+	first, err := Lock(context.Background(), path, 0)
+	if err != nil {
+		t.Fatalf("Failed to Lock. err: %s", err)
+	}
+
+	// the second waits for the first, and fails at once on cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, err := Lock(ctx, path, time.Minute); !xerrors.Is(err, context.Canceled) {
+		t.Fatalf("expected error: %v, actual: %v", context.Canceled, err)
+	}
+
+	// and acquires the lock once the first releases it
+	done := make(chan error, 1)
+	go func() {
+		second, err := Lock(context.Background(), path, 5*time.Second)
+		if err == nil {
+			err = second.Unlock()
+		}
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("expected to wait for the first, actual: %v", err)
+	default:
+	}
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("Failed to Unlock. err: %s", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Failed to Lock after Unlock. err: %s", err)
+	}
+}
+
+func TestLockStaleConcurrent(t *testing.T) {
+	hostname, _ := os.Hostname()
+
+	// the processes finding the same stale lock file take it over once, and only one of them holds the lock
+	for i := 0; i < 20; i++ {
+		path := LockPath(filepath.Join(t.TempDir(), "oval.sqlite3"))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("%d\n%s\n", math.MaxInt32, hostname)), 0644); err != nil {
+			t.Fatalf("Failed to write lock file. err: %s", err)
+		}
+
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			locks []*FileLock
+		)
+		start := make(chan struct{})
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				lock, err := Lock(context.Background(), path, 0)
+				if err != nil {
+					if !xerrors.Is(err, ErrLocked) {
+						t.Errorf("expected error: %v, actual: %v", ErrLocked, err)
+					}
+					return
+				}
+				mu.Lock()
+				locks = append(locks, lock)
+				mu.Unlock()
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if len(locks) != 1 {
+			t.Fatalf("expected: 1 holder of the lock, actual: %d", len(locks))
+		}
+		if err := locks[0].Unlock(); err != nil {
+			t.Fatalf("Failed to Unlock. err: %s", err)
+		}
+		if matches, _ := filepath.Glob(path + "*"); len(matches) != 0 {
+			t.Errorf("expected: no lock file left, actual: %q", matches)
+		}
+	}
+}
+
+func TestTakeOverStaleLock(t *testing.T) {
+	hostname, _ := os.Hostname()
+
+	// the lock file of the live process, taken over by another process after found stale, is restored
+	path := LockPath(filepath.Join(t.TempDir(), "oval.sqlite3"))
+	held := fmt.Sprintf("%d\n%s\n", os.Getpid(), hostname)
+	if err := os.WriteFile(path, []byte(held), 0644); err != nil {
+		t.Fatalf("Failed to write lock file. err: %s", err)
+	}
+	if err := takeOverStaleLock(path, "PID 0 on "+hostname); err != nil {
+		t.Fatalf("Failed to takeOverStaleLock. err: %s", err)
+	}
+	if bs, err := os.ReadFile(path); err != nil || string(bs) != held {
+		t.Errorf("expected: the lock file %q restored, actual: %q, err: %v", held, bs, err)
+	}
+	if matches, _ := filepath.Glob(path + ".stale.*"); len(matches) != 0 {
+		t.Errorf("expected: no lock file moved left, actual: %q", matches)
+	}
+
+	// the one removed already by another process is left to the retry
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove lock file. err: %s", err)
+	}
+	if err := takeOverStaleLock(path, "PID 0 on "+hostname); err != nil {
+		t.Errorf("expected: no error, actual: %s", err)
+	}
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// Omit is the children of the definitions the lookups do not load, e.g. for the caller needing only the advisories and their CVEs
+// of the definitions affecting thousands of packages, such as texlive of SUSE. All of them are loaded by default.
+type Omit struct {
+	Packages   bool
+	References bool
+}
+
+// ParseOmit returns Omit of the comma-separated children, "packages" and "references", e.g. of ?omit= of the server
+func ParseOmit(s string) (Omit, error) {
+	var omit Omit
+	for _, name := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "packages":
+			omit.Packages = true
+		case "references":
+			omit.References = true
+		default:
+			return Omit{}, xerrors.Errorf("invalid omit: %s, expected packages or references", name)
+		}
+	}
+	return omit, nil
+}
+
+// String returns the comma-separated children of omit, as ParseOmit accepts
+func (o Omit) String() string {
+	names := []string{}
+	if o.Packages {
+		names = append(names, "packages")
+	}
+	if o.References {
+		names = append(names, "references")
+	}
+	return strings.Join(names, ",")
+}
+
+type omitKey struct{}
+
+// WithOmit returns ctx whose lookups do not load the children of omit, leaving them nil in the definitions,
+// which RDB skips the preloads of and Redis drops after decoding the definitions, as it stores each in a JSON
+func WithOmit(ctx context.Context, omit Omit) context.Context {
+	return context.WithValue(ctx, omitKey{}, omit)
+}
+
+func omitFrom(ctx context.Context) Omit {
+	if ctx == nil {
+		return Omit{}
+	}
+	omit, _ := ctx.Value(omitKey{}).(Omit)
+	return omit
+}
+
+// apply drops the children of omit from def
+func (o Omit) apply(def *models.Definition) {
+	if o.Packages {
+		def.AffectedPacks = nil
+	}
+	if o.References {
+		def.References = nil
+	}
+}
@@ -1,18 +1,22 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"os"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/cheggaaa/pb/v3"
 	"github.com/glebarez/sqlite"
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/inconshreveable/log15"
-	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
 	"golang.org/x/xerrors"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
@@ -35,6 +39,9 @@ const (
 type RDBDriver struct {
 	name string
 	conn *gorm.DB
+	// readOnly and noWALCheckpoint are of Option of OpenDB
+	readOnly        bool
+	noWALCheckpoint bool
 }
 
 // https://github.com/mattn/go-sqlite3/blob/edc3bb69551dcfff02651f083b21f3366ea2f5ab/error.go#L18-L66
@@ -46,10 +53,27 @@ type sqliteError struct {
 
 // result codes from http://www.sqlite.org/c3ref/c_abort.html
 var (
-	errBusy   = errNo(5) /* The database file is locked */
-	errLocked = errNo(6) /* A table in the database is locked */
+	errBusy    = errNo(5)  /* The database file is locked */
+	errLocked  = errNo(6)  /* A table in the database is locked */
+	errCorrupt = errNo(11) /* The database disk image is malformed */
+	errNotADB  = errNo(26) /* File opened that is not a database file */
 )
 
+// isSqliteCorrupt reports whether err is of SQLite finding the DB file malformed or not a DB at all, e.g. truncated
+func isSqliteCorrupt(err error) bool {
+	var se interface{ Code() int }
+	if !xerrors.As(err, &se) {
+		return false
+	}
+	// the extended result codes have the primary one in the lower 8 bits
+	switch errNo(se.Code() & 0xff) {
+	case errCorrupt, errNotADB:
+		return true
+	default:
+		return false
+	}
+}
+
 // ErrDBLocked :
 var ErrDBLocked = xerrors.New("database is locked")
 
@@ -59,31 +83,19 @@ func (r *RDBDriver) Name() string {
 }
 
 // OpenDB opens Database
-func (r *RDBDriver) OpenDB(dbType, dbPath string, debugSQL bool, _ Option) (err error) {
+func (r *RDBDriver) OpenDB(dbType, dbPath string, debugSQL bool, option Option) (err error) {
 	gormConfig := gorm.Config{
 		DisableForeignKeyConstraintWhenMigrating: true,
-		Logger: logger.New(
-			log.New(os.Stderr, "\r\n", log.LstdFlags),
-			logger.Config{
-				LogLevel: logger.Silent,
-			},
-		),
-	}
-
-	if debugSQL {
-		gormConfig.Logger = logger.New(
-			log.New(os.Stderr, "\r\n", log.LstdFlags),
-			logger.Config{
-				SlowThreshold: time.Second,
-				LogLevel:      logger.Info,
-				Colorful:      true,
-			},
-		)
+		Logger:                                   newSQLLogger(debugSQL, option.SlowQueryThreshold),
 	}
 
 	switch r.name {
 	case dialectSqlite3:
-		r.conn, err = gorm.Open(sqlite.Open(dbPath), &gormConfig)
+		dsn := dbPath
+		if option.ReadOnly {
+			dsn = sqliteReadOnlyDSN(dbPath)
+		}
+		r.conn, err = gorm.Open(sqlite.Open(dsn), &gormConfig)
 		if err != nil {
 			parsedErr, marshalErr := json.Marshal(err)
 			if marshalErr != nil {
@@ -97,22 +109,28 @@ func (r *RDBDriver) OpenDB(dbType, dbPath string, debugSQL bool, _ Option) (err
 
 			switch errMsg.Code {
 			case errBusy, errLocked:
-				return xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dbType, dbPath, ErrDBLocked)
+				return xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dbType, c.RedactDSN(dbType, dbPath), ErrDBLocked)
 			default:
-				return xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dbType, dbPath, err)
+				return xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dbType, c.RedactDSN(dbType, dbPath), err)
 			}
 		}
 
 		r.conn.Exec("PRAGMA foreign_keys = ON")
+		r.readOnly, r.noWALCheckpoint = option.ReadOnly, option.NoWALCheckpoint
 	case dialectMysql:
-		r.conn, err = gorm.Open(mysql.Open(dbPath), &gormConfig)
+		r.conn, err = gorm.Open(mysql.Open(mysqlDSN(dbPath, option.QueryTimeout)), &gormConfig)
+		var mysqlErr *mysqldriver.MySQLError
+		if option.QueryTimeout > 0 && xerrors.As(err, &mysqlErr) && mysqlErr.Number == errMySQLUnknownSystemVariable {
+			log15.Warn("max_execution_time is not supported, e.g. by MariaDB, and the lookups are bounded by QueryTimeout alone", "err", err)
+			r.conn, err = gorm.Open(mysql.Open(dbPath), &gormConfig)
+		}
 		if err != nil {
-			return xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dbType, dbPath, err)
+			return xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dbType, c.RedactDSN(dbType, dbPath), err)
 		}
 	case dialectPostgreSQL:
 		r.conn, err = gorm.Open(postgres.Open(dbPath), &gormConfig)
 		if err != nil {
-			return xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dbType, dbPath, err)
+			return xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dbType, c.RedactDSN(dbType, dbPath), err)
 		}
 	default:
 		return xerrors.Errorf("Not Supported DB dialects. r.name: %s", r.name)
@@ -120,20 +138,58 @@ func (r *RDBDriver) OpenDB(dbType, dbPath string, debugSQL bool, _ Option) (err
 	return nil
 }
 
+// errMySQLUnknownSystemVariable is the error number of MySQL of setting the system variable not supported, ER_UNKNOWN_SYSTEM_VARIABLE
+const errMySQLUnknownSystemVariable = 1193
+
+// mysqlDSN returns dbPath with max_execution_time of timeout in milliseconds for MySQL to abort the SELECT taking longer by itself,
+// and dbPath as is if timeout is 0, max_execution_time is given in it already or it is malformed, which fails to open anyway
+func mysqlDSN(dbPath string, timeout time.Duration) string {
+	if timeout <= 0 {
+		return dbPath
+	}
+	cfg, err := mysqldriver.ParseDSN(dbPath)
+	if err != nil {
+		return dbPath
+	}
+	if _, ok := cfg.Params["max_execution_time"]; ok {
+		return dbPath
+	}
+	if cfg.Params == nil {
+		cfg.Params = map[string]string{}
+	}
+	cfg.Params["max_execution_time"] = strconv.FormatInt(timeout.Milliseconds(), 10)
+	return cfg.FormatDSN()
+}
+
+// sqliteReadOnlyDSN returns the URI filename of dbPath opened in the read-only mode, which fails if the file does not exist
+func sqliteReadOnlyDSN(dbPath string) string {
+	if strings.HasPrefix(dbPath, "file:") {
+		if strings.Contains(dbPath, "?") {
+			return dbPath + "&mode=ro"
+		}
+		return dbPath + "?mode=ro"
+	}
+	return "file:" + (&url.URL{Path: dbPath}).EscapedPath() + "?mode=ro"
+}
+
+// Ping verifies the connection to DB is alive, e.g. for /health of the server
+func (r *RDBDriver) Ping() error {
+	if r.conn == nil {
+		return xerrors.New("Failed to ping DB. err: not opened")
+	}
+	sqlDB, err := r.conn.DB()
+	if err != nil {
+		return xerrors.Errorf("Failed to get DB Object. err: %w", err)
+	}
+	if err := sqlDB.Ping(); err != nil {
+		return xerrors.Errorf("Failed to ping DB. Type: %s. err: %w", r.name, err)
+	}
+	return nil
+}
+
 // MigrateDB migrates Database
 func (r *RDBDriver) MigrateDB() error {
-	if err := r.conn.AutoMigrate(
-		&models.FetchMeta{},
-		&models.Root{},
-		&models.Definition{},
-		&models.Package{},
-		&models.Reference{},
-		&models.Advisory{},
-		&models.Cve{},
-		&models.Bugzilla{},
-		&models.Cpe{},
-		&models.Debian{},
-	); err != nil {
+	if err := r.conn.AutoMigrate(migrationModels()...); err != nil {
 		switch r.name {
 		case dialectSqlite3:
 			if r.name == dialectSqlite3 {
@@ -163,14 +219,138 @@ func (r *RDBDriver) MigrateDB() error {
 		}
 	}
 
+	if err := r.backfillReleaseKeys(); err != nil {
+		return xerrors.Errorf("Failed to migrate. err: %w", err)
+	}
+	return nil
+}
+
+// backfillReleaseKeys sets the release key of the roots stored without it, i.e. before the column or by the older binary,
+// by config.ReleaseKey of their family and OS version as the insert does
+func (r *RDBDriver) backfillReleaseKeys() error {
+	type release struct {
+		Family    string
+		OSVersion string
+	}
+	releases := []release{}
+	if err := r.conn.Model(&models.Root{}).Distinct("family", "os_version").Where("release_key = ? OR release_key IS NULL", "").Scan(&releases).Error; err != nil {
+		return xerrors.Errorf("Failed to select roots without release key. err: %w", err)
+	}
+	for _, rel := range releases {
+		if err := r.conn.Model(&models.Root{}).
+			Where("family = ? AND os_version = ? AND (release_key = ? OR release_key IS NULL)", rel.Family, rel.OSVersion, "").
+			Update("release_key", c.ReleaseKey(rel.Family, rel.OSVersion)).Error; err != nil {
+			return xerrors.Errorf("Failed to backfill release key. family: %s, osVer: %s, err: %w", rel.Family, rel.OSVersion, err)
+		}
+	}
 	return nil
 }
 
+// migrationModels returns the models of the tables migrated by MigrateDB, in the order of creation
+func migrationModels() []interface{} {
+	return []interface{}{
+		&models.FetchMeta{},
+		&models.FetchFile{},
+		&models.FetchHistory{},
+		&models.Root{},
+		&models.Definition{},
+		&models.Package{},
+		&models.Reference{},
+		&models.Advisory{},
+		&models.Cve{},
+		&models.Bugzilla{},
+		&models.Cpe{},
+		&models.Debian{},
+	}
+}
+
+// PendingMigrations returns the missing tables, columns and indexes which MigrateDB creates, with their DDL captured by the dry run
+func (r *RDBDriver) PendingMigrations() ([]Migration, error) {
+	migrator := r.conn.Migrator()
+	ms := []Migration{}
+	for _, model := range migrationModels() {
+		stmt := &gorm.Statement{DB: r.conn}
+		if err := stmt.Parse(model); err != nil {
+			return nil, xerrors.Errorf("Failed to parse model. err: %w", err)
+		}
+		table := stmt.Schema.Table
+
+		if !migrator.HasTable(model) {
+			ddl, err := r.captureDDL(func(m gorm.Migrator) error { return m.CreateTable(model) })
+			if err != nil {
+				return nil, xerrors.Errorf("Failed to capture DDL of table %s. err: %w", table, err)
+			}
+			ms = append(ms, Migration{Table: table, Description: fmt.Sprintf("create table %s", table), DDL: ddl})
+			continue
+		}
+
+		for _, column := range stmt.Schema.DBNames {
+			if migrator.HasColumn(model, column) {
+				continue
+			}
+			ddl, err := r.captureDDL(func(m gorm.Migrator) error { return m.AddColumn(model, column) })
+			if err != nil {
+				return nil, xerrors.Errorf("Failed to capture DDL of column %s.%s. err: %w", table, column, err)
+			}
+			ms = append(ms, Migration{Table: table, Description: fmt.Sprintf("add column %s.%s", table, column), DDL: ddl, Alter: true})
+		}
+
+		indexes := []string{}
+		for name := range stmt.Schema.ParseIndexes() {
+			indexes = append(indexes, name)
+		}
+		sort.Strings(indexes)
+		for _, index := range indexes {
+			if migrator.HasIndex(model, index) {
+				continue
+			}
+			ddl, err := r.captureDDL(func(m gorm.Migrator) error { return m.CreateIndex(model, index) })
+			if err != nil {
+				return nil, xerrors.Errorf("Failed to capture DDL of index %s. err: %w", index, err)
+			}
+			ms = append(ms, Migration{Table: table, Description: fmt.Sprintf("create index %s on %s", index, table), DDL: ddl, Alter: true})
+		}
+	}
+	return ms, nil
+}
+
+// captureDDL runs fn on the migrator of the dry run session, and returns the DDL it would have executed
+func (r *RDBDriver) captureDDL(fn func(gorm.Migrator) error) ([]string, error) {
+	rec := &ddlRecorder{Interface: logger.Discard}
+	if err := fn(r.conn.Session(&gorm.Session{DryRun: true, Logger: rec}).Migrator()); err != nil {
+		return nil, err
+	}
+	return rec.ddl, nil
+}
+
+// ddlRecorder is the logger of the dry run session, recording the statements traced instead of executed
+type ddlRecorder struct {
+	logger.Interface
+	ddl []string
+}
+
+// LogMode keeps recording whatever the level
+func (l *ddlRecorder) LogMode(logger.LogLevel) logger.Interface {
+	return l
+}
+
+// Trace records the statement
+func (l *ddlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	l.ddl = append(l.ddl, sql)
+}
+
 // CloseDB close Database
 func (r *RDBDriver) CloseDB() (err error) {
 	if r.conn == nil {
 		return
 	}
+	// the WAL is left as large as the last insert until the last connection to the file closes, e.g. of the server opening it as well
+	if r.name == dialectSqlite3 && !r.readOnly {
+		if err := r.checkpointWAL(); err != nil {
+			log15.Warn("Failed to checkpoint WAL before closing DB", "err", err)
+		}
+	}
 
 	var sqlDB *sql.DB
 	if sqlDB, err = r.conn.DB(); err != nil {
@@ -182,245 +362,1239 @@ func (r *RDBDriver) CloseDB() (err error) {
 	return
 }
 
-// GetByPackName select OVAL definition related to OS Family, osVer, packName
-func (r *RDBDriver) GetByPackName(family, osVer, packName, arch string) ([]models.Definition, error) {
+// GetByPackName select OVAL definition related to OS Family, osVer, packName, narrowed down to classes if specified
+func (r *RDBDriver) GetByPackName(ctx context.Context, family, osVer, packName, arch string, classes ...string) ([]models.Definition, error) {
 	family, osVer, err := formatFamilyAndOSVer(family, osVer)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
 	}
+	conn := r.conn.WithContext(ctx)
 
-	q := r.conn.
-		Joins("JOIN roots ON roots.id = definitions.root_id AND roots.family= ? AND roots.os_version = ?", family, osVer).
+	q := conn.
+		Model(&models.Definition{}).
+		Joins("JOIN roots ON roots.id = definitions.root_id AND roots.family= ? AND roots.release_key = ? AND roots.active = ?", family, osVer, true).
 		Joins("JOIN packages ON packages.definition_id = definitions.id").
-		Preload("Advisory").
-		Preload("Advisory.Cves").
-		Preload("Advisory.Bugzillas").
-		Preload("Advisory.AffectedCPEList").
-		Preload("References")
-
-	switch family {
-	case c.Debian:
-		q = q.Preload("Debian").Where("packages.name = ?", packName).Preload("AffectedPacks")
-	case c.Amazon, c.Oracle, c.Fedora:
-		if arch == "" {
-			q = q.Where("packages.name = ?", packName).Preload("AffectedPacks")
-		} else {
-			q = q.Where("packages.name = ? AND packages.arch = ?", packName, arch).Preload("AffectedPacks", "arch = ?", arch)
-		}
-	default:
-		q = q.Where("packages.name = ?", packName).Preload("AffectedPacks")
+		Joins("LEFT JOIN advisories ON advisories.definition_id = definitions.id").
+		Where("packages.name = ?", packName)
+	if arch != "" && (family == c.Amazon || family == c.Oracle || family == c.Fedora) {
+		q = q.Where("packages.arch = ?", arch)
+	}
+	if len(classes) > 0 {
+		q = q.Where("definitions.class IN ?", classes)
 	}
 
-	defs := []models.Definition{}
-	tmpDefs := []models.Definition{}
-	if err := q.FindInBatches(&tmpDefs, 998, func(_ *gorm.DB, _ int) error {
-		defs = append(defs, tmpDefs...)
-		return nil
-	}).Error; err != nil {
-		return nil, xerrors.Errorf("Failed to FindInBatches. family: %s, osVer: %s, packName: %s, arch: %s, err: %w", family, osVer, packName, arch, err)
+	defs, err := r.findInOrder(ctx, q, family, arch)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to find definitions. family: %s, osVer: %s, packName: %s, arch: %s, err: %w", family, osVer, packName, arch, err)
+	}
+	if arch == "" && collapseArchFrom(ctx) {
+		defs = collapseRepeats(defs, packName)
 	}
 
 	if family == c.RedHat {
 		for i := range defs {
-			defs[i].AffectedPacks = filterByRedHatMajor(defs[i].AffectedPacks, major(osVer))
+			defs[i].AffectedPacks = filterByRedHatMajor(defs[i].AffectedPacks, c.ReleaseKey(c.RedHat, osVer))
 		}
 	}
 
 	return defs, nil
 }
 
-// GetByCveID select OVAL definition related to OS Family, osVer, cveID
-func (r *RDBDriver) GetByCveID(family, osVer, cveID, arch string) ([]models.Definition, error) {
+// GetByPackNames selects the OVAL definitions of the OS family and osVer affecting each of packNames, with an empty slice for the package
+// affected by none, each in definitionOrder, in two queries of the IDs and the definitions, plus the preloads, per 998 of them
+func (r *RDBDriver) GetByPackNames(ctx context.Context, family, osVer string, packNames []string, arch string, classes ...string) (map[string][]models.Definition, error) {
 	family, osVer, err := formatFamilyAndOSVer(family, osVer)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
 	}
+	conn := r.conn.WithContext(ctx)
+	byArch := arch != "" && (family == c.Amazon || family == c.Oracle || family == c.Fedora)
+	omit := omitFrom(ctx)
 
-	q := r.conn.
-		Joins("JOIN roots ON roots.id = definitions.root_id AND roots.family= ? AND roots.os_version = ?", family, osVer).
-		Joins("JOIN advisories ON advisories.definition_id = definitions.id").
-		Joins("JOIN cves ON cves.advisory_id = advisories.id").
-		Where("cves.cve_id = ?", cveID).
-		Preload("Advisory").
-		Preload("Advisory.Cves").
-		Preload("Advisory.Bugzillas").
-		Preload("Advisory.AffectedCPEList").
-		Preload("References")
-
-	switch family {
-	case c.Debian:
-		q = q.Preload("Debian").Preload("AffectedPacks")
-	case c.Amazon, c.Oracle, c.Fedora:
-		if arch == "" {
-			q = q.Preload("AffectedPacks")
-		} else {
-			q = q.Preload("AffectedPacks", "arch = ?", arch)
+	filter := func(packs []models.Package) []models.Package { return packs }
+	switch {
+	case omit.Packages:
+		filter = func([]models.Package) []models.Package { return nil }
+	case family == c.RedHat:
+		filter = func(packs []models.Package) []models.Package {
+			return filterByRedHatMajor(packs, c.ReleaseKey(c.RedHat, osVer))
 		}
-	default:
-		q = q.Preload("AffectedPacks")
 	}
 
-	defs := []models.Definition{}
-	if err := q.Find(&defs).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, err
+	// each package is of one chunk, so that the definitions of each are in the order of its chunk
+	m := make(map[string][]models.Definition, len(packNames))
+	for idx := range chunkSlice(len(packNames), 998) {
+		names := packNames[idx.From:idx.To]
+		query := func() *gorm.DB {
+			q := conn.
+				Model(&models.Definition{}).
+				Joins("JOIN roots ON roots.id = definitions.root_id AND roots.family= ? AND roots.release_key = ? AND roots.active = ?", family, osVer, true).
+				Joins("JOIN packages ON packages.definition_id = definitions.id").
+				Joins("LEFT JOIN advisories ON advisories.definition_id = definitions.id").
+				Where("packages.name IN ?", names)
+			if byArch {
+				q = q.Where("packages.arch = ?", arch)
+			}
+			if len(classes) > 0 {
+				q = q.Where("definitions.class IN ?", classes)
+			}
+			return q
+		}
+		defs, err := r.findInOrder(ctx, query(), family, arch)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to find definitions. family: %s, osVer: %s, arch: %s, err: %w", family, osVer, arch, err)
+		}
+		// the definition of more than one of names is selected once
+		defs = slices.CompactFunc(defs, func(a, b models.Definition) bool { return a.ID == b.ID })
+		if omit.Packages {
+			// the packages are not preloaded, and the definitions are grouped by the names of their packages selected by the same joins
+			packs := []models.Package{}
+			if err := query().Select("packages.definition_id, packages.name").Scan(&packs).Error; err != nil {
+				return nil, xerrors.Errorf("Failed to select the names of the packages. family: %s, osVer: %s, err: %w", family, osVer, err)
+			}
+			byDefID := make(map[uint][]models.Package, len(defs))
+			for _, p := range packs {
+				byDefID[p.DefinitionID] = append(byDefID[p.DefinitionID], p)
+			}
+			for i := range defs {
+				defs[i].AffectedPacks = byDefID[defs[i].ID]
+			}
+		}
+		for name, defs := range groupByPackName(defs, names, filter) {
+			m[name] = defs
+		}
 	}
+	return m, nil
+}
 
-	if family == c.RedHat {
-		for i := range defs {
-			defs[i].AffectedPacks = filterByRedHatMajor(defs[i].AffectedPacks, major(osVer))
+// definitionOrder is the order of the definitions looked up, the latest issued advisory first, then by DefinitionID, and by ID of the same
+// DefinitionID, so that the responses are the same across the DB types and the runs. The definitions without the advisory are the last.
+const definitionOrder = "advisories.issued IS NULL, advisories.issued DESC, definitions.definition_id, definitions.id"
+
+// findInOrder selects the definitions of q, the query of them joined with the advisories, in definitionOrder, with their children preloaded
+// per 998 of them. The definition selected more than once by the joins, e.g. of the package of more than one version, is repeated as many times.
+func (r *RDBDriver) findInOrder(ctx context.Context, q *gorm.DB, family, arch string) ([]models.Definition, error) {
+	ids := []uint{}
+	if err := q.Order(definitionOrder).Pluck("definitions.id", &ids).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to select the IDs of the definitions. err: %w", err)
+	}
+	// the repeated IDs are adjacent, as the order ends with the ID
+	unique := slices.Compact(slices.Clone(ids))
+
+	conn := r.conn.WithContext(ctx)
+	byID := make(map[uint]models.Definition, len(unique))
+	for idx := range chunkSlice(len(unique), 998) {
+		chunk := []models.Definition{}
+		if err := preloadDefinition(conn.Where("id IN ?", unique[idx.From:idx.To]), family, arch, omitFrom(ctx)).Find(&chunk).Error; err != nil {
+			return nil, xerrors.Errorf("Failed to select the definitions. err: %w", err)
+		}
+		collapseArchOf(ctx, chunk, arch)
+		for _, d := range chunk {
+			byID[d.ID] = d
 		}
 	}
 
+	defs := make([]models.Definition, 0, len(ids))
+	for _, id := range ids {
+		defs = append(defs, byID[id])
+	}
 	return defs, nil
 }
 
-// InsertOval inserts OVAL
-func (r *RDBDriver) InsertOval(root *models.Root) error {
-	family, osVer, err := formatFamilyAndOSVer(root.Family, root.OSVersion)
+// preloadDefinition preloads the children of the definitions of family into q but the ones of omit, each in the order of ID, i.e. as they are in OVAL,
+// with the affected packages of arch only if given for Amazon Linux, Oracle Linux and Fedora
+func preloadDefinition(q *gorm.DB, family, arch string, omit Omit) *gorm.DB {
+	byID := func(db *gorm.DB) *gorm.DB { return db.Order("id") }
+	q = q.
+		Preload("Advisory").
+		Preload("Advisory.Cves", byID).
+		Preload("Advisory.Bugzillas", byID).
+		Preload("Advisory.AffectedCPEList", byID)
+	if !omit.References {
+		q = q.Preload("References", byID)
+	}
+	if family == c.Debian {
+		q = q.Preload("Debian")
+	}
+	switch {
+	case omit.Packages:
+	case family == c.Amazon || family == c.Oracle || family == c.Fedora:
+		if arch == "" {
+			q = q.Preload("AffectedPacks", byID)
+		} else {
+			q = q.Preload("AffectedPacks", func(db *gorm.DB) *gorm.DB { return db.Where("arch = ?", arch).Order("id") })
+		}
+	default:
+		q = q.Preload("AffectedPacks", byID)
+	}
+	return q
+}
+
+// GetByPackNamePage selects the page of the OVAL definitions of the OS family and osVer affecting packName ordered by DefinitionID,
+// with the number of all of them
+func (r *RDBDriver) GetByPackNamePage(ctx context.Context, family, osVer, packName, arch string, page Page, classes ...string) ([]models.Definition, int64, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
 	if err != nil {
-		return xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+		return nil, 0, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
 	}
-	log15.Info("Refreshing...", "Family", family, "Version", osVer)
+	conn := r.conn.WithContext(ctx)
 
-	batchSize := viper.GetInt("batch-size")
-	if batchSize < 1 {
-		return fmt.Errorf("Failed to set batch-size. err: batch-size option is not set properly")
+	ids := conn.Model(&models.Package{}).Select("definition_id").Where("name = ?", packName)
+	if arch != "" && (family == c.Amazon || family == c.Oracle || family == c.Fedora) {
+		ids = ids.Where("arch = ?", arch)
+	}
+	defs, total, err := r.findPage(ctx, family, osVer, arch, ids, page, classes)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("Failed to find page. family: %s, osVer: %s, packName: %s, arch: %s, err: %w", family, osVer, packName, arch, err)
 	}
+	return defs, total, nil
+}
 
-	tx := r.conn.Begin()
-	old := models.Root{}
-	result := tx.Where(&models.Root{Family: family, OSVersion: osVer}).First(&old)
-	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		tx.Rollback()
-		return xerrors.Errorf("Failed to select old defs: %w", result.Error)
+// GetByCveIDPage selects the page of the OVAL definitions of the OS family and osVer of cveID ordered by DefinitionID,
+// with the number of all of them
+func (r *RDBDriver) GetByCveIDPage(ctx context.Context, family, osVer, cveID, arch string, page Page) ([]models.Definition, int64, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
 	}
+	conn := r.conn.WithContext(ctx)
 
-	if result.RowsAffected > 0 {
-		log15.Info("Deleting old Definitions...")
-		// Delete data related to root passed in arg
-		defs := []models.Definition{}
-		if err := tx.Model(&old).Association("Definitions").Find(&defs); err != nil {
-			tx.Rollback()
-			return xerrors.Errorf("Failed to select old defs: %w", err)
-		}
+	ids := conn.Model(&models.Advisory{}).
+		Select("advisories.definition_id").
+		Joins("JOIN cves ON cves.advisory_id = advisories.id").
+		Where("cves.cve_id = ?", cveID)
+	defs, total, err := r.findPage(ctx, family, osVer, arch, ids, page, nil)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("Failed to find page. family: %s, osVer: %s, cveID: %s, arch: %s, err: %w", family, osVer, cveID, arch, err)
+	}
+	return defs, total, nil
+}
 
-		bar := pb.StartNew(len(defs))
-		for idx := range chunkSlice(len(defs), 998) {
-			var advs []models.Advisory
-			if err := tx.Model(defs[idx.From:idx.To]).Association("Advisory").Find(&advs); err != nil {
-				tx.Rollback()
-				return xerrors.Errorf("Failed to delete: %w", err)
-			}
+// findPage selects the page of the definitions of the family and osVer in the subquery of their IDs and of classes if any, with LIMIT and OFFSET
+// in the order of DefinitionID, which is stable across the fetches unlike the ID, and counts all of them unless the page is all
+func (r *RDBDriver) findPage(ctx context.Context, family, osVer, arch string, ids *gorm.DB, page Page, classes []string) ([]models.Definition, int64, error) {
+	conn := r.conn.WithContext(ctx)
+	where := func() *gorm.DB {
+		q := conn.
+			Model(&models.Definition{}).
+			Joins("JOIN roots ON roots.id = definitions.root_id AND roots.family= ? AND roots.release_key = ? AND roots.active = ?", family, osVer, true).
+			Where("definitions.id IN (?)", ids)
+		if len(classes) > 0 {
+			q = q.Where("definitions.class IN ?", classes)
+		}
+		return q
+	}
 
-			for idx2 := range chunkSlice(len(advs), 998) {
-				if err := tx.Select(clause.Associations).Unscoped().Delete(advs[idx2.From:idx2.To]).Error; err != nil {
-					tx.Rollback()
-					return xerrors.Errorf("Failed to delete: %w", err)
-				}
-			}
+	q := preloadDefinition(where().Order("definitions.definition_id, definitions.id"), family, arch, omitFrom(ctx))
+	// OFFSET needs LIMIT in SQLite and MySQL
+	switch {
+	case page.Limit > 0:
+		q = q.Limit(page.Limit).Offset(page.Offset)
+	case page.Offset > 0:
+		q = q.Limit(math.MaxInt32).Offset(page.Offset)
+	}
 
-			if err := tx.Select(clause.Associations).Unscoped().Delete(defs[idx.From:idx.To]).Error; err != nil {
-				tx.Rollback()
-				return xerrors.Errorf("Failed to delete: %w", err)
-			}
-			bar.Add(idx.To - idx.From)
-		}
-		if err := tx.Unscoped().Where("id = ?", old.ID).Delete(&models.Root{}).Error; err != nil {
-			tx.Rollback()
-			return xerrors.Errorf("Failed to delete: %w", err)
+	defs := []models.Definition{}
+	if err := q.Find(&defs).Error; err != nil {
+		return nil, 0, xerrors.Errorf("Failed to select definitions. err: %w", err)
+	}
+	collapseArchOf(ctx, defs, arch)
+	if family == c.RedHat {
+		for i := range defs {
+			defs[i].AffectedPacks = filterByRedHatMajor(defs[i].AffectedPacks, c.ReleaseKey(c.RedHat, osVer))
 		}
-		bar.Finish()
 	}
 
-	log15.Info("Inserting new Definitions...")
-	bar := pb.StartNew(len(root.Definitions))
-	if err := tx.Omit("Definitions").Create(&root).Error; err != nil {
-		tx.Rollback()
-		return xerrors.Errorf("Failed to insert Root. err: %w", err)
+	total := int64(len(defs))
+	if page.Limit > 0 || page.Offset > 0 {
+		if err := where().Count(&total).Error; err != nil {
+			return nil, 0, xerrors.Errorf("Failed to count definitions. err: %w", err)
+		}
 	}
+	return defs, total, nil
+}
 
-	for i := range root.Definitions {
-		root.Definitions[i].RootID = root.ID
+// GetByCveID select OVAL definition related to OS Family, osVer, cveID
+func (r *RDBDriver) GetByCveID(ctx context.Context, family, osVer, cveID, arch string) ([]models.Definition, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
 	}
+	conn := r.conn.WithContext(ctx)
 
-	for idx := range chunkSlice(len(root.Definitions), batchSize) {
-		if err := tx.Omit("AffectedPacks").Create(root.Definitions[idx.From:idx.To]).Error; err != nil {
-			tx.Rollback()
-			return xerrors.Errorf("Failed to insert Definitions. err: %w", err)
-		}
+	q := conn.
+		Model(&models.Definition{}).
+		Joins("JOIN roots ON roots.id = definitions.root_id AND roots.family= ? AND roots.release_key = ? AND roots.active = ?", family, osVer, true).
+		Joins("JOIN advisories ON advisories.definition_id = definitions.id").
+		Joins("JOIN cves ON cves.advisory_id = advisories.id").
+		Where("cves.cve_id = ?", cveID)
 
-		for _, d := range root.Definitions[idx.From:idx.To] {
-			for idx2 := range chunkSlice(len(d.AffectedPacks), batchSize) {
-				for i := range d.AffectedPacks[idx2.From:idx2.To] {
-					d.AffectedPacks[idx2.From+i].DefinitionID = d.ID
-				}
-				if err := tx.Create(d.AffectedPacks[idx2.From:idx2.To]).Error; err != nil {
-					tx.Rollback()
-					return xerrors.Errorf("Failed to insert AffectedPacks. err: %w", err)
-				}
-			}
-		}
+	defs, err := r.findInOrder(ctx, q, family, arch)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to find definitions. family: %s, osVer: %s, cveID: %s, arch: %s, err: %w", family, osVer, cveID, arch, err)
+	}
 
-		bar.Add(idx.To - idx.From)
+	if family == c.RedHat {
+		for i := range defs {
+			defs[i].AffectedPacks = filterByRedHatMajor(defs[i].AffectedPacks, c.ReleaseKey(c.RedHat, osVer))
+		}
 	}
-	bar.Finish()
 
-	return tx.Commit().Error
+	return defs, nil
 }
 
-// CountDefs counts the number of definitions specified by args
-func (r *RDBDriver) CountDefs(family, osVer string) (int, error) {
+// GetByAdvisoryID select OVAL definition related to OS Family, osVer, of the advisory of advisoryID or of its revisions,
+// selecting the candidates by the prefix of advisoryID and matching them in Go, as the revisions are not matched by SQL of every dialect
+func (r *RDBDriver) GetByAdvisoryID(ctx context.Context, family, osVer, advisoryID, arch string) ([]models.Definition, error) {
 	family, osVer, err := formatFamilyAndOSVer(family, osVer)
 	if err != nil {
-		return 0, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
 	}
+	if advisoryID == "" {
+		return []models.Definition{}, nil
+	}
+	conn := r.conn.WithContext(ctx)
 
-	root := models.Root{}
-	if err := r.conn.Where(&models.Root{Family: family, OSVersion: osVer}).Take(&root).Error; err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			return 0, err
+	candidates := []struct {
+		DefinitionID uint
+		AdvisoryID   string
+	}{}
+	if err := conn.
+		Table("advisories").
+		Select("advisories.definition_id, advisories.advisory_id").
+		Joins("JOIN definitions ON definitions.id = advisories.definition_id").
+		Joins("JOIN roots ON roots.id = definitions.root_id AND roots.family= ? AND roots.release_key = ? AND roots.active = ?", family, osVer, true).
+		Where("UPPER(advisories.advisory_id) LIKE ? ESCAPE ?", likeEscaper.Replace(strings.ToUpper(advisoryID))+"%", `\`).
+		Scan(&candidates).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to select the advisories. family: %s, osVer: %s, advisoryID: %s, err: %w", family, osVer, advisoryID, err)
+	}
+	ids := []uint{}
+	for _, cand := range candidates {
+		if matchAdvisoryID(cand.AdvisoryID, advisoryID) {
+			ids = append(ids, cand.DefinitionID)
 		}
-		return 0, nil
+	}
+	if len(ids) == 0 {
+		return []models.Definition{}, nil
 	}
 
-	var count int64
-	if err := r.conn.Model(&models.Definition{}).Where(
-		"root_id = ?", root.ID).Count(&count).Error; err != nil {
-		return 0, err
+	q := conn.
+		Model(&models.Definition{}).
+		Joins("LEFT JOIN advisories ON advisories.definition_id = definitions.id").
+		Where("definitions.id IN ?", ids)
+	defs, err := r.findInOrder(ctx, q, family, arch)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to find definitions. family: %s, osVer: %s, advisoryID: %s, arch: %s, err: %w", family, osVer, advisoryID, arch, err)
 	}
-	return int(count), nil
+
+	if family == c.RedHat {
+		for i := range defs {
+			defs[i].AffectedPacks = filterByRedHatMajor(defs[i].AffectedPacks, c.ReleaseKey(c.RedHat, osVer))
+		}
+	}
+
+	return defs, nil
 }
 
-// GetLastModified get last modified time of OVAL in roots
-func (r *RDBDriver) GetLastModified(family, osVer string) (time.Time, error) {
+// GetByCpe select OVAL definition related to OS Family, osVer, whose affected CPE starts with cpe,
+// as the stored CPE is more specific than the one of the callers, e.g. cpe:/o:redhat:enterprise_linux:7 matches cpe:/o:redhat:enterprise_linux:7::server
+func (r *RDBDriver) GetByCpe(ctx context.Context, family, osVer, cpe, arch string) ([]models.Definition, error) {
 	family, osVer, err := formatFamilyAndOSVer(family, osVer)
 	if err != nil {
-		return time.Time{}, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
 	}
+	conn := r.conn.WithContext(ctx)
 
-	root := models.Root{}
-	result := r.conn.Where(&models.Root{Family: family, OSVersion: osVer}).First(&root)
-	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return time.Time{}, xerrors.Errorf("Failed to get root: %w", result.Error)
+	// the definition matched by several CPEs of its advisory is selected once
+	matched := conn.
+		Table("advisories").
+		Select("advisories.definition_id").
+		Joins("JOIN cpes ON cpes.advisory_id = advisories.id").
+		Where("cpes.cpe LIKE ? ESCAPE ?", likeEscaper.Replace(cpe)+"%", `\`)
+	q := conn.
+		Model(&models.Definition{}).
+		Joins("JOIN roots ON roots.id = definitions.root_id AND roots.family= ? AND roots.release_key = ? AND roots.active = ?", family, osVer, true).
+		Joins("LEFT JOIN advisories ON advisories.definition_id = definitions.id").
+		Where("definitions.id IN (?)", matched)
+
+	defs, err := r.findInOrder(ctx, q, family, arch)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to select definitions by CPE. family: %s, osVer: %s, cpe: %s, arch: %s, err: %w", family, osVer, cpe, arch, err)
 	}
 
-	if result.RowsAffected == 0 {
-		now := time.Now()
-		return now.AddDate(-100, 0, 0), nil
+	if family == c.RedHat {
+		for i := range defs {
+			defs[i].AffectedPacks = filterByRedHatMajor(defs[i].AffectedPacks, c.ReleaseKey(c.RedHat, osVer))
+		}
 	}
-	return root.Timestamp, nil
-}
 
-// IsGovalDictModelV1 determines if the DB was created at the time of goval-dictionary Model v1
-func (r *RDBDriver) IsGovalDictModelV1() (bool, error) {
-	return r.conn.Migrator().HasColumn(&models.FetchMeta{}, "file_name"), nil
+	return defs, nil
 }
 
-// GetFetchMeta get FetchMeta from Database
-func (r *RDBDriver) GetFetchMeta() (fetchMeta *models.FetchMeta, err error) {
-	if err = r.conn.Take(&fetchMeta).Error; err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, err
+// likeEscaper escapes the wildcards of LIKE, so that the CPE is matched as it is, e.g. "_" of enterprise_linux
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// GetPackInfo select the flattened CVE and fixed version of packName related to OS Family, osVer
+func (r *RDBDriver) GetPackInfo(ctx context.Context, family, osVer, packName string) ([]models.PackInfo, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+	conn := r.conn.WithContext(ctx)
+
+	infos := []models.PackInfo{}
+	if err := conn.
+		Table("definitions").
+		Select("DISTINCT COALESCE(cves.cve_id, '') AS cve_id, definitions.definition_id AS definition_id, COALESCE(advisories.advisory_id, '') AS advisory_id, packages.version AS fixed_version, packages.not_fixed_yet AS not_fixed_yet, COALESCE(advisories.severity, '') AS severity").
+		Joins("JOIN roots ON roots.id = definitions.root_id AND roots.family= ? AND roots.release_key = ? AND roots.active = ?", family, osVer, true).
+		Joins("JOIN packages ON packages.definition_id = definitions.id AND packages.name = ?", packName).
+		Joins("LEFT JOIN advisories ON advisories.definition_id = definitions.id").
+		Joins("LEFT JOIN cves ON cves.advisory_id = advisories.id").
+		Scan(&infos).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to select PackInfo. family: %s, osVer: %s, packName: %s, err: %w", family, osVer, packName, err)
+	}
+
+	if family == c.RedHat {
+		filtered := []models.PackInfo{}
+		for _, info := range infos {
+			if len(filterByRedHatMajor([]models.Package{{Version: info.FixedVersion, NotFixedYet: info.NotFixedYet}}, c.ReleaseKey(c.RedHat, osVer))) > 0 {
+				filtered = append(filtered, info)
+			}
+		}
+		infos = filtered
+	}
+
+	sortPackInfos(infos)
+	return infos, nil
+}
+
+// ListPackages selects the distinct names of the affected packages of OS Family, osVer in a query, sorted.
+// Of RedHat, the names of the packages of the other major versions, e.g. of rhel-7-8.oval.xml.bz2, are not.
+func (r *RDBDriver) ListPackages(ctx context.Context, family, osVer string) ([]string, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+	q := r.conn.WithContext(ctx).
+		Table("packages").
+		Joins("JOIN definitions ON definitions.id = packages.definition_id").
+		Joins("JOIN roots ON roots.id = definitions.root_id AND roots.family= ? AND roots.release_key = ? AND roots.active = ?", family, osVer, true)
+
+	names := []string{}
+	if family != c.RedHat {
+		if err := q.Distinct("packages.name").Pluck("packages.name", &names).Error; err != nil {
+			return nil, xerrors.Errorf("Failed to select packages. family: %s, osVer: %s, err: %w", family, osVer, err)
+		}
+		// sorted in Go, as the collation of MySQL is case-insensitive
+		sort.Strings(names)
+		return names, nil
+	}
+
+	packs := []models.Package{}
+	if err := q.Distinct("packages.name", "packages.version", "packages.not_fixed_yet").Scan(&packs).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to select packages. family: %s, osVer: %s, err: %w", family, osVer, err)
+	}
+	return packageNames(filterByRedHatMajor(packs, c.ReleaseKey(c.RedHat, osVer))), nil
+}
+
+// InsertOval inserts OVAL in a transaction, which is rolled back once ctx is done,
+// returning the numbers of the definitions new, updated, unchanged and removed from the stored ones
+func (r *RDBDriver) InsertOval(ctx context.Context, root *models.Root) (models.ChangeStat, error) {
+	family, osVer, err := formatFamilyAndOSVer(root.Family, root.OSVersion)
+	if err != nil {
+		return models.ChangeStat{}, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+	// stored as the family looked up, e.g. redhat of RedHat, and of the key of the release looked up, e.g. 7 of 7Server
+	root.Family, root.ReleaseKey = family, osVer
+	familyLog := familyLogger(ctx, family, osVer)
+	familyLog.Info("Refreshing...")
+
+	conf := c.FromContext(ctx)
+	batchSize := conf.BatchSize
+	if batchSize < 1 {
+		return models.ChangeStat{}, fmt.Errorf("Failed to set batch-size. err: batch-size option is not set properly")
+	}
+
+	conn := r.conn.WithContext(ctx)
+	old := models.Root{}
+	result := conn.Where(&models.Root{Family: family, ReleaseKey: osVer, Active: true}).First(&old)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return models.ChangeStat{}, xerrors.Errorf("Failed to select old defs: %w", result.Error)
+	}
+
+	if result.RowsAffected > 0 && len(root.Definitions) == 0 && !conf.ForceEmpty {
+		var count int64
+		if err := conn.Model(&models.Definition{}).Where("root_id = ?", old.ID).Count(&count).Error; err != nil {
+			return models.ChangeStat{}, xerrors.Errorf("Failed to count old defs: %w", err)
+		}
+		if count > 0 {
+			return models.ChangeStat{}, xerrors.Errorf("Failed to refresh OVAL. err: refuse to replace %d definitions with empty OVAL, use --force-empty to override. family: %s, osVer: %s", count, family, osVer)
+		}
+	}
+
+	var sourceChange *models.SourceChange
+	if result.RowsAffected > 0 && old.Source != "" && root.Source != "" && old.Source != root.Source {
+		var count int64
+		if err := conn.Model(&models.Definition{}).Where("root_id = ?", old.ID).Count(&count).Error; err != nil {
+			return models.ChangeStat{}, xerrors.Errorf("Failed to count old defs: %w", err)
+		}
+		if sourceChange, err = checkSourceChange(familyLog, conf.AllowSourceChange, family, osVer, old.Source, int(count), root); err != nil {
+			return models.ChangeStat{}, err
+		}
+	}
+
+	// the same files converted by another binary or options differ of ConvertDigest, and the roots stored before it of the empty one are refreshed once
+	unchanged := result.RowsAffected > 0 && root.SHA256 != "" && old.SHA256 == root.SHA256 && old.ConvertDigest == root.ConvertDigest
+	if unchanged && conf.Force {
+		familyLog.Info("Refreshing the unchanged OVAL, as the skip is overridden by --force", "SHA256", root.SHA256)
+	} else if unchanged {
+		familyLog.Info("Skip refreshing because the OVAL has not been changed", "SHA256", root.SHA256)
+		// the zero Source of the unknown one is not updated by the struct
+		if err := conn.Model(&old).Updates(models.Root{Timestamp: root.Timestamp, Source: root.Source}).Error; err != nil {
+			return models.ChangeStat{}, xerrors.Errorf("Failed to update Root timestamp. err: %w", err)
+		}
+		stat := models.ChangeStat{Unchanged: len(root.Definitions), SourceChange: sourceChange}
+		r.appendHistory(ctx, family, osVer, root.Timestamp, stat)
+		return stat, nil
+	}
+
+	hashes, oldDefs := map[string]string{}, 0
+	if result.RowsAffected > 0 {
+		defs := []models.Definition{}
+		if err := conn.Model(&old).Association("Definitions").Find(&defs); err != nil {
+			return models.ChangeStat{}, xerrors.Errorf("Failed to select old defs: %w", err)
+		}
+		oldDefs = len(defs)
+		if hashes, err = contentHashes(ctx, conn, defs); err != nil {
+			return models.ChangeStat{}, xerrors.Errorf("Failed to hash old defs. err: %w", err)
+		}
+	}
+
+	// the inactive roots left by the refresh failed to swap or to delete the old one are never served, and deleted before inserting another
+	if err := r.deleteInactiveRoots(ctx, familyLog, family, osVer); err != nil {
+		return models.ChangeStat{}, xerrors.Errorf("Failed to delete inactive roots. err: %w", err)
+	}
+
+	// the new root is inserted inactive in its own transaction, while the lookups are served of the old one
+	familyLog.Info("Inserting new Definitions...", "Count", len(root.Definitions))
+	root.ID, root.Active = 0, false
+	tx := conn.Begin()
+	if err := tx.Omit("Definitions").Create(&root).Error; err != nil {
+		tx.Rollback()
+		return models.ChangeStat{}, xerrors.Errorf("Failed to insert Root. err: %w", err)
+	}
+	// false is not inserted over the default of the column
+	if err := tx.Model(&models.Root{}).Where("id = ?", root.ID).Update("active", false).Error; err != nil {
+		tx.Rollback()
+		return models.ChangeStat{}, xerrors.Errorf("Failed to deactivate Root. err: %w", err)
+	}
+	if err := insertDefinitions(ctx, tx, family, osVer, root.ID, root.Definitions, batchSize); err != nil {
+		tx.Rollback()
+		return models.ChangeStat{}, xerrors.Errorf("Failed to insert new defs. err: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return models.ChangeStat{}, err
+	}
+
+	// and swapped for the old one in a transaction of the two updates, however many definitions they have
+	if err := conn.Transaction(func(tx *gorm.DB) error {
+		if result.RowsAffected > 0 {
+			if err := tx.Model(&models.Root{}).Where("id = ?", old.ID).Update("active", false).Error; err != nil {
+				return xerrors.Errorf("Failed to deactivate old Root. err: %w", err)
+			}
+		}
+		if err := tx.Model(&models.Root{}).Where("id = ?", root.ID).Update("active", true).Error; err != nil {
+			return xerrors.Errorf("Failed to activate new Root. err: %w", err)
+		}
+		return nil
+	}); err != nil {
+		if delErr := r.deleteRoot(context.Background(), *root); delErr != nil {
+			familyLog.Warn("Failed to delete the new inactive Root, left for the next refresh", "err", delErr)
+		}
+		return models.ChangeStat{}, xerrors.Errorf("Failed to swap Root. err: %w", err)
+	}
+	root.Active = true
+
+	// the old root is no longer served, and its deletion is not aborted by ctx, as the refresh has been done
+	if result.RowsAffected > 0 {
+		familyLog.Info("Deleting old Definitions...", "Count", oldDefs)
+		if err := r.deleteRoot(context.Background(), old); err != nil {
+			familyLog.Warn("Failed to delete the old inactive Root, left for the next refresh or db --action fix", "err", err)
+		}
+	}
+
+	stat := models.ChangeStat{SourceChange: sourceChange}
+	inserted := make(map[string]struct{}, len(root.Definitions))
+	for _, d := range root.Definitions {
+		h, ok := hashes[d.DefinitionID]
+		countChange(&stat, d, h, ok)
+		inserted[d.DefinitionID] = struct{}{}
+	}
+	for id := range hashes {
+		if _, ok := inserted[id]; !ok {
+			stat.Removed++
+		}
+	}
+	r.appendHistory(ctx, family, osVer, root.Timestamp, stat)
+	r.checkpointAfterInsert(familyLog)
+	return stat, nil
+}
+
+// deleteRoot deletes root with its definitions in a transaction
+func (r *RDBDriver) deleteRoot(ctx context.Context, root models.Root) error {
+	return r.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		defs := []models.Definition{}
+		if err := tx.Model(&root).Association("Definitions").Find(&defs); err != nil {
+			return xerrors.Errorf("Failed to select defs. err: %w", err)
+		}
+		if err := deleteDefinitions(ctx, tx, defs); err != nil {
+			return xerrors.Errorf("Failed to delete defs. err: %w", err)
+		}
+		if err := tx.Unscoped().Where("id = ?", root.ID).Delete(&models.Root{}).Error; err != nil {
+			return xerrors.Errorf("Failed to delete root. err: %w", err)
+		}
+		return nil
+	})
+}
+
+// deleteInactiveRoots deletes the inactive roots of family and osVer with their definitions
+func (r *RDBDriver) deleteInactiveRoots(ctx context.Context, familyLog log15.Logger, family, osVer string) error {
+	roots := []models.Root{}
+	if err := r.conn.WithContext(ctx).Where("family = ? AND release_key = ? AND active = ?", family, osVer, false).Find(&roots).Error; err != nil {
+		return xerrors.Errorf("Failed to select inactive roots. err: %w", err)
+	}
+	for _, root := range roots {
+		familyLog.Info("Deleting the inactive Root left by the last refresh...", "ID", root.ID)
+		if err := r.deleteRoot(ctx, root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeOval merges the definitions of root into the stored OVAL, replacing the ones of the same DefinitionID and keeping the others,
+// e.g. to add the OVAL of a year to the stored one instead of refreshing it
+func (r *RDBDriver) MergeOval(ctx context.Context, root *models.Root) (models.ChangeStat, error) {
+	family, osVer, err := formatFamilyAndOSVer(root.Family, root.OSVersion)
+	if err != nil {
+		return models.ChangeStat{}, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+	familyLog := familyLogger(ctx, family, osVer)
+	familyLog.Info("Merging...")
+
+	batchSize := c.FromContext(ctx).BatchSize
+	if batchSize < 1 {
+		return models.ChangeStat{}, fmt.Errorf("Failed to set batch-size. err: batch-size option is not set properly")
+	}
+
+	defs := uniqueDefinitions(root.Definitions)
+	tx := r.conn.WithContext(ctx).Begin()
+	old := models.Root{}
+	result := tx.Where(&models.Root{Family: family, ReleaseKey: osVer, Active: true}).First(&old)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		return models.ChangeStat{}, xerrors.Errorf("Failed to select old defs: %w", result.Error)
+	}
+
+	hashes := map[string]string{}
+	if result.RowsAffected == 0 {
+		old = models.Root{Family: family, OSVersion: osVer, ReleaseKey: osVer, Timestamp: root.Timestamp}
+		if err := tx.Omit("Definitions").Create(&old).Error; err != nil {
+			tx.Rollback()
+			return models.ChangeStat{}, xerrors.Errorf("Failed to insert Root. err: %w", err)
+		}
+	} else {
+		ids := make([]string, 0, len(defs))
+		for _, d := range defs {
+			ids = append(ids, d.DefinitionID)
+		}
+		replaced := []models.Definition{}
+		for idx := range chunkSlice(len(ids), 998) {
+			ds := []models.Definition{}
+			if err := tx.Where("root_id = ? AND definition_id IN ?", old.ID, ids[idx.From:idx.To]).Find(&ds).Error; err != nil {
+				tx.Rollback()
+				return models.ChangeStat{}, xerrors.Errorf("Failed to select old defs: %w", err)
+			}
+			replaced = append(replaced, ds...)
+		}
+		if hashes, err = contentHashes(ctx, tx, replaced); err != nil {
+			tx.Rollback()
+			return models.ChangeStat{}, xerrors.Errorf("Failed to hash replaced defs. err: %w", err)
+		}
+		familyLog.Info("Deleting replaced Definitions...", "Count", len(replaced))
+		if err := deleteDefinitions(ctx, tx, replaced); err != nil {
+			tx.Rollback()
+			return models.ChangeStat{}, xerrors.Errorf("Failed to delete replaced defs. err: %w", err)
+		}
+		// the merged OVAL is no longer the content of any single file
+		if err := tx.Model(&old).Updates(map[string]interface{}{"timestamp": root.Timestamp, "file_size": 0, "sha256": ""}).Error; err != nil {
+			tx.Rollback()
+			return models.ChangeStat{}, xerrors.Errorf("Failed to update Root. err: %w", err)
+		}
+	}
+
+	familyLog.Info("Inserting merged Definitions...", "Count", len(defs))
+	if err := insertDefinitions(ctx, tx, family, osVer, old.ID, defs, batchSize); err != nil {
+		tx.Rollback()
+		return models.ChangeStat{}, xerrors.Errorf("Failed to insert merged defs. err: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return models.ChangeStat{}, err
+	}
+
+	// the stored definitions not in root are kept, not removed
+	stat := models.ChangeStat{}
+	for _, d := range defs {
+		h, ok := hashes[d.DefinitionID]
+		countChange(&stat, d, h, ok)
+	}
+	r.appendHistory(ctx, family, osVer, root.Timestamp, stat)
+	r.checkpointAfterInsert(familyLog)
+	return stat, nil
+}
+
+// PurgeOval deletes the OVAL of family and osVer with its definitions in a transaction, which is rolled back once ctx is done,
+// returning the stats of the deleted OVAL, whose counts are zero if it is not stored
+func (r *RDBDriver) PurgeOval(ctx context.Context, family, osVer string) (models.RootStat, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return models.RootStat{}, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+	familyLog := familyLogger(ctx, family, osVer)
+	familyLog.Info("Purging...")
+
+	stat := models.RootStat{Family: family, OSVersion: osVer}
+	tx := r.conn.WithContext(ctx).Begin()
+	// the inactive roots left by the refresh are deleted as well, counted only of the active one
+	roots := []models.Root{}
+	if err := tx.Where(&models.Root{Family: family, ReleaseKey: osVer}).Find(&roots).Error; err != nil {
+		tx.Rollback()
+		return models.RootStat{}, xerrors.Errorf("Failed to select roots. err: %w", err)
+	}
+	if len(roots) == 0 {
+		tx.Rollback()
+		return stat, nil
+	}
+
+	var defCount, packs int64
+	for _, root := range roots {
+		defs := []models.Definition{}
+		if err := tx.Model(&root).Association("Definitions").Find(&defs); err != nil {
+			tx.Rollback()
+			return models.RootStat{}, xerrors.Errorf("Failed to select defs. err: %w", err)
+		}
+		if root.Active {
+			stat.Timestamp = root.Timestamp
+			defCount = int64(len(defs))
+			if err := tx.Model(&models.Package{}).Joins("JOIN definitions ON definitions.id = packages.definition_id").Where("definitions.root_id = ?", root.ID).Count(&packs).Error; err != nil {
+				tx.Rollback()
+				return models.RootStat{}, xerrors.Errorf("Failed to count packages. err: %w", err)
+			}
+		}
+		familyLog.Info("Deleting Definitions...", "Count", len(defs), "Active", root.Active)
+		if err := deleteDefinitions(ctx, tx, defs); err != nil {
+			tx.Rollback()
+			return models.RootStat{}, xerrors.Errorf("Failed to delete defs. err: %w", err)
+		}
+		if err := tx.Unscoped().Where("id = ?", root.ID).Delete(&models.Root{}).Error; err != nil {
+			tx.Rollback()
+			return models.RootStat{}, xerrors.Errorf("Failed to delete root. err: %w", err)
+		}
+	}
+	if err := purgeSourceFiles(tx, family, osVer); err != nil {
+		tx.Rollback()
+		return models.RootStat{}, xerrors.Errorf("Failed to purge source files. err: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return models.RootStat{}, xerrors.Errorf("Failed to commit. err: %w", err)
+	}
+
+	stat.Definitions = int(defCount)
+	stat.Packages = int(packs)
+	return stat, nil
+}
+
+// contentHashes returns the content hashes of the stored definitions by DefinitionID, loading them with their associations in the chunks
+// before they are deleted, stopping between the chunks once ctx is done
+func contentHashes(ctx context.Context, tx *gorm.DB, defs []models.Definition) (map[string]string, error) {
+	hashes := make(map[string]string, len(defs))
+	for idx := range chunkSlice(len(defs), 998) {
+		if err := ctx.Err(); err != nil {
+			return nil, xerrors.Errorf("Failed to select defs. err: %w", err)
+		}
+		ids := make([]uint, 0, idx.To-idx.From)
+		for _, d := range defs[idx.From:idx.To] {
+			ids = append(ids, d.ID)
+		}
+		ds := []models.Definition{}
+		if err := tx.
+			Preload("Advisory").
+			Preload("Advisory.Cves").
+			Preload("Advisory.Bugzillas").
+			Preload("Advisory.AffectedCPEList").
+			Preload("References").
+			Preload("Debian").
+			Preload("AffectedPacks").
+			Where("id IN ?", ids).
+			Find(&ds).Error; err != nil {
+			return nil, xerrors.Errorf("Failed to select defs. err: %w", err)
+		}
+		for _, d := range ds {
+			hashes[d.DefinitionID] = d.ContentHash()
+		}
+	}
+	return hashes, nil
+}
+
+// deleteDefinitions deletes the definitions and their associations, stopping between the chunks once ctx is done
+func deleteDefinitions(ctx context.Context, tx *gorm.DB, defs []models.Definition) error {
+	bar := startProgressBar(ctx, len(defs))
+	for idx := range chunkSlice(len(defs), 998) {
+		if err := ctx.Err(); err != nil {
+			return xerrors.Errorf("Failed to delete: %w", err)
+		}
+		var advs []models.Advisory
+		if err := tx.Model(defs[idx.From:idx.To]).Association("Advisory").Find(&advs); err != nil {
+			return xerrors.Errorf("Failed to delete: %w", err)
+		}
+
+		for idx2 := range chunkSlice(len(advs), 998) {
+			if err := tx.Select(clause.Associations).Unscoped().Delete(advs[idx2.From:idx2.To]).Error; err != nil {
+				return xerrors.Errorf("Failed to delete: %w", err)
+			}
+		}
+
+		if err := tx.Select(clause.Associations).Unscoped().Delete(defs[idx.From:idx.To]).Error; err != nil {
+			return xerrors.Errorf("Failed to delete: %w", err)
+		}
+		bar.Add(idx.To - idx.From)
+	}
+	bar.Finish()
+	return nil
+}
+
+// insertDefinitions inserts the definitions of the root of rootID, stopping between the batches once ctx is done.
+// The batch failed is told by *InsertError of family and osVer.
+func insertDefinitions(ctx context.Context, tx *gorm.DB, family, osVer string, rootID uint, defs []models.Definition, batchSize int) error {
+	bar := startProgressBar(ctx, len(defs))
+	for i := range defs {
+		defs[i].RootID = rootID
+	}
+
+	for idx := range chunkSlice(len(defs), batchSize) {
+		if err := ctx.Err(); err != nil {
+			return xerrors.Errorf("Failed to insert Definitions. err: %w", err)
+		}
+		if err := tx.Omit("AffectedPacks").Create(defs[idx.From:idx.To]).Error; err != nil {
+			return newInsertError(ctx, family, osVer, "Definitions", defs[idx.From:idx.To], err)
+		}
+
+		for _, d := range defs[idx.From:idx.To] {
+			for idx2 := range chunkSlice(len(d.AffectedPacks), batchSize) {
+				for i := range d.AffectedPacks[idx2.From:idx2.To] {
+					d.AffectedPacks[idx2.From+i].DefinitionID = d.ID
+				}
+				if err := tx.Create(d.AffectedPacks[idx2.From:idx2.To]).Error; err != nil {
+					return newInsertError(ctx, family, osVer, "AffectedPacks", []models.Definition{d}, err)
+				}
+			}
+		}
+
+		bar.Add(idx.To - idx.From)
+	}
+	bar.Finish()
+	return nil
+}
+
+// IterateDefinitions calls fn with each definition of the stored OVAL of family and osVer sorted by DefinitionID, with all its associations,
+// loading them in batches so that the OVAL of the big family is not held in memory at once
+func (r *RDBDriver) IterateDefinitions(ctx context.Context, family, osVer string, fn func(models.Definition) error) error {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+
+	root := models.Root{}
+	if err := r.conn.WithContext(ctx).Where(&models.Root{Family: family, ReleaseKey: osVer, Active: true}).Take(&root).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return xerrors.Errorf("Failed to select root. err: %w", err)
+	}
+
+	var last *models.Definition
+	for {
+		q := r.conn.WithContext(ctx).Where("root_id = ?", root.ID)
+		if last != nil {
+			q = q.Where("(definition_id > ? OR (definition_id = ? AND id > ?))", last.DefinitionID, last.DefinitionID, last.ID)
+		}
+		defs := []models.Definition{}
+		if err := q.
+			Preload("Advisory").
+			Preload("Advisory.Cves").
+			Preload("Advisory.Bugzillas").
+			Preload("Advisory.AffectedCPEList").
+			Preload("References").
+			Preload("Debian").
+			Preload("AffectedPacks").
+			Order("definition_id, id").
+			Limit(998).
+			Find(&defs).Error; err != nil {
+			return xerrors.Errorf("Failed to select defs. family: %s, osVer: %s, err: %w", family, osVer, err)
+		}
+		for _, d := range defs {
+			if err := fn(d); err != nil {
+				return err
+			}
+		}
+		if len(defs) < 998 {
+			return nil
+		}
+		last = &defs[len(defs)-1]
+	}
+}
+
+// CountDefs counts the number of definitions specified by args
+func (r *RDBDriver) CountDefs(family, osVer string) (int, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return 0, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+
+	root := models.Root{}
+	if err := r.conn.Where(&models.Root{Family: family, ReleaseKey: osVer, Active: true}).Take(&root).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, err
+		}
+		return 0, nil
+	}
+
+	var count int64
+	if err := r.conn.Model(&models.Definition{}).Where(
+		"root_id = ?", root.ID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// GetRootStats returns the stats of every stored OVAL, sorted by family and version
+func (r *RDBDriver) GetRootStats() ([]models.RootStat, error) {
+	roots := []models.Root{}
+	if err := r.conn.Where("active = ?", true).Order("family, os_version").Find(&roots).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to get roots. err: %w", err)
+	}
+
+	stats := make([]models.RootStat, 0, len(roots))
+	for _, root := range roots {
+		var defs, packs int64
+		if err := r.conn.Model(&models.Definition{}).Where("root_id = ?", root.ID).Count(&defs).Error; err != nil {
+			return nil, xerrors.Errorf("Failed to count definitions. err: %w", err)
+		}
+		if err := r.conn.Model(&models.Package{}).Joins("JOIN definitions ON definitions.id = packages.definition_id").Where("definitions.root_id = ?", root.ID).Count(&packs).Error; err != nil {
+			return nil, xerrors.Errorf("Failed to count packages. err: %w", err)
+		}
+		stats = append(stats, models.RootStat{Family: root.Family, OSVersion: root.OSVersion, Timestamp: root.Timestamp, Definitions: int(defs), Packages: int(packs), FileSize: root.FileSize, SHA256: root.SHA256})
+	}
+	return stats, nil
+}
+
+// GetRootTimestamps returns the timestamps and the SHA-256 of all the stored OVAL sorted by family and OS version
+func (r *RDBDriver) GetRootTimestamps() ([]models.RootTimestamp, error) {
+	ts := []models.RootTimestamp{}
+	if err := r.conn.Model(&models.Root{}).Select("family, os_version, timestamp, sha256, convert_digest").Where("active = ?", true).Order("family, os_version").Scan(&ts).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to get roots. err: %w", err)
+	}
+	return ts, nil
+}
+
+// orphanChecks are the child tables with the foreign key of the parent table, in the order to delete the orphaned rows,
+// where the children of the deleted orphans are deleted after them
+var orphanChecks = []struct {
+	table  string
+	child  interface{}
+	fk     string
+	parent interface{}
+}{
+	{table: "definitions", child: &models.Definition{}, fk: "root_id", parent: &models.Root{}},
+	{table: "packages", child: &models.Package{}, fk: "definition_id", parent: &models.Definition{}},
+	{table: "references", child: &models.Reference{}, fk: "definition_id", parent: &models.Definition{}},
+	{table: "debians", child: &models.Debian{}, fk: "definition_id", parent: &models.Definition{}},
+	{table: "advisories", child: &models.Advisory{}, fk: "definition_id", parent: &models.Definition{}},
+	{table: "cves", child: &models.Cve{}, fk: "advisory_id", parent: &models.Advisory{}},
+	{table: "bugzillas", child: &models.Bugzilla{}, fk: "advisory_id", parent: &models.Advisory{}},
+	{table: "cpes", child: &models.Cpe{}, fk: "advisory_id", parent: &models.Advisory{}},
+}
+
+// CheckStorage checks that the storage of DB is sound, e.g. before the fetch replaces the stored OVAL: PRAGMA quick_check of SQLite,
+// or integrity_check if full, which reads every page, and the ping of MySQL and PostgreSQL, then a SELECT of roots if migrated for all of them.
+// The corruption found is returned as ErrCorrupted with up to MaxSamples of the problems.
+func (r *RDBDriver) CheckStorage(full bool) error {
+	if r.name == dialectSqlite3 {
+		pragma := "quick_check"
+		if full {
+			pragma = "integrity_check"
+		}
+		problems, err := r.sqliteCheck(pragma)
+		if err != nil {
+			if isSqliteCorrupt(err) {
+				return xerrors.Errorf("Failed to %s. %s, err: %w", pragma, err, ErrCorrupted)
+			}
+			return xerrors.Errorf("Failed to %s. err: %w", pragma, err)
+		}
+		if len(problems) > 0 {
+			if len(problems) > MaxSamples {
+				problems = problems[:MaxSamples]
+			}
+			return xerrors.Errorf("Failed to %s. %s, err: %w", pragma, strings.Join(problems, "; "), ErrCorrupted)
+		}
+	} else if err := r.Ping(); err != nil {
+		return err
+	}
+
+	// the new DB has no table until migrated
+	if !r.conn.Migrator().HasTable(&models.Root{}) {
+		return nil
+	}
+	ids := []uint{}
+	if err := r.conn.Model(&models.Root{}).Limit(1).Pluck("id", &ids).Error; err != nil {
+		if isSqliteCorrupt(err) {
+			return xerrors.Errorf("Failed to select roots. %s, err: %w", err, ErrCorrupted)
+		}
+		return xerrors.Errorf("Failed to select roots. err: %w", err)
+	}
+	return nil
+}
+
+// sqliteCheck runs PRAGMA quick_check or integrity_check and returns the problems it found, none for the single row of ok
+func (r *RDBDriver) sqliteCheck(pragma string) ([]string, error) {
+	rows, err := r.conn.Raw(fmt.Sprintf("PRAGMA %s", pragma)).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	problems := []string{}
+	for rows.Next() {
+		var row string
+		if err := rows.Scan(&row); err != nil {
+			return nil, err
+		}
+		if row != "ok" {
+			problems = append(problems, row)
+		}
+	}
+	return problems, rows.Err()
+}
+
+// CheckIntegrity counts the orphaned rows of each table, whose parent definition, advisory or root is gone, the duplicate roots of the same family
+// and OS version, and the cache validators in FetchMeta of the OS versions with no root, with up to MaxSamples of each of them
+func (r *RDBDriver) CheckIntegrity() (Report, error) {
+	report := Report{Orphans: map[string]int64{}, Samples: map[string][]string{}}
+	for _, c := range orphanChecks {
+		orphans := r.conn.Model(c.child).Where(fmt.Sprintf("%s NOT IN (?)", c.fk), r.conn.Model(c.parent).Select("id"))
+		var count int64
+		if err := orphans.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+			return Report{}, xerrors.Errorf("Failed to count orphaned %s. err: %w", c.table, err)
+		}
+		report.Orphans[c.table] = count
+		if count == 0 {
+			continue
+		}
+		ids := []uint{}
+		if err := orphans.Session(&gorm.Session{}).Order("id").Limit(MaxSamples).Pluck("id", &ids).Error; err != nil {
+			return Report{}, xerrors.Errorf("Failed to get orphaned %s. err: %w", c.table, err)
+		}
+		for _, id := range ids {
+			report.Samples[c.table] = append(report.Samples[c.table], strconv.FormatUint(uint64(id), 10))
+		}
+	}
+
+	dups := []struct {
+		Family    string
+		OSVersion string
+	}{}
+	if err := r.conn.Model(&models.Root{}).Select("family, os_version").Where("active = ?", true).Group("family, os_version").Having("COUNT(*) > 1").Order("family, os_version").Scan(&dups).Error; err != nil {
+		return Report{}, xerrors.Errorf("Failed to get duplicate roots. err: %w", err)
+	}
+	report.DuplicateRoots = int64(len(dups))
+	for i, d := range dups {
+		if i == MaxSamples {
+			break
+		}
+		report.Samples[SampleDuplicateRoots] = append(report.Samples[SampleDuplicateRoots], fmt.Sprintf("%s %s", d.Family, d.OSVersion))
+	}
+
+	osVers := []string{}
+	if err := r.conn.Model(&models.Root{}).Distinct().Pluck("os_version", &osVers).Error; err != nil {
+		return Report{}, xerrors.Errorf("Failed to get OS versions of roots. err: %w", err)
+	}
+	fetchMeta, err := r.GetFetchMeta()
+	if err != nil {
+		return Report{}, xerrors.Errorf("Failed to get FetchMeta. err: %w", err)
+	}
+	urls := make([]string, 0, len(fetchMeta.CacheValidators))
+	for u, v := range fetchMeta.CacheValidators {
+		for _, osVer := range v.OSVersions {
+			if !slices.Contains(osVers, osVer) {
+				urls = append(urls, u)
+				break
+			}
+		}
+	}
+	sort.Strings(urls)
+	report.StaleFetchMeta = int64(len(urls))
+	if len(urls) > MaxSamples {
+		urls = urls[:MaxSamples]
+	}
+	if len(urls) > 0 {
+		report.Samples[SampleStaleFetchMeta] = urls
+	}
+	return report, nil
+}
+
+// FixIntegrity deletes the orphaned rows of each table in a transaction, including the children of the orphans, and returns the numbers deleted
+func (r *RDBDriver) FixIntegrity() (Report, error) {
+	report := Report{Orphans: map[string]int64{}}
+	if err := r.conn.Transaction(func(tx *gorm.DB) error {
+		for _, c := range orphanChecks {
+			result := tx.Where(fmt.Sprintf("%s NOT IN (?)", c.fk), tx.Model(c.parent).Select("id")).Delete(c.child)
+			if result.Error != nil {
+				return xerrors.Errorf("Failed to delete orphaned %s. err: %w", c.table, result.Error)
+			}
+			report.Orphans[c.table] = result.RowsAffected
+		}
+		return nil
+	}); err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// Vacuum reclaims the space of the deleted rows: VACUUM after the checkpoint of WAL for SQLite, OPTIMIZE TABLE of the big tables for MySQL
+// and VACUUM for PostgreSQL
+func (r *RDBDriver) Vacuum() error {
+	switch r.name {
+	case dialectSqlite3:
+		if err := r.checkpointWAL(); err != nil {
+			return err
+		}
+		if err := r.conn.Exec("VACUUM").Error; err != nil {
+			return xerrors.Errorf("Failed to VACUUM. err: %w", err)
+		}
+	case dialectMysql:
+		if err := r.conn.Exec(fmt.Sprintf("OPTIMIZE TABLE %s", strings.Join(bigTables(), ", "))).Error; err != nil {
+			return xerrors.Errorf("Failed to OPTIMIZE TABLE. err: %w", err)
+		}
+	case dialectPostgreSQL:
+		if err := r.conn.Exec("VACUUM").Error; err != nil {
+			return xerrors.Errorf("Failed to VACUUM. err: %w", err)
+		}
+	}
+	return nil
+}
+
+// Optimize updates the statistics of the tables for the query planner: PRAGMA optimize followed by the checkpoint of WAL for SQLite,
+// ANALYZE TABLE of the big tables for MySQL and ANALYZE for PostgreSQL
+func (r *RDBDriver) Optimize() error {
+	switch r.name {
+	case dialectSqlite3:
+		// the statistics written by PRAGMA optimize are checkpointed as well
+		if err := r.conn.Exec("PRAGMA optimize").Error; err != nil {
+			return xerrors.Errorf("Failed to optimize. err: %w", err)
+		}
+		if err := r.checkpointWAL(); err != nil {
+			return err
+		}
+	case dialectMysql:
+		if err := r.conn.Exec(fmt.Sprintf("ANALYZE TABLE %s", strings.Join(bigTables(), ", "))).Error; err != nil {
+			return xerrors.Errorf("Failed to ANALYZE TABLE. err: %w", err)
+		}
+	case dialectPostgreSQL:
+		if err := r.conn.Exec("ANALYZE").Error; err != nil {
+			return xerrors.Errorf("Failed to ANALYZE. err: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkpointWAL writes the WAL of SQLite back into the DB file and truncates it, so that the file alone is consistent, e.g. for the backups.
+// It does nothing for the DB not in the WAL mode, and fails when a reader or a writer of another connection keeps the WAL from being
+// checkpointed fully, e.g. the server reading the same file.
+func (r *RDBDriver) checkpointWAL() error {
+	// busy is 1 when the checkpoint is blocked, log and ckpt are the frames in the WAL and the ones checkpointed, -1 if not in the WAL mode
+	var busy, log, ckpt int
+	if err := r.conn.Raw("PRAGMA wal_checkpoint(TRUNCATE)").Row().Scan(&busy, &log, &ckpt); err != nil {
+		return xerrors.Errorf("Failed to checkpoint WAL. err: %w", err)
+	}
+	if busy != 0 || log != ckpt {
+		return xerrors.Errorf("Failed to checkpoint WAL fully, blocked by another connection. busy: %d, frames in WAL: %d, checkpointed: %d", busy, log, ckpt)
+	}
+	return nil
+}
+
+// checkpointAfterInsert checkpoints the WAL of SQLite grown by the insert of the OVAL of a family and a version, unless Option.NoWALCheckpoint,
+// only warning the failure as the OVAL is already committed
+func (r *RDBDriver) checkpointAfterInsert(familyLog log15.Logger) {
+	if r.name != dialectSqlite3 || r.noWALCheckpoint {
+		return
+	}
+	if err := r.checkpointWAL(); err != nil {
+		familyLog.Warn("Failed to checkpoint WAL", "err", err)
+	}
+}
+
+// bigTables returns the quoted names of the tables of the definitions and their children for MySQL
+func bigTables() []string {
+	tables := make([]string, 0, len(orphanChecks))
+	for _, c := range orphanChecks {
+		tables = append(tables, fmt.Sprintf("`%s`", c.table))
+	}
+	return tables
+}
+
+// GetLastModified get last modified time of OVAL in roots
+func (r *RDBDriver) GetLastModified(family, osVer string) (time.Time, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return time.Time{}, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+
+	root := models.Root{}
+	result := r.conn.Where(&models.Root{Family: family, ReleaseKey: osVer, Active: true}).First(&root)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return time.Time{}, xerrors.Errorf("Failed to get root: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		now := time.Now()
+		return now.AddDate(-100, 0, 0), nil
+	}
+	return root.Timestamp, nil
+}
+
+// UpdateLastModified updates the timestamp of the stored OVAL without refreshing it, e.g. the OVAL file has not been modified
+func (r *RDBDriver) UpdateLastModified(family, osVer string, lastModified time.Time) error {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+
+	if err := r.conn.Model(&models.Root{}).Where("family = ? AND release_key = ? AND active = ?", family, osVer, true).Update("timestamp", lastModified).Error; err != nil {
+		return xerrors.Errorf("Failed to update Root timestamp. err: %w", err)
+	}
+	return nil
+}
+
+// IsGovalDictModelV1 determines if the DB was created at the time of goval-dictionary Model v1
+func (r *RDBDriver) IsGovalDictModelV1() (bool, error) {
+	return r.conn.Migrator().HasColumn(&models.FetchMeta{}, "file_name"), nil
+}
+
+// GetFetchMeta get FetchMeta from Database
+func (r *RDBDriver) GetFetchMeta() (fetchMeta *models.FetchMeta, err error) {
+	if err = r.conn.Take(&fetchMeta).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
 		}
 		return &models.FetchMeta{GovalDictRevision: c.Revision, SchemaVersion: models.LatestSchemaVersion, LastFetchedAt: time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC)}, nil
 	}
@@ -434,3 +1608,157 @@ func (r *RDBDriver) UpsertFetchMeta(fetchMeta *models.FetchMeta) error {
 	fetchMeta.SchemaVersion = models.LatestSchemaVersion
 	return r.conn.Save(fetchMeta).Error
 }
+
+// StoreSourceFile replaces the stored file of the same name with file, of which the family and the OS versions are normalized as the ones of Root
+func (r *RDBDriver) StoreSourceFile(file *models.FetchFile) error {
+	family, _, err := formatFamilyAndOSVer(file.Family, "")
+	if err != nil {
+		return xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+	osVers := make([]string, 0, len(file.OSVersions))
+	for _, v := range file.OSVersions {
+		osVers = append(osVers, c.ReleaseKey(family, v))
+	}
+	file.Family, file.OSVersions = family, osVers
+
+	tx := r.conn.Begin()
+	if err := tx.Where("file_name = ?", file.FileName).Delete(&models.FetchFile{}).Error; err != nil {
+		tx.Rollback()
+		return xerrors.Errorf("Failed to delete source file. file: %s, err: %w", file.FileName, err)
+	}
+	file.ID = 0
+	if err := tx.Create(file).Error; err != nil {
+		tx.Rollback()
+		return xerrors.Errorf("Failed to insert source file. file: %s, err: %w", file.FileName, err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return xerrors.Errorf("Failed to commit. err: %w", err)
+	}
+	return nil
+}
+
+// TouchSourceFile updates the fetch timestamp of the stored file of fileName, e.g. not modified since the previous fetch, to keep it from PruneSourceFiles
+func (r *RDBDriver) TouchSourceFile(fileName string, fetchedAt time.Time) error {
+	if err := r.conn.Model(&models.FetchFile{}).Where("file_name = ?", fileName).Update("fetched_at", fetchedAt).Error; err != nil {
+		return xerrors.Errorf("Failed to update source file timestamp. file: %s, err: %w", fileName, err)
+	}
+	return nil
+}
+
+// GetSourceFile returns the stored file of fileName as fetched, the error matching ErrNoSourceFile if not stored
+func (r *RDBDriver) GetSourceFile(fileName string) ([]byte, error) {
+	file := models.FetchFile{}
+	if err := r.conn.Where("file_name = ?", fileName).Take(&file).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, xerrors.Errorf("Failed to get source file. file: %s, err: %w", fileName, ErrNoSourceFile)
+		}
+		return nil, xerrors.Errorf("Failed to get source file. file: %s, err: %w", fileName, err)
+	}
+	if len(file.Data) == 0 {
+		return nil, xerrors.Errorf("Failed to get source file. file: %s, err: %d bytes larger than --store-source-max-size, only its SHA-256 %s is stored: %w", fileName, file.Size, file.SHA256, ErrNoSourceFile)
+	}
+	return file.Decompress()
+}
+
+// PruneSourceFiles deletes the stored files fetched before before, returning the number of them
+func (r *RDBDriver) PruneSourceFiles(before time.Time) (int64, error) {
+	result := r.conn.Where("fetched_at < ?", before).Delete(&models.FetchFile{})
+	if result.Error != nil {
+		return 0, xerrors.Errorf("Failed to delete source files. err: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// appendHistory appends the FetchHistory of the refresh of family and osVer of stat with the counts of the stored OVAL, deleting the ones of them
+// older than --history-retention of the Conf of ctx, kept forever if 0. It only warns on the failure, as the refresh has been done.
+func (r *RDBDriver) appendHistory(ctx context.Context, family, osVer string, timestamp time.Time, stat models.ChangeStat) {
+	if err := r.putHistory(family, osVer, timestamp, stat, c.FromContext(ctx).HistoryRetention); err != nil {
+		familyLogger(ctx, family, osVer).Warn("Failed to append the fetch history", "err", err)
+	}
+}
+
+func (r *RDBDriver) putHistory(family, osVer string, timestamp time.Time, stat models.ChangeStat, retention time.Duration) error {
+	h := models.FetchHistory{
+		Family:      family,
+		OSVersion:   osVer,
+		RefreshedAt: time.Now().UTC(),
+		Timestamp:   timestamp,
+		New:         stat.New,
+		Updated:     stat.Updated,
+		Unchanged:   stat.Unchanged,
+		Removed:     stat.Removed,
+	}
+	roots := r.conn.Model(&models.Root{}).Select("id").Where(&models.Root{Family: family, ReleaseKey: osVer, Active: true})
+	var defs, advisories, cves int64
+	if err := r.conn.Model(&models.Definition{}).Where("root_id IN (?)", roots).Count(&defs).Error; err != nil {
+		return xerrors.Errorf("Failed to count definitions. err: %w", err)
+	}
+	if err := r.conn.Table("advisories").
+		Joins("JOIN definitions ON definitions.id = advisories.definition_id").
+		Where("definitions.root_id IN (?) AND advisories.advisory_id <> ?", roots, "").
+		Distinct("advisories.advisory_id").
+		Count(&advisories).Error; err != nil {
+		return xerrors.Errorf("Failed to count advisories. err: %w", err)
+	}
+	if err := r.conn.Table("cves").
+		Joins("JOIN advisories ON advisories.id = cves.advisory_id").
+		Joins("JOIN definitions ON definitions.id = advisories.definition_id").
+		Where("definitions.root_id IN (?)", roots).
+		Distinct("cves.cve_id").
+		Count(&cves).Error; err != nil {
+		return xerrors.Errorf("Failed to count CVEs. err: %w", err)
+	}
+	h.Definitions, h.Advisories, h.Cves = int(defs), int(advisories), int(cves)
+	if err := r.conn.Create(&h).Error; err != nil {
+		return xerrors.Errorf("Failed to insert fetch history. err: %w", err)
+	}
+
+	if retention <= 0 {
+		return nil
+	}
+	if err := r.conn.Where("family = ? AND os_version = ? AND refreshed_at < ?", family, osVer, h.RefreshedAt.Add(-retention)).Delete(&models.FetchHistory{}).Error; err != nil {
+		return xerrors.Errorf("Failed to delete fetch history. err: %w", err)
+	}
+	return nil
+}
+
+// GetFetchHistory returns the refreshes of the OVAL of family and osVer since since, in the order of them
+func (r *RDBDriver) GetFetchHistory(ctx context.Context, family, osVer string, since time.Time) ([]models.FetchHistory, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+	hs := []models.FetchHistory{}
+	if err := r.conn.WithContext(ctx).
+		Where("family = ? AND os_version = ? AND refreshed_at >= ?", family, osVer, since.UTC()).
+		Order("refreshed_at, id").
+		Find(&hs).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to select fetch history. family: %s, osVer: %s, err: %w", family, osVer, err)
+	}
+	return hs, nil
+}
+
+// purgeSourceFiles removes osVer of family from the OS versions of the stored files, deleting the ones of no OS version left
+func purgeSourceFiles(tx *gorm.DB, family, osVer string) error {
+	files := []models.FetchFile{}
+	if err := tx.Select("id", "os_versions").Where("family = ?", family).Find(&files).Error; err != nil {
+		return xerrors.Errorf("Failed to select source files. err: %w", err)
+	}
+	for _, f := range files {
+		i := slices.Index(f.OSVersions, osVer)
+		if i < 0 {
+			continue
+		}
+		if len(f.OSVersions) == 1 {
+			if err := tx.Delete(&models.FetchFile{}, f.ID).Error; err != nil {
+				return xerrors.Errorf("Failed to delete source file. err: %w", err)
+			}
+			continue
+		}
+		f.OSVersions = slices.Delete(f.OSVersions, i, i+1)
+		if err := tx.Model(&f).Select("OSVersions").Updates(&f).Error; err != nil {
+			return xerrors.Errorf("Failed to update source file. err: %w", err)
+		}
+	}
+	return nil
+}
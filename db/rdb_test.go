@@ -0,0 +1,2853 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/internal/testutil"
+	"github.com/vulsio/goval-dictionary/log"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/debian"
+)
+
+func newTestRDB(t *testing.T) *RDBDriver {
+	t.Helper()
+
+	driver, err := NewDB(dialectSqlite3, filepath.Join(t.TempDir(), "oval.sqlite3"), false, Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	t.Cleanup(func() { _ = driver.CloseDB() })
+	return driver.(errorDB).DB.(*RDBDriver)
+}
+
+func newTestRedHatRoot() *models.Root {
+	return &models.Root{
+		Family:    c.RedHat,
+		OSVersion: "7",
+		Timestamp: time.Date(2017, time.April, 12, 0, 0, 0, 0, time.UTC),
+		Definitions: []models.Definition{
+			{
+				DefinitionID: "oval:com.redhat.rhsa:def:20170933",
+				Title:        "RHSA-2017:0933: kernel security update (Important)",
+				Advisory: models.Advisory{
+					Severity: "Important",
+					Cves:     []models.Cve{{CveID: "CVE-2016-8650"}},
+					Bugzillas: []models.Bugzilla{
+						{BugzillaID: "1395187", URL: "https://bugzilla.redhat.com/1395187", Title: "CVE-2016-8650 kernel: Null pointer dereference via keyctl"},
+						{BugzillaID: "1406921", URL: "https://bugzilla.redhat.com/1406921", Title: "CVE-2016-9793 kernel: Signed overflow for SO_{SND|RCV}BUFFORCE"},
+						{BugzillaID: "1442086", URL: "https://bugzilla.redhat.com/1442086", Title: "CVE-2017-2618 kernel: Off-by-one error in selinux_setprocattr"},
+					},
+					AffectedCPEList: []models.Cpe{
+						{Cpe: "cpe:/o:redhat:enterprise_linux:7"},
+						{Cpe: "cpe:/o:redhat:enterprise_linux:7::server"},
+						{Cpe: "cpe:/o:redhat:enterprise_linux:7::workstation"},
+					},
+				},
+				AffectedPacks: []models.Package{{Name: "kernel", Version: "0:3.10.0-514.16.1.el7"}},
+			},
+		},
+	}
+}
+
+func TestRDBDriver_InsertOval(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+
+	// insert twice to check that refreshing does not leave orphaned rows
+	for i := 0; i < 2; i++ {
+		if _, err := r.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+			t.Fatalf("[%d] Failed to InsertOval. err: %s", i, err)
+		}
+	}
+
+	defs, err := r.GetByCveID(context.Background(), c.RedHat, "7", "CVE-2016-8650", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByCveID. err: %s", err)
+	}
+	if len(defs) != 1 {
+		t.Fatalf("expected: 1 definition, actual: %d", len(defs))
+	}
+	if len(defs[0].Advisory.Bugzillas) != 3 {
+		t.Errorf("expected: 3 bugzillas, actual: %d", len(defs[0].Advisory.Bugzillas))
+	}
+
+	if len(defs[0].Advisory.AffectedCPEList) != 3 {
+		t.Errorf("expected: 3 cpes, actual: %d", len(defs[0].Advisory.AffectedCPEList))
+	}
+
+	for _, m := range []interface{}{&models.Bugzilla{}, &models.Cpe{}} {
+		var count int64
+		if err := r.conn.Model(m).Count(&count).Error; err != nil {
+			t.Fatalf("Failed to count %T. err: %s", m, err)
+		}
+		if count != 3 {
+			t.Errorf("expected: 3 %T rows, actual: %d", m, count)
+		}
+	}
+}
+
+func TestRDBDriver_InsertOvalLogFields(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+
+	records := []*log15.Record{}
+	log15.Root().SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	defer log15.Root().SetHandler(log15.StderrHandler)
+
+	// the fields of the fetch, e.g. centos of fetch redhat, are overridden by the ones stored
+	ctx := log.NewContext(context.Background(), log.Fields{"Family": c.CentOS, "File": "rhel-7.oval.xml.bz2"})
+	// inserted twice to log deleting the old definitions as well
+	for i := 0; i < 2; i++ {
+		root := newTestRedHatRoot()
+		root.OSVersion = "7.9"
+		if _, err := r.InsertOval(ctx, root); err != nil {
+			t.Fatalf("[%d] Failed to InsertOval. err: %s", i, err)
+		}
+	}
+
+	if len(records) == 0 {
+		t.Fatalf("expected: the logs of InsertOval, actual: none")
+	}
+	want := map[string]interface{}{"File": "rhel-7.oval.xml.bz2", "Family": c.RedHat, "Version": "7"}
+	for _, rec := range records {
+		got := map[string]interface{}{}
+		for i := 0; i+1 < len(rec.Ctx); i += 2 {
+			k := rec.Ctx[i].(string)
+			if _, ok := got[k]; ok {
+				t.Errorf("%s: expected: %s once, actual: %v", rec.Msg, k, rec.Ctx)
+			}
+			got[k] = rec.Ctx[i+1]
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("%s: %s: expected: %v, actual: %v", rec.Msg, k, v, got[k])
+			}
+		}
+	}
+}
+
+func TestRDBDriver_InsertOvalError(t *testing.T) {
+	viper.Set("batch-size", 10)
+	viper.Set("debug", true)
+	defer viper.Set("batch-size", nil)
+	defer viper.Set("debug", nil)
+
+	dumps := []string{}
+	log15.Root().SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			if r.Ctx[i] == "Dump" {
+				dumps = append(dumps, r.Ctx[i+1].(string))
+			}
+		}
+		return nil
+	}))
+	defer log15.Root().SetHandler(log15.StderrHandler)
+
+	// the titles of 1 MB, which the error must not carry
+	title := strings.Repeat("kernel security update ", 1<<16)
+	tests := []struct {
+		name string
+		defs []models.Definition
+		want []string
+	}{
+		{
+			// the definitions of the same primary key in a batch
+			name: "definitions",
+			defs: []models.Definition{
+				{ID: 1, DefinitionID: "oval:com.redhat.rhsa:def:20170001", Title: title},
+				{ID: 2, DefinitionID: "oval:com.redhat.rhsa:def:20170002", Title: title},
+				{ID: 1, DefinitionID: "oval:com.redhat.rhsa:def:20170003", Title: title},
+			},
+			want: []string{"Failed to insert Definitions.", "family: redhat, osVer: 7,", "definitions: oval:com.redhat.rhsa:def:20170001 to oval:com.redhat.rhsa:def:20170003 (3)", "UNIQUE constraint failed"},
+		},
+		{
+			name: "affected packages",
+			defs: []models.Definition{
+				{DefinitionID: "oval:com.redhat.rhsa:def:20170001", Title: "RHSA-2017:0001: kernel security update (Important)"},
+				{DefinitionID: "oval:com.redhat.rhsa:def:20170002", Title: title, AffectedPacks: []models.Package{{ID: 1, Name: "kernel"}, {ID: 1, Name: "kernel-tools"}}},
+			},
+			want: []string{"Failed to insert AffectedPacks.", "family: redhat, osVer: 7,", `definition: oval:com.redhat.rhsa:def:20170002 "kernel security update`, "bytes truncated", "UNIQUE constraint failed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dumps = dumps[:0]
+			r := newTestRDB(t)
+			_, err := r.InsertOval(context.Background(), &models.Root{Family: "RedHat", OSVersion: "7", Definitions: tt.defs})
+			var ie *InsertError
+			if !xerrors.As(err, &ie) {
+				t.Fatalf("expected: *InsertError, actual: %v", err)
+			}
+			if len(err.Error()) > 1024 {
+				t.Errorf("expected: within 1 KB, actual: %d bytes", len(err.Error()))
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected: %q in the error, actual: %s", want, err)
+				}
+			}
+			if len(dumps) != 1 || len(dumps[0]) > maxInsertErrorDump+64 || !strings.Contains(dumps[0], ie.DefinitionID) {
+				t.Errorf("expected: a dump of the batch within %d bytes by --debug, actual: %d dumps", maxInsertErrorDump, len(dumps))
+			}
+		})
+	}
+}
+
+func TestRDBDriver_FamilyNormalized(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	driver, err := NewDB(dialectSqlite3, filepath.Join(t.TempDir(), "oval.sqlite3"), false, Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	root := newTestRedHatRoot()
+	root.Family = "RedHat"
+	if _, err := driver.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	for _, family := range []string{c.RedHat, "RedHat", "Red Hat", "rhel", c.CentOS, "CentOS"} {
+		defs, err := driver.GetByPackName(context.Background(), family, "7", "kernel", "")
+		if err != nil || len(defs) != 1 {
+			t.Errorf("%q: GetByPackName: expected: 1 definition, actual: %d, err: %v", family, len(defs), err)
+		}
+		defs, err = driver.GetByCveID(context.Background(), family, "7.9", "CVE-2016-8650", "")
+		if err != nil || len(defs) != 1 {
+			t.Errorf("%q: GetByCveID: expected: 1 definition, actual: %d, err: %v", family, len(defs), err)
+		}
+		defs, err = driver.GetByCpe(context.Background(), family, "7", "cpe:/o:redhat:enterprise_linux:7::server", "")
+		if err != nil || len(defs) != 1 {
+			t.Errorf("%q: GetByCpe: expected: 1 definition, actual: %d, err: %v", family, len(defs), err)
+		}
+	}
+	stats, err := driver.GetRootStats()
+	if err != nil || len(stats) != 1 || stats[0].Family != c.RedHat {
+		t.Errorf("expected: the OVAL stored as redhat, actual: %+v, err: %v", stats, err)
+	}
+	if _, err := driver.GetByPackName(context.Background(), "Red Hot", "7", "kernel", ""); !xerrors.Is(err, ErrUnknownFamily) {
+		t.Errorf("expected: ErrUnknownFamily, actual: %v", err)
+	}
+}
+
+func TestRDBDriver_GetByCpe(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	if _, err := r.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		cpe  string
+		want int
+	}{
+		{name: "exact", cpe: "cpe:/o:redhat:enterprise_linux:7::server", want: 1},
+		// the prefix matches all the 3 CPEs of the advisory, which selects the definition once
+		{name: "prefix", cpe: "cpe:/o:redhat:enterprise_linux:7", want: 1},
+		{name: "not matched", cpe: "cpe:/o:redhat:enterprise_linux:8", want: 0},
+		{name: "no wildcard", cpe: "cpe:/o:redhat:enterprise%linux", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs, err := r.GetByCpe(context.Background(), c.RedHat, "7", tt.cpe, "")
+			if err != nil {
+				t.Fatalf("Failed to GetByCpe. err: %s", err)
+			}
+			if len(defs) != tt.want {
+				t.Fatalf("expected: %d definitions, actual: %d", tt.want, len(defs))
+			}
+			for _, d := range defs {
+				if len(d.Advisory.AffectedCPEList) != 3 || len(d.Advisory.Bugzillas) != 3 || len(d.AffectedPacks) != 1 {
+					t.Errorf("expected: the definition with the children preloaded, actual: %+v", d)
+				}
+			}
+		})
+	}
+}
+
+func TestRDBDriver_InsertOvalDebian(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+
+	moreInfo := strings.Repeat("The expandArguments function in the database abstraction API in Drupal core 7.x before 7.32 does not properly construct prepared statements.\n", 500)
+	root := &models.Root{
+		Family:    c.Debian,
+		OSVersion: "7",
+		Definitions: []models.Definition{
+			{
+				DefinitionID: "oval:org.debian:def:20143704",
+				Title:        "CVE-2014-3704",
+				Advisory:     models.Advisory{Cves: []models.Cve{{CveID: "CVE-2014-3704"}}},
+				Debian: &models.Debian{
+					DSA:      "DSA-3051-1",
+					MoreInfo: moreInfo,
+					Date:     time.Date(2014, time.October, 15, 0, 0, 0, 0, time.UTC),
+				},
+				AffectedPacks: []models.Package{{Name: "drupal7", Version: "7.14-2+deb7u7"}},
+			},
+		},
+	}
+	if _, err := r.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	byPack, err := r.GetByPackName(context.Background(), c.Debian, "7", "drupal7", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	byCve, err := r.GetByCveID(context.Background(), c.Debian, "7", "CVE-2014-3704", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByCveID. err: %s", err)
+	}
+	for _, defs := range [][]models.Definition{byPack, byCve} {
+		if len(defs) != 1 || defs[0].Debian == nil {
+			t.Fatalf("expected: 1 definition with Debian, actual: %#v", defs)
+		}
+		if defs[0].Debian.DSA != "DSA-3051-1" || defs[0].Debian.MoreInfo != moreInfo {
+			t.Errorf("expected: DSA-3051-1 and %d bytes of moreinfo, actual: %s and %d bytes", len(moreInfo), defs[0].Debian.DSA, len(defs[0].Debian.MoreInfo))
+		}
+	}
+}
+
+func TestRDBDriver_InsertOvalDebianPerRelease(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	// the fix is available in stretch only, jessie is still vulnerable
+	oval := `<oval_definitions>
+  <definitions>
+    <definition class="vulnerability" id="oval:org.debian:def:20175617" version="1">
+      <metadata>
+        <title>CVE-2017-5617</title>
+        <reference ref_id="CVE-2017-5617" ref_url="https://security-tracker.debian.org/tracker/CVE-2017-5617" source="CVE"/>
+        <description>svgsalamander - security update</description>
+      </metadata>
+      <criteria comment="Platform section" operator="OR">
+        <criteria comment="Release section" operator="AND">
+          <criterion comment="Debian GNU/Linux 9 is installed" test_ref="oval:org.debian.oval:tst:1"/>
+          <criteria comment="Architecture section" operator="OR">
+            <criteria comment="Architecture independent section" operator="AND">
+              <criterion comment="all architecture" test_ref="oval:org.debian.oval:tst:2"/>
+              <criterion comment="svgsalamander DPKG is earlier than 1.1.1+dfsg-2" test_ref="oval:org.debian.oval:tst:3"/>
+            </criteria>
+          </criteria>
+        </criteria>
+      </criteria>
+    </definition>
+  </definitions>
+</oval_definitions>`
+	var ovalroot debian.Root
+	if err := xml.Unmarshal([]byte(oval), &ovalroot); err != nil {
+		t.Fatalf("Failed to unmarshal. err: %s", err)
+	}
+
+	r := newTestRDB(t)
+	for _, v := range []string{"8", "9"} {
+		defs, _ := debian.ConvertToModel(v, &ovalroot)
+		root := &models.Root{Family: c.Debian, OSVersion: v, Definitions: defs, Timestamp: time.Now()}
+		if _, err := r.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+
+	tests := []struct {
+		osVer    string
+		expected []models.Package
+	}{
+		{
+			osVer:    "8",
+			expected: []models.Package{{Name: "svgsalamander", NotFixedYet: true}},
+		},
+		{
+			osVer:    "9",
+			expected: []models.Package{{Name: "svgsalamander", Version: "1.1.1+dfsg-2"}},
+		},
+	}
+	for _, tt := range tests {
+		defs, err := r.GetByPackName(context.Background(), c.Debian, tt.osVer, "svgsalamander", "")
+		if err != nil {
+			t.Fatalf("Failed to GetByPackName. err: %s", err)
+		}
+		if len(defs) != 1 {
+			t.Fatalf("[%s] expected: 1 definition, actual: %d", tt.osVer, len(defs))
+		}
+		if actual := stripPackIDs(defs[0].AffectedPacks); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("[%s] expected: %+v, actual: %+v", tt.osVer, tt.expected, actual)
+		}
+	}
+}
+
+func TestRDBDriver_InsertOvalUnpatched(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+
+	root := newTestRedHatRoot()
+	root.Definitions = append(root.Definitions, models.Definition{
+		DefinitionID: "oval:com.redhat.cve:def:20163695",
+		Title:        "CVE-2016-3695 kernel: Mishandling of the einj_error_inject in the APEI",
+		Advisory: models.Advisory{
+			Severity: "Low",
+			Cves:     []models.Cve{{CveID: "CVE-2016-3695"}},
+			State:    models.StateWillNotFix,
+		},
+		AffectedPacks: []models.Package{{Name: "kernel", NotFixedYet: true}},
+	})
+	if _, err := r.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	defs, err := r.GetByCveID(context.Background(), c.RedHat, "7", "CVE-2016-3695", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByCveID. err: %s", err)
+	}
+	if len(defs) != 1 {
+		t.Fatalf("expected: 1 definition, actual: %d", len(defs))
+	}
+	if defs[0].Advisory.State != models.StateWillNotFix {
+		t.Errorf("expected: %q, actual: %q", models.StateWillNotFix, defs[0].Advisory.State)
+	}
+	if expected := []models.Package{{Name: "kernel", NotFixedYet: true}}; !reflect.DeepEqual(stripPackIDs(defs[0].AffectedPacks), expected) {
+		t.Errorf("expected: %+v, actual: %+v", expected, defs[0].AffectedPacks)
+	}
+
+	defs, err = r.GetByPackName(context.Background(), c.RedHat, "7", "kernel", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	if len(defs) != 2 {
+		t.Errorf("expected: 2 definitions, actual: %d", len(defs))
+	}
+}
+
+func stripPackIDs(packs []models.Package) []models.Package {
+	stripped := make([]models.Package, 0, len(packs))
+	for _, p := range packs {
+		p.ID, p.DefinitionID = 0, 0
+		stripped = append(stripped, p)
+	}
+	return stripped
+}
+
+func TestRDBDriver_InsertOvalCancel(t *testing.T) {
+	viper.Set("batch-size", 1)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	if _, err := r.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	// cancel after the new inactive Root is created in the transaction
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := r.conn.Callback().Create().After("gorm:create").Register("test:cancel", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Dest.(**models.Root); ok {
+			cancel()
+		}
+	}); err != nil {
+		t.Fatalf("Failed to register callback. err: %s", err)
+	}
+
+	// the cancelled refresh is rolled back, keeping the stored definitions
+	root := &models.Root{Family: c.RedHat, OSVersion: "7", Timestamp: time.Now(), Definitions: []models.Definition{{DefinitionID: "oval:com.redhat.rhsa:def:1"}, {DefinitionID: "oval:com.redhat.rhsa:def:2"}}}
+	if _, err := r.InsertOval(ctx, root); !xerrors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancellation, actual: %v", err)
+	}
+	defs, err := r.GetByCveID(context.Background(), c.RedHat, "7", "CVE-2016-8650", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByCveID. err: %s", err)
+	}
+	if len(defs) != 1 {
+		t.Fatalf("expected: 1 definition, actual: %d", len(defs))
+	}
+	var roots int64
+	if err := r.conn.Model(&models.Root{}).Count(&roots).Error; err != nil || roots != 1 {
+		t.Errorf("expected: the old Root only, actual: %d roots, err: %v", roots, err)
+	}
+}
+
+func TestRDBDriver_InsertOvalSwap(t *testing.T) {
+	viper.Set("batch-size", 1)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	if _, err := r.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	// the lookups during the insert of the new definitions are served of the old ones
+	served := []int{}
+	if err := r.conn.Callback().Create().After("gorm:create").Register("test:lookup", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Dest.([]models.Definition); !ok {
+			return
+		}
+		defs, err := r.GetByPackName(context.Background(), c.RedHat, "7", "kernel", "")
+		if err != nil {
+			t.Errorf("Failed to GetByPackName. err: %s", err)
+		}
+		served = append(served, len(defs))
+	}); err != nil {
+		t.Fatalf("Failed to register callback. err: %s", err)
+	}
+	defer func() { _ = r.conn.Callback().Create().Remove("test:lookup") }()
+
+	root := &models.Root{Family: c.RedHat, OSVersion: "7", Timestamp: time.Now(), Definitions: []models.Definition{
+		{DefinitionID: "oval:com.redhat.rhsa:def:1", AffectedPacks: []models.Package{{Name: "bash"}}},
+		{DefinitionID: "oval:com.redhat.rhsa:def:2", AffectedPacks: []models.Package{{Name: "bash"}}},
+	}}
+	if _, err := r.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	if !reflect.DeepEqual(served, []int{1, 1}) {
+		t.Errorf("expected: the old definition served during the insert, actual: %v", served)
+	}
+
+	// swapped for the new ones, with the old Root deleted
+	for pack, want := range map[string]int{"kernel": 0, "bash": 2} {
+		if defs, err := r.GetByPackName(context.Background(), c.RedHat, "7", pack, ""); err != nil || len(defs) != want {
+			t.Errorf("%s: expected: %d definitions, actual: %d, err: %v", pack, want, len(defs), err)
+		}
+	}
+	roots := []models.Root{}
+	if err := r.conn.Find(&roots).Error; err != nil {
+		t.Fatalf("Failed to select roots. err: %s", err)
+	}
+	if len(roots) != 1 || roots[0].ID != root.ID || !roots[0].Active {
+		t.Errorf("expected: the new active Root only, actual: %+v", roots)
+	}
+	var defs int64
+	if err := r.conn.Model(&models.Definition{}).Count(&defs).Error; err != nil || defs != 2 {
+		t.Errorf("expected: the new definitions only, actual: %d, err: %v", defs, err)
+	}
+}
+
+func TestRDBDriver_InsertOvalInactiveRoot(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	if _, err := r.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	// the inactive Root left by the refresh crashed before the swap
+	left := &models.Root{Family: c.RedHat, OSVersion: "7", ReleaseKey: "7", Timestamp: time.Now(), Definitions: []models.Definition{
+		{DefinitionID: "oval:com.redhat.rhsa:def:1", Advisory: models.Advisory{Cves: []models.Cve{{CveID: "CVE-2016-8650"}}}, AffectedPacks: []models.Package{{Name: "kernel"}}},
+	}}
+	if err := r.conn.Create(left).Error; err != nil {
+		t.Fatalf("Failed to create Root. err: %s", err)
+	}
+	if err := r.conn.Model(&models.Root{}).Where("id = ?", left.ID).Update("active", false).Error; err != nil {
+		t.Fatalf("Failed to deactivate Root. err: %s", err)
+	}
+
+	// is never served
+	if defs, err := r.GetByPackName(context.Background(), c.RedHat, "7", "kernel", ""); err != nil || len(defs) != 1 || defs[0].DefinitionID != "oval:com.redhat.rhsa:def:20170933" {
+		t.Errorf("GetByPackName: expected: the active definition only, actual: %+v, err: %v", defs, err)
+	}
+	if defs, err := r.GetByCveID(context.Background(), c.RedHat, "7", "CVE-2016-8650", ""); err != nil || len(defs) != 1 {
+		t.Errorf("GetByCveID: expected: 1 definition, actual: %d, err: %v", len(defs), err)
+	}
+	if stats, err := r.GetRootStats(); err != nil || len(stats) != 1 || stats[0].Definitions != 1 {
+		t.Errorf("GetRootStats: expected: the active Root only, actual: %+v, err: %v", stats, err)
+	}
+
+	// and deleted by the next refresh
+	if _, err := r.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	var roots, defs int64
+	if err := r.conn.Model(&models.Root{}).Count(&roots).Error; err != nil || roots != 1 {
+		t.Errorf("expected: 1 Root, actual: %d, err: %v", roots, err)
+	}
+	if err := r.conn.Model(&models.Definition{}).Count(&defs).Error; err != nil || defs != 1 {
+		t.Errorf("expected: 1 definition, actual: %d, err: %v", defs, err)
+	}
+}
+
+func TestRDBDriver_ReadOnly(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	dbPath := filepath.Join(t.TempDir(), "oval.sqlite3")
+	if _, err := NewDB(dialectSqlite3, dbPath, false, Option{ReadOnly: true}); err == nil {
+		t.Errorf("expected: the error of the DB not existing")
+	}
+
+	rw, err := NewDB(dialectSqlite3, dbPath, false, Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	if _, err := rw.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	if err := rw.CloseDB(); err != nil {
+		t.Fatalf("Failed to CloseDB. err: %s", err)
+	}
+
+	ro, err := NewDB(dialectSqlite3, dbPath, false, Option{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer ro.CloseDB()
+	defs, err := ro.GetByCveID(context.Background(), c.RedHat, "7", "CVE-2016-8650", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByCveID. err: %s", err)
+	}
+	if len(defs) != 1 {
+		t.Errorf("expected: 1 definition, actual: %d", len(defs))
+	}
+	if err := ro.UpdateLastModified(c.RedHat, "7", time.Now()); err == nil {
+		t.Errorf("expected: the error of writing the read-only DB")
+	}
+}
+
+func TestRDBDriver_InsertOvalRefuseEmpty(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	if _, err := r.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	// a truncated OVAL converted into no definitions must not wipe the stored ones
+	empty := &models.Root{Family: c.RedHat, OSVersion: "7", Timestamp: time.Now()}
+	if _, err := r.InsertOval(context.Background(), empty); err == nil {
+		t.Fatalf("expected an error on replacing with empty OVAL")
+	}
+	defs, err := r.GetByCveID(context.Background(), c.RedHat, "7", "CVE-2016-8650", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByCveID. err: %s", err)
+	}
+	if len(defs) != 1 {
+		t.Fatalf("expected: 1 definition, actual: %d", len(defs))
+	}
+
+	viper.Set("force-empty", true)
+	defer viper.Set("force-empty", nil)
+	if _, err := r.InsertOval(context.Background(), &models.Root{Family: c.RedHat, OSVersion: "7", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to InsertOval with force-empty. err: %s", err)
+	}
+	defs, err = r.GetByCveID(context.Background(), c.RedHat, "7", "CVE-2016-8650", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByCveID. err: %s", err)
+	}
+	if len(defs) != 0 {
+		t.Errorf("expected: 0 definitions, actual: %d", len(defs))
+	}
+}
+
+func TestRDBDriver_InsertOvalSourceChange(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	root := newTestRedHatRoot()
+	root.Source = "rhel-7.oval.xml.bz2"
+	if _, err := r.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	// RedHat 7 of the OVAL including the unpatched definitions loaded over the one of RHEL7 by mistake
+	unpatched := newTestRedHatRoot()
+	unpatched.Source = "rhel-7-including-unpatched.oval.xml.bz2"
+	unpatched.Definitions = append(unpatched.Definitions, models.Definition{DefinitionID: "oval:com.redhat.cve:def:20163695", Title: "CVE-2016-3695"})
+	if _, err := r.InsertOval(context.Background(), unpatched); !xerrors.Is(err, ErrSourceChanged) {
+		t.Fatalf("expected: ErrSourceChanged, actual: %v", err)
+	}
+	stored := models.Root{}
+	if err := r.conn.Where(&models.Root{Family: c.RedHat, OSVersion: "7"}).First(&stored).Error; err != nil {
+		t.Fatalf("Failed to select root. err: %s", err)
+	}
+	if n, err := r.CountDefs(c.RedHat, "7"); err != nil || n != 1 || stored.Source != root.Source {
+		t.Fatalf("expected: 1 definition of %s kept, actual: %d of %s, err: %v", root.Source, n, stored.Source, err)
+	}
+
+	records := []*log15.Record{}
+	log15.Root().SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	defer log15.Root().SetHandler(log15.StderrHandler)
+
+	viper.Set("allow-source-change", true)
+	defer viper.Set("allow-source-change", nil)
+	unpatched = newTestRedHatRoot()
+	unpatched.Source = "rhel-7-including-unpatched.oval.xml.bz2"
+	unpatched.Definitions = append(unpatched.Definitions, models.Definition{DefinitionID: "oval:com.redhat.cve:def:20163695", Title: "CVE-2016-3695"})
+	stat, err := r.InsertOval(context.Background(), unpatched)
+	if err != nil {
+		t.Fatalf("Failed to InsertOval with allow-source-change. err: %s", err)
+	}
+	want := &models.SourceChange{From: "rhel-7.oval.xml.bz2", To: "rhel-7-including-unpatched.oval.xml.bz2", FromDefinitions: 1, ToDefinitions: 2}
+	if !reflect.DeepEqual(stat.SourceChange, want) {
+		t.Errorf("expected: %+v, actual: %+v", want, stat.SourceChange)
+	}
+	warned := false
+	for _, rec := range records {
+		warned = warned || rec.Lvl == log15.LvlWarn && rec.Msg == "Replacing the OVAL loaded from another source file, as allowed by --allow-source-change"
+	}
+	if !warned {
+		t.Errorf("expected: the warning of the source changed, actual: %v", records)
+	}
+
+	// neither the same source nor the unknown one is a change
+	for _, source := range []string{"rhel-7-including-unpatched.oval.xml.bz2", ""} {
+		viper.Set("allow-source-change", nil)
+		root := newTestRedHatRoot()
+		root.Source = source
+		stat, err := r.InsertOval(context.Background(), root)
+		if err != nil || stat.SourceChange != nil {
+			t.Errorf("source %q: expected: no source change, actual: %+v, err: %v", source, stat.SourceChange, err)
+		}
+	}
+}
+
+func TestRDBDriver_SourceFile(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	if _, err := r.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	body := []byte(`<oval_definitions><generator><timestamp>2017-04-12T00:00:00</timestamp></generator></oval_definitions>`)
+	fetchedAt := time.Date(2023, time.July, 6, 4, 0, 10, 0, time.UTC)
+	file, err := models.NewFetchFile("rhel-7.oval.xml", "https://www.redhat.com/security/data/oval/v2/RHEL7/rhel-7.oval.xml.bz2", c.RedHat, body, fetchedAt)
+	if err != nil {
+		t.Fatalf("Failed to NewFetchFile. err: %s", err)
+	}
+	file.OSVersions = []string{"7.9"}
+	if err := r.StoreSourceFile(&file); err != nil {
+		t.Fatalf("Failed to StoreSourceFile. err: %s", err)
+	}
+	// stored again, replacing the one of the same name
+	if err := r.StoreSourceFile(&file); err != nil {
+		t.Fatalf("Failed to StoreSourceFile. err: %s", err)
+	}
+	got, err := r.GetSourceFile("rhel-7.oval.xml")
+	if err != nil {
+		t.Fatalf("Failed to GetSourceFile. err: %s", err)
+	}
+	sum := sha256.Sum256(got)
+	if !bytes.Equal(got, body) || hex.EncodeToString(sum[:]) != file.SHA256 {
+		t.Errorf("expected: %q of %s, actual: %q of %x", body, file.SHA256, got, sum)
+	}
+	stored := []models.FetchFile{}
+	if err := r.conn.Find(&stored).Error; err != nil {
+		t.Fatalf("Failed to select source files. err: %s", err)
+	}
+	if len(stored) != 1 || !reflect.DeepEqual(stored[0].OSVersions, []string{"7"}) {
+		t.Errorf("expected: 1 file of the OS version 7, actual: %+v", stored)
+	}
+	if _, err := r.GetSourceFile("rhel-8.oval.xml"); !xerrors.Is(err, ErrNoSourceFile) {
+		t.Errorf("expected: ErrNoSourceFile, actual: %v", err)
+	}
+
+	// only the SHA-256 of the file larger than --store-source-max-size
+	large := file
+	large.FileName, large.Data = "com.redhat.rhsa-RHEL7.xml", nil
+	if err := r.StoreSourceFile(&large); err != nil {
+		t.Fatalf("Failed to StoreSourceFile. err: %s", err)
+	}
+	if _, err := r.GetSourceFile("com.redhat.rhsa-RHEL7.xml"); !xerrors.Is(err, ErrNoSourceFile) || !strings.Contains(err.Error(), file.SHA256) {
+		t.Errorf("expected: ErrNoSourceFile with the SHA-256, actual: %v", err)
+	}
+
+	// the file found not modified is kept from the prune
+	if err := r.TouchSourceFile("rhel-7.oval.xml", fetchedAt.Add(48*time.Hour)); err != nil {
+		t.Fatalf("Failed to TouchSourceFile. err: %s", err)
+	}
+	n, err := r.PruneSourceFiles(fetchedAt.Add(24 * time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to PruneSourceFiles. err: %s", err)
+	}
+	if _, err := r.GetSourceFile("rhel-7.oval.xml"); n != 1 || err != nil {
+		t.Errorf("expected: 1 file pruned and rhel-7.oval.xml kept, actual: %d pruned, err: %v", n, err)
+	}
+
+	// purged with the OVAL of its OS version
+	if _, err := r.PurgeOval(context.Background(), c.RedHat, "7"); err != nil {
+		t.Fatalf("Failed to PurgeOval. err: %s", err)
+	}
+	if _, err := r.GetSourceFile("rhel-7.oval.xml"); !xerrors.Is(err, ErrNoSourceFile) {
+		t.Errorf("expected: ErrNoSourceFile after purge, actual: %v", err)
+	}
+}
+
+func TestRDBDriver_GetByPackNameClass(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+
+	pack := models.Package{Name: "glib2-tools", Version: "0:2.54.3-4.24.1"}
+	root := &models.Root{
+		Family:    c.SUSEEnterpriseServer,
+		OSVersion: "15.1",
+		Timestamp: time.Now(),
+		Definitions: []models.Definition{
+			{
+				DefinitionID:  "oval:org.opensuse.security:def:20210857",
+				Class:         models.ClassPatch,
+				Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2021-27218"}}},
+				AffectedPacks: []models.Package{pack},
+			},
+			{
+				DefinitionID:  "oval:org.opensuse.security:def:202127218",
+				Class:         models.ClassVulnerability,
+				Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2021-27218"}}},
+				AffectedPacks: []models.Package{pack},
+			},
+		},
+	}
+	if _, err := r.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	tests := []struct {
+		classes  []string
+		expected []string
+	}{
+		{
+			expected: []string{"oval:org.opensuse.security:def:20210857", "oval:org.opensuse.security:def:202127218"},
+		},
+		{
+			classes:  []string{models.ClassPatch},
+			expected: []string{"oval:org.opensuse.security:def:20210857"},
+		},
+		{
+			classes:  []string{models.ClassVulnerability},
+			expected: []string{"oval:org.opensuse.security:def:202127218"},
+		},
+	}
+	for i, tt := range tests {
+		defs, err := r.GetByPackName(context.Background(), c.SUSEEnterpriseServer, "15.1", "glib2-tools", "", tt.classes...)
+		if err != nil {
+			t.Fatalf("[%d] Failed to GetByPackName. err: %s", i, err)
+		}
+		ids := []string{}
+		for _, d := range defs {
+			ids = append(ids, d.DefinitionID)
+		}
+		sort.Strings(ids)
+		if !reflect.DeepEqual(ids, tt.expected) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.expected, ids)
+		}
+	}
+}
+
+func TestRDBDriver_GetByPackNames(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+
+	root := newTestRedHatRoot()
+	root.Definitions = append(root.Definitions, models.Definition{
+		DefinitionID: "oval:com.redhat.rhsa:def:20171842",
+		Advisory:     models.Advisory{Cves: []models.Cve{{CveID: "CVE-2017-1000364"}}},
+		AffectedPacks: []models.Package{
+			{Name: "kernel", Version: "0:3.10.0-693.el7"},
+			{Name: "kernel-tools", Version: "0:3.10.0-693.el7"},
+			{Name: "kernel-tools", Version: "0:3.10.0-693.el8"},
+		},
+	})
+	if _, err := r.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	// the queries are counted to be the same however many packages are looked up
+	queries := 0
+	if err := r.conn.Callback().Query().After("gorm:query").Register("test:count", func(*gorm.DB) { queries++ }); err != nil {
+		t.Fatalf("Failed to register callback. err: %s", err)
+	}
+
+	tests := []struct {
+		packNames []string
+		expected  map[string][]string
+	}{
+		{
+			packNames: []string{"kernel"},
+			expected:  map[string][]string{"kernel": {"oval:com.redhat.rhsa:def:20170933", "oval:com.redhat.rhsa:def:20171842"}},
+		},
+		{
+			packNames: []string{"kernel", "kernel-tools", "openssl"},
+			expected: map[string][]string{
+				"kernel":       {"oval:com.redhat.rhsa:def:20170933", "oval:com.redhat.rhsa:def:20171842"},
+				"kernel-tools": {"oval:com.redhat.rhsa:def:20171842"},
+				"openssl":      {},
+			},
+		},
+	}
+	wantQueries := -1
+	for i, tt := range tests {
+		queries = 0
+		m, err := r.GetByPackNames(context.Background(), c.RedHat, "7", tt.packNames, "")
+		if err != nil {
+			t.Fatalf("[%d] Failed to GetByPackNames. err: %s", i, err)
+		}
+		if wantQueries < 0 {
+			wantQueries = queries
+		} else if queries != wantQueries {
+			t.Errorf("[%d] queries: expected: %d, actual: %d", i, wantQueries, queries)
+		}
+
+		actual := map[string][]string{}
+		for name, defs := range m {
+			actual[name] = []string{}
+			for _, d := range defs {
+				actual[name] = append(actual[name], d.DefinitionID)
+			}
+			sort.Strings(actual[name])
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.expected, actual)
+		}
+
+		// the same definitions as GetByPackName, which repeats the definition of the package of more than one version, once each
+		for _, name := range tt.packNames {
+			defs, err := r.GetByPackName(context.Background(), c.RedHat, "7", name, "")
+			if err != nil {
+				t.Fatalf("[%d] Failed to GetByPackName. err: %s", i, err)
+			}
+			expected := map[string][]models.Package{}
+			for _, d := range defs {
+				expected[d.DefinitionID] = d.AffectedPacks
+			}
+			batch := map[string][]models.Package{}
+			for _, d := range m[name] {
+				batch[d.DefinitionID] = d.AffectedPacks
+			}
+			if len(batch) != len(m[name]) || !reflect.DeepEqual(batch, expected) {
+				t.Errorf("[%d] %s: expected: %v, actual: %v", i, name, expected, m[name])
+			}
+		}
+	}
+}
+
+func TestRDBDriver_GetByPackNameOmit(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	root := newTestRedHatRoot()
+	root.Definitions[0].References = []models.Reference{{Source: "RHSA", RefID: "RHSA-2017:0933", RefURL: "https://access.redhat.com/errata/RHSA-2017:0933"}}
+	if _, err := r.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	queries := 0
+	if err := r.conn.Callback().Query().After("gorm:query").Register("test:count", func(*gorm.DB) { queries++ }); err != nil {
+		t.Fatalf("Failed to register callback. err: %s", err)
+	}
+
+	queries = 0
+	full, err := r.GetByPackName(context.Background(), c.RedHat, "7", "kernel", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	fullQueries := queries
+	if len(full) != 1 || len(full[0].AffectedPacks) != 1 || len(full[0].References) != 1 {
+		t.Fatalf("expected: 1 definition with the package and the reference, actual: %+v", full)
+	}
+
+	tests := []struct {
+		omit        Omit
+		lessQueries int
+	}{
+		{omit: Omit{Packages: true}, lessQueries: 1},
+		{omit: Omit{References: true}, lessQueries: 1},
+		{omit: Omit{Packages: true, References: true}, lessQueries: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.omit.String(), func(t *testing.T) {
+			ctx := WithOmit(context.Background(), tt.omit)
+			want := full[0]
+			if tt.omit.Packages {
+				want.AffectedPacks = nil
+			}
+			if tt.omit.References {
+				want.References = nil
+			}
+
+			// the preloads of the children omitted are skipped, rather than the children dropped after loaded
+			queries = 0
+			defs, err := r.GetByPackName(ctx, c.RedHat, "7", "kernel", "")
+			if err != nil {
+				t.Fatalf("Failed to GetByPackName. err: %s", err)
+			}
+			if len(defs) != 1 || !reflect.DeepEqual(defs[0], want) {
+				t.Errorf("GetByPackName: expected: %+v, actual: %+v", want, defs)
+			}
+			if queries != fullQueries-tt.lessQueries {
+				t.Errorf("queries: expected: %d, actual: %d", fullQueries-tt.lessQueries, queries)
+			}
+
+			// and of the pages
+			defs, _, err = r.GetByCveIDPage(ctx, c.RedHat, "7", "CVE-2016-8650", "", Page{Limit: 10})
+			if err != nil {
+				t.Fatalf("Failed to GetByCveIDPage. err: %s", err)
+			}
+			if len(defs) != 1 || !reflect.DeepEqual(defs[0], want) {
+				t.Errorf("GetByCveIDPage: expected: %+v, actual: %+v", want, defs)
+			}
+
+			// and of the batch, still grouped by the packages
+			m, err := r.GetByPackNames(ctx, c.RedHat, "7", []string{"kernel", "openssl"}, "")
+			if err != nil {
+				t.Fatalf("Failed to GetByPackNames. err: %s", err)
+			}
+			if len(m["kernel"]) != 1 || !reflect.DeepEqual(m["kernel"][0], want) || m["openssl"] == nil || len(m["openssl"]) != 0 {
+				t.Errorf("GetByPackNames: expected: %+v of kernel, actual: %+v", want, m)
+			}
+		})
+	}
+}
+
+func TestRDBDriver_GetByPackNameCollapseArch(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	all := []models.Package{
+		{Name: "openssl", Version: "1:1.1.1k-9.el8_7", Arch: "x86_64"},
+		{Name: "openssl", Version: "1:1.1.1k-9.el8_7", Arch: "aarch64"},
+		{Name: "openssl-libs", Version: "1:1.1.1k-9.el8_7", Arch: "x86_64"},
+		{Name: "openssl", Version: "1:1.1.1k-9.el8_7", Arch: "i686"},
+	}
+	root := &models.Root{
+		Family:    c.Oracle,
+		OSVersion: "8",
+		Definitions: []models.Definition{{
+			DefinitionID:  "oval:com.oracle.elsa:def:20233349",
+			Advisory:      models.Advisory{AdvisoryID: "ELSA-2023-3349", Cves: []models.Cve{{CveID: "CVE-2023-0464"}}},
+			AffectedPacks: slices.Clone(all),
+		}},
+	}
+	if _, err := r.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	collapsed := []models.Package{
+		{Name: "openssl", Version: "1:1.1.1k-9.el8_7"},
+		{Name: "openssl-libs", Version: "1:1.1.1k-9.el8_7", Arch: "x86_64"},
+	}
+	// the definition is repeated by GetByPackName for each package of openssl, of each arch if not collapsed
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		arch    string
+		want    []models.Package
+		repeats int
+	}{
+		{name: "collapsed by default", ctx: context.Background(), want: collapsed, repeats: 1},
+		{name: "collapsed", ctx: WithCollapseArch(context.Background(), true), want: collapsed, repeats: 1},
+		{name: "not collapsed", ctx: WithCollapseArch(context.Background(), false), want: all, repeats: 3},
+		{name: "of the arch", ctx: context.Background(), arch: "aarch64", want: []models.Package{{Name: "openssl", Version: "1:1.1.1k-9.el8_7", Arch: "aarch64"}}, repeats: 1},
+	}
+	packs := func(t *testing.T, defs []models.Definition, repeats int) []models.Package {
+		t.Helper()
+		if len(defs) != repeats {
+			t.Fatalf("expected: %d definitions, actual: %+v", repeats, defs)
+		}
+		ps := []models.Package{}
+		for _, p := range defs[0].AffectedPacks {
+			p.ID, p.DefinitionID = 0, 0
+			ps = append(ps, p)
+		}
+		return ps
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs, err := r.GetByPackName(tt.ctx, c.Oracle, "8", "openssl", tt.arch)
+			if err != nil {
+				t.Fatalf("Failed to GetByPackName. err: %s", err)
+			}
+			if got := packs(t, defs, tt.repeats); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetByPackName: expected: %+v, actual: %+v", tt.want, got)
+			}
+
+			// and of the pages and the batch
+			defs, _, err = r.GetByPackNamePage(tt.ctx, c.Oracle, "8", "openssl", tt.arch, Page{Limit: 10})
+			if err != nil {
+				t.Fatalf("Failed to GetByPackNamePage. err: %s", err)
+			}
+			if got := packs(t, defs, 1); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetByPackNamePage: expected: %+v, actual: %+v", tt.want, got)
+			}
+			m, err := r.GetByPackNames(tt.ctx, c.Oracle, "8", []string{"openssl"}, tt.arch)
+			if err != nil {
+				t.Fatalf("Failed to GetByPackNames. err: %s", err)
+			}
+			if got := packs(t, m["openssl"], 1); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetByPackNames: expected: %+v, actual: %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRDBDriver_GetByPackNamePage(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+
+	// more definitions than the page, inserted out of the order of DefinitionID, the one of kernel-tools only never in the pages of kernel
+	root := newTestRedHatRoot()
+	all := []string{root.Definitions[0].DefinitionID}
+	for _, n := range []int{20179999, 20171842, 20175555, 20170001, 20178888, 20173333} {
+		id := fmt.Sprintf("oval:com.redhat.rhsa:def:%d", n)
+		root.Definitions = append(root.Definitions, models.Definition{
+			DefinitionID:  id,
+			Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2016-8650"}}},
+			AffectedPacks: []models.Package{{Name: "kernel", Version: "0:3.10.0-693.el7"}, {Name: "kernel", Version: "0:3.10.0-693.el8"}},
+		})
+		all = append(all, id)
+	}
+	root.Definitions = append(root.Definitions, models.Definition{
+		DefinitionID:  "oval:com.redhat.rhsa:def:20170000",
+		AffectedPacks: []models.Package{{Name: "kernel-tools", Version: "0:3.10.0-693.el7"}},
+	})
+	sort.Strings(all)
+	if _, err := r.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	// the page is limited in the query of the definitions, not sliced after selecting all of them
+	limited := false
+	if err := r.conn.Callback().Query().After("gorm:query").Register("test:limit", func(tx *gorm.DB) {
+		if tx.Statement.Table == "definitions" && strings.Contains(tx.Statement.SQL.String(), "LIMIT") {
+			limited = true
+		}
+	}); err != nil {
+		t.Fatalf("Failed to register callback. err: %s", err)
+	}
+
+	lookups := map[string]func(Page) ([]models.Definition, int64, error){
+		"GetByPackNamePage": func(page Page) ([]models.Definition, int64, error) {
+			return r.GetByPackNamePage(context.Background(), c.RedHat, "7", "kernel", "", page)
+		},
+		"GetByCveIDPage": func(page Page) ([]models.Definition, int64, error) {
+			return r.GetByCveIDPage(context.Background(), c.RedHat, "7", "CVE-2016-8650", "", page)
+		},
+	}
+	for name, lookup := range lookups {
+		for _, limit := range []int{1, 3, 7, 10} {
+			limited = false
+			actual := []string{}
+			for page := (Page{Limit: limit}); ; page.Offset += limit {
+				defs, total, err := lookup(page)
+				if err != nil {
+					t.Fatalf("%s: Failed to lookup. page: %+v, err: %s", name, page, err)
+				}
+				if total != int64(len(all)) {
+					t.Errorf("%s: total: expected: %d, actual: %d", name, len(all), total)
+				}
+				if len(defs) > limit {
+					t.Errorf("%s: expected up to %d definitions, actual: %d", name, limit, len(defs))
+				}
+				for _, d := range defs {
+					actual = append(actual, d.DefinitionID)
+					// the affected packages are filtered by the major version as without the page
+					if len(d.AffectedPacks) != 1 {
+						t.Errorf("%s: %s: expected the package of el7, actual: %v", name, d.DefinitionID, d.AffectedPacks)
+					}
+				}
+				if page.Offset+limit >= len(all) {
+					break
+				}
+			}
+			if !reflect.DeepEqual(actual, all) {
+				t.Errorf("%s: limit %d: expected: %q, actual: %q", name, limit, all, actual)
+			}
+			if !limited {
+				t.Errorf("%s: expected LIMIT in the query of the definitions", name)
+			}
+		}
+
+		// all of them without the page, and none beyond the last one
+		defs, total, err := lookup(Page{})
+		if err != nil {
+			t.Fatalf("%s: Failed to lookup. err: %s", name, err)
+		}
+		if len(defs) != len(all) || total != int64(len(all)) {
+			t.Errorf("%s: expected: %d definitions of %d, actual: %d of %d", name, len(all), len(all), len(defs), total)
+		}
+		defs, total, err = lookup(Page{Offset: len(all)})
+		if err != nil {
+			t.Fatalf("%s: Failed to lookup. err: %s", name, err)
+		}
+		if len(defs) != 0 || total != int64(len(all)) {
+			t.Errorf("%s: expected: 0 definitions of %d, actual: %d of %d", name, len(all), len(defs), total)
+		}
+	}
+}
+
+func TestRDBDriver_InsertOvalSkipUnchanged(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	newRoot := func(sha256 string, ts time.Time, defIDs ...string) *models.Root {
+		root := &models.Root{Family: c.RedHat, OSVersion: "7", Timestamp: ts, SHA256: sha256}
+		for _, id := range defIDs {
+			root.Definitions = append(root.Definitions, models.Definition{DefinitionID: id})
+		}
+		return root
+	}
+	withConvertDigest := func(root *models.Root, digest string) *models.Root {
+		root.ConvertDigest = digest
+		return root
+	}
+
+	t1 := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2023, time.January, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		old       *models.Root
+		new       *models.Root
+		wantCount int
+	}{
+		{
+			name:      "same content with different timestamp is skipped",
+			old:       newRoot("aaaa", t1, "def-1"),
+			new:       newRoot("aaaa", t2, "def-1", "def-2"),
+			wantCount: 1,
+		},
+		{
+			name:      "different content with same timestamp is refreshed",
+			old:       newRoot("aaaa", t1, "def-1"),
+			new:       newRoot("bbbb", t1, "def-1", "def-2"),
+			wantCount: 2,
+		},
+		{
+			name:      "empty hash is always refreshed",
+			old:       newRoot("", t1, "def-1"),
+			new:       newRoot("", t1, "def-1", "def-2"),
+			wantCount: 2,
+		},
+		{
+			name:      "same content converted by another binary or options is refreshed",
+			old:       withConvertDigest(newRoot("aaaa", t1, "def-1"), "issued-years=2023"),
+			new:       withConvertDigest(newRoot("aaaa", t2, "def-1", "def-2"), "issued-years=0"),
+			wantCount: 2,
+		},
+		{
+			name:      "same content stored before the digest of the conversion is refreshed",
+			old:       newRoot("aaaa", t1, "def-1"),
+			new:       withConvertDigest(newRoot("aaaa", t2, "def-1", "def-2"), "issued-years=0"),
+			wantCount: 2,
+		},
+		{
+			name:      "same content converted by the same binary and options is skipped",
+			old:       withConvertDigest(newRoot("aaaa", t1, "def-1"), "issued-years=0"),
+			new:       withConvertDigest(newRoot("aaaa", t2, "def-1", "def-2"), "issued-years=0"),
+			wantCount: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRDB(t)
+			if _, err := r.InsertOval(context.Background(), tt.old); err != nil {
+				t.Fatalf("Failed to InsertOval. err: %s", err)
+			}
+			if _, err := r.InsertOval(context.Background(), tt.new); err != nil {
+				t.Fatalf("Failed to InsertOval. err: %s", err)
+			}
+
+			count, err := r.CountDefs(c.RedHat, "7")
+			if err != nil {
+				t.Fatalf("Failed to CountDefs. err: %s", err)
+			}
+			if count != tt.wantCount {
+				t.Errorf("expected: %d definitions, actual: %d", tt.wantCount, count)
+			}
+
+			lastModified, err := r.GetLastModified(c.RedHat, "7")
+			if err != nil {
+				t.Fatalf("Failed to GetLastModified. err: %s", err)
+			}
+			if !lastModified.Equal(tt.new.Timestamp) {
+				t.Errorf("expected: %s, actual: %s", tt.new.Timestamp, lastModified)
+			}
+		})
+	}
+}
+
+func TestRDBDriver_InsertOvalChangeStat(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	issued := time.Date(2017, time.April, 12, 0, 0, 0, 0, time.UTC)
+	newDef := func(id, severity string) models.Definition {
+		return models.Definition{
+			DefinitionID:  id,
+			Advisory:      models.Advisory{Severity: severity, Cves: []models.Cve{{CveID: "CVE-2016-8650"}}, Issued: issued},
+			AffectedPacks: []models.Package{{Name: "kernel", Version: "0:3.10.0-514.16.1.el7"}},
+		}
+	}
+	newRoot := func(sha256 string, defs ...models.Definition) *models.Root {
+		return &models.Root{Family: c.RedHat, OSVersion: "7", Timestamp: issued, SHA256: sha256, Definitions: defs}
+	}
+
+	r := newTestRDB(t)
+	tests := []struct {
+		name  string
+		root  *models.Root
+		merge bool
+		want  models.ChangeStat
+	}{
+		{
+			name: "v1 into the empty DB",
+			root: newRoot("aaaa", newDef("def-1", "Important"), newDef("def-2", "Important"), newDef("def-3", "Low")),
+			want: models.ChangeStat{New: 3, NewIDs: []string{"def-1", "def-2", "def-3"}},
+		},
+		{
+			name: "v2 updating def-2, adding def-4 and removing def-3",
+			root: newRoot("bbbb", newDef("def-1", "Important"), newDef("def-2", "Critical"), newDef("def-4", "Low")),
+			want: models.ChangeStat{New: 1, Updated: 1, Unchanged: 1, Removed: 1, NewIDs: []string{"def-4"}},
+		},
+		{
+			name: "v2 again, skipped as unchanged",
+			root: newRoot("bbbb", newDef("def-1", "Important"), newDef("def-2", "Critical"), newDef("def-4", "Low")),
+			want: models.ChangeStat{Unchanged: 3},
+		},
+		{
+			name:  "merge keeps the others",
+			root:  newRoot("", newDef("def-1", "Moderate"), newDef("def-5", "Low")),
+			merge: true,
+			want:  models.ChangeStat{New: 1, Updated: 1, NewIDs: []string{"def-5"}},
+		},
+	}
+	for _, tt := range tests {
+		insert := r.InsertOval
+		if tt.merge {
+			insert = r.MergeOval
+		}
+		got, err := insert(context.Background(), tt.root)
+		if err != nil {
+			t.Fatalf("[%s] Failed to insert. err: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("[%s] expected: %+v, actual: %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRDBDriver_InsertOvalFixtures(t *testing.T) {
+	viper.Set("batch-size", 2)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	for _, root := range testutil.Load(t, r) {
+		got := []models.Definition{}
+		if err := r.IterateDefinitions(context.Background(), root.Family, root.OSVersion, func(d models.Definition) error {
+			got = append(got, d)
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to IterateDefinitions. err: %s", err)
+		}
+		testutil.AssertDefinitions(t, root.Definitions, got)
+	}
+
+	// the converted definitions are unchanged from the stored ones of every family, e.g. regardless of the order of their children
+	for _, family := range testutil.Families() {
+		for _, root := range testutil.Roots(t, family) {
+			stat, err := r.InsertOval(context.Background(), &root)
+			if err != nil {
+				t.Fatalf("Failed to InsertOval. err: %s", err)
+			}
+			if want := (models.ChangeStat{Unchanged: len(root.Definitions)}); !reflect.DeepEqual(stat, want) {
+				t.Errorf("%s %s: expected: %+v, actual: %+v", root.Family, root.OSVersion, want, stat)
+			}
+		}
+	}
+
+	root := testutil.Roots(t, c.RedHat)[0]
+	root.Definitions[0].AffectedPacks = append(root.Definitions[0].AffectedPacks, models.Package{Name: "kernel-headers", Version: "0:4.18.0-425.13.1.el8_7"})
+	stat, err := r.InsertOval(context.Background(), &root)
+	if err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	if want := (models.ChangeStat{Updated: 1, Unchanged: len(root.Definitions) - 1}); !reflect.DeepEqual(stat, want) {
+		t.Errorf("expected: %+v, actual: %+v", want, stat)
+	}
+}
+
+func TestRDBDriver_InsertOvalForce(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+	defer viper.Set("force", nil)
+
+	ts := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		force       bool
+		wantRefresh bool
+	}{
+		{
+			name:        "identical re-insert is skipped",
+			wantRefresh: false,
+		},
+		{
+			name:        "identical re-insert is refreshed with --force",
+			force:       true,
+			wantRefresh: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRDB(t)
+			rootID := func() uint {
+				root := models.Root{}
+				if err := r.conn.Where(&models.Root{Family: c.RedHat, OSVersion: "7"}).Take(&root).Error; err != nil {
+					t.Fatalf("Failed to get Root. err: %s", err)
+				}
+				return root.ID
+			}
+
+			viper.Set("force", false)
+			if _, err := r.InsertOval(context.Background(), &models.Root{Family: c.RedHat, OSVersion: "7", Timestamp: ts, SHA256: "aaaa", Definitions: []models.Definition{{DefinitionID: "def-1"}}}); err != nil {
+				t.Fatalf("Failed to InsertOval. err: %s", err)
+			}
+			before := rootID()
+			// SQLite reuses the largest ROWID once deleted, which the root of another OS version keeps from being the refreshed one
+			if _, err := r.InsertOval(context.Background(), &models.Root{Family: c.Oracle, OSVersion: "8", Timestamp: ts, Definitions: []models.Definition{{DefinitionID: "def-1"}}}); err != nil {
+				t.Fatalf("Failed to InsertOval. err: %s", err)
+			}
+
+			viper.Set("force", tt.force)
+			if _, err := r.InsertOval(context.Background(), &models.Root{Family: c.RedHat, OSVersion: "7", Timestamp: ts, SHA256: "aaaa", Definitions: []models.Definition{{DefinitionID: "def-1"}}}); err != nil {
+				t.Fatalf("Failed to InsertOval. err: %s", err)
+			}
+			if refreshed := rootID() != before; refreshed != tt.wantRefresh {
+				t.Errorf("expected refreshed: %t, actual: %t", tt.wantRefresh, refreshed)
+			}
+
+			count, err := r.CountDefs(c.RedHat, "7")
+			if err != nil {
+				t.Fatalf("Failed to CountDefs. err: %s", err)
+			}
+			if count != 1 {
+				t.Errorf("expected: 1 definition, actual: %d", count)
+			}
+		})
+	}
+}
+
+func TestRDBDriver_MergeOval(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	newDef := func(id, cveID, version string) models.Definition {
+		return models.Definition{
+			DefinitionID:  id,
+			Advisory:      models.Advisory{Cves: []models.Cve{{CveID: cveID}}},
+			AffectedPacks: []models.Package{{Name: "kernel", Version: version, Arch: "x86_64"}},
+		}
+	}
+	t1 := time.Date(2022, time.December, 31, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)
+
+	r := newTestRDB(t)
+	// the full OVAL, then the OVAL of 2023 updating ELSA-2023-0001 and adding ELSA-2023-0002
+	if _, err := r.InsertOval(context.Background(), &models.Root{Family: c.Oracle, OSVersion: "8", Timestamp: t1, SHA256: "aaaa", Definitions: []models.Definition{
+		newDef("oval:com.oracle.elsa:def:20220001", "CVE-2022-0001", "0:4.18.0-1.el8"),
+		newDef("oval:com.oracle.elsa:def:20230001", "CVE-2023-0001", "0:4.18.0-2.el8"),
+	}}); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	if _, err := r.MergeOval(context.Background(), &models.Root{Family: c.Oracle, OSVersion: "8", Timestamp: t2, Definitions: []models.Definition{
+		newDef("oval:com.oracle.elsa:def:20230001", "CVE-2023-0001", "0:4.18.0-3.el8"),
+		newDef("oval:com.oracle.elsa:def:20230002", "CVE-2023-0002", "0:4.18.0-4.el8"),
+		newDef("oval:com.oracle.elsa:def:20230002", "CVE-2023-0002", "0:4.18.0-4.el8"),
+	}}); err != nil {
+		t.Fatalf("Failed to MergeOval. err: %s", err)
+	}
+
+	count, err := r.CountDefs(c.Oracle, "8")
+	if err != nil {
+		t.Fatalf("Failed to CountDefs. err: %s", err)
+	}
+	if count != 3 {
+		t.Errorf("expected: 3 definitions, actual: %d", count)
+	}
+
+	for cveID, version := range map[string]string{
+		"CVE-2022-0001": "0:4.18.0-1.el8",
+		"CVE-2023-0001": "0:4.18.0-3.el8",
+		"CVE-2023-0002": "0:4.18.0-4.el8",
+	} {
+		defs, err := r.GetByCveID(context.Background(), c.Oracle, "8", cveID, "x86_64")
+		if err != nil {
+			t.Fatalf("Failed to GetByCveID. err: %s", err)
+		}
+		if len(defs) != 1 || len(defs[0].AffectedPacks) != 1 || defs[0].AffectedPacks[0].Version != version {
+			t.Errorf("%s expected: %s, actual: %+v", cveID, version, defs)
+		}
+	}
+
+	// the replaced definition leaves no orphaned rows
+	for _, m := range []interface{}{&models.Package{}, &models.Cve{}} {
+		var count int64
+		if err := r.conn.Model(m).Count(&count).Error; err != nil {
+			t.Fatalf("Failed to count %T. err: %s", m, err)
+		}
+		if count != 3 {
+			t.Errorf("expected: 3 %T rows, actual: %d", m, count)
+		}
+	}
+
+	root := models.Root{}
+	if err := r.conn.Where(&models.Root{Family: c.Oracle, OSVersion: "8"}).Take(&root).Error; err != nil {
+		t.Fatalf("Failed to get Root. err: %s", err)
+	}
+	if !root.Timestamp.Equal(t2) || root.SHA256 != "" {
+		t.Errorf("expected: timestamp %s without SHA256, actual: %s %q", t2, root.Timestamp, root.SHA256)
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestRDBDriver_FetchMetaCacheValidators(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+
+	meta, err := r.GetFetchMeta()
+	if err != nil {
+		t.Fatalf("Failed to GetFetchMeta. err: %s", err)
+	}
+	meta.CacheValidators = map[string]models.CacheValidator{
+		"https://www.debian.org/security/oval/oval-definitions-stretch.xml.bz2": {ETag: `"5f3c-1"`, LastModified: "Thu, 06 Jul 2023 04:00:10 GMT", OSVersions: []string{"9"}},
+	}
+	meta.SHA256 = map[string]string{
+		"https://www.debian.org/security/oval/oval-definitions-stretch.xml.bz2": "b2a6b7f6a1f8d5e0c3b9a4d7e6f5a8c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7",
+	}
+	if err := r.UpsertFetchMeta(meta); err != nil {
+		t.Fatalf("Failed to UpsertFetchMeta. err: %s", err)
+	}
+	stored, err := r.GetFetchMeta()
+	if err != nil {
+		t.Fatalf("Failed to GetFetchMeta. err: %s", err)
+	}
+	if !reflect.DeepEqual(stored.CacheValidators, meta.CacheValidators) {
+		t.Errorf("expected: %+v, actual: %+v", meta.CacheValidators, stored.CacheValidators)
+	}
+	if !reflect.DeepEqual(stored.SHA256, meta.SHA256) {
+		t.Errorf("expected: %+v, actual: %+v", meta.SHA256, stored.SHA256)
+	}
+
+	if _, err := r.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := r.UpdateLastModified(c.RedHat, "7", now); err != nil {
+		t.Fatalf("Failed to UpdateLastModified. err: %s", err)
+	}
+	lastModified, err := r.GetLastModified(c.RedHat, "7")
+	if err != nil {
+		t.Fatalf("Failed to GetLastModified. err: %s", err)
+	}
+	if !lastModified.Equal(now) {
+		t.Errorf("expected: %s, actual: %s", now, lastModified)
+	}
+}
+
+func TestRDBDriver_GetPackInfo(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	roots := []*models.Root{
+		newTestRedHatRoot(),
+		{
+			Family:    c.Debian,
+			OSVersion: "12",
+			Definitions: []models.Definition{
+				{
+					DefinitionID:  "oval:org.debian:def:20231234",
+					Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2023-1234"}}},
+					AffectedPacks: []models.Package{{Name: "openssl", Version: "3.0.9-1"}},
+				},
+			},
+		},
+		{
+			Family:    c.Ubuntu,
+			OSVersion: "22.04",
+			Definitions: []models.Definition{
+				{
+					DefinitionID: "oval:com.ubuntu.jammy:def:202312340000000",
+					Advisory: models.Advisory{
+						Severity: "Medium",
+						Cves:     []models.Cve{{CveID: "CVE-2023-1234"}, {CveID: "CVE-2023-5678"}},
+					},
+					AffectedPacks: []models.Package{{Name: "openssl", NotFixedYet: true}},
+				},
+				{
+					DefinitionID:  "oval:com.ubuntu.jammy:def:100",
+					AffectedPacks: []models.Package{{Name: "openssl", Version: "3.0.2-0ubuntu1.10"}},
+				},
+			},
+		},
+	}
+	for _, root := range roots {
+		if _, err := r.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+
+	queries := []struct {
+		family   string
+		osVer    string
+		packName string
+	}{
+		{family: c.RedHat, osVer: "7.9", packName: "kernel"},
+		{family: c.RedHat, osVer: "8", packName: "kernel"},
+		{family: c.Debian, osVer: "12", packName: "openssl"},
+		{family: c.Ubuntu, osVer: "22.04", packName: "openssl"},
+		{family: c.Ubuntu, osVer: "22.04", packName: "unknown"},
+	}
+	actual := map[string][]models.PackInfo{}
+	for _, q := range queries {
+		infos, err := r.GetPackInfo(context.Background(), q.family, q.osVer, q.packName)
+		if err != nil {
+			t.Fatalf("Failed to GetPackInfo. err: %s", err)
+		}
+		actual[fmt.Sprintf("%s %s %s", q.family, q.osVer, q.packName)] = infos
+
+		// same result as flattening the definitions, as the Redis driver does
+		defs, err := r.GetByPackName(context.Background(), q.family, q.osVer, q.packName, "")
+		if err != nil {
+			t.Fatalf("Failed to GetByPackName. err: %s", err)
+		}
+		if flattened := toPackInfos(defs, q.packName); !reflect.DeepEqual(infos, flattened) {
+			t.Errorf("%+v: GetPackInfo: %+v, toPackInfos: %+v", q, infos, flattened)
+		}
+	}
+
+	bs, err := json.MarshalIndent(actual, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal. err: %s", err)
+	}
+	golden := filepath.Join("testdata", "packinfo.json")
+	if *update {
+		if err := os.WriteFile(golden, bs, 0644); err != nil {
+			t.Fatalf("Failed to update golden file. err: %s", err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read golden file. err: %s", err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(expected), bytes.TrimSpace(bs)) {
+		t.Errorf("expected: %s\n  actual: %s\n", expected, bs)
+	}
+}
+
+func TestRDBDriver_ListPackages(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	for _, root := range []*models.Root{
+		{
+			Family:    c.RedHat,
+			OSVersion: "7",
+			Definitions: []models.Definition{
+				{
+					DefinitionID:  "oval:com.redhat.rhsa:def:20170933",
+					AffectedPacks: []models.Package{{Name: "perf", Version: "0:3.10.0-514.16.1.el7"}, {Name: "kernel", Version: "0:3.10.0-514.16.1.el7"}},
+				},
+				{
+					DefinitionID: "oval:com.redhat.rhsa:def:20171000",
+					// kernel again, and nodejs of 8 only in the file of 7 and 8
+					AffectedPacks: []models.Package{{Name: "kernel", Version: "0:3.10.0-693.el7"}, {Name: "nodejs", Version: "1:18.14.2-2.module+el8.7.0+18113+bc7e31cd"}, {Name: "bpftool", NotFixedYet: true}},
+				},
+			},
+		},
+		{
+			Family:      c.Debian,
+			OSVersion:   "12",
+			Definitions: []models.Definition{{DefinitionID: "oval:org.debian:def:20231234", AffectedPacks: []models.Package{{Name: "openssl", Version: "3.0.9-1"}, {Name: "libssl3", Version: "3.0.9-1"}}}},
+		},
+		{
+			Family:      c.Debian,
+			OSVersion:   "11",
+			Definitions: []models.Definition{{DefinitionID: "oval:org.debian:def:20231234", AffectedPacks: []models.Package{{Name: "openssl", Version: "1.1.1n-0+deb11u5"}, {Name: "libssl1.1", Version: "1.1.1n-0+deb11u5"}}}},
+		},
+	} {
+		if _, err := r.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+
+	tests := []struct {
+		family string
+		osVer  string
+		want   []string
+	}{
+		{family: c.RedHat, osVer: "7.9", want: []string{"bpftool", "kernel", "perf"}},
+		{family: c.Debian, osVer: "12", want: []string{"libssl3", "openssl"}},
+		{family: "raspbian", osVer: "11", want: []string{"libssl1.1", "openssl"}},
+		{family: c.Ubuntu, osVer: "22.04", want: []string{}},
+	}
+	for _, tt := range tests {
+		names, err := r.ListPackages(context.Background(), tt.family, tt.osVer)
+		if err != nil {
+			t.Fatalf("Failed to ListPackages. err: %s", err)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%s %s: expected: %q, actual: %q", tt.family, tt.osVer, tt.want, names)
+		}
+	}
+}
+
+func TestRDBDriver_GetByAdvisoryID(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	def := func(id, advisoryID string, packs ...models.Package) models.Definition {
+		return models.Definition{DefinitionID: id, Advisory: models.Advisory{AdvisoryID: advisoryID}, AffectedPacks: packs}
+	}
+	for _, root := range []*models.Root{
+		{
+			Family:    c.Debian,
+			OSVersion: "12",
+			Definitions: []models.Definition{
+				def("oval:org.debian:def:20231234", "DSA-5417-1", models.Package{Name: "openssl", Version: "3.0.9-1"}),
+				def("oval:org.debian:def:20231235", "DSA-5417-2", models.Package{Name: "openssl", Version: "3.0.9-2"}),
+				def("oval:org.debian:def:20231236", "DSA-54170-1", models.Package{Name: "curl", Version: "7.88.1-10"}),
+				def("oval:org.debian:def:20231237", "", models.Package{Name: "bash", Version: "5.2.15-2"}),
+			},
+		},
+		{
+			Family:    c.RedHat,
+			OSVersion: "8",
+			Definitions: []models.Definition{
+				def("oval:com.redhat.rhsa:def:20233349", "RHSA-2023:3349",
+					models.Package{Name: "openssl", Version: "1:1.1.1k-9.el8_7"},
+					models.Package{Name: "nodejs", Version: "1:18.14.2-2.module+el9.2.0+18113+bc7e31cd"},
+				),
+			},
+		},
+		{
+			Family:    c.Oracle,
+			OSVersion: "8",
+			Definitions: []models.Definition{
+				def("oval:com.oracle.elsa:def:20233349", "ELSA-2023-3349-1",
+					models.Package{Name: "openssl", Version: "1:1.1.1k-9.el8_7", Arch: "x86_64"},
+					models.Package{Name: "openssl", Version: "1:1.1.1k-9.el8_7", Arch: "aarch64"},
+				),
+				def("oval:com.oracle.elsa:def:20230333", "ELSA-2023-0333", models.Package{Name: "curl", Version: "7.61.1-25.el8_7.1", Arch: "x86_64"}),
+			},
+		},
+		{
+			Family:      c.SUSEEnterpriseServer,
+			OSVersion:   "15",
+			Definitions: []models.Definition{def("oval:org.opensuse.security:def:20210857", "SUSE-SU-2021:0857-1", models.Package{Name: "openssl", Version: "1.1.1d-11.20.1"})},
+		},
+		{
+			Family:      c.Amazon,
+			OSVersion:   "2",
+			Definitions: []models.Definition{def("ALAS2-2023-2088", "ALAS2-2023-2088", models.Package{Name: "openssl", Version: "1:1.0.2k-24.amzn2.0.7", Arch: "x86_64"})},
+		},
+		{
+			Family:      c.Fedora,
+			OSVersion:   "38",
+			Definitions: []models.Definition{def("FEDORA-2023-1f2d9fa9b1", "FEDORA-2023-1f2d9fa9b1", models.Package{Name: "openssl", Version: "1:3.0.9-2.fc38", Arch: "x86_64"})},
+		},
+	} {
+		if _, err := r.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		family     string
+		osVer      string
+		advisoryID string
+		arch       string
+		want       []string
+		wantPacks  int
+	}{
+		{name: "debian of the revision", family: c.Debian, osVer: "12", advisoryID: "DSA-5417-2", want: []string{"oval:org.debian:def:20231235"}, wantPacks: 1},
+		{name: "debian of all the revisions", family: c.Debian, osVer: "12", advisoryID: "dsa-5417", want: []string{"oval:org.debian:def:20231234", "oval:org.debian:def:20231235"}, wantPacks: 1},
+		{name: "debian of the prefix", family: c.Debian, osVer: "12", advisoryID: "DSA-541", want: []string{}},
+		{name: "redhat", family: c.RedHat, osVer: "8", advisoryID: "RHSA-2023:3349", want: []string{"oval:com.redhat.rhsa:def:20233349"}, wantPacks: 1},
+		{name: "oracle of the arch", family: c.Oracle, osVer: "8", advisoryID: "ELSA-2023-3349", arch: "x86_64", want: []string{"oval:com.oracle.elsa:def:20233349"}, wantPacks: 1},
+		{name: "oracle not of the year", family: c.Oracle, osVer: "8", advisoryID: "ELSA-2023", want: []string{}},
+		{name: "suse", family: c.SUSEEnterpriseServer, osVer: "15", advisoryID: "SUSE-SU-2021:0857", want: []string{"oval:org.opensuse.security:def:20210857"}, wantPacks: 1},
+		{name: "amazon", family: c.Amazon, osVer: "2", advisoryID: "alas2-2023-2088", want: []string{"ALAS2-2023-2088"}, wantPacks: 1},
+		{name: "fedora", family: c.Fedora, osVer: "38", advisoryID: "FEDORA-2023-1F2D9FA9B1", want: []string{"FEDORA-2023-1f2d9fa9b1"}, wantPacks: 1},
+		{name: "empty", family: c.Debian, osVer: "12", advisoryID: "", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs, err := r.GetByAdvisoryID(context.Background(), tt.family, tt.osVer, tt.advisoryID, tt.arch)
+			if err != nil {
+				t.Fatalf("Failed to GetByAdvisoryID. err: %s", err)
+			}
+			ids := []string{}
+			for _, d := range defs {
+				ids = append(ids, d.DefinitionID)
+				if len(d.AffectedPacks) != tt.wantPacks {
+					t.Errorf("%s: expected: %d packages, actual: %+v", d.DefinitionID, tt.wantPacks, d.AffectedPacks)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("expected: %q, actual: %q", tt.want, ids)
+			}
+		})
+	}
+}
+
+func TestRDBDriver_GetFetchHistory(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	def := func(id, advisoryID string, cveIDs ...string) models.Definition {
+		d := models.Definition{DefinitionID: id, Advisory: models.Advisory{AdvisoryID: advisoryID}, AffectedPacks: []models.Package{{Name: "kernel", Version: "0:4.18.0-477.el8"}}}
+		for _, cveID := range cveIDs {
+			d.Advisory.Cves = append(d.Advisory.Cves, models.Cve{CveID: cveID})
+		}
+		return d
+	}
+	timestamp := time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)
+	// 20230001 removed, 20230002 unchanged and 20230003 new
+	second := func() *models.Root {
+		return &models.Root{Family: c.RedHat, OSVersion: "8", Timestamp: timestamp.Add(24 * time.Hour), Definitions: []models.Definition{
+			def("oval:com.redhat.rhsa:def:20230002", "RHSA-2023:0002", "CVE-2023-0002"),
+			def("oval:com.redhat.rhsa:def:20230003", "RHSA-2023:0003", "CVE-2023-0003"),
+		}}
+	}
+	refreshes := []struct {
+		merge bool
+		root  *models.Root
+	}{
+		{root: &models.Root{Family: c.RedHat, OSVersion: "8", Timestamp: timestamp, Definitions: []models.Definition{
+			def("oval:com.redhat.rhsa:def:20230001", "RHSA-2023:0001", "CVE-2023-0001", "CVE-2023-0002"),
+			def("oval:com.redhat.rhsa:def:20230002", "RHSA-2023:0002", "CVE-2023-0002"),
+		}}},
+		{root: second()},
+		// 20230003 updated of the CVE and 20230004 new
+		{merge: true, root: &models.Root{Family: c.RedHat, OSVersion: "8", Timestamp: timestamp.Add(48 * time.Hour), Definitions: []models.Definition{
+			def("oval:com.redhat.rhsa:def:20230003", "RHSA-2023:0003", "CVE-2023-0003", "CVE-2023-0004"),
+			def("oval:com.redhat.rhsa:def:20230004", "RHSA-2023:0004", "CVE-2023-0004"),
+		}}},
+		{root: &models.Root{Family: c.Debian, OSVersion: "12", Timestamp: timestamp, Definitions: []models.Definition{
+			def("oval:org.debian:def:20230001", "", "CVE-2023-0001"),
+		}}},
+	}
+	for _, rf := range refreshes {
+		insert := r.InsertOval
+		if rf.merge {
+			insert = r.MergeOval
+		}
+		if _, err := insert(context.Background(), rf.root); err != nil {
+			t.Fatalf("Failed to insert. err: %s", err)
+		}
+	}
+
+	// RefreshedAt is of the time of each refresh, compared apart
+	strip := func(hs []models.FetchHistory) []models.FetchHistory {
+		for i := range hs {
+			if hs[i].RefreshedAt.IsZero() {
+				t.Errorf("expected: RefreshedAt of the refresh, actual: zero")
+			}
+			hs[i].ID, hs[i].RefreshedAt = 0, time.Time{}
+			hs[i].Timestamp = hs[i].Timestamp.UTC()
+		}
+		return hs
+	}
+	hs, err := r.GetFetchHistory(context.Background(), c.RedHat, "8.6", time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to GetFetchHistory. err: %s", err)
+	}
+	want := []models.FetchHistory{
+		{Family: c.RedHat, OSVersion: "8", Timestamp: timestamp, Definitions: 2, Advisories: 2, Cves: 2, New: 2},
+		{Family: c.RedHat, OSVersion: "8", Timestamp: timestamp.Add(24 * time.Hour), Definitions: 2, Advisories: 2, Cves: 2, New: 1, Unchanged: 1, Removed: 1},
+		{Family: c.RedHat, OSVersion: "8", Timestamp: timestamp.Add(48 * time.Hour), Definitions: 3, Advisories: 3, Cves: 3, New: 1, Updated: 1},
+	}
+	if hs = strip(hs); !reflect.DeepEqual(hs, want) {
+		t.Errorf("expected: %+v, actual: %+v", want, hs)
+	}
+
+	hs, err = r.GetFetchHistory(context.Background(), c.Debian, "12", time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to GetFetchHistory. err: %s", err)
+	}
+	if want := []models.FetchHistory{{Family: c.Debian, OSVersion: "12", Timestamp: timestamp, Definitions: 1, Cves: 1, New: 1}}; !reflect.DeepEqual(strip(hs), want) {
+		t.Errorf("expected: %+v, actual: %+v", want, hs)
+	}
+
+	// since the second refresh, dated a week ago
+	if err := r.conn.Model(&models.FetchHistory{}).Where("family = ?", c.RedHat).Update("refreshed_at", time.Now().UTC().Add(-7*24*time.Hour)).Error; err != nil {
+		t.Fatalf("Failed to update RefreshedAt. err: %s", err)
+	}
+	if hs, err = r.GetFetchHistory(context.Background(), c.RedHat, "8", time.Now().Add(-24*time.Hour)); err != nil || len(hs) != 0 {
+		t.Errorf("expected: none since yesterday, actual: %d, err: %v", len(hs), err)
+	}
+
+	// the ones beyond the retention are deleted by the next refresh of the version only
+	viper.Set("history-retention", 24*time.Hour)
+	defer viper.Set("history-retention", nil)
+	if _, err := r.InsertOval(context.Background(), second()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	if hs, err = r.GetFetchHistory(context.Background(), c.RedHat, "8", time.Time{}); err != nil || len(hs) != 1 {
+		t.Errorf("expected: the last refresh only, actual: %d, err: %v", len(hs), err)
+	}
+	if hs, err = r.GetFetchHistory(context.Background(), c.Debian, "12", time.Time{}); err != nil || len(hs) != 1 {
+		t.Errorf("expected: the refresh of debian kept, actual: %d, err: %v", len(hs), err)
+	}
+}
+
+func TestRDBDriver_LookupOrder(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	def := func(id string, issued time.Time, cves []string, packs ...string) models.Definition {
+		d := models.Definition{
+			DefinitionID: id,
+			Advisory:     models.Advisory{Issued: issued, AffectedCPEList: []models.Cpe{{Cpe: "cpe:/o:redhat:enterprise_linux:8::baseos"}, {Cpe: "cpe:/a:redhat:enterprise_linux:8::appstream"}}},
+			References:   []models.Reference{{Source: "RHSA", RefID: id}, {Source: "CVE", RefID: cves[0]}},
+		}
+		for _, cve := range cves {
+			d.Advisory.Cves = append(d.Advisory.Cves, models.Cve{CveID: cve})
+		}
+		for _, p := range packs {
+			d.AffectedPacks = append(d.AffectedPacks, models.Package{Name: p, Version: "0:4.18.0-477.el8"})
+		}
+		return d
+	}
+	// stored in neither the order of the issued date nor of DefinitionID, with the tie of the issued date and the missing one
+	root := &models.Root{
+		Family:    c.RedHat,
+		OSVersion: "8",
+		Definitions: []models.Definition{
+			def("oval:com.redhat.rhsa:def:20220001", time.Time{}, []string{"CVE-2022-0001"}, "kernel"),
+			def("oval:com.redhat.rhsa:def:20230100", time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC), []string{"CVE-2023-0200", "CVE-2023-0100"}, "kernel-tools", "kernel"),
+			def("oval:com.redhat.rhsa:def:20230300", time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), []string{"CVE-2023-0300", "CVE-2023-0100"}, "kernel", "kernel-tools"),
+			def("oval:com.redhat.rhsa:def:20230200", time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), []string{"CVE-2023-0100"}, "kernel"),
+		},
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "oval.sqlite3")
+	rw, err := NewDB(dialectSqlite3, dbPath, false, Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer rw.CloseDB()
+	if _, err := rw.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	ro, err := NewDB(dialectSqlite3, dbPath, false, Option{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer ro.CloseDB()
+
+	type result struct {
+		DefinitionID string    `json:"definitionID"`
+		Issued       time.Time `json:"issued"`
+		Cves         []string  `json:"cves"`
+		Packages     []string  `json:"packages"`
+		References   []string  `json:"references"`
+		CPEs         []string  `json:"cpes"`
+	}
+	results := func(defs []models.Definition) []result {
+		rs := []result{}
+		for _, d := range defs {
+			r := result{DefinitionID: d.DefinitionID, Issued: d.Advisory.Issued.UTC()}
+			for _, cve := range d.Advisory.Cves {
+				r.Cves = append(r.Cves, cve.CveID)
+			}
+			for _, p := range d.AffectedPacks {
+				r.Packages = append(r.Packages, p.Name)
+			}
+			for _, ref := range d.References {
+				r.References = append(r.References, ref.RefID)
+			}
+			for _, cpe := range d.Advisory.AffectedCPEList {
+				r.CPEs = append(r.CPEs, cpe.Cpe)
+			}
+			rs = append(rs, r)
+		}
+		return rs
+	}
+	lookup := func(driver DB) map[string][]result {
+		ctx := context.Background()
+		m := map[string][]result{}
+		defs, err := driver.GetByPackName(ctx, c.RedHat, "8", "kernel", "")
+		if err != nil {
+			t.Fatalf("Failed to GetByPackName. err: %s", err)
+		}
+		m["GetByPackName kernel"] = results(defs)
+
+		// the same order as Redis sorting the definitions selected in no order
+		shuffled := append([]models.Definition{}, defs...)
+		for i, j := 0, len(shuffled)-1; i < j; i, j = i+1, j-1 {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		}
+		sortDefinitions(shuffled)
+		if !reflect.DeepEqual(results(shuffled), m["GetByPackName kernel"]) {
+			t.Errorf("sortDefinitions: expected: %+v, actual: %+v", m["GetByPackName kernel"], results(shuffled))
+		}
+
+		batch, err := driver.GetByPackNames(ctx, c.RedHat, "8", []string{"kernel", "kernel-tools"}, "")
+		if err != nil {
+			t.Fatalf("Failed to GetByPackNames. err: %s", err)
+		}
+		for name, defs := range batch {
+			m["GetByPackNames "+name] = results(defs)
+		}
+		if defs, err = driver.GetByCveID(ctx, c.RedHat, "8", "CVE-2023-0100", ""); err != nil {
+			t.Fatalf("Failed to GetByCveID. err: %s", err)
+		}
+		m["GetByCveID CVE-2023-0100"] = results(defs)
+		if defs, err = driver.GetByCpe(ctx, c.RedHat, "8", "cpe:/o:redhat:enterprise_linux:8", ""); err != nil {
+			t.Fatalf("Failed to GetByCpe. err: %s", err)
+		}
+		m["GetByCpe cpe:/o:redhat:enterprise_linux:8"] = results(defs)
+		return m
+	}
+
+	actual := lookup(rw)
+	if readOnly := lookup(ro); !reflect.DeepEqual(readOnly, actual) {
+		t.Errorf("read-only: expected: %+v, actual: %+v", actual, readOnly)
+	}
+	if !reflect.DeepEqual(actual["GetByPackNames kernel"], actual["GetByPackName kernel"]) {
+		t.Errorf("GetByPackNames: expected: %+v, actual: %+v", actual["GetByPackName kernel"], actual["GetByPackNames kernel"])
+	}
+
+	bs, err := json.MarshalIndent(actual, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal. err: %s", err)
+	}
+	golden := filepath.Join("testdata", "lookup_order.json")
+	if *update {
+		if err := os.WriteFile(golden, bs, 0644); err != nil {
+			t.Fatalf("Failed to update golden file. err: %s", err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read golden file. err: %s", err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(expected), bytes.TrimSpace(bs)) {
+		t.Errorf("expected: %s\n  actual: %s\n", expected, bs)
+	}
+}
+
+func TestRDBDriver_GetRootStats(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	debian := &models.Root{
+		Family:    c.Debian,
+		OSVersion: "12",
+		Timestamp: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC),
+		Definitions: []models.Definition{
+			{
+				DefinitionID:  "oval:org.debian:def:20231234",
+				Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2023-1234"}}},
+				AffectedPacks: []models.Package{{Name: "openssl", Version: "3.0.9-1"}, {Name: "libssl3", Version: "3.0.9-1"}},
+			},
+			{
+				DefinitionID:  "oval:org.debian:def:20235678",
+				Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2023-5678"}}},
+				AffectedPacks: []models.Package{{Name: "curl", Version: "7.88.1-10"}},
+			},
+		},
+	}
+	for _, root := range []*models.Root{newTestRedHatRoot(), debian} {
+		if _, err := r.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+
+	stats, err := r.GetRootStats()
+	if err != nil {
+		t.Fatalf("Failed to GetRootStats. err: %s", err)
+	}
+	expected := []models.RootStat{
+		{Family: c.Debian, OSVersion: "12", Timestamp: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC), Definitions: 2, Packages: 3},
+		{Family: c.RedHat, OSVersion: "7", Timestamp: time.Date(2017, time.April, 12, 0, 0, 0, 0, time.UTC), Definitions: 1, Packages: 1},
+	}
+	for i := range stats {
+		stats[i].Timestamp = stats[i].Timestamp.UTC()
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected: %+v, actual: %+v", expected, stats)
+	}
+}
+
+func TestRDBDriver_PurgeOval(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	debian := &models.Root{
+		Family:    c.Debian,
+		OSVersion: "12",
+		Timestamp: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC),
+		Definitions: []models.Definition{{
+			DefinitionID:  "oval:org.debian:def:20231234",
+			Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2023-1234"}}},
+			AffectedPacks: []models.Package{{Name: "openssl", Version: "3.0.9-1"}, {Name: "libssl3", Version: "3.0.9-1"}},
+			References:    []models.Reference{{Source: "CVE", RefID: "CVE-2023-1234"}},
+			Debian:        &models.Debian{DSA: "DSA-5432-1"},
+		}},
+	}
+	for _, root := range []*models.Root{newTestRedHatRoot(), debian} {
+		if _, err := r.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+
+	stat, err := r.PurgeOval(context.Background(), c.RedHat, "7")
+	if err != nil {
+		t.Fatalf("Failed to PurgeOval. err: %s", err)
+	}
+	stat.Timestamp = stat.Timestamp.UTC()
+	if expected := (models.RootStat{Family: c.RedHat, OSVersion: "7", Timestamp: time.Date(2017, time.April, 12, 0, 0, 0, 0, time.UTC), Definitions: 1, Packages: 1}); !reflect.DeepEqual(stat, expected) {
+		t.Errorf("expected: %+v, actual: %+v", expected, stat)
+	}
+
+	// the other OVAL is kept, and the purged one leaves no orphaned rows
+	for _, tt := range []struct {
+		model interface{}
+		want  int64
+	}{
+		{model: &models.Root{}, want: 1},
+		{model: &models.Definition{}, want: 1},
+		{model: &models.Package{}, want: 2},
+		{model: &models.Reference{}, want: 1},
+		{model: &models.Advisory{}, want: 1},
+		{model: &models.Cve{}, want: 1},
+		{model: &models.Bugzilla{}, want: 0},
+		{model: &models.Cpe{}, want: 0},
+		{model: &models.Debian{}, want: 1},
+	} {
+		var count int64
+		if err := r.conn.Model(tt.model).Count(&count).Error; err != nil {
+			t.Fatalf("Failed to count %T. err: %s", tt.model, err)
+		}
+		if count != tt.want {
+			t.Errorf("expected: %d %T rows, actual: %d", tt.want, tt.model, count)
+		}
+	}
+
+	// purging the OVAL not stored deletes nothing
+	stat, err = r.PurgeOval(context.Background(), c.RedHat, "7")
+	if err != nil {
+		t.Fatalf("Failed to PurgeOval. err: %s", err)
+	}
+	if stat.Definitions != 0 || stat.Packages != 0 {
+		t.Errorf("expected: nothing purged, actual: %+v", stat)
+	}
+}
+
+func TestRDBDriver_IterateDefinitions(t *testing.T) {
+	viper.Set("batch-size", 500)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	// more than a batch, inserted in the reverse order of DefinitionID
+	root := &models.Root{Family: c.RedHat, OSVersion: "7", Timestamp: time.Date(2017, time.April, 12, 0, 0, 0, 0, time.UTC)}
+	for i := 2100; i > 0; i-- {
+		root.Definitions = append(root.Definitions, models.Definition{
+			DefinitionID:  fmt.Sprintf("oval:com.redhat.rhsa:def:%08d", i),
+			Advisory:      models.Advisory{Cves: []models.Cve{{CveID: fmt.Sprintf("CVE-2017-%04d", i)}}},
+			AffectedPacks: []models.Package{{Name: "kernel", Version: "0:3.10.0-514.16.1.el7"}},
+		})
+	}
+	if _, err := r.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+
+	n := 0
+	if err := r.IterateDefinitions(context.Background(), c.RedHat, "7", func(d models.Definition) error {
+		n++
+		if want := fmt.Sprintf("oval:com.redhat.rhsa:def:%08d", n); d.DefinitionID != want {
+			return fmt.Errorf("expected: %s, actual: %s", want, d.DefinitionID)
+		}
+		if len(d.Advisory.Cves) != 1 || d.Advisory.Cves[0].CveID != fmt.Sprintf("CVE-2017-%04d", n) || len(d.AffectedPacks) != 1 {
+			return fmt.Errorf("expected: hydrated definition, actual: %+v", d)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to IterateDefinitions. err: %s", err)
+	}
+	if n != 2100 {
+		t.Errorf("expected: 2100 definitions, actual: %d", n)
+	}
+
+	if err := r.IterateDefinitions(context.Background(), c.Debian, "12", func(models.Definition) error {
+		return fmt.Errorf("expected: no definitions")
+	}); err != nil {
+		t.Errorf("Failed to IterateDefinitions of the OVAL not stored. err: %s", err)
+	}
+}
+
+func TestRDBDriver_CheckIntegrity(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	debian := &models.Root{
+		Family:    c.Debian,
+		OSVersion: "12",
+		Timestamp: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC),
+		Definitions: []models.Definition{{
+			DefinitionID:  "oval:org.debian:def:20231234",
+			Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2023-1234"}}},
+			AffectedPacks: []models.Package{{Name: "openssl", Version: "3.0.9-1"}},
+			Debian:        &models.Debian{DSA: "DSA-5432-1"},
+		}},
+	}
+	for _, root := range []*models.Root{newTestRedHatRoot(), debian} {
+		if _, err := r.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+
+	report, err := r.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("Failed to CheckIntegrity. err: %s", err)
+	}
+	if report.Total() != 0 {
+		t.Fatalf("expected: no orphans, actual: %+v", report)
+	}
+
+	// the definition of redhat deleted alone orphans its children, and the cve of the gone advisory is orphaned
+	if err := r.conn.Exec("DELETE FROM definitions WHERE definition_id = ?", "oval:com.redhat.rhsa:def:20170933").Error; err != nil {
+		t.Fatalf("Failed to delete definition. err: %s", err)
+	}
+	if err := r.conn.Create(&models.Cve{AdvisoryID: 9999, CveID: "CVE-2023-9999"}).Error; err != nil {
+		t.Fatalf("Failed to insert cve. err: %s", err)
+	}
+
+	report, err = r.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("Failed to CheckIntegrity. err: %s", err)
+	}
+	expected := map[string]int64{"definitions": 0, "packages": 1, "references": 0, "debians": 0, "advisories": 1, "cves": 1, "bugzillas": 0, "cpes": 0}
+	if !reflect.DeepEqual(report.Orphans, expected) {
+		t.Errorf("expected: %v, actual: %v", expected, report.Orphans)
+	}
+
+	// the children of the orphaned advisory are deleted with it
+	report, err = r.FixIntegrity()
+	if err != nil {
+		t.Fatalf("Failed to FixIntegrity. err: %s", err)
+	}
+	expected = map[string]int64{"definitions": 0, "packages": 1, "references": 0, "debians": 0, "advisories": 1, "cves": 2, "bugzillas": 3, "cpes": 3}
+	if !reflect.DeepEqual(report.Orphans, expected) {
+		t.Errorf("expected: %v, actual: %v", expected, report.Orphans)
+	}
+
+	report, err = r.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("Failed to CheckIntegrity. err: %s", err)
+	}
+	if report.Total() != 0 {
+		t.Errorf("expected: no orphans after fix, actual: %+v", report)
+	}
+	defs, err := r.GetByPackName(context.Background(), c.Debian, "12", "openssl", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	if len(defs) != 1 || len(defs[0].Advisory.Cves) != 1 || defs[0].Debian == nil {
+		t.Errorf("expected: the definition of debian kept, actual: %+v", defs)
+	}
+
+	for _, f := range []func() error{r.Vacuum, r.Optimize} {
+		if err := f(); err != nil {
+			t.Errorf("Failed to maintain DB. err: %s", err)
+		}
+	}
+}
+
+func TestRDBDriver_LookupContext(t *testing.T) {
+	r := newTestRDB(t)
+	testutil.Load(t, r, c.RedHat)
+
+	// the only connection held by another, e.g. of the slow query, so that the lookups wait for it until their context is done
+	sqlDB, err := r.conn.DB()
+	if err != nil {
+		t.Fatalf("Failed to get DB Object. err: %s", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	held, err := sqlDB.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get connection. err: %s", err)
+	}
+	defer held.Close()
+
+	lookups := map[string]func(ctx context.Context) error{
+		"GetByPackName": func(ctx context.Context) error {
+			_, err := r.GetByPackName(ctx, c.RedHat, "8", "nodejs", "")
+			return err
+		},
+		"GetByPackNames": func(ctx context.Context) error {
+			_, err := r.GetByPackNames(ctx, c.RedHat, "8", []string{"nodejs", "npm"}, "")
+			return err
+		},
+		"GetByPackNamePage": func(ctx context.Context) error {
+			_, _, err := r.GetByPackNamePage(ctx, c.RedHat, "8", "nodejs", "", Page{Limit: 1})
+			return err
+		},
+		"GetByCveID": func(ctx context.Context) error {
+			_, err := r.GetByCveID(ctx, c.RedHat, "8", "CVE-2023-23918", "")
+			return err
+		},
+		"GetByCveIDPage": func(ctx context.Context) error {
+			_, _, err := r.GetByCveIDPage(ctx, c.RedHat, "8", "CVE-2023-23918", "", Page{Limit: 1})
+			return err
+		},
+		"GetByCpe": func(ctx context.Context) error {
+			_, err := r.GetByCpe(ctx, c.RedHat, "8", "cpe:/o:redhat:enterprise_linux:8", "")
+			return err
+		},
+		"GetPackInfo": func(ctx context.Context) error {
+			_, err := r.GetPackInfo(ctx, c.RedHat, "8", "nodejs")
+			return err
+		},
+	}
+	for name, lookup := range lookups {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			if err := lookup(ctx); !xerrors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected: %s, actual: %v", context.DeadlineExceeded, err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected: returned once the context is done, actual: %s", elapsed)
+			}
+
+			// cancelled in the middle of the lookup
+			ctx, cancel = context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			if err := lookup(ctx); !xerrors.Is(err, context.Canceled) {
+				t.Errorf("expected: %s, actual: %v", context.Canceled, err)
+			}
+		})
+	}
+
+	// the lookups go on once the connection is released
+	if err := held.Close(); err != nil {
+		t.Fatalf("Failed to close connection. err: %s", err)
+	}
+	for name, lookup := range lookups {
+		if err := lookup(context.Background()); err != nil {
+			t.Errorf("%s: expected: no error, actual: %s", name, err)
+		}
+	}
+}
+
+func TestRDBDriver_WALCheckpoint(t *testing.T) {
+	// open opens the sqlite3 DB at dbPath in the WAL mode
+	open := func(t *testing.T, dbPath string, option Option) *RDBDriver {
+		driver, err := NewDB(dialectSqlite3, dbPath, false, option)
+		if err != nil {
+			t.Fatalf("Failed to NewDB. err: %s", err)
+		}
+		t.Cleanup(func() { _ = driver.CloseDB() })
+		r := driver.(errorDB).DB.(*RDBDriver)
+		if err := r.conn.Exec("PRAGMA journal_mode=WAL").Error; err != nil {
+			t.Fatalf("Failed to switch to WAL. err: %s", err)
+		}
+		return r
+	}
+	walSize := func(t *testing.T, dbPath string) int64 {
+		fi, err := os.Stat(dbPath + "-wal")
+		if err != nil {
+			t.Fatalf("Failed to stat WAL. err: %s", err)
+		}
+		return fi.Size()
+	}
+
+	t.Run("no checkpoint after insert", func(t *testing.T) {
+		dbPath := filepath.Join(t.TempDir(), "oval.sqlite3")
+		r := open(t, dbPath, Option{NoWALCheckpoint: true})
+		testutil.Load(t, r)
+		if size := walSize(t, dbPath); size == 0 {
+			t.Fatalf("expected: the WAL grown by the inserts, actual: %d bytes", size)
+		}
+
+		if err := r.Optimize(); err != nil {
+			t.Fatalf("Failed to Optimize. err: %s", err)
+		}
+		if size := walSize(t, dbPath); size != 0 {
+			t.Errorf("expected: the WAL truncated by Optimize, actual: %d bytes", size)
+		}
+	})
+
+	t.Run("checkpoint after insert", func(t *testing.T) {
+		dbPath := filepath.Join(t.TempDir(), "oval.sqlite3")
+		r := open(t, dbPath, Option{})
+		testutil.Load(t, r)
+		if size := walSize(t, dbPath); size != 0 {
+			t.Errorf("expected: the WAL truncated after the inserts, actual: %d bytes", size)
+		}
+	})
+
+	t.Run("reader of another connection", func(t *testing.T) {
+		dbPath := filepath.Join(t.TempDir(), "oval.sqlite3")
+		r := open(t, dbPath, Option{NoWALCheckpoint: true})
+		testutil.Load(t, r)
+
+		other := open(t, dbPath, Option{})
+		tx := other.conn.Begin()
+		t.Cleanup(func() { tx.Rollback() })
+		var count int64
+		if err := tx.Model(&models.Root{}).Count(&count).Error; err != nil {
+			t.Fatalf("Failed to read in the other connection. err: %s", err)
+		}
+
+		// the checkpoint gives up on the reader without waiting for it long
+		if err := r.conn.Exec("PRAGMA busy_timeout=100").Error; err != nil {
+			t.Fatalf("Failed to set busy_timeout. err: %s", err)
+		}
+		if err := r.Optimize(); err == nil {
+			t.Errorf("expected: the error of the checkpoint blocked by the reader, actual: no error")
+		}
+		if size := walSize(t, dbPath); size == 0 {
+			t.Errorf("expected: the WAL left by the blocked checkpoint, actual: %d bytes", size)
+		}
+
+		tx.Rollback()
+		if err := r.Optimize(); err != nil {
+			t.Fatalf("Failed to Optimize after the reader ended. err: %s", err)
+		}
+		if size := walSize(t, dbPath); size != 0 {
+			t.Errorf("expected: the WAL truncated by Optimize, actual: %d bytes", size)
+		}
+	})
+}
+
+func TestRDBDriver_CheckStorage(t *testing.T) {
+	// newDBFile returns the path of the sqlite3 DB file of the fixtures, closed
+	newDBFile := func(t *testing.T) string {
+		dbPath := filepath.Join(t.TempDir(), "oval.sqlite3")
+		driver, err := NewDB(dialectSqlite3, dbPath, false, Option{})
+		if err != nil {
+			t.Fatalf("Failed to NewDB. err: %s", err)
+		}
+		testutil.Load(t, driver)
+		if err := driver.CloseDB(); err != nil {
+			t.Fatalf("Failed to CloseDB. err: %s", err)
+		}
+		return dbPath
+	}
+	// truncate cuts the DB file in half, as the write of the full disk does
+	truncate := func(t *testing.T, dbPath string) {
+		fi, err := os.Stat(dbPath)
+		if err != nil {
+			t.Fatalf("Failed to stat DB. err: %s", err)
+		}
+		if err := os.Truncate(dbPath, fi.Size()/2); err != nil {
+			t.Fatalf("Failed to truncate DB. err: %s", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(*testing.T, string)
+		full    bool
+		wantErr bool
+	}{
+		{name: "healthy quick_check"},
+		{name: "healthy integrity_check", full: true},
+		{name: "truncated quick_check", corrupt: truncate, wantErr: true},
+		{name: "truncated integrity_check", corrupt: truncate, full: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbPath := newDBFile(t)
+			if tt.corrupt != nil {
+				tt.corrupt(t, dbPath)
+			}
+			driver, err := NewDB(dialectSqlite3, dbPath, false, Option{SkipMigration: true})
+			if err != nil {
+				t.Fatalf("Failed to NewDB. err: %s", err)
+			}
+			defer driver.CloseDB()
+
+			err = driver.CheckStorage(tt.full)
+			switch {
+			case tt.wantErr && !xerrors.Is(err, ErrCorrupted):
+				t.Errorf("expected: %s, actual: %v", ErrCorrupted, err)
+			case !tt.wantErr && err != nil:
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestRDBDriver_CheckIntegrityProblems(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	noOrphans := map[string]int64{"definitions": 0, "packages": 0, "references": 0, "debians": 0, "advisories": 0, "cves": 0, "bugzillas": 0, "cpes": 0}
+	orphans := func(table string) map[string]int64 {
+		m := map[string]int64{}
+		for k, v := range noOrphans {
+			m[k] = v
+		}
+		m[table] = 1
+		return m
+	}
+
+	tests := []struct {
+		name string
+		// corrupt corrupts the DB of the OVAL of redhat 7, returning the sample of the problem
+		corrupt func(t *testing.T, r *RDBDriver) string
+		want    Report
+		wantKey string
+	}{
+		{
+			name: "orphaned package",
+			corrupt: func(t *testing.T, r *RDBDriver) string {
+				pack := &models.Package{DefinitionID: 9999, Name: "kernel"}
+				return createOrphan(t, r, pack, func() uint { return pack.ID })
+			},
+			want:    Report{Orphans: orphans("packages")},
+			wantKey: "packages",
+		},
+		{
+			name: "orphaned reference",
+			corrupt: func(t *testing.T, r *RDBDriver) string {
+				ref := &models.Reference{DefinitionID: 9999, Source: "CVE", RefID: "CVE-2023-9999"}
+				return createOrphan(t, r, ref, func() uint { return ref.ID })
+			},
+			want:    Report{Orphans: orphans("references")},
+			wantKey: "references",
+		},
+		{
+			name: "orphaned advisory",
+			corrupt: func(t *testing.T, r *RDBDriver) string {
+				adv := &models.Advisory{DefinitionID: 9999, Severity: "Low"}
+				return createOrphan(t, r, adv, func() uint { return adv.ID })
+			},
+			want:    Report{Orphans: orphans("advisories")},
+			wantKey: "advisories",
+		},
+		{
+			name: "orphaned cve",
+			corrupt: func(t *testing.T, r *RDBDriver) string {
+				cve := &models.Cve{AdvisoryID: 9999, CveID: "CVE-2023-9999"}
+				return createOrphan(t, r, cve, func() uint { return cve.ID })
+			},
+			want:    Report{Orphans: orphans("cves")},
+			wantKey: "cves",
+		},
+		{
+			name: "orphaned bugzilla",
+			corrupt: func(t *testing.T, r *RDBDriver) string {
+				bz := &models.Bugzilla{AdvisoryID: 9999, BugzillaID: "9999"}
+				return createOrphan(t, r, bz, func() uint { return bz.ID })
+			},
+			want:    Report{Orphans: orphans("bugzillas")},
+			wantKey: "bugzillas",
+		},
+		{
+			name: "orphaned cpe",
+			corrupt: func(t *testing.T, r *RDBDriver) string {
+				cpe := &models.Cpe{AdvisoryID: 9999, Cpe: "cpe:/o:redhat:enterprise_linux:9"}
+				return createOrphan(t, r, cpe, func() uint { return cpe.ID })
+			},
+			want:    Report{Orphans: orphans("cpes")},
+			wantKey: "cpes",
+		},
+		{
+			name: "definition of missing root",
+			corrupt: func(t *testing.T, r *RDBDriver) string {
+				def := &models.Definition{RootID: 9999, DefinitionID: "oval:com.redhat.rhsa:def:20239999"}
+				return createOrphan(t, r, def, func() uint { return def.ID })
+			},
+			want:    Report{Orphans: orphans("definitions")},
+			wantKey: "definitions",
+		},
+		{
+			name: "duplicate root",
+			corrupt: func(t *testing.T, r *RDBDriver) string {
+				if err := r.conn.Omit(clause.Associations).Create(&models.Root{Family: c.RedHat, OSVersion: "7"}).Error; err != nil {
+					t.Fatalf("Failed to create root. err: %s", err)
+				}
+				return "redhat 7"
+			},
+			want:    Report{Orphans: noOrphans, DuplicateRoots: 1},
+			wantKey: SampleDuplicateRoots,
+		},
+		{
+			name: "stale fetch meta",
+			corrupt: func(t *testing.T, r *RDBDriver) string {
+				fetchMeta, err := r.GetFetchMeta()
+				if err != nil {
+					t.Fatalf("Failed to GetFetchMeta. err: %s", err)
+				}
+				// redhat 7 is stored, but 8 of the same file is not
+				fetchMeta.CacheValidators = map[string]models.CacheValidator{
+					"https://example.com/rhel-7.oval.xml.bz2":   {ETag: `"7"`, OSVersions: []string{"7"}},
+					"https://example.com/rhel-7-8.oval.xml.bz2": {ETag: `"8"`, OSVersions: []string{"7", "8"}},
+				}
+				if err := r.UpsertFetchMeta(fetchMeta); err != nil {
+					t.Fatalf("Failed to UpsertFetchMeta. err: %s", err)
+				}
+				return "https://example.com/rhel-7-8.oval.xml.bz2"
+			},
+			want:    Report{Orphans: noOrphans, StaleFetchMeta: 1},
+			wantKey: SampleStaleFetchMeta,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRDB(t)
+			if _, err := r.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+				t.Fatalf("Failed to InsertOval. err: %s", err)
+			}
+			tt.want.Samples = map[string][]string{tt.wantKey: {tt.corrupt(t, r)}}
+
+			report, err := r.CheckIntegrity()
+			if err != nil {
+				t.Fatalf("Failed to CheckIntegrity. err: %s", err)
+			}
+			if !reflect.DeepEqual(report, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, report)
+			}
+			if report.Total() != 1 {
+				t.Errorf("expected: 1 problem, actual: %d", report.Total())
+			}
+		})
+	}
+}
+
+// createOrphan creates the row of child alone, without the associations, and returns its ID as the sample of the orphan
+func createOrphan(t *testing.T, r *RDBDriver, child interface{}, id func() uint) string {
+	t.Helper()
+	if err := r.conn.Omit(clause.Associations).Create(child).Error; err != nil {
+		t.Fatalf("Failed to create orphan. err: %s", err)
+	}
+	return fmt.Sprint(id())
+}
+
+func TestRDBDriver_PendingMigrations(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "oval.sqlite3")
+	driver, err := NewDB(dialectSqlite3, dbPath, false, Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	r := driver.(errorDB).DB.(*RDBDriver)
+
+	// the schema of the older release, without the columns of the raw version and the state, the index of the package name and the table of CPEs
+	for _, ddl := range []string{
+		"ALTER TABLE packages DROP COLUMN raw_version",
+		"ALTER TABLE advisories DROP COLUMN state",
+		"DROP INDEX idx_packages_name",
+		"DROP TABLE cpes",
+	} {
+		if err := r.conn.Exec(ddl).Error; err != nil {
+			t.Fatalf("Failed to %s. err: %s", ddl, err)
+		}
+	}
+
+	pending, err := r.PendingMigrations()
+	if err != nil {
+		t.Fatalf("Failed to PendingMigrations. err: %s", err)
+	}
+	got := []string{}
+	for _, m := range pending {
+		got = append(got, fmt.Sprintf("%s alter:%t", m.Description, m.Alter))
+		if len(m.DDL) == 0 {
+			t.Errorf("expected: the DDL of %s", m.Description)
+		}
+	}
+	want := []string{
+		"add column packages.raw_version alter:true",
+		"create index idx_packages_name on packages alter:true",
+		"add column advisories.state alter:true",
+		"create table cpes alter:false",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected: %q, actual: %q", want, got)
+	}
+
+	// nothing is applied by the dry run
+	if r.conn.Migrator().HasTable(&models.Cpe{}) {
+		t.Errorf("expected: the table of CPEs not created by the dry run")
+	}
+
+	// the DB opened read-only of them is refused, rather than failing the queries of the missing column, unless told to skip the check
+	_, err = NewDB(dialectSqlite3, dbPath, false, Option{ReadOnly: true})
+	if wantErr := "4 migrations are pending, e.g. add column packages.raw_version. Schema version: 3 (latest: 3)"; !xerrors.Is(err, ErrSchemaOutdated) || !strings.Contains(err.Error(), wantErr) {
+		t.Errorf("expected: %s, actual: %v", wantErr, err)
+	}
+	readOnly, err := NewDB(dialectSqlite3, dbPath, false, Option{ReadOnly: true, SkipSchemaCheck: true})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	_ = readOnly.CloseDB()
+
+	if err := r.MigrateDB(); err != nil {
+		t.Fatalf("Failed to MigrateDB. err: %s", err)
+	}
+	if pending, err = r.PendingMigrations(); err != nil {
+		t.Fatalf("Failed to PendingMigrations. err: %s", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected: no pending migrations, actual: %+v", pending)
+	}
+	_ = r.CloseDB()
+
+	// the new DB is created without altering any table
+	fresh, err := NewDB(dialectSqlite3, filepath.Join(t.TempDir(), "oval.sqlite3"), false, Option{SkipMigration: true})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer fresh.CloseDB()
+	if pending, err = fresh.PendingMigrations(); err != nil {
+		t.Fatalf("Failed to PendingMigrations. err: %s", err)
+	}
+	for _, m := range pending {
+		if m.Alter {
+			t.Errorf("expected: only the creation of the tables, actual: %s", m.Description)
+		}
+	}
+	if len(pending) != len(migrationModels()) {
+		t.Errorf("expected: %d tables, actual: %d", len(migrationModels()), len(pending))
+	}
+}
+
+func Test_mysqlDSN(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		timeout time.Duration
+		want    string
+	}{
+		{dsn: "user:pass@tcp(127.0.0.1:3306)/oval?parseTime=true", timeout: 30 * time.Second, want: "user:pass@tcp(127.0.0.1:3306)/oval?parseTime=true&max_execution_time=30000"},
+		{dsn: "user:pass@tcp(127.0.0.1:3306)/oval", timeout: 0, want: "user:pass@tcp(127.0.0.1:3306)/oval"},
+		// max_execution_time given in the DSN is kept
+		{dsn: "user:pass@tcp(127.0.0.1:3306)/oval?max_execution_time=1000", timeout: 30 * time.Second, want: "user:pass@tcp(127.0.0.1:3306)/oval?max_execution_time=1000"},
+		// the malformed DSN is as is, failing to open anyway
+		{dsn: "user:pass@tcp(127.0.0.1:3306", timeout: 30 * time.Second, want: "user:pass@tcp(127.0.0.1:3306"},
+	}
+	for _, tt := range tests {
+		if got := mysqlDSN(tt.dsn, tt.timeout); got != tt.want {
+			t.Errorf("mysqlDSN(%q, %s): expected: %q, actual: %q", tt.dsn, tt.timeout, tt.want, got)
+		}
+	}
+}
+
+func TestRDBDriver_ReleaseKey(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	r := newTestRDB(t)
+	tests := []struct {
+		family   string
+		osVer    string
+		variants []string
+	}{
+		{family: c.RedHat, osVer: "7", variants: []string{"7", "7.4", "7Server", "7.9.2009", "7 (Maipo)"}},
+		{family: c.Oracle, osVer: "8", variants: []string{"8", "8.6", "8.6.1"}},
+		{family: c.Debian, osVer: "9", variants: []string{"9", "9.1", "stretch", "Stretch"}},
+		{family: c.Ubuntu, osVer: "22.04", variants: []string{"22.04", "22.04.3", "22.04.3 LTS", "jammy"}},
+		{family: c.OpenSUSELeap, osVer: "15.5", variants: []string{"15.5", "15.5.1"}},
+		{family: c.OpenSUSE, osVer: "tumbleweed", variants: []string{"tumbleweed", "Tumbleweed", "20231015"}},
+		{family: c.SUSEEnterpriseServer, osVer: "12.1", variants: []string{"12.1", "12-SP1", "12 SP1", "12SP1"}},
+		{family: c.Amazon, osVer: "1", variants: []string{"1", "2017.09", "2018.03"}},
+	}
+	for _, tt := range tests {
+		root := &models.Root{Family: tt.family, OSVersion: tt.osVer, Timestamp: time.Now(), Definitions: []models.Definition{
+			{DefinitionID: "def-" + tt.family, Advisory: models.Advisory{Cves: []models.Cve{{CveID: "CVE-2023-0001"}}}, AffectedPacks: []models.Package{{Name: "openssl", Version: "1.0"}}},
+		}}
+		if _, err := r.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+
+	// every variant of the naming hits the root of its family, however stored
+	check := func(t *testing.T) {
+		t.Helper()
+		for _, tt := range tests {
+			for _, v := range tt.variants {
+				defs, err := r.GetByPackName(context.Background(), tt.family, v, "openssl", "")
+				if err != nil {
+					t.Fatalf("Failed to GetByPackName. err: %s", err)
+				}
+				if len(defs) != 1 || defs[0].DefinitionID != "def-"+tt.family {
+					t.Errorf("%s %q: expected: def-%s, actual: %+v", tt.family, v, tt.family, defs)
+				}
+				if defs, err := r.GetByCveID(context.Background(), tt.family, v, "CVE-2023-0001", ""); err != nil || len(defs) != 1 {
+					t.Errorf("%s %q: GetByCveID expected: 1 definition, actual: %d, err: %v", tt.family, v, len(defs), err)
+				}
+				if n, err := r.CountDefs(tt.family, v); err != nil || n != 1 {
+					t.Errorf("%s %q: CountDefs expected: 1, actual: %d, err: %v", tt.family, v, n, err)
+				}
+			}
+		}
+	}
+	check(t)
+
+	// the roots stored before the column are backfilled by the migration
+	for _, ddl := range []string{
+		"DROP INDEX idx_roots_family_release_key",
+		"ALTER TABLE roots DROP COLUMN release_key",
+	} {
+		if err := r.conn.Exec(ddl).Error; err != nil {
+			t.Fatalf("Failed to %s. err: %s", ddl, err)
+		}
+	}
+	if err := r.MigrateDB(); err != nil {
+		t.Fatalf("Failed to MigrateDB. err: %s", err)
+	}
+	check(t)
+}
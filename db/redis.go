@@ -5,13 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/cheggaaa/pb/v3"
 	"github.com/go-redis/redis/v8"
-	"github.com/inconshreveable/log15"
-	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
 	"golang.org/x/xerrors"
 
 	c "github.com/vulsio/goval-dictionary/config"
@@ -29,6 +30,12 @@ import (
   │ 1 │ OVAL#$OSFAMILY#$VERSION#DEP          │   JSON  │ TO DELETE OUTDATED AND UNNEEDED FIELD AND MEMBER │
   ├───┼──────────────────────────────────────┼─────────┼──────────────────────────────────────────────────┤
   │ 2 │ OVAL#$OSFAMILY#$VERSION#LASTMODIFIED │  string │ TO GET Last Modified                             │
+  ├───┼──────────────────────────────────────┼─────────┼──────────────────────────────────────────────────┤
+  │ 3 │ OVAL#$OSFAMILY#$VERSION#SHA256       │  string │ TO SKIP REFRESHING UNCHANGED OVAL                │
+  ├───┼──────────────────────────────────────┼─────────┼──────────────────────────────────────────────────┤
+  │ 4 │ OVAL#$OSFAMILY#$VERSION#SOURCE       │  string │ TO REFUSE REPLACING OVAL OF ANOTHER SOURCE FILE  │
+  ├───┼──────────────────────────────────────┼─────────┼──────────────────────────────────────────────────┤
+  │ 5 │ OVAL#$OSFAMILY#$VERSION#CONVERTDIGEST│  string │ TO REFRESH OVAL CONVERTED BY ANOTHER BINARY/OPTS │
   └───┴──────────────────────────────────────┴─────────┴──────────────────────────────────────────────────┘
 
 - Sets
@@ -41,6 +48,8 @@ import (
   │ 2 │ OVAL#$OSFAMILY#$VERSION#PKG#$PACKAGENAME#$ARCH │ $DEFINITIONID │ TO GET []$DEFINITIONID for Amazon/Oracle/Fedora │
   ├───┼────────────────────────────────────────────────┼───────────────┼─────────────────────────────────────────────────┤
   │ 3 │ OVAL#$OSFAMILY#$VERSION#CVE#$CVEID             │ $DEFINITIONID │ TO GET []$DEFINITIONID                          │
+  ├───┼────────────────────────────────────────────────┼───────────────┼─────────────────────────────────────────────────┤
+  │ 4 │ OVAL#$OSFAMILY#$VERSION#CPE#$CPE               │ $DEFINITIONID │ TO GET []$DEFINITIONID by the prefix of CPE     │
   └───┴────────────────────────────────────────────────┴───────────────┴─────────────────────────────────────────────────┘
 
 - Hash
@@ -55,20 +64,30 @@ import (
   │ 3 │ OVAL#FETCHMETA              │ SchemaVersion │    uint   │ GET Go-Oval-Disctionary Schema Version    │
   ├───┼─────────────────────────────┼───────────────┼───────────┼───────────────────────────────────────────┤
   │ 4 │ OVAL#FETCHMETA              │ LastFetchedAt │ time.Time │ GET Go-Oval-Disctionary Last Fetched Time │
+  ├───┼─────────────────────────────┼───────────────┼───────────┼───────────────────────────────────────────┤
+  │ 5 │ OVAL#FETCHMETA              │CacheValidators│   JSON    │ GET HTTP Cache Validators by URL          │
+  ├───┼─────────────────────────────┼───────────────┼───────────┼───────────────────────────────────────────┤
+  │ 6 │ OVAL#FETCHMETA              │    SHA256     │   JSON    │ GET Verified SHA-256 by URL               │
+  ├───┼─────────────────────────────┼───────────────┼───────────┼───────────────────────────────────────────┤
+  │ 7 │ OVAL#FETCHMETA              │   Snapshots   │   JSON    │ GET Snapshot of Rolling Releases by URL   │
   └───┴─────────────────────────────┴───────────────┴───────────┴───────────────────────────────────────────┘
 
   **/
 
 // Supported DB dialects.
 const (
-	dialectRedis          = "redis"
-	defKeyFormat          = "OVAL#%s#%s#DEF"
-	cveKeyFormat          = "OVAL#%s#%s#CVE#%s"
-	pkgKeyFormat          = "OVAL#%s#%s#PKG#%s"
-	depKeyFormat          = "OVAL#%s#%s#DEP"
-	lastModifiedKeyFormat = "OVAL#%s#%s#LASTMODIFIED"
-	fileMetaKey           = "OVAL#FILEMETA"
-	fetchMetaKey          = "OVAL#FETCHMETA"
+	dialectRedis           = "redis"
+	defKeyFormat           = "OVAL#%s#%s#DEF"
+	cveKeyFormat           = "OVAL#%s#%s#CVE#%s"
+	cpeKeyFormat           = "OVAL#%s#%s#CPE#%s"
+	pkgKeyFormat           = "OVAL#%s#%s#PKG#%s"
+	depKeyFormat           = "OVAL#%s#%s#DEP"
+	lastModifiedKeyFormat  = "OVAL#%s#%s#LASTMODIFIED"
+	sha256KeyFormat        = "OVAL#%s#%s#SHA256"
+	sourceKeyFormat        = "OVAL#%s#%s#SOURCE"
+	convertDigestKeyFormat = "OVAL#%s#%s#CONVERTDIGEST"
+	fileMetaKey            = "OVAL#FILEMETA"
+	fetchMetaKey           = "OVAL#FETCHMETA"
 )
 
 // RedisDriver is Driver for Redis
@@ -85,7 +104,7 @@ func (r *RedisDriver) Name() string {
 // OpenDB opens Database
 func (r *RedisDriver) OpenDB(_, dbPath string, _ bool, option Option) error {
 	if err := r.connectRedis(dbPath, option); err != nil {
-		return xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dialectRedis, dbPath, err)
+		return xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dialectRedis, c.RedactDSN(dialectRedis, dbPath), err)
 	}
 	return nil
 }
@@ -93,6 +112,11 @@ func (r *RedisDriver) OpenDB(_, dbPath string, _ bool, option Option) error {
 func (r *RedisDriver) connectRedis(dbPath string, option Option) error {
 	opt, err := redis.ParseURL(dbPath)
 	if err != nil {
+		// url.Error has the URL with the password
+		var ue *url.Error
+		if xerrors.As(err, &ue) {
+			err = ue.Err
+		}
 		return xerrors.Errorf("Failed to parse url. err: %w", err)
 	}
 
@@ -114,19 +138,34 @@ func (r *RedisDriver) CloseDB() (err error) {
 	return
 }
 
+// Ping verifies the connection to Redis is alive, e.g. for /health of the server
+func (r *RedisDriver) Ping() error {
+	if r.conn == nil {
+		return xerrors.New("Failed to ping DB. err: not opened")
+	}
+	if err := r.conn.Ping(context.Background()).Err(); err != nil {
+		return xerrors.Errorf("Failed to ping DB. Type: %s. err: %w", r.name, err)
+	}
+	return nil
+}
+
 // MigrateDB migrates Database
 func (r *RedisDriver) MigrateDB() error {
 	return nil
 }
 
-// GetByPackName select OVAL definition related to OS Family, osVer, packName, arch
-func (r *RedisDriver) GetByPackName(family, osVer, packName, arch string) ([]models.Definition, error) {
+// PendingMigrations returns no migration, as Redis has no schema
+func (r *RedisDriver) PendingMigrations() ([]Migration, error) {
+	return nil, nil
+}
+
+// GetByPackName select OVAL definition related to OS Family, osVer, packName, arch, narrowed down to classes if specified
+func (r *RedisDriver) GetByPackName(ctx context.Context, family, osVer, packName, arch string, classes ...string) ([]models.Definition, error) {
 	family, osVer, err := formatFamilyAndOSVer(family, osVer)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
 	}
 
-	ctx := context.Background()
 	key := fmt.Sprintf(pkgKeyFormat, family, osVer, packName)
 	pkgKeys := []string{}
 	switch family {
@@ -192,23 +231,54 @@ func (r *RedisDriver) GetByPackName(family, osVer, packName, arch string) ([]mod
 		if defstr == nil {
 			return nil, xerrors.Errorf("Failed to HMGet. Redis relationship may be broken. err: Some fields do not exist. family: %s, version: %s, defID: %s", family, osVer, defIDs[i])
 		}
-		def, err := restoreDefinition(defstr.(string), family, osVer, arch)
+		def, err := restoreDefinition(defstr.(string), family, osVer, arch, omitFrom(ctx), collapseArchFrom(ctx))
 		if err != nil {
 			return nil, xerrors.Errorf("Failed to restoreDefinition. err: %w", err)
 		}
+		if len(classes) > 0 && !slices.Contains(classes, def.Class) {
+			continue
+		}
 		defs = append(defs, def)
 	}
+	sortDefinitions(defs)
+	if arch == "" && collapseArchFrom(ctx) {
+		defs = collapseRepeats(defs, packName)
+	}
 	return defs, nil
 }
 
+// GetByPackNames selects the OVAL definitions of the OS family and osVer affecting each of packNames, with an empty slice for the package
+// affected by none, looking up each of them as GetByPackName
+func (r *RedisDriver) GetByPackNames(ctx context.Context, family, osVer string, packNames []string, arch string, classes ...string) (map[string][]models.Definition, error) {
+	m := make(map[string][]models.Definition, len(packNames))
+	for _, name := range packNames {
+		defs, err := r.GetByPackName(ctx, family, osVer, name, arch, classes...)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to GetByPackName. packName: %s, err: %w", name, err)
+		}
+		m[name] = defs
+	}
+	return m, nil
+}
+
+// GetByPackNamePage selects the page of the OVAL definitions of the OS family and osVer affecting packName ordered by DefinitionID,
+// with the number of all of them, selecting all of them to sort
+func (r *RedisDriver) GetByPackNamePage(ctx context.Context, family, osVer, packName, arch string, page Page, classes ...string) ([]models.Definition, int64, error) {
+	defs, err := r.GetByPackName(ctx, family, osVer, packName, arch, classes...)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("Failed to GetByPackName. err: %w", err)
+	}
+	defs, total := pageOf(defs, page)
+	return defs, total, nil
+}
+
 // GetByCveID select OVAL definition related to OS Family, osVer, cveID
-func (r *RedisDriver) GetByCveID(family, osVer, cveID, arch string) ([]models.Definition, error) {
+func (r *RedisDriver) GetByCveID(ctx context.Context, family, osVer, cveID, arch string) ([]models.Definition, error) {
 	family, osVer, err := formatFamilyAndOSVer(family, osVer)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
 	}
 
-	ctx := context.Background()
 	defIDs, err := r.conn.SMembers(ctx, fmt.Sprintf(cveKeyFormat, family, osVer, cveID)).Result()
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to SMembers. err: %w", err)
@@ -227,29 +297,131 @@ func (r *RedisDriver) GetByCveID(family, osVer, cveID, arch string) ([]models.De
 		if defstr == nil {
 			return nil, xerrors.Errorf("Failed to HMGet. Redis relationship may be broken. err: Some fields do not exist. family: %s, version: %s, defID: %s", family, osVer, defIDs[i])
 		}
-		def, err := restoreDefinition(defstr.(string), family, osVer, arch)
+		def, err := restoreDefinition(defstr.(string), family, osVer, arch, omitFrom(ctx), collapseArchFrom(ctx))
 		if err != nil {
 			return nil, xerrors.Errorf("Failed to restoreDefinition. err: %w", err)
 		}
 		defs = append(defs, def)
 	}
+	sortDefinitions(defs)
 	return defs, nil
 }
 
-func restoreDefinition(defstr, family, version, arch string) (models.Definition, error) {
+// GetByCveIDPage selects the page of the OVAL definitions of the OS family and osVer of cveID ordered by DefinitionID,
+// with the number of all of them, selecting all of them to sort
+func (r *RedisDriver) GetByCveIDPage(ctx context.Context, family, osVer, cveID, arch string, page Page) ([]models.Definition, int64, error) {
+	defs, err := r.GetByCveID(ctx, family, osVer, cveID, arch)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("Failed to GetByCveID. err: %w", err)
+	}
+	defs, total := pageOf(defs, page)
+	return defs, total, nil
+}
+
+// GetByCpe select OVAL definition related to OS Family, osVer, whose affected CPE starts with cpe
+func (r *RedisDriver) GetByCpe(ctx context.Context, family, osVer, cpe, arch string) ([]models.Definition, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+
+	dbsize, err := r.conn.DBSize(ctx).Result()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to DBSize. err: %w", err)
+	}
+	cpeKeys := []string{}
+	var cursor uint64
+	for {
+		var keys []string
+		var err error
+		keys, cursor, err = r.conn.Scan(ctx, cursor, fmt.Sprintf(cpeKeyFormat, family, osVer, globEscaper.Replace(cpe))+"*", dbsize/5).Result()
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to Scan. err: %w", err)
+		}
+
+		cpeKeys = append(cpeKeys, keys...)
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if len(cpeKeys) == 0 {
+		return []models.Definition{}, nil
+	}
+
+	pipe := r.conn.Pipeline()
+	for _, key := range cpeKeys {
+		_ = pipe.SMembers(ctx, key)
+	}
+	cmders, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to exec pipeline. err: %w", err)
+	}
+
+	defIDs := []string{}
+	for _, cmder := range cmders {
+		result, err := cmder.(*redis.StringSliceCmd).Result()
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to SMembers. err: %w", err)
+		}
+		// the definition matched by several CPEs of its advisory is selected once
+		for _, id := range result {
+			if !slices.Contains(defIDs, id) {
+				defIDs = append(defIDs, id)
+			}
+		}
+	}
+	if len(defIDs) == 0 {
+		return []models.Definition{}, nil
+	}
+
+	defStrs, err := r.conn.HMGet(ctx, fmt.Sprintf(defKeyFormat, family, osVer), defIDs...).Result()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to HMGet. err: %w", err)
+	}
+
+	defs := []models.Definition{}
+	for i, defstr := range defStrs {
+		if defstr == nil {
+			return nil, xerrors.Errorf("Failed to HMGet. Redis relationship may be broken. err: Some fields do not exist. family: %s, version: %s, defID: %s", family, osVer, defIDs[i])
+		}
+		def, err := restoreDefinition(defstr.(string), family, osVer, arch, omitFrom(ctx), collapseArchFrom(ctx))
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to restoreDefinition. err: %w", err)
+		}
+		defs = append(defs, def)
+	}
+	sortDefinitions(defs)
+	return defs, nil
+}
+
+// globEscaper escapes the special characters of the pattern of SCAN, so that the CPE is matched as it is, e.g. "*" of CPE 2.3
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// restoreDefinition decodes the definition stored in JSON, dropping the children of omit
+func restoreDefinition(defstr, family, version, arch string, omit Omit, collapse bool) (models.Definition, error) {
 	var def models.Definition
 	if err := json.Unmarshal([]byte(defstr), &def); err != nil {
 		return models.Definition{}, xerrors.Errorf("Failed to Unmarshal JSON. err: %w", err)
 	}
+	filterDefinition(&def, family, version, arch, omit, collapse)
+	return def, nil
+}
 
+// filterDefinition drops the affected packages of def not of arch or of the major version of RedHat, and the children of omit,
+// collapsing the packages of more than one arch by collapseArch if collapse and arch is not given
+func filterDefinition(def *models.Definition, family, version, arch string, omit Omit, collapse bool) {
 	switch family {
 	case c.Amazon, c.Oracle, c.Fedora:
 		def.AffectedPacks = fileterPacksByArch(def.AffectedPacks, arch)
 	case c.RedHat:
-		def.AffectedPacks = filterByRedHatMajor(def.AffectedPacks, major(version))
+		def.AffectedPacks = filterByRedHatMajor(def.AffectedPacks, c.ReleaseKey(c.RedHat, version))
 	}
-
-	return def, nil
+	if collapse && arch == "" {
+		def.AffectedPacks = collapseArch(def.AffectedPacks)
+	}
+	omit.apply(def)
 }
 
 func fileterPacksByArch(packs []models.Package, arch string) []models.Package {
@@ -267,47 +439,188 @@ func fileterPacksByArch(packs []models.Package, arch string) []models.Package {
 	return filtered
 }
 
-// InsertOval inserts OVAL
-func (r *RedisDriver) InsertOval(root *models.Root) (err error) {
-	ctx := context.Background()
-	batchSize := viper.GetInt("batch-size")
+// GetByAdvisoryID select OVAL definition related to OS Family, osVer, of the advisory of advisoryID or of its revisions,
+// decoding all the definitions, as the advisories are not indexed by keys
+func (r *RedisDriver) GetByAdvisoryID(ctx context.Context, family, osVer, advisoryID, arch string) ([]models.Definition, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+	defs := []models.Definition{}
+	if err := r.IterateDefinitions(ctx, family, osVer, func(def models.Definition) error {
+		if !matchAdvisoryID(def.Advisory.AdvisoryID, advisoryID) {
+			return nil
+		}
+		filterDefinition(&def, family, osVer, arch, omitFrom(ctx), collapseArchFrom(ctx))
+		defs = append(defs, def)
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("Failed to IterateDefinitions. err: %w", err)
+	}
+	sortDefinitions(defs)
+	return defs, nil
+}
+
+// GetPackInfo select the flattened CVE and fixed version of packName related to OS Family, osVer
+func (r *RedisDriver) GetPackInfo(ctx context.Context, family, osVer, packName string) ([]models.PackInfo, error) {
+	defs, err := r.GetByPackName(ctx, family, osVer, packName, "")
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to GetByPackName. err: %w", err)
+	}
+	return toPackInfos(defs, packName), nil
+}
+
+// ListPackages returns the distinct names of the affected packages of OS Family, osVer, sorted, decoding all the definitions,
+// as the keys of the packages are not listed but by SCAN of the whole DB
+func (r *RedisDriver) ListPackages(ctx context.Context, family, osVer string) ([]string, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+	packs := []models.Package{}
+	if err := r.IterateDefinitions(ctx, family, osVer, func(def models.Definition) error {
+		if family == c.RedHat {
+			def.AffectedPacks = filterByRedHatMajor(def.AffectedPacks, c.ReleaseKey(c.RedHat, osVer))
+		}
+		packs = append(packs, def.AffectedPacks...)
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("Failed to IterateDefinitions. err: %w", err)
+	}
+	return packageNames(packs), nil
+}
+
+// InsertOval inserts OVAL, stopping between the batches once ctx is done,
+// returning the numbers of the definitions new, updated, unchanged and removed from the stored ones
+func (r *RedisDriver) InsertOval(ctx context.Context, root *models.Root) (models.ChangeStat, error) {
+	return r.putOval(ctx, root, false)
+}
+
+// MergeOval merges the definitions of root into the stored OVAL, replacing the ones of the same DefinitionID and keeping the others,
+// e.g. to add the OVAL of a year to the stored one instead of refreshing it
+func (r *RedisDriver) MergeOval(ctx context.Context, root *models.Root) (models.ChangeStat, error) {
+	return r.putOval(ctx, &models.Root{
+		Family:      root.Family,
+		OSVersion:   root.OSVersion,
+		Timestamp:   root.Timestamp,
+		Definitions: uniqueDefinitions(root.Definitions),
+	}, true)
+}
+
+// putOval refreshes the stored OVAL with root, or merges root into it if merge
+func (r *RedisDriver) putOval(ctx context.Context, root *models.Root, merge bool) (stat models.ChangeStat, err error) {
+	conf := c.FromContext(ctx)
+	batchSize := conf.BatchSize
 	if batchSize < 1 {
-		return fmt.Errorf("Failed to set batch-size. err: batch-size option is not set properly")
+		return models.ChangeStat{}, fmt.Errorf("Failed to set batch-size. err: batch-size option is not set properly")
 	}
 
 	family, osVer, err := formatFamilyAndOSVer(root.Family, root.OSVersion)
 	if err != nil {
-		return xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+		return models.ChangeStat{}, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+	familyLog := familyLogger(ctx, family, osVer)
+	if merge {
+		familyLog.Info("Merging...")
+	} else {
+		familyLog.Info("Refreshing...")
+	}
+
+	var sourceChange *models.SourceChange
+	if !merge && root.Source != "" {
+		oldSource, err := r.conn.Get(ctx, fmt.Sprintf(sourceKeyFormat, family, osVer)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return models.ChangeStat{}, xerrors.Errorf("Failed to Get key: %s. err: %w", fmt.Sprintf(sourceKeyFormat, family, osVer), err)
+		}
+		if oldSource != "" && oldSource != root.Source {
+			count, err := r.conn.HLen(ctx, fmt.Sprintf(defKeyFormat, family, osVer)).Result()
+			if err != nil {
+				return models.ChangeStat{}, xerrors.Errorf("Failed to HLen key: %s. err: %w", fmt.Sprintf(defKeyFormat, family, osVer), err)
+			}
+			if sourceChange, err = checkSourceChange(familyLog, conf.AllowSourceChange, family, osVer, oldSource, int(count), root); err != nil {
+				return models.ChangeStat{}, err
+			}
+		}
+	}
+
+	if !merge && root.SHA256 != "" {
+		oldSHA256, err := r.conn.Get(ctx, fmt.Sprintf(sha256KeyFormat, family, osVer)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return models.ChangeStat{}, xerrors.Errorf("Failed to Get key: %s. err: %w", fmt.Sprintf(sha256KeyFormat, family, osVer), err)
+		}
+		oldConvertDigest, err := r.conn.Get(ctx, fmt.Sprintf(convertDigestKeyFormat, family, osVer)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return models.ChangeStat{}, xerrors.Errorf("Failed to Get key: %s. err: %w", fmt.Sprintf(convertDigestKeyFormat, family, osVer), err)
+		}
+		// the same files converted by another binary or options differ of ConvertDigest
+		unchanged := oldSHA256 == root.SHA256 && oldConvertDigest == root.ConvertDigest
+		if unchanged && conf.Force {
+			familyLog.Info("Refreshing the unchanged OVAL, as the skip is overridden by --force", "SHA256", root.SHA256)
+		} else if unchanged {
+			familyLog.Info("Skip refreshing because the OVAL has not been changed", "SHA256", root.SHA256)
+			if err := r.conn.Set(ctx, fmt.Sprintf(lastModifiedKeyFormat, family, osVer), root.Timestamp.Format("2006-01-02T15:04:05Z"), 0).Err(); err != nil {
+				return models.ChangeStat{}, xerrors.Errorf("Failed to Set key: %s. err: %w", fmt.Sprintf(lastModifiedKeyFormat, family, osVer), err)
+			}
+			if root.Source != "" {
+				if err := r.conn.Set(ctx, fmt.Sprintf(sourceKeyFormat, family, osVer), root.Source, 0).Err(); err != nil {
+					return models.ChangeStat{}, xerrors.Errorf("Failed to Set key: %s. err: %w", fmt.Sprintf(sourceKeyFormat, family, osVer), err)
+				}
+			}
+			return models.ChangeStat{Unchanged: len(root.Definitions), SourceChange: sourceChange}, nil
+		}
 	}
-	log15.Info("Refreshing...", "Family", family, "Version", osVer)
 
-	// newDeps, oldDeps: {"DEFID": {"cves": {"CVEID": {}}, "packages": {"PACKNAME": {}}}}
+	// newDeps, oldDeps: {"DEFID": {"cves": {"CVEID": {}}, "packages": {"PACKNAME": {}}, "cpes": {"CPE": {}}}}
 	newDeps := map[string]map[string]map[string]struct{}{}
 	depKey := fmt.Sprintf(depKeyFormat, family, osVer)
 	oldDepsStr, err := r.conn.Get(ctx, depKey).Result()
 	if err != nil {
 		if !errors.Is(err, redis.Nil) {
-			return xerrors.Errorf("Failed to Get key: %s. err: %w", depKey, err)
+			return models.ChangeStat{}, xerrors.Errorf("Failed to Get key: %s. err: %w", depKey, err)
 		}
 		oldDepsStr = "{}"
 	}
 	var oldDeps map[string]map[string]map[string]struct{}
 	if err := json.Unmarshal([]byte(oldDepsStr), &oldDeps); err != nil {
-		return xerrors.Errorf("Failed to unmarshal JSON. err: %w", err)
+		return models.ChangeStat{}, xerrors.Errorf("Failed to unmarshal JSON. err: %w", err)
+	}
+
+	if !merge && len(root.Definitions) == 0 && len(oldDeps) > 0 && !conf.ForceEmpty {
+		return models.ChangeStat{}, xerrors.Errorf("Failed to refresh OVAL. err: refuse to replace %d definitions with empty OVAL, use --force-empty to override. family: %s, osVer: %s", len(oldDeps), family, osVer)
 	}
 
-	bar := pb.StartNew(len(root.Definitions))
+	bar := startProgressBar(ctx, len(root.Definitions))
 	for idx := range chunkSlice(len(root.Definitions), batchSize) {
+		if err := ctx.Err(); err != nil {
+			return models.ChangeStat{}, xerrors.Errorf("Failed to insert definitions. err: %w", err)
+		}
+		batch := root.Definitions[idx.From:idx.To]
+		ids := make([]string, 0, len(batch))
+		for _, def := range batch {
+			ids = append(ids, def.DefinitionID)
+		}
+		stored, err := r.conn.HMGet(ctx, fmt.Sprintf(defKeyFormat, family, osVer), ids...).Result()
+		if err != nil {
+			return models.ChangeStat{}, xerrors.Errorf("Failed to HMGet. err: %w", err)
+		}
+		for i, def := range batch {
+			hash, ok, err := storedContentHash(stored[i])
+			if err != nil {
+				return models.ChangeStat{}, xerrors.Errorf("Failed to hash the stored definition: %s. err: %w", def.DefinitionID, err)
+			}
+			countChange(&stat, def, hash, ok)
+		}
+
 		pipe := r.conn.Pipeline()
-		for _, def := range root.Definitions[idx.From:idx.To] {
+		for _, def := range batch {
 			var dj []byte
 			if dj, err = json.Marshal(def); err != nil {
-				return xerrors.Errorf("Failed to marshal json. err: %w", err)
+				return models.ChangeStat{}, newInsertError(ctx, family, osVer, "Definitions", []models.Definition{def}, xerrors.Errorf("Failed to marshal json. err: %w", err))
 			}
 
 			_ = pipe.HSet(ctx, fmt.Sprintf(defKeyFormat, family, osVer), def.DefinitionID, string(dj))
 			if _, ok := newDeps[def.DefinitionID]; !ok {
-				newDeps[def.DefinitionID] = map[string]map[string]struct{}{"cves": {}, "packages": {}}
+				newDeps[def.DefinitionID] = map[string]map[string]struct{}{"cves": {}, "packages": {}, "cpes": {}}
 			}
 
 			for _, cve := range def.Advisory.Cves {
@@ -337,6 +650,16 @@ func (r *RedisDriver) InsertOval(root *models.Root) (err error) {
 				}
 			}
 
+			for _, cpe := range def.Advisory.AffectedCPEList {
+				_ = pipe.SAdd(ctx, fmt.Sprintf(cpeKeyFormat, family, osVer, cpe.Cpe), def.DefinitionID)
+				newDeps[def.DefinitionID]["cpes"][cpe.Cpe] = struct{}{}
+				if _, ok := oldDeps[def.DefinitionID]; ok {
+					if _, ok := oldDeps[def.DefinitionID]["cpes"]; ok {
+						delete(oldDeps[def.DefinitionID]["cpes"], cpe.Cpe)
+					}
+				}
+			}
+
 			if _, ok := oldDeps[def.DefinitionID]; ok {
 				if _, ok := oldDeps[def.DefinitionID]["cves"]; ok {
 					if len(oldDeps[def.DefinitionID]["cves"]) == 0 {
@@ -348,40 +671,187 @@ func (r *RedisDriver) InsertOval(root *models.Root) (err error) {
 						delete(oldDeps[def.DefinitionID], "packages")
 					}
 				}
+				if _, ok := oldDeps[def.DefinitionID]["cpes"]; ok {
+					if len(oldDeps[def.DefinitionID]["cpes"]) == 0 {
+						delete(oldDeps[def.DefinitionID], "cpes")
+					}
+				}
 				if len(oldDeps[def.DefinitionID]) == 0 {
 					delete(oldDeps, def.DefinitionID)
 				}
 			}
 		}
 		if _, err = pipe.Exec(ctx); err != nil {
-			return xerrors.Errorf("Failed to exec pipeline. err: %w", err)
+			return models.ChangeStat{}, newInsertError(ctx, family, osVer, "Definitions", batch, xerrors.Errorf("Failed to exec pipeline. err: %w", err))
 		}
 		bar.Add(idx.To - idx.From)
 	}
 	bar.Finish()
 
+	if err := ctx.Err(); err != nil {
+		return models.ChangeStat{}, xerrors.Errorf("Failed to insert definitions. err: %w", err)
+	}
 	pipe := r.conn.Pipeline()
 	for defID, definitions := range oldDeps {
+		if _, ok := newDeps[defID]; !ok && merge {
+			// the definition not in root is kept as is
+			newDeps[defID] = definitions
+			continue
+		}
+		if _, ok := newDeps[defID]; !ok {
+			stat.Removed++
+		}
 		for cveID := range definitions["cves"] {
 			_ = pipe.SRem(ctx, fmt.Sprintf(cveKeyFormat, family, osVer, cveID), defID)
 		}
 		for pack := range definitions["packages"] {
 			_ = pipe.SRem(ctx, fmt.Sprintf(pkgKeyFormat, family, osVer, pack), defID)
 		}
+		for cpe := range definitions["cpes"] {
+			_ = pipe.SRem(ctx, fmt.Sprintf(cpeKeyFormat, family, osVer, cpe), defID)
+		}
 		if _, ok := newDeps[defID]; !ok {
 			_ = pipe.HDel(ctx, fmt.Sprintf(defKeyFormat, family, osVer), defID)
 		}
 	}
 	newDepsJSON, err := json.Marshal(newDeps)
 	if err != nil {
-		return xerrors.Errorf("Failed to Marshal JSON. err: %w", err)
+		return models.ChangeStat{}, xerrors.Errorf("Failed to Marshal JSON. err: %w", err)
 	}
 	_ = pipe.Set(ctx, depKey, string(newDepsJSON), 0)
 	_ = pipe.Set(ctx, fmt.Sprintf(lastModifiedKeyFormat, family, osVer), root.Timestamp.Format("2006-01-02T15:04:05Z"), 0)
+	if root.SHA256 != "" {
+		_ = pipe.Set(ctx, fmt.Sprintf(sha256KeyFormat, family, osVer), root.SHA256, 0)
+	} else {
+		_ = pipe.Del(ctx, fmt.Sprintf(sha256KeyFormat, family, osVer))
+	}
+	if root.ConvertDigest != "" {
+		_ = pipe.Set(ctx, fmt.Sprintf(convertDigestKeyFormat, family, osVer), root.ConvertDigest, 0)
+	} else {
+		_ = pipe.Del(ctx, fmt.Sprintf(convertDigestKeyFormat, family, osVer))
+	}
+	// the source of the merged OVAL is of the refreshed one
+	if !merge && root.Source != "" {
+		_ = pipe.Set(ctx, fmt.Sprintf(sourceKeyFormat, family, osVer), root.Source, 0)
+	} else if !merge {
+		_ = pipe.Del(ctx, fmt.Sprintf(sourceKeyFormat, family, osVer))
+	}
 	if _, err = pipe.Exec(ctx); err != nil {
-		return xerrors.Errorf("Failed to exec pipeline. err: %w", err)
+		return models.ChangeStat{}, xerrors.Errorf("Failed to exec pipeline. err: %w", err)
+	}
+
+	stat.SourceChange = sourceChange
+	return stat, nil
+}
+
+// storedContentHash returns the content hash of the definition stored as the JSON of v got by HMGet, or false if not stored
+func storedContentHash(v interface{}) (string, bool, error) {
+	dj, ok := v.(string)
+	if !ok {
+		return "", false, nil
+	}
+	var def models.Definition
+	if err := json.Unmarshal([]byte(dj), &def); err != nil {
+		return "", false, xerrors.Errorf("Failed to unmarshal json. err: %w", err)
+	}
+	return def.ContentHash(), true, nil
+}
+
+// PurgeOval deletes the keys of the OVAL of family and osVer in a transaction, returning the stats of the deleted OVAL,
+// whose counts are zero if it is not stored
+func (r *RedisDriver) PurgeOval(ctx context.Context, family, osVer string) (models.RootStat, error) {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return models.RootStat{}, xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+	familyLog := familyLogger(ctx, family, osVer)
+	familyLog.Info("Purging...")
+
+	stat := models.RootStat{Family: family, OSVersion: osVer}
+	defs, err := r.conn.HLen(ctx, fmt.Sprintf(defKeyFormat, family, osVer)).Result()
+	if err != nil {
+		return models.RootStat{}, xerrors.Errorf("Failed to HLen. err: %w", err)
+	}
+	depKey := fmt.Sprintf(depKeyFormat, family, osVer)
+	depsStr, err := r.conn.Get(ctx, depKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return models.RootStat{}, xerrors.Errorf("Failed to Get key: %s. err: %w", depKey, err)
+	}
+	if defs == 0 && depsStr == "" {
+		return stat, nil
+	}
+	if stat.Timestamp, err = r.GetLastModified(family, osVer); err != nil {
+		return models.RootStat{}, xerrors.Errorf("Failed to GetLastModified. err: %w", err)
+	}
+
+	// deps: {"DEFID": {"cves": {"CVEID": {}}, "packages": {"PACKNAME": {}}, "cpes": {"CPE": {}}}}
+	var deps map[string]map[string]map[string]struct{}
+	if depsStr != "" {
+		if err := json.Unmarshal([]byte(depsStr), &deps); err != nil {
+			return models.RootStat{}, xerrors.Errorf("Failed to unmarshal JSON. err: %w", err)
+		}
+	}
+	keys := map[string]struct{}{}
+	for _, dep := range deps {
+		for cveID := range dep["cves"] {
+			keys[fmt.Sprintf(cveKeyFormat, family, osVer, cveID)] = struct{}{}
+		}
+		for pack := range dep["packages"] {
+			keys[fmt.Sprintf(pkgKeyFormat, family, osVer, pack)] = struct{}{}
+		}
+		for cpe := range dep["cpes"] {
+			keys[fmt.Sprintf(cpeKeyFormat, family, osVer, cpe)] = struct{}{}
+		}
+		stat.Packages += len(dep["packages"])
 	}
 
+	pipe := r.conn.TxPipeline()
+	for key := range keys {
+		_ = pipe.Del(ctx, key)
+	}
+	_ = pipe.Del(ctx, fmt.Sprintf(defKeyFormat, family, osVer), depKey, fmt.Sprintf(lastModifiedKeyFormat, family, osVer), fmt.Sprintf(sha256KeyFormat, family, osVer), fmt.Sprintf(sourceKeyFormat, family, osVer), fmt.Sprintf(convertDigestKeyFormat, family, osVer))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return models.RootStat{}, xerrors.Errorf("Failed to exec pipeline. err: %w", err)
+	}
+
+	stat.Definitions = int(defs)
+	return stat, nil
+}
+
+// IterateDefinitions calls fn with each definition of the stored OVAL of family and osVer sorted by DefinitionID,
+// getting them in batches so that the OVAL of the big family is not held in memory at once
+func (r *RedisDriver) IterateDefinitions(ctx context.Context, family, osVer string, fn func(models.Definition) error) error {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+
+	defKey := fmt.Sprintf(defKeyFormat, family, osVer)
+	ids, err := r.conn.HKeys(ctx, defKey).Result()
+	if err != nil {
+		return xerrors.Errorf("Failed to HKeys. err: %w", err)
+	}
+	sort.Strings(ids)
+
+	for idx := range chunkSlice(len(ids), 998) {
+		defstrs, err := r.conn.HMGet(ctx, defKey, ids[idx.From:idx.To]...).Result()
+		if err != nil {
+			return xerrors.Errorf("Failed to HMGet. err: %w", err)
+		}
+		for i, defstr := range defstrs {
+			s, ok := defstr.(string)
+			if !ok {
+				return xerrors.Errorf("Failed to get definition. defID: %s, err: deleted while iterating", ids[idx.From+i])
+			}
+			var def models.Definition
+			if err := json.Unmarshal([]byte(s), &def); err != nil {
+				return xerrors.Errorf("Failed to unmarshal json. err: %w", err)
+			}
+			if err := fn(def); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -403,6 +873,150 @@ func (r *RedisDriver) CountDefs(family, osVer string) (int, error) {
 	return int(count), nil
 }
 
+// GetRootStats returns the stats of every stored OVAL, sorted by family and version
+func (r *RedisDriver) GetRootStats() ([]models.RootStat, error) {
+	ctx := context.Background()
+
+	stats := []models.RootStat{}
+	iter := r.conn.Scan(ctx, 0, "OVAL#*#DEF", 0).Iterator()
+	for iter.Next(ctx) {
+		// OVAL#$OSFAMILY#$VERSION#DEF
+		ss := strings.Split(iter.Val(), "#")
+		if len(ss) != 4 {
+			continue
+		}
+		family, osVer := ss[1], ss[2]
+
+		defs, err := r.conn.HLen(ctx, fmt.Sprintf(defKeyFormat, family, osVer)).Result()
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to HLen. err: %w", err)
+		}
+		depsStr, err := r.conn.Get(ctx, fmt.Sprintf(depKeyFormat, family, osVer)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, xerrors.Errorf("Failed to Get key: %s. err: %w", fmt.Sprintf(depKeyFormat, family, osVer), err)
+		}
+		var deps map[string]map[string]map[string]struct{}
+		if depsStr != "" {
+			if err := json.Unmarshal([]byte(depsStr), &deps); err != nil {
+				return nil, xerrors.Errorf("Failed to unmarshal JSON. err: %w", err)
+			}
+		}
+		packs := 0
+		for _, dep := range deps {
+			packs += len(dep["packages"])
+		}
+		lastModified, err := r.GetLastModified(family, osVer)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to GetLastModified. err: %w", err)
+		}
+		sum, err := r.conn.Get(ctx, fmt.Sprintf(sha256KeyFormat, family, osVer)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, xerrors.Errorf("Failed to Get key: %s. err: %w", fmt.Sprintf(sha256KeyFormat, family, osVer), err)
+		}
+		stats = append(stats, models.RootStat{Family: family, OSVersion: osVer, Timestamp: lastModified, Definitions: int(defs), Packages: packs, SHA256: sum})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, xerrors.Errorf("Failed to Scan. err: %w", err)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Family != stats[j].Family {
+			return stats[i].Family < stats[j].Family
+		}
+		return stats[i].OSVersion < stats[j].OSVersion
+	})
+	return stats, nil
+}
+
+// GetRootTimestamps returns the timestamps and the SHA-256 of all the stored OVAL sorted by family and OS version
+func (r *RedisDriver) GetRootTimestamps() ([]models.RootTimestamp, error) {
+	ctx := context.Background()
+
+	ts := []models.RootTimestamp{}
+	iter := r.conn.Scan(ctx, 0, "OVAL#*#DEF", 0).Iterator()
+	for iter.Next(ctx) {
+		// OVAL#$OSFAMILY#$VERSION#DEF
+		ss := strings.Split(iter.Val(), "#")
+		if len(ss) != 4 {
+			continue
+		}
+		lastModified, err := r.GetLastModified(ss[1], ss[2])
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to GetLastModified. err: %w", err)
+		}
+		sum, err := r.conn.Get(ctx, fmt.Sprintf(sha256KeyFormat, ss[1], ss[2])).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, xerrors.Errorf("Failed to Get key: %s. err: %w", fmt.Sprintf(sha256KeyFormat, ss[1], ss[2]), err)
+		}
+		convertDigest, err := r.conn.Get(ctx, fmt.Sprintf(convertDigestKeyFormat, ss[1], ss[2])).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, xerrors.Errorf("Failed to Get key: %s. err: %w", fmt.Sprintf(convertDigestKeyFormat, ss[1], ss[2]), err)
+		}
+		ts = append(ts, models.RootTimestamp{Family: ss[1], OSVersion: ss[2], Timestamp: lastModified, SHA256: sum, ConvertDigest: convertDigest})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, xerrors.Errorf("Failed to Scan. err: %w", err)
+	}
+
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].Family != ts[j].Family {
+			return ts[i].Family < ts[j].Family
+		}
+		return ts[i].OSVersion < ts[j].OSVersion
+	})
+	return ts, nil
+}
+
+// CheckStorage only pings Redis, which checks its persistence by itself on loading it
+func (r *RedisDriver) CheckStorage(bool) error {
+	return r.Ping()
+}
+
+// CheckIntegrity is not supported for Redis, whose keys have no parent to be orphaned from
+func (r *RedisDriver) CheckIntegrity() (Report, error) {
+	return Report{}, xerrors.Errorf("Failed to check integrity. dbtype: %s, err: %w", r.name, ErrNotSupported)
+}
+
+// FixIntegrity is not supported for Redis, whose keys have no parent to be orphaned from
+func (r *RedisDriver) FixIntegrity() (Report, error) {
+	return Report{}, xerrors.Errorf("Failed to fix integrity. dbtype: %s, err: %w", r.name, ErrNotSupported)
+}
+
+// StoreSourceFile is not supported for Redis, which holds the whole DB in memory
+func (r *RedisDriver) StoreSourceFile(*models.FetchFile) error {
+	return xerrors.Errorf("Failed to store source file. dbtype: %s, err: %w", r.name, ErrNotSupported)
+}
+
+// TouchSourceFile is not supported for Redis, which holds the whole DB in memory
+func (r *RedisDriver) TouchSourceFile(string, time.Time) error {
+	return xerrors.Errorf("Failed to update source file timestamp. dbtype: %s, err: %w", r.name, ErrNotSupported)
+}
+
+// GetSourceFile is not supported for Redis, which holds the whole DB in memory
+func (r *RedisDriver) GetSourceFile(string) ([]byte, error) {
+	return nil, xerrors.Errorf("Failed to get source file. dbtype: %s, err: %w", r.name, ErrNotSupported)
+}
+
+// PruneSourceFiles is not supported for Redis, which holds the whole DB in memory
+func (r *RedisDriver) PruneSourceFiles(time.Time) (int64, error) {
+	return 0, xerrors.Errorf("Failed to delete source files. dbtype: %s, err: %w", r.name, ErrNotSupported)
+}
+
+// GetFetchHistory is not supported for Redis, of which the refreshes are not recorded
+func (r *RedisDriver) GetFetchHistory(context.Context, string, string, time.Time) ([]models.FetchHistory, error) {
+	return nil, xerrors.Errorf("Failed to get fetch history. dbtype: %s, err: %w", r.name, ErrNotSupported)
+}
+
+// Vacuum is not supported for Redis
+func (r *RedisDriver) Vacuum() error {
+	return xerrors.Errorf("Failed to vacuum. dbtype: %s, err: %w", r.name, ErrNotSupported)
+}
+
+// Optimize is not supported for Redis
+func (r *RedisDriver) Optimize() error {
+	return xerrors.Errorf("Failed to optimize. dbtype: %s, err: %w", r.name, ErrNotSupported)
+}
+
 // GetLastModified get last modified time of OVAL in roots
 func (r *RedisDriver) GetLastModified(family, osVer string) (time.Time, error) {
 	family, osVer, err := formatFamilyAndOSVer(family, osVer)
@@ -425,6 +1039,20 @@ func (r *RedisDriver) GetLastModified(family, osVer string) (time.Time, error) {
 	return lastModified, nil
 }
 
+// UpdateLastModified updates the timestamp of the stored OVAL without refreshing it, e.g. the OVAL file has not been modified
+func (r *RedisDriver) UpdateLastModified(family, osVer string, lastModified time.Time) error {
+	family, osVer, err := formatFamilyAndOSVer(family, osVer)
+	if err != nil {
+		return xerrors.Errorf("Failed to formatFamilyAndOSVer. err: %w", err)
+	}
+
+	key := fmt.Sprintf(lastModifiedKeyFormat, family, osVer)
+	if err := r.conn.SetXX(context.Background(), key, lastModified.Format("2006-01-02T15:04:05Z"), 0).Err(); err != nil {
+		return xerrors.Errorf("Failed to Set key: %s. err: %w", key, err)
+	}
+	return nil
+}
+
 // IsGovalDictModelV1 determines if the DB was created at the time of goval-dictionary Model v1
 func (r *RedisDriver) IsGovalDictModelV1() (bool, error) {
 	ctx := context.Background()
@@ -485,10 +1113,58 @@ func (r *RedisDriver) GetFetchMeta() (*models.FetchMeta, error) {
 		return nil, xerrors.Errorf("Failed to Parse date. err: %w", err)
 	}
 
-	return &models.FetchMeta{GovalDictRevision: revision, SchemaVersion: uint(version), LastFetchedAt: date}, nil
+	validators := map[string]models.CacheValidator{}
+	validatorsStr, err := r.conn.HGet(ctx, fetchMetaKey, "CacheValidators").Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			return nil, xerrors.Errorf("Failed to HGet CacheValidators. err: %w", err)
+		}
+		validatorsStr = "{}"
+	}
+	if err := json.Unmarshal([]byte(validatorsStr), &validators); err != nil {
+		return nil, xerrors.Errorf("Failed to unmarshal JSON. err: %w", err)
+	}
+
+	sums := map[string]string{}
+	sumsStr, err := r.conn.HGet(ctx, fetchMetaKey, "SHA256").Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			return nil, xerrors.Errorf("Failed to HGet SHA256. err: %w", err)
+		}
+		sumsStr = "{}"
+	}
+	if err := json.Unmarshal([]byte(sumsStr), &sums); err != nil {
+		return nil, xerrors.Errorf("Failed to unmarshal JSON. err: %w", err)
+	}
+
+	snapshots := map[string]time.Time{}
+	snapshotsStr, err := r.conn.HGet(ctx, fetchMetaKey, "Snapshots").Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			return nil, xerrors.Errorf("Failed to HGet Snapshots. err: %w", err)
+		}
+		snapshotsStr = "{}"
+	}
+	if err := json.Unmarshal([]byte(snapshotsStr), &snapshots); err != nil {
+		return nil, xerrors.Errorf("Failed to unmarshal JSON. err: %w", err)
+	}
+
+	return &models.FetchMeta{GovalDictRevision: revision, SchemaVersion: uint(version), LastFetchedAt: date, CacheValidators: validators, SHA256: sums, Snapshots: snapshots}, nil
 }
 
 // UpsertFetchMeta upsert FetchMeta to Database
 func (r *RedisDriver) UpsertFetchMeta(fetchMeta *models.FetchMeta) error {
-	return r.conn.HSet(context.Background(), fetchMetaKey, map[string]interface{}{"Revision": c.Revision, "SchemaVersion": models.LatestSchemaVersion, "LastFetchedAt": fetchMeta.LastFetchedAt}).Err()
+	validators, err := json.Marshal(fetchMeta.CacheValidators)
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal JSON. err: %w", err)
+	}
+	sums, err := json.Marshal(fetchMeta.SHA256)
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal JSON. err: %w", err)
+	}
+	snapshots, err := json.Marshal(fetchMeta.Snapshots)
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal JSON. err: %w", err)
+	}
+	return r.conn.HSet(context.Background(), fetchMetaKey, map[string]interface{}{"Revision": c.Revision, "SchemaVersion": models.LatestSchemaVersion, "LastFetchedAt": fetchMeta.LastFetchedAt, "CacheValidators": string(validators), "SHA256": string(sums), "Snapshots": string(snapshots)}).Err()
 }
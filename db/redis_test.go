@@ -296,8 +296,15 @@ func Test_restoreDefinition(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		if aout, _ := restoreDefinition(tt.in.defstr, tt.in.family, tt.in.version, tt.in.arch); !reflect.DeepEqual(aout, tt.expected) {
+		if aout, _ := restoreDefinition(tt.in.defstr, tt.in.family, tt.in.version, tt.in.arch, Omit{}, true); !reflect.DeepEqual(aout, tt.expected) {
 			t.Errorf("[%d] restoreDefinition expected: %#v\n  actual: %#v\n", i, tt.expected, aout)
 		}
+
+		// the children omitted are dropped, and the others kept
+		expected := tt.expected
+		expected.AffectedPacks, expected.References = nil, nil
+		if aout, _ := restoreDefinition(tt.in.defstr, tt.in.family, tt.in.version, tt.in.arch, Omit{Packages: true, References: true}, true); !reflect.DeepEqual(aout, expected) {
+			t.Errorf("[%d] restoreDefinition of omit expected: %#v\n  actual: %#v\n", i, expected, aout)
+		}
 	}
 }
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// ReloadDB is the DB swapped for the one opened again by Reload, e.g. of the sqlite3 file replaced by the one built apart.
+// The operations started before Reload finish on the DB they started on, which is closed after them, and the later ones go to the new DB.
+type ReloadDB struct {
+	open func() (DB, error)
+
+	reloading sync.Mutex
+	mu        sync.RWMutex
+	cur       *reloadHandle
+}
+
+// reloadHandle is a DB with the operations in progress on it
+type reloadHandle struct {
+	DB
+	inFlight sync.WaitGroup
+}
+
+var _ DB = (*ReloadDB)(nil)
+
+// NewReloadDB returns the DB of driver opened already, which is swapped for the one of open by Reload
+func NewReloadDB(driver DB, open func() (DB, error)) *ReloadDB {
+	return &ReloadDB{open: open, cur: &reloadHandle{DB: driver}}
+}
+
+// Reload opens the DB again and swaps the current one for it, closing the old one after the operations in progress on it finish.
+// The current one is kept if the new one fails to open.
+func (d *ReloadDB) Reload() error {
+	d.reloading.Lock()
+	defer d.reloading.Unlock()
+
+	driver, err := d.open()
+	if err != nil {
+		return xerrors.Errorf("Failed to reopen DB, keeping the current one. err: %w", err)
+	}
+	d.mu.Lock()
+	old := d.cur
+	d.cur = &reloadHandle{DB: driver}
+	d.mu.Unlock()
+
+	old.inFlight.Wait()
+	if err := old.CloseDB(); err != nil {
+		return xerrors.Errorf("Failed to close the old DB. err: %w", err)
+	}
+	return nil
+}
+
+// acquire returns the current DB, which is not closed until release is called
+func (d *ReloadDB) acquire() (DB, func()) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	h := d.cur
+	h.inFlight.Add(1)
+	return h.DB, h.inFlight.Done
+}
+
+func (d *ReloadDB) Name() string {
+	driver, release := d.acquire()
+	defer release()
+	return driver.Name()
+}
+
+func (d *ReloadDB) OpenDB(dbType, dbPath string, debugSQL bool, option Option) error {
+	driver, release := d.acquire()
+	defer release()
+	return driver.OpenDB(dbType, dbPath, debugSQL, option)
+}
+
+// CloseDB closes the current DB, waiting for Reload in progress, so that no DB opened by it is left open
+func (d *ReloadDB) CloseDB() error {
+	d.reloading.Lock()
+	defer d.reloading.Unlock()
+	driver, release := d.acquire()
+	defer release()
+	return driver.CloseDB()
+}
+
+func (d *ReloadDB) Ping() error {
+	driver, release := d.acquire()
+	defer release()
+	return driver.Ping()
+}
+
+func (d *ReloadDB) MigrateDB() error {
+	driver, release := d.acquire()
+	defer release()
+	return driver.MigrateDB()
+}
+
+func (d *ReloadDB) PendingMigrations() ([]Migration, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.PendingMigrations()
+}
+
+func (d *ReloadDB) IsGovalDictModelV1() (bool, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.IsGovalDictModelV1()
+}
+
+func (d *ReloadDB) GetFetchMeta() (*models.FetchMeta, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetFetchMeta()
+}
+
+func (d *ReloadDB) UpsertFetchMeta(fetchMeta *models.FetchMeta) error {
+	driver, release := d.acquire()
+	defer release()
+	return driver.UpsertFetchMeta(fetchMeta)
+}
+
+func (d *ReloadDB) StoreSourceFile(file *models.FetchFile) error {
+	driver, release := d.acquire()
+	defer release()
+	return driver.StoreSourceFile(file)
+}
+
+func (d *ReloadDB) TouchSourceFile(fileName string, fetchedAt time.Time) error {
+	driver, release := d.acquire()
+	defer release()
+	return driver.TouchSourceFile(fileName, fetchedAt)
+}
+
+func (d *ReloadDB) GetSourceFile(fileName string) ([]byte, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetSourceFile(fileName)
+}
+
+func (d *ReloadDB) GetFetchHistory(ctx context.Context, family, osVer string, since time.Time) ([]models.FetchHistory, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetFetchHistory(ctx, family, osVer, since)
+}
+
+func (d *ReloadDB) PruneSourceFiles(before time.Time) (int64, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.PruneSourceFiles(before)
+}
+
+func (d *ReloadDB) GetByPackName(ctx context.Context, family, osVer, packName, arch string, classes ...string) ([]models.Definition, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetByPackName(ctx, family, osVer, packName, arch, classes...)
+}
+
+func (d *ReloadDB) GetByPackNames(ctx context.Context, family, osVer string, packNames []string, arch string, classes ...string) (map[string][]models.Definition, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetByPackNames(ctx, family, osVer, packNames, arch, classes...)
+}
+
+func (d *ReloadDB) GetByPackNamePage(ctx context.Context, family, osVer, packName, arch string, page Page, classes ...string) ([]models.Definition, int64, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetByPackNamePage(ctx, family, osVer, packName, arch, page, classes...)
+}
+
+func (d *ReloadDB) GetByCveID(ctx context.Context, family, osVer, cveID, arch string) ([]models.Definition, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetByCveID(ctx, family, osVer, cveID, arch)
+}
+
+func (d *ReloadDB) GetByCveIDPage(ctx context.Context, family, osVer, cveID, arch string, page Page) ([]models.Definition, int64, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetByCveIDPage(ctx, family, osVer, cveID, arch, page)
+}
+
+func (d *ReloadDB) GetByAdvisoryID(ctx context.Context, family, osVer, advisoryID, arch string) ([]models.Definition, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetByAdvisoryID(ctx, family, osVer, advisoryID, arch)
+}
+
+func (d *ReloadDB) GetByCpe(ctx context.Context, family, osVer, cpe, arch string) ([]models.Definition, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetByCpe(ctx, family, osVer, cpe, arch)
+}
+
+func (d *ReloadDB) GetPackInfo(ctx context.Context, family, osVer, packName string) ([]models.PackInfo, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetPackInfo(ctx, family, osVer, packName)
+}
+
+func (d *ReloadDB) ListPackages(ctx context.Context, family, osVer string) ([]string, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.ListPackages(ctx, family, osVer)
+}
+
+func (d *ReloadDB) InsertOval(ctx context.Context, root *models.Root) (models.ChangeStat, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.InsertOval(ctx, root)
+}
+
+func (d *ReloadDB) MergeOval(ctx context.Context, root *models.Root) (models.ChangeStat, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.MergeOval(ctx, root)
+}
+
+func (d *ReloadDB) PurgeOval(ctx context.Context, family, osVer string) (models.RootStat, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.PurgeOval(ctx, family, osVer)
+}
+
+func (d *ReloadDB) CountDefs(family, osVer string) (int, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.CountDefs(family, osVer)
+}
+
+func (d *ReloadDB) IterateDefinitions(ctx context.Context, family, osVer string, fn func(models.Definition) error) error {
+	driver, release := d.acquire()
+	defer release()
+	return driver.IterateDefinitions(ctx, family, osVer, fn)
+}
+
+func (d *ReloadDB) GetRootStats() ([]models.RootStat, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetRootStats()
+}
+
+func (d *ReloadDB) GetRootTimestamps() ([]models.RootTimestamp, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetRootTimestamps()
+}
+
+func (d *ReloadDB) GetLastModified(family, osVer string) (time.Time, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.GetLastModified(family, osVer)
+}
+
+func (d *ReloadDB) UpdateLastModified(family, osVer string, t time.Time) error {
+	driver, release := d.acquire()
+	defer release()
+	return driver.UpdateLastModified(family, osVer, t)
+}
+
+func (d *ReloadDB) CheckStorage(full bool) error {
+	driver, release := d.acquire()
+	defer release()
+	return driver.CheckStorage(full)
+}
+
+func (d *ReloadDB) CheckIntegrity() (Report, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.CheckIntegrity()
+}
+
+func (d *ReloadDB) FixIntegrity() (Report, error) {
+	driver, release := d.acquire()
+	defer release()
+	return driver.FixIntegrity()
+}
+
+func (d *ReloadDB) Vacuum() error {
+	driver, release := d.acquire()
+	defer release()
+	return driver.Vacuum()
+}
+
+func (d *ReloadDB) Optimize() error {
+	driver, release := d.acquire()
+	defer release()
+	return driver.Optimize()
+}
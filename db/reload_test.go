@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// reloadTestDB is the DB whose GetByCpe blocks until unblocked, to be in progress over Reload
+type reloadTestDB struct {
+	DB
+	name    string
+	started chan struct{}
+	unblock chan struct{}
+	closed  atomic.Bool
+}
+
+func newReloadTestDB(name string) *reloadTestDB {
+	return &reloadTestDB{name: name, started: make(chan struct{}, 1), unblock: make(chan struct{})}
+}
+
+func (d *reloadTestDB) Name() string { return d.name }
+
+func (d *reloadTestDB) CloseDB() error {
+	d.closed.Store(true)
+	return nil
+}
+
+func (d *reloadTestDB) GetByCpe(context.Context, string, string, string, string) ([]models.Definition, error) {
+	d.started <- struct{}{}
+	<-d.unblock
+	if d.closed.Load() {
+		return nil, xerrors.New("closed in progress")
+	}
+	return []models.Definition{{DefinitionID: d.name}}, nil
+}
+
+func TestReloadDB(t *testing.T) {
+	old, next := newReloadTestDB("old"), newReloadTestDB("new")
+	opens := []DB{next}
+	d := NewReloadDB(old, func() (DB, error) {
+		if len(opens) == 0 {
+			return nil, xerrors.New("no DB")
+		}
+		driver := opens[0]
+		opens = opens[1:]
+		return driver, nil
+	})
+
+	// the lookup in progress on the old DB
+	type result struct {
+		defs []models.Definition
+		err  error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		defs, err := d.GetByCpe(context.Background(), "", "", "", "")
+		inFlight <- result{defs: defs, err: err}
+	}()
+	<-old.started
+
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- d.Reload() }()
+
+	// the later operations go to the new DB at once, while the old one is not closed until the lookup finishes
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Name() != "new" {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected: the new DB after Reload, actual: %s", d.Name())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-reloaded:
+		t.Fatalf("expected: Reload waiting for the lookup in progress, actual: returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if old.closed.Load() {
+		t.Fatalf("expected: the old DB open until the lookup finishes, actual: closed")
+	}
+
+	close(old.unblock)
+	if r := <-inFlight; r.err != nil || len(r.defs) != 1 || r.defs[0].DefinitionID != "old" {
+		t.Errorf("expected: the lookup in progress finishing on the old DB, actual: %+v, %v", r.defs, r.err)
+	}
+	if err := <-reloaded; err != nil {
+		t.Fatalf("Failed to Reload. err: %s", err)
+	}
+	if !old.closed.Load() {
+		t.Errorf("expected: the old DB closed after Reload, actual: open")
+	}
+
+	// the failure to open keeps the current DB
+	if err := d.Reload(); err == nil {
+		t.Errorf("expected: the error of the failure to open, actual: nil")
+	}
+	if name := d.Name(); name != "new" || next.closed.Load() {
+		t.Errorf("expected: the current DB kept open, actual: %s, closed: %t", name, next.closed.Load())
+	}
+
+	if err := d.CloseDB(); err != nil || !next.closed.Load() {
+		t.Errorf("expected: the current DB closed, actual: %v, closed: %t", err, next.closed.Load())
+	}
+}
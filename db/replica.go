@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// replicaDB is the DB of the writer and the reader apart, e.g. the primary of MySQL and its read replica, opened by NewDB of Option.ReadDBPath.
+// The reads of the OVAL, i.e. the lookups, the roots and their history, go to the reader, so that they are consistent with each other
+// while the reader lags behind the writer, e.g. the timestamps of the conditional requests and the cache of the server and the definitions.
+// The writes go to the writer, and so do the fetch metadata, the source files and the migrations, as they are read before writing them.
+type replicaDB struct {
+	DB
+	reader DB
+}
+
+var _ DB = (*replicaDB)(nil)
+
+// newReplicaDB opens the writer of dbType and dbPath as NewDB does, and the reader of option.ReadDBType and option.ReadDBPath read-only,
+// of dbType if option.ReadDBType is empty
+func newReplicaDB(dbType, dbPath string, debugSQL bool, option Option) (DB, error) {
+	readType, readPath := option.ReadDBType, option.ReadDBPath
+	if readType == "" {
+		readType = dbType
+	}
+	option.ReadDBType, option.ReadDBPath = "", ""
+
+	writer, err := NewDB(dbType, dbPath, debugSQL, option)
+	if err != nil {
+		return nil, err
+	}
+	readOption := option
+	readOption.ReadOnly = true
+	// the reader is migrated by the replication of the writer migrated by NewDB, which it may lag behind, unless the writer is not migrated either
+	readOption.SkipSchemaCheck = option.SkipSchemaCheck || !(option.ReadOnly || option.SkipMigration)
+	reader, err := NewDB(readType, readPath, debugSQL, readOption)
+	if err != nil {
+		_ = writer.CloseDB()
+		return nil, xerrors.Errorf("Failed to open the read DB. err: %w", err)
+	}
+	return errorDB{DB: &replicaDB{DB: writer.(errorDB).DB, reader: reader.(errorDB).DB}, queryTimeout: option.QueryTimeout, slowThreshold: option.SlowQueryThreshold}, nil
+}
+
+// CloseDB closes both of the writer and the reader, returning the error of the writer first
+func (d *replicaDB) CloseDB() error {
+	werr, rerr := d.DB.CloseDB(), d.reader.CloseDB()
+	if werr != nil {
+		return werr
+	}
+	if rerr != nil {
+		return xerrors.Errorf("Failed to close the read DB. err: %w", rerr)
+	}
+	return nil
+}
+
+// Ping pings both of the writer and the reader, e.g. for the health check of the server
+func (d *replicaDB) Ping() error {
+	if err := d.DB.Ping(); err != nil {
+		return err
+	}
+	if err := d.reader.Ping(); err != nil {
+		return xerrors.Errorf("Failed to ping the read DB. err: %w", err)
+	}
+	return nil
+}
+
+func (d *replicaDB) GetFetchHistory(ctx context.Context, family string, osVer string, since time.Time) ([]models.FetchHistory, error) {
+	return d.reader.GetFetchHistory(ctx, family, osVer, since)
+}
+
+func (d *replicaDB) GetByPackName(ctx context.Context, family string, osVer string, packName string, arch string, classes ...string) ([]models.Definition, error) {
+	return d.reader.GetByPackName(ctx, family, osVer, packName, arch, classes...)
+}
+
+func (d *replicaDB) GetByPackNames(ctx context.Context, family string, osVer string, packNames []string, arch string, classes ...string) (map[string][]models.Definition, error) {
+	return d.reader.GetByPackNames(ctx, family, osVer, packNames, arch, classes...)
+}
+
+func (d *replicaDB) GetByPackNamePage(ctx context.Context, family string, osVer string, packName string, arch string, page Page, classes ...string) ([]models.Definition, int64, error) {
+	return d.reader.GetByPackNamePage(ctx, family, osVer, packName, arch, page, classes...)
+}
+
+func (d *replicaDB) GetByCveID(ctx context.Context, family string, osVer string, cveID string, arch string) ([]models.Definition, error) {
+	return d.reader.GetByCveID(ctx, family, osVer, cveID, arch)
+}
+
+func (d *replicaDB) GetByCveIDPage(ctx context.Context, family string, osVer string, cveID string, arch string, page Page) ([]models.Definition, int64, error) {
+	return d.reader.GetByCveIDPage(ctx, family, osVer, cveID, arch, page)
+}
+
+func (d *replicaDB) GetByCpe(ctx context.Context, family string, osVer string, cpe string, arch string) ([]models.Definition, error) {
+	return d.reader.GetByCpe(ctx, family, osVer, cpe, arch)
+}
+
+func (d *replicaDB) GetByAdvisoryID(ctx context.Context, family string, osVer string, advisoryID string, arch string) ([]models.Definition, error) {
+	return d.reader.GetByAdvisoryID(ctx, family, osVer, advisoryID, arch)
+}
+
+func (d *replicaDB) GetPackInfo(ctx context.Context, family string, osVer string, packName string) ([]models.PackInfo, error) {
+	return d.reader.GetPackInfo(ctx, family, osVer, packName)
+}
+
+func (d *replicaDB) ListPackages(ctx context.Context, family string, osVer string) ([]string, error) {
+	return d.reader.ListPackages(ctx, family, osVer)
+}
+
+func (d *replicaDB) CountDefs(family string, osVer string) (int, error) {
+	return d.reader.CountDefs(family, osVer)
+}
+
+func (d *replicaDB) IterateDefinitions(ctx context.Context, family string, osVer string, fn func(models.Definition) error) error {
+	return d.reader.IterateDefinitions(ctx, family, osVer, fn)
+}
+
+func (d *replicaDB) GetRootStats() ([]models.RootStat, error) {
+	return d.reader.GetRootStats()
+}
+
+func (d *replicaDB) GetRootTimestamps() ([]models.RootTimestamp, error) {
+	return d.reader.GetRootTimestamps()
+}
+
+func (d *replicaDB) GetLastModified(family string, osVer string) (time.Time, error) {
+	return d.reader.GetLastModified(family, osVer)
+}
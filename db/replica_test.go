@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+)
+
+func TestReplicaDB(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	dir := t.TempDir()
+	writePath, readPath := filepath.Join(dir, "primary.sqlite3"), filepath.Join(dir, "replica.sqlite3")
+
+	// the replica has redhat 7, which the primary has not, telling the reads of it from the ones of the primary
+	replica, err := NewDB(dialectSqlite3, readPath, false, Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	if _, err := replica.InsertOval(context.Background(), newTestRedHatRoot()); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	if err := replica.CloseDB(); err != nil {
+		t.Fatalf("Failed to CloseDB. err: %s", err)
+	}
+
+	d, err := NewDB(dialectSqlite3, writePath, false, Option{ReadDBPath: readPath})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	root := newTestRedHatRoot()
+	root.OSVersion = "8"
+	if _, err := d.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	if err := d.Ping(); err != nil {
+		t.Errorf("Failed to Ping. err: %s", err)
+	}
+
+	// redhat 7 is read from the replica, and redhat 8 written to the primary is not
+	if defs, err := d.GetByPackName(context.Background(), c.RedHat, "7", "kernel", ""); err != nil || len(defs) != 1 {
+		t.Errorf("expected: 1 definition of the replica, actual: %d, err: %v", len(defs), err)
+	}
+	if _, err := d.GetByCveID(context.Background(), c.RedHat, "8", "CVE-2016-8650", ""); !xerrors.Is(err, ErrNoSuchRelease) {
+		t.Errorf("expected: ErrNoSuchRelease of the release written to the primary, actual: %v", err)
+	}
+	stats, err := d.GetRootStats()
+	if err != nil || len(stats) != 1 || stats[0].OSVersion != "7" {
+		t.Errorf("expected: the root of redhat 7 of the replica, actual: %+v, err: %v", stats, err)
+	}
+
+	// both of the handles are closed
+	rd := d.(errorDB).DB.(*replicaDB)
+	if err := d.CloseDB(); err != nil {
+		t.Fatalf("Failed to CloseDB. err: %s", err)
+	}
+	if rd.DB.Ping() == nil || rd.reader.Ping() == nil {
+		t.Errorf("expected: both of the writer and the reader closed")
+	}
+
+	// redhat 8 is written to the primary only
+	primary, err := NewDB(dialectSqlite3, writePath, false, Option{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer primary.CloseDB()
+	if _, ok := primary.(errorDB).DB.(*RDBDriver); !ok {
+		t.Errorf("expected: the single handle without ReadDBPath, actual: %T", primary.(errorDB).DB)
+	}
+	if defs, err := primary.GetByPackName(context.Background(), c.RedHat, "8", "kernel", ""); err != nil || len(defs) != 1 {
+		t.Errorf("expected: 1 definition of the primary, actual: %d, err: %v", len(defs), err)
+	}
+	if _, err := primary.GetByPackName(context.Background(), c.RedHat, "7", "kernel", ""); !xerrors.Is(err, ErrNoSuchRelease) {
+		t.Errorf("expected: ErrNoSuchRelease of the release of the replica only, actual: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/vulsio/goval-dictionary/log"
+)
+
+// sqlLogger is the logger of gorm, logging the SQL through log.SQL() instead of writing it to stdout: every statement at the debug level
+// with debugSQL, and the one taking slowThreshold or longer at the info level even without debugSQL
+type sqlLogger struct {
+	logger        log15.Logger
+	level         logger.LogLevel
+	debugSQL      bool
+	slowThreshold time.Duration
+}
+
+// newSQLLogger returns the logger of gorm of debugSQL and slowThreshold, never logging the slow SQL if slowThreshold is 0
+func newSQLLogger(debugSQL bool, slowThreshold time.Duration) *sqlLogger {
+	level := logger.Silent
+	if debugSQL {
+		level = logger.Info
+	}
+	return &sqlLogger{logger: log.SQL(), level: level, debugSQL: debugSQL, slowThreshold: slowThreshold}
+}
+
+// LogMode returns the logger of level, silencing the slow SQL as well by logger.Silent
+func (l *sqlLogger) LogMode(level logger.LogLevel) logger.Interface {
+	nl := *l
+	nl.level = level
+	if level == logger.Silent {
+		nl.debugSQL, nl.slowThreshold = false, 0
+	}
+	return &nl
+}
+
+// Info logs the message of gorm at the debug level, e.g. of the migrator
+func (l *sqlLogger) Info(_ context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Info {
+		l.logger.Debug(fmt.Sprintf(msg, args...))
+	}
+}
+
+// Warn logs the warning of gorm
+func (l *sqlLogger) Warn(_ context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Warn {
+		l.logger.Warn(fmt.Sprintf(msg, args...))
+	}
+}
+
+// Error logs the error of gorm, which is returned to the caller anyway
+func (l *sqlLogger) Error(_ context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Error {
+		l.logger.Error(fmt.Sprintf(msg, args...))
+	}
+}
+
+// Trace logs the SQL executed from begin, with the rows affected, the elapsed time and the error except for gorm.ErrRecordNotFound
+func (l *sqlLogger) Trace(_ context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	slow := l.slowThreshold > 0 && elapsed >= l.slowThreshold
+	if !slow && !l.debugSQL {
+		return
+	}
+
+	sql, rows := fc()
+	ctx := []interface{}{"SQL", sql, "Rows", rows, "Elapsed", elapsed}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx = append(ctx, "err", err)
+	}
+	if slow {
+		l.logger.Info("Slow SQL", append(ctx, "Threshold", l.slowThreshold)...)
+		return
+	}
+	l.logger.Debug("SQL", ctx...)
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	sqlite "github.com/glebarez/go-sqlite"
+	"github.com/inconshreveable/log15"
+
+	"github.com/vulsio/goval-dictionary/log"
+)
+
+var registerSleep sync.Once
+
+// newSQLLogTestRDB opens the sqlite3 DB of debugSQL and slowThreshold, with sleep(ms) of SQL sleeping for ms milliseconds
+func newSQLLogTestRDB(t *testing.T, debugSQL bool, slowThreshold time.Duration) *RDBDriver {
+	t.Helper()
+
+	registerSleep.Do(func() {
+		sqlite.MustRegisterScalarFunction("sleep", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			ms, _ := args[0].(int64)
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			return ms, nil
+		})
+	})
+	d, err := NewDB(dialectSqlite3, filepath.Join(t.TempDir(), "oval.sqlite3"), debugSQL, Option{SlowQueryThreshold: slowThreshold})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	t.Cleanup(func() { _ = d.CloseDB() })
+	return d.(errorDB).DB.(*RDBDriver)
+}
+
+func TestSQLLogger(t *testing.T) {
+	tests := []struct {
+		name          string
+		debugSQL      bool
+		slowThreshold time.Duration
+		sleep         int
+		// want are the messages and the levels of the lines of the SQL executed
+		want []string
+	}{
+		{name: "debug-sql", debugSQL: true, want: []string{"SQL dbug"}},
+		{name: "neither", sleep: 200},
+		{name: "fast", slowThreshold: 100 * time.Millisecond, sleep: 1},
+		{name: "slow", slowThreshold: 100 * time.Millisecond, sleep: 200, want: []string{"Slow SQL info"}},
+		{name: "slow with debug-sql", debugSQL: true, slowThreshold: 100 * time.Millisecond, sleep: 200, want: []string{"Slow SQL info"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newSQLLogTestRDB(t, tt.debugSQL, tt.slowThreshold)
+
+			var records []*log15.Record
+			log.SQL().SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+				records = append(records, r)
+				return nil
+			}))
+			defer log.SQL().SetHandler(log15.StderrHandler)
+
+			var ms int64
+			if err := r.conn.Raw("SELECT sleep(?)", tt.sleep).Scan(&ms).Error; err != nil {
+				t.Fatalf("Failed to select. err: %s", err)
+			}
+
+			got := []string{}
+			for _, r := range records {
+				got = append(got, r.Msg+" "+r.Lvl.String())
+				ctx := map[interface{}]interface{}{}
+				for i := 0; i+1 < len(r.Ctx); i += 2 {
+					ctx[r.Ctx[i]] = r.Ctx[i+1]
+				}
+				if want := fmt.Sprintf("SELECT sleep(%d)", tt.sleep); ctx["SQL"] != want || ctx["Module"] != "sql" {
+					t.Errorf("expected: SQL=%q Module=sql, actual: %v", want, r.Ctx)
+				}
+			}
+			if want := append([]string{}, tt.want...); !reflect.DeepEqual(want, got) {
+				t.Errorf("expected: %q, actual: %q", want, got)
+			}
+		})
+	}
+}
@@ -1,28 +1,34 @@
 package alpine
 
 import (
+	"context"
 	"fmt"
+	"regexp"
 
 	"golang.org/x/xerrors"
 
+	"github.com/vulsio/goval-dictionary/config"
 	"github.com/vulsio/goval-dictionary/fetcher/util"
 )
 
-const community = "https://secdb.alpinelinux.org/v%s/community.yaml"
-const main = "https://secdb.alpinelinux.org/v%s/main.yaml"
+const defaultBaseURL = "https://secdb.alpinelinux.org/"
 
-func newFetchRequests(target []string) (reqs []util.FetchRequest) {
+func newFetchRequests(ctx context.Context, target []string) (reqs []util.FetchRequest, err error) {
+	base, err := util.BaseURL(ctx, config.Alpine, defaultBaseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
 	for _, v := range target {
 		reqs = append(reqs, util.FetchRequest{
 			Target:   v,
-			URL:      fmt.Sprintf(main, v),
+			URL:      fmt.Sprintf("%sv%s/main.yaml", base, v),
 			MIMEType: util.MIMETypeYml,
 		})
 
 		if v != "3.2" {
 			reqs = append(reqs, util.FetchRequest{
 				Target:   v,
-				URL:      fmt.Sprintf(community, v),
+				URL:      fmt.Sprintf("%sv%s/community.yaml", base, v),
 				MIMEType: util.MIMETypeYml,
 			})
 		}
@@ -30,17 +36,31 @@ func newFetchRequests(target []string) (reqs []util.FetchRequest) {
 	return
 }
 
+var versionDirPattern = regexp.MustCompile(`^v(\d+\.\d+)$`)
+
+// ListVersions returns the versions listed in the index of secdb, e.g. v3.18/ -> 3.18
+func ListVersions(ctx context.Context) ([]string, error) {
+	base, err := util.BaseURL(ctx, config.Alpine, defaultBaseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
+	vs, err := util.ListIndex(ctx, base, versionDirPattern)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to list index. err: %w", err)
+	}
+	return vs, nil
+}
+
 // FetchFiles fetch from alpine secdb
 // https://secdb.alpinelinux.org/
-func FetchFiles(versions []string) ([]util.FetchResult, error) {
-	reqs := newFetchRequests(versions)
+func FetchFiles(ctx context.Context, versions []string) ([]util.FetchResult, error) {
+	reqs, err := newFetchRequests(ctx, versions)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to create fetch requests. err: %w", err)
+	}
 	if len(reqs) == 0 {
 		return nil, xerrors.New("There are no versions to fetch")
 	}
-	results, err := util.FetchFeedFiles(reqs)
-	if err != nil {
-		return nil, xerrors.Errorf("Failed to fetch. err: %w", err)
-	}
-
+	results, _ := util.FetchFeedFiles(ctx, reqs)
 	return results, nil
 }
@@ -0,0 +1,126 @@
+package alpine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/vulsio/goval-dictionary/fetcher/fetchertest"
+	"github.com/vulsio/goval-dictionary/fetcher/util"
+)
+
+func TestNewFetchRequests(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		expected []string
+	}{
+		{
+			expected: []string{"https://secdb.alpinelinux.org/v3.2/main.yaml", "https://secdb.alpinelinux.org/v3.17/main.yaml", "https://secdb.alpinelinux.org/v3.17/community.yaml"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/alpine/secdb",
+			expected: []string{"https://mirror.example.com/alpine/secdb/v3.2/main.yaml", "https://mirror.example.com/alpine/secdb/v3.17/main.yaml", "https://mirror.example.com/alpine/secdb/v3.17/community.yaml"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/alpine/secdb/",
+			expected: []string{"https://mirror.example.com/alpine/secdb/v3.2/main.yaml", "https://mirror.example.com/alpine/secdb/v3.17/main.yaml", "https://mirror.example.com/alpine/secdb/v3.17/community.yaml"},
+		},
+	}
+	for i, tt := range tests {
+		viper.Set("alpine.base-url", tt.baseURL)
+		reqs, err := newFetchRequests(context.Background(), []string{"3.2", "3.17"})
+		viper.Set("alpine.base-url", nil)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		urls := []string{}
+		for _, r := range reqs {
+			urls = append(urls, r.URL)
+		}
+		if !reflect.DeepEqual(urls, tt.expected) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.expected, urls)
+		}
+	}
+}
+
+func TestFetchFiles(t *testing.T) {
+	viper.Set("threads", 1)
+	defer viper.Set("threads", nil)
+
+	files := map[string][]byte{
+		"https://secdb.alpinelinux.org/v3.2/main.yaml":       []byte("distroversion: v3.2\nreponame: main\n"),
+		"https://secdb.alpinelinux.org/v3.18/main.yaml":      []byte("distroversion: v3.18\nreponame: main\n"),
+		"https://secdb.alpinelinux.org/v3.18/community.yaml": []byte("distroversion: v3.18\nreponame: community\n"),
+	}
+
+	type result struct {
+		target   string
+		url      string
+		body     string
+		notFound bool
+	}
+	tests := []struct {
+		name         string
+		versions     []string
+		wantRequests []string
+		want         []result
+	}{
+		{
+			name:     "main and community",
+			versions: []string{"3.18"},
+			wantRequests: []string{
+				"https://secdb.alpinelinux.org/v3.18/main.yaml",
+				"https://secdb.alpinelinux.org/v3.18/community.yaml",
+			},
+			want: []result{
+				{target: "3.18", url: "https://secdb.alpinelinux.org/v3.18/main.yaml", body: "distroversion: v3.18\nreponame: main\n"},
+				{target: "3.18", url: "https://secdb.alpinelinux.org/v3.18/community.yaml", body: "distroversion: v3.18\nreponame: community\n"},
+			},
+		},
+		{
+			name:     "no community in 3.2",
+			versions: []string{"3.2"},
+			wantRequests: []string{
+				"https://secdb.alpinelinux.org/v3.2/main.yaml",
+			},
+			want: []result{
+				{target: "3.2", url: "https://secdb.alpinelinux.org/v3.2/main.yaml", body: "distroversion: v3.2\nreponame: main\n"},
+			},
+		},
+		{
+			name:     "not found",
+			versions: []string{"3.19"},
+			wantRequests: []string{
+				"https://secdb.alpinelinux.org/v3.19/main.yaml",
+				"https://secdb.alpinelinux.org/v3.19/community.yaml",
+			},
+			want: []result{
+				{target: "3.19", url: "https://secdb.alpinelinux.org/v3.19/main.yaml", notFound: true},
+				{target: "3.19", url: "https://secdb.alpinelinux.org/v3.19/community.yaml", notFound: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fetchertest.NewServer(t, files)
+
+			results, err := FetchFiles(context.Background(), tt.versions)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got := []result{}
+			for _, r := range results {
+				got = append(got, result{target: r.Target, url: r.URL, body: string(r.Body), notFound: util.IsNotFound(r.Err)})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, got)
+			}
+			if !reflect.DeepEqual(s.Requests(), tt.wantRequests) {
+				t.Errorf("expected: %q, actual: %q", tt.wantRequests, s.Requests())
+			}
+		})
+	}
+}
@@ -3,7 +3,7 @@ package amazon
 import (
 	"bufio"
 	"bytes"
-	"compress/gzip"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
@@ -11,52 +11,93 @@ import (
 	"net/url"
 	"path"
 
-	"github.com/inconshreveable/log15"
+	"golang.org/x/exp/maps"
 	"golang.org/x/xerrors"
 
+	"github.com/vulsio/goval-dictionary/config"
 	"github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/log"
 	models "github.com/vulsio/goval-dictionary/models/amazon"
 )
 
 // updateinfo for x86_64 also contains information for aarch64
 
+const cdnBaseURL = "https://cdn.amazonlinux.com/"
+
+// mirrorFile is the path of a file on the default host, or on the base URL if overridden
+type mirrorFile struct {
+	base string
+	path string
+}
+
+func (f mirrorFile) url(ctx context.Context) (string, error) {
+	base, err := util.BaseURL(ctx, config.Amazon, f.base)
+	if err != nil {
+		return "", xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
+	return base + f.path, nil
+}
+
 type mirror struct {
-	core  string
-	extra string
+	core  mirrorFile
+	extra mirrorFile
 }
 
 var mirrors = map[string]mirror{
-	"1": {core: "http://repo.us-west-2.amazonaws.com/2018.03/updates/x86_64/mirror.list"},
+	"1": {core: mirrorFile{base: "http://repo.us-west-2.amazonaws.com/", path: "2018.03/updates/x86_64/mirror.list"}},
 	"2": {
-		core:  "https://cdn.amazonlinux.com/2/core/latest/x86_64/mirror.list",
-		extra: "http://amazonlinux.default.amazonaws.com/2/extras-catalog.json",
+		core:  mirrorFile{base: cdnBaseURL, path: "2/core/latest/x86_64/mirror.list"},
+		extra: mirrorFile{base: "http://amazonlinux.default.amazonaws.com/", path: "2/extras-catalog.json"},
 	},
-	"2022": {core: "https://cdn.amazonlinux.com/al2022/core/mirrors/latest/x86_64/mirror.list"},
-	"2023": {core: "https://cdn.amazonlinux.com/al2023/core/mirrors/latest/x86_64/mirror.list"},
+	"2022": {core: mirrorFile{base: cdnBaseURL, path: "al2022/core/mirrors/latest/x86_64/mirror.list"}},
+	"2023": {core: mirrorFile{base: cdnBaseURL, path: "al2023/core/mirrors/latest/x86_64/mirror.list"}},
+}
+
+func extrasMirror(topic string) mirrorFile {
+	return mirrorFile{base: cdnBaseURL, path: fmt.Sprintf("2/extras/%s/latest/x86_64/mirror.list", topic)}
+}
+
+// ListVersions returns the versions of Amazon Linux, which have the fixed mirrors
+func ListVersions() ([]string, error) {
+	vs := maps.Keys(mirrors)
+	util.SortVersions(vs)
+	return vs, nil
 }
 
 var errNoUpdateInfo = xerrors.New("No updateinfo field in the repomd")
 
 // FetchFiles fetch from Amazon ALAS
-func FetchFiles(versions []string) (map[string]*models.Updates, error) {
+func FetchFiles(ctx context.Context, versions []string) (map[string]*models.Updates, error) {
 	m := map[string]*models.Updates{}
 	for _, v := range versions {
 		switch v {
 		case "1", "2022", "2023":
-			us, err := fetchUpdateInfoAmazonLinux(mirrors[v].core)
+			u, err := mirrors[v].core.url(ctx)
+			if err != nil {
+				return nil, xerrors.Errorf("Failed to get mirror list URL. err: %w", err)
+			}
+			us, err := fetchUpdateInfoAmazonLinux(ctx, u)
 			if err != nil {
 				return nil, xerrors.Errorf("Failed to fetch Amazon Linux %s UpdateInfo. err: %w", v, err)
 			}
 			m[v] = us
 		case "2":
-			updates, err := fetchUpdateInfoAmazonLinux(mirrors[v].core)
+			u, err := mirrors[v].core.url(ctx)
+			if err != nil {
+				return nil, xerrors.Errorf("Failed to get mirror list URL. err: %w", err)
+			}
+			updates, err := fetchUpdateInfoAmazonLinux(ctx, u)
 			if err != nil {
 				return nil, xerrors.Errorf("Failed to fetch Amazon Linux %s UpdateInfo. err: %w", v, err)
 			}
 
-			rs, err := util.FetchFeedFiles([]util.FetchRequest{{URL: mirrors[v].extra, MIMEType: util.MIMETypeJSON}})
+			extra, err := mirrors[v].extra.url(ctx)
+			if err != nil {
+				return nil, xerrors.Errorf("Failed to get extras catalog URL. err: %w", err)
+			}
+			rs, err := util.FetchFeedFiles(ctx, []util.FetchRequest{{URL: extra, MIMEType: util.MIMETypeJSON}})
 			if err != nil || len(rs) != 1 {
-				return nil, xerrors.Errorf("Failed to fetch extras-catalog.json for Amazon Linux 2. url: %s, err: %w", mirrors[v].extra, err)
+				return nil, xerrors.Errorf("Failed to fetch extras-catalog.json for Amazon Linux 2. url: %s, err: %w", extra, err)
 			}
 
 			var catalog extrasCatalog
@@ -65,7 +106,11 @@ func FetchFiles(versions []string) (map[string]*models.Updates, error) {
 			}
 
 			for _, t := range catalog.Topics {
-				us, err := fetchUpdateInfoAmazonLinux(fmt.Sprintf("https://cdn.amazonlinux.com/2/extras/%s/latest/x86_64/mirror.list", t.N))
+				u, err := extrasMirror(t.N).url(ctx)
+				if err != nil {
+					return nil, xerrors.Errorf("Failed to get mirror list URL. err: %w", err)
+				}
+				us, err := fetchUpdateInfoAmazonLinux(ctx, u)
 				if err != nil {
 					if errors.Is(err, errNoUpdateInfo) {
 						continue
@@ -80,14 +125,14 @@ func FetchFiles(versions []string) (map[string]*models.Updates, error) {
 
 			m[v] = updates
 		default:
-			log15.Warn("Skip unknown amazon.", "version", v)
+			log.FromContext(ctx).Warn("Skip unknown amazon.", "version", v)
 		}
 	}
 	return m, nil
 }
 
-func fetchUpdateInfoAmazonLinux(mirrorListURL string) (uinfo *models.Updates, err error) {
-	results, err := util.FetchFeedFiles([]util.FetchRequest{{URL: mirrorListURL, MIMEType: util.MIMETypeXML}})
+func fetchUpdateInfoAmazonLinux(ctx context.Context, mirrorListURL string) (uinfo *models.Updates, err error) {
+	results, err := util.FetchFeedFiles(ctx, []util.FetchRequest{{URL: mirrorListURL, MIMEType: util.MIMETypeXML}})
 	if err != nil || len(results) != 1 {
 		return nil, xerrors.Errorf("Failed to fetch mirror list files. err: %w", err)
 	}
@@ -100,14 +145,14 @@ func fetchUpdateInfoAmazonLinux(mirrorListURL string) (uinfo *models.Updates, er
 		}
 	}
 
-	uinfoURLs, err := fetchUpdateInfoURL(mirrors)
+	uinfoURLs, err := fetchUpdateInfoURL(ctx, mirrors)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch updateInfo URL. err: %w", err)
 	}
 	for _, url := range uinfoURLs {
-		uinfo, err = fetchUpdateInfo(url)
+		uinfo, err = fetchUpdateInfo(ctx, url)
 		if err != nil {
-			log15.Warn("Failed to fetch updateinfo. continue with other mirror", "err", err)
+			log.FromContext(ctx).Warn("Failed to fetch updateinfo. continue with other mirror", "err", err)
 			continue
 		}
 		return uinfo, nil
@@ -116,7 +161,7 @@ func fetchUpdateInfoAmazonLinux(mirrorListURL string) (uinfo *models.Updates, er
 }
 
 // FetchUpdateInfoURL fetches update info urls for AmazonLinux1 ,Amazon Linux2 and Amazon Linux2022.
-func fetchUpdateInfoURL(mirrors []string) (updateInfoURLs []string, err error) {
+func fetchUpdateInfoURL(ctx context.Context, mirrors []string) (updateInfoURLs []string, err error) {
 	reqs := []util.FetchRequest{}
 	for _, mirror := range mirrors {
 		u, err := url.Parse(mirror)
@@ -132,18 +177,21 @@ func fetchUpdateInfoURL(mirrors []string) (updateInfoURLs []string, err error) {
 		})
 	}
 
-	results, err := util.FetchFeedFiles(reqs)
+	results, err := util.FetchFeedFiles(ctx, reqs)
 	if err != nil {
-		log15.Warn("Some errors occurred while fetching repomd", "err", err)
-	}
-	if len(results) == 0 {
-		return nil, xerrors.Errorf("Failed to fetch repomd.xml. URLs: %s", mirrors)
+		log.FromContext(ctx).Warn("Some errors occurred while fetching repomd", "err", err)
 	}
 
+	fetched := 0
 	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		fetched++
+
 		var repoMd repoMd
 		if err := xml.NewDecoder(bytes.NewBuffer(r.Body)).Decode(&repoMd); err != nil {
-			log15.Warn("Failed to decode repomd. Trying another mirror", "err", err)
+			log.FromContext(ctx).Warn("Failed to decode repomd. Trying another mirror", "err", err)
 			continue
 		}
 
@@ -159,25 +207,23 @@ func fetchUpdateInfoURL(mirrors []string) (updateInfoURLs []string, err error) {
 			}
 		}
 	}
+	if fetched == 0 {
+		return nil, xerrors.Errorf("Failed to fetch repomd.xml. URLs: %s", mirrors)
+	}
 	if len(updateInfoURLs) == 0 {
 		return nil, errNoUpdateInfo
 	}
 	return updateInfoURLs, nil
 }
 
-func fetchUpdateInfo(url string) (*models.Updates, error) {
-	results, err := util.FetchFeedFiles([]util.FetchRequest{{URL: url, MIMEType: util.MIMETypeXML}})
+func fetchUpdateInfo(ctx context.Context, url string) (*models.Updates, error) {
+	results, err := util.FetchFeedFiles(ctx, []util.FetchRequest{{URL: url, MIMEType: util.MIMETypeXML}})
 	if err != nil || len(results) != 1 {
 		return nil, xerrors.Errorf("Failed to fetch updateInfo. err: %w", err)
 	}
-	r, err := gzip.NewReader(bytes.NewBuffer(results[0].Body))
-	if err != nil {
-		return nil, xerrors.Errorf("Failed to decompress updateInfo. err: %w", err)
-	}
-	defer r.Close()
-
+	// updateinfo.xml.gz is decompressed by the fetch
 	var updateInfo models.Updates
-	if err := xml.NewDecoder(r).Decode(&updateInfo); err != nil {
+	if err := xml.NewDecoder(bytes.NewReader(results[0].Body)).Decode(&updateInfo); err != nil {
 		return nil, err
 	}
 	for i, alas := range updateInfo.UpdateList {
@@ -0,0 +1,149 @@
+package amazon
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/vulsio/goval-dictionary/fetcher/fetchertest"
+	models "github.com/vulsio/goval-dictionary/models/amazon"
+)
+
+func TestMirrorFileURL(t *testing.T) {
+	files := []mirrorFile{mirrors["1"].core, mirrors["2"].core, mirrors["2"].extra, extrasMirror("kernel-5.10"), mirrors["2023"].core}
+
+	tests := []struct {
+		baseURL  string
+		expected []string
+	}{
+		{
+			expected: []string{
+				"http://repo.us-west-2.amazonaws.com/2018.03/updates/x86_64/mirror.list",
+				"https://cdn.amazonlinux.com/2/core/latest/x86_64/mirror.list",
+				"http://amazonlinux.default.amazonaws.com/2/extras-catalog.json",
+				"https://cdn.amazonlinux.com/2/extras/kernel-5.10/latest/x86_64/mirror.list",
+				"https://cdn.amazonlinux.com/al2023/core/mirrors/latest/x86_64/mirror.list",
+			},
+		},
+		{
+			baseURL: "https://mirror.example.com/amazonlinux",
+			expected: []string{
+				"https://mirror.example.com/amazonlinux/2018.03/updates/x86_64/mirror.list",
+				"https://mirror.example.com/amazonlinux/2/core/latest/x86_64/mirror.list",
+				"https://mirror.example.com/amazonlinux/2/extras-catalog.json",
+				"https://mirror.example.com/amazonlinux/2/extras/kernel-5.10/latest/x86_64/mirror.list",
+				"https://mirror.example.com/amazonlinux/al2023/core/mirrors/latest/x86_64/mirror.list",
+			},
+		},
+		{
+			baseURL: "https://mirror.example.com/amazonlinux/",
+			expected: []string{
+				"https://mirror.example.com/amazonlinux/2018.03/updates/x86_64/mirror.list",
+				"https://mirror.example.com/amazonlinux/2/core/latest/x86_64/mirror.list",
+				"https://mirror.example.com/amazonlinux/2/extras-catalog.json",
+				"https://mirror.example.com/amazonlinux/2/extras/kernel-5.10/latest/x86_64/mirror.list",
+				"https://mirror.example.com/amazonlinux/al2023/core/mirrors/latest/x86_64/mirror.list",
+			},
+		},
+	}
+	for i, tt := range tests {
+		viper.Set("amazon.base-url", tt.baseURL)
+		urls := []string{}
+		for _, f := range files {
+			u, err := f.url(context.Background())
+			if err != nil {
+				t.Errorf("[%d] unexpected error: %s", i, err)
+			}
+			urls = append(urls, u)
+		}
+		viper.Set("amazon.base-url", nil)
+		if !reflect.DeepEqual(urls, tt.expected) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.expected, urls)
+		}
+	}
+}
+
+func TestFetchFiles(t *testing.T) {
+	viper.Set("threads", 1)
+	defer viper.Set("threads", nil)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(`<updates><update><id>ALAS2023-2023-001</id><references><reference id="CVE-2023-0001" type="cve"/><reference id="ALAS2023-2023-001" type="self"/></references></update></updates>`)); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	files := map[string][]byte{
+		"https://cdn.amazonlinux.com/al2023/core/mirrors/latest/x86_64/mirror.list":               []byte("https://cdn.amazonlinux.com/al2023/core/guids/0123/x86_64/\nhttps://cdn.amazonlinux.com/al2023/core/guids/4567/x86_64/\n"),
+		"https://cdn.amazonlinux.com/al2023/core/guids/4567/x86_64/repodata/repomd.xml":           []byte(`<repomd><data type="primary"><location href="repodata/primary.xml.gz"/></data><data type="updateinfo"><location href="repodata/updateinfo.xml.gz"/></data></repomd>`),
+		"https://cdn.amazonlinux.com/al2023/core/guids/4567/x86_64/repodata/updateinfo.xml.gz":    buf.Bytes(),
+		"http://repo.us-west-2.amazonaws.com/2018.03/updates/x86_64/mirror.list":                  []byte("http://packages.us-west-2.amazonaws.com/2018.03/updates/0123/x86_64\n"),
+		"http://packages.us-west-2.amazonaws.com/2018.03/updates/0123/x86_64/repodata/repomd.xml": []byte(`<repomd><data type="primary"><location href="repodata/primary.xml.gz"/></data></repomd>`),
+	}
+
+	tests := []struct {
+		name         string
+		versions     []string
+		wantRequests []string
+		want         map[string][]models.UpdateInfo
+		wantErr      bool
+	}{
+		{
+			name:     "fetched from the mirror found",
+			versions: []string{"2023"},
+			wantRequests: []string{
+				"https://cdn.amazonlinux.com/al2023/core/mirrors/latest/x86_64/mirror.list",
+				"https://cdn.amazonlinux.com/al2023/core/guids/0123/x86_64/repodata/repomd.xml",
+				"https://cdn.amazonlinux.com/al2023/core/guids/4567/x86_64/repodata/repomd.xml",
+				"https://cdn.amazonlinux.com/al2023/core/guids/4567/x86_64/repodata/updateinfo.xml.gz",
+			},
+			want: map[string][]models.UpdateInfo{
+				"2023": {{
+					ID: "ALAS2023-2023-001",
+					References: []models.Reference{
+						{ID: "CVE-2023-0001", Type: "cve"},
+						{ID: "ALAS2023-2023-001", Type: "self"},
+					},
+					CVEIDs: []string{"CVE-2023-0001"},
+				}},
+			},
+		},
+		{
+			name:     "no updateinfo in the repomd",
+			versions: []string{"1"},
+			wantRequests: []string{
+				"http://repo.us-west-2.amazonaws.com/2018.03/updates/x86_64/mirror.list",
+				"http://packages.us-west-2.amazonaws.com/2018.03/updates/0123/x86_64/repodata/repomd.xml",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fetchertest.NewServer(t, files)
+
+			m, err := FetchFiles(context.Background(), tt.versions)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %t, actual: %v", tt.wantErr, err)
+			}
+			if !tt.wantErr {
+				got := map[string][]models.UpdateInfo{}
+				for v, us := range m {
+					got[v] = us.UpdateList
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("expected: %+v, actual: %+v", tt.want, got)
+				}
+			}
+			if !reflect.DeepEqual(s.Requests(), tt.wantRequests) {
+				t.Errorf("expected: %q, actual: %q", tt.wantRequests, s.Requests())
+			}
+		})
+	}
+}
@@ -1,29 +1,37 @@
 package debian
 
 import (
+	"context"
 	"fmt"
+	"regexp"
 
-	"github.com/inconshreveable/log15"
 	"golang.org/x/xerrors"
 
 	"github.com/vulsio/goval-dictionary/config"
 	"github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/log"
+	"github.com/vulsio/goval-dictionary/models"
 )
 
-// https://www.debian.org/security/oval/
-func newFetchRequests(target []string) (reqs []util.FetchRequest) {
-	const t = "https://www.debian.org/security/oval/oval-definitions-%s.xml.bz2"
+const defaultBaseURL = "https://www.debian.org/security/oval/"
+
+func newFetchRequests(ctx context.Context, target []string) (reqs []util.FetchRequest, err error) {
+	base, err := util.BaseURL(ctx, config.Debian, defaultBaseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
 	for _, v := range target {
 		var name string
 		if name = debianName(v); name == "unknown" {
-			log15.Warn("Skip unknown debian.", "version", v)
+			log.FromContext(ctx).Warn("Skip unknown debian.", "version", v)
 			continue
 		}
 		reqs = append(reqs, util.FetchRequest{
 			Target:       v,
-			URL:          fmt.Sprintf(t, name),
+			URL:          fmt.Sprintf("%soval-definitions-%s.xml.bz2", base, name),
 			Concurrently: true,
 			MIMEType:     util.MIMETypeBzip2,
+			Checksum:     true,
 		})
 	}
 	return
@@ -48,15 +56,85 @@ func debianName(major string) string {
 	}
 }
 
-// FetchFiles fetch OVAL from Debian
-func FetchFiles(versions []string) ([]util.FetchResult, error) {
-	reqs := newFetchRequests(versions)
-	if len(reqs) == 0 {
-		return nil, xerrors.New("There are no versions to fetch")
+// defaultVersions are the releases known to debianName, fetched by --all if the OVAL directory cannot be listed
+var defaultVersions = []string{"7", "8", "9", "10", "11", "12"}
+
+// KnownVersions returns the releases known to this binary, without listing the OVAL directory
+func KnownVersions() ([]string, error) {
+	return append([]string{}, defaultVersions...), nil
+}
+
+var ovalFilePattern = regexp.MustCompile(`^oval-definitions-([a-z]+)\.xml(?:\.bz2)?$`)
+
+// ListVersions returns the releases whose OVAL is published in the OVAL directory, e.g. oval-definitions-bookworm.xml.bz2 -> 12
+func ListVersions(ctx context.Context) ([]string, error) {
+	base, err := util.BaseURL(ctx, config.Debian, defaultBaseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
 	}
-	results, err := util.FetchFeedFiles(reqs)
+	names, err := util.ListIndex(ctx, base, ovalFilePattern)
 	if err != nil {
-		return nil, xerrors.Errorf("Failed to fetch. err: %w", err)
+		return nil, xerrors.Errorf("Failed to list index. err: %w", err)
+	}
+
+	vs := []string{}
+	for _, name := range names {
+		v := debianVersion(name)
+		if v == "" {
+			log.FromContext(ctx).Warn("Skip unknown debian release, not supported yet.", "codename", name)
+			continue
+		}
+		vs = append(vs, v)
+	}
+	util.SortVersions(vs)
+	return vs, nil
+}
+
+// DetectVersions returns the releases currently published for --all, or the compiled-in default ones if the OVAL directory cannot be listed
+func DetectVersions(ctx context.Context) []string {
+	vs, err := ListVersions(ctx)
+	switch {
+	case err != nil:
+		log.FromContext(ctx).Warn("Failed to detect the published releases, fetch the default ones instead", "versions", defaultVersions, "err", err)
+		return defaultVersions
+	case len(vs) == 0:
+		log.FromContext(ctx).Warn("No published release found in the OVAL directory, the listing format may have changed, fetch the default ones instead", "versions", defaultVersions)
+		return defaultVersions
+	default:
+		log.FromContext(ctx).Info("Detected the published releases", "versions", vs)
+		return vs
+	}
+}
+
+// debianVersion returns the major version of the codename, or empty if unknown
+func debianVersion(codename string) string {
+	for _, v := range defaultVersions {
+		if debianName(v) == codename {
+			return v
+		}
+	}
+	return ""
+}
+
+// FetchFiles fetch OVAL from Debian, skipping the files not modified since the previous fetch with validators
+func FetchFiles(ctx context.Context, versions []string, validators map[string]models.CacheValidator) ([]util.FetchResult, error) {
+	results := []util.FetchResult{}
+	if err := StreamFiles(ctx, versions, validators, func(r util.FetchResult) { results = append(results, r) }); err != nil {
+		return nil, err
 	}
 	return results, nil
 }
+
+// StreamFiles fetches OVAL from Debian as FetchFiles does, but calls fn with the file of each version in order as soon as it is fetched
+func StreamFiles(ctx context.Context, versions []string, validators map[string]models.CacheValidator, fn func(util.FetchResult)) error {
+	reqs, err := newFetchRequests(ctx, versions)
+	if err != nil {
+		return xerrors.Errorf("Failed to create fetch requests. err: %w", err)
+	}
+	reqs = util.WithCacheValidators(reqs, validators, versions)
+	if len(reqs) == 0 {
+		return xerrors.New("There are no versions to fetch")
+	}
+	_ = util.StreamFeedFiles(ctx, reqs, fn)
+	return nil
+}
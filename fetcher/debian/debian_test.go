@@ -0,0 +1,174 @@
+package debian
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/vulsio/goval-dictionary/fetcher/fetchertest"
+	"github.com/vulsio/goval-dictionary/fetcher/util"
+)
+
+func TestNewFetchRequests(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		expected []string
+	}{
+		{
+			expected: []string{"https://www.debian.org/security/oval/oval-definitions-bullseye.xml.bz2", "https://www.debian.org/security/oval/oval-definitions-bookworm.xml.bz2"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/debian/oval",
+			expected: []string{"https://mirror.example.com/debian/oval/oval-definitions-bullseye.xml.bz2", "https://mirror.example.com/debian/oval/oval-definitions-bookworm.xml.bz2"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/debian/oval/",
+			expected: []string{"https://mirror.example.com/debian/oval/oval-definitions-bullseye.xml.bz2", "https://mirror.example.com/debian/oval/oval-definitions-bookworm.xml.bz2"},
+		},
+	}
+	for i, tt := range tests {
+		viper.Set("debian.base-url", tt.baseURL)
+		reqs, err := newFetchRequests(context.Background(), []string{"11", "12"})
+		viper.Set("debian.base-url", nil)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		urls := []string{}
+		for _, r := range reqs {
+			urls = append(urls, r.URL)
+		}
+		if !reflect.DeepEqual(urls, tt.expected) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.expected, urls)
+		}
+	}
+}
+
+func TestDetectVersions(t *testing.T) {
+	index, err := os.ReadFile(filepath.Join("testdata", "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture. err: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		status   int
+		body     []byte
+		expected []string
+	}{
+		{
+			name:     "listed",
+			status:   http.StatusOK,
+			body:     index,
+			expected: []string{"9", "10", "11", "12"},
+		},
+		{
+			name:     "listing format changed",
+			status:   http.StatusOK,
+			body:     []byte(`<ul><li>oval-definitions-bookworm.xml.bz2</li></ul>`),
+			expected: defaultVersions,
+		},
+		{
+			name:     "not listed",
+			status:   http.StatusForbidden,
+			expected: defaultVersions,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/security/oval/" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write(tt.body)
+			}))
+			defer ts.Close()
+
+			viper.Set("debian.base-url", ts.URL+"/security/oval/")
+			defer viper.Set("debian.base-url", nil)
+
+			if vs := DetectVersions(context.Background()); !reflect.DeepEqual(vs, tt.expected) {
+				t.Errorf("expected: %v, actual: %v", tt.expected, vs)
+			}
+		})
+	}
+}
+
+func TestFetchFiles(t *testing.T) {
+	viper.Set("threads", 1)
+	defer viper.Set("threads", nil)
+
+	bookworm, err := os.ReadFile(filepath.Join("testdata", "oval-definitions-bookworm.xml.bz2"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture. err: %s", err)
+	}
+
+	type result struct {
+		target   string
+		body     string
+		notFound bool
+	}
+	tests := []struct {
+		name         string
+		versions     []string
+		wantRequests []string
+		want         []result
+	}{
+		{
+			name:     "fetched",
+			versions: []string{"12"},
+			wantRequests: []string{
+				"https://www.debian.org/security/oval/oval-definitions-bookworm.xml.bz2",
+				"https://www.debian.org/security/oval/oval-definitions-bookworm.xml.bz2.sha256",
+			},
+			want: []result{{target: "12", body: "<oval_definitions><!-- bookworm --></oval_definitions>"}},
+		},
+		{
+			name:     "not found",
+			versions: []string{"11", "12"},
+			wantRequests: []string{
+				"https://www.debian.org/security/oval/oval-definitions-bullseye.xml.bz2",
+				"https://www.debian.org/security/oval/oval-definitions-bookworm.xml.bz2",
+				"https://www.debian.org/security/oval/oval-definitions-bookworm.xml.bz2.sha256",
+			},
+			want: []result{{target: "11", notFound: true}, {target: "12", body: "<oval_definitions><!-- bookworm --></oval_definitions>"}},
+		},
+		{
+			name:     "unknown version",
+			versions: []string{"6", "12"},
+			wantRequests: []string{
+				"https://www.debian.org/security/oval/oval-definitions-bookworm.xml.bz2",
+				"https://www.debian.org/security/oval/oval-definitions-bookworm.xml.bz2.sha256",
+			},
+			want: []result{{target: "12", body: "<oval_definitions><!-- bookworm --></oval_definitions>"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fetchertest.NewServer(t, map[string][]byte{"https://www.debian.org/security/oval/oval-definitions-bookworm.xml.bz2": bookworm})
+
+			results, err := FetchFiles(context.Background(), tt.versions, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got := []result{}
+			for _, r := range results {
+				got = append(got, result{target: r.Target, body: string(r.Body), notFound: util.IsNotFound(r.Err)})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, got)
+			}
+			if !reflect.DeepEqual(s.Requests(), tt.wantRequests) {
+				t.Errorf("expected: %q, actual: %q", tt.wantRequests, s.Requests())
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package fedora
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"net/url"
@@ -10,11 +11,12 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/inconshreveable/log15"
 	"golang.org/x/xerrors"
 	"gopkg.in/yaml.v2"
 
+	"github.com/vulsio/goval-dictionary/config"
 	"github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/log"
 	models "github.com/vulsio/goval-dictionary/models/fedora"
 )
 
@@ -22,26 +24,32 @@ const (
 	archX8664   = "x86_64"
 	archAarch64 = "aarch64"
 
-	pubUpdateURL     = "https://dl.fedoraproject.org/pub/fedora/linux/updates/%s/Everything/%s/repodata/repomd.xml"
-	pubModuleURL     = "https://dl.fedoraproject.org/pub/fedora/linux/updates/%s/Modular/%s/repodata/repomd.xml"
-	archiveUpdateURL = "https://archives.fedoraproject.org/pub/archive/fedora/linux/updates/%s/Everything/%s/repodata/repomd.xml"
-	archiveModuleURL = "https://archives.fedoraproject.org/pub/archive/fedora/linux/updates/%s/Modular/%s/repodata/repomd.xml"
-	bugZillaURL      = "https://bugzilla.redhat.com/show_bug.cgi?ctype=xml&id=%s"
-	kojiPkgURL       = "https://kojipkgs.fedoraproject.org/packages/%s/%s/%s/files/module/modulemd.%s.txt"
+	// the mirror of the base URL, if overridden, has both of pub and archive, like dl.fedoraproject.org/pub/
+	pubBaseURL        = "https://dl.fedoraproject.org/pub/"
+	archiveBaseURL    = "https://archives.fedoraproject.org/pub/"
+	pubUpdatePath     = "fedora/linux/updates/%s/Everything/%s/repodata/repomd.xml"
+	pubModulePath     = "fedora/linux/updates/%s/Modular/%s/repodata/repomd.xml"
+	archiveUpdatePath = "archive/fedora/linux/updates/%s/Everything/%s/repodata/repomd.xml"
+	archiveModulePath = "archive/fedora/linux/updates/%s/Modular/%s/repodata/repomd.xml"
+	bugZillaURL       = "https://bugzilla.redhat.com/show_bug.cgi?ctype=xml&id=%s"
+	kojiPkgURL        = "https://kojipkgs.fedoraproject.org/packages/%s/%s/%s/files/module/modulemd.%s.txt"
 )
 
 // FetchUpdateInfosFedora fetch OVAL from Fedora
-func FetchUpdateInfosFedora(versions []string) (map[string]*models.Updates, error) {
+func FetchUpdateInfosFedora(ctx context.Context, versions []string) (map[string]*models.Updates, error) {
 	// map[osVer][updateInfoID]models.UpdateInfo
 	uinfos := make(map[string]map[string]models.UpdateInfo, len(versions))
 	for _, arch := range []string{archX8664, archAarch64} {
-		reqs, moduleReqs := newFedoraFetchRequests(versions, arch)
-		everythingResults, err := fetchEverythingFedora(reqs)
+		reqs, moduleReqs, err := newFedoraFetchRequests(ctx, versions, arch)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to create fetch requests. err: %w", err)
+		}
+		everythingResults, err := fetchEverythingFedora(ctx, reqs)
 		if err != nil {
 			return nil, xerrors.Errorf("fetchEverythingFedora. err: %w", err)
 		}
 
-		moduleResults, err := fetchModulesFedora(moduleReqs, arch)
+		moduleResults, err := fetchModulesFedora(ctx, moduleReqs, arch)
 		if err != nil {
 			return nil, xerrors.Errorf("fetchModulesFedora. err: %w", err)
 		}
@@ -69,31 +77,75 @@ func FetchUpdateInfosFedora(versions []string) (map[string]*models.Updates, erro
 	}
 
 	for version, v := range results {
-		log15.Info(fmt.Sprintf("%d Advisories for Fedora %s Fetched", len(v.UpdateList), version))
+		log.FromContext(ctx).Info("Fetched the advisories", "Family", config.Fedora, "Version", version, "Count", len(v.UpdateList))
 	}
 
 	return results, nil
 }
 
-func newFedoraFetchRequests(target []string, arch string) (reqs []util.FetchRequest, moduleReqs []util.FetchRequest) {
+var releaseDirPattern = regexp.MustCompile(`^(\d+)$`)
+
+// ListVersions returns the versions with vulnerability information listed in the updates indexes of pub and archive
+func ListVersions(ctx context.Context) ([]string, error) {
+	pubBase, err := util.BaseURL(ctx, config.Fedora, pubBaseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
+	archiveBase, err := util.BaseURL(ctx, config.Fedora, archiveBaseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
+
+	vs := []string{}
+	for _, index := range []struct {
+		url      string
+		min, max int
+	}{
+		{url: archiveBase + "archive/fedora/linux/updates/", min: 32, max: 35},
+		{url: pubBase + "fedora/linux/updates/", min: 36},
+	} {
+		listed, err := util.ListIndex(ctx, index.url, releaseDirPattern)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to list index. err: %w", err)
+		}
+		for _, v := range listed {
+			// the same range as newFedoraFetchRequests fetches from each
+			n, _ := strconv.Atoi(v)
+			if n >= index.min && (index.max == 0 || n <= index.max) {
+				vs = append(vs, v)
+			}
+		}
+	}
+	return vs, nil
+}
+
+func newFedoraFetchRequests(ctx context.Context, target []string, arch string) (reqs []util.FetchRequest, moduleReqs []util.FetchRequest, err error) {
+	pubBase, err := util.BaseURL(ctx, config.Fedora, pubBaseURL)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
+	archiveBase, err := util.BaseURL(ctx, config.Fedora, archiveBaseURL)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
 	for _, v := range target {
 		var updateURL, moduleURL string
 		n, err := strconv.Atoi(v)
 		if err != nil {
-			log15.Warn("Skip unknown fedora.", "version", v)
+			log.FromContext(ctx).Warn("Skip unknown fedora.", "version", v)
 			continue
 		}
 
 		switch {
 		case n < 32:
-			log15.Warn("Skip fedora because no vulnerability information provided.", "version", v)
+			log.FromContext(ctx).Warn("Skip fedora because no vulnerability information provided.", "version", v)
 			continue
 		case n < 36:
-			updateURL = archiveUpdateURL
-			moduleURL = archiveModuleURL
+			updateURL = archiveBase + archiveUpdatePath
+			moduleURL = archiveBase + archiveModulePath
 		default:
-			updateURL = pubUpdateURL
-			moduleURL = pubModuleURL
+			updateURL = pubBase + pubUpdatePath
+			moduleURL = pubBase + pubModulePath
 		}
 
 		reqs = append(reqs, util.FetchRequest{
@@ -112,19 +164,19 @@ func newFedoraFetchRequests(target []string, arch string) (reqs []util.FetchRequ
 	return
 }
 
-func fetchEverythingFedora(reqs []util.FetchRequest) (map[string]*models.Updates, error) {
-	log15.Info("start fetch data from repomd.xml of non-modular package")
-	feeds, err := fetchFeedFilesFedora(reqs)
+func fetchEverythingFedora(ctx context.Context, reqs []util.FetchRequest) (map[string]*models.Updates, error) {
+	log.FromContext(ctx).Info("start fetch data from repomd.xml of non-modular package")
+	feeds, err := fetchFeedFilesFedora(ctx, reqs)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch feed file, err: %w", err)
 	}
 
-	updates, err := fetchUpdateInfosFedora(feeds)
+	updates, err := fetchUpdateInfosFedora(ctx, feeds)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch updateinfo, err: %w", err)
 	}
 
-	results, err := parseFetchResultsFedora(updates)
+	results, err := parseFetchResultsFedora(ctx, updates)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to parse fetch results, err: %w", err)
 	}
@@ -132,24 +184,24 @@ func fetchEverythingFedora(reqs []util.FetchRequest) (map[string]*models.Updates
 	return results, nil
 }
 
-func fetchModulesFedora(reqs []util.FetchRequest, arch string) (map[string]*models.Updates, error) {
-	log15.Info("start fetch data from repomd.xml of modular")
-	feeds, err := fetchModuleFeedFilesFedora(reqs)
+func fetchModulesFedora(ctx context.Context, reqs []util.FetchRequest, arch string) (map[string]*models.Updates, error) {
+	log.FromContext(ctx).Info("start fetch data from repomd.xml of modular")
+	feeds, err := fetchModuleFeedFilesFedora(ctx, reqs)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch feed file, err: %w", err)
 	}
 
-	updates, err := fetchUpdateInfosFedora(feeds)
+	updates, err := fetchUpdateInfosFedora(ctx, feeds)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch updateinfo, err: %w", err)
 	}
 
-	moduleYaml, err := fetchModulesYamlFedora(feeds)
+	moduleYaml, err := fetchModulesYamlFedora(ctx, feeds)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch module info, err: %w", err)
 	}
 
-	results, err := parseFetchResultsFedora(updates)
+	results, err := parseFetchResultsFedora(ctx, updates)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to parse fetch results, err: %w", err)
 	}
@@ -158,7 +210,7 @@ func fetchModulesFedora(reqs []util.FetchRequest, arch string) (map[string]*mode
 		for i, update := range result.UpdateList {
 			yml, ok := moduleYaml[version][update.Title]
 			if !ok {
-				yml, err = fetchModuleInfoFromKojiPkgs(arch, update.Title)
+				yml, err = fetchModuleInfoFromKojiPkgs(ctx, arch, update.Title)
 				if err != nil {
 					return nil, xerrors.Errorf("Failed to fetch module info from kojipkgs.fedoraproject.org, err: %w", err)
 				}
@@ -178,19 +230,19 @@ func fetchModulesFedora(reqs []util.FetchRequest, arch string) (map[string]*mode
 	return results, nil
 }
 
-func fetchFeedFilesFedora(reqs []util.FetchRequest) ([]util.FetchResult, error) {
+func fetchFeedFilesFedora(ctx context.Context, reqs []util.FetchRequest) ([]util.FetchResult, error) {
 	if len(reqs) == 0 {
 		return nil, xerrors.New("There are no versions to fetch")
 	}
-	results, err := util.FetchFeedFiles(reqs)
+	results, err := util.FetchFeedFiles(ctx, reqs)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch. err: %w", err)
 	}
 	return results, nil
 }
 
-func fetchUpdateInfosFedora(results []util.FetchResult) ([]util.FetchResult, error) {
-	log15.Info("start fetch updateinfo in repomd.xml")
+func fetchUpdateInfosFedora(ctx context.Context, results []util.FetchResult) ([]util.FetchResult, error) {
+	log.FromContext(ctx).Info("start fetch updateinfo in repomd.xml")
 	updateInfoReqs, err := extractInfoFromRepoMd(results, "updateinfo", util.MIMETypeXz)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to extract updateinfo from xml, err: %w", err)
@@ -200,7 +252,7 @@ func fetchUpdateInfosFedora(results []util.FetchResult) ([]util.FetchResult, err
 		return nil, xerrors.New("No updateinfo field in the repomd")
 	}
 
-	results, err = util.FetchFeedFiles(updateInfoReqs)
+	results, err = util.FetchFeedFiles(ctx, updateInfoReqs)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch. err: %w", err)
 	}
@@ -210,7 +262,7 @@ func fetchUpdateInfosFedora(results []util.FetchResult) ([]util.FetchResult, err
 // variousFlawsPattern is regexp to detect title that omit the part of CVE-IDs by finding both `...` and `various flaws`
 var variousFlawsPattern = regexp.MustCompile(`.*\.\.\..*various flaws.*`)
 
-func parseFetchResultsFedora(results []util.FetchResult) (map[string]*models.Updates, error) {
+func parseFetchResultsFedora(ctx context.Context, results []util.FetchResult) (map[string]*models.Updates, error) {
 	updateInfos := make(map[string]*models.Updates, len(results))
 	for _, r := range results {
 		var updateInfo models.Updates
@@ -234,7 +286,7 @@ func parseFetchResultsFedora(results []util.FetchResult) (map[string]*models.Upd
 					}
 				} else {
 					var err error
-					ids, err = fetchCveIDsFromBugzilla(ref.ID)
+					ids, err = fetchCveIDsFromBugzilla(ctx, ref.ID)
 					if err != nil {
 						return nil, xerrors.Errorf("Failed to fetch CVE-IDs from bugzilla, err: %w", err)
 					}
@@ -260,19 +312,19 @@ func isFedoraUpdateInfoTitleReliable(title string) bool {
 	return len(util.CveIDPattern.FindAllString(title, -1)) == strings.Count(title, "CVE-")
 }
 
-func fetchModuleFeedFilesFedora(reqs []util.FetchRequest) ([]util.FetchResult, error) {
+func fetchModuleFeedFilesFedora(ctx context.Context, reqs []util.FetchRequest) ([]util.FetchResult, error) {
 	if len(reqs) == 0 {
 		return nil, xerrors.New("There are no versions to fetch")
 	}
-	results, err := util.FetchFeedFiles(reqs)
+	results, err := util.FetchFeedFiles(ctx, reqs)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch. err: %w", err)
 	}
 	return results, nil
 }
 
-func fetchModulesYamlFedora(results []util.FetchResult) (moduleInfosPerVersion, error) {
-	log15.Info("start fetch modules.yaml in repomd.xml")
+func fetchModulesYamlFedora(ctx context.Context, results []util.FetchResult) (moduleInfosPerVersion, error) {
+	log.FromContext(ctx).Info("start fetch modules.yaml in repomd.xml")
 	updateInfoReqs, err := extractInfoFromRepoMd(results, "modules", util.MIMETypeGzip)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to extract modules from xml, err: %w", err)
@@ -282,7 +334,7 @@ func fetchModulesYamlFedora(results []util.FetchResult) (moduleInfosPerVersion,
 		return nil, xerrors.New("No updateinfo field in the repomd")
 	}
 
-	results, err = util.FetchFeedFiles(updateInfoReqs)
+	results, err = util.FetchFeedFiles(ctx, updateInfoReqs)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch modules.yaml, err: %w", err)
 	}
@@ -329,14 +381,14 @@ func parseModulesYamlFedora(b []byte) (moduleInfosPerPackage, error) {
 	return modules, nil
 }
 
-func fetchCveIDsFromBugzilla(id string) ([]string, error) {
+func fetchCveIDsFromBugzilla(ctx context.Context, id string) ([]string, error) {
 	req := util.FetchRequest{
 		URL:           fmt.Sprintf(bugZillaURL, id),
 		LogSuppressed: true,
 		MIMEType:      util.MIMETypeXML,
 	}
-	log15.Info("Fetch CVE-ID list from bugzilla.redhat.com", "URL", req.URL)
-	body, err := util.FetchFeedFiles([]util.FetchRequest{req})
+	log.FromContext(ctx).Info("Fetch CVE-ID list from bugzilla.redhat.com", "URL", req.URL)
+	body, err := util.FetchFeedFiles(ctx, []util.FetchRequest{req})
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch CVE-ID list, err: %w", err)
 	}
@@ -356,7 +408,7 @@ func fetchCveIDsFromBugzilla(id string) ([]string, error) {
 		}
 	}
 
-	results, err := util.FetchFeedFiles(reqs)
+	results, err := util.FetchFeedFiles(ctx, reqs)
 	if err != nil {
 		return nil, xerrors.Errorf("Failed to fetch CVE-IDs, err: %w", err)
 	}
@@ -373,7 +425,7 @@ func fetchCveIDsFromBugzilla(id string) ([]string, error) {
 		}
 	}
 
-	log15.Info(fmt.Sprintf("%d CVE-IDs fetched", len(ids)))
+	log.FromContext(ctx).Info("Fetched the CVE-IDs", "Count", len(ids))
 	return ids, nil
 }
 
@@ -408,12 +460,12 @@ func extractInfoFromRepoMd(results []util.FetchResult, rt string, mt util.MIMETy
 }
 
 // uinfoTitle is expected title of xml format as ${name}-${stream}-${version}.${context}
-func fetchModuleInfoFromKojiPkgs(arch, uinfoTitle string) (moduleInfo, error) {
+func fetchModuleInfoFromKojiPkgs(ctx context.Context, arch, uinfoTitle string) (moduleInfo, error) {
 	req, err := newKojiPkgsRequest(arch, uinfoTitle)
 	if err != nil {
 		return moduleInfo{}, xerrors.Errorf("Failed to generate request to kojipkgs.fedoraproject.org, err: %w", err)
 	}
-	result, err := util.FetchFeedFiles([]util.FetchRequest{req})
+	result, err := util.FetchFeedFiles(ctx, []util.FetchRequest{req})
 	if err != nil {
 		return moduleInfo{}, xerrors.Errorf("Failed to fetch from kojipkgs.fedoraproject.org, err: %w", err)
 	}
@@ -0,0 +1,148 @@
+package fedora
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/ulikunitz/xz"
+
+	"github.com/vulsio/goval-dictionary/fetcher/fetchertest"
+	models "github.com/vulsio/goval-dictionary/models/fedora"
+)
+
+func TestNewFedoraFetchRequests(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		expected []string
+	}{
+		{
+			expected: []string{
+				"https://archives.fedoraproject.org/pub/archive/fedora/linux/updates/35/Everything/x86_64/repodata/repomd.xml",
+				"https://dl.fedoraproject.org/pub/fedora/linux/updates/37/Everything/x86_64/repodata/repomd.xml",
+				"https://archives.fedoraproject.org/pub/archive/fedora/linux/updates/35/Modular/x86_64/repodata/repomd.xml",
+				"https://dl.fedoraproject.org/pub/fedora/linux/updates/37/Modular/x86_64/repodata/repomd.xml",
+			},
+		},
+		{
+			baseURL: "https://mirror.example.com/fedora/pub",
+			expected: []string{
+				"https://mirror.example.com/fedora/pub/archive/fedora/linux/updates/35/Everything/x86_64/repodata/repomd.xml",
+				"https://mirror.example.com/fedora/pub/fedora/linux/updates/37/Everything/x86_64/repodata/repomd.xml",
+				"https://mirror.example.com/fedora/pub/archive/fedora/linux/updates/35/Modular/x86_64/repodata/repomd.xml",
+				"https://mirror.example.com/fedora/pub/fedora/linux/updates/37/Modular/x86_64/repodata/repomd.xml",
+			},
+		},
+		{
+			baseURL: "https://mirror.example.com/fedora/pub/",
+			expected: []string{
+				"https://mirror.example.com/fedora/pub/archive/fedora/linux/updates/35/Everything/x86_64/repodata/repomd.xml",
+				"https://mirror.example.com/fedora/pub/fedora/linux/updates/37/Everything/x86_64/repodata/repomd.xml",
+				"https://mirror.example.com/fedora/pub/archive/fedora/linux/updates/35/Modular/x86_64/repodata/repomd.xml",
+				"https://mirror.example.com/fedora/pub/fedora/linux/updates/37/Modular/x86_64/repodata/repomd.xml",
+			},
+		},
+	}
+	for i, tt := range tests {
+		viper.Set("fedora.base-url", tt.baseURL)
+		reqs, moduleReqs, err := newFedoraFetchRequests(context.Background(), []string{"31", "35", "37"}, archX8664)
+		viper.Set("fedora.base-url", nil)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		urls := []string{}
+		for _, r := range append(reqs, moduleReqs...) {
+			urls = append(urls, r.URL)
+		}
+		if !reflect.DeepEqual(urls, tt.expected) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.expected, urls)
+		}
+	}
+}
+
+func TestFetchEverythingFedora(t *testing.T) {
+	viper.Set("threads", 1)
+	defer viper.Set("threads", nil)
+
+	var buf bytes.Buffer
+	xw, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("Failed to create xz writer. err: %s", err)
+	}
+	if _, err := xw.Write([]byte(`<updates>
+<update type="security"><id>FEDORA-2023-0001</id><title>curl-8.0.1-1.fc38</title><references><reference id="2000001" title="CVE-2023-0001 curl: a flaw" type="bugzilla"/></references></update>
+<update type="bugfix"><id>FEDORA-2023-0002</id><title>bash-5.2.15-3.fc38</title></update>
+</updates>`)); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	if err := xw.Close(); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	files := map[string][]byte{
+		"https://dl.fedoraproject.org/pub/fedora/linux/updates/38/Everything/x86_64/repodata/repomd.xml":             []byte(`<repomd><data type="primary"><location href="repodata/0123-primary.xml.zst"/></data><data type="updateinfo"><location href="repodata/4567-updateinfo.xml.xz"/></data></repomd>`),
+		"https://dl.fedoraproject.org/pub/fedora/linux/updates/38/Everything/x86_64/repodata/4567-updateinfo.xml.xz": buf.Bytes(),
+	}
+
+	tests := []struct {
+		name         string
+		versions     []string
+		wantRequests []string
+		want         map[string][]models.UpdateInfo
+		wantErr      bool
+	}{
+		{
+			name:     "security updates",
+			versions: []string{"38"},
+			wantRequests: []string{
+				"https://dl.fedoraproject.org/pub/fedora/linux/updates/38/Everything/x86_64/repodata/repomd.xml",
+				"https://dl.fedoraproject.org/pub/fedora/linux/updates/38/Everything/x86_64/repodata/4567-updateinfo.xml.xz",
+			},
+			want: map[string][]models.UpdateInfo{
+				"38": {{
+					ID:         "FEDORA-2023-0001",
+					Title:      "curl-8.0.1-1.fc38",
+					Type:       "security",
+					References: []models.Reference{{ID: "2000001", Title: "CVE-2023-0001 curl: a flaw", Type: "bugzilla"}},
+					CVEIDs:     []string{"CVE-2023-0001"},
+				}},
+			},
+		},
+		{
+			name:     "repomd not found",
+			versions: []string{"35"},
+			wantRequests: []string{
+				"https://archives.fedoraproject.org/pub/archive/fedora/linux/updates/35/Everything/x86_64/repodata/repomd.xml",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fetchertest.NewServer(t, files)
+
+			reqs, _, err := newFedoraFetchRequests(context.Background(), tt.versions, archX8664)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			m, err := fetchEverythingFedora(context.Background(), reqs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %t, actual: %v", tt.wantErr, err)
+			}
+			if !tt.wantErr {
+				got := map[string][]models.UpdateInfo{}
+				for v, us := range m {
+					got[v] = us.UpdateList
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("expected: %+v, actual: %+v", tt.want, got)
+				}
+			}
+			if !reflect.DeepEqual(s.Requests(), tt.wantRequests) {
+				t.Errorf("expected: %q, actual: %q", tt.wantRequests, s.Requests())
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Package fetchertest serves the files of the upstream URLs to the fetchers in the tests, so that the URLs built by the fetchers
+// and the handling of the responses are tested without the network
+package fetchertest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vulsio/goval-dictionary/fetcher/util"
+)
+
+// urlHeader carries the requested URL from the client to the server
+const urlHeader = "X-Fetchertest-Url"
+
+// Server serves the files by the URLs requested by the fetchers, e.g. "https://www.debian.org/security/oval/oval-definitions-bookworm.xml.bz2",
+// and 404 for the others
+type Server struct {
+	srv      *httptest.Server
+	files    map[string][]byte
+	mu       sync.Mutex
+	requests []string
+}
+
+// NewServer starts the server of files, and makes the fetchers send the requests to it through util.SetHTTPClient until the end of the test
+func NewServer(t testing.TB, files map[string][]byte) *Server {
+	t.Helper()
+
+	s := &Server{files: files}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	target, err := url.Parse(s.srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL. err: %s", err)
+	}
+	util.SetHTTPClient(&http.Client{Transport: &rewriteTransport{server: s, target: target, base: s.srv.Client().Transport}})
+	t.Cleanup(func() {
+		util.SetHTTPClient(nil)
+		s.srv.Close()
+	})
+	return s
+}
+
+// Requests returns the URLs requested so far, each once in the order of the first request,
+// as the concurrent download requests a file with HEAD first and may request it in ranges
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	urls := []string{}
+	seen := map[string]struct{}{}
+	for _, u := range s.requests {
+		if _, ok := seen[u]; ok {
+			continue
+		}
+		seen[u] = struct{}{}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	bs, ok := s.files[r.Header.Get(urlHeader)]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	// serves HEAD and the ranges as well, which are requested by the concurrent downloads
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(bs))
+}
+
+// rewriteTransport sends the requests of any URL to the server, passing the requested one in urlHeader
+type rewriteTransport struct {
+	server *Server
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requested := req.URL.String()
+	t.server.mu.Lock()
+	t.server.requests = append(t.server.requests, requested)
+	t.server.mu.Unlock()
+
+	req = req.Clone(req.Context())
+	req.Header.Set(urlHeader, requested)
+	req.URL.Scheme, req.URL.Host, req.Host = t.target.Scheme, t.target.Host, t.target.Host
+	return t.base.RoundTrip(req)
+}
@@ -1,29 +1,60 @@
 package oracle
 
 import (
+	"context"
+	"fmt"
+	"strconv"
+
 	"golang.org/x/xerrors"
 
+	"github.com/vulsio/goval-dictionary/config"
 	"github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models"
 )
 
-func newFetchRequests() (reqs []util.FetchRequest) {
-	const t = "https://linux.oracle.com/security/oval/com.oracle.elsa-all.xml.bz2"
+const defaultBaseURL = "https://linux.oracle.com/security/oval/"
+
+// newFetchRequests returns the request of com.oracle.elsa-all.xml.bz2, or of com.oracle.elsa-<year>.xml.bz2 for each of years if any
+func newFetchRequests(ctx context.Context, years []int) (reqs []util.FetchRequest, err error) {
+	base, err := util.BaseURL(ctx, config.Oracle, defaultBaseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
+	for _, year := range years {
+		reqs = append(reqs, util.FetchRequest{
+			Target:   strconv.Itoa(year),
+			URL:      fmt.Sprintf("%scom.oracle.elsa-%d.xml.bz2", base, year),
+			MIMEType: util.MIMETypeBzip2,
+			Checksum: true,
+		})
+	}
+	if len(years) > 0 {
+		return
+	}
 	reqs = append(reqs, util.FetchRequest{
-		URL:      t,
+		URL:      base + "com.oracle.elsa-all.xml.bz2",
 		MIMEType: util.MIMETypeBzip2,
+		Checksum: true,
 	})
 	return
 }
 
-// FetchFiles fetch OVAL from Oracle
-func FetchFiles() ([]util.FetchResult, error) {
-	reqs := newFetchRequests()
+// ListVersions returns the versions of Oracle Linux, all of which are in the single com.oracle.elsa-all.xml.bz2,
+// so that the index lists no file per version
+func ListVersions() ([]string, error) {
+	return []string{"5", "6", "7", "8", "9"}, nil
+}
+
+// FetchFiles fetch OVAL from Oracle, only of years if any, skipping the files not modified since the previous fetch of versions with validators
+func FetchFiles(ctx context.Context, versions []string, years []int, validators map[string]models.CacheValidator) ([]util.FetchResult, error) {
+	reqs, err := newFetchRequests(ctx, years)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to create fetch requests. err: %w", err)
+	}
+	reqs = util.WithCacheValidators(reqs, validators, versions)
 	if len(reqs) == 0 {
 		return nil, xerrors.New("There are no versions to fetch")
 	}
-	results, err := util.FetchFeedFiles(reqs)
-	if err != nil {
-		return nil, xerrors.Errorf("Failed to fetch. err: %w", err)
-	}
+	results, _ := util.FetchFeedFiles(ctx, reqs)
 	return results, nil
 }
@@ -0,0 +1,119 @@
+package oracle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/vulsio/goval-dictionary/fetcher/fetchertest"
+	"github.com/vulsio/goval-dictionary/fetcher/util"
+)
+
+func TestNewFetchRequests(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		years    []int
+		expected []string
+	}{
+		{
+			expected: []string{"https://linux.oracle.com/security/oval/com.oracle.elsa-all.xml.bz2"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/oracle/oval",
+			expected: []string{"https://mirror.example.com/oracle/oval/com.oracle.elsa-all.xml.bz2"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/oracle/oval/",
+			expected: []string{"https://mirror.example.com/oracle/oval/com.oracle.elsa-all.xml.bz2"},
+		},
+		{
+			years:    []int{2016, 2017},
+			expected: []string{"https://linux.oracle.com/security/oval/com.oracle.elsa-2016.xml.bz2", "https://linux.oracle.com/security/oval/com.oracle.elsa-2017.xml.bz2"},
+		},
+	}
+	for i, tt := range tests {
+		viper.Set("oracle.base-url", tt.baseURL)
+		reqs, err := newFetchRequests(context.Background(), tt.years)
+		viper.Set("oracle.base-url", nil)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		urls := []string{}
+		for _, r := range reqs {
+			urls = append(urls, r.URL)
+		}
+		if !reflect.DeepEqual(urls, tt.expected) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.expected, urls)
+		}
+	}
+}
+
+func TestFetchFiles(t *testing.T) {
+	viper.Set("threads", 1)
+	defer viper.Set("threads", nil)
+
+	files := map[string][]byte{}
+	for _, name := range []string{"com.oracle.elsa-all.xml.bz2", "com.oracle.elsa-2023.xml.bz2"} {
+		bs, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("Failed to read fixture. err: %s", err)
+		}
+		files["https://linux.oracle.com/security/oval/"+name] = bs
+	}
+
+	type result struct {
+		target   string
+		body     string
+		notFound bool
+	}
+	tests := []struct {
+		name         string
+		years        []int
+		wantRequests []string
+		want         []result
+	}{
+		{
+			name: "all",
+			wantRequests: []string{
+				"https://linux.oracle.com/security/oval/com.oracle.elsa-all.xml.bz2",
+				"https://linux.oracle.com/security/oval/com.oracle.elsa-all.xml.bz2.sha256",
+			},
+			want: []result{{body: "<oval_definitions><!-- all --></oval_definitions>"}},
+		},
+		{
+			name:  "years",
+			years: []int{2022, 2023},
+			wantRequests: []string{
+				"https://linux.oracle.com/security/oval/com.oracle.elsa-2022.xml.bz2",
+				"https://linux.oracle.com/security/oval/com.oracle.elsa-2023.xml.bz2",
+				"https://linux.oracle.com/security/oval/com.oracle.elsa-2023.xml.bz2.sha256",
+			},
+			want: []result{{target: "2022", notFound: true}, {target: "2023", body: "<oval_definitions><!-- 2023 --></oval_definitions>"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fetchertest.NewServer(t, files)
+
+			results, err := FetchFiles(context.Background(), []string{"8", "9"}, tt.years, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got := []result{}
+			for _, r := range results {
+				got = append(got, result{target: r.Target, body: string(r.Body), notFound: util.IsNotFound(r.Err)})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, got)
+			}
+			if !reflect.DeepEqual(s.Requests(), tt.wantRequests) {
+				t.Errorf("expected: %q, actual: %q", tt.wantRequests, s.Requests())
+			}
+		})
+	}
+}
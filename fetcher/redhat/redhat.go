@@ -2,55 +2,111 @@ package redhat
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
-	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/inconshreveable/log15"
 	"golang.org/x/exp/slices"
 	"golang.org/x/xerrors"
 
+	"github.com/vulsio/goval-dictionary/config"
 	"github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/log"
 )
 
+const defaultBaseURL = "https://access.redhat.com/security/data/"
+
+func newOVALv2FetchRequests(base string, versions []string) []util.FetchRequest {
+	reqs := make([]util.FetchRequest, 0, len(versions))
+	for _, v := range versions {
+		if v != "5" {
+			// the compressed one is about a fifth of the size, decompressed by the suffix, or the uncompressed one if not available
+			reqs = append(reqs, util.FetchRequest{
+				Target:      v,
+				URL:         fmt.Sprintf("%soval/v2/RHEL%s/rhel-%s.oval.xml.bz2", base, v, v),
+				MIMEType:    util.MIMETypeXML,
+				Checksum:    true,
+				FallbackURL: fmt.Sprintf("%soval/v2/RHEL%s/rhel-%s.oval.xml", base, v, v),
+			})
+		}
+	}
+	return reqs
+}
+
+// DefaultVersions returns the major versions fetched without the version args, the ones of which RedHat provides the OVAL
+func DefaultVersions() []string {
+	return []string{"5", "6", "7", "8", "9"}
+}
+
+var ovalv2DirPattern = regexp.MustCompile(`^RHEL(\d+)$`)
+
+// ListVersions returns the versions listed in the OVALv2 index of the mirror, e.g. RHEL8/ -> 8
+func ListVersions(ctx context.Context) ([]string, error) {
+	base, err := util.BaseURL(ctx, config.RedHat, defaultBaseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
+	vs, err := util.ListIndex(ctx, base+"oval/v2/", ovalv2DirPattern)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to list index. err: %w", err)
+	}
+	return vs, nil
+}
+
 // FetchFiles fetch OVAL from RedHat
-func FetchFiles(versions []string) (map[string][]util.FetchResult, error) {
+func FetchFiles(ctx context.Context, versions []string) (map[string][]util.FetchResult, error) {
+	results := map[string][]util.FetchResult{}
+	if err := StreamFiles(ctx, versions, func(v string, rs []util.FetchResult) { results[v] = rs }); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// StreamFiles fetches OVAL from RedHat as FetchFiles does, but calls fn with the files of each version in order as soon as they are fetched:
+// OVALv1 in the archive of all the versions fetched first, and OVALv2 of the version if any
+func StreamFiles(ctx context.Context, versions []string, fn func(string, []util.FetchResult)) error {
 	results := map[string][]util.FetchResult{}
 	vs := make([]string, 0, len(versions))
 	for _, v := range versions {
 		n, err := strconv.Atoi(v)
 		if err != nil {
-			log15.Warn("Skip unknown redhat.", "version", v)
+			log.FromContext(ctx).Warn("Skip unknown redhat.", "version", v)
 			continue
 		}
 
 		if n < 5 {
-			log15.Warn("Skip redhat because no vulnerability information provided.", "version", v)
+			log.FromContext(ctx).Warn("Skip redhat because no vulnerability information provided.", "version", v)
 			continue
 		}
 
 		vs = append(vs, v)
 	}
 	if len(vs) == 0 {
-		return nil, xerrors.New("There are no versions to fetch")
+		return xerrors.New("There are no versions to fetch")
+	}
+
+	base, err := util.BaseURL(ctx, config.RedHat, defaultBaseURL)
+	if err != nil {
+		return xerrors.Errorf("Failed to get base URL. err: %w", err)
 	}
 
-	log15.Info("Fetching... ", "URL", "https://access.redhat.com/security/data/archive/oval_v1_20230706.tar.gz")
-	resp, err := http.Get("https://access.redhat.com/security/data/archive/oval_v1_20230706.tar.gz")
+	log.FromContext(ctx).Info("Fetching... ", "URL", base+"archive/oval_v1_20230706.tar.gz")
+	bs, err := util.HTTPGet(ctx, base+"archive/oval_v1_20230706.tar.gz")
 	if err != nil {
-		return nil, xerrors.Errorf("Failed to get oval v1. err: %w", err)
+		return xerrors.Errorf("Failed to get oval v1. err: %w", err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, xerrors.Errorf("Failed to get oval v1. err: bad status %d", resp.StatusCode)
+	if err := util.Archive(ctx, base+"archive/oval_v1_20230706.tar.gz", bs); err != nil {
+		return xerrors.Errorf("Failed to archive oval v1. err: %w", err)
 	}
-	defer resp.Body.Close()
 
-	gr, err := gzip.NewReader(resp.Body)
+	gr, err := gzip.NewReader(bytes.NewReader(bs))
 	if err != nil {
-		return nil, xerrors.Errorf("Failed to create gzip reader. err: %w", err)
+		return xerrors.Errorf("Failed to create gzip reader. err: %w", err)
 	}
 	defer gr.Close()
 
@@ -61,45 +117,50 @@ func FetchFiles(versions []string) (map[string][]util.FetchResult, error) {
 			break
 		}
 		if err != nil {
-			return nil, xerrors.Errorf("Failed to next tar reader. err: %w", err)
+			return xerrors.Errorf("Failed to next tar reader. err: %w", err)
 		}
 
 		v := strings.TrimSuffix(strings.TrimPrefix(hdr.Name, "com.redhat.rhsa-RHEL"), ".xml")
 		if slices.Contains(vs, v) {
 			bs, err := io.ReadAll(tr)
 			if err != nil {
-				return nil, xerrors.Errorf("Failed to read all com.redhat.rhsa-RHEL%s.xml. err: %w", v, err)
+				return xerrors.Errorf("Failed to read all com.redhat.rhsa-RHEL%s.xml. err: %w", v, err)
 			}
 			results[v] = append(results[v], util.FetchResult{
 				Target: v,
-				URL:    fmt.Sprintf("https://access.redhat.com/security/data/archive/oval_v1_20230706.tar.gz/com.redhat.rhsa-RHEL%s.xml", v),
+				URL:    fmt.Sprintf("%sarchive/oval_v1_20230706.tar.gz/com.redhat.rhsa-RHEL%s.xml", base, v),
 				Body:   bs,
 			})
 		}
 	}
 
-	reqs := make([]util.FetchRequest, 0, len(vs))
-	for _, v := range vs {
-		if v != "5" {
-			reqs = append(reqs, util.FetchRequest{
-				Target:   v,
-				URL:      fmt.Sprintf("https://access.redhat.com/security/data/oval/v2/RHEL%s/rhel-%s.oval.xml.bz2", v, v),
-				MIMEType: util.MIMETypeBzip2,
-			})
-		}
+	reqs := newOVALv2FetchRequests(base, vs)
+	withV2 := map[string]bool{}
+	for _, req := range reqs {
+		withV2[req.Target] = true
 	}
-	if len(reqs) > 0 {
-		rs, err := util.FetchFeedFiles(reqs)
-		if err != nil {
-			return nil, xerrors.Errorf("Failed to fetch. err: %w", err)
+
+	fetched, next := 0, 0
+	// emit calls fn with the versions up to target, those without OVALv2 before it, e.g. 5, and target with its OVALv2 if not empty
+	emit := func(target string, v2 *util.FetchResult) {
+		for ; next < len(vs) && vs[next] != target; next++ {
+			if rs, ok := results[vs[next]]; ok && !withV2[vs[next]] {
+				fn(vs[next], rs)
+				fetched++
+			}
 		}
-		for _, r := range rs {
-			results[r.Target] = append(results[r.Target], r)
+		if v2 != nil {
+			next++
+			fn(target, append(results[target], *v2))
+			fetched++
 		}
 	}
+	// the files failed to fetch carry the error in their results, OVALv1 alone is incomplete for the versions whose OVALv2 failed
+	_ = util.StreamFeedFiles(ctx, reqs, func(r util.FetchResult) { emit(r.Target, &r) })
+	emit("", nil)
 
-	if len(results) == 0 {
-		return nil, xerrors.New("There are no versions to fetch")
+	if fetched == 0 {
+		return xerrors.New("There are no versions to fetch")
 	}
-	return results, nil
+	return nil
 }
@@ -0,0 +1,255 @@
+package redhat
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/fetcher/fetchertest"
+	"github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models/redhat"
+)
+
+func TestNewOVALv2FetchRequests(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		expected []string
+	}{
+		{
+			expected: []string{"https://access.redhat.com/security/data/oval/v2/RHEL8/rhel-8.oval.xml.bz2", "https://access.redhat.com/security/data/oval/v2/RHEL9/rhel-9.oval.xml.bz2"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/redhat/security/data",
+			expected: []string{"https://mirror.example.com/redhat/security/data/oval/v2/RHEL8/rhel-8.oval.xml.bz2", "https://mirror.example.com/redhat/security/data/oval/v2/RHEL9/rhel-9.oval.xml.bz2"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/redhat/security/data/",
+			expected: []string{"https://mirror.example.com/redhat/security/data/oval/v2/RHEL8/rhel-8.oval.xml.bz2", "https://mirror.example.com/redhat/security/data/oval/v2/RHEL9/rhel-9.oval.xml.bz2"},
+		},
+	}
+	for i, tt := range tests {
+		viper.Set("redhat.base-url", tt.baseURL)
+		base, err := util.BaseURL(context.Background(), config.RedHat, defaultBaseURL)
+		viper.Set("redhat.base-url", nil)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		urls := []string{}
+		for _, r := range newOVALv2FetchRequests(base, []string{"5", "8", "9"}) {
+			urls = append(urls, r.URL)
+		}
+		if !reflect.DeepEqual(urls, tt.expected) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.expected, urls)
+		}
+	}
+}
+
+func TestListVersions(t *testing.T) {
+	index, err := os.ReadFile(filepath.Join("testdata", "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture. err: %s", err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/security/data/oval/v2/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(index)
+	}))
+	defer ts.Close()
+
+	viper.Set("redhat.base-url", ts.URL+"/security/data/")
+	defer viper.Set("redhat.base-url", nil)
+
+	vs, err := ListVersions(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{"6", "7", "8", "9", "10"}; !reflect.DeepEqual(vs, expected) {
+		t.Errorf("expected: %v, actual: %v", expected, vs)
+	}
+}
+
+func TestFetchOVALv2(t *testing.T) {
+	bz2, err := os.ReadFile(filepath.Join("testdata", "rhel-8.oval.xml.bz2"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture. err: %s", err)
+	}
+	plain, err := io.ReadAll(bzip2.NewReader(bytes.NewReader(bz2)))
+	if err != nil {
+		t.Fatalf("Failed to decompress fixture. err: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string][]byte
+		wantURL string
+	}{
+		{
+			name: "bzip2",
+			files: map[string][]byte{
+				"/oval/v2/RHEL8/rhel-8.oval.xml.bz2": bz2,
+				"/oval/v2/RHEL8/rhel-8.oval.xml":     plain,
+			},
+			wantURL: "/oval/v2/RHEL8/rhel-8.oval.xml.bz2",
+		},
+		{
+			name: "fallback on not found",
+			files: map[string][]byte{
+				"/oval/v2/RHEL8/rhel-8.oval.xml": plain,
+			},
+			wantURL: "/oval/v2/RHEL8/rhel-8.oval.xml",
+		},
+		{
+			name: "fallback on decompression error",
+			files: map[string][]byte{
+				"/oval/v2/RHEL8/rhel-8.oval.xml.bz2": bz2[:len(bz2)/2],
+				"/oval/v2/RHEL8/rhel-8.oval.xml":     plain,
+			},
+			wantURL: "/oval/v2/RHEL8/rhel-8.oval.xml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				bs, ok := tt.files[r.URL.Path]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write(bs)
+			}))
+			defer ts.Close()
+
+			results, err := util.FetchFeedFiles(context.Background(), newOVALv2FetchRequests(ts.URL+"/", []string{"8"}))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if results[0].URL != ts.URL+tt.wantURL {
+				t.Errorf("expected: %s, actual: %s", ts.URL+tt.wantURL, results[0].URL)
+			}
+			_, defs, _, err := redhat.Decode("8", bytes.NewReader(results[0].Body))
+			if err != nil {
+				t.Fatalf("Failed to decode. err: %s", err)
+			}
+			if len(defs) != 1 || defs[0].DefinitionID != "oval:com.redhat.rhsa:def:20230001" {
+				t.Errorf("expected: the definition of the fixture, actual: %+v", defs)
+			}
+		})
+	}
+}
+
+func TestFetchFiles(t *testing.T) {
+	viper.Set("threads", 1)
+	defer viper.Set("threads", nil)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, v := range []string{"7", "8"} {
+		body := []byte(fmt.Sprintf("<oval_definitions><!-- RHEL%s --></oval_definitions>", v))
+		if err := tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("com.redhat.rhsa-RHEL%s.xml", v), Mode: 0644, Size: int64(len(body))}); err != nil {
+			t.Fatalf("Failed to write fixture. err: %s", err)
+		}
+		if _, err := tw.Write(body); err != nil {
+			t.Fatalf("Failed to write fixture. err: %s", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	bz2, err := os.ReadFile(filepath.Join("testdata", "rhel-8.oval.xml.bz2"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture. err: %s", err)
+	}
+	plain, err := io.ReadAll(bzip2.NewReader(bytes.NewReader(bz2)))
+	if err != nil {
+		t.Fatalf("Failed to decompress fixture. err: %s", err)
+	}
+	files := map[string][]byte{
+		"https://access.redhat.com/security/data/archive/oval_v1_20230706.tar.gz":   buf.Bytes(),
+		"https://access.redhat.com/security/data/oval/v2/RHEL8/rhel-8.oval.xml.bz2": bz2,
+	}
+
+	type result struct {
+		url      string
+		body     string
+		notFound bool
+	}
+	tests := []struct {
+		name         string
+		versions     []string
+		wantRequests []string
+		want         map[string][]result
+	}{
+		{
+			name:     "OVALv1 and OVALv2",
+			versions: []string{"8"},
+			wantRequests: []string{
+				"https://access.redhat.com/security/data/archive/oval_v1_20230706.tar.gz",
+				"https://access.redhat.com/security/data/oval/v2/RHEL8/rhel-8.oval.xml.bz2",
+				"https://access.redhat.com/security/data/oval/v2/RHEL8/rhel-8.oval.xml.bz2.sha256",
+			},
+			want: map[string][]result{
+				"8": {
+					{url: "https://access.redhat.com/security/data/archive/oval_v1_20230706.tar.gz/com.redhat.rhsa-RHEL8.xml", body: "<oval_definitions><!-- RHEL8 --></oval_definitions>"},
+					{url: "https://access.redhat.com/security/data/oval/v2/RHEL8/rhel-8.oval.xml.bz2", body: string(plain)},
+				},
+			},
+		},
+		{
+			name:     "OVALv2 not found",
+			versions: []string{"4", "7"},
+			wantRequests: []string{
+				"https://access.redhat.com/security/data/archive/oval_v1_20230706.tar.gz",
+				"https://access.redhat.com/security/data/oval/v2/RHEL7/rhel-7.oval.xml.bz2",
+				"https://access.redhat.com/security/data/oval/v2/RHEL7/rhel-7.oval.xml",
+			},
+			want: map[string][]result{
+				"7": {
+					{url: "https://access.redhat.com/security/data/archive/oval_v1_20230706.tar.gz/com.redhat.rhsa-RHEL7.xml", body: "<oval_definitions><!-- RHEL7 --></oval_definitions>"},
+					{url: "https://access.redhat.com/security/data/oval/v2/RHEL7/rhel-7.oval.xml.bz2", notFound: true},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fetchertest.NewServer(t, files)
+
+			results, err := FetchFiles(context.Background(), tt.versions)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got := map[string][]result{}
+			for v, rs := range results {
+				for _, r := range rs {
+					got[v] = append(got[v], result{url: r.URL, body: string(r.Body), notFound: util.IsNotFound(r.Err)})
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, got)
+			}
+			if !reflect.DeepEqual(s.Requests(), tt.wantRequests) {
+				t.Errorf("expected: %q, actual: %q", tt.wantRequests, s.Requests())
+			}
+		})
+	}
+}
@@ -1,39 +1,127 @@
 package suse
 
 import (
+	"context"
 	"fmt"
+	"regexp"
+	"strings"
 
 	"golang.org/x/xerrors"
 
+	"github.com/vulsio/goval-dictionary/config"
 	"github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/log"
+	"github.com/vulsio/goval-dictionary/models"
 )
 
+const defaultBaseURL = "https://ftp.suse.com/pub/projects/security/oval/"
+
 // https://ftp.suse.com/pub/projects/security/oval/opensuse.leap.42.2.xml
 // https://ftp.suse.com/pub/projects/security/oval/opensuse.13.2.xml
 // https://ftp.suse.com/pub/projects/security/oval/suse.linux.enterprise.desktop.12.xml"
 // https://ftp.suse.com/pub/projects/security/oval/suse.linux.enterprise.server.12.xml
-func newFetchRequests(suseType string, target []string) (reqs []util.FetchRequest) {
-	const t = "https://ftp.suse.com/pub/projects/security/oval/%s.%s.xml"
+// fetch the gzip'd one (.xml.gz) preferably, which is much smaller
+func newFetchRequests(ctx context.Context, suseType string, target []string) (reqs []util.FetchRequest, err error) {
+	base, err := util.BaseURL(ctx, "suse", defaultBaseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
 	for _, v := range target {
 		reqs = append(reqs, util.FetchRequest{
 			Target:       v,
-			URL:          fmt.Sprintf(t, suseType, v),
+			URL:          fmt.Sprintf("%s%s.%s.xml.gz", base, suseType, v),
 			Concurrently: true,
 			MIMEType:     util.MIMETypeXML,
+			Checksum:     true,
+			FallbackURL:  fmt.Sprintf("%s%s.%s.xml", base, suseType, v),
 		})
 	}
 	return
 }
 
-// FetchFiles fetch OVAL from SUSE
-func FetchFiles(suseType string, versions []string) ([]util.FetchResult, error) {
-	reqs := newFetchRequests(suseType, versions)
-	if len(reqs) == 0 {
-		return nil, xerrors.New("There are no versions to fetch")
+// ListVersions returns the versions of suseType listed in the index of the mirror, e.g. opensuse.leap.15.4.xml.gz -> 15.4
+func ListVersions(ctx context.Context, suseType string) ([]string, error) {
+	base, err := util.BaseURL(ctx, "suse", defaultBaseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
 	}
-	results, err := util.FetchFeedFiles(reqs)
+	// the version is a number or tumbleweed, so that opensuse does not match opensuse.leap.*
+	pattern := regexp.MustCompile(fmt.Sprintf(`^%s\.(\d+(?:\.\d+)*|tumbleweed)\.xml(?:\.gz)?$`, regexp.QuoteMeta(suseType)))
+	vs, err := util.ListIndex(ctx, base, pattern)
 	if err != nil {
-		return nil, xerrors.Errorf("Failed to fetch. err: %w", err)
+		return nil, xerrors.Errorf("Failed to list index. err: %w", err)
+	}
+	return vs, nil
+}
+
+// FetchFiles fetch OVAL from SUSE, skipping the files not modified since the previous fetch with validators
+func FetchFiles(ctx context.Context, suseType string, versions []string, validators map[string]models.CacheValidator) ([]util.FetchResult, error) {
+	results := []util.FetchResult{}
+	if err := StreamFiles(ctx, suseType, versions, validators, func(r util.FetchResult) { results = append(results, r) }); err != nil {
+		return nil, err
 	}
 	return results, nil
 }
+
+// StreamFiles fetches OVAL from SUSE as FetchFiles does, but calls fn with the file of each version in order as soon as it is fetched
+func StreamFiles(ctx context.Context, suseType string, versions []string, validators map[string]models.CacheValidator, fn func(util.FetchResult)) error {
+	reqs, err := newFetchRequests(ctx, suseType, versions)
+	if err != nil {
+		return xerrors.Errorf("Failed to create fetch requests. err: %w", err)
+	}
+	reqs = util.WithCacheValidators(reqs, validators, versions)
+	if len(reqs) == 0 {
+		return xerrors.New("There are no versions to fetch")
+	}
+	// the index is listed once for all the versions not found, e.g. typos
+	var (
+		available []string
+		listed    bool
+	)
+	_ = util.StreamFeedFiles(ctx, reqs, func(r util.FetchResult) {
+		if r.Err != nil && util.IsNotFound(r.Err) {
+			if !listed {
+				if available, err = ListVersions(ctx, suseType); err != nil {
+					log.FromContext(ctx).Debug("Failed to list the available versions", "err", err)
+				}
+				listed = true
+			}
+			if len(available) > 0 {
+				r.Err = xerrors.Errorf("No OVAL for %s %s, available: %s. err: %w", suseName(suseType), r.Target, strings.Join(nearestVersions(r.Target, available), ", "), r.Err)
+			}
+		}
+		fn(r)
+	})
+	return nil
+}
+
+// suseName returns the product name of suseType for the messages
+func suseName(suseType string) string {
+	switch suseType {
+	case config.OpenSUSE:
+		return "openSUSE"
+	case config.OpenSUSELeap:
+		return "openSUSE Leap"
+	case config.SUSEEnterpriseServer:
+		return "SUSE Linux Enterprise Server"
+	case config.SUSEEnterpriseDesktop:
+		return "SUSE Linux Enterprise Desktop"
+	default:
+		return suseType
+	}
+}
+
+// nearestVersions returns the available versions of the same major version as v, or all of them if none
+func nearestVersions(v string, available []string) []string {
+	major, _, _ := strings.Cut(v, ".")
+	vs := []string{}
+	for _, a := range available {
+		if m, _, _ := strings.Cut(a, "."); m == major {
+			vs = append(vs, a)
+		}
+	}
+	if len(vs) == 0 {
+		return available
+	}
+	return vs
+}
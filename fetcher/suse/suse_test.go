@@ -0,0 +1,232 @@
+package suse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/fetcher/fetchertest"
+	"github.com/vulsio/goval-dictionary/fetcher/util"
+)
+
+func TestNewFetchRequests(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		suseType string
+		versions []string
+		expected []string
+	}{
+		{
+			expected: []string{"https://ftp.suse.com/pub/projects/security/oval/suse.linux.enterprise.server.12.xml.gz", "https://ftp.suse.com/pub/projects/security/oval/suse.linux.enterprise.server.15.xml.gz"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/suse/oval",
+			expected: []string{"https://mirror.example.com/suse/oval/suse.linux.enterprise.server.12.xml.gz", "https://mirror.example.com/suse/oval/suse.linux.enterprise.server.15.xml.gz"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/suse/oval/",
+			expected: []string{"https://mirror.example.com/suse/oval/suse.linux.enterprise.server.12.xml.gz", "https://mirror.example.com/suse/oval/suse.linux.enterprise.server.15.xml.gz"},
+		},
+		// openSUSE Tumbleweed of no version number
+		{
+			suseType: config.OpenSUSE,
+			versions: []string{config.OpenSUSETumbleweed},
+			expected: []string{"https://ftp.suse.com/pub/projects/security/oval/opensuse.tumbleweed.xml.gz"},
+		},
+	}
+	for i, tt := range tests {
+		if tt.suseType == "" {
+			tt.suseType, tt.versions = config.SUSEEnterpriseServer, []string{"12", "15"}
+		}
+		viper.Set("suse.base-url", tt.baseURL)
+		reqs, err := newFetchRequests(context.Background(), tt.suseType, tt.versions)
+		viper.Set("suse.base-url", nil)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		urls := []string{}
+		for _, r := range reqs {
+			urls = append(urls, r.URL)
+			if r.FallbackURL != strings.TrimSuffix(r.URL, ".gz") {
+				t.Errorf("[%d] expected fallback: %s, actual: %s", i, strings.TrimSuffix(r.URL, ".gz"), r.FallbackURL)
+			}
+		}
+		if !reflect.DeepEqual(urls, tt.expected) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.expected, urls)
+		}
+	}
+}
+
+func TestListVersions(t *testing.T) {
+	index, err := os.ReadFile(filepath.Join("testdata", "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture. err: %s", err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(index)
+	}))
+	defer ts.Close()
+
+	viper.Set("suse.base-url", ts.URL)
+	defer viper.Set("suse.base-url", nil)
+
+	tests := []struct {
+		suseType string
+		expected []string
+	}{
+		{
+			suseType: "opensuse",
+			expected: []string{"13.2", "tumbleweed"},
+		},
+		{
+			suseType: "opensuse.leap",
+			expected: []string{"15.4", "15.5", "42.3"},
+		},
+		{
+			suseType: "suse.linux.enterprise.server",
+			expected: []string{"12", "15"},
+		},
+		{
+			suseType: "suse.linux.enterprise.desktop",
+			expected: []string{},
+		},
+	}
+	for i, tt := range tests {
+		vs, err := ListVersions(context.Background(), tt.suseType)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		if len(vs) != len(tt.expected) || (len(vs) > 0 && !reflect.DeepEqual(vs, tt.expected)) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.expected, vs)
+		}
+	}
+}
+
+func TestFetchFilesNotFound(t *testing.T) {
+	var listed int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			atomic.AddInt32(&listed, 1)
+			_, _ = w.Write([]byte(`<a href="opensuse.leap.15.5.xml.gz">opensuse.leap.15.5.xml.gz</a>
+<a href="opensuse.leap.42.1.xml">opensuse.leap.42.1.xml</a>
+<a href="opensuse.leap.42.2.xml">opensuse.leap.42.2.xml</a>
+<a href="opensuse.leap.42.3.xml">opensuse.leap.42.3.xml</a>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	viper.Set("suse.base-url", ts.URL)
+	defer viper.Set("suse.base-url", nil)
+
+	results, err := FetchFiles(context.Background(), "opensuse.leap", []string{"42.30", "16.0"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i, expected := range []string{
+		"No OVAL for openSUSE Leap 42.30, available: 42.1, 42.2, 42.3.",
+		"No OVAL for openSUSE Leap 16.0, available: 15.5, 42.1, 42.2, 42.3.",
+	} {
+		if results[i].Err == nil || !strings.HasPrefix(results[i].Err.Error(), expected) {
+			t.Errorf("[%d] expected: %q, actual: %v", i, expected, results[i].Err)
+		}
+	}
+	if listed != 1 {
+		t.Errorf("expected: the index listed once, actual: %d times", listed)
+	}
+}
+
+func TestFetchFiles(t *testing.T) {
+	viper.Set("threads", 1)
+	defer viper.Set("threads", nil)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte("<oval_definitions><!-- 15.5 --></oval_definitions>")); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write fixture. err: %s", err)
+	}
+	files := map[string][]byte{
+		"https://ftp.suse.com/pub/projects/security/oval/opensuse.leap.15.5.xml.gz": buf.Bytes(),
+		"https://ftp.suse.com/pub/projects/security/oval/opensuse.leap.42.3.xml":    []byte("<oval_definitions><!-- 42.3 --></oval_definitions>"),
+	}
+
+	type result struct {
+		target   string
+		body     string
+		notFound bool
+	}
+	tests := []struct {
+		name         string
+		versions     []string
+		wantRequests []string
+		want         []result
+	}{
+		{
+			name:     "gzip",
+			versions: []string{"15.5"},
+			wantRequests: []string{
+				"https://ftp.suse.com/pub/projects/security/oval/opensuse.leap.15.5.xml.gz",
+				"https://ftp.suse.com/pub/projects/security/oval/opensuse.leap.15.5.xml.gz.sha256",
+			},
+			want: []result{{target: "15.5", body: "<oval_definitions><!-- 15.5 --></oval_definitions>"}},
+		},
+		{
+			name:     "fallback to the uncompressed one",
+			versions: []string{"42.3"},
+			wantRequests: []string{
+				"https://ftp.suse.com/pub/projects/security/oval/opensuse.leap.42.3.xml.gz",
+				"https://ftp.suse.com/pub/projects/security/oval/opensuse.leap.42.3.xml",
+				"https://ftp.suse.com/pub/projects/security/oval/opensuse.leap.42.3.xml.sha256",
+			},
+			want: []result{{target: "42.3", body: "<oval_definitions><!-- 42.3 --></oval_definitions>"}},
+		},
+		{
+			name:     "not found",
+			versions: []string{"42.30"},
+			wantRequests: []string{
+				"https://ftp.suse.com/pub/projects/security/oval/opensuse.leap.42.30.xml.gz",
+				"https://ftp.suse.com/pub/projects/security/oval/opensuse.leap.42.30.xml",
+				"https://ftp.suse.com/pub/projects/security/oval/",
+			},
+			want: []result{{target: "42.30", notFound: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fetchertest.NewServer(t, files)
+
+			results, err := FetchFiles(context.Background(), "opensuse.leap", tt.versions, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got := []result{}
+			for _, r := range results {
+				got = append(got, result{target: r.Target, body: string(r.Body), notFound: util.IsNotFound(r.Err)})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, got)
+			}
+			if !reflect.DeepEqual(s.Requests(), tt.wantRequests) {
+				t.Errorf("expected: %q, actual: %q", tt.wantRequests, s.Requests())
+			}
+		})
+	}
+}
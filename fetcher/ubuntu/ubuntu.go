@@ -1,50 +1,59 @@
 package ubuntu
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
-	"github.com/inconshreveable/log15"
 	"golang.org/x/xerrors"
 
 	"github.com/vulsio/goval-dictionary/config"
 	"github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/log"
+	"github.com/vulsio/goval-dictionary/models"
 )
 
-func newFetchRequests(target []string) (reqs []util.FetchRequest) {
+const defaultBaseURL = "https://security-metadata.canonical.com/oval/"
+
+func newFetchRequests(ctx context.Context, target []string) (reqs []util.FetchRequest, err error) {
+	base, err := util.BaseURL(ctx, config.Ubuntu, defaultBaseURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get base URL. err: %w", err)
+	}
 	for _, v := range target {
-		switch url := getOVALURL(v); url {
+		switch url := getOVALURL(base, v); url {
 		case "unknown":
-			log15.Warn("Skip unknown ubuntu.", "version", v)
+			log.FromContext(ctx).Warn("Skip unknown ubuntu.", "version", v)
 		case "unsupported":
-			log15.Warn("Skip unsupported ubuntu version.", "version", v)
-			log15.Warn("See https://wiki.ubuntu.com/Releases for supported versions")
+			log.FromContext(ctx).Warn("Skip unsupported ubuntu version.", "version", v)
+			log.FromContext(ctx).Warn("See https://wiki.ubuntu.com/Releases for supported versions")
 		default:
 			reqs = append(reqs, util.FetchRequest{
 				Target:       v,
 				URL:          url,
 				Concurrently: true,
 				MIMEType:     util.MIMETypeBzip2,
+				Checksum:     true,
 			})
 		}
 	}
 	return
 }
 
-func getOVALURL(version string) string {
+func getOVALURL(base, version string) string {
 	major, minor, ok := strings.Cut(version, ".")
 	if !ok {
 		return "unknown"
 	}
 
-	const main = "https://security-metadata.canonical.com/oval/oci.com.ubuntu.%s.cve.oval.xml.bz2"
+	const main = "%soci.com.ubuntu.%s.cve.oval.xml.bz2"
 	switch major {
 	case "4", "5", "6", "7", "8", "9", "10", "11", "12":
 		return "unsupported"
 	case "14":
 		switch minor {
 		case "04":
-			return fmt.Sprintf(main, config.Ubuntu1404)
+			return fmt.Sprintf(main, base, config.Ubuntu1404)
 		case "10":
 			return "unsupported"
 		default:
@@ -53,7 +62,7 @@ func getOVALURL(version string) string {
 	case "16":
 		switch minor {
 		case "04":
-			return fmt.Sprintf(main, config.Ubuntu1604)
+			return fmt.Sprintf(main, base, config.Ubuntu1604)
 		case "10":
 			return "unsupported"
 		default:
@@ -64,7 +73,7 @@ func getOVALURL(version string) string {
 	case "18":
 		switch minor {
 		case "04":
-			return fmt.Sprintf(main, config.Ubuntu1804)
+			return fmt.Sprintf(main, base, config.Ubuntu1804)
 		case "10":
 			return "unsupported"
 		default:
@@ -75,7 +84,7 @@ func getOVALURL(version string) string {
 	case "20":
 		switch minor {
 		case "04":
-			return fmt.Sprintf(main, config.Ubuntu2004)
+			return fmt.Sprintf(main, base, config.Ubuntu2004)
 		case "10":
 			return "unsupported"
 		default:
@@ -84,25 +93,25 @@ func getOVALURL(version string) string {
 	case "21":
 		switch minor {
 		case "04":
-			return fmt.Sprintf(main, config.Ubuntu2104)
+			return fmt.Sprintf(main, base, config.Ubuntu2104)
 		case "10":
-			return fmt.Sprintf(main, config.Ubuntu2110)
+			return fmt.Sprintf(main, base, config.Ubuntu2110)
 		default:
 			return "unknown"
 		}
 	case "22":
 		switch minor {
 		case "04":
-			return fmt.Sprintf(main, config.Ubuntu2204)
+			return fmt.Sprintf(main, base, config.Ubuntu2204)
 		case "10":
-			return fmt.Sprintf(main, config.Ubuntu2210)
+			return fmt.Sprintf(main, base, config.Ubuntu2210)
 		default:
 			return "unknown"
 		}
 	case "23":
 		switch minor {
 		case "04":
-			return fmt.Sprintf(main, config.Ubuntu2304)
+			return fmt.Sprintf(main, base, config.Ubuntu2304)
 		case "10":
 			return "unsupported"
 		default:
@@ -113,15 +122,39 @@ func getOVALURL(version string) string {
 	}
 }
 
-// FetchFiles fetch OVAL from Ubuntu
-func FetchFiles(versions []string) ([]util.FetchResult, error) {
-	reqs := newFetchRequests(versions)
-	if len(reqs) == 0 {
-		return nil, xerrors.New("There are no versions to fetch")
+// ListVersions returns the versions supported by the fetcher, the mirror has the fixed set of releases
+func ListVersions() ([]string, error) {
+	vs := []string{}
+	for _, major := range []string{"14", "16", "18", "20", "21", "22", "23"} {
+		for _, minor := range []string{"04", "10"} {
+			v := fmt.Sprintf("%s.%s", major, minor)
+			if u := getOVALURL(defaultBaseURL, v); u != "unknown" && u != "unsupported" {
+				vs = append(vs, v)
+			}
+		}
 	}
-	results, err := util.FetchFeedFiles(reqs)
-	if err != nil {
-		return nil, xerrors.Errorf("Failed to fetch. err: %w", err)
+	return vs, nil
+}
+
+// FetchFiles fetch OVAL from Ubuntu, skipping the files not modified since the previous fetch with validators
+func FetchFiles(ctx context.Context, versions []string, validators map[string]models.CacheValidator) ([]util.FetchResult, error) {
+	results := []util.FetchResult{}
+	if err := StreamFiles(ctx, versions, validators, func(r util.FetchResult) { results = append(results, r) }); err != nil {
+		return nil, err
 	}
 	return results, nil
 }
+
+// StreamFiles fetches OVAL from Ubuntu as FetchFiles does, but calls fn with the file of each version in order as soon as it is fetched
+func StreamFiles(ctx context.Context, versions []string, validators map[string]models.CacheValidator, fn func(util.FetchResult)) error {
+	reqs, err := newFetchRequests(ctx, versions)
+	if err != nil {
+		return xerrors.Errorf("Failed to create fetch requests. err: %w", err)
+	}
+	reqs = util.WithCacheValidators(reqs, validators, versions)
+	if len(reqs) == 0 {
+		return xerrors.New("There are no versions to fetch")
+	}
+	_ = util.StreamFeedFiles(ctx, reqs, fn)
+	return nil
+}
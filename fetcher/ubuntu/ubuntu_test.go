@@ -0,0 +1,118 @@
+package ubuntu
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/vulsio/goval-dictionary/fetcher/fetchertest"
+	"github.com/vulsio/goval-dictionary/fetcher/util"
+)
+
+func TestNewFetchRequests(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		expected []string
+	}{
+		{
+			expected: []string{"https://security-metadata.canonical.com/oval/oci.com.ubuntu.focal.cve.oval.xml.bz2", "https://security-metadata.canonical.com/oval/oci.com.ubuntu.jammy.cve.oval.xml.bz2"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/ubuntu/oval",
+			expected: []string{"https://mirror.example.com/ubuntu/oval/oci.com.ubuntu.focal.cve.oval.xml.bz2", "https://mirror.example.com/ubuntu/oval/oci.com.ubuntu.jammy.cve.oval.xml.bz2"},
+		},
+		{
+			baseURL:  "https://mirror.example.com/ubuntu/oval/",
+			expected: []string{"https://mirror.example.com/ubuntu/oval/oci.com.ubuntu.focal.cve.oval.xml.bz2", "https://mirror.example.com/ubuntu/oval/oci.com.ubuntu.jammy.cve.oval.xml.bz2"},
+		},
+	}
+	for i, tt := range tests {
+		viper.Set("ubuntu.base-url", tt.baseURL)
+		reqs, err := newFetchRequests(context.Background(), []string{"20.04", "22.04"})
+		viper.Set("ubuntu.base-url", nil)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		urls := []string{}
+		for _, r := range reqs {
+			urls = append(urls, r.URL)
+		}
+		if !reflect.DeepEqual(urls, tt.expected) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.expected, urls)
+		}
+	}
+}
+
+func TestFetchFiles(t *testing.T) {
+	viper.Set("threads", 1)
+	defer viper.Set("threads", nil)
+
+	jammy, err := os.ReadFile(filepath.Join("testdata", "oci.com.ubuntu.jammy.cve.oval.xml.bz2"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture. err: %s", err)
+	}
+
+	type result struct {
+		target   string
+		body     string
+		notFound bool
+	}
+	tests := []struct {
+		name         string
+		versions     []string
+		wantErr      bool
+		wantRequests []string
+		want         []result
+	}{
+		{
+			name:     "fetched",
+			versions: []string{"22.04"},
+			wantRequests: []string{
+				"https://security-metadata.canonical.com/oval/oci.com.ubuntu.jammy.cve.oval.xml.bz2",
+				"https://security-metadata.canonical.com/oval/oci.com.ubuntu.jammy.cve.oval.xml.bz2.sha256",
+			},
+			want: []result{{target: "22.04", body: "<oval_definitions><!-- jammy --></oval_definitions>"}},
+		},
+		{
+			name:     "not found",
+			versions: []string{"20.04", "22.04"},
+			wantRequests: []string{
+				"https://security-metadata.canonical.com/oval/oci.com.ubuntu.focal.cve.oval.xml.bz2",
+				"https://security-metadata.canonical.com/oval/oci.com.ubuntu.jammy.cve.oval.xml.bz2",
+				"https://security-metadata.canonical.com/oval/oci.com.ubuntu.jammy.cve.oval.xml.bz2.sha256",
+			},
+			want: []result{{target: "20.04", notFound: true}, {target: "22.04", body: "<oval_definitions><!-- jammy --></oval_definitions>"}},
+		},
+		{
+			name:         "unsupported version",
+			versions:     []string{"12.04"},
+			wantErr:      true,
+			wantRequests: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fetchertest.NewServer(t, map[string][]byte{"https://security-metadata.canonical.com/oval/oci.com.ubuntu.jammy.cve.oval.xml.bz2": jammy})
+
+			results, err := FetchFiles(context.Background(), tt.versions, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %t, actual: %v", tt.wantErr, err)
+			}
+			got := []result{}
+			for _, r := range results {
+				got = append(got, result{target: r.Target, body: string(r.Body), notFound: util.IsNotFound(r.Err)})
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, got)
+			}
+			if !reflect.DeepEqual(s.Requests(), tt.wantRequests) {
+				t.Errorf("expected: %q, actual: %q", tt.wantRequests, s.Requests())
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+)
+
+// archiveIndexName is the name of the index of the files in "download-dir"
+const archiveIndexName = "index.json"
+
+// ArchiveEntry is the record of a file written to "download-dir" in its index.json
+type ArchiveEntry struct {
+	File      string    `json:"file"`
+	URL       string    `json:"url"`
+	SHA256    string    `json:"sha256"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// archiveMu serializes the updates of index.json by the concurrent downloads
+var archiveMu sync.Mutex
+
+// archiveNow returns the fetch timestamp recorded in the index, replaced in the tests
+var archiveNow = time.Now
+
+// Archive writes body fetched from rawURL as is to "download-dir" of ctx, as the file of the same name, and records it in index.json.
+// It does nothing without "download-dir".
+func Archive(ctx context.Context, rawURL string, body []byte) error {
+	return archive(ctx, rawURL, fileName(rawURL), body)
+}
+
+// archiveDecompressed writes body fetched and decompressed from rawURL to "download-dir", as the file of the same name without the suffix of the compression,
+// e.g. rhel-8.oval.xml of rhel-8.oval.xml.bz2, so that --local-dir reads it again. It does nothing without "download-dir".
+func archiveDecompressed(ctx context.Context, rawURL string, body []byte) error {
+	return archive(ctx, rawURL, trimCompressionExt(fileName(rawURL)), body)
+}
+
+func archive(ctx context.Context, rawURL, name string, body []byte) error {
+	dir := config.FromContext(ctx).DownloadDir
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return xerrors.Errorf("Failed to create download dir. dir: %s, err: %w", dir, err)
+	}
+
+	fetchedAt := archiveNow().UTC().Truncate(time.Second)
+	p := filepath.Join(dir, name)
+	if err := writeFileAtomic(p, body); err != nil {
+		return xerrors.Errorf("Failed to write downloaded file. path: %s, err: %w", p, err)
+	}
+	// the modification time of the file is the fetch timestamp, which --local-dir reads as the last modified one
+	if err := os.Chtimes(p, fetchedAt, fetchedAt); err != nil {
+		return xerrors.Errorf("Failed to set fetch timestamp. path: %s, err: %w", p, err)
+	}
+
+	sum := sha256.Sum256(body)
+	return updateArchiveIndex(dir, ArchiveEntry{File: name, URL: rawURL, SHA256: hex.EncodeToString(sum[:]), FetchedAt: fetchedAt})
+}
+
+// updateArchiveIndex replaces the entry of the same file in index.json of dir with e, keeping the entries sorted by the file
+func updateArchiveIndex(dir string, e ArchiveEntry) error {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+
+	entries, err := ReadArchiveIndex(dir)
+	if err != nil {
+		return err
+	}
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].File >= e.File })
+	if i < len(entries) && entries[i].File == e.File {
+		entries[i] = e
+	} else {
+		entries = append(entries[:i], append([]ArchiveEntry{e}, entries[i:]...)...)
+	}
+
+	bs, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal download index. err: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, archiveIndexName), append(bs, '\n')); err != nil {
+		return xerrors.Errorf("Failed to write download index. dir: %s, err: %w", dir, err)
+	}
+	return nil
+}
+
+// ReadArchiveIndex reads the entries of index.json in dir sorted by the file, none if it does not exist yet
+func ReadArchiveIndex(dir string) ([]ArchiveEntry, error) {
+	bs, err := os.ReadFile(filepath.Join(dir, archiveIndexName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ArchiveEntry{}, nil
+		}
+		return nil, xerrors.Errorf("Failed to read download index. dir: %s, err: %w", dir, err)
+	}
+	entries := []ArchiveEntry{}
+	if err := json.Unmarshal(bs, &entries); err != nil {
+		return nil, xerrors.Errorf("Failed to unmarshal download index. dir: %s, err: %w", dir, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].File < entries[j].File })
+	return entries, nil
+}
+
+// fileName returns the name of the file of rawURL, e.g. rhel-8.oval.xml.bz2
+func fileName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(rawURL)
+}
+
+// SourceFileName returns the name of the file fetched from rawURL stored by --store-source, the one written to "download-dir" decompressed,
+// e.g. rhel-8.oval.xml of rhel-8.oval.xml.bz2
+func SourceFileName(rawURL string) string {
+	return trimCompressionExt(fileName(rawURL))
+}
+
+// trimCompressionExt returns name without the suffix of the compression decompressed by the fetch, if any
+func trimCompressionExt(name string) string {
+	switch ext := path.Ext(name); ext {
+	case ".bz2", ".xz", ".gz":
+		return name[:len(name)-len(ext)]
+	}
+	return name
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestFetchFeedFilesArchive(t *testing.T) {
+	const body = "<oval_definitions/>"
+	bz2, err := os.ReadFile(filepath.Join("testdata", "oval.xml.bz2"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture. err: %s", err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oval.xml.bz2":
+			_, _ = w.Write(bz2)
+		case "/other.xml":
+			_, _ = w.Write([]byte("<oval_definitions>other</oval_definitions>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	viper.Set("download-dir", dir)
+	defer viper.Set("download-dir", nil)
+	fetchedAt := time.Date(2023, time.July, 6, 4, 0, 10, 0, time.UTC)
+	archiveNow = func() time.Time { return fetchedAt }
+	defer func() { archiveNow = time.Now }()
+
+	reqs := []FetchRequest{
+		{URL: ts.URL + "/oval.xml.bz2", MIMEType: MIMETypeXML},
+		{URL: ts.URL + "/other.xml", MIMEType: MIMETypeXML},
+	}
+	// fetched twice, the second of which replaces the files and their entries
+	for i := 0; i < 2; i++ {
+		if _, err := FetchFeedFiles(context.Background(), reqs); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// decompressed, with the name without the suffix of the compression
+	for name, want := range map[string]string{"oval.xml": body, "other.xml": "<oval_definitions>other</oval_definitions>"} {
+		bs, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to read downloaded file. err: %s", err)
+		}
+		if string(bs) != want {
+			t.Errorf("expected: %q, actual: %q", want, bs)
+		}
+	}
+
+	entries, err := ReadArchiveIndex(dir)
+	if err != nil {
+		t.Fatalf("Failed to read index. err: %s", err)
+	}
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	want := []ArchiveEntry{
+		{File: "other.xml", URL: ts.URL + "/other.xml", SHA256: sum("<oval_definitions>other</oval_definitions>"), FetchedAt: fetchedAt},
+		{File: "oval.xml", URL: ts.URL + "/oval.xml.bz2", SHA256: sum(body), FetchedAt: fetchedAt},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("expected: %+v, actual: %+v", want, entries)
+	}
+
+	// and read again by local-dir as of the fetch timestamp, without the download-dir not to rewrite them
+	viper.Set("download-dir", nil)
+	viper.Set("local-dir", dir)
+	defer viper.Set("local-dir", nil)
+	results, err := FetchFeedFiles(context.Background(), reqs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(results[0].Body) != body || !results[0].ModTime.Equal(fetchedAt) {
+		t.Errorf("expected: %q as of %s, actual: %q as of %s", body, fetchedAt, results[0].Body, results[0].ModTime)
+	}
+}
@@ -0,0 +1,236 @@
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/log"
+)
+
+// httpCache stores the downloaded files with their cache validators in "cache-dir", so that the files not modified since are
+// revalidated with a conditional request and reused across the runs, even if the DB is rebuilt from scratch every time
+type httpCache struct {
+	mu      sync.Mutex
+	dir     string
+	maxAge  time.Duration // the entries not validated for maxAge are pruned, no limit if 0
+	maxSize int64         // the least recently validated entries are pruned over maxSize bytes in total, no limit if 0
+	now     func() time.Time
+	logger  log15.Logger // the root logger if nil
+}
+
+// cacheEntry is the metadata of the cached file, stored in <key>.json next to the body in <key>.body
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	SHA256       string    `json:"sha256,omitempty"` // verified against the published checksum when stored, empty if not verified
+	ValidatedAt  time.Time `json:"validated_at"`     // stored or revalidated last
+}
+
+type cacheOption struct {
+	dir     string
+	maxAge  time.Duration
+	maxSize int64
+}
+
+var (
+	sharedCacheMu  sync.Mutex
+	sharedCache    *httpCache
+	sharedCacheOpt cacheOption
+)
+
+// openCache returns the cache shared by the fetches of one run, pruned when opened, or nil without "cache-dir" of ctx
+func openCache(ctx context.Context) (*httpCache, error) {
+	conf := config.FromContext(ctx)
+	opt := cacheOption{
+		dir:     conf.CacheDir,
+		maxAge:  conf.CacheMaxAge,
+		maxSize: conf.CacheMaxSize << 20,
+	}
+	if opt.dir == "" {
+		return nil, nil
+	}
+
+	sharedCacheMu.Lock()
+	defer sharedCacheMu.Unlock()
+	if sharedCache != nil && sharedCacheOpt == opt {
+		return sharedCache, nil
+	}
+
+	if err := os.MkdirAll(opt.dir, 0700); err != nil {
+		return nil, xerrors.Errorf("Failed to create cache dir. path: %s, err: %w", opt.dir, err)
+	}
+	c := &httpCache{dir: opt.dir, maxAge: opt.maxAge, maxSize: opt.maxSize, now: time.Now, logger: log.FromContext(ctx)}
+	c.mu.Lock()
+	err := c.prune()
+	c.mu.Unlock()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to prune cache. err: %w", err)
+	}
+	sharedCache, sharedCacheOpt = c, opt
+	return c, nil
+}
+
+func (c *httpCache) path(rawURL, ext string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+ext)
+}
+
+// get returns the cached file of rawURL, or false if not cached or expired
+func (c *httpCache) get(rawURL string) (cacheEntry, []byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := readCacheEntry(c.path(rawURL, ".json"))
+	if err != nil || e.URL != rawURL || c.expired(e) {
+		return cacheEntry{}, nil, false
+	}
+	body, err := os.ReadFile(c.path(rawURL, ".body"))
+	if err != nil {
+		return cacheEntry{}, nil, false
+	}
+	return e, body, true
+}
+
+// put stores the file downloaded from e.URL, replacing the stale one, and prunes the cache over the size
+func (c *httpCache) put(e cacheEntry, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := writeFileAtomic(c.path(e.URL, ".body"), body); err != nil {
+		return xerrors.Errorf("Failed to write cached file. err: %w", err)
+	}
+	e.ValidatedAt = c.now()
+	if err := c.writeEntry(e); err != nil {
+		return err
+	}
+	return c.prune()
+}
+
+// touch records that the cached file of rawURL has been revalidated, which keeps it from being pruned by the age
+func (c *httpCache) touch(rawURL string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := readCacheEntry(c.path(rawURL, ".json"))
+	if err != nil {
+		return err
+	}
+	e.ValidatedAt = c.now()
+	return c.writeEntry(e)
+}
+
+func (c *httpCache) writeEntry(e cacheEntry) error {
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal cache entry. err: %w", err)
+	}
+	if err := writeFileAtomic(c.path(e.URL, ".json"), bs); err != nil {
+		return xerrors.Errorf("Failed to write cache entry. err: %w", err)
+	}
+	return nil
+}
+
+func (c *httpCache) expired(e cacheEntry) bool {
+	return c.maxAge > 0 && c.now().Sub(e.ValidatedAt) > c.maxAge
+}
+
+// prune removes the expired entries, the broken ones, and then the least recently validated ones over the size
+func (c *httpCache) prune() error {
+	des, err := os.ReadDir(c.dir)
+	if err != nil {
+		return xerrors.Errorf("Failed to read cache dir. path: %s, err: %w", c.dir, err)
+	}
+
+	type entry struct {
+		key         string
+		validatedAt time.Time
+		size        int64
+	}
+	entries := []entry{}
+	keys := map[string]struct{}{}
+	for _, de := range des {
+		key, ok := strings.CutSuffix(de.Name(), ".json")
+		if !ok {
+			continue
+		}
+		e, err := readCacheEntry(filepath.Join(c.dir, de.Name()))
+		if err != nil || c.expired(e) {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(c.dir, key+".body"))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry{key: key, validatedAt: e.ValidatedAt, size: fi.Size()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].validatedAt.After(entries[j].validatedAt) })
+	var total int64
+	for _, e := range entries {
+		total += e.size
+		if c.maxSize > 0 && total > c.maxSize {
+			continue
+		}
+		keys[e.key] = struct{}{}
+	}
+
+	for _, de := range des {
+		name := de.Name()
+		if _, ok := keys[strings.TrimSuffix(strings.TrimSuffix(name, ".json"), ".body")]; ok {
+			continue
+		}
+		logger := c.logger
+		if logger == nil {
+			logger = log15.Root()
+		}
+		logger.Debug("Prune cached file", "Path", filepath.Join(c.dir, name))
+		if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("Failed to remove cached file. path: %s, err: %w", filepath.Join(c.dir, name), err)
+		}
+	}
+	return nil
+}
+
+func readCacheEntry(p string) (cacheEntry, error) {
+	bs, err := os.ReadFile(p)
+	if err != nil {
+		return cacheEntry{}, xerrors.Errorf("Failed to read cache entry. path: %s, err: %w", p, err)
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(bs, &e); err != nil {
+		return cacheEntry{}, xerrors.Errorf("Failed to unmarshal cache entry. path: %s, err: %w", p, err)
+	}
+	return e, nil
+}
+
+// writeFileAtomic writes bs to a temporary file renamed to p, so that a broken file is never left at p
+func writeFileAtomic(p string, bs []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(bs); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
@@ -0,0 +1,151 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestFetchFeedFilesCache(t *testing.T) {
+	viper.Set("cache-dir", t.TempDir())
+	defer viper.Set("cache-dir", nil)
+
+	var (
+		etag, body  = `"v1"`, "<oval_definitions>v1</oval_definitions>"
+		downloads   int32
+		notModified int32
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&downloads, 1)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		update          bool
+		wantBody        string
+		wantDownloads   int32
+		wantNotModified int32
+	}{
+		{
+			name:          "cold cache",
+			wantBody:      "<oval_definitions>v1</oval_definitions>",
+			wantDownloads: 1,
+		},
+		{
+			name:            "warm hit via 304",
+			wantBody:        "<oval_definitions>v1</oval_definitions>",
+			wantDownloads:   1,
+			wantNotModified: 1,
+		},
+		{
+			name:            "stale on 200",
+			update:          true,
+			wantBody:        "<oval_definitions>v2</oval_definitions>",
+			wantDownloads:   2,
+			wantNotModified: 1,
+		},
+		{
+			name:            "warm hit of the updated file",
+			wantBody:        "<oval_definitions>v2</oval_definitions>",
+			wantDownloads:   2,
+			wantNotModified: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.update {
+				etag, body = `"v2"`, "<oval_definitions>v2</oval_definitions>"
+			}
+			results, err := FetchFeedFiles(context.Background(), []FetchRequest{{URL: ts.URL + "/oval.xml", MIMEType: MIMETypeXML}})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			// the cached file is fed into the normal parse path, not skipped as not modified
+			if string(results[0].Body) != tt.wantBody || results[0].NotModified {
+				t.Errorf("expected: %q, actual: %+v", tt.wantBody, results[0])
+			}
+			if downloads != tt.wantDownloads || notModified != tt.wantNotModified {
+				t.Errorf("expected: %d downloads and %d 304s, actual: %d downloads and %d 304s", tt.wantDownloads, tt.wantNotModified, downloads, notModified)
+			}
+		})
+	}
+}
+
+func TestHTTPCachePrune(t *testing.T) {
+	now := time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		maxAge  time.Duration
+		maxSize int64
+		want    []string
+	}{
+		{
+			name: "no limit",
+			want: []string{"https://example.com/old", "https://example.com/middle", "https://example.com/new"},
+		},
+		{
+			name:   "by age",
+			maxAge: 48 * time.Hour,
+			want:   []string{"https://example.com/middle", "https://example.com/new"},
+		},
+		{
+			name:    "by size",
+			maxSize: 10,
+			want:    []string{"https://example.com/new"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &httpCache{dir: t.TempDir(), now: func() time.Time { return now }}
+			for i, u := range []string{"https://example.com/old", "https://example.com/middle", "https://example.com/new"} {
+				c.now = func() time.Time { return now.Add(time.Duration(i-3) * 24 * time.Hour) }
+				if err := c.put(cacheEntry{URL: u, ETag: u}, []byte("012345")); err != nil {
+					t.Fatalf("Failed to put. err: %s", err)
+				}
+			}
+			if err := os.WriteFile(filepath.Join(c.dir, "broken.json"), []byte("{"), 0600); err != nil {
+				t.Fatalf("Failed to write fixture. err: %s", err)
+			}
+
+			c.now, c.maxAge, c.maxSize = func() time.Time { return now }, tt.maxAge, tt.maxSize
+			if err := c.prune(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			got := []string{}
+			for _, u := range []string{"https://example.com/old", "https://example.com/middle", "https://example.com/new"} {
+				if e, _, ok := c.get(u); ok && e.URL == u {
+					got = append(got, u)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected: %v, actual: %v", tt.want, got)
+			}
+			des, err := os.ReadDir(c.dir)
+			if err != nil {
+				t.Fatalf("Failed to read dir. err: %s", err)
+			}
+			if len(des) != 2*len(tt.want) {
+				t.Errorf("expected: %d files, actual: %d", 2*len(tt.want), len(des))
+			}
+		})
+	}
+}
@@ -4,18 +4,38 @@ import (
 	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"math/rand"
+	"mime"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/htcat/htcat"
 	"github.com/inconshreveable/log15"
-	"github.com/spf13/viper"
 	"github.com/ulikunitz/xz"
+	"golang.org/x/exp/slices"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
 	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/log"
+	"github.com/vulsio/goval-dictionary/models"
 )
 
 // MIMEType :
@@ -65,215 +85,1236 @@ func (m MIMEType) String() string {
 
 // FetchRequest has url, mimetype and fetch option
 type FetchRequest struct {
-	Target        string
-	URL           string
-	MIMEType      MIMEType
-	Concurrently  bool
-	LogSuppressed bool
+	Target                string
+	URL                   string
+	MIMEType              MIMEType
+	Concurrently          bool
+	LogSuppressed         bool
+	ETag                  string // sent as If-None-Match if not empty
+	LastModified          string // sent as If-Modified-Since if not empty
+	ContentLength         int64  // of the previous fetch, compared with the one of HEAD along with LastModified if not zero
+	Checksum              bool   // verify against the checksum file published next to the file (URL + ".sha256") if any
+	FallbackURL           string // fetched instead if URL is not found or fails to decompress, e.g. the uncompressed file of the compressed URL
+	FallbackETag          string // sent as If-None-Match to FallbackURL if not empty
+	FallbackLastModified  string // sent as If-Modified-Since to FallbackURL if not empty
+	FallbackContentLength int64  // compared with the one of HEAD of FallbackURL if not zero
 }
 
-// FetchResult has url and OVAL definitions
+// FetchResult has url and OVAL definitions.
+// The files failed to fetch carry the error in their results, so that the fetchers of the families pass them on
+// and drop the aggregated error of FetchFeedFiles and StreamFeedFiles, and the other files can be inserted.
 type FetchResult struct {
 	Target        string
 	URL           string
 	Body          []byte
 	LogSuppressed bool
+	ETag          string
+	LastModified  string
+	NotModified   bool      // the file has not been modified since the previous fetch, Body is empty
+	UpToDate      bool      // NotModified told by Last-Modified and Content-Length of HEAD rather than by the conditional request
+	ContentLength int64     // Content-Length of the downloaded file, 0 or -1 if unknown
+	SHA256        string    // SHA-256 of the downloaded file verified against the published checksum, empty if not verified
+	ModTime       time.Time // modification time of the file read from the local directory, zero if downloaded
+	Err           error     // the error of fetching the file, only Target, URL and LogSuppressed are set if not nil
 }
 
-// genWorkers generate workers
-func genWorkers(num int) chan<- func() {
-	tasks := make(chan func())
-	for i := 0; i < num; i++ {
-		go func() {
-			for f := range tasks {
-				f()
-			}
-		}()
+// WithCacheValidators sets the cache validators of the previous fetch to the requests, so that unchanged files are not downloaded again.
+// They are set only if the previous fetch has inserted all the OS versions required from the file: the target of the request, or osVers if no target.
+func WithCacheValidators(reqs []FetchRequest, validators map[string]models.CacheValidator, osVers []string) []FetchRequest {
+	for i := range reqs {
+		required := osVers
+		if reqs[i].Target != "" {
+			required = []string{reqs[i].Target}
+		}
+		if v, ok := validators[reqs[i].URL]; ok && containsAll(v.OSVersions, required) {
+			reqs[i].ETag = v.ETag
+			reqs[i].LastModified = v.LastModified
+			reqs[i].ContentLength = v.ContentLength
+		}
+		// the validators are recorded by the URL actually fetched, so those of the fallback are sent only to the fallback
+		if v, ok := validators[reqs[i].FallbackURL]; ok && reqs[i].FallbackURL != "" && containsAll(v.OSVersions, required) {
+			reqs[i].FallbackETag = v.ETag
+			reqs[i].FallbackLastModified = v.LastModified
+			reqs[i].FallbackContentLength = v.ContentLength
+		}
 	}
-	return tasks
+	return reqs
 }
 
-// FetchFeedFiles :
-func FetchFeedFiles(reqs []FetchRequest) (results []FetchResult, err error) {
-	reqChan := make(chan FetchRequest, len(reqs))
-	resChan := make(chan FetchResult, len(reqs))
-	errChan := make(chan error, len(reqs))
-	defer close(reqChan)
-	defer close(resChan)
-	defer close(errChan)
+func containsAll(xs, ys []string) bool {
+	for _, y := range ys {
+		if !slices.Contains(xs, y) {
+			return false
+		}
+	}
+	return true
+}
+
+// FetchFeedFiles fetches the files with up to "threads" downloads at a time, and returns the result of each request in the order of reqs.
+// If some of the files fail, their results carry the error, and the aggregated error is returned as well.
+// With "fail-fast", the files not started yet are skipped after the first failure, and so are they once ctx is done.
+func FetchFeedFiles(ctx context.Context, reqs []FetchRequest) ([]FetchResult, error) {
+	results := make([]FetchResult, 0, len(reqs))
+	err := StreamFeedFiles(ctx, reqs, func(r FetchResult) {
+		results = append(results, r)
+	})
+	return results, err
+}
+
+// StreamFeedFiles fetches the files as FetchFeedFiles does, but calls fn with the result of each request in the order of reqs as soon as it is fetched,
+// so that the caller converts and inserts one while the next ones are downloaded. fn is called in the calling goroutine, and the files downloaded
+// or being downloaded ahead of the one passed to fn are up to "threads", which caps the bodies held in memory.
+func StreamFeedFiles(ctx context.Context, reqs []FetchRequest, fn func(FetchResult)) error {
+	conf := config.FromContext(ctx)
+	threads := conf.Threads
+	if threads < 1 || threads > len(reqs) {
+		threads = len(reqs)
+	}
+	failFast := conf.FailFast
 
 	for _, r := range reqs {
-		if !r.LogSuppressed {
-			log15.Info("Fetching... ", "URL", r.URL)
+		if r.LogSuppressed {
+			continue
+		}
+		logger := log.FromContext(requestContext(ctx, r))
+		if p, local := localPath(ctx, r.URL); local {
+			logger.Info("Loading... ", "Path", p)
+		} else {
+			logger.Info("Fetching... ", "URL", r.URL)
 		}
 	}
 
+	type fetched struct {
+		resp response
+		err  error
+		done chan struct{}
+	}
+	files := make([]fetched, len(reqs))
+	for i := range files {
+		files[i].done = make(chan struct{})
+	}
+	var failed atomic.Bool
+	// a slot is taken by each file from the start of its download until it is passed to fn
+	slots := make(chan struct{}, threads)
 	go func() {
-		for _, r := range reqs {
-			reqChan <- r
-		}
-	}()
+		for i := range reqs {
+			slots <- struct{}{}
+			go func(idx int) {
+				defer close(files[idx].done)
+				req := reqs[idx]
+				ctx := requestContext(ctx, req)
+				if failFast && failed.Load() {
+					files[idx].err = xerrors.Errorf("Skip fetching because of the previous failure. url: %s", req.URL)
+					return
+				}
+				if err := ctx.Err(); err != nil {
+					files[idx].err = xerrors.Errorf("Skip fetching because of the cancellation. url: %s, err: %w", req.URL, err)
+					return
+				}
 
-	concurrency := len(reqs)
-	tasks := genWorkers(concurrency)
-	wg := new(sync.WaitGroup)
-	for range reqs {
-		wg.Add(1)
-		tasks <- func() {
-			select {
-			case req := <-reqChan:
-				var body []byte
-				if req.Concurrently {
-					body, err = fetchFileConcurrently(req, 20/len(reqs))
-				} else {
-					body, err = fetchFileWithUA(req)
+				resp, err := fetchFile(ctx, req, max(20/threads, 1))
+				if err == nil && !resp.notModified {
+					err = archiveDecompressed(ctx, resp.url, resp.body)
 				}
-				wg.Done()
 				if err != nil {
-					errChan <- err
+					log.FromContext(ctx).Error("Failed to fetch", "URL", req.URL, "err", err)
+					files[idx].err = err
+					failed.Store(true)
 					return
 				}
-				resChan <- FetchResult{
-					Target:        req.Target,
-					URL:           req.URL,
-					Body:          body,
-					LogSuppressed: req.LogSuppressed,
-				}
-			}
-			return
+				files[idx].resp = resp
+			}(i)
+		}
+	}()
+
+	msgs := []string{}
+	for i, req := range reqs {
+		<-files[i].done
+		f := files[i]
+		// not to hold the body passed to fn until the end
+		files[i] = fetched{}
+
+		if f.err != nil {
+			msgs = append(msgs, f.err.Error())
+			fn(FetchResult{
+				Target:        req.Target,
+				URL:           req.URL,
+				LogSuppressed: req.LogSuppressed,
+				Err:           f.err,
+			})
+		} else {
+			fn(FetchResult{
+				Target:        req.Target,
+				URL:           f.resp.url,
+				Body:          f.resp.body,
+				LogSuppressed: req.LogSuppressed,
+				ETag:          f.resp.etag,
+				LastModified:  f.resp.lastModified,
+				NotModified:   f.resp.notModified,
+				UpToDate:      f.resp.upToDate,
+				ContentLength: f.resp.contentLength,
+				SHA256:        f.resp.sha256,
+				ModTime:       f.resp.modTime,
+			})
+		}
+		<-slots
+	}
+	if len(msgs) > 0 {
+		return xerrors.Errorf("Failed to fetch %d of %d files. err: [%s]", len(msgs), len(reqs), strings.Join(msgs, ", "))
+	}
+	return nil
+}
+
+// requestContext returns ctx tagging the lines of fetching req with its target, e.g. the OS version of the file
+func requestContext(ctx context.Context, req FetchRequest) context.Context {
+	if req.Target == "" {
+		return ctx
+	}
+	return log.NewContext(ctx, log.Fields{"Version": req.Target})
+}
+
+// fetchFile fetches the file of req, or of req.FallbackURL if not found or failed to decompress
+func fetchFile(ctx context.Context, req FetchRequest, concurrency int) (response, error) {
+	res, err := fetchFileCached(ctx, req, concurrency)
+	switch {
+	case err == nil || req.FallbackURL == "":
+		res.url = req.URL
+		return res, err
+	case IsNotFound(err):
+		log.FromContext(ctx).Info("Not found, fetching the fallback", "URL", req.URL, "Fallback", req.FallbackURL)
+	case isDecompressError(err):
+		log.FromContext(ctx).Warn("Failed to decompress, fetching the fallback", "URL", req.URL, "Fallback", req.FallbackURL, "err", err)
+	default:
+		res.url = req.URL
+		return res, err
+	}
+
+	fallback := req
+	fallback.URL, fallback.FallbackURL, fallback.ETag, fallback.LastModified, fallback.FallbackETag, fallback.FallbackLastModified = req.FallbackURL, "", req.FallbackETag, req.FallbackLastModified, "", ""
+	fallback.ContentLength, fallback.FallbackContentLength = req.FallbackContentLength, 0
+	res, err = fetchFileCached(ctx, fallback, concurrency)
+	if err == nil {
+		log.FromContext(ctx).Info("Fetched the fallback", "URL", fallback.URL)
+	}
+	res.url = fallback.URL
+	return res, err
+}
+
+// fetchFileCached fetches the file of req, revalidating the one in the cache of "cache-dir" if any, and stores the downloaded one in the cache.
+// The cache validators of the previous fetch in FetchMeta take precedence, whose 304 skips the file rather than reusing the cached one.
+func fetchFileCached(ctx context.Context, req FetchRequest, concurrency int) (response, error) {
+	if _, local := localPath(ctx, req.URL); local {
+		return fetchFileOnce(ctx, req, concurrency)
+	}
+	cache, err := openCache(ctx)
+	if err != nil {
+		return response{}, xerrors.Errorf("Failed to open cache. err: %w", err)
+	}
+	if cache == nil {
+		return fetchFileOnce(ctx, req, concurrency)
+	}
+
+	var (
+		entry  cacheEntry
+		raw    []byte
+		cached bool
+	)
+	if req.ETag == "" && req.LastModified == "" {
+		if entry, raw, cached = cache.get(req.URL); cached {
+			req.ETag, req.LastModified = entry.ETag, entry.LastModified
+		}
+	}
+
+	res, err := fetchFileOnce(ctx, req, concurrency)
+	if err != nil {
+		return response{}, err
+	}
+	if cached && res.notModified {
+		log.FromContext(ctx).Info("Not modified, use the cached file", "URL", req.URL)
+		body, err := decompress(compression(req, entry.ContentType), raw)
+		if err != nil {
+			return response{}, xerrors.Errorf("Failed to decompress the cached file. url: %s, err: %w", req.URL, err)
+		}
+		if err := cache.touch(req.URL); err != nil {
+			log.FromContext(ctx).Warn("Failed to update the cached file", "URL", req.URL, "err", err)
+		}
+		return response{body: body, etag: entry.ETag, lastModified: entry.LastModified, sha256: entry.SHA256, contentType: entry.ContentType}, nil
+	}
+	// the file without the cache validators cannot be revalidated
+	if !res.notModified && (res.etag != "" || res.lastModified != "") {
+		if err := cache.put(cacheEntry{URL: req.URL, ETag: res.etag, LastModified: res.lastModified, ContentType: res.contentType, SHA256: res.sha256}, res.raw); err != nil {
+			log.FromContext(ctx).Warn("Failed to store the file in the cache", "URL", req.URL, "err", err)
+		}
+	}
+	return res, nil
+}
+
+func fetchFileOnce(ctx context.Context, req FetchRequest, concurrency int) (response, error) {
+	p, local := localPath(ctx, req.URL)
+	if local {
+		return readLocalFile(ctx, req, p)
+	}
+	download := fetchFileWithUA
+	if req.Concurrently {
+		download = func(ctx context.Context, req FetchRequest) (response, error) {
+			return fetchFileConcurrently(ctx, req, concurrency)
 		}
 	}
-	wg.Wait()
 
-	errs := []error{}
-	timeout := time.After(10 * 60 * time.Second)
-	for range reqs {
+	res, err := download(ctx, req)
+	// the truncation is retried by withRetry if detected by Content-Length, otherwise only found out after the download, then retried once
+	var te *truncatedError
+	if xerrors.As(err, &te) && te.expected < 0 {
+		log.FromContext(ctx).Warn("The file without Content-Length ends unexpectedly, retrying the download once", "URL", req.URL, "received", te.actual, "err", te.err)
+		res, err = download(ctx, req)
+	}
+	return res, err
+}
+
+// IsNotFound reports whether the file does not exist on the server or in the local directory
+func IsNotFound(err error) bool {
+	var se *statusError
+	if xerrors.As(err, &se) {
+		return se.code == http.StatusNotFound
+	}
+	return xerrors.Is(err, os.ErrNotExist)
+}
+
+// decompressError is returned when the fetched file fails to decompress, e.g. a truncated or mislabeled file
+type decompressError struct {
+	mimeType MIMEType
+	err      error
+}
+
+func (e *decompressError) Error() string {
+	return fmt.Sprintf("Failed to decompress %s file. err: %s", e.mimeType, e.err)
+}
+
+func (e *decompressError) Unwrap() error {
+	return e.err
+}
+
+func isDecompressError(err error) bool {
+	var de *decompressError
+	return xerrors.As(err, &de)
+}
+
+func max(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+// truncatedError is returned when the body is shorter than Content-Length, or ends in the middle of the file without Content-Length
+type truncatedError struct {
+	url      string
+	expected int64 // -1 if Content-Length is absent
+	actual   int64
+	err      error // the error of reading the body or of parsing it at EOF, nil if not any
+}
+
+func (e *truncatedError) Error() string {
+	if e.expected < 0 {
+		return fmt.Sprintf("Failed to read response body, truncated without Content-Length. url: %s, received: %d bytes, err: %s", e.url, e.actual, e.err)
+	}
+	return fmt.Sprintf("Failed to read response body, truncated. url: %s, expected: %d bytes, received: %d bytes", e.url, e.expected, e.actual)
+}
+
+func (e *truncatedError) Unwrap() error {
+	return e.err
+}
+
+// retryBaseDelay is the delay before the first retry, doubled on each retry
+var retryBaseDelay = time.Second
+
+// statusError is returned for a non-200 HTTP response
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("Failed to HTTP GET. url: %s, status: %d %s", e.url, e.code, http.StatusText(e.code))
+}
+
+// retryable reports whether the download may succeed if retried: network errors, truncated bodies and 5xx/429 are retryable, other statuses (e.g. 404, 403) are not
+func retryable(err error) bool {
+	var se *statusError
+	if xerrors.As(err, &se) {
+		return se.code >= http.StatusInternalServerError || se.code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// FetchError is the error of the download of URL given up after the attempts, told by Temporary whether it is worth retrying later
+type FetchError struct {
+	URL      string
+	Attempts int
+	Err      error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("Failed to fetch after %d attempt(s). url: %s, err: %s", e.Attempts, e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether the download may succeed if retried later, e.g. on the network error or 503 of the mirror, unlike 404 of the unknown file
+func (e *FetchError) Temporary() bool {
+	return retryable(e.Err)
+}
+
+// withRetry calls f until it succeeds or the error is not retryable, up to the "retry" times with exponential backoff and jitter.
+// It gives up without retrying once ctx is done, even in the backoff.
+func withRetry[T any](ctx context.Context, rawURL string, f func() (T, error)) (T, error) {
+	retry := config.FromContext(ctx).Retry
+	for attempt := 0; ; attempt++ {
+		res, err := f()
+		if err == nil {
+			return res, nil
+		}
+		if attempt >= retry || !retryable(err) || ctx.Err() != nil {
+			var zero T
+			return zero, &FetchError{URL: rawURL, Attempts: attempt + 1, Err: err}
+		}
+
+		wait := retryBaseDelay << attempt
+		wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+		log.FromContext(ctx).Warn("Failed to fetch, retrying...", "URL", rawURL, "attempt", attempt+1, "wait", wait, "err", err)
+		t := time.NewTimer(wait)
 		select {
-		case res := <-resChan:
-			results = append(results, res)
-		case err := <-errChan:
-			errs = append(errs, err)
-		case <-timeout:
-			return results, fmt.Errorf("Timeout Fetching")
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			var zero T
+			return zero, &FetchError{URL: rawURL, Attempts: attempt + 1, Err: ctx.Err()}
 		}
 	}
-	if 0 < len(errs) {
-		return results, fmt.Errorf("%s", errs)
+}
+
+// timeoutError is returned when the request has timed out, retryable
+type timeoutError struct {
+	url     string
+	elapsed time.Duration
+	err     error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("Failed to download, timed out. url: %s, elapsed: %s, err: %s", e.url, e.elapsed.Round(time.Millisecond), e.err)
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+// withTimeout returns the timeoutError with the elapsed time since start if err is a timeout, otherwise err as is
+func withTimeout(rawURL string, start time.Time, err error) error {
+	var ne net.Error
+	if xerrors.As(err, &ne) && ne.Timeout() {
+		return &timeoutError{url: rawURL, elapsed: time.Since(start), err: err}
 	}
-	return results, nil
+	return err
+}
+
+// clientOption is the settings of the http.Client shared by the fetches
+type clientOption struct {
+	httpProxy           string
+	noProxy             string
+	timeout             time.Duration
+	dialTimeout         time.Duration
+	tlsHandshakeTimeout time.Duration
+	headers             string // "http-header" joined with "\n", to be comparable
+	interval            time.Duration
+	insecureSkipVerify  bool
+	caCert              string
 }
 
-func fetchFileConcurrently(req FetchRequest, concurrency int) (body []byte, err error) {
-	var proxyURL *url.URL
-	httpClient := &http.Client{}
-	httpProxy := viper.GetString("http-proxy")
+// HTTPClient sends the requests of the fetches, satisfied by *http.Client
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+var (
+	sharedClientMu  sync.Mutex
+	sharedClient    *http.Client
+	sharedClientOpt clientOption
+	injectedClient  HTTPClient
+)
+
+// SetHTTPClient makes the fetches send the requests through c instead of the client configured from the flags,
+// e.g. the one of httptest.Server in the tests, or the one of the library user. The retries, the checksum verification
+// and the cache still apply, while the proxy, the timeouts, the headers and the rate limit are left to c. nil restores the default.
+func SetHTTPClient(c HTTPClient) {
+	sharedClientMu.Lock()
+	defer sharedClientMu.Unlock()
+	injectedClient = c
+}
+
+// proxyFunc returns the proxy of the requests: httpProxy for both of http and https, or HTTP_PROXY and HTTPS_PROXY if empty,
+// bypassed for the hosts in noProxy, or NO_PROXY if empty. The credentials in the proxy URL are sent as Proxy-Authorization.
+func proxyFunc(httpProxy, noProxy string) (func(*http.Request) (*url.URL, error), error) {
+	cfg := httpproxy.FromEnvironment()
 	if httpProxy != "" {
-		if proxyURL, err = url.Parse(httpProxy); err != nil {
+		if _, err := url.Parse(httpProxy); err != nil {
+			// url.Error has the URL with the credentials
+			var ue *url.Error
+			if xerrors.As(err, &ue) {
+				err = ue.Err
+			}
 			return nil, xerrors.Errorf("Failed to parse proxy url. err: %w", err)
 		}
-		httpClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		cfg.HTTPProxy, cfg.HTTPSProxy = httpProxy, httpProxy
+	}
+	if noProxy != "" {
+		cfg.NoProxy = noProxy
 	}
+	f := cfg.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) { return f(req.URL) }, nil
+}
 
-	u, err := url.Parse(req.URL)
+// socksProxy returns the URL of httpProxy if it is of SOCKS5, i.e. socks5:// or socks5h://, which the transport dials through
+// rather than sends the requests to
+func socksProxy(httpProxy string) (*url.URL, bool) {
+	u, err := url.Parse(httpProxy)
+	if err != nil || u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return nil, false
+	}
+	return u, true
+}
+
+// socksDialContext returns the dial of the connections through the SOCKS5 proxy of proxyURL with the credentials in it if any,
+// or of forward directly for the hosts of noProxy, or NO_PROXY if empty, matched as of the HTTP proxy. The hostnames are sent to the proxy
+// to resolve as of socks5h, even of socks5://, for the lookups of the mirrors not to leak from the network behind the proxy.
+func socksDialContext(proxyURL *url.URL, noProxy string, forward *net.Dialer) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	d, err := proxy.FromURL(proxyURL, forward)
 	if err != nil {
-		return nil, xerrors.Errorf("Failed to parse given URL: %w", err)
+		return nil, xerrors.Errorf("Failed to create SOCKS5 dialer. err: %w", err)
 	}
+	dialer, ok := d.(proxy.ContextDialer)
+	if !ok {
+		return nil, xerrors.Errorf("Failed to create SOCKS5 dialer. err: no DialContext of %T", d)
+	}
+	if noProxy == "" {
+		noProxy = httpproxy.FromEnvironment().NoProxy
+	}
+	// only whether to bypass is of the config, with the scheme of the proxy unused
+	useProxy := (&httpproxy.Config{HTTPProxy: "http://socks5", HTTPSProxy: "http://socks5", NoProxy: noProxy}).ProxyFunc()
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if u, err := useProxy(&url.URL{Scheme: "https", Host: addr}); err == nil && u == nil {
+			return forward.DialContext(ctx, network, addr)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}, nil
+}
 
-	buf := bytes.Buffer{}
-	htc := htcat.New(httpClient, u, concurrency)
-	if _, err := htc.WriteTo(&buf); err != nil {
-		return nil, xerrors.Errorf("Failed to write to output stream: %w", err)
+// parseHeaders parses the "Name: value" headers to send with every request, with the default User-Agent of goval-dictionary/<version> unless given
+func parseHeaders(headers []string) (http.Header, error) {
+	h := http.Header{}
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, xerrors.Errorf("Failed to parse http header. err: not in the form of \"Name: value\": %q", header)
+		}
+		h.Add(name, strings.TrimSpace(value))
 	}
+	if h.Get("User-Agent") == "" {
+		h.Set("User-Agent", fmt.Sprintf("goval-dictionary/%s", config.DisplayVersion()))
+	}
+	return h, nil
+}
 
-	var b bytes.Buffer
-	switch req.MIMEType {
-	case MIMETypeXML, MIMETypeTxt, MIMETypeJSON, MIMETypeYml, MIMETypeHTML:
-		b = buf
-	case MIMETypeBzip2:
-		if _, err := b.ReadFrom(bzip2.NewReader(bytes.NewReader(buf.Bytes()))); err != nil {
-			return nil, xerrors.Errorf("Failed to open bzip2 file. err: %w", err)
+// rateLimiter spaces the requests of all the workers at least interval apart.
+// The time slept in the backoff of retries counts toward the interval, so that it is not waited twice.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+	now      func() time.Time
+}
+
+func newRateLimiter(interval time.Duration) *rateLimiter {
+	if interval <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: interval, now: time.Now}
+}
+
+// reserve reserves the next slot and returns how long to wait for it
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	d := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return d
+}
+
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	d := l.reserve()
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateInterval returns the interval between requests of "wait" and "requests-per-second" of conf, the longer one if both are set
+func rateInterval(conf config.Conf) time.Duration {
+	interval := conf.Wait
+	if rps := conf.RequestsPerSecond; rps > 0 {
+		if d := time.Duration(float64(time.Second) / rps); d > interval {
+			interval = d
 		}
-	case MIMETypeXz:
-		r, err := xz.NewReader(bytes.NewReader(buf.Bytes()))
+	}
+	return interval
+}
+
+// connStats counts the connections the requests of the shared client got, new or reused from the idle ones of the pool
+type connStats struct {
+	created atomic.Int64
+	reused  atomic.Int64
+}
+
+// conns counts across the shared clients of the run, e.g. rebuilt by the different flags of fetch all
+var conns connStats
+
+// ConnStats returns the numbers of the connections opened and reused by the requests of the fetches so far,
+// e.g. 1 and 9 of the 10 files of a mirror fetched over a connection kept alive
+func ConnStats() (created, reused int64) {
+	return conns.created.Load(), conns.reused.Load()
+}
+
+// trace returns ctx tracing the connection got for the request of rawURL, logged at debug level
+func (s *connStats) trace(ctx context.Context, rawURL string) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				s.reused.Add(1)
+			} else {
+				s.created.Add(1)
+			}
+			log.FromContext(ctx).Debug("Got connection", "URL", rawURL, "Reused", info.Reused, "WasIdle", info.WasIdle, "IdleTime", info.IdleTime)
+		},
+	})
+}
+
+// sharedTransport sets the headers on every request sent through the transport and paces them by the limiter,
+// including the ones following redirects, the HEAD requests and the chunks downloaded by htcat
+type sharedTransport struct {
+	base    *http.Transport
+	header  http.Header
+	limiter *rateLimiter
+}
+
+func (t *sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	req = req.Clone(conns.trace(req.Context(), req.URL.String()))
+	for k, vs := range t.header {
+		req.Header[k] = vs
+	}
+	return t.base.RoundTrip(req)
+}
+
+// CloseIdleConnections is called by http.Client.CloseIdleConnections
+func (t *sharedTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
+
+// newTLSConfig returns the TLS config trusting the CA certificates in the PEM file of caCert in addition to the system ones,
+// or not verifying the server certificates at all if insecureSkipVerify, warned to logger
+func newTLSConfig(logger log15.Logger, insecureSkipVerify bool, caCert string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caCert != "" {
+		pool, err := x509.SystemCertPool()
 		if err != nil {
-			return nil, xerrors.Errorf("Failed to open xz file. err: %w", err)
+			logger.Debug("Failed to load the system cert pool, trust only the given CA", "err", err)
+			pool = x509.NewCertPool()
 		}
-		if _, err := b.ReadFrom(r); err != nil {
-			return nil, xerrors.Errorf("Failed to read xz file. err: %w", err)
+		bs, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to read CA certificate. path: %s, err: %w", caCert, err)
 		}
-	case MIMETypeGzip:
-		r, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+		if !pool.AppendCertsFromPEM(bs) {
+			return nil, xerrors.Errorf("Failed to append CA certificate. path: %s, err: no PEM certificate found", caCert)
+		}
+		cfg.RootCAs = pool
+	}
+	if insecureSkipVerify {
+		logger.Warn("TLS certificate verification is DISABLED, the fetched OVAL may be tampered with by anyone on the network. Use --cacert instead if possible.")
+		cfg.InsecureSkipVerify = true
+	}
+	return cfg, nil
+}
+
+// newHTTPClient returns the client injected by SetHTTPClient, or the http.Client shared by the fetches of one run and all its workers,
+// so that the connections are kept alive across the files, and multiplexed by HTTP/2 if the server supports it, rather than
+// the handshakes of TCP and TLS per file dominating the small files of the far mirrors
+func newHTTPClient(ctx context.Context) (HTTPClient, error) {
+	conf := config.FromContext(ctx)
+	opt := clientOption{
+		httpProxy:           conf.HTTPProxy,
+		noProxy:             conf.NoProxy,
+		timeout:             conf.Timeout,
+		dialTimeout:         conf.DialTimeout,
+		tlsHandshakeTimeout: conf.TLSHandshakeTimeout,
+		headers:             strings.Join(conf.HTTPHeader, "\n"),
+		interval:            rateInterval(conf),
+		insecureSkipVerify:  conf.InsecureSkipVerify,
+		caCert:              conf.CACert,
+	}
+
+	sharedClientMu.Lock()
+	defer sharedClientMu.Unlock()
+	if injectedClient != nil {
+		return injectedClient, nil
+	}
+	if sharedClient != nil && sharedClientOpt == opt {
+		return sharedClient, nil
+	}
+
+	var headers []string
+	if opt.headers != "" {
+		headers = strings.Split(opt.headers, "\n")
+	}
+	header, err := parseHeaders(headers)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to set http headers. err: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// the one of http.DefaultTransport
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if opt.dialTimeout > 0 {
+		dialer.Timeout = opt.dialTimeout
+		transport.DialContext = dialer.DialContext
+	}
+	if u, ok := socksProxy(opt.httpProxy); ok {
+		dial, err := socksDialContext(u, opt.noProxy, dialer)
 		if err != nil {
-			return nil, xerrors.Errorf("Failed to open gzip file. err: %w", err)
+			return nil, xerrors.Errorf("Failed to set proxy. err: %w", err)
 		}
-		if _, err := b.ReadFrom(r); err != nil {
-			return nil, xerrors.Errorf("Failed to read gzip file. err: %w", err)
+		transport.Proxy, transport.DialContext = nil, dial
+	} else {
+		f, err := proxyFunc(opt.httpProxy, opt.noProxy)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to set proxy. err: %w", err)
 		}
+		transport.Proxy = f
+	}
+	if opt.tlsHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = opt.tlsHandshakeTimeout
 	}
+	if opt.insecureSkipVerify || opt.caCert != "" {
+		tlsConfig, err := newTLSConfig(log.FromContext(ctx), opt.insecureSkipVerify, opt.caCert)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to set TLS config. err: %w", err)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	// up to "threads" files, and the chunks of htcat, are downloaded from the same host at a time
+	transport.MaxIdleConnsPerHost = 20
+	// HTTP/2 is disabled by the custom DialContext and TLSClientConfig above unless forced, as http.DefaultTransport is
+	transport.ForceAttemptHTTP2 = true
 
-	return b.Bytes(), nil
+	if sharedClient != nil {
+		sharedClient.CloseIdleConnections()
+	}
+	sharedClient = &http.Client{Transport: &sharedTransport{base: transport, header: header, limiter: newRateLimiter(opt.interval)}, Timeout: opt.timeout}
+	sharedClientOpt = opt
+	return sharedClient, nil
 }
 
-func fetchFileWithUA(req FetchRequest) (body []byte, err error) {
-	var proxyURL *url.URL
-	var resp *http.Response
-
-	httpClient := &http.Client{}
-	httpProxy := viper.GetString("http-proxy")
-	if httpProxy != "" {
-		if proxyURL, err = url.Parse(httpProxy); err != nil {
-			return nil, xerrors.Errorf("Failed to parse proxy url. err: %w", err)
+// HTTPGet downloads the body of the URL, retrying on transient failures
+func HTTPGet(ctx context.Context, rawURL string) ([]byte, error) {
+	if p, local := localPath(ctx, rawURL); local {
+		bs, err := os.ReadFile(p)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to read local file. path: %s, err: %w", p, err)
 		}
-		httpClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		return bs, nil
 	}
 
-	httpreq, err := http.NewRequest("GET", req.URL, nil)
+	httpClient, err := newHTTPClient(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to create http client. err: %w", err)
+	}
+	resp, err := withRetry(ctx, rawURL, func() (response, error) {
+		return httpDo(ctx, httpClient, http.MethodGet, FetchRequest{URL: rawURL})
+	})
 	if err != nil {
-		return nil, xerrors.Errorf("Failed to download. err: %w", err)
+		return nil, err
+	}
+	return resp.body, nil
+}
+
+// response is the downloaded body and the cache validators of a file
+type response struct {
+	body          []byte
+	raw           []byte // body before decompressed, stored in the cache
+	etag          string
+	lastModified  string
+	notModified   bool
+	upToDate      bool // notModified by unchanged
+	sha256        string
+	modTime       time.Time
+	contentType   string
+	contentLength int64
+	url           string // fetched URL, the fallback one if URL is not found
+}
+
+// progressInterval is the interval to report the progress of a download
+var progressInterval = 5 * time.Second
+
+// progress counts the bytes written through it, and logs the progress of the download every progressInterval.
+// The progress is logged as lines rather than redrawn on a terminal, so that the logs of cron jobs stay readable.
+type progress struct {
+	w       io.Writer
+	url     string
+	total   int64 // -1 if unknown
+	written int64
+	start   time.Time
+	last    time.Time
+	logged  bool
+	now     func() time.Time
+	log     func(msg string, ctx ...interface{})
+	debug   func(msg string, ctx ...interface{})
+}
+
+func newProgress(logger log15.Logger, w io.Writer, rawURL string, total int64) *progress {
+	now := time.Now()
+	return &progress{w: w, url: rawURL, total: total, start: now, last: now, now: time.Now, log: logger.Info, debug: logger.Debug}
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if now := p.now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.logged = true
+		ctx := []interface{}{"URL", p.url, "Downloaded", formatBytes(p.written)}
+		if p.total > 0 {
+			ctx = append(ctx, "Total", formatBytes(p.total), "Percent", fmt.Sprintf("%d%%", p.written*100/p.total))
+		}
+		p.log("Downloading...", ctx...)
 	}
+	return n, err
+}
 
-	httpreq.Header.Set("User-Agent", "curl/7.37.0")
-	resp, err = httpClient.Do(httpreq)
+// done logs the size and the throughput of the download, at debug level if it has finished before the first progress
+func (p *progress) done() {
+	elapsed := p.now().Sub(p.start)
+	log := p.log
+	if !p.logged {
+		log = p.debug
+	}
+	throughput := "-"
+	if elapsed > 0 {
+		throughput = formatBytes(int64(float64(p.written)/elapsed.Seconds())) + "/s"
+	}
+	log("Downloaded", "URL", p.url, "Size", formatBytes(p.written), "Elapsed", elapsed.Round(time.Millisecond), "Throughput", throughput)
+}
+
+// formatBytes formats n bytes in the binary units, e.g. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// localPath returns the path of the file to read instead of downloading: the path of a file:// URL, or the file of the same name in "local-dir" of ctx
+func localPath(ctx context.Context, rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
 	if err != nil {
-		return nil, xerrors.Errorf("Failed to download. err: %w", err)
+		return "", false
+	}
+	if u.Scheme == "file" {
+		return filepath.FromSlash(u.Path), true
+	}
+	if dir := config.FromContext(ctx).LocalDir; dir != "" {
+		return filepath.Join(dir, path.Base(u.Path)), true
 	}
-	defer func() {
-		if resp != nil {
-			resp.Body.Close()
+	return "", false
+}
+
+// readLocalFile reads the file mirrored to the local directory, verifying it against the checksum file next to it if any.
+// Without the compressed file, it reads the decompressed one of the same name without the suffix, written by "download-dir", as is.
+func readLocalFile(ctx context.Context, req FetchRequest, p string) (response, error) {
+	logger := log.FromContext(ctx)
+	fi, err := os.Stat(p)
+	if plain := trimCompressionExt(p); os.IsNotExist(err) && plain != p {
+		if pfi, perr := os.Stat(plain); perr == nil {
+			logger.Debug("Read the decompressed local file instead", "Path", plain)
+			p, fi, err = plain, pfi, nil
+			req.URL, req.MIMEType = plain, MIMETypeXML
 		}
-	}()
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Failed to HTTP GET. url: %s, response: %+v", req.URL, resp)
+	}
+	if err != nil {
+		return response{}, xerrors.Errorf("Failed to read local file. target: %s, err: %w", req.Target, err)
+	}
+	bs, err := os.ReadFile(p)
+	if err != nil {
+		return response{}, xerrors.Errorf("Failed to read local file. target: %s, err: %w", req.Target, err)
+	}
+	logger.Debug("Read local file", "Path", p, "ModTime", fi.ModTime())
+
+	res := response{modTime: fi.ModTime()}
+	v := &checksumVerifier{
+		location: p + ".sha256",
+		enabled:  req.Checksum && !config.FromContext(ctx).SkipChecksum,
+		fetch: func() string {
+			bs, err := os.ReadFile(p + ".sha256")
+			if err != nil {
+				logger.Debug("Failed to read the checksum file, skip verifying", "Path", p+".sha256", "err", err)
+				return ""
+			}
+			return parseChecksum(logger, p+".sha256", bs)
+		},
+	}
+	if res.sha256, err = v.verify(bs); err != nil {
+		return response{}, err
+	}
+	if res.body, err = decompress(compression(req, res.contentType), bs); err != nil {
+		return response{}, err
+	}
+	return res, nil
+}
+
+// httpDo sends the request, conditional if req has the cache validators
+func httpDo(ctx context.Context, httpClient HTTPClient, method string, req FetchRequest) (response, error) {
+	httpreq, err := http.NewRequestWithContext(ctx, method, req.URL, nil)
+	if err != nil {
+		return response{}, xerrors.Errorf("Failed to download. err: %w", err)
+	}
+
+	if req.ETag != "" {
+		httpreq.Header.Set("If-None-Match", req.ETag)
+	}
+	if req.LastModified != "" {
+		httpreq.Header.Set("If-Modified-Since", req.LastModified)
+	}
+	start := time.Now()
+	resp, err := httpClient.Do(httpreq)
+	if err != nil {
+		return response{}, withTimeout(req.URL, start, xerrors.Errorf("Failed to download. err: %w", err))
+	}
+	defer resp.Body.Close()
+
+	res := response{
+		etag:          resp.Header.Get("ETag"),
+		lastModified:  resp.Header.Get("Last-Modified"),
+		contentType:   resp.Header.Get("Content-Type"),
+		contentLength: resp.ContentLength,
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		res.notModified = true
+		res.etag, res.lastModified = req.ETag, req.LastModified
+		return res, nil
+	default:
+		return response{}, &statusError{url: req.URL, code: resp.StatusCode}
+	}
+	if method == http.MethodHead {
+		return res, nil
 	}
 
 	buf := bytes.Buffer{}
-	if _, err := io.Copy(&buf, resp.Body); err != nil {
-		return nil, err
+	p := newProgress(log.FromContext(ctx), &buf, req.URL, resp.ContentLength)
+	if _, err := io.Copy(p, resp.Body); err != nil {
+		if resp.ContentLength >= 0 && xerrors.Is(err, io.ErrUnexpectedEOF) {
+			return response{}, &truncatedError{url: req.URL, expected: resp.ContentLength, actual: int64(buf.Len()), err: err}
+		}
+		return response{}, withTimeout(req.URL, start, xerrors.Errorf("Failed to read response body. err: %w", err))
+	}
+	p.done()
+	if resp.ContentLength >= 0 && int64(buf.Len()) != resp.ContentLength {
+		return response{}, &truncatedError{url: req.URL, expected: resp.ContentLength, actual: int64(buf.Len())}
 	}
+	res.body = buf.Bytes()
+	return res, nil
+}
 
-	var b bytes.Buffer
+func fetchFileConcurrently(ctx context.Context, req FetchRequest, concurrency int) (response, error) {
+	httpClient, err := newHTTPClient(ctx)
+	if err != nil {
+		return response{}, xerrors.Errorf("Failed to create http client. err: %w", err)
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return response{}, xerrors.Errorf("Failed to parse given URL: %w", err)
+	}
+
+	// htcat cannot send conditional requests, so ask with HEAD first. Some mirrors do not support HEAD, then download anyway.
+	res, err := httpDo(ctx, httpClient, http.MethodHead, req)
+	switch {
+	case IsNotFound(err):
+		// htcat does not check the status, so that the error page would be downloaded as the file
+		return response{}, err
+	case err != nil:
+		log.FromContext(ctx).Debug("Failed to HEAD, download without the cache validators", "URL", req.URL, "err", err)
+		res = response{contentLength: -1}
+	}
+	if res.notModified {
+		return res, nil
+	}
+	if unchanged(req, res) {
+		return upToDate(ctx, req), nil
+	}
+
+	v := newChecksumVerifier(ctx, httpClient, req)
+	// htcat takes *http.Client sending the requests without the context, so that they are sent through httpClient with ctx
+	htcClient := &http.Client{Transport: &clientTransport{client: httpClient, ctx: ctx}}
+	bs, err := withRetry(ctx, req.URL, func() ([]byte, error) {
+		buf := bytes.Buffer{}
+		start := time.Now()
+		htc := htcat.New(htcClient, u, concurrency)
+		p := newProgress(log.FromContext(ctx), &buf, req.URL, res.contentLength)
+		if _, err := htc.WriteTo(p); err != nil {
+			return nil, withTimeout(req.URL, start, xerrors.Errorf("Failed to write to output stream: %w", err))
+		}
+		p.done()
+		// htcat does not check the length of the body, compare with Content-Length of HEAD if any
+		if res.contentLength >= 0 && int64(buf.Len()) != res.contentLength {
+			return nil, &truncatedError{url: req.URL, expected: res.contentLength, actual: int64(buf.Len())}
+		}
+		if res.sha256, err = v.verify(buf.Bytes()); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	})
+	if err != nil {
+		return response{}, err
+	}
+	res.raw = bs
+	return decodeBody(req, res)
+}
+
+// unchanged reports whether HEAD of req responded res of the same Last-Modified and Content-Length as the previous fetch,
+// for the mirrors responding 200 to the conditional request of the unchanged file. The file missing either of them is downloaded.
+func unchanged(req FetchRequest, res response) bool {
+	return req.LastModified != "" && req.ContentLength > 0 && res.lastModified == req.LastModified && res.contentLength == req.ContentLength
+}
+
+// upToDate returns the response of the file of req not downloaded as unchanged, with the cache validators of the previous fetch
+func upToDate(ctx context.Context, req FetchRequest) response {
+	log.FromContext(ctx).Debug("The same Last-Modified and Content-Length on HEAD, skip downloading", "URL", req.URL, "LastModified", req.LastModified, "ContentLength", req.ContentLength)
+	return response{notModified: true, upToDate: true, etag: req.ETag, lastModified: req.LastModified, contentLength: req.ContentLength}
+}
+
+// clientTransport sends the requests through client with ctx, for the ones taking *http.Client without the context, e.g. htcat
+type clientTransport struct {
+	client HTTPClient
+	ctx    context.Context
+}
+
+func (t *clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.client.Do(req.WithContext(t.ctx))
+}
+
+func fetchFileWithUA(ctx context.Context, req FetchRequest) (response, error) {
+	httpClient, err := newHTTPClient(ctx)
+	if err != nil {
+		return response{}, xerrors.Errorf("Failed to create http client. err: %w", err)
+	}
+
+	// the mirrors not honoring If-Modified-Since are asked with HEAD whether the file is the same, and it is downloaded anyway if HEAD fails, e.g. of 405
+	if req.LastModified != "" && req.ContentLength > 0 {
+		res, err := httpDo(ctx, httpClient, http.MethodHead, req)
+		switch {
+		case err != nil:
+			log.FromContext(ctx).Debug("Failed to HEAD, download with the cache validators", "URL", req.URL, "err", err)
+		case res.notModified:
+			return res, nil
+		case unchanged(req, res):
+			return upToDate(ctx, req), nil
+		}
+	}
+
+	v := newChecksumVerifier(ctx, httpClient, req)
+	res, err := withRetry(ctx, req.URL, func() (response, error) {
+		res, err := httpDo(ctx, httpClient, http.MethodGet, req)
+		if err != nil || res.notModified {
+			return res, err
+		}
+		if res.sha256, err = v.verify(res.body); err != nil {
+			return response{}, err
+		}
+		return res, nil
+	})
+	if err != nil {
+		return response{}, err
+	}
+	if res.notModified {
+		return res, nil
+	}
+	res.raw = res.body
+	return decodeBody(req, res)
+}
+
+// decodeBody decompresses res.raw downloaded for req into res.body. Without Content-Length, the truncation is detected only here,
+// by the compressed stream or the XML ending unexpectedly, which is returned as *truncatedError.
+func decodeBody(req FetchRequest, res response) (response, error) {
+	body, err := decompress(compression(req, res.contentType), res.raw)
+	if err != nil {
+		if res.contentLength < 0 && xerrors.Is(err, io.ErrUnexpectedEOF) {
+			return response{}, &truncatedError{url: req.URL, expected: -1, actual: int64(len(res.raw)), err: err}
+		}
+		return response{}, err
+	}
+	if res.contentLength < 0 {
+		if err := truncatedXML(body); err != nil {
+			return response{}, &truncatedError{url: req.URL, expected: -1, actual: int64(len(res.raw)), err: err}
+		}
+	}
+	res.body = body
+	return res, nil
+}
+
+// checksumVerifier verifies the downloaded file against the checksum file published next to it.
+// The checksum file is fetched once on the first verification, and the mismatch is returned as a retryable error.
+type checksumVerifier struct {
+	location string
+	enabled  bool
+	fetch    func() string
+	fetched  bool
+	want     string
+}
+
+func newChecksumVerifier(ctx context.Context, httpClient HTTPClient, req FetchRequest) *checksumVerifier {
+	return &checksumVerifier{
+		location: req.URL + ".sha256",
+		enabled:  req.Checksum && !config.FromContext(ctx).SkipChecksum,
+		fetch:    func() string { return fetchChecksum(ctx, httpClient, req.URL+".sha256") },
+	}
+}
+
+// verify returns the SHA-256 of bs if verified, or empty if there is no checksum to verify against
+func (v *checksumVerifier) verify(bs []byte) (string, error) {
+	if !v.enabled {
+		return "", nil
+	}
+	if !v.fetched {
+		v.want = v.fetch()
+		v.fetched = true
+	}
+	if v.want == "" {
+		return "", nil
+	}
+
+	sum := sha256.Sum256(bs)
+	if got := hex.EncodeToString(sum[:]); got != v.want {
+		return "", xerrors.Errorf("Failed to verify checksum. checksum: %s, expected: %s, actual: %s", v.location, v.want, got)
+	}
+	return v.want, nil
+}
+
+// fetchChecksum returns the SHA-256 in the checksum file formatted as sha256sum outputs, or empty if there is no valid checksum file
+func fetchChecksum(ctx context.Context, httpClient HTTPClient, rawURL string) string {
+	res, err := httpDo(ctx, httpClient, http.MethodGet, FetchRequest{URL: rawURL})
+	if err != nil {
+		log.FromContext(ctx).Debug("Failed to fetch the checksum file, skip verifying", "URL", rawURL, "err", err)
+		return ""
+	}
+	return parseChecksum(log.FromContext(ctx), rawURL, res.body)
+}
+
+// parseChecksum returns the SHA-256 in the checksum file formatted as sha256sum outputs, or empty if invalid, logged to logger
+func parseChecksum(logger log15.Logger, location string, bs []byte) string {
+	fields := strings.Fields(string(bs))
+	if len(fields) == 0 {
+		logger.Debug("Empty checksum file, skip verifying", "Location", location)
+		return ""
+	}
+	want := strings.ToLower(fields[0])
+	if sum, err := hex.DecodeString(want); err != nil || len(sum) != sha256.Size {
+		logger.Debug("Invalid checksum file, skip verifying", "Location", location)
+		return ""
+	}
+	return want
+}
+
+// compression returns the MIME type to decompress the fetched file with: the one of the request if compressed, otherwise detected from the URL suffix or the Content-Type
+func compression(req FetchRequest, contentType string) MIMEType {
 	switch req.MIMEType {
+	case MIMETypeBzip2, MIMETypeXz, MIMETypeGzip:
+		return req.MIMEType
+	}
+
+	p := req.URL
+	if u, err := url.Parse(req.URL); err == nil {
+		p = u.Path
+	}
+	switch path.Ext(p) {
+	case ".bz2":
+		return MIMETypeBzip2
+	case ".xz":
+		return MIMETypeXz
+	case ".gz":
+		return MIMETypeGzip
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-bzip2", "application/x-bzip":
+		return MIMETypeBzip2
+	case "application/x-xz":
+		return MIMETypeXz
+	case "application/gzip", "application/x-gzip":
+		return MIMETypeGzip
+	}
+	return req.MIMEType
+}
+
+func decompress(mt MIMEType, bs []byte) ([]byte, error) {
+	var b bytes.Buffer
+	switch mt {
 	case MIMETypeXML, MIMETypeTxt, MIMETypeJSON, MIMETypeYml, MIMETypeHTML:
-		b = buf
+		return bs, nil
 	case MIMETypeBzip2:
-		if _, err := b.ReadFrom(bzip2.NewReader(bytes.NewReader(buf.Bytes()))); err != nil {
-			return nil, xerrors.Errorf("Failed to open bzip2 file. err: %w", err)
+		if _, err := b.ReadFrom(bzip2.NewReader(bytes.NewReader(bs))); err != nil {
+			return nil, &decompressError{mimeType: mt, err: err}
 		}
 	case MIMETypeXz:
-		r, err := xz.NewReader(bytes.NewReader(buf.Bytes()))
+		r, err := xz.NewReader(bytes.NewReader(bs))
 		if err != nil {
-			return nil, xerrors.Errorf("Failed to open xz file. err: %w", err)
+			return nil, &decompressError{mimeType: mt, err: err}
 		}
 		if _, err = b.ReadFrom(r); err != nil {
-			return nil, xerrors.Errorf("Failed to read xz file. err: %w", err)
+			return nil, &decompressError{mimeType: mt, err: err}
 		}
 	case MIMETypeGzip:
-		r, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+		r, err := gzip.NewReader(bytes.NewReader(bs))
 		if err != nil {
-			return nil, xerrors.Errorf("Failed to open gzip file. err: %w", err)
+			return nil, &decompressError{mimeType: mt, err: err}
 		}
 		if _, err = b.ReadFrom(r); err != nil {
-			return nil, xerrors.Errorf("Failed to read gzip file. err: %w", err)
+			return nil, &decompressError{mimeType: mt, err: err}
 		}
 	}
 
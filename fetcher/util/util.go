@@ -1,6 +1,21 @@
 package util
 
-import "regexp"
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+)
 
 // CveIDPattern is regexp matches to `CVE-\d{4}-\d{4,}`
 var CveIDPattern = regexp.MustCompile(`CVE-\d{4}-\d{4,}`)
@@ -20,3 +35,109 @@ func UniqueStrings(s []string) []string {
 	}
 	return uniq
 }
+
+// BaseURL returns the base URL to fetch the files of the fetch subcommand from, ending with "/": "<name>.base-url" of ctx if set, otherwise def
+func BaseURL(ctx context.Context, name, def string) (string, error) {
+	raw := config.FromContext(ctx).BaseURL(name)
+	if raw == "" {
+		return def, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", xerrors.Errorf("Failed to parse base URL. err: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", xerrors.Errorf("Failed to parse base URL. err: not an absolute http(s) URL: %s", raw)
+	}
+	return strings.TrimRight(raw, "/") + "/", nil
+}
+
+// Source returns the names of the fetched files, e.g. rhel-7.oval.xml.bz2 of https://.../rhel-7.oval.xml.bz2, sorted and joined by ", "
+func Source(results ...FetchResult) string {
+	names := make([]string, 0, len(results))
+	for _, r := range results {
+		name := r.URL
+		if u, err := url.Parse(r.URL); err == nil && u.Path != "" {
+			name = u.Path
+		}
+		names = append(names, path.Base(name))
+	}
+	sort.Strings(names)
+	return strings.Join(slices.Compact(names), ", ")
+}
+
+// Digest returns the total size and the SHA-256 of the fetched (decompressed) files.
+// For multiple files, the SHA-256 is calculated over the SHA-256 of each file in the order of URL.
+func Digest(results ...FetchResult) (int64, string) {
+	if len(results) == 0 {
+		return 0, ""
+	}
+	if len(results) == 1 {
+		sum := sha256.Sum256(results[0].Body)
+		return int64(len(results[0].Body)), hex.EncodeToString(sum[:])
+	}
+
+	rs := append([]FetchResult{}, results...)
+	sort.Slice(rs, func(i, j int) bool { return rs[i].URL < rs[j].URL })
+
+	var size int64
+	h := sha256.New()
+	for _, r := range rs {
+		sum := sha256.Sum256(r.Body)
+		h.Write(sum[:])
+		size += int64(len(r.Body))
+	}
+	return size, hex.EncodeToString(h.Sum(nil))
+}
+
+var hrefPattern = regexp.MustCompile(`(?i)href\s*=\s*["']([^"']+)["']`)
+
+// ListIndex fetches the directory listing (index HTML) at rawURL and returns the first submatch of pattern
+// against the base name of each link, e.g. "RHEL8" for <a href="RHEL8/">, in the order of SortVersions
+func ListIndex(ctx context.Context, rawURL string, pattern *regexp.Regexp) ([]string, error) {
+	bs, err := HTTPGet(ctx, rawURL)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get index. url: %s, err: %w", rawURL, err)
+	}
+	return parseIndex(bs, pattern), nil
+}
+
+func parseIndex(bs []byte, pattern *regexp.Regexp) []string {
+	vs := []string{}
+	for _, m := range hrefPattern.FindAllSubmatch(bs, -1) {
+		u, err := url.Parse(string(m[1]))
+		if err != nil {
+			continue
+		}
+		if sm := pattern.FindStringSubmatch(path.Base(strings.TrimSuffix(u.Path, "/"))); len(sm) > 1 {
+			vs = append(vs, sm[1])
+		}
+	}
+	vs = UniqueStrings(vs)
+	SortVersions(vs)
+	return vs
+}
+
+// SortVersions sorts the versions by dot-separated fields, numerically if both are numbers, e.g. 9 < 10 < tumbleweed
+func SortVersions(vs []string) {
+	sort.Slice(vs, func(i, j int) bool {
+		fi, fj := strings.Split(vs[i], "."), strings.Split(vs[j], ".")
+		for k := 0; k < len(fi) && k < len(fj); k++ {
+			if fi[k] == fj[k] {
+				continue
+			}
+			ni, erri := strconv.Atoi(fi[k])
+			nj, errj := strconv.Atoi(fj[k])
+			switch {
+			case erri == nil && errj == nil:
+				return ni < nj
+			case erri == nil || errj == nil:
+				// numbers first
+				return erri == nil
+			default:
+				return fi[k] < fj[k]
+			}
+		}
+		return len(fi) < len(fj)
+	})
+}
@@ -1,10 +1,14 @@
 package util
 
 import (
+	"context"
+	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/viper"
 )
 
 func TestCveIDPattern(t *testing.T) {
@@ -48,3 +52,128 @@ func TestUniqueStrings(t *testing.T) {
 		t.Errorf("(-got +want):\n%s", diff)
 	}
 }
+
+func TestBaseURL(t *testing.T) {
+	const def = "https://www.debian.org/security/oval/"
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "not overridden",
+			want: def,
+		},
+		{
+			name: "trailing slash",
+			in:   "https://mirror.example.com/debian/oval/",
+			want: "https://mirror.example.com/debian/oval/",
+		},
+		{
+			name: "no trailing slash",
+			in:   "http://mirror.example.com/debian/oval",
+			want: "http://mirror.example.com/debian/oval/",
+		},
+		{
+			name: "multiple trailing slashes",
+			in:   "https://mirror.example.com//",
+			want: "https://mirror.example.com/",
+		},
+		{
+			name:    "relative",
+			in:      "mirror.example.com/debian/oval/",
+			wantErr: "not an absolute http(s) URL",
+		},
+		{
+			name:    "not http",
+			in:      "ftp://mirror.example.com/debian/oval/",
+			wantErr: "not an absolute http(s) URL",
+		},
+		{
+			name:    "invalid",
+			in:      "https://mirror.example.com:port/",
+			wantErr: "Failed to parse base URL",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("debian.base-url", tt.in)
+			defer viper.Set("debian.base-url", nil)
+
+			got, err := BaseURL(context.Background(), "debian", def)
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, actual: %v", tt.wantErr, err)
+				}
+			case err != nil:
+				t.Errorf("unexpected error: %s", err)
+			case got != tt.want:
+				t.Errorf("expected: %q, actual: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSortVersions(t *testing.T) {
+	vs := []string{"tumbleweed", "10", "9", "15.10", "15.4", "2023", "15"}
+	SortVersions(vs)
+	if expected := []string{"9", "10", "15", "15.4", "15.10", "2023", "tumbleweed"}; !reflect.DeepEqual(vs, expected) {
+		t.Errorf("expected: %v, actual: %v", expected, vs)
+	}
+}
+
+func TestSource(t *testing.T) {
+	got := Source(
+		FetchResult{URL: "https://security-metadata.canonical.com/oval/com.ubuntu.jammy.usn.oval.xml.bz2?x=1"},
+		FetchResult{URL: "https://www.redhat.com/security/data/oval/v2/RHEL7/rhel-7-including-unpatched.oval.xml.bz2"},
+		FetchResult{URL: "https://www.redhat.com/security/data/oval/v2/RHEL7/rhel-7-including-unpatched.oval.xml.bz2"},
+	)
+	if expected := "com.ubuntu.jammy.usn.oval.xml.bz2, rhel-7-including-unpatched.oval.xml.bz2"; got != expected {
+		t.Errorf("expected: %q, actual: %q", expected, got)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	a := FetchResult{URL: "https://example.com/a.xml", Body: []byte("a")}
+	b := FetchResult{URL: "https://example.com/b.xml", Body: []byte("bb")}
+
+	tests := []struct {
+		name     string
+		in       []FetchResult
+		wantSize int64
+		wantHash string
+	}{
+		{
+			name: "no files",
+		},
+		{
+			name:     "single file",
+			in:       []FetchResult{a},
+			wantSize: 1,
+			wantHash: "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb",
+		},
+		{
+			name:     "multiple files",
+			in:       []FetchResult{a, b},
+			wantSize: 3,
+			wantHash: "a0cdbcdb2d56c941c21f0f5638f4d147e32892f4bb2ace9ca54ba2fd1476053b",
+		},
+		{
+			name:     "multiple files in another order",
+			in:       []FetchResult{b, a},
+			wantSize: 3,
+			wantHash: "a0cdbcdb2d56c941c21f0f5638f4d147e32892f4bb2ace9ca54ba2fd1476053b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, hash := Digest(tt.in...)
+			if size != tt.wantSize || hash != tt.wantHash {
+				t.Errorf("got = (%d, %s), want = (%d, %s)", size, hash, tt.wantSize, tt.wantHash)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package util
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/xerrors"
+)
+
+// ParseError is the error of parsing the fetched XML, located in the file
+type ParseError struct {
+	URL     string
+	Line    int    // 0 if unknown
+	Offset  int64  // byte offset of the error, -1 if unknown
+	Element string // path of the elements enclosing the error, e.g. oval_definitions>definitions>definition
+	HTML    bool   // the body looks like an HTML page, e.g. an error page of the mirror
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	if e.HTML {
+		return fmt.Sprintf("Failed to parse XML. url: %s, err: the response looks like an HTML page, e.g. an error page of the mirror, rather than XML", e.URL)
+	}
+	if e.Offset < 0 {
+		return fmt.Sprintf("Failed to parse XML. url: %s, err: %s", e.URL, e.Err)
+	}
+	return fmt.Sprintf("Failed to parse XML. url: %s, line: %d, offset: %d, element: %s, err: %s", e.URL, e.Line, e.Offset, e.Element, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeXML decodes the XML of the fetched file into v, returning *ParseError on failure.
+// An HTML page is rejected even if well-formed, which would be decoded into v without any definitions.
+func DecodeXML(r FetchResult, v interface{}) error {
+	if looksLikeHTML(r.Body) {
+		return &ParseError{URL: r.URL, Offset: -1, HTML: true, Err: xerrors.New("HTML page")}
+	}
+	d := xml.NewDecoder(bytes.NewReader(r.Body))
+	d.CharsetReader = charset.NewReaderLabel
+	if err := d.Decode(v); err != nil {
+		return NewParseError(r.URL, r.Body, err)
+	}
+	return nil
+}
+
+// NewParseError locates err of decoding body fetched from rawURL, by scanning body again up to the first syntax error
+func NewParseError(rawURL string, body []byte, err error) *ParseError {
+	pe := &ParseError{URL: rawURL, Offset: -1, Err: err}
+	if looksLikeHTML(body) {
+		pe.HTML = true
+		return pe
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.CharsetReader = charset.NewReaderLabel
+	stack := []string{}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			// no syntax error, e.g. a value of the wrong type
+			return pe
+		}
+		if err != nil {
+			var se *xml.SyntaxError
+			if xerrors.As(err, &se) {
+				pe.Line = se.Line
+			}
+			pe.Offset = d.InputOffset()
+			pe.Element = strings.Join(stack, ">")
+			return pe
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// truncatedXML returns the syntax error if body is XML ending unexpectedly, e.g. cut off in the middle of the download, otherwise nil
+// even if malformed elsewhere, which is left to DecodeXML to report
+func truncatedXML(body []byte) error {
+	head := bytes.TrimLeft(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if !bytes.HasPrefix(head, []byte("<")) || looksLikeHTML(body) {
+		return nil
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.CharsetReader = charset.NewReaderLabel
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var se *xml.SyntaxError
+			if xerrors.As(err, &se) && se.Msg == "unexpected EOF" {
+				return err
+			}
+			return nil
+		}
+	}
+}
+
+func looksLikeHTML(body []byte) bool {
+	head := bytes.TrimLeft(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(head) > 64 {
+		head = head[:64]
+	}
+	head = bytes.ToLower(head)
+	return bytes.HasPrefix(head, []byte("<html")) || bytes.HasPrefix(head, []byte("<!doctype html"))
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestDecodeXML(t *testing.T) {
+	type root struct {
+		Definitions []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"definitions>definition"`
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "valid",
+			body:     `<oval_definitions><definitions><definition id="oval:1"/></definitions></oval_definitions>`,
+			expected: "",
+		},
+		{
+			name:     "truncated",
+			body:     "<oval_definitions>\n<definitions>\n<definition id=\"oval:1\"/>\n<definition id=\"oval:2\"><metadata>",
+			expected: "Failed to parse XML. url: https://example.com/oval.xml, line: 4, offset: 93, element: oval_definitions>definitions>definition>metadata, err: XML syntax error on line 4: unexpected EOF",
+		},
+		{
+			name:     "mismatched end element",
+			body:     "<oval_definitions>\n<definitions>\n<definition id=\"oval:1\"></defin>\n</definitions>\n</oval_definitions>",
+			expected: "Failed to parse XML. url: https://example.com/oval.xml, line: 3, offset: 65, element: oval_definitions>definitions>definition, err: XML syntax error on line 3: element <definition> closed by </defin>",
+		},
+		{
+			name:     "HTML error page",
+			body:     "\n<!DOCTYPE html>\n<html><head><title>503 Service Unavailable</title></head><body></body></html>",
+			expected: "Failed to parse XML. url: https://example.com/oval.xml, err: the response looks like an HTML page, e.g. an error page of the mirror, rather than XML",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v root
+			err := DecodeXML(FetchResult{URL: "https://example.com/oval.xml", Body: []byte(tt.body)}, &v)
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("expected: %s\n  actual: %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package goval
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+	yaml "gopkg.in/yaml.v2"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	fetcher "github.com/vulsio/goval-dictionary/fetcher/alpine"
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/alpine"
+)
+
+// loadAlpine fetches the secdb of versions into the DB
+func (l *loader) loadAlpine(ctx context.Context, versions []string) error {
+	if err := l.checkLocalDir(); err != nil {
+		return err
+	}
+
+	results, err := fetcher.FetchFiles(ctx, versions)
+	if err != nil {
+		return xerrors.Errorf("Failed to fetch files. err: %w", err)
+	}
+
+	osVerResults := map[string][]fetcherutil.FetchResult{}
+	for _, r := range results {
+		osVerResults[r.Target] = append(osVerResults[r.Target], r)
+	}
+
+osVers:
+	for _, osVer := range versions {
+		rs, ok := osVerResults[osVer]
+		if !ok {
+			continue
+		}
+		defs := []models.Definition{}
+		for _, r := range rs {
+			// main or community alone is incomplete for the version
+			if r.Err != nil {
+				if err := l.fail(osVer, r.Err); err != nil {
+					return err
+				}
+				continue osVers
+			}
+			var secdb alpine.SecDB
+			if err := yaml.Unmarshal(r.Body, &secdb); err != nil {
+				if err := l.fail(osVer, xerrors.Errorf("Failed to unmarshal. url: %s, err: %w", r.URL, err)); err != nil {
+					return err
+				}
+				continue osVers
+			}
+			converted, stat := alpine.ConvertToModel(&secdb)
+			l.converted(osVer, stat)
+			defs = append(defs, converted...)
+		}
+
+		root := models.Root{
+			Family:      c.Alpine,
+			OSVersion:   osVer,
+			Definitions: defs,
+			Timestamp:   time.Now(),
+		}
+		root.FileSize, root.SHA256 = fetcherutil.Digest(rs...)
+		root.Source = fetcherutil.Source(rs...)
+		if err := l.validateRoot(&root); err != nil {
+			if err := l.fail(osVer, err); err != nil {
+				return err
+			}
+			continue
+		}
+		stat, err := l.db.InsertOval(ctx, &root)
+		if err != nil {
+			return xerrors.Errorf("Failed to insert OVAL. err: %w", err)
+		}
+		l.add(osVer, StatusInserted, root.Definitions, stat)
+	}
+
+	return l.upsertFetchMeta()
+}
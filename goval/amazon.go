@@ -0,0 +1,53 @@
+package goval
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	fetcher "github.com/vulsio/goval-dictionary/fetcher/amazon"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/amazon"
+)
+
+// loadAmazon fetches the ALAS of versions into the DB, converting the advisories issued in Options.IssuedYears
+func (l *loader) loadAmazon(ctx context.Context, versions []string) error {
+	if err := l.checkLocalDir(); err != nil {
+		return err
+	}
+
+	m, err := fetcher.FetchFiles(ctx, versions)
+	if err != nil {
+		return xerrors.Errorf("Failed to fetch files. err: %w", err)
+	}
+	for _, ver := range versions {
+		us, ok := m[ver]
+		if !ok {
+			continue
+		}
+		defs, convertStat := amazon.ConvertToModel(us, l.issuedYears)
+		l.converted(ver, convertStat)
+		root := models.Root{
+			Family:      c.Amazon,
+			OSVersion:   ver,
+			Definitions: defs,
+			Timestamp:   time.Now(),
+		}
+
+		if err := l.validateRoot(&root); err != nil {
+			if err := l.fail(ver, err); err != nil {
+				return err
+			}
+			continue
+		}
+		stat, err := l.db.InsertOval(ctx, &root)
+		if err != nil {
+			return xerrors.Errorf("Failed to insert OVAL. err: %w", err)
+		}
+		l.add(ver, StatusInserted, root.Definitions, stat)
+	}
+
+	return l.upsertFetchMeta()
+}
@@ -0,0 +1,77 @@
+package goval
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	fetcher "github.com/vulsio/goval-dictionary/fetcher/debian"
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/debian"
+)
+
+// loadDebian fetches the OVAL of versions into the DB, or of the published releases by Conf.Debian.All without versions.
+// The file of each version is inserted while the next ones are downloaded and converted.
+func (l *loader) loadDebian(ctx context.Context, versions []string) error {
+	if l.conf.Debian.All {
+		if len(versions) > 0 {
+			l.logger.Info("The versions are given, fetch them instead of the detected ones", "versions", versions)
+		} else {
+			versions = fetcher.DetectVersions(ctx)
+		}
+	}
+
+	validators := l.cacheValidators()
+	download := func(ctx context.Context, send func(convertedFile)) error {
+		submit, wait := convertInOrder(l.parseWorkers(), send)
+		err := fetcher.StreamFiles(ctx, versions, validators, func(r fetcherutil.FetchResult) { submit(func() convertedFile { return l.convertDebian(r) }) })
+		wait()
+		if err != nil {
+			return xerrors.Errorf("Failed to fetch files. err: %w", err)
+		}
+		return nil
+	}
+	insert := func(f convertedFile) error {
+		return l.insertConvertedFile(ctx, f)
+	}
+	if err := pipeline(ctx, download, insert); err != nil {
+		return err
+	}
+	if err := l.pruneSourceFiles(); err != nil {
+		return err
+	}
+
+	return l.upsertFetchMeta()
+}
+
+// convertDebian decodes and converts the fetched file of the version of r.Target
+func (l *loader) convertDebian(r fetcherutil.FetchResult) convertedFile {
+	f := convertedFile{result: r}
+	if r.Err != nil || r.NotModified {
+		return f
+	}
+	ovalroot := debian.Root{}
+	if err := fetcherutil.DecodeXML(r, &ovalroot); err != nil {
+		f.err = err
+		return f
+	}
+	l.logFetched(r.URL[strings.LastIndex(r.URL, "/")+1:], r, len(ovalroot.Definitions.Definitions), ovalroot.Generator.Timestamp)
+
+	defs, stat := debian.ConvertToModel(r.Target, &ovalroot)
+	root := models.Root{
+		Family:      c.Debian,
+		OSVersion:   r.Target,
+		Definitions: defs,
+		Timestamp:   rootTimestamp(r),
+	}
+	root.FileSize, root.SHA256 = fetcherutil.Digest(r)
+	root.Source = fetcherutil.Source(r)
+	if f.source, f.err = l.sourceFile(r); f.err != nil {
+		return f
+	}
+	f.roots, f.stat = []models.Root{root}, stat
+	return f
+}
@@ -0,0 +1,140 @@
+package goval
+
+import (
+	"context"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// dryRunDB is the DB of Conf.DryRun and Conf.NoInsert, which stores nothing and has stored nothing, so that no DB is required
+type dryRunDB struct {
+	logger log15.Logger
+}
+
+var _ db.DB = dryRunDB{}
+
+func (dryRunDB) Name() string { return "dry-run" }
+
+func (dryRunDB) OpenDB(string, string, bool, db.Option) error { return nil }
+
+func (dryRunDB) CloseDB() error { return nil }
+
+func (dryRunDB) Ping() error { return nil }
+
+func (dryRunDB) MigrateDB() error { return nil }
+
+func (dryRunDB) PendingMigrations() ([]db.Migration, error) { return nil, nil }
+
+func (dryRunDB) IsGovalDictModelV1() (bool, error) { return false, nil }
+
+// GetFetchMeta returns the FetchMeta of the empty DB, without the cache validators, so that every file is fetched
+func (dryRunDB) GetFetchMeta() (*models.FetchMeta, error) {
+	return &models.FetchMeta{GovalDictRevision: c.Revision, SchemaVersion: models.LatestSchemaVersion, LastFetchedAt: time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC)}, nil
+}
+
+func (dryRunDB) UpsertFetchMeta(*models.FetchMeta) error { return nil }
+
+func (dryRunDB) StoreSourceFile(*models.FetchFile) error { return nil }
+
+func (dryRunDB) TouchSourceFile(string, time.Time) error { return nil }
+
+func (dryRunDB) GetSourceFile(fileName string) ([]byte, error) {
+	return nil, xerrors.Errorf("Failed to get source file. file: %s, err: %w", fileName, db.ErrNoSourceFile)
+}
+
+func (dryRunDB) PruneSourceFiles(time.Time) (int64, error) { return 0, nil }
+
+func (dryRunDB) GetFetchHistory(context.Context, string, string, time.Time) ([]models.FetchHistory, error) {
+	return nil, nil
+}
+
+func (dryRunDB) GetByPackName(context.Context, string, string, string, string, ...string) ([]models.Definition, error) {
+	return nil, nil
+}
+
+func (dryRunDB) GetByPackNames(context.Context, string, string, []string, string, ...string) (map[string][]models.Definition, error) {
+	return nil, nil
+}
+
+func (dryRunDB) GetByPackNamePage(context.Context, string, string, string, string, db.Page, ...string) ([]models.Definition, int64, error) {
+	return nil, 0, nil
+}
+
+func (dryRunDB) GetByCveIDPage(context.Context, string, string, string, string, db.Page) ([]models.Definition, int64, error) {
+	return nil, 0, nil
+}
+
+func (dryRunDB) GetByCveID(context.Context, string, string, string, string) ([]models.Definition, error) {
+	return nil, nil
+}
+
+func (dryRunDB) GetByAdvisoryID(context.Context, string, string, string, string) ([]models.Definition, error) {
+	return nil, nil
+}
+
+func (dryRunDB) GetByCpe(context.Context, string, string, string, string) ([]models.Definition, error) {
+	return nil, nil
+}
+
+func (dryRunDB) GetPackInfo(context.Context, string, string, string) ([]models.PackInfo, error) {
+	return nil, nil
+}
+
+func (dryRunDB) ListPackages(context.Context, string, string) ([]string, error) {
+	return nil, nil
+}
+
+// InsertOval returns every definition as new, as nothing has been stored
+func (d dryRunDB) InsertOval(_ context.Context, root *models.Root) (models.ChangeStat, error) {
+	d.logger.Info("Dry run, skip inserting", "Family", root.Family, "Version", root.OSVersion, "Definitions", len(root.Definitions))
+	return newChangeStat(root), nil
+}
+
+func (d dryRunDB) MergeOval(_ context.Context, root *models.Root) (models.ChangeStat, error) {
+	d.logger.Info("Dry run, skip merging", "Family", root.Family, "Version", root.OSVersion, "Definitions", len(root.Definitions))
+	return newChangeStat(root), nil
+}
+
+func (d dryRunDB) PurgeOval(_ context.Context, family, osVer string) (models.RootStat, error) {
+	d.logger.Info("Dry run, skip purging", "Family", family, "Version", osVer)
+	return models.RootStat{Family: family, OSVersion: osVer}, nil
+}
+
+func (dryRunDB) CountDefs(string, string) (int, error) { return 0, nil }
+
+func (dryRunDB) IterateDefinitions(context.Context, string, string, func(models.Definition) error) error {
+	return nil
+}
+
+func (dryRunDB) GetRootStats() ([]models.RootStat, error) { return nil, nil }
+
+func (dryRunDB) GetRootTimestamps() ([]models.RootTimestamp, error) { return nil, nil }
+
+func (dryRunDB) GetLastModified(string, string) (time.Time, error) { return time.Time{}, nil }
+
+func (dryRunDB) UpdateLastModified(string, string, time.Time) error { return nil }
+
+func (dryRunDB) CheckStorage(bool) error { return nil }
+
+func (dryRunDB) CheckIntegrity() (db.Report, error) { return db.Report{}, nil }
+
+func (dryRunDB) FixIntegrity() (db.Report, error) { return db.Report{}, nil }
+
+func (dryRunDB) Vacuum() error { return nil }
+
+func (dryRunDB) Optimize() error { return nil }
+
+// newChangeStat counts all the definitions of root as new
+func newChangeStat(root *models.Root) models.ChangeStat {
+	stat := models.ChangeStat{New: len(root.Definitions), NewIDs: make([]string, 0, len(root.Definitions))}
+	for _, d := range root.Definitions {
+		stat.NewIDs = append(stat.NewIDs, d.DefinitionID)
+	}
+	return stat
+}
@@ -0,0 +1,53 @@
+package goval
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	fetcher "github.com/vulsio/goval-dictionary/fetcher/fedora"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/fedora"
+)
+
+// loadFedora fetches the updateinfo of versions into the DB
+func (l *loader) loadFedora(ctx context.Context, versions []string) error {
+	if err := l.checkLocalDir(); err != nil {
+		return err
+	}
+
+	uinfos, err := fetcher.FetchUpdateInfosFedora(ctx, versions)
+	if err != nil {
+		return xerrors.Errorf("Failed to fetch files. err: %w", err)
+	}
+
+	for _, k := range versions {
+		v, ok := uinfos[k]
+		if !ok {
+			continue
+		}
+		defs, convertStat := fedora.ConvertToModel(v)
+		l.converted(k, convertStat)
+		root := models.Root{
+			Family:      c.Fedora,
+			OSVersion:   k,
+			Definitions: defs,
+			Timestamp:   time.Now(),
+		}
+		if err := l.validateRoot(&root); err != nil {
+			if err := l.fail(k, err); err != nil {
+				return err
+			}
+			continue
+		}
+		stat, err := l.db.InsertOval(ctx, &root)
+		if err != nil {
+			return xerrors.Errorf("Failed to insert OVAL. err: %w", err)
+		}
+		l.add(k, StatusInserted, root.Definitions, stat)
+	}
+
+	return nil
+}
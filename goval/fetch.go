@@ -0,0 +1,221 @@
+package goval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// cacheValidators returns the cache validators of the previous fetch to send, or none by Conf.Force to download every file again.
+// Last-Modified more than Conf.MaxClockSkew in the future, e.g. stored by the older versions, is not sent, with a warning recorded in the summary,
+// as the file would be told not modified since then until that time, so that the file is refreshed rather than skipped.
+func (l *loader) cacheValidators() map[string]models.CacheValidator {
+	if l.conf.Force {
+		return nil
+	}
+	validators := make(map[string]models.CacheValidator, len(l.fetchMeta.CacheValidators))
+	now := time.Now()
+	for url, v := range l.fetchMeta.CacheValidators {
+		if t, err := http.ParseTime(v.LastModified); err == nil && l.futureTimestamp(t, now) {
+			l.skewed(url, t, "stored one not sent, refreshing")
+			v.LastModified = ""
+		}
+		validators[url] = v
+	}
+	return validators
+}
+
+// setCacheValidator records the cache validators of the file from which osVers have been inserted, for the next fetch.
+// Last-Modified more than Conf.MaxClockSkew in the future is not recorded, as the file modified until then would be told not modified since it,
+// nor is it clamped to now, as the file of the mirror of the right clock modified before now would be.
+func (l *loader) setCacheValidator(r fetcherutil.FetchResult, osVers []string) {
+	if l.fetchMeta.CacheValidators == nil {
+		l.fetchMeta.CacheValidators = map[string]models.CacheValidator{}
+	}
+	lastModified := r.LastModified
+	if t, err := http.ParseTime(lastModified); err == nil && l.futureTimestamp(t, time.Now()) {
+		l.skewed(r.URL, t, "Last-Modified not recorded")
+		lastModified = ""
+	}
+	if r.ETag == "" && lastModified == "" {
+		delete(l.fetchMeta.CacheValidators, r.URL)
+		return
+	}
+	v := models.CacheValidator{ETag: r.ETag, LastModified: lastModified, OSVersions: osVers}
+	if r.ContentLength > 0 {
+		v.ContentLength = r.ContentLength
+	}
+	l.fetchMeta.CacheValidators[r.URL] = v
+}
+
+// setSHA256 records the SHA-256 of the fetched files verified against the published checksum
+func setSHA256(fetchMeta *models.FetchMeta, results ...fetcherutil.FetchResult) {
+	if fetchMeta.SHA256 == nil {
+		fetchMeta.SHA256 = map[string]string{}
+	}
+	for _, r := range results {
+		switch {
+		case r.NotModified:
+		case r.SHA256 == "":
+			delete(fetchMeta.SHA256, r.URL)
+		default:
+			fetchMeta.SHA256[r.URL] = r.SHA256
+		}
+	}
+}
+
+// setSnapshot records the snapshot of the rolling release of the file of r, whose freshness is tracked by it instead of the version, or forgets it if zero
+func (l *loader) setSnapshot(r fetcherutil.FetchResult, snapshot time.Time) {
+	if snapshot.IsZero() {
+		delete(l.fetchMeta.Snapshots, r.URL)
+		return
+	}
+	if l.fetchMeta.Snapshots == nil {
+		l.fetchMeta.Snapshots = map[string]time.Time{}
+	}
+	l.fetchMeta.Snapshots[r.URL] = l.clampFuture(r.URL, snapshot)
+}
+
+// sourceFile returns the fetched file of r compressed to be stored by Conf.StoreSource once its OS versions are inserted, nil without it.
+// Only the SHA-256 of the file compressed larger than Conf.StoreSourceMaxSize is stored, with a warning.
+func (l *loader) sourceFile(r fetcherutil.FetchResult) (*models.FetchFile, error) {
+	if !l.conf.StoreSource {
+		return nil, nil
+	}
+	f, err := models.NewFetchFile(fetcherutil.SourceFileName(r.URL), r.URL, l.family, r.Body, time.Now())
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to compress source file. err: %w", err)
+	}
+	if limit := l.conf.StoreSourceMaxSize << 20; limit > 0 && int64(len(f.Data)) > limit {
+		l.logger.Warn("The source file is larger than --store-source-max-size, storing only its SHA-256", "File", f.FileName, "Size", len(f.Data), "MaxSize", limit)
+		f.Data = nil
+	}
+	return &f, nil
+}
+
+// storeSourceFiles stores the files of sourceFile, from which osVers have been inserted
+func (l *loader) storeSourceFiles(osVers []string, files ...*models.FetchFile) error {
+	for _, f := range files {
+		if f == nil {
+			continue
+		}
+		f.OSVersions = osVers
+		if err := l.db.StoreSourceFile(f); err != nil {
+			return xerrors.Errorf("Failed to store source file. err: %w", err)
+		}
+		l.logger.Info("Stored the source file", "File", f.FileName, "SHA256", f.SHA256, "Size", f.Size, "Compressed", len(f.Data))
+	}
+	return nil
+}
+
+// pruneSourceFiles deletes the files stored by Conf.StoreSource neither fetched nor found not modified within Conf.StoreSourceRetention
+func (l *loader) pruneSourceFiles() error {
+	retention := l.conf.StoreSourceRetention
+	if !l.conf.StoreSource || retention <= 0 {
+		return nil
+	}
+	n, err := l.db.PruneSourceFiles(time.Now().Add(-retention))
+	if err != nil {
+		return xerrors.Errorf("Failed to prune source files. err: %w", err)
+	}
+	if n > 0 {
+		l.logger.Info("Pruned the source files beyond --store-source-retention", "Count", n, "Retention", retention)
+	}
+	return nil
+}
+
+// skipNotModified only updates the timestamp of the OS versions inserted from the file not modified since the previous fetch,
+// recorded as up to date if told by HEAD rather than by the conditional request
+func (l *loader) skipNotModified(r fetcherutil.FetchResult) error {
+	status := StatusNotModified
+	if r.UpToDate {
+		status = StatusUpToDate
+		l.logger.Info("Up to date, skipping", "URL", r.URL)
+	} else {
+		l.logger.Info("Not modified, skipping", "URL", r.URL)
+	}
+	for _, osVer := range l.fetchMeta.CacheValidators[r.URL].OSVersions {
+		if err := l.db.UpdateLastModified(l.family, osVer, time.Now()); err != nil {
+			return xerrors.Errorf("Failed to update last modified. family: %s, osVer: %s, err: %w", l.family, osVer, err)
+		}
+		l.add(osVer, status, nil, models.ChangeStat{})
+	}
+	if l.conf.StoreSource {
+		if err := l.db.TouchSourceFile(fetcherutil.SourceFileName(r.URL), time.Now()); err != nil {
+			return xerrors.Errorf("Failed to update source file timestamp. err: %w", err)
+		}
+	}
+	return nil
+}
+
+// stripDetails strips the details of the converted Root by Conf.NoDetails before inserting or merging it
+func (l *loader) stripDetails(root *models.Root) {
+	if l.conf.NoDetails {
+		root.StripDetails()
+	}
+}
+
+// validateRoot strips the details of the converted Root by Conf.NoDetails, and validates it before inserting it,
+// recording the digest of the binary and the options it was converted by
+func (l *loader) validateRoot(root *models.Root) error {
+	l.stripDetails(root)
+	root.ConvertDigest = l.convertDigest()
+	opt := models.ValidateOption{
+		MinDefinitions: l.conf.MinDefinitions,
+		NoDetails:      l.conf.NoDetails,
+	}
+	if l.conf.ForceEmpty {
+		opt.MinDefinitions = 0
+	}
+	if err := root.Validate(opt); err != nil {
+		l.logger.Error("Failed to validate OVAL", "Family", root.Family, "Version", root.OSVersion, "Definitions", len(root.Definitions), "err", err)
+		return err
+	}
+	return nil
+}
+
+// convertDigest returns the digest of the revision of the binary and the options converting the OVAL, Options.IssuedYears and Conf.NoDetails,
+// of which the same files converted otherwise, e.g. all the years after --issued-years 2023, are refreshed rather than skipped as unchanged
+func (l *loader) convertDigest() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		config.Version,
+		config.Revision,
+		fmt.Sprintf("issued-years=%d-%d", l.issuedYears.From, l.issuedYears.To),
+		fmt.Sprintf("no-details=%t", l.conf.NoDetails),
+	}, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkLocalDir rejects Conf.LocalDir and Conf.DownloadDir for the families whose files cannot be identified by their names, e.g. the same main.yaml for every Alpine version
+func (l *loader) checkLocalDir() error {
+	if l.conf.LocalDir != "" {
+		return xerrors.Errorf("--local-dir is not supported for %s", l.family)
+	}
+	if l.conf.DownloadDir != "" {
+		return xerrors.Errorf("--download-dir is not supported for %s", l.family)
+	}
+	return nil
+}
+
+// rootTimestamp returns the latest modification time of the files read from Conf.LocalDir, or the current time if downloaded
+func rootTimestamp(results ...fetcherutil.FetchResult) time.Time {
+	var ts time.Time
+	for _, r := range results {
+		if r.ModTime.After(ts) {
+			ts = r.ModTime
+		}
+	}
+	if ts.IsZero() {
+		return time.Now()
+	}
+	return ts
+}
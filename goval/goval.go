@@ -0,0 +1,236 @@
+// Package goval loads the OVAL of a family into DB and looks it up as the fetch and select subcommands do, for the programs embedding
+// goval-dictionary without its CLI. Load neither sets nor reads the global viper, the configuration is of Options.Conf, and neither sets
+// the handlers of the root logger of log15. The lines of the load, of the fetchers and of the inserts into DB, are logged to Options.Logger,
+// while some lines of the packages below still go to the root logger: the warnings of the converters of models, e.g. of the definitions
+// without ID and of the dates failed to parse, and "Filtered by the issued year" of amazon and oracle, and the lines of DB outside the load,
+// e.g. of opening, locking and closing it, and of the lookups of Query of the release not loaded.
+package goval
+
+import (
+	"context"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/log"
+	"github.com/vulsio/goval-dictionary/models"
+	modelsutil "github.com/vulsio/goval-dictionary/models/util"
+)
+
+// the defaults of --batch-size and --threads, of Options.Conf of BatchSize and Threads less than 1
+const (
+	defaultBatchSize = 25
+	defaultThreads   = 3
+)
+
+// Options is the option of Load
+type Options struct {
+	// Family is the family to load, normalized by config.NormalizeFamily, e.g. redhat of rhel, or the type of SUSE, e.g. suse.linux.enterprise.server.
+	// openSUSE Tumbleweed is of opensuse and its version tumbleweed.
+	Family string
+	// Versions are the versions to load, e.g. 8 and 9 of redhat, required unless Conf.Debian.All detects the published releases of debian
+	Versions []string
+	// DB is the DB to insert into, which Load checks and migrates as the fetch subcommands do, but neither locks nor closes.
+	// It is not used by Conf.DryRun or Conf.NoInsert, which insert nothing, and may be nil then.
+	DB db.DB
+	// Logger is the logger of the lines of the load, e.g. of the fetchers and of the inserts into DB, discarded if nil.
+	// The warnings of the converters of models still go to the root logger of log15, see the package doc.
+	Logger log15.Logger
+	// Conf is the configuration of the fetch as the flags of the fetch subcommands, e.g. Threads, LocalDir and BaseURL of the family sections.
+	// BatchSize less than 1 is 25 and Threads less than 1 is 3, as the flags, while RunTimeout is of the caller bounding ctx.
+	Conf config.Conf
+	// IssuedYears is the range of the years of the advisories of amazon and oracle to convert, unbounded if zero
+	IssuedYears modelsutil.YearRange
+}
+
+// Load fetches the OVAL of opts.Family and opts.Versions, converts it and inserts it into opts.DB, returning the summary of the versions finished.
+// The version failed is recorded in the summary to continue with the others, unless Conf.FailFast or ctx is done, which stops the load with the error.
+// The summary of the versions finished before is returned with the error as well.
+func Load(ctx context.Context, opts Options) (Summary, error) {
+	family, err := config.NormalizeFamily(opts.Family)
+	if err != nil {
+		return Summary{Family: opts.Family}, xerrors.Errorf("Failed to load. err: %w", err)
+	}
+	summary := Summary{Family: family}
+
+	l, err := newLoader(family, opts, &summary)
+	if err != nil {
+		return summary, err
+	}
+	ctx = config.NewContext(ctx, l.conf)
+	ctx = log.WithLogger(ctx, l.logger)
+	ctx = log.NewContext(ctx, log.Fields{"Family": family})
+
+	var load func(context.Context, []string) error
+	switch family {
+	case config.Alpine:
+		load = l.loadAlpine
+	case config.Amazon:
+		load = l.loadAmazon
+	case config.Debian:
+		load = l.loadDebian
+	case config.Fedora:
+		load = l.loadFedora
+	case config.Oracle:
+		load = l.loadOracle
+	case config.RedHat:
+		load = l.loadRedHat
+	case config.OpenSUSE, config.OpenSUSELeap, config.SUSEEnterpriseServer, config.SUSEEnterpriseDesktop:
+		load = l.loadSUSE
+	case config.Ubuntu:
+		load = l.loadUbuntu
+	default:
+		return summary, xerrors.Errorf("Failed to load. err: the OVAL of %s is not fetched by itself", family)
+	}
+	if len(opts.Versions) == 0 && !(family == config.Debian && l.conf.Debian.All) {
+		return summary, xerrors.Errorf("Failed to load %s. err: no versions to load", family)
+	}
+
+	if err := l.openDB(); err != nil {
+		return summary, err
+	}
+	if err := load(ctx, opts.Versions); err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// OpenDB returns the DB to insert the OVAL into as Load does, e.g. the OVAL exported by the export subcommand: opts.DB checked and migrated,
+// or the one discarding the OVAL by Conf.DryRun or Conf.NoInsert, with its FetchMeta to upsert once inserted
+func OpenDB(opts Options) (db.DB, *models.FetchMeta, error) {
+	l, err := newLoader(opts.Family, opts, &Summary{Family: opts.Family})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := l.openDB(); err != nil {
+		return nil, nil, err
+	}
+	return l.db, l.fetchMeta, nil
+}
+
+// Validate validates root before inserting it as Load does, stripping its details by Conf.NoDetails
+func Validate(root *models.Root, opts Options) error {
+	l, err := newLoader(root.Family, Options{DB: dryRunDB{}, Logger: opts.Logger, Conf: opts.Conf}, &Summary{Family: root.Family})
+	if err != nil {
+		return err
+	}
+	return l.validateRoot(root)
+}
+
+// loader loads the OVAL of a family into driver, recording the result of each version in summary
+type loader struct {
+	family string
+	conf   config.Conf
+	// logger is of the lines without the fields of the family, as the lines of the summary tell it themselves
+	logger      log15.Logger
+	db          db.DB
+	fetchMeta   *models.FetchMeta
+	issuedYears modelsutil.YearRange
+	summary     *Summary
+}
+
+func newLoader(family string, opts Options, summary *Summary) (*loader, error) {
+	l := &loader{family: family, conf: opts.Conf, logger: opts.Logger, db: opts.DB, issuedYears: opts.IssuedYears, summary: summary}
+	if l.logger == nil {
+		l.logger = log15.New()
+		l.logger.SetHandler(log15.DiscardHandler())
+	}
+	if l.conf.BatchSize < 1 {
+		l.conf.BatchSize = defaultBatchSize
+	}
+	// not one download of each file at once, which the fetchers make of Threads less than 1
+	if l.conf.Threads < 1 {
+		l.conf.Threads = defaultThreads
+	}
+	if l.conf.DryRun || l.conf.NoInsert {
+		l.db = dryRunDB{logger: l.logger}
+	}
+	if l.db == nil {
+		return nil, xerrors.New("Failed to load. err: no DB to insert into, set Options.DB unless Conf.DryRun or Conf.NoInsert")
+	}
+	return l, nil
+}
+
+// openDB checks and migrates the DB before the load, and reads its FetchMeta
+func (l *loader) openDB() error {
+	if err := checkFetchDB(l.db, l.conf.IntegrityCheck); err != nil {
+		return err
+	}
+	if err := l.migrateDB(); err != nil {
+		return err
+	}
+
+	fetchMeta, err := l.db.GetFetchMeta()
+	if err != nil {
+		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+	}
+	if fetchMeta.OutDated() {
+		return xerrors.Errorf("Failed to Insert CVEs into DB. SchemaVersion is old. SchemaVersion: %+v", map[string]uint{"latest": models.LatestSchemaVersion, "DB": fetchMeta.SchemaVersion})
+	}
+	// If the fetch fails the first time (without SchemaVersion), the DB needs to be cleaned every time, so insert SchemaVersion.
+	if err := l.db.UpsertFetchMeta(fetchMeta); err != nil {
+		return xerrors.Errorf("Failed to upsert FetchMeta to DB. err: %w", err)
+	}
+	l.fetchMeta = fetchMeta
+	return nil
+}
+
+// checkFetchDB checks the storage of the DB before the fetch deletes and inserts the OVAL, which would make the corrupted DB worse,
+// e.g. the sqlite3 file of the full disk: by PRAGMA quick_check of mode quick, the default, or integrity_check of full, and not at all of none.
+// MySQL and PostgreSQL are pinged and SELECTed from instead.
+func checkFetchDB(driver db.DB, mode string) error {
+	switch mode {
+	case "", "quick", "full":
+	case "none":
+		return nil
+	default:
+		return xerrors.Errorf("Unknown integrity check: %s. Available integrity check: quick, full, none", mode)
+	}
+	if err := driver.CheckStorage(mode == "full"); err != nil {
+		if xerrors.Is(err, db.ErrCorrupted) {
+			return xerrors.Errorf("Failed to check DB before fetching. Restore DB from the backup, or remove it and fetch all the families again to rebuild it. err: %w", err)
+		}
+		return xerrors.Errorf("Failed to check DB before fetching. err: %w", err)
+	}
+	return nil
+}
+
+// migrateDB migrates the DB before the fetch. The changes of the existing tables, which may take long on the big DB,
+// are refused without Conf.AutoMigrate, to be applied by the migrate subcommand instead, while the new tables are created anyway.
+func (l *loader) migrateDB() error {
+	pending, err := l.db.PendingMigrations()
+	if err != nil {
+		return xerrors.Errorf("Failed to get pending migrations. err: %w", err)
+	}
+	alters := 0
+	for _, m := range pending {
+		if m.Alter {
+			alters++
+		}
+	}
+	if alters > 0 {
+		if !l.conf.AutoMigrate {
+			return xerrors.Errorf("Failed to migrate DB. %d migrations of the existing tables are pending, apply them by `goval-dictionary migrate --apply` first, or fetch with --auto-migrate", alters)
+		}
+		l.logger.Info("Applying the pending migrations", "migrations", alters)
+	}
+	if err := l.db.MigrateDB(); err != nil {
+		if xerrors.Is(err, db.ErrDBLocked) {
+			return xerrors.Errorf("Failed to migrate DB. Close DB connection before fetching. err: %w", err)
+		}
+		return xerrors.Errorf("Failed to migrate DB. err: %w", err)
+	}
+	return nil
+}
+
+// upsertFetchMeta records the end of the fetch with the cache validators and the checksums of the fetched files in the FetchMeta
+func (l *loader) upsertFetchMeta() error {
+	l.fetchMeta.LastFetchedAt = time.Now()
+	if err := l.db.UpsertFetchMeta(l.fetchMeta); err != nil {
+		return xerrors.Errorf("Failed to upsert FetchMeta to DB. err: %w", err)
+	}
+	return nil
+}
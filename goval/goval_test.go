@@ -0,0 +1,216 @@
+package goval
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/internal/testutil"
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+	modelsutil "github.com/vulsio/goval-dictionary/models/util"
+)
+
+// newSUSEMirror serves the OVAL of SUSE Linux Enterprise Server 15 uncompressed, without the gzip'd one nor the checksum file
+func newSUSEMirror(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	oval := testutil.File(t, "suse.linux.enterprise.server.15.xml")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/suse.linux.enterprise.server.15.xml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(oval)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestLoadQuery(t *testing.T) {
+	ts := newSUSEMirror(t)
+	driver := testdb.New(t)
+	ctx := context.Background()
+
+	conf := config.Conf{Threads: 1, Retry: 1}
+	conf.SUSE.BaseURL = ts.URL + "/"
+	summary, err := Load(ctx, Options{Family: config.SUSEEnterpriseServer, Versions: []string{"15"}, DB: driver, Conf: conf})
+	if err != nil {
+		t.Fatalf("Failed to Load. err: %s", err)
+	}
+	if summary.Failed() > 0 {
+		t.Fatalf("expected: no failed versions, actual: %+v", summary)
+	}
+	statuses := map[string]string{}
+	for _, v := range summary.Versions {
+		statuses[v.Version] = v.Status
+	}
+	if statuses["15.4"] != StatusInserted || statuses["15.5"] != StatusInserted {
+		t.Errorf("expected: 15.4 and 15.5 inserted, actual: %+v", statuses)
+	}
+
+	tests := []struct {
+		name string
+		opts QueryOptions
+		want []string
+	}{
+		{
+			name: "by package",
+			opts: QueryOptions{Release: "15.5", By: ByPackage, Arg: "libopenssl3"},
+			want: []string{"oval:org.opensuse.security:def:20232650"},
+		},
+		{
+			name: "by cveid",
+			opts: QueryOptions{Release: "15.4", By: ByCveID, Arg: "CVE-2023-2650"},
+			want: []string{"oval:org.opensuse.security:def:20232650"},
+		},
+		{
+			name: "nothing affected",
+			opts: QueryOptions{Release: "15.4", By: ByCveID, Arg: "CVE-2023-3090"},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.DB = driver
+			tt.opts.Family = config.SUSEEnterpriseServer
+			defs, err := Query(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to Query. err: %s", err)
+			}
+			ids := []string{}
+			for _, d := range defs {
+				ids = append(ids, d.DefinitionID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected: %q, actual: %q", tt.want, ids)
+			}
+		})
+	}
+
+	if _, err := Query(ctx, QueryOptions{DB: driver, Family: config.SUSEEnterpriseServer, Release: "12", By: ByPackage, Arg: "libopenssl3"}); !xerrors.Is(err, db.ErrNoSuchRelease) {
+		t.Errorf("expected: ErrNoSuchRelease of the release not loaded, actual: %v", err)
+	}
+}
+
+func TestLoadConvertOptions(t *testing.T) {
+	ts := newSUSEMirror(t)
+	driver := testdb.New(t)
+	ctx := context.Background()
+
+	load := func(noDetails bool) Summary {
+		t.Helper()
+		conf := config.Conf{Threads: 1, Retry: 1, NoDetails: noDetails}
+		conf.SUSE.BaseURL = ts.URL + "/"
+		summary, err := Load(ctx, Options{Family: config.SUSEEnterpriseServer, Versions: []string{"15"}, DB: driver, Conf: conf})
+		if err != nil {
+			t.Fatalf("Failed to Load. err: %s", err)
+		}
+		if summary.Failed() > 0 {
+			t.Fatalf("expected: no failed versions, actual: %+v", summary)
+		}
+		return summary
+	}
+	updated := func(s Summary) int {
+		n := 0
+		for _, v := range s.Versions {
+			n += v.Change.Updated
+		}
+		return n
+	}
+
+	load(false)
+	if s := load(false); updated(s) != 0 {
+		t.Errorf("expected: the same file by the same options skipped, actual: %+v", s.Versions)
+	}
+	// the same file converted by another option is refreshed, rather than skipped as unchanged
+	if s := load(true); updated(s) == 0 {
+		t.Errorf("expected: the same file by --no-details refreshed, actual: %+v", s.Versions)
+	}
+}
+
+func TestConvertDigest(t *testing.T) {
+	digest := func(years modelsutil.YearRange, noDetails bool) string {
+		return (&loader{conf: config.Conf{NoDetails: noDetails}, issuedYears: years}).convertDigest()
+	}
+	all := digest(modelsutil.YearRange{}, false)
+	if all != digest(modelsutil.YearRange{}, false) {
+		t.Errorf("expected: the same digest of the same options")
+	}
+	for name, d := range map[string]string{
+		"--issued-years 2023":  digest(modelsutil.YearRange{From: 2023, To: 2023}, false),
+		"--issued-years 2023-": digest(modelsutil.YearRange{From: 2023}, false),
+		"--no-details":         digest(modelsutil.YearRange{}, true),
+	} {
+		if d == all {
+			t.Errorf("%s: expected: the digest other than the one of the default options", name)
+		}
+	}
+}
+
+func TestLoadDryRun(t *testing.T) {
+	ts := newSUSEMirror(t)
+
+	conf := config.Conf{Threads: 1, Retry: 1, DryRun: true}
+	conf.SUSE.BaseURL = ts.URL + "/"
+	summary, err := Load(context.Background(), Options{Family: config.SUSEEnterpriseServer, Versions: []string{"15"}, Conf: conf})
+	if err != nil {
+		t.Fatalf("Failed to Load. err: %s", err)
+	}
+	if len(summary.Versions) != 2 || summary.Failed() > 0 {
+		t.Errorf("expected: 15.4 and 15.5 converted, actual: %+v", summary)
+	}
+}
+
+func TestLoadErr(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "unknown family",
+			opts: Options{Family: "windows", Versions: []string{"11"}, DB: testdb.New(t)},
+			want: "Failed to load.",
+		},
+		{
+			name: "no versions",
+			opts: Options{Family: config.RedHat, DB: testdb.New(t)},
+			want: "no versions to load",
+		},
+		{
+			name: "no DB",
+			opts: Options{Family: config.RedHat, Versions: []string{"9"}},
+			want: "no DB to insert into",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(context.Background(), tt.opts); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected: the error of %q, actual: %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestNewLoaderDefaults(t *testing.T) {
+	l, err := newLoader(config.RedHat, Options{Conf: config.Conf{DryRun: true}}, &Summary{Family: config.RedHat})
+	if err != nil {
+		t.Fatalf("Failed to newLoader. err: %s", err)
+	}
+	if l.conf.BatchSize != defaultBatchSize || l.conf.Threads != defaultThreads {
+		t.Errorf("expected: the batch size of %d and the threads of %d, actual: %d and %d", defaultBatchSize, defaultThreads, l.conf.BatchSize, l.conf.Threads)
+	}
+}
+
+func TestQueryArch(t *testing.T) {
+	_, err := Query(context.Background(), QueryOptions{DB: testdb.New(t), Family: config.Debian, Release: "12", By: ByPackage, Arg: "curl", Arch: "x86_64"})
+	if err == nil || !strings.Contains(err.Error(), "cannot use the Architecture argument") {
+		t.Errorf("expected: the error of the architecture of debian, actual: %v", err)
+	}
+}
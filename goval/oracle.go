@@ -0,0 +1,132 @@
+package goval
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	fetcher "github.com/vulsio/goval-dictionary/fetcher/oracle"
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/oracle"
+)
+
+// loadOracle fetches the OVAL of versions into the DB, converting the advisories issued in Options.IssuedYears,
+// or merges the OVAL of Conf.Years into the stored one
+func (l *loader) loadOracle(ctx context.Context, versions []string) error {
+	validators := l.cacheValidators()
+	if !l.issuedYears.IsZero() {
+		// the stored OVAL may have been converted with another range, then the file is converted again to refresh it
+		validators = nil
+	}
+	years := l.conf.Years
+	results, err := fetcher.FetchFiles(ctx, versions, years, validators)
+	if err != nil {
+		return xerrors.Errorf("Failed to fetch files. err: %w", err)
+	}
+
+	osVerDefs := map[string][]models.Definition{}
+	parsed := []fetcherutil.FetchResult{}
+	for _, r := range results {
+		// the OVAL of all the versions is in one file, reported by the file name
+		name := r.URL[strings.LastIndex(r.URL, "/")+1:]
+		if r.Err != nil {
+			if err := l.fail(name, r.Err); err != nil {
+				return err
+			}
+			continue
+		}
+		if r.NotModified {
+			if err := l.skipNotModified(r); err != nil {
+				return xerrors.Errorf("Failed to skip not modified OVAL. err: %w", err)
+			}
+			continue
+		}
+		ovalroot := oracle.Root{}
+		if err := fetcherutil.DecodeXML(r, &ovalroot); err != nil {
+			if err := l.fail(name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		parsed = append(parsed, r)
+		l.logFetched(name, r, len(ovalroot.Definitions.Definitions), ovalroot.Generator.Timestamp)
+
+		converted, convertStat := oracle.ConvertToModel(&ovalroot, l.issuedYears)
+		l.converted(name, convertStat)
+		for osVer, defs := range converted {
+			if slices.Contains(versions, osVer) {
+				osVerDefs[osVer] = append(osVerDefs[osVer], defs...)
+			}
+		}
+	}
+
+	// loaded are the versions inserted or merged, from which the files are stored by Conf.StoreSource
+	inserted, loaded := []string{}, []string{}
+	for osVer, defs := range osVerDefs {
+		root := models.Root{
+			Family:      c.Oracle,
+			OSVersion:   osVer,
+			Definitions: defs,
+			Timestamp:   rootTimestamp(parsed...),
+		}
+		root.Timestamp = l.clampFuture(parsed[0].URL, root.Timestamp)
+
+		if len(years) > 0 {
+			// the OVAL of some years is merged into the stored one, which keeps the definitions of the other years
+			l.stripDetails(&root)
+			stat, err := l.db.MergeOval(ctx, &root)
+			if err != nil {
+				return xerrors.Errorf("Failed to merge OVAL. err: %w", err)
+			}
+			l.add(osVer, StatusMerged, root.Definitions, stat)
+			loaded = append(loaded, osVer)
+			continue
+		}
+
+		root.FileSize, root.SHA256 = fetcherutil.Digest(parsed...)
+		root.Source = fetcherutil.Source(parsed...)
+		if err := l.validateRoot(&root); err != nil {
+			if err := l.fail(osVer, err); err != nil {
+				return err
+			}
+			continue
+		}
+		stat, err := l.db.InsertOval(ctx, &root)
+		if err != nil {
+			return xerrors.Errorf("Failed to insert OVAL. err: %w", err)
+		}
+		l.add(osVer, StatusInserted, root.Definitions, stat)
+		inserted, loaded = append(inserted, osVer), append(loaded, osVer)
+	}
+	if len(loaded) > 0 {
+		slices.Sort(loaded)
+		for _, r := range parsed {
+			source, err := l.sourceFile(r)
+			if err != nil {
+				return err
+			}
+			if err := l.storeSourceFiles(loaded, source); err != nil {
+				return err
+			}
+		}
+	}
+	// the files failed to parse are fetched again next time, and so are the versions failed to validate
+	for _, r := range parsed {
+		if !l.issuedYears.IsZero() {
+			// nor is the OVAL converted with the range skipped by the next fetch, which may be with another range
+			l.setCacheValidator(r, nil)
+			continue
+		}
+		l.setCacheValidator(r, inserted)
+	}
+	setSHA256(l.fetchMeta, parsed...)
+	if err := l.pruneSourceFiles(); err != nil {
+		return err
+	}
+
+	return l.upsertFetchMeta()
+}
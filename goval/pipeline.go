@@ -0,0 +1,154 @@
+package goval
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/util"
+)
+
+// pipeline overlaps the downloads of a fetch with the inserts into DB. download fetches and converts the files one after another in its own goroutine,
+// passing each converted one to send, while insert is called with them in the same order in the calling goroutine, so that the writes to DB stay
+// serialized as sqlite3 requires. send blocks until insert takes the previous one, which caps the converted files held at two: the one being
+// inserted and the next one. Once insert fails, ctx of download is cancelled and the rest are drained without inserting them.
+func pipeline[T any](ctx context.Context, download func(ctx context.Context, send func(T)) error, insert func(T) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan T)
+	var downloadErr error
+	go func() {
+		defer close(ch)
+		downloadErr = download(ctx, func(t T) { ch <- t })
+	}()
+
+	var err error
+	for t := range ch {
+		if err != nil {
+			continue
+		}
+		if err = insert(t); err != nil {
+			cancel()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// read after ch is closed by the goroutine
+	return downloadErr
+}
+
+// parseWorkers returns the number of the files decoded and converted at a time by Conf.ParseWorkers, GOMAXPROCS if 0
+func (l *loader) parseWorkers() int {
+	if n := l.conf.ParseWorkers; n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// convertInOrder runs the conversions submitted on up to workers goroutines at once, e.g. decoding the XML of the fetched files on the other cores
+// while the next ones are downloaded, and passes their results to send in the order they are submitted, so that the files are inserted in the order
+// of the versions however long each takes. submit blocks while workers conversions are in progress or waiting for send, which caps the files held,
+// and wait returns once all the submitted ones are sent. workers of 1 or less converts them one after another in submit.
+func convertInOrder[T any](workers int, send func(T)) (submit func(convert func() T), wait func()) {
+	if workers <= 1 {
+		return func(convert func() T) { send(convert()) }, func() {}
+	}
+
+	slots := make(chan struct{}, workers)
+	queue := make(chan chan T, workers)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for res := range queue {
+			send(<-res)
+			<-slots
+		}
+	}()
+	submit = func(convert func() T) {
+		slots <- struct{}{}
+		res := make(chan T, 1)
+		queue <- res
+		go func() { res <- convert() }()
+	}
+	wait = func() {
+		close(queue)
+		<-done
+	}
+	return submit, wait
+}
+
+// convertedFile is a file fetched and converted by the download stage of pipeline, to be inserted by its insert stage
+type convertedFile struct {
+	result   fetcherutil.FetchResult
+	roots    []models.Root      // the OVAL of each OS version in the file, none if not modified or failed
+	stat     models.ConvertStat // the stat of the conversion of the file
+	source   *models.FetchFile  // the file to store by Conf.StoreSource, nil without it
+	snapshot time.Time          // the snapshot of the rolling release of the file, e.g. openSUSE Tumbleweed, zero for the others
+	err      error              // the error of decoding or converting the file, failing result.Target
+}
+
+// insertConvertedFile is the insert stage of pipeline for the files of the OVAL of one or more OS versions of the family,
+// recording the result of each OS version, or of result.Target if the file failed, in the summary
+func (l *loader) insertConvertedFile(ctx context.Context, f convertedFile) error {
+	r := f.result
+	switch {
+	case r.Err != nil:
+		return l.fail(r.Target, r.Err)
+	case r.NotModified:
+		if err := l.skipNotModified(r); err != nil {
+			return xerrors.Errorf("Failed to skip not modified OVAL. err: %w", err)
+		}
+		return nil
+	case f.err != nil:
+		return l.fail(r.Target, f.err)
+	}
+	l.converted(r.Target, f.stat)
+
+	inserted := []string{}
+	for _, root := range f.roots {
+		root := root
+		root.Timestamp = l.clampFuture(r.URL, root.Timestamp)
+		if err := l.validateRoot(&root); err != nil {
+			if err := l.fail(root.OSVersion, err); err != nil {
+				return err
+			}
+			continue
+		}
+		stat, err := l.db.InsertOval(ctx, &root)
+		if err != nil {
+			return xerrors.Errorf("Failed to insert OVAL. err: %w", err)
+		}
+		l.add(root.OSVersion, StatusInserted, root.Definitions, stat)
+		inserted = append(inserted, root.OSVersion)
+	}
+	// nothing is recorded for the file of which no OS version has been inserted, fetched again next time
+	if len(inserted) == 0 {
+		return nil
+	}
+	if err := l.storeSourceFiles(inserted, f.source); err != nil {
+		return err
+	}
+	l.setCacheValidator(r, inserted)
+	setSHA256(l.fetchMeta, r)
+	l.setSnapshot(r, f.snapshot)
+	return nil
+}
+
+// logFetched logs the count of the definitions and the timestamp of the OVAL fetched as the file of name, warning if it has not been updated for 3 days
+func (l *loader) logFetched(name string, r fetcherutil.FetchResult, count int, timestamp string) {
+	l.logger.Info("Fetched", "File", name, "Count", count, "Timestamp", timestamp)
+	ts, err := util.ParseOvalTimestamp(timestamp)
+	if err != nil {
+		l.logger.Warn("Failed to parse timestamp, use the current time instead.", "OVAL", r.URL, "Timestamp", timestamp, "err", err)
+		ts = time.Now()
+	}
+	if ts.Before(time.Now().AddDate(0, 0, -3)) {
+		l.logger.Warn("The fetched OVAL has not been updated for 3 days, the OVAL URL may have changed, please register a GitHub issue.", "GitHub", "https://github.com/vulsio/goval-dictionary/issues", "OVAL", r.URL, "Timestamp", timestamp)
+	}
+}
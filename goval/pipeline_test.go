@@ -0,0 +1,213 @@
+package goval
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/internal/testutil"
+)
+
+func TestPipeline(t *testing.T) {
+	// each file takes as long to download and convert as to insert
+	const (
+		files = 4
+		delay = 100 * time.Millisecond
+	)
+	type span struct{ start, end time.Time }
+	downloads, inserts := make([]span, files), make([]span, files)
+	download := func(ctx context.Context, send func(int)) error {
+		for i := 0; i < files; i++ {
+			downloads[i].start = time.Now()
+			time.Sleep(delay)
+			downloads[i].end = time.Now()
+			send(i)
+		}
+		return nil
+	}
+	inserted := []int{}
+	insert := func(i int) error {
+		inserts[i].start = time.Now()
+		time.Sleep(delay)
+		inserts[i].end = time.Now()
+		inserted = append(inserted, i)
+		return nil
+	}
+
+	start := time.Now()
+	if err := pipeline(context.Background(), download, insert); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	elapsed := time.Since(start)
+
+	if want := []int{0, 1, 2, 3}; !reflect.DeepEqual(inserted, want) {
+		t.Errorf("expected: %v, actual: %v", want, inserted)
+	}
+	// the next file is downloaded while the previous one is inserted
+	for i := 0; i < files-1; i++ {
+		if d, in := downloads[i+1], inserts[i]; !d.start.Before(in.end) || !in.start.Before(d.end) {
+			t.Errorf("expected: the download of %d overlapped with the insert of %d, actual: %+v, %+v", i+1, i, d, in)
+		}
+	}
+	// about (files+1)*delay instead of 2*files*delay one after another
+	sequential := 2 * files * delay
+	if elapsed >= sequential-delay {
+		t.Errorf("expected: shorter than %s of the sequential run, actual: %s", sequential, elapsed)
+	}
+	t.Logf("pipelined: %s, sequential: %s", elapsed.Round(time.Millisecond), sequential)
+}
+
+func TestPipelineError(t *testing.T) {
+	var sent, cancelled int32
+	download := func(ctx context.Context, send func(int)) error {
+		for i := 0; i < 5; i++ {
+			if ctx.Err() != nil {
+				atomic.AddInt32(&cancelled, 1)
+			}
+			send(i)
+			atomic.AddInt32(&sent, 1)
+		}
+		return nil
+	}
+	inserted := []int{}
+	insert := func(i int) error {
+		if i == 1 {
+			return xerrors.New("Failed to insert OVAL")
+		}
+		inserted = append(inserted, i)
+		return nil
+	}
+
+	err := pipeline(context.Background(), download, insert)
+	if err == nil || err.Error() != "Failed to insert OVAL" {
+		t.Errorf("expected: the error of the insert, actual: %v", err)
+	}
+	// the rest are drained without inserting them, and download sees the cancellation
+	if want := []int{0}; !reflect.DeepEqual(inserted, want) {
+		t.Errorf("expected: %v, actual: %v", want, inserted)
+	}
+	if sent != 5 || cancelled == 0 {
+		t.Errorf("expected: all drained after the cancellation, actual: %d sent, %d cancelled", sent, cancelled)
+	}
+}
+
+func TestPipelineDownloadError(t *testing.T) {
+	download := func(_ context.Context, send func(int)) error {
+		send(0)
+		return fmt.Errorf("Failed to fetch files. err: %w", context.DeadlineExceeded)
+	}
+	inserted := 0
+	err := pipeline(context.Background(), download, func(int) error {
+		inserted++
+		return nil
+	})
+	if !xerrors.Is(err, context.DeadlineExceeded) || inserted != 1 {
+		t.Errorf("expected: the error of download after inserting the sent one, actual: %v, %d inserted", err, inserted)
+	}
+}
+
+func TestConvertInOrder(t *testing.T) {
+	// the later files are converted faster, but sent in the order they are submitted
+	const (
+		files   = 6
+		workers = 3
+	)
+	var running, peak int32
+	sent := []int{}
+	submit, wait := convertInOrder(workers, func(i int) { sent = append(sent, i) })
+	for i := 0; i < files; i++ {
+		i := i
+		submit(func() int {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Duration(files-i) * 20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return i
+		})
+	}
+	wait()
+
+	if want := []int{0, 1, 2, 3, 4, 5}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("expected: %v, actual: %v", want, sent)
+	}
+	if peak < 2 || peak > workers {
+		t.Errorf("expected: 2 to %d conversions at once, actual: %d", workers, peak)
+	}
+}
+
+// fixtureFiles returns the fetched files of the fixtures of Debian and Ubuntu, n times each
+func fixtureFiles(tb testing.TB, n int) []fetcherutil.FetchResult {
+	tb.Helper()
+
+	// ModTime for the timestamps of the roots not to be of time.Now
+	modTime := time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)
+	rs := []fetcherutil.FetchResult{}
+	for i := 0; i < n; i++ {
+		rs = append(rs,
+			fetcherutil.FetchResult{Target: "12", URL: "https://www.debian.org/security/oval/oval-definitions-bookworm.xml", Body: testutil.File(tb, "oval-definitions-bookworm.xml"), ModTime: modTime},
+			fetcherutil.FetchResult{Target: "22.04", URL: "https://security-metadata.canonical.com/oval/com.ubuntu.jammy.cve.oval.xml", Body: testutil.File(tb, "com.ubuntu.jammy.cve.oval.xml"), ModTime: modTime},
+		)
+	}
+	return rs
+}
+
+// convertFixtureFiles converts rs on workers as Load does, returning the converted files in the order they are sent
+func convertFixtureFiles(rs []fetcherutil.FetchResult, workers int) []convertedFile {
+	l := &loader{logger: log15.New()}
+	l.logger.SetHandler(log15.DiscardHandler())
+	fs := []convertedFile{}
+	submit, wait := convertInOrder(workers, func(f convertedFile) { fs = append(fs, f) })
+	for _, r := range rs {
+		r := r
+		submit(func() convertedFile {
+			if r.Target == "12" {
+				return l.convertDebian(r)
+			}
+			return l.convertUbuntu(r)
+		})
+	}
+	wait()
+	return fs
+}
+
+// TestConvertInOrderFixtures converts the fixtures concurrently as sequentially, for the race detector to check the converters share no state
+func TestConvertInOrderFixtures(t *testing.T) {
+	rs := fixtureFiles(t, 4)
+	want := convertFixtureFiles(rs, 1)
+	got := convertFixtureFiles(rs, 4)
+	if len(got) != len(want) {
+		t.Fatalf("expected: %d files, actual: %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].err != nil || want[i].err != nil {
+			t.Fatalf("unexpected error: %v, %v", got[i].err, want[i].err)
+		}
+		if !reflect.DeepEqual(got[i].roots, want[i].roots) || !reflect.DeepEqual(got[i].stat, want[i].stat) {
+			t.Errorf("[%d] expected: the same as converted sequentially, actual: %d roots, %+v", i, len(got[i].roots), got[i].stat)
+		}
+	}
+}
+
+func BenchmarkConvertInOrder(b *testing.B) {
+	rs := fixtureFiles(b, 8)
+	for _, workers := range []int{1, runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				convertFixtureFiles(rs, workers)
+			}
+		})
+	}
+}
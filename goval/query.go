@@ -0,0 +1,85 @@
+package goval
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// the lookups of Query, as --by-package, --by-cveid, --by-cpe and --by-advisory of the select subcommand
+const (
+	ByPackage  = "package"
+	ByCveID    = "cveid"
+	ByCpe      = "cpe"
+	ByAdvisory = "advisory"
+)
+
+// QueryOptions is the option of Query
+type QueryOptions struct {
+	// DB is the DB to look up, loaded by Load or the fetch subcommands
+	DB db.DB
+	// Family is the family to look up, normalized by config.NormalizeFamily, e.g. redhat of RedHat
+	Family string
+	// Release is the release of Family, e.g. 7, matched as the lookups of the server match it
+	Release string
+	// By is the lookup, ByPackage, ByCveID, ByCpe or ByAdvisory
+	By string
+	// Arg is the package name, the CVE-ID, the CPE or its prefix, or the advisory ID to look up by
+	Arg string
+	// Arch is the architecture of the packages of amazon, oracle and fedora, all of them if empty
+	Arch string
+	// Classes are the classes of the definitions looked up ByPackage, e.g. patch and vulnerability, all of them if empty
+	Classes []string
+}
+
+// Query looks up the definitions of opts.Family and opts.Release in opts.DB by opts.By, as the select subcommand does.
+// The lookup of the release not loaded fails with db.ErrNoSuchRelease, to tell it apart from the release affected by nothing.
+func Query(ctx context.Context, opts QueryOptions) ([]models.Definition, error) {
+	if opts.DB == nil {
+		return nil, xerrors.New("Failed to query. err: no DB to look up, set QueryOptions.DB")
+	}
+	family, err := config.NormalizeFamily(opts.Family)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to query. err: %w", err)
+	}
+	if opts.Arch != "" {
+		switch family {
+		case config.Amazon, config.Oracle, config.Fedora:
+		default:
+			return nil, xerrors.Errorf("Family: %s cannot use the Architecture argument.", family)
+		}
+	}
+
+	switch opts.By {
+	case ByPackage:
+		dfs, err := opts.DB.GetByPackName(ctx, family, opts.Release, opts.Arg, opts.Arch, opts.Classes...)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to get cve by package. err: %w", err)
+		}
+		return dfs, nil
+	case ByCveID:
+		dfs, err := opts.DB.GetByCveID(ctx, family, opts.Release, opts.Arg, opts.Arch)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to get cve by cveID. err: %w", err)
+		}
+		return dfs, nil
+	case ByCpe:
+		dfs, err := opts.DB.GetByCpe(ctx, family, opts.Release, opts.Arg, opts.Arch)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to get cve by CPE. err: %w", err)
+		}
+		return dfs, nil
+	case ByAdvisory:
+		dfs, err := opts.DB.GetByAdvisoryID(ctx, family, opts.Release, opts.Arg, opts.Arch)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to get cve by advisory ID. err: %w", err)
+		}
+		return dfs, nil
+	default:
+		return nil, xerrors.Errorf("Unknown lookup: %q. Available lookup: %s, %s, %s, %s", opts.By, ByPackage, ByCveID, ByCpe, ByAdvisory)
+	}
+}
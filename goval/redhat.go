@@ -0,0 +1,123 @@
+package goval
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	fetcher "github.com/vulsio/goval-dictionary/fetcher/redhat"
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/redhat"
+)
+
+// loadRedHat fetches the OVAL of versions into the DB.
+// The files of each version are inserted while those of the next ones are downloaded and converted.
+func (l *loader) loadRedHat(ctx context.Context, versions []string) error {
+	download := func(ctx context.Context, send func(convertedRedHat)) error {
+		submit, wait := convertInOrder(l.parseWorkers(), send)
+		err := fetcher.StreamFiles(ctx, versions, func(v string, rs []fetcherutil.FetchResult) {
+			submit(func() convertedRedHat { return l.convertRedHat(v, rs) })
+		})
+		wait()
+		if err != nil {
+			return xerrors.Errorf("Failed to fetch files. err: %w", err)
+		}
+		return nil
+	}
+	insert := func(f convertedRedHat) error {
+		if f.err != nil {
+			return l.fail(f.version, f.err)
+		}
+		l.converted(f.version, f.stat)
+		if err := l.validateRoot(&f.root); err != nil {
+			return l.fail(f.version, err)
+		}
+		stat, err := l.db.InsertOval(ctx, &f.root)
+		if err != nil {
+			return xerrors.Errorf("Failed to insert OVAL. err: %w", err)
+		}
+		l.add(f.version, StatusInserted, f.root.Definitions, stat)
+		if err := l.storeSourceFiles([]string{f.version}, f.sources...); err != nil {
+			return err
+		}
+		setSHA256(l.fetchMeta, f.results...)
+		return nil
+	}
+	if err := pipeline(ctx, download, insert); err != nil {
+		return err
+	}
+	if err := l.pruneSourceFiles(); err != nil {
+		return err
+	}
+
+	return l.upsertFetchMeta()
+}
+
+// convertedRedHat is the OVAL of a version converted from its files, OVALv1 and OVALv2, by the download stage of loadRedHat
+type convertedRedHat struct {
+	version string
+	results []fetcherutil.FetchResult
+	root    models.Root
+	stat    models.ConvertStat  // the stat of the conversion of both of the files
+	sources []*models.FetchFile // the files to store by Conf.StoreSource, none without it
+	err     error               // the error of fetching or converting either of the files, failing the version
+}
+
+// convertRedHat decodes the files of the version and merges their definitions
+func (l *loader) convertRedHat(v string, rs []fetcherutil.FetchResult) convertedRedHat {
+	f := convertedRedHat{version: v, results: rs}
+	m := map[string][]models.Definition{}
+	for _, r := range rs {
+		// OVALv1 or OVALv2 alone is incomplete for the version
+		if r.Err != nil {
+			f.err = r.Err
+			return f
+		}
+		gen, defs, stat, err := redhat.Decode(v, bytes.NewReader(r.Body))
+		if err != nil {
+			f.err = fetcherutil.NewParseError(r.URL, r.Body, err)
+			return f
+		}
+		f.stat = f.stat.Add(stat)
+		l.logFetched(r.URL[strings.LastIndex(r.URL, "/")+1:], r, len(defs), gen.Timestamp)
+
+		// OVALv2 is either of the compressed one or the uncompressed fallback
+		m[strings.TrimSuffix(r.URL[strings.LastIndex(r.URL, "/")+1:], ".bz2")] = defs
+	}
+
+	defss := make([][]models.Definition, 0, len(m))
+	for _, k := range []string{fmt.Sprintf("rhel-%s.oval.xml", v), fmt.Sprintf("com.redhat.rhsa-RHEL%s.xml", v)} {
+		defss = append(defss, m[k])
+	}
+
+	f.root = models.Root{
+		Family:      c.RedHat,
+		OSVersion:   v,
+		Definitions: redhat.MergeDefinitions(defss...),
+		Timestamp:   rootTimestamp(rs...),
+	}
+	f.root.FileSize, f.root.SHA256 = fetcherutil.Digest(rs...)
+	f.root.Source = fetcherutil.Source(rs...)
+	for _, r := range rs {
+		source, err := l.sourceFile(r)
+		if err != nil {
+			f.err = err
+			return f
+		}
+		if source != nil {
+			f.sources = append(f.sources, source)
+		}
+	}
+	// not to hold the bodies until the insert, which needs only their digests and the files compressed
+	f.results = make([]fetcherutil.FetchResult, len(rs))
+	for i, r := range rs {
+		r.Body = nil
+		f.results[i] = r
+	}
+	return f
+}
@@ -0,0 +1,234 @@
+package goval
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// the statuses of a version in the summary of a load
+const (
+	StatusInserted    = "inserted"
+	StatusMerged      = "merged"
+	StatusNotModified = "not modified"
+	StatusUpToDate    = "up to date"
+	StatusFailed      = "failed"
+	StatusDryRun      = "dry run"
+	StatusDownloaded  = "downloaded"
+)
+
+// SeverityUnknown is the severity of the new definitions whose advisory has none, in Summary.NewAdvisories
+const SeverityUnknown = "unknown"
+
+// Summary is the result of each version of Family in a load, in the order the versions finished
+type Summary struct {
+	Family   string
+	Versions []VersionSummary
+	// Conversions are the stats of the conversion by the version of the converted files, or by the name of the file of all the versions, e.g. of Oracle
+	Conversions map[string]models.ConvertStat
+	// ClockSkews are the timestamps of the fetched files in the future, clamped or refreshed
+	ClockSkews []ClockSkew
+}
+
+// VersionSummary is the result of a version, with the definitions inserted, which would have been inserted by Conf.DryRun or Conf.NoInsert
+type VersionSummary struct {
+	Version     string
+	Status      string
+	Definitions int
+	Packages    int
+	CVEs        int
+	// Change is the numbers of the definitions new, updated, unchanged and removed from the stored ones
+	Change models.ChangeStat
+	// NewAdvisories are the IDs of the advisories of the new definitions by their severity
+	NewAdvisories map[string][]string
+	Err           error
+}
+
+// ClockSkew is the timestamp more than Conf.MaxClockSkew in the future of a fetched file, e.g. Last-Modified of the mirror of the skewed clock,
+// with the action taken on it, e.g. clamped to now
+type ClockSkew struct {
+	URL       string
+	Timestamp time.Time
+	Action    string
+}
+
+// Change returns the sum of the numbers of the definitions new, updated, unchanged and removed of all the versions
+func (s Summary) Change() models.ChangeStat {
+	total := models.ChangeStat{}
+	for _, v := range s.Versions {
+		total = total.Add(v.Change)
+	}
+	return total
+}
+
+// NewAdvisories returns the IDs of the advisories of the new definitions of all the versions by their severity
+func (s Summary) NewAdvisories() map[string][]string {
+	ms := make([]map[string][]string, 0, len(s.Versions))
+	for _, v := range s.Versions {
+		ms = append(ms, v.NewAdvisories)
+	}
+	return mergeAdvisories(ms...)
+}
+
+// Failed returns the number of the failed versions
+func (s Summary) Failed() int {
+	n := 0
+	for _, v := range s.Versions {
+		if v.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// ConvertStat returns the sum of the stats of the conversion of all the files, with the IDs of the skipped definitions in the order of the versions
+func (s Summary) ConvertStat() models.ConvertStat {
+	versions := maps.Keys(s.Conversions)
+	sort.Strings(versions)
+	total := models.ConvertStat{}
+	for _, v := range versions {
+		total = total.Add(s.Conversions[v])
+	}
+	return total
+}
+
+// add records the version finished with the status and the definitions inserted, which would have been inserted by Conf.DryRun or Conf.NoInsert,
+// and the numbers of them new, updated, unchanged and removed from the stored ones
+func (l *loader) add(version, status string, defs []models.Definition, change models.ChangeStat) {
+	switch {
+	case status != StatusInserted && status != StatusMerged:
+	case l.conf.DryRun:
+		status = StatusDryRun
+	case l.conf.NoInsert:
+		status = StatusDownloaded
+	}
+	v := VersionSummary{Version: version, Status: status, Definitions: len(defs), Change: change, NewAdvisories: newAdvisories(defs, change.NewIDs)}
+	cveIDs := map[string]struct{}{}
+	for _, d := range defs {
+		v.Packages += len(d.AffectedPacks)
+		for _, c := range d.Advisory.Cves {
+			cveIDs[c.CveID] = struct{}{}
+		}
+	}
+	v.CVEs = len(cveIDs)
+	l.summary.Versions = append(l.summary.Versions, v)
+	l.logger.Info("Finish", "Family", l.family, "Version", version, "Status", status, "Definitions", v.Definitions, "Packages", v.Packages, "CVEs", v.CVEs,
+		"New", change.New, "Updated", change.Updated, "Unchanged", change.Unchanged, "Removed", change.Removed)
+}
+
+// converted logs the stat of the conversion of a file of the version, and records it summed up with the other files of the version
+func (l *loader) converted(version string, stat models.ConvertStat) {
+	logCtx := []interface{}{"Family", l.family, "Version", version, "Seen", stat.Seen, "Converted", stat.Converted, "Skipped", stat.SkippedTotal()}
+	if len(stat.Skipped) > 0 {
+		logCtx = append(logCtx, "Reasons", stat.Skipped, "SkippedIDs", strings.Join(stat.SkippedIDs, ", "))
+	}
+	if stat.CvesNormalized+stat.CvesRerouted > 0 {
+		logCtx = append(logCtx, "CvesNormalized", stat.CvesNormalized, "CvesRerouted", stat.CvesRerouted)
+	}
+	if stat.IDsDerived > 0 {
+		logCtx = append(logCtx, "IDsDerived", stat.IDsDerived)
+	}
+	l.logger.Info("Converted", logCtx...)
+	if l.summary.Conversions == nil {
+		l.summary.Conversions = map[string]models.ConvertStat{}
+	}
+	l.summary.Conversions[version] = l.summary.Conversions[version].Add(stat)
+}
+
+// fail records the version failed to continue with the other files, or returns the error by Conf.FailFast or on the cancellation
+func (l *loader) fail(version string, err error) error {
+	// the other versions are cancelled as well, then stop the load rather than reporting all of them as failed
+	if l.conf.FailFast || xerrors.Is(err, context.Canceled) || xerrors.Is(err, context.DeadlineExceeded) {
+		return xerrors.Errorf("Failed to fetch. family: %s, version: %s, err: %w", l.family, version, err)
+	}
+	l.logger.Error("Failed to fetch, continue with the other files", "Family", l.family, "Version", version, "err", err)
+	l.summary.Versions = append(l.summary.Versions, VersionSummary{Version: version, Status: StatusFailed, Err: err})
+	return nil
+}
+
+// futureTimestamp reports whether ts is more than Conf.MaxClockSkew after now, never if it is 0
+func (l *loader) futureTimestamp(ts, now time.Time) bool {
+	return l.conf.MaxClockSkew > 0 && ts.After(now.Add(l.conf.MaxClockSkew))
+}
+
+// clampFuture returns ts of the file of url clamped to now if it is more than Conf.MaxClockSkew in the future, recorded with a warning once for each of them,
+// or ts as is otherwise
+func (l *loader) clampFuture(url string, ts time.Time) time.Time {
+	now := time.Now()
+	if !l.futureTimestamp(ts, now) {
+		return ts
+	}
+	l.skewed(url, ts, "clamped to now")
+	return now
+}
+
+// skewed records ts of the file of url in the future and the action taken on it with a warning, once for each of them
+func (l *loader) skewed(url string, ts time.Time, action string) {
+	skew := ClockSkew{URL: url, Timestamp: ts, Action: action}
+	if slices.Contains(l.summary.ClockSkews, skew) {
+		return
+	}
+	l.logger.Warn("The timestamp of the fetched file is in the future", "URL", url, "Timestamp", ts, "Action", action, "MaxClockSkew", l.conf.MaxClockSkew)
+	l.summary.ClockSkews = append(l.summary.ClockSkews, skew)
+}
+
+// newAdvisories returns the IDs of the advisories of the new definitions of defs by their severity, sorted and unique
+func newAdvisories(defs []models.Definition, newIDs []string) map[string][]string {
+	if len(newIDs) == 0 {
+		return nil
+	}
+	isNew := make(map[string]struct{}, len(newIDs))
+	for _, id := range newIDs {
+		isNew[id] = struct{}{}
+	}
+	m := map[string][]string{}
+	for _, d := range defs {
+		if _, ok := isNew[d.DefinitionID]; !ok {
+			continue
+		}
+		severity := d.Advisory.Severity
+		if severity == "" {
+			severity = SeverityUnknown
+		}
+		m[severity] = append(m[severity], advisoryID(d))
+	}
+	return mergeAdvisories(m)
+}
+
+// advisoryID returns the ID of the advisory of def, e.g. RHSA-2017:0933, or the reference of the advisory for the families without it,
+// e.g. SUSE-SU-2021:0857-1, or the DefinitionID if neither
+func advisoryID(def models.Definition) string {
+	if def.Advisory.AdvisoryID != "" {
+		return def.Advisory.AdvisoryID
+	}
+	for _, r := range def.References {
+		switch {
+		case r.RefID == "", strings.EqualFold(r.Source, "CVE"), r.Source == "Ref", r.Source == "Bug":
+		default:
+			return r.RefID
+		}
+	}
+	return def.DefinitionID
+}
+
+// mergeAdvisories returns the IDs of the advisories of ms by their severity, sorted and unique
+func mergeAdvisories(ms ...map[string][]string) map[string][]string {
+	merged := map[string][]string{}
+	for _, m := range ms {
+		for severity, ids := range m {
+			merged[severity] = append(merged[severity], ids...)
+		}
+	}
+	for severity, ids := range merged {
+		sort.Strings(ids)
+		merged[severity] = slices.Compact(ids)
+	}
+	return merged
+}
@@ -0,0 +1,94 @@
+package goval
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	fetcher "github.com/vulsio/goval-dictionary/fetcher/suse"
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/suse"
+	"github.com/vulsio/goval-dictionary/util"
+)
+
+// loadSUSE fetches the OVAL of versions of the SUSE type of the family into the DB, e.g. suse.linux.enterprise.server.
+// The file of each version is inserted while the next ones are downloaded and converted.
+func (l *loader) loadSUSE(ctx context.Context, versions []string) error {
+	validators := l.cacheValidators()
+	download := func(ctx context.Context, send func(convertedFile)) error {
+		submit, wait := convertInOrder(l.parseWorkers(), send)
+		err := fetcher.StreamFiles(ctx, l.family, versions, validators, func(r fetcherutil.FetchResult) { submit(func() convertedFile { return l.convertSUSE(r) }) })
+		wait()
+		if err != nil {
+			return xerrors.Errorf("Failed to fetch files. err: %w", err)
+		}
+		return nil
+	}
+	insert := func(f convertedFile) error {
+		return l.insertConvertedFile(ctx, f)
+	}
+	if err := pipeline(ctx, download, insert); err != nil {
+		return err
+	}
+	if err := l.pruneSourceFiles(); err != nil {
+		return err
+	}
+
+	return l.upsertFetchMeta()
+}
+
+// convertSUSE decodes and converts the fetched file of the SUSE type, which has the OVAL of the OS versions of r.Target, e.g. 15.1 and 15.2 in the one of 15
+func (l *loader) convertSUSE(r fetcherutil.FetchResult) convertedFile {
+	f := convertedFile{result: r}
+	if r.Err != nil || r.NotModified {
+		return f
+	}
+	ovalroot := suse.Root{}
+	if err := fetcherutil.DecodeXML(r, &ovalroot); err != nil {
+		f.err = err
+		return f
+	}
+	filename := strings.TrimSuffix(r.URL[strings.LastIndex(r.URL, "/")+1:], ".gz")
+	l.logFetched(filename, r, len(ovalroot.Definitions.Definitions), ovalroot.Generator.Timestamp)
+
+	osVerDefs, stat, err := suse.ConvertToModel(filename, &ovalroot)
+	if err != nil {
+		f.err = xerrors.Errorf("Failed to convert from OVAL to goval-dictionary model. err: %w", err)
+		return f
+	}
+	f.stat = stat
+	f.snapshot = tumbleweedSnapshot(l.family, r, ovalroot.Generator.Timestamp)
+	for osVer, defs := range osVerDefs {
+		root := models.Root{
+			Family:      l.family,
+			OSVersion:   osVer,
+			Definitions: defs,
+			Timestamp:   rootTimestamp(r),
+		}
+		if !f.snapshot.IsZero() {
+			root.Timestamp = f.snapshot
+		}
+		root.FileSize, root.SHA256 = fetcherutil.Digest(r)
+		root.Source = fetcherutil.Source(r)
+		f.roots = append(f.roots, root)
+	}
+	f.source, f.err = l.sourceFile(r)
+	return f
+}
+
+// tumbleweedSnapshot returns the snapshot of the OVAL of openSUSE Tumbleweed of r, the timestamp of its generator, by which its freshness is tracked
+// as it has no version number, or zero for the other files and the timestamp failing to parse
+func tumbleweedSnapshot(suseType string, r fetcherutil.FetchResult, timestamp string) time.Time {
+	if suseType != c.OpenSUSE || r.Target != c.OpenSUSETumbleweed {
+		return time.Time{}
+	}
+	ts, err := util.ParseOvalTimestamp(timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return ts
+}
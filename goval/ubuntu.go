@@ -0,0 +1,73 @@
+package goval
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	fetcher "github.com/vulsio/goval-dictionary/fetcher/ubuntu"
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/ubuntu"
+)
+
+// loadUbuntu fetches the OVAL of versions into the DB.
+// The file of each version is inserted while the next ones are downloaded and converted.
+func (l *loader) loadUbuntu(ctx context.Context, versions []string) error {
+	validators := l.cacheValidators()
+	download := func(ctx context.Context, send func(convertedFile)) error {
+		submit, wait := convertInOrder(l.parseWorkers(), send)
+		err := fetcher.StreamFiles(ctx, versions, validators, func(r fetcherutil.FetchResult) { submit(func() convertedFile { return l.convertUbuntu(r) }) })
+		wait()
+		if err != nil {
+			return xerrors.Errorf("Failed to fetch files. err: %w", err)
+		}
+		return nil
+	}
+	insert := func(f convertedFile) error {
+		return l.insertConvertedFile(ctx, f)
+	}
+	if err := pipeline(ctx, download, insert); err != nil {
+		return err
+	}
+	if err := l.pruneSourceFiles(); err != nil {
+		return err
+	}
+
+	return l.upsertFetchMeta()
+}
+
+// convertUbuntu decodes and converts the fetched file of the version of r.Target
+func (l *loader) convertUbuntu(r fetcherutil.FetchResult) convertedFile {
+	f := convertedFile{result: r}
+	if r.Err != nil || r.NotModified {
+		return f
+	}
+	ovalroot := ubuntu.Root{}
+	if err := fetcherutil.DecodeXML(r, &ovalroot); err != nil {
+		f.err = err
+		return f
+	}
+	l.logFetched(r.URL[strings.LastIndex(r.URL, "/")+1:], r, len(ovalroot.Definitions.Definitions), ovalroot.Generator.Timestamp)
+
+	defs, stat, err := ubuntu.ConvertToModel(&ovalroot)
+	if err != nil {
+		f.err = xerrors.Errorf("Failed to convert from OVAL to goval-dictionary model. err: %w", err)
+		return f
+	}
+	root := models.Root{
+		Family:      c.Ubuntu,
+		OSVersion:   r.Target,
+		Definitions: defs,
+		Timestamp:   rootTimestamp(r),
+	}
+	root.FileSize, root.SHA256 = fetcherutil.Digest(r)
+	root.Source = fetcherutil.Source(r)
+	if f.source, f.err = l.sourceFile(r); f.err != nil {
+		return f
+	}
+	f.roots, f.stat = []models.Root{root}, stat
+	return f
+}
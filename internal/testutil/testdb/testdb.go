@@ -0,0 +1,50 @@
+// Package testdb opens the sqlite3 DB of the tests in the memory, or in the file for the subcommands, of the fixtures of testutil
+// or the roots of the test inserted by the real InsertOval
+package testdb
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/internal/testutil"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// seq names the DB of each test apart, as the in-memory DB of the same name is shared by the connections of the process
+var seq atomic.Int64
+
+// New opens the empty in-memory sqlite3 DB migrated, closed at the end of the test
+func New(t testing.TB) db.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:testdb-%d?mode=memory&cache=shared", seq.Add(1))
+	driver, err := db.NewDB("sqlite3", dsn, false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	t.Cleanup(func() { _ = driver.CloseDB() })
+	return driver
+}
+
+// Load opens the in-memory sqlite3 DB by New, and inserts the fixtures of families by testutil.Load, of all the families if none
+func Load(t testing.TB, families ...string) (db.DB, []models.Root) {
+	t.Helper()
+
+	driver := New(t)
+	return driver, testutil.Load(t, driver, families...)
+}
+
+// File creates the sqlite3 DB of path migrated, inserts roots by testutil.Insert and closes it, for the subcommands of the test to open path
+func File(t testing.TB, path string, roots ...*models.Root) string {
+	t.Helper()
+
+	driver, err := db.NewDB("sqlite3", path, false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	testutil.Insert(t, driver, roots...)
+	return path
+}
@@ -0,0 +1,181 @@
+package testdb_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/internal/testutil"
+	"github.com/vulsio/goval-dictionary/internal/testutil/testdb"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+func TestLoad(t *testing.T) {
+	for _, family := range testutil.Families() {
+		t.Run(family, func(t *testing.T) {
+			driver, roots := testdb.Load(t, family)
+			if len(roots) == 0 {
+				t.Fatalf("expected: the roots of %s, actual: none", family)
+			}
+
+			for _, root := range roots {
+				got := []models.Definition{}
+				if err := driver.IterateDefinitions(context.Background(), root.Family, root.OSVersion, func(d models.Definition) error {
+					got = append(got, d)
+					return nil
+				}); err != nil {
+					t.Fatalf("Failed to IterateDefinitions. err: %s", err)
+				}
+				testutil.AssertDefinitions(t, root.Definitions, got)
+
+				// the packages of each arch as stored, not collapsed
+				ctx := db.WithCollapseArch(context.Background(), false)
+				for _, want := range root.Definitions {
+					for _, cve := range want.Advisory.Cves {
+						defs, err := driver.GetByCveID(ctx, root.Family, root.OSVersion, cve.CveID, "")
+						if err != nil {
+							t.Fatalf("Failed to GetByCveID. err: %s", err)
+						}
+						testutil.AssertDefinitions(t, []models.Definition{want}, []models.Definition{testutil.Definition(t, defs, want.DefinitionID)})
+					}
+					for _, p := range want.AffectedPacks {
+						defs, err := driver.GetByPackName(ctx, root.Family, root.OSVersion, p.Name, "")
+						if err != nil {
+							t.Fatalf("Failed to GetByPackName. err: %s", err)
+						}
+						testutil.AssertDefinitions(t, []models.Definition{want}, []models.Definition{testutil.Definition(t, defs, want.DefinitionID)})
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	loaded, _ := testdb.Load(t)
+	empty := testdb.New(t)
+
+	stats, err := loaded.GetRootStats()
+	if err != nil {
+		t.Fatalf("Failed to GetRootStats. err: %s", err)
+	}
+	if len(stats) == 0 {
+		t.Errorf("expected: the roots of all the fixtures, actual: none")
+	}
+	if stats, err = empty.GetRootStats(); err != nil {
+		t.Fatalf("Failed to GetRootStats. err: %s", err)
+	}
+	if len(stats) != 0 {
+		t.Errorf("expected: no roots in the DB of another test, actual: %+v", stats)
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := testdb.File(t, filepath.Join(t.TempDir(), "oval.sqlite3"), &models.Root{
+		Family:      c.RedHat,
+		OSVersion:   "7",
+		Timestamp:   testutil.Timestamp,
+		Definitions: []models.Definition{{DefinitionID: "oval:com.redhat.rhsa:def:20170933", AffectedPacks: []models.Package{{Name: "kernel", Version: "0:3.10.0-514.16.1.el7"}}}},
+	})
+
+	// closed, for the subcommands to open it
+	driver, err := db.NewDB("sqlite3", path, false, db.Option{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	defs, err := driver.GetByPackName(context.Background(), c.RedHat, "7", "kernel", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	if len(defs) != 1 || defs[0].DefinitionID != "oval:com.redhat.rhsa:def:20170933" {
+		t.Errorf("expected: oval:com.redhat.rhsa:def:20170933, actual: %+v", defs)
+	}
+}
+
+func TestLoadDebianPacks(t *testing.T) {
+	driver, _ := testdb.Load(t, c.Debian)
+	tests := []struct {
+		pack  string
+		defID string
+		want  []models.Package
+	}{
+		{
+			pack:  "thunderbird",
+			defID: "oval:org.debian:def:160442418283063913207066440339186371364",
+			want: []models.Package{
+				{Name: "firefox-esr", Version: "102.11.0esr-1~deb12u1"},
+				{Name: "thunderbird", Version: "1:102.11.0-1~deb12u1"},
+			},
+		},
+		{
+			pack:  "tiff",
+			defID: "oval:org.debian:def:207311254385436289431093404744104330391",
+			want: []models.Package{
+				{Name: "libtiff-tools", NotFixedYet: true},
+				{Name: "tiff", Version: "4.5.0-6"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		defs, err := driver.GetByPackName(context.Background(), c.Debian, "12", tt.pack, "")
+		if err != nil {
+			t.Fatalf("Failed to GetByPackName. err: %s", err)
+		}
+		def := testutil.Normalize([]models.Definition{testutil.Definition(t, defs, tt.defID)})[0]
+		if diff := cmp.Diff(tt.want, def.AffectedPacks); diff != "" {
+			t.Errorf("%s: stored packages (-want +got):\n%s", tt.defID, diff)
+		}
+	}
+}
+
+func TestLoadRedHatCves(t *testing.T) {
+	driver, _ := testdb.Load(t, c.RedHat)
+	defs, err := driver.GetByCveID(context.Background(), c.RedHat, "8", "CVE-2023-23919", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByCveID. err: %s", err)
+	}
+	def := testutil.Definition(t, defs, "oval:com.redhat.rhsa:def:20231583")
+	if def.Advisory.Severity != "Moderate" {
+		t.Errorf("expected: Moderate, actual: %s", def.Advisory.Severity)
+	}
+
+	date := func(s string) *time.Time {
+		t, _ := time.Parse("2006-01-02", s)
+		return &t
+	}
+	type cveMeta struct {
+		impact     string
+		publicDate *time.Time
+	}
+	// the impacts of the CVEs rolled up into the advisory, and the public dates of YYYYMMDD, ISO and none
+	want := map[string]cveMeta{
+		"CVE-2023-23918": {impact: "moderate", publicDate: date("2023-02-16")},
+		"CVE-2023-23919": {impact: "important", publicDate: date("2023-02-16")},
+		"CVE-2023-23920": {impact: "low"},
+	}
+	got := map[string]cveMeta{}
+	for _, cve := range def.Advisory.Cves {
+		got[cve.CveID] = cveMeta{impact: cve.Impact, publicDate: cve.PublicDate}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected: %d CVEs, actual: %+v", len(want), def.Advisory.Cves)
+	}
+	for id, w := range want {
+		g := got[id]
+		if g.impact != w.impact {
+			t.Errorf("%s: expected impact: %s, actual: %s", id, w.impact, g.impact)
+		}
+		switch {
+		case w.publicDate == nil && g.publicDate != nil:
+			t.Errorf("%s: expected no public date, actual: %s", id, g.publicDate)
+		case w.publicDate != nil && (g.publicDate == nil || !g.publicDate.Equal(*w.publicDate)):
+			t.Errorf("%s: expected public date: %s, actual: %v", id, w.publicDate, g.publicDate)
+		}
+	}
+}
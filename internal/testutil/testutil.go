@@ -0,0 +1,331 @@
+// Package testutil has the small OVAL of every family converted by the real converters, inserted into the DB by the real InsertOval,
+// and the assertions comparing the Definition trees, so that the tests cover the pipeline from the fetched files to the lookups
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	fetcherutil "github.com/vulsio/goval-dictionary/fetcher/util"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/alpine"
+	"github.com/vulsio/goval-dictionary/models/amazon"
+	"github.com/vulsio/goval-dictionary/models/debian"
+	"github.com/vulsio/goval-dictionary/models/fedora"
+	"github.com/vulsio/goval-dictionary/models/oracle"
+	"github.com/vulsio/goval-dictionary/models/redhat"
+	"github.com/vulsio/goval-dictionary/models/suse"
+	"github.com/vulsio/goval-dictionary/models/ubuntu"
+	"github.com/vulsio/goval-dictionary/models/util"
+)
+
+//go:embed testdata
+var testdata embed.FS
+
+// Timestamp is the timestamp of the Roots of the fixtures
+var Timestamp = time.Date(2023, time.July, 6, 4, 7, 21, 0, time.UTC)
+
+// fixture is the file in testdata of the family, converted as the fetch subcommand of the family does
+type fixture struct {
+	family  string
+	file    string
+	convert func(name string, bs []byte) ([]models.Root, error)
+}
+
+var fixtures = []fixture{
+	{family: c.Alpine, file: "alpine-v3.18-main.yaml", convert: convertAlpine("3.18")},
+	{family: c.Amazon, file: "amazon-2-updateinfo.xml", convert: convertAmazon("2")},
+	{family: c.Debian, file: "oval-definitions-bookworm.xml", convert: convertDebian("12")},
+	{family: c.Fedora, file: "fedora-38-updateinfo.xml", convert: convertFedora("38")},
+	{family: c.OpenSUSELeap, file: "opensuse.leap.15.5.xml", convert: convertSUSE},
+	{family: c.Oracle, file: "com.oracle.elsa-all.xml", convert: convertOracle},
+	{family: c.RedHat, file: "rhel-8.oval.xml", convert: convertRedHat("8")},
+	{family: c.SUSEEnterpriseServer, file: "suse.linux.enterprise.server.15.xml", convert: convertSUSE},
+	{family: c.Ubuntu, file: "com.ubuntu.jammy.cve.oval.xml", convert: convertUbuntu("22.04")},
+}
+
+// Families returns the families of the fixtures, sorted
+func Families() []string {
+	families := make([]string, 0, len(fixtures))
+	for _, f := range fixtures {
+		families = append(families, f.family)
+	}
+	return families
+}
+
+// File returns the content of the fixture file, e.g. rhel-8.oval.xml, to be served to the fetchers by fetchertest.Server
+func File(t testing.TB, name string) []byte {
+	t.Helper()
+
+	bs, err := testdata.ReadFile(path.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to read fixture. err: %s", err)
+	}
+	return bs
+}
+
+// Roots returns the Roots of the fixture of family converted by the real converters, one per OS version in the order of OSVersion
+func Roots(t testing.TB, family string) []models.Root {
+	t.Helper()
+
+	for _, f := range fixtures {
+		if f.family != family {
+			continue
+		}
+		roots, err := f.convert(f.file, File(t, f.file))
+		if err != nil {
+			t.Fatalf("Failed to convert %s. err: %s", f.file, err)
+		}
+		for i := range roots {
+			roots[i].Family, roots[i].Timestamp = family, Timestamp
+			if err := roots[i].Validate(models.ValidateOption{MinDefinitions: 1}); err != nil {
+				t.Fatalf("Failed to validate %s. err: %s", f.file, err)
+			}
+		}
+		sort.Slice(roots, func(i, j int) bool { return roots[i].OSVersion < roots[j].OSVersion })
+		return roots
+	}
+	t.Fatalf("No fixture of family: %s", family)
+	return nil
+}
+
+// Inserter is the DB the fixtures are inserted into, e.g. db.DB
+type Inserter interface {
+	InsertOval(context.Context, *models.Root) (models.ChangeStat, error)
+}
+
+// batchSize is the default of --batch-size of the fetch subcommands
+const batchSize = 25
+
+// Load inserts the Roots of the fixtures of families by InsertOval of driver, of all the families if none, and returns them.
+// They are inserted by the default --batch-size unless the test sets it.
+func Load(t testing.TB, driver Inserter, families ...string) []models.Root {
+	t.Helper()
+
+	if len(families) == 0 {
+		families = Families()
+	}
+	roots := []models.Root{}
+	for _, family := range families {
+		roots = append(roots, Roots(t, family)...)
+	}
+	for i := range roots {
+		Insert(t, driver, &roots[i])
+	}
+	return roots
+}
+
+// Insert inserts roots by InsertOval of driver, e.g. the ones built by the test rather than the fixtures, by the default --batch-size
+// unless the test sets it
+func Insert(t testing.TB, driver Inserter, roots ...*models.Root) {
+	t.Helper()
+
+	if !viper.IsSet("batch-size") {
+		viper.Set("batch-size", batchSize)
+		t.Cleanup(func() { viper.Set("batch-size", nil) })
+	}
+	for _, root := range roots {
+		if _, err := driver.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to insert %s %s. err: %s", root.Family, root.OSVersion, err)
+		}
+	}
+}
+
+// Definition returns the definition of defID in defs, failing the test if none
+func Definition(t testing.TB, defs []models.Definition, defID string) models.Definition {
+	t.Helper()
+
+	for _, d := range defs {
+		if d.DefinitionID == defID {
+			return d
+		}
+	}
+	t.Fatalf("No definition of %s", defID)
+	return models.Definition{}
+}
+
+// AssertDefinitions fails the test with the diff if got is not the same as want, compared as Normalize does
+func AssertDefinitions(t testing.TB, want, got []models.Definition) {
+	t.Helper()
+
+	if diff := cmp.Diff(Normalize(want), Normalize(got)); diff != "" {
+		t.Errorf("definitions differ (-want +got):\n%s", diff)
+	}
+}
+
+// Normalize returns the copies of defs comparable regardless of the DB they are loaded from: without the IDs of the DB,
+// the empty children nil, the times in UTC, and the definitions and their children sorted,
+// as the DB returns them in no particular order and the converters build some of them from maps
+func Normalize(defs []models.Definition) []models.Definition {
+	if len(defs) == 0 {
+		return nil
+	}
+	normalized := make([]models.Definition, 0, len(defs))
+	for _, d := range defs {
+		d.ID, d.RootID = 0, 0
+		d.Advisory.ID, d.Advisory.DefinitionID = 0, 0
+		d.Advisory.Issued, d.Advisory.Updated = d.Advisory.Issued.UTC(), d.Advisory.Updated.UTC()
+		d.Advisory.Cves = normalizeSlice(d.Advisory.Cves, func(c *models.Cve) { c.ID, c.AdvisoryID = 0, 0 })
+		d.Advisory.Bugzillas = normalizeSlice(d.Advisory.Bugzillas, func(b *models.Bugzilla) { b.ID, b.AdvisoryID = 0, 0 })
+		d.Advisory.AffectedCPEList = normalizeSlice(d.Advisory.AffectedCPEList, func(c *models.Cpe) { c.ID, c.AdvisoryID = 0, 0 })
+		d.AffectedPacks = normalizeSlice(d.AffectedPacks, func(p *models.Package) { p.ID, p.DefinitionID = 0, 0 })
+		d.References = normalizeSlice(d.References, func(r *models.Reference) { r.ID, r.DefinitionID = 0, 0 })
+		if d.Debian != nil {
+			deb := *d.Debian
+			deb.ID, deb.DefinitionID = 0, 0
+			deb.Date = deb.Date.UTC()
+			d.Debian = &deb
+		}
+		normalized = append(normalized, d)
+	}
+	sort.SliceStable(normalized, func(i, j int) bool { return normalized[i].DefinitionID < normalized[j].DefinitionID })
+	return normalized
+}
+
+// normalizeSlice returns the copy of s of the elements cleared by clear and sorted by their fields, nil if empty
+func normalizeSlice[T any](s []T, clear func(*T)) []T {
+	if len(s) == 0 {
+		return nil
+	}
+	copied := make([]T, len(s))
+	copy(copied, s)
+	for i := range copied {
+		clear(&copied[i])
+	}
+	sort.SliceStable(copied, func(i, j int) bool { return fmt.Sprintf("%+v", copied[i]) < fmt.Sprintf("%+v", copied[j]) })
+	return copied
+}
+
+func convertAlpine(osVer string) func(string, []byte) ([]models.Root, error) {
+	return func(_ string, bs []byte) ([]models.Root, error) {
+		var secdb alpine.SecDB
+		if err := yaml.Unmarshal(bs, &secdb); err != nil {
+			return nil, err
+		}
+		defs, _ := alpine.ConvertToModel(&secdb)
+		return []models.Root{{OSVersion: osVer, Definitions: defs}}, nil
+	}
+}
+
+func convertAmazon(osVer string) func(string, []byte) ([]models.Root, error) {
+	return func(_ string, bs []byte) ([]models.Root, error) {
+		var updates amazon.Updates
+		if err := xml.Unmarshal(bs, &updates); err != nil {
+			return nil, err
+		}
+		// as the fetcher of updateinfo.xml does
+		for i, alas := range updates.UpdateList {
+			cveIDs := []string{}
+			for _, ref := range alas.References {
+				if ref.Type == "cve" {
+					cveIDs = append(cveIDs, ref.ID)
+				}
+			}
+			updates.UpdateList[i].CVEIDs = cveIDs
+		}
+		defs, _ := amazon.ConvertToModel(&updates, util.YearRange{})
+		return []models.Root{{OSVersion: osVer, Definitions: defs}}, nil
+	}
+}
+
+func convertDebian(osVer string) func(string, []byte) ([]models.Root, error) {
+	return func(name string, bs []byte) ([]models.Root, error) {
+		var root debian.Root
+		if err := fetcherutil.DecodeXML(fetcherutil.FetchResult{URL: name, Body: bs}, &root); err != nil {
+			return nil, err
+		}
+		defs, _ := debian.ConvertToModel(osVer, &root)
+		return []models.Root{{OSVersion: osVer, Definitions: defs}}, nil
+	}
+}
+
+func convertFedora(osVer string) func(string, []byte) ([]models.Root, error) {
+	return func(_ string, bs []byte) ([]models.Root, error) {
+		var updates fedora.Updates
+		if err := xml.Unmarshal(bs, &updates); err != nil {
+			return nil, err
+		}
+		// as the fetcher of updateinfo.xml does, of the titles of the references all reliable
+		security := []fedora.UpdateInfo{}
+		for _, update := range updates.UpdateList {
+			if update.Type != "security" {
+				continue
+			}
+			cveIDs := []string{}
+			for _, ref := range update.References {
+				cveIDs = append(cveIDs, fetcherutil.CveIDPattern.FindAllString(ref.Title, -1)...)
+			}
+			update.CVEIDs = fetcherutil.UniqueStrings(cveIDs)
+			security = append(security, update)
+		}
+		updates.UpdateList = security
+		defs, _ := fedora.ConvertToModel(&updates)
+		return []models.Root{{OSVersion: osVer, Definitions: defs}}, nil
+	}
+}
+
+func convertOracle(name string, bs []byte) ([]models.Root, error) {
+	var root oracle.Root
+	if err := fetcherutil.DecodeXML(fetcherutil.FetchResult{URL: name, Body: bs}, &root); err != nil {
+		return nil, err
+	}
+	osVerDefs, _ := oracle.ConvertToModel(&root, util.YearRange{})
+	roots := []models.Root{}
+	for osVer, defs := range osVerDefs {
+		roots = append(roots, models.Root{OSVersion: osVer, Definitions: defs})
+	}
+	return roots, nil
+}
+
+func convertRedHat(osVer string) func(string, []byte) ([]models.Root, error) {
+	return func(_ string, bs []byte) ([]models.Root, error) {
+		_, defs, _, err := redhat.Decode(osVer, bytes.NewReader(bs))
+		if err != nil {
+			return nil, err
+		}
+		return []models.Root{{OSVersion: osVer, Definitions: redhat.MergeDefinitions(defs)}}, nil
+	}
+}
+
+// convertSUSE converts the file of the OS versions of a SUSE family, e.g. 15.4 and 15.5 in the one of SUSE Linux Enterprise Server 15
+func convertSUSE(name string, bs []byte) ([]models.Root, error) {
+	var root suse.Root
+	if err := fetcherutil.DecodeXML(fetcherutil.FetchResult{URL: name, Body: bs}, &root); err != nil {
+		return nil, err
+	}
+	osVerDefs, _, err := suse.ConvertToModel(name, &root)
+	if err != nil {
+		return nil, err
+	}
+	roots := []models.Root{}
+	for osVer, defs := range osVerDefs {
+		roots = append(roots, models.Root{OSVersion: osVer, Definitions: defs})
+	}
+	return roots, nil
+}
+
+func convertUbuntu(osVer string) func(string, []byte) ([]models.Root, error) {
+	return func(name string, bs []byte) ([]models.Root, error) {
+		var root ubuntu.Root
+		if err := fetcherutil.DecodeXML(fetcherutil.FetchResult{URL: name, Body: bs}, &root); err != nil {
+			return nil, err
+		}
+		defs, _, err := ubuntu.ConvertToModel(&root)
+		if err != nil {
+			return nil, err
+		}
+		return []models.Root{{OSVersion: osVer, Definitions: defs}}, nil
+	}
+}
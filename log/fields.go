@@ -0,0 +1,77 @@
+package log
+
+import (
+	"context"
+	"sort"
+
+	"github.com/inconshreveable/log15"
+)
+
+// Fields are the context fields tagging the lines of a logger, e.g. Family and Version of the OVAL being fetched
+type Fields map[string]interface{}
+
+// WithFields returns the logger tagging every line with fields in the order of their keys, as the keys of the object in JSON by --log-json.
+// The package-level functions of log15 remain for the lines of no family, e.g. of opening the DB.
+func WithFields(fields Fields) log15.Logger {
+	return log15.Root().New(fields.ctx()...)
+}
+
+// ctx returns the fields as the key-value pairs of log15, sorted by the key
+func (f Fields) ctx() []interface{} {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ctx := make([]interface{}, 0, len(f)*2)
+	for _, k := range keys {
+		ctx = append(ctx, k, f[k])
+	}
+	return ctx
+}
+
+type fieldsKey struct{}
+
+// NewContext returns ctx carrying fields added to the ones of ctx, which are overridden by fields of the same keys,
+// so that the callees tag their lines by FromContext, e.g. the fetchers and the DB of the Family and the Version being processed
+func NewContext(ctx context.Context, fields Fields) context.Context {
+	merged := Fields{}
+	for k, v := range fieldsFrom(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// FromContext returns the logger of ctx tagging every line with the fields of ctx, where the logger is the root logger unless WithLogger
+func FromContext(ctx context.Context) log15.Logger {
+	logger := log15.Root()
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey{}).(log15.Logger); ok {
+			logger = l
+		}
+	}
+	fields := fieldsFrom(ctx)
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.New(fields.ctx()...)
+}
+
+type loggerKey struct{}
+
+// WithLogger returns ctx whose callees log to logger by FromContext instead of the root logger, e.g. the one given to goval.Load
+// by the program embedding goval-dictionary, whose handlers are not replaced by SetLogger
+func WithLogger(ctx context.Context, logger log15.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+func fieldsFrom(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).(Fields)
+	return fields
+}
@@ -0,0 +1,105 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+func TestFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		logJSON bool
+		// want are the substrings of each line of the tagged logs, in the order of the lines
+		want []string
+	}{
+		{
+			name: "text",
+			want: []string{
+				`msg="Fetching... " Family=redhat URL=https://example.com/rhel-8.oval.xml.bz2`,
+				`msg="Inserting new Definitions..." Family=redhat Version=8 Count=2`,
+				`msg="Inserting new Definitions..." Family=redhat Version=9 Count=3`,
+				`msg=Untagged`,
+			},
+		},
+		{
+			name:    "json",
+			logJSON: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log15.Root().SetHandler(log15.StreamHandler(&buf, Format(tt.logJSON)))
+			defer log15.Root().SetHandler(log15.StderrHandler)
+
+			ctx := NewContext(context.Background(), Fields{"Family": "redhat"})
+			FromContext(ctx).Info("Fetching... ", "URL", "https://example.com/rhel-8.oval.xml.bz2")
+			// the version of the inner context overrides the one of the outer
+			v8 := NewContext(NewContext(ctx, Fields{"Version": "7"}), Fields{"Version": "8"})
+			FromContext(v8).Info("Inserting new Definitions...", "Count", 2)
+			WithFields(Fields{"Version": "9", "Family": "redhat"}).Info("Inserting new Definitions...", "Count", 3)
+			FromContext(context.Background()).Info("Untagged")
+
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if len(lines) != 4 {
+				t.Fatalf("expected: 4 lines, actual: %q", lines)
+			}
+			if !tt.logJSON {
+				for i, want := range tt.want {
+					if !strings.Contains(lines[i], want) {
+						t.Errorf("line %d: expected: %q, actual: %q", i, want, lines[i])
+					}
+				}
+				return
+			}
+
+			wants := []map[string]interface{}{
+				{"msg": "Fetching... ", "Family": "redhat", "URL": "https://example.com/rhel-8.oval.xml.bz2"},
+				{"msg": "Inserting new Definitions...", "Family": "redhat", "Version": "8", "Count": float64(2)},
+				{"msg": "Inserting new Definitions...", "Family": "redhat", "Version": "9", "Count": float64(3)},
+				{"msg": "Untagged"},
+			}
+			for i, want := range wants {
+				var got map[string]interface{}
+				if err := json.Unmarshal([]byte(lines[i]), &got); err != nil {
+					t.Fatalf("Failed to unmarshal %s. err: %s", lines[i], err)
+				}
+				for _, k := range []string{"t", "lvl"} {
+					delete(got, k)
+				}
+				if len(got) != len(want) {
+					t.Errorf("line %d: expected: %v, actual: %v", i, want, got)
+					continue
+				}
+				for k, v := range want {
+					if got[k] != v {
+						t.Errorf("line %d: %s: expected: %v, actual: %v", i, k, v, got[k])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var root, own bytes.Buffer
+	log15.Root().SetHandler(log15.StreamHandler(&root, Format(false)))
+	defer log15.Root().SetHandler(log15.StderrHandler)
+
+	logger := log15.New("Component", "embedded")
+	logger.SetHandler(log15.StreamHandler(&own, Format(false)))
+	ctx := NewContext(WithLogger(context.Background(), logger), Fields{"Family": "redhat"})
+	FromContext(ctx).Info("Fetching... ")
+
+	if root.Len() != 0 {
+		t.Errorf("expected: nothing to the root logger, actual: %q", root.String())
+	}
+	if want := `msg="Fetching... " Component=embedded Family=redhat`; !strings.Contains(own.String(), want) {
+		t.Errorf("expected: %q, actual: %q", want, own.String())
+	}
+}
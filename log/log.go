@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/inconshreveable/log15"
 	"golang.org/x/xerrors"
@@ -18,43 +19,132 @@ func GetDefaultLogDir() string {
 	return defaultLogDir
 }
 
-// SetLogger set logger
-func SetLogger(logToFile bool, logDir string, debug, logJSON bool) error {
+// Format returns the format of the logs, logfmt by default, or one JSON object per line of t, lvl, msg and the fields with logJSON
+func Format(logJSON bool) log15.Format {
+	if logJSON {
+		return log15.JsonFormatEx(false, true)
+	}
+	return log15.LogfmtFormat()
+}
+
+// the logs before SetLogger, e.g. of reading the config file, go to stderr as well, as stdout is reserved for the data, e.g. of select
+func init() {
+	log15.Root().SetHandler(log15.StderrHandler)
+}
+
+// logDirs returns the directories to log to without --log-dir in the order of preference: the default log directory,
+// $XDG_STATE_HOME/goval-dictionary, ~/.local/state/goval-dictionary if XDG_STATE_HOME is not set, and the temporary directory
+var logDirs = func() []string {
+	dirs := []string{GetDefaultLogDir()}
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			state = filepath.Join(home, ".local", "state")
+		}
+	}
+	if state != "" {
+		dirs = append(dirs, filepath.Join(state, "goval-dictionary"))
+	}
+	return append(dirs, filepath.Join(os.TempDir(), "goval-dictionary"))
+}
+
+// SetLogger set logger, to stderr unless !logToStderr and to the file of file.Name in logDir with logToFile, rotated by file.
+// Without logDir, the file is in the first writable of logDirs, e.g. for the service account not allowed to write /var/log,
+// and only to stderr if none of them is, which is warned, while the unwritable logDir given is the error.
+// quiet logs only the warnings and the errors to stderr, taking precedence over debug and debugSQL.
+// The SQL of SQL() goes to stderr at the debug level with debugSQL, and to sql.log in the same directory instead of the log file and stderr
+// with file.SQL, except for the slow ones and the others at the info level or above.
+func SetLogger(logToFile bool, logDir string, debug, debugSQL, logJSON, quiet, logToStderr bool, file FileOption) error {
+	logFormat := Format(logJSON)
 	stderrHandler := log15.StderrHandler
-	logFormat := log15.LogfmtFormat()
 	if logJSON {
-		logFormat = log15.JsonFormatEx(false, true)
 		stderrHandler = log15.StreamHandler(os.Stderr, logFormat)
 	}
 
-	lvlHandler := log15.LvlFilterHandler(log15.LvlInfo, stderrHandler)
-	if debug {
-		lvlHandler = log15.LvlFilterHandler(log15.LvlDebug, stderrHandler)
+	lvl := log15.LvlInfo
+	switch {
+	case quiet:
+		lvl = log15.LvlWarn
+	case debug:
+		lvl = log15.LvlDebug
+	}
+	sqlLvl := lvl
+	if debugSQL && !quiet {
+		sqlLvl = log15.LvlDebug
+	}
+	lvlHandler := log15.LvlFilterHandler(lvl, stderrHandler)
+	sqlHandler := log15.LvlFilterHandler(sqlLvl, stderrHandler)
+	if !logToStderr {
+		lvlHandler, sqlHandler = log15.DiscardHandler(), log15.DiscardHandler()
 	}
 
-	var handler log15.Handler
-	if logToFile {
-		if _, err := os.Stat(logDir); err != nil {
-			if os.IsNotExist(err) {
-				if err := os.Mkdir(logDir, 0700); err != nil {
-					return xerrors.Errorf("Failed to create log directory. err: %w", err)
-				}
-			} else {
-				return xerrors.Errorf("Failed to check log directory. err: %w", err)
-			}
-		}
+	if !logToFile {
+		log15.Root().SetHandler(lvlHandler)
+		sqlLogger.SetHandler(sqlHandler)
+		return nil
+	}
 
-		logPath := filepath.Join(logDir, "goval-dictionary.log")
-		if _, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+	name := file.Name
+	if name == "" {
+		name = "goval-dictionary"
+	}
+	name += ".log"
+	if logDir != "" {
+		w, err := openLogFile(logDir, name, file)
+		if err != nil {
 			return xerrors.Errorf("Failed to open a log file. err: %w", err)
 		}
-		handler = log15.MultiHandler(
-			log15.Must.FileHandler(logPath, logFormat),
-			lvlHandler,
-		)
-	} else {
-		handler = lvlHandler
-	}
-	log15.Root().SetHandler(handler)
+		return setFileHandlers(logDir, w, logFormat, lvlHandler, sqlHandler, file)
+	}
+
+	dirs := logDirs()
+	errs := []string{}
+	for i, dir := range dirs {
+		w, err := openLogFile(dir, name, file)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if err := setFileHandlers(dir, w, logFormat, lvlHandler, sqlHandler, file); err != nil {
+			return err
+		}
+		if i > 0 {
+			log15.Warn("The default log directory is not writable, logging to the fallback", "Dir", dir, "Path", filepath.Join(dir, name), "Unwritable", dirs[:i])
+		} else {
+			log15.Debug("Logging to file", "Path", filepath.Join(dir, name))
+		}
+		return nil
+	}
+	log15.Root().SetHandler(lvlHandler)
+	sqlLogger.SetHandler(sqlHandler)
+	log15.Warn("None of the log directories is writable, logging only to stderr. Give a writable one by --log-dir, or disable --log-to-file", "Dirs", dirs, "err", strings.Join(errs, ", "))
 	return nil
 }
+
+// setFileHandlers sets the handlers of the root logger and of SQL() to w of the log file in dir and to stderr by lvlHandler and sqlHandler,
+// or of SQL() to sql.log in dir with file.SQL, passing only the lines at the info level or above to the root logger
+func setFileHandlers(dir string, w *rotateWriter, logFormat log15.Format, lvlHandler, sqlHandler log15.Handler, file FileOption) error {
+	fileHandler := log15.StreamHandler(w, logFormat)
+	rootHandler := log15.MultiHandler(fileHandler, lvlHandler)
+	if !file.SQL {
+		log15.Root().SetHandler(rootHandler)
+		sqlLogger.SetHandler(log15.MultiHandler(fileHandler, sqlHandler))
+		return nil
+	}
+
+	sw, err := openLogFile(dir, "sql.log", file)
+	if err != nil {
+		return xerrors.Errorf("Failed to open the SQL log file. err: %w", err)
+	}
+	log15.Root().SetHandler(rootHandler)
+	sqlLogger.SetHandler(log15.MultiHandler(log15.StreamHandler(sw, logFormat), log15.LvlFilterHandler(log15.LvlInfo, rootHandler)))
+	return nil
+}
+
+// openLogFile opens the log file of name in dir, creating dir if not exists
+func openLogFile(dir, name string, file FileOption) (*rotateWriter, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, xerrors.Errorf("Failed to create log directory. err: %w", err)
+	}
+	return newRotateWriter(filepath.Join(dir, name), file)
+}
@@ -0,0 +1,325 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		logJSON bool
+		golden  string
+	}{
+		{
+			name:   "text",
+			golden: "text.golden",
+		},
+		{
+			name:    "json",
+			logJSON: true,
+			golden:  "json.golden",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := log15.StreamHandler(&buf, Format(tt.logJSON))
+			logger := log15.New()
+			// the fixed time of the records for the golden file
+			logger.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+				r.Time = time.Date(2023, time.July, 6, 4, 0, 10, 0, time.UTC)
+				return h.Log(r)
+			}))
+
+			// the representative calls of the fetchers, the DB and the summary of the fetch subcommands
+			logger.Info("Fetching... ", "URL", "https://www.debian.org/security/oval/oval-definitions-bookworm.xml.bz2")
+			logger.Warn("Failed to fetch, retrying...", "URL", "https://www.debian.org/security/oval/oval-definitions-bookworm.xml.bz2", "attempt", 1, "wait", 2*time.Second, "err", xerrors.New("unexpected EOF"))
+			logger.Info("Inserting new Definitions...", "Family", "debian", "Version", "12", "Count", 1838)
+			logger.Info("Finish", "Family", "debian", "Version", "12", "Status", "inserted", "Definitions", 1838, "Packages", 31022, "CVEs", 6215)
+			logger.Error("Failed to fetch, continue with the other files", "Family", "debian", "Version", "13", "err", xerrors.New("Failed to HTTP GET. status: 404 Not Found"))
+
+			p := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+					t.Fatalf("Failed to update golden file. err: %s", err)
+				}
+			}
+			want, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatalf("Failed to read golden file. err: %s", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("expected: %s, actual: %s", want, buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	tests := []struct {
+		name        string
+		debug       bool
+		quiet       bool
+		logToStderr bool
+		want        []string
+	}{
+		{
+			name:        "default",
+			logToStderr: true,
+			want:        []string{"info", "warn", "eror"},
+		},
+		{
+			name:        "debug",
+			debug:       true,
+			logToStderr: true,
+			want:        []string{"dbug", "info", "warn", "eror"},
+		},
+		{
+			name:        "quiet",
+			debug:       true,
+			quiet:       true,
+			logToStderr: true,
+			want:        []string{"warn", "eror"},
+		},
+		{
+			name: "not to stderr",
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr := os.Stderr
+			defer func() {
+				os.Stderr = stderr
+				log15.Root().SetHandler(log15.StderrHandler)
+				sqlLogger.SetHandler(log15.StderrHandler)
+			}()
+			f, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+			if err != nil {
+				t.Fatalf("Failed to create stderr. err: %s", err)
+			}
+			defer f.Close()
+			os.Stderr = f
+
+			if err := SetLogger(false, "", tt.debug, false, true, tt.quiet, tt.logToStderr, FileOption{}); err != nil {
+				t.Fatalf("Failed to SetLogger. err: %s", err)
+			}
+			log15.Debug("debug")
+			log15.Info("info")
+			log15.Warn("warn")
+			log15.Error("error")
+
+			bs, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatalf("Failed to read stderr. err: %s", err)
+			}
+			lvls := []string{}
+			for _, line := range bytes.Split(bytes.TrimSpace(bs), []byte("\n")) {
+				if len(line) == 0 {
+					continue
+				}
+				var r struct {
+					Lvl string `json:"lvl"`
+				}
+				if err := json.Unmarshal(line, &r); err != nil {
+					t.Fatalf("Failed to unmarshal %s. err: %s", line, err)
+				}
+				lvls = append(lvls, r.Lvl)
+			}
+			if !reflect.DeepEqual(lvls, tt.want) {
+				t.Errorf("expected: %q, actual: %q", tt.want, lvls)
+			}
+		})
+	}
+}
+
+func TestSetLoggerFile(t *testing.T) {
+	defer func() {
+		log15.Root().SetHandler(log15.StderrHandler)
+		sqlLogger.SetHandler(log15.StderrHandler)
+	}()
+
+	dir := filepath.Join(t.TempDir(), "log")
+	for _, name := range []string{"fetch-redhat", ""} {
+		if err := SetLogger(true, dir, false, false, false, false, false, FileOption{Name: name}); err != nil {
+			t.Fatalf("Failed to SetLogger. err: %s", err)
+		}
+		log15.Info("to file")
+	}
+	for _, name := range []string{"fetch-redhat.log", "goval-dictionary.log"} {
+		bs, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to read log file. err: %s", err)
+		}
+		if !bytes.Contains(bs, []byte("to file")) {
+			t.Errorf("%s: expected: the log, actual: %q", name, bs)
+		}
+	}
+}
+
+func TestSetLoggerSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		debugSQL bool
+		sql      bool
+		// wantLog and wantSQL are the messages in fetch-redhat.log and sql.log, sql.log not created if wantSQL is nil
+		wantLog []string
+		wantSQL []string
+	}{
+		{name: "to log file", debugSQL: true, wantLog: []string{"info", "SQL", "Slow SQL"}},
+		{name: "to sql.log", debugSQL: true, sql: true, wantLog: []string{"info", "Slow SQL"}, wantSQL: []string{"SQL", "Slow SQL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				log15.Root().SetHandler(log15.StderrHandler)
+				sqlLogger.SetHandler(log15.StderrHandler)
+			}()
+
+			dir := t.TempDir()
+			if err := SetLogger(true, dir, false, tt.debugSQL, true, false, false, FileOption{Name: "fetch-redhat", SQL: tt.sql}); err != nil {
+				t.Fatalf("Failed to SetLogger. err: %s", err)
+			}
+			log15.Info("info")
+			SQL().Debug("SQL", "SQL", "SELECT 1")
+			SQL().Info("Slow SQL", "SQL", "SELECT 2")
+
+			for name, want := range map[string][]string{"fetch-redhat.log": tt.wantLog, "sql.log": tt.wantSQL} {
+				bs, err := os.ReadFile(filepath.Join(dir, name))
+				if want == nil {
+					if !os.IsNotExist(err) {
+						t.Errorf("%s: expected: not created, actual: %v", name, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Failed to read log file. err: %s", err)
+				}
+				msgs := []string{}
+				for _, line := range bytes.Split(bytes.TrimSpace(bs), []byte("\n")) {
+					var r struct {
+						Msg string `json:"msg"`
+					}
+					if err := json.Unmarshal(line, &r); err != nil {
+						t.Fatalf("Failed to unmarshal %s. err: %s", line, err)
+					}
+					msgs = append(msgs, r.Msg)
+				}
+				if !reflect.DeepEqual(msgs, want) {
+					t.Errorf("%s: expected: %q, actual: %q", name, want, msgs)
+				}
+			}
+		})
+	}
+}
+
+func TestSetLoggerFallback(t *testing.T) {
+	tmp := t.TempDir()
+	// the directories under the read-only one, or under a regular file, which is not writable even by root
+	readOnly := filepath.Join(tmp, "read-only")
+	if err := os.Mkdir(readOnly, 0500); err != nil {
+		t.Fatalf("Failed to create dir. err: %s", err)
+	}
+	file := filepath.Join(tmp, "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatalf("Failed to write file. err: %s", err)
+	}
+	unwritable := filepath.Join(file, "goval-dictionary")
+	if f, err := os.Create(filepath.Join(readOnly, "probe")); err == nil {
+		// root writes the read-only directory anyway
+		f.Close()
+		os.Remove(f.Name())
+	} else {
+		unwritable = filepath.Join(readOnly, "goval-dictionary")
+	}
+	state, temp := filepath.Join(tmp, "state", "goval-dictionary"), filepath.Join(tmp, "temp", "goval-dictionary")
+
+	tests := []struct {
+		name   string
+		logDir string
+		dirs   []string
+		// want is the directory of the log file, none if only to stderr
+		want    string
+		wantErr bool
+		// wantWarn is the substring of the warning to stderr, none if not warned
+		wantWarn string
+	}{
+		{name: "default", dirs: []string{state, temp}, want: state},
+		{name: "XDG_STATE_HOME", dirs: []string{unwritable, state, temp}, want: state, wantWarn: "logging to the fallback"},
+		{name: "temporary directory", dirs: []string{unwritable, unwritable, temp}, want: temp, wantWarn: "logging to the fallback"},
+		{name: "none writable", dirs: []string{unwritable, unwritable}, wantWarn: "logging only to stderr"},
+		{name: "log-dir given", logDir: unwritable, dirs: []string{state, temp}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr := os.Stderr
+			dirs := logDirs
+			defer func() {
+				os.Stderr = stderr
+				logDirs = dirs
+				log15.Root().SetHandler(log15.StderrHandler)
+				sqlLogger.SetHandler(log15.StderrHandler)
+			}()
+			f, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+			if err != nil {
+				t.Fatalf("Failed to create stderr. err: %s", err)
+			}
+			defer f.Close()
+			os.Stderr = f
+			logDirs = func() []string { return tt.dirs }
+			for _, dir := range []string{state, temp} {
+				if err := os.RemoveAll(dir); err != nil {
+					t.Fatalf("Failed to remove dir. err: %s", err)
+				}
+			}
+
+			// JSON to the stderr replaced, as the default handler of text writes the original one
+			err = SetLogger(true, tt.logDir, false, false, true, false, true, FileOption{Name: "fetch-redhat"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %t, actual: %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			log15.Info("logged")
+
+			for _, dir := range []string{state, temp} {
+				_, err := os.Stat(filepath.Join(dir, "fetch-redhat.log"))
+				if got := err == nil; got != (dir == tt.want) {
+					t.Errorf("%s: expected the log file: %t, actual: %t", dir, dir == tt.want, got)
+				}
+			}
+			bs, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatalf("Failed to read stderr. err: %s", err)
+			}
+			if tt.wantWarn == "" && bytes.Contains(bs, []byte(`"lvl":"warn"`)) || tt.wantWarn != "" && !bytes.Contains(bs, []byte(tt.wantWarn)) {
+				t.Errorf("expected: %q warned, actual: %s", tt.wantWarn, bs)
+			}
+			if !bytes.Contains(bs, []byte("logged")) {
+				t.Errorf("expected: logged to stderr, actual: %s", bs)
+			}
+		})
+	}
+}
+
+func TestLogDirs(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/var/lib/state")
+	dirs := logDirs()
+	want := []string{GetDefaultLogDir(), filepath.Join("/var/lib/state", "goval-dictionary"), filepath.Join(os.TempDir(), "goval-dictionary")}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("expected: %q, actual: %q", want, dirs)
+	}
+}
@@ -0,0 +1,219 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// FileOption is the option of the log file of SetLogger
+type FileOption struct {
+	// Name is the name of the log file without .log, e.g. fetch-redhat of the subcommand, goval-dictionary if empty
+	Name string
+	// MaxSize is the size in bytes the log file is rotated at, never rotated if 0
+	MaxSize int64
+	// MaxBackups is the number of the rotated files kept, e.g. fetch-redhat.log.1 the newest of them
+	MaxBackups int
+	// MaxAge removes the rotated files modified longer ago than it, never by age if 0
+	MaxAge time.Duration
+	// Compress gzips the rotated files, e.g. to fetch-redhat.log.1.gz
+	Compress bool
+	// SQL logs the SQL of SQL() to sql.log in the same directory apart, rotated alike, e.g. to keep the flood of --debug-sql out of the log file
+	SQL bool
+}
+
+// rotateWriter is the log file rotated when it reaches MaxSize, renaming it to path.1 and the rotated ones to path.2, path.3, ...
+// up to MaxBackups. Each subcommand writes the file of its own name, so the ones running at once never rotate the files of each other.
+// The file rotated by another process of the same subcommand is opened again instead of rotated twice.
+type rotateWriter struct {
+	path   string
+	option FileOption
+	now    func() time.Time
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+var _ io.WriteCloser = (*rotateWriter)(nil)
+
+// newRotateWriter opens the log file of path to be appended, rotated by option
+func newRotateWriter(path string, option FileOption) (*rotateWriter, error) {
+	w := &rotateWriter{path: path, option: option, now: time.Now}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotateWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return xerrors.Errorf("Failed to open a log file. err: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return xerrors.Errorf("Failed to stat a log file. err: %w", err)
+	}
+	w.f, w.size = f, fi.Size()
+	return nil
+}
+
+// Write appends p to the log file, rotating it first if p makes it exceed MaxSize. A record longer than MaxSize is written whole.
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.option.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.option.MaxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file
+func (w *rotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// rotate renames the log file to path.1 after shifting the rotated ones, and opens the new one
+func (w *rotateWriter) rotate() error {
+	cur, err := w.f.Stat()
+	if err != nil {
+		return xerrors.Errorf("Failed to stat a log file. err: %w", err)
+	}
+	if err := w.f.Close(); err != nil {
+		return xerrors.Errorf("Failed to close a log file. err: %w", err)
+	}
+
+	// rotated by another process already, e.g. fetch redhat run twice at once
+	if fi, err := os.Stat(w.path); err != nil || !os.SameFile(cur, fi) {
+		return w.open()
+	}
+
+	if w.option.MaxBackups <= 0 {
+		if err := os.Remove(w.path); err != nil {
+			return xerrors.Errorf("Failed to remove a log file. err: %w", err)
+		}
+		return w.open()
+	}
+
+	for i := w.option.MaxBackups; i > 0; i-- {
+		for _, ext := range []string{"", ".gz"} {
+			src := w.backup(i) + ext
+			if _, err := os.Stat(src); err != nil {
+				continue
+			}
+			if i == w.option.MaxBackups {
+				if err := os.Remove(src); err != nil {
+					return xerrors.Errorf("Failed to remove a rotated log file. err: %w", err)
+				}
+				continue
+			}
+			if err := os.Rename(src, w.backup(i+1)+ext); err != nil {
+				return xerrors.Errorf("Failed to rename a rotated log file. err: %w", err)
+			}
+		}
+	}
+	if err := os.Rename(w.path, w.backup(1)); err != nil {
+		return xerrors.Errorf("Failed to rename a log file. err: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	if w.option.Compress {
+		if err := compress(w.backup(1)); err != nil {
+			return err
+		}
+	}
+	if w.option.MaxAge > 0 {
+		if err := w.removeOld(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backup returns the path of the i-th rotated file without .gz, e.g. fetch-redhat.log.1
+func (w *rotateWriter) backup(i int) string {
+	return fmt.Sprintf("%s.%d", w.path, i)
+}
+
+// removeOld removes the rotated files modified before MaxAge ago
+func (w *rotateWriter) removeOld() error {
+	matches, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return xerrors.Errorf("Failed to glob rotated log files. err: %w", err)
+	}
+	cutoff := w.now().Add(-w.option.MaxAge)
+	for _, m := range matches {
+		if _, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(m, w.path+"."), ".gz")); err != nil {
+			continue
+		}
+		fi, err := os.Stat(m)
+		if err != nil || !fi.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(m); err != nil {
+			return xerrors.Errorf("Failed to remove a rotated log file. err: %w", err)
+		}
+	}
+	return nil
+}
+
+// compress gzips path to path.gz, removing path, and keeps its modification time for MaxAge
+func compress(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return xerrors.Errorf("Failed to open a rotated log file. err: %w", err)
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return xerrors.Errorf("Failed to stat a rotated log file. err: %w", err)
+	}
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return xerrors.Errorf("Failed to create a compressed log file. err: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(dst.Name())
+		}
+	}()
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return xerrors.Errorf("Failed to compress a rotated log file. err: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return xerrors.Errorf("Failed to compress a rotated log file. err: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return xerrors.Errorf("Failed to close a compressed log file. err: %w", err)
+	}
+	if err := os.Chtimes(dst.Name(), fi.ModTime(), fi.ModTime()); err != nil {
+		return xerrors.Errorf("Failed to set the time of a compressed log file. err: %w", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return xerrors.Errorf("Failed to remove a rotated log file. err: %w", err)
+	}
+	return nil
+}
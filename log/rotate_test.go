@@ -0,0 +1,196 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rotatedFiles returns the names of the files in dir, sorted
+func rotatedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read dir. err: %s", err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readLog returns the content of the log file, gunzipped if of .gz
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file. err: %s", err)
+	}
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(bs))
+		if err != nil {
+			t.Fatalf("Failed to gunzip %s. err: %s", path, err)
+		}
+		if bs, err = io.ReadAll(zr); err != nil {
+			t.Fatalf("Failed to gunzip %s. err: %s", path, err)
+		}
+	}
+	return string(bs)
+}
+
+func TestRotateWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		option FileOption
+		want   []string
+		// wantLast is the content of fetch-redhat.log.1, the newest rotated one
+		wantLast string
+	}{
+		{
+			name:     "size",
+			option:   FileOption{MaxSize: 30, MaxBackups: 2},
+			want:     []string{"fetch-redhat.log", "fetch-redhat.log.1", "fetch-redhat.log.2"},
+			wantLast: "line 07\nline 08\nline 09\n",
+		},
+		{
+			name:     "compress",
+			option:   FileOption{MaxSize: 30, MaxBackups: 2, Compress: true},
+			want:     []string{"fetch-redhat.log", "fetch-redhat.log.1.gz", "fetch-redhat.log.2.gz"},
+			wantLast: "line 07\nline 08\nline 09\n",
+		},
+		{
+			name:   "no backups",
+			option: FileOption{MaxSize: 30},
+			want:   []string{"fetch-redhat.log"},
+		},
+		{
+			name:   "never rotated",
+			option: FileOption{MaxBackups: 2},
+			want:   []string{"fetch-redhat.log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w, err := newRotateWriter(filepath.Join(dir, "fetch-redhat.log"), tt.option)
+			if err != nil {
+				t.Fatalf("Failed to open. err: %s", err)
+			}
+			defer w.Close()
+
+			// 8 bytes per line, 3 lines per file of 30 bytes
+			for i := 1; i <= 11; i++ {
+				if _, err := fmt.Fprintf(w, "line %02d\n", i); err != nil {
+					t.Fatalf("Failed to write. err: %s", err)
+				}
+			}
+
+			if got := rotatedFiles(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected: %q, actual: %q", tt.want, got)
+			}
+			if tt.wantLast != "" {
+				if got := readLog(t, filepath.Join(dir, tt.want[1])); got != tt.wantLast {
+					t.Errorf("expected: %q, actual: %q", tt.wantLast, got)
+				}
+			}
+			if tt.option.MaxSize > 0 {
+				if got := readLog(t, filepath.Join(dir, "fetch-redhat.log")); got != "line 10\nline 11\n" {
+					t.Errorf("expected: the lines after the last rotation, actual: %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestRotateWriterMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.log")
+	w, err := newRotateWriter(path, FileOption{MaxSize: 10, MaxBackups: 5, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to open. err: %s", err)
+	}
+	defer w.Close()
+
+	if _, err := w.Write([]byte("old line\n")); err != nil {
+		t.Fatalf("Failed to write. err: %s", err)
+	}
+	if _, err := w.Write([]byte("new line\n")); err != nil {
+		t.Fatalf("Failed to write. err: %s", err)
+	}
+	// server.log.1 of old line modified 2 hours ago
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path+".1", old, old); err != nil {
+		t.Fatalf("Failed to chtimes. err: %s", err)
+	}
+
+	if _, err := w.Write([]byte("last line\n")); err != nil {
+		t.Fatalf("Failed to write. err: %s", err)
+	}
+	want := []string{"server.log", "server.log.1"}
+	if got := rotatedFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected: %q, actual: %q", want, got)
+	}
+	if got := readLog(t, path+".1"); got != "new line\n" {
+		t.Errorf("expected: the old one removed, actual: %q in server.log.1", got)
+	}
+}
+
+func TestRotateWriterConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"fetch-redhat", "fetch-debian"}
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		w, err := newRotateWriter(filepath.Join(dir, name+".log"), FileOption{MaxSize: 100, MaxBackups: 3})
+		if err != nil {
+			t.Fatalf("Failed to open. err: %s", err)
+		}
+		defer w.Close()
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(w *rotateWriter, name string) {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					if _, err := fmt.Fprintf(w, "%s\n", name); err != nil {
+						t.Errorf("Failed to write. err: %s", err)
+						return
+					}
+				}
+			}(w, name)
+		}
+	}
+	wg.Wait()
+
+	want := []string{}
+	for _, name := range names {
+		want = append(want, name+".log", name+".log.1", name+".log.2", name+".log.3")
+	}
+	sort.Strings(want)
+	if got := rotatedFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected: %q, actual: %q", want, got)
+	}
+	// every file is of its own subcommand only, in the whole lines, within the cap
+	for _, f := range want {
+		content := readLog(t, filepath.Join(dir, f))
+		if len(content) > 100 {
+			t.Errorf("%s: expected: within 100 bytes, actual: %d bytes", f, len(content))
+		}
+		name := strings.SplitN(f, ".", 2)[0]
+		for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+			if line != name {
+				t.Errorf("%s: expected: %q, actual: %q", f, name, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package log
+
+import "github.com/inconshreveable/log15"
+
+// sqlLogger is the logger of the SQL executed by the DB, tagged by Module=sql, of its own handler set by SetLogger
+var sqlLogger = log15.Root().New("Module", "sql")
+
+// SQL returns the logger of the SQL executed by the DB, e.g. of the gorm logger of --debug-sql and --slow-query-threshold,
+// which logs the statements to stderr by --debug-sql even without --debug, and to sql.log apart by FileOption.SQL
+func SQL() log15.Logger {
+	return sqlLogger
+}
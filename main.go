@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/vulsio/goval-dictionary/commands"
 )
@@ -11,13 +14,24 @@ import (
 // Name ... Name
 const Name string = "goval-dictionary"
 
+// exitInterrupted is the status on SIGINT/SIGTERM, as the shells report a command killed by SIGINT
+const exitInterrupted = 130
+
 func main() {
 	if envArgs := os.Getenv("GOVAL_DICTIONARY_ARGS"); 0 < len(envArgs) {
 		commands.RootCmd.SetArgs(strings.Fields(envArgs))
 	}
 
-	if err := commands.RootCmd.Execute(); err != nil {
+	// SIGINT/SIGTERM cancels the context, which stops the downloads and rolls back the insert in progress
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := commands.RootCmd.ExecuteContext(ctx)
+	interrupted := ctx.Err() != nil
+	stop()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		if interrupted {
+			os.Exit(exitInterrupted)
+		}
+		os.Exit(commands.ExitCode(err))
 	}
 }
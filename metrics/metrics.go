@@ -0,0 +1,268 @@
+// Package metrics has the counters, the gauges and the histograms written in the text format of Prometheus,
+// scraped from /metrics of the server and pushed to Pushgateway by the fetch commands
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// ContentType is the media type of the text format of Prometheus
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds in seconds of the buckets of the histograms of the durations, from 5ms to 10s
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry of the metrics of the process, e.g. of the requests of the server and the queries of DB
+var Default = NewRegistry()
+
+// Registry has the metrics written in the order of their registration
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*metric
+}
+
+// NewRegistry returns the registry of no metric
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// metric is a metric of its series by the values of the labels
+type metric struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64 // of the histogram
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // of the histogram, by bucket, not cumulative
+	count       uint64
+}
+
+func (r *Registry) register(name, help, typ string, buckets []float64, labels []string) *metric {
+	m := &metric{name: name, help: help, typ: typ, labels: labels, buckets: buckets, series: map[string]*series{}}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, registered := range r.metrics {
+		if registered.name == name {
+			panic(fmt.Sprintf("metric %s is already registered", name))
+		}
+	}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// get returns the series of labelValues, which must be as many as the labels
+func (m *metric) get(labelValues []string) *series {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, but %d values are given", m.name, len(m.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		if m.buckets != nil {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Counter is the counter of the series by the values of its labels
+type Counter struct{ m *metric }
+
+// NewCounter registers the counter of name, which ends with _total by convention
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{m: r.register(name, help, "counter", nil, labels)}
+}
+
+// Inc adds 1 to the series of labelValues
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series of labelValues
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.m.name))
+	}
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	c.m.get(labelValues).value += v
+}
+
+// Gauge is the gauge of the series by the values of its labels
+type Gauge struct{ m *metric }
+
+// NewGauge registers the gauge of name
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{m: r.register(name, help, "gauge", nil, labels)}
+}
+
+// Set sets the series of labelValues to v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.m.mu.Lock()
+	defer g.m.mu.Unlock()
+	g.m.get(labelValues).value = v
+}
+
+// Reset removes all the series, e.g. to set the ones of the OVAL stored now, without the purged one
+func (g *Gauge) Reset() {
+	g.m.mu.Lock()
+	defer g.m.mu.Unlock()
+	g.m.series = map[string]*series{}
+}
+
+// Histogram is the histogram of the series by the values of its labels
+type Histogram struct{ m *metric }
+
+// NewHistogram registers the histogram of name with the upper bounds of buckets in ascending order, to which +Inf is added
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets of histogram %s are not sorted", name))
+	}
+	return &Histogram{m: r.register(name, help, "histogram", append([]float64{}, buckets...), labels)}
+}
+
+// Observe adds v, e.g. the duration in seconds, to the series of labelValues
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	s := h.m.get(labelValues)
+	if i := sort.SearchFloat64s(h.m.buckets, v); i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.count++
+	s.value += v
+}
+
+// Write writes the metrics in the text format of Prometheus, their series sorted by the values of the labels
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]*metric{}, r.metrics...)
+	r.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		m.write(&buf)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return xerrors.Errorf("Failed to write metrics. err: %w", err)
+	}
+	return nil
+}
+
+func (m *metric) write(buf *bytes.Buffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(buf, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", m.name, m.typ)
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := m.series[k]
+		if m.typ != "histogram" {
+			fmt.Fprintf(buf, "%s%s %s\n", m.name, labelPairs(m.labels, s.labelValues), formatFloat(s.value))
+			continue
+		}
+		le := append(append([]string{}, m.labels...), "le")
+		bucket := func(upper string) string {
+			return labelPairs(le, append(append([]string{}, s.labelValues...), upper))
+		}
+		var cumulative uint64
+		for i, b := range m.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", m.name, bucket(formatFloat(b)), cumulative)
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", m.name, bucket("+Inf"), s.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", m.name, labelPairs(m.labels, s.labelValues), formatFloat(s.value))
+		fmt.Fprintf(buf, "%s_count%s %d\n", m.name, labelPairs(m.labels, s.labelValues), s.count)
+	}
+}
+
+// labelPairs returns the labels of the series, e.g. {family="redhat",release="8"}, or nothing if none
+func labelPairs(labels, values []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels))
+	for i, l := range labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l, escapeLabelValue(values[i])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler returns the handler responding the metrics of r to the scrapes of Prometheus
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_ = r.Write(w)
+	})
+}
+
+// Push replaces the metrics of job in Pushgateway of gatewayURL with the ones of r, e.g. the summary of the run of a batch job
+func (r *Registry) Push(ctx context.Context, gatewayURL, job string) error {
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		return err
+	}
+	u := strings.TrimSuffix(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, &buf)
+	if err != nil {
+		return xerrors.Errorf("Failed to create request. url: %s, err: %w", u, err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return xerrors.Errorf("Failed to push metrics. url: %s, err: %w", u, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return xerrors.Errorf("Failed to push metrics. url: %s, status: %s, body: %s", u, res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "The requests.", "route", "status")
+	age := r.NewGauge("age_seconds", "The age\nof the OVAL.", "family")
+	duration := r.NewHistogram("duration_seconds", "The durations.", []float64{0.1, 1})
+	r.NewGauge("empty", "No series.")
+
+	requests.Inc("/packs/:family", "200")
+	requests.Add(2, "/packs/:family", "200")
+	requests.Inc(`/cves/"x"`, "500")
+	age.Set(10, "redhat")
+	age.Set(5, "debian")
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		duration.Observe(v)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("Failed to Write. err: %s", err)
+	}
+	want := `# HELP requests_total The requests.
+# TYPE requests_total counter
+requests_total{route="/cves/\"x\"",status="500"} 1
+requests_total{route="/packs/:family",status="200"} 3
+# HELP age_seconds The age\nof the OVAL.
+# TYPE age_seconds gauge
+age_seconds{family="debian"} 5
+age_seconds{family="redhat"} 10
+# HELP duration_seconds The durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="0.1"} 2
+duration_seconds_bucket{le="1"} 3
+duration_seconds_bucket{le="+Inf"} 4
+duration_seconds_sum 3.65
+duration_seconds_count 4
+# HELP empty No series.
+# TYPE empty gauge
+`
+	if buf.String() != want {
+		t.Errorf("expected: %s, actual: %s", want, buf.String())
+	}
+
+	// the gauges of the purged OVAL are removed
+	age.Reset()
+	buf.Reset()
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("Failed to Write. err: %s", err)
+	}
+	if strings.Contains(buf.String(), "age_seconds{") {
+		t.Errorf("expected: no series of age_seconds, actual: %s", buf.String())
+	}
+}
+
+func TestRegistryPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "pushed", status: http.StatusOK},
+		{name: "rejected", status: http.StatusBadRequest, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method, path, contentType, body string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				bs, _ := io.ReadAll(req.Body)
+				method, path, contentType, body = req.Method, req.URL.Path, req.Header.Get("Content-Type"), string(bs)
+				w.WriteHeader(tt.status)
+			}))
+			defer ts.Close()
+
+			r := NewRegistry()
+			r.NewGauge("last_run_timestamp_seconds", "The last run.").Set(1688601600)
+			err := r.Push(context.Background(), ts.URL+"/", "goval-dictionary-fetch")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %t, actual: %v", tt.wantErr, err)
+			}
+			if method != http.MethodPut || path != "/metrics/job/goval-dictionary-fetch" || contentType != ContentType {
+				t.Errorf("expected: PUT /metrics/job/goval-dictionary-fetch in %s, actual: %s %s in %s", ContentType, method, path, contentType)
+			}
+			if !strings.Contains(body, "last_run_timestamp_seconds 1.6886016e+09\n") {
+				t.Errorf("expected: the gauge pushed, actual: %s", body)
+			}
+		})
+	}
+}
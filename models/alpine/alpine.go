@@ -5,21 +5,30 @@ import (
 	"strings"
 	"time"
 
-	"github.com/spf13/viper"
-
 	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/util"
 )
 
-// ConvertToModel Convert OVAL to models
-func ConvertToModel(data *SecDB) (defs []models.Definition) {
+// ConvertToModel Convert OVAL to models, a definition of each CVE, with the stat of the vulnerability IDs of the fixes
+func ConvertToModel(data *SecDB) (defs []models.Definition, stat models.ConvertStat) {
 	cveIDPacks := map[string][]models.Package{}
+	notCVEs := map[string]struct{}{}
 	for _, pack := range data.Packages {
 		for ver, vulnIDs := range pack.Pkg.Secfixes {
 			for _, s := range vulnIDs {
-				cveID := strings.Split(s, " ")[0]
-				if !strings.HasPrefix(cveID, "CVE") {
+				// the ID may be followed by a comment after the space
+				raw := strings.Split(strings.TrimSpace(s), " ")[0]
+				cveID, ok := util.NormalizeCveID(raw)
+				if !ok {
+					if _, ok := notCVEs[raw]; !ok && raw != "" {
+						notCVEs[raw] = struct{}{}
+						stat.Skip(raw, models.SkipNotCVE)
+					}
 					continue
 				}
+				if cveID != raw {
+					stat.CvesNormalized++
+				}
 
 				if packs, ok := cveIDPacks[cveID]; ok {
 					packs = append(packs, models.Package{
@@ -40,6 +49,7 @@ func ConvertToModel(data *SecDB) (defs []models.Definition) {
 	for cveID, packs := range cveIDPacks {
 		def := models.Definition{
 			DefinitionID: fmt.Sprintf("def-%s-%s-%s", data.Reponame, data.Distroversion, cveID),
+			Class:        models.ClassVulnerability,
 			Title:        cveID,
 			Description:  "",
 			Advisory: models.Advisory{
@@ -61,17 +71,7 @@ func ConvertToModel(data *SecDB) (defs []models.Definition) {
 			},
 		}
 
-		if viper.GetBool("no-details") {
-			def.Title = ""
-			def.Description = ""
-			def.Advisory.Severity = ""
-			def.Advisory.Bugzillas = []models.Bugzilla{}
-			def.Advisory.AffectedCPEList = []models.Cpe{}
-			def.Advisory.Issued = time.Time{}
-			def.Advisory.Updated = time.Time{}
-			def.References = []models.Reference{}
-		}
-
+		stat.Convert()
 		defs = append(defs, def)
 	}
 	return
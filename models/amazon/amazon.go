@@ -2,19 +2,20 @@ package amazon
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
-	"time"
 
-	"github.com/spf13/viper"
+	"github.com/inconshreveable/log15"
 
 	"github.com/vulsio/goval-dictionary/models"
 	"github.com/vulsio/goval-dictionary/models/util"
 )
 
-// ConvertToModel Convert OVAL to models
-func ConvertToModel(data *Updates) (defs []models.Definition) {
+// ConvertToModel Convert OVAL to models, only of the advisories issued in years, with the stat of the advisories
+func ConvertToModel(data *Updates, years util.YearRange) (defs []models.Definition, stat models.ConvertStat) {
 	for _, alas := range data.UpdateList {
 		if strings.Contains(alas.Description, "** REJECT **") {
+			stat.Skip("def-"+alas.ID, models.SkipRejected)
 			continue
 		}
 
@@ -30,11 +31,13 @@ func ConvertToModel(data *Updates) (defs []models.Definition) {
 		for _, pack := range alas.Packages {
 			packs = append(packs, models.Package{
 				Name:    pack.Name,
-				Version: fmt.Sprintf("%s:%s-%s", pack.Epoch, pack.Version, pack.Release),
+				Version: util.NormalizeEVR(fmt.Sprintf("%s:%s-%s", pack.Epoch, pack.Version, pack.Release)),
 				Arch:    pack.Arch,
 			})
 		}
 
+		cves, rerouted := util.NormalizeCves(cves, &stat)
+
 		refs := []models.Reference{}
 		for _, ref := range alas.References {
 			refs = append(refs, models.Reference{
@@ -43,15 +46,24 @@ func ConvertToModel(data *Updates) (defs []models.Definition) {
 				RefURL: ref.Href,
 			})
 		}
+		refs = append(refs, rerouted...)
 
 		issuedAt := util.ParsedOrDefaultTime([]string{"2006-01-02 15:04"}, alas.Issued.Date)
+		if !years.Contains(issuedAt) {
+			stat.Skip("def-"+alas.ID, models.SkipOutOfYears)
+			continue
+		}
 		updatedAt := util.ParsedOrDefaultTime([]string{"2006-01-02 15:04"}, alas.Updated.Date)
+		normalized := util.NormalizeReferences(refs)
 
 		def := models.Definition{
 			DefinitionID: "def-" + alas.ID,
+			Class:        models.ClassPatch,
 			Title:        alas.ID,
-			Description:  alas.Description,
+			Description:  strings.TrimSpace(alas.Description),
 			Advisory: models.Advisory{
+				AdvisoryID:         alas.ID,
+				AdvisoryURL:        util.AdvisoryURL(alas.ID, normalized, alasURL),
 				Severity:           alas.Severity,
 				Cves:               cves,
 				Bugzillas:          []models.Bugzilla{},
@@ -62,21 +74,32 @@ func ConvertToModel(data *Updates) (defs []models.Definition) {
 			},
 			Debian:        nil,
 			AffectedPacks: packs,
-			References:    refs,
-		}
-
-		if viper.GetBool("no-details") {
-			def.Title = ""
-			def.Description = ""
-			def.Advisory.Severity = ""
-			def.Advisory.Bugzillas = []models.Bugzilla{}
-			def.Advisory.AffectedCPEList = []models.Cpe{}
-			def.Advisory.Issued = time.Time{}
-			def.Advisory.Updated = time.Time{}
-			def.References = []models.Reference{}
+			References:    normalized,
 		}
 
+		stat.Convert()
 		defs = append(defs, def)
 	}
+	if !years.IsZero() {
+		log15.Info("Filtered by the issued year", "From", years.From, "To", years.To, "Filtered", stat.Skipped[models.SkipOutOfYears])
+	}
 	return
 }
+
+// alasID matches the ID of ALAS by the release prefixed, e.g. ALAS-2023-1712 of Amazon Linux AMI, ALAS2-2023-2000 of Amazon Linux 2,
+// ALAS2KERNEL-5.10-2023-030 of its extras and ALAS2023-2023-100 of Amazon Linux 2023
+var alasID = regexp.MustCompile(`^ALAS(2022|2023|2)?(.+)$`)
+
+// alasURL returns the URL of the advisory of ALAS id in the directory of the release without the release in the ID,
+// e.g. https://alas.aws.amazon.com/AL2/ALAS-2023-2000.html of ALAS2-2023-2000, or empty if id is not of ALAS
+func alasURL(id string) string {
+	m := alasID.FindStringSubmatch(id)
+	if m == nil {
+		return ""
+	}
+	dir := ""
+	if m[1] != "" {
+		dir = "AL" + m[1] + "/"
+	}
+	return "https://alas.aws.amazon.com/" + dir + "ALAS" + m[2] + ".html"
+}
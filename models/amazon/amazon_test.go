@@ -0,0 +1,56 @@
+package amazon
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	"github.com/vulsio/goval-dictionary/models/util"
+)
+
+func TestConvertToModelAdvisoryURL(t *testing.T) {
+	in := `<updates>
+  <update type="security">
+    <id>ALAS2-2023-2000</id>
+    <severity>important</severity>
+    <references>
+      <reference href="https://alas.aws.amazon.com/AL2/ALAS-2023-2000.html" id="ALAS2-2023-2000" type="self"/>
+    </references>
+  </update>
+  <update type="security">
+    <id>ALAS2023-2023-100</id>
+    <severity>medium</severity>
+    <references>
+      <reference href="https://alas.aws.amazon.com/AL2023/ALAS-2023-100.html?from=updateinfo" id="ALAS2023-2023-100" type="self"/>
+    </references>
+  </update>
+  <update type="security">
+    <id>ALAS-2023-1712</id>
+    <severity>low</severity>
+  </update>
+  <update type="security">
+    <id>ALAS2KERNEL-5.10-2023-030</id>
+    <severity>important</severity>
+  </update>
+</updates>`
+	var updates Updates
+	if err := xml.Unmarshal([]byte(in), &updates); err != nil {
+		t.Fatalf("Failed to unmarshal. err: %s", err)
+	}
+
+	got := map[string]string{}
+	defs, _ := ConvertToModel(&updates, util.YearRange{})
+	for _, d := range defs {
+		got[d.DefinitionID] = d.Advisory.AdvisoryURL
+	}
+	want := map[string]string{
+		"def-ALAS2-2023-2000": "https://alas.aws.amazon.com/AL2/ALAS-2023-2000.html",
+		// the reference of the advisory wins over alasURL
+		"def-ALAS2023-2023-100":         "https://alas.aws.amazon.com/AL2023/ALAS-2023-100.html?from=updateinfo",
+		"def-ALAS-2023-1712":            "https://alas.aws.amazon.com/ALAS-2023-1712.html",
+		"def-ALAS2KERNEL-5.10-2023-030": "https://alas.aws.amazon.com/AL2/ALASKERNEL-5.10-2023-030.html",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
@@ -1,11 +1,10 @@
 package debian
 
 import (
+	"regexp"
 	"strings"
 	"time"
 
-	"github.com/spf13/viper"
-
 	"github.com/vulsio/goval-dictionary/models"
 	"github.com/vulsio/goval-dictionary/models/util"
 )
@@ -15,13 +14,17 @@ type distroPackage struct {
 	pack  models.Package
 }
 
-// ConvertToModel Convert OVAL to models
-func ConvertToModel(root *Root) (defs []models.Definition) {
+// ConvertToModel Convert OVAL to models, attributing the affected packages to the release osVer, with the stat of the definitions
+func ConvertToModel(osVer string, root *Root) (defs []models.Definition, stat models.ConvertStat) {
+	tests := parseTests(*root)
 	for _, ovaldef := range root.Definitions.Definitions {
 		if strings.Contains(ovaldef.Description, "** REJECT **") {
+			stat.Skip(ovaldef.ID, models.SkipRejected)
 			continue
 		}
 
+		defID := util.DefinitionID(ovaldef.ID, ovaldef.Title, &stat)
+
 		cves := []models.Cve{}
 		rs := []models.Reference{}
 		for _, r := range ovaldef.References {
@@ -38,12 +41,16 @@ func ConvertToModel(root *Root) (defs []models.Definition) {
 				RefURL: r.RefURL,
 			})
 		}
+		cves, rerouted := util.NormalizeCves(cves, &stat)
+		rs = append(rs, rerouted...)
 
 		def := models.Definition{
-			DefinitionID: ovaldef.ID,
-			Title:        ovaldef.Title,
-			Description:  ovaldef.Description,
+			DefinitionID: defID,
+			Class:        strings.TrimSpace(ovaldef.Class),
+			Title:        strings.TrimSpace(ovaldef.Title),
+			Description:  strings.TrimSpace(ovaldef.Description),
 			Advisory: models.Advisory{
+				AdvisoryID:      dsaID(ovaldef),
 				Severity:        "",
 				Cves:            cves,
 				Bugzillas:       []models.Bugzilla{},
@@ -52,69 +59,162 @@ func ConvertToModel(root *Root) (defs []models.Definition) {
 				Updated:         time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC),
 			},
 			Debian: &models.Debian{
-				MoreInfo: ovaldef.Debian.MoreInfo,
+				DSA:      strings.TrimSpace(ovaldef.Debian.DSA),
+				MoreInfo: strings.TrimSpace(ovaldef.Debian.MoreInfo),
 				Date:     util.ParsedOrDefaultTime([]string{"2006-01-02"}, ovaldef.Debian.Date),
 			},
-			AffectedPacks: collectDebianPacks(ovaldef.Criteria),
-			References:    rs,
-		}
-
-		if viper.GetBool("no-details") {
-			def.Title = ""
-			def.Description = ""
-			def.Advisory.Severity = ""
-			def.Advisory.Bugzillas = []models.Bugzilla{}
-			def.Advisory.AffectedCPEList = []models.Cpe{}
-			def.Advisory.Issued = time.Time{}
-			def.Advisory.Updated = time.Time{}
-			def.Debian = nil
-			def.References = []models.Reference{}
+			AffectedPacks: collectDebianPacks(osVer, ovaldef.Criteria, tests),
+			References:    util.NormalizeReferences(rs),
 		}
 
+		stat.Convert()
 		defs = append(defs, def)
 	}
 	return
 }
 
-func collectDebianPacks(cri Criteria) []models.Package {
-	distPacks := walkDebian(cri, "", []distroPackage{})
-	packs := make([]models.Package, len(distPacks))
-	for i, distPack := range distPacks {
-		packs[i] = distPack.pack
+// dsaPattern matches the ID of DSA, e.g. DSA-3981-1, and DSA-2919 of the old definitions without the revision
+var dsaPattern = regexp.MustCompile(`(?i)\bDSA-\d+(?:-\d+)?\b`)
+
+// dsaID returns the ID of DSA of def, uppercased, of the dsa of its metadata, of its references or of its moreinfo and description in the order,
+// or "" if none, e.g. of the CVE not fixed by any DSA
+func dsaID(def Definition) string {
+	texts := []string{def.Debian.DSA}
+	for _, r := range def.References {
+		texts = append(texts, r.RefID)
+	}
+	texts = append(texts, def.Debian.MoreInfo, def.Description)
+	for _, text := range texts {
+		if id := dsaPattern.FindString(text); id != "" {
+			return strings.ToUpper(id)
+		}
+	}
+	return ""
+}
+
+// dpkgInfoTest is the package and its fixed version of dpkginfo_test, of the object and the state it refers to
+type dpkgInfoTest struct {
+	Name         string
+	FixedVersion string
+}
+
+// parseTests returns the dpkginfo_tests by their IDs, of the ones of which both the object and the state are found
+func parseTests(root Root) map[string]dpkgInfoTest {
+	objs := map[string]string{}
+	for _, obj := range root.Objects.DpkginfoObject {
+		objs[obj.ID] = strings.TrimSpace(obj.Name)
+	}
+	states := map[string]string{}
+	for _, state := range root.States.DpkginfoState {
+		states[state.ID] = strings.TrimSpace(state.Evr.Text)
+	}
+
+	tests := map[string]dpkgInfoTest{}
+	for _, test := range root.Tests.DpkginfoTest {
+		name, ok := objs[test.Object.ObjectRef]
+		if !ok || name == "" {
+			continue
+		}
+		ver, ok := states[test.State.StateRef]
+		if !ok || ver == "" {
+			continue
+		}
+		tests[test.ID] = dpkgInfoTest{Name: name, FixedVersion: ver}
+	}
+	return tests
+}
+
+// collectDebianPacks returns the packages fixed in the release osVer, each paired with the fixed version of its own test,
+// once for each pair even if it is in several architecture sections.
+// The packages fixed only in other releases (e.g. unstable) are still vulnerable in osVer, so they are marked as not fixed yet.
+func collectDebianPacks(osVer string, cri Criteria, tests map[string]dpkgInfoTest) []models.Package {
+	packs := []models.Package{}
+	fixed := map[string]struct{}{}
+	seen := map[models.Package]struct{}{}
+	others := []string{}
+	for _, distPack := range walkDebian(cri, "", tests, []distroPackage{}) {
+		// no release section means that the packages are for the release of the OVAL file
+		if distPack.osVer == "" || distPack.osVer == osVer {
+			fixed[distPack.pack.Name] = struct{}{}
+			if _, ok := seen[distPack.pack]; ok {
+				continue
+			}
+			seen[distPack.pack] = struct{}{}
+			packs = append(packs, distPack.pack)
+			continue
+		}
+		others = append(others, distPack.pack.Name)
+	}
+
+	for _, name := range others {
+		if _, ok := fixed[name]; ok {
+			continue
+		}
+		fixed[name] = struct{}{}
+		packs = append(packs, models.Package{
+			Name:        name,
+			NotFixedYet: true,
+		})
 	}
 	return packs
 }
 
-func walkDebian(cri Criteria, osVer string, acc []distroPackage) []distroPackage {
+// debianRelease returns the major version of the release criterion, e.g. "Debian 8.2 is installed", "Debian GNU/Linux 9 is installed" -> "8", "9"
+func debianRelease(comment string) string {
+	v := strings.TrimSuffix(strings.TrimPrefix(comment, "Debian "), " is installed")
+	v = strings.TrimPrefix(v, "GNU/Linux ")
+	v, _, _ = strings.Cut(v, ".")
+	return v
+}
+
+// walkDebian returns the packages of the criterions in cri and its branches, attributed to the release of the release criterion
+// of the innermost branch having one, wherever it is among the criterions of the branch, or osVer of the outer one.
+// The package and its fixed version are of the dpkginfo_test the criterion refers to, or of its comment if the test is not found.
+func walkDebian(cri Criteria, osVer string, tests map[string]dpkgInfoTest, acc []distroPackage) []distroPackage {
 	for _, c := range cri.Criterions {
 		if strings.HasPrefix(c.Comment, "Debian ") &&
 			strings.HasSuffix(c.Comment, " is installed") {
-			osVer = strings.TrimSuffix(strings.TrimPrefix(c.Comment, "Debian "), " is installed")
+			osVer = debianRelease(c.Comment)
 		}
-		ss := strings.Split(c.Comment, " DPKG is earlier than ")
-		if len(ss) != 2 {
+	}
+
+	for _, c := range cri.Criterions {
+		name, ver, ok := packageOf(c, tests)
+		if !ok {
 			continue
 		}
 
 		// "0" means notyetfixed or erroneous information.
 		// Not available because "0" includes erroneous info...
-		if ss[1] == "0" {
+		version, raw := util.NormalizedVersion(ver, util.NormalizeDebianVersion)
+		if version == "0" {
 			continue
 		}
 		acc = append(acc, distroPackage{
 			osVer: osVer,
 			pack: models.Package{
-				Name:    ss[0],
-				Version: strings.Split(ss[1], " ")[0],
+				Name:       name,
+				Version:    version,
+				RawVersion: raw,
 			},
 		})
 	}
 
-	if len(cri.Criterias) == 0 {
-		return acc
-	}
 	for _, c := range cri.Criterias {
-		acc = walkDebian(c, osVer, acc)
+		acc = walkDebian(c, osVer, tests, acc)
 	}
 	return acc
 }
+
+// packageOf returns the package and its fixed version of the criterion, by its dpkginfo_test or by its comment,
+// e.g. "openssl DPKG is earlier than 3.0.9-1"
+func packageOf(c Criterion, tests map[string]dpkgInfoTest) (name, ver string, ok bool) {
+	if t, ok := tests[c.TestRef]; ok {
+		return t.Name, t.FixedVersion, true
+	}
+	ss := strings.Split(c.Comment, " DPKG is earlier than ")
+	if len(ss) != 2 {
+		return "", "", false
+	}
+	return ss[0], strings.Split(ss[1], " ")[0], true
+}
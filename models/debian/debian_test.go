@@ -4,19 +4,14 @@ import (
 	"encoding/xml"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/k0kubun/pp"
 
 	"github.com/vulsio/goval-dictionary/models"
 )
 
-func TestWalkDebian(t *testing.T) {
-	var tests = []struct {
-		oval     string
-		expected []models.Package
-	}{
-		{
-			oval: `
+const walkDebianOVAL = `
 <?xml version="1.0" ?>
 <oval_definitions>
 	<generator>
@@ -85,16 +80,42 @@ Critical Patch Update advisory for further details:
 		</definition>
 	</definitions>
 </oval_definitions>
-			`,
+			`
+
+func TestWalkDebian(t *testing.T) {
+	var tests = []struct {
+		osVer    string
+		expected []models.Package
+	}{
+		{
+			osVer: "7",
 			expected: []models.Package{
 				{
 					Name:    "mysql-5.5",
 					Version: "5.5.37-0+wheezy1",
 				},
+				{
+					Name:        "mysql-5.6",
+					NotFixedYet: true,
+				},
+			},
+		},
+		{
+			osVer: "8",
+			expected: []models.Package{
 				{
 					Name:    "mysql-5.5",
 					Version: "5.5.37-1",
 				},
+				{
+					Name:        "mysql-5.6",
+					NotFixedYet: true,
+				},
+			},
+		},
+		{
+			osVer: "9",
+			expected: []models.Package{
 				{
 					Name:    "mysql-5.5",
 					Version: "5.5.37-1",
@@ -107,13 +128,13 @@ Critical Patch Update advisory for further details:
 		},
 	}
 
+	var root *Root
+	if err := xml.Unmarshal([]byte(walkDebianOVAL), &root); err != nil {
+		t.Fatalf("marshall error")
+	}
+	c := root.Definitions.Definitions[0].Criteria
 	for i, tt := range tests {
-		var root *Root
-		if err := xml.Unmarshal([]byte(tt.oval), &root); err != nil {
-			t.Errorf("[%d] marshall error", i)
-		}
-		c := root.Definitions.Definitions[0].Criteria
-		actual := collectDebianPacks(c)
+		actual := collectDebianPacks(tt.osVer, c, parseTests(*root))
 
 		if !reflect.DeepEqual(tt.expected, actual) {
 			e := pp.Sprintf("%v", tt.expected)
@@ -122,3 +143,287 @@ Critical Patch Update advisory for further details:
 		}
 	}
 }
+
+func TestDebianRelease(t *testing.T) {
+	var tests = []struct {
+		in       string
+		expected string
+	}{
+		{in: "Debian 7.0 is installed", expected: "7"},
+		{in: "Debian 8.2 is installed", expected: "8"},
+		{in: "Debian GNU/Linux 9 is installed", expected: "9"},
+		{in: "Debian GNU/Linux 10 is installed", expected: "10"},
+	}
+	for i, tt := range tests {
+		if actual := debianRelease(tt.in); actual != tt.expected {
+			t.Errorf("[%d]: expected: %q, actual: %q", i, tt.expected, actual)
+		}
+	}
+}
+
+func TestConvertToModel(t *testing.T) {
+	var tests = []struct {
+		oval     string
+		expected *models.Debian
+	}{
+		{
+			oval: `<?xml version="1.0" ?>
+<oval_definitions>
+  <definitions>
+    <definition class="vulnerability" id="oval:org.debian:def:20143704" version="1">
+      <metadata>
+        <title>CVE-2014-3704</title>
+        <description>drupal7 - SQL injection</description>
+        <debian>
+          <dsa>DSA-3051-1</dsa>
+          <moreinfo>
+The expandArguments function in the database abstraction API in Drupal
+core 7.x before 7.32 does not properly construct prepared statements.
+          </moreinfo>
+          <date>2014-10-15</date>
+        </debian>
+      </metadata>
+    </definition>
+  </definitions>
+</oval_definitions>`,
+			expected: &models.Debian{
+				DSA:      "DSA-3051-1",
+				MoreInfo: "The expandArguments function in the database abstraction API in Drupal\ncore 7.x before 7.32 does not properly construct prepared statements.",
+				Date:     time.Date(2014, time.October, 15, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		var root *Root
+		if err := xml.Unmarshal([]byte(tt.oval), &root); err != nil {
+			t.Fatalf("[%d] marshall error", i)
+		}
+		defs, _ := ConvertToModel("8", root)
+		if len(defs) != 1 {
+			t.Fatalf("[%d]: expected: 1 definition, actual: %d", i, len(defs))
+		}
+		if !reflect.DeepEqual(tt.expected, defs[0].Debian) {
+			e := pp.Sprintf("%v", tt.expected)
+			a := pp.Sprintf("%v", defs[0].Debian)
+			t.Errorf("[%d]: expected: %s\n, actual: %s\n", i, e, a)
+		}
+	}
+}
+
+const testRefDebianOVAL = `
+<?xml version="1.0" ?>
+<oval_definitions>
+	<definitions>
+		<definition class="vulnerability" id="oval:org.debian:def:20230001" version="1">
+			<criteria comment="Release section" operator="AND">
+				<criteria comment="Architecture section" operator="OR">
+					<criteria comment="Architecture independent section" operator="AND">
+						<criterion comment="all architecture" test_ref="oval:org.debian.oval:tst:2"/>
+						<criterion comment="tiff DPKG is earlier than 4.5.0-5" test_ref="oval:org.debian.oval:tst:3"/>
+					</criteria>
+					<criteria comment="Architecture independent section" operator="AND">
+						<criterion comment="all architecture" test_ref="oval:org.debian.oval:tst:2"/>
+						<criterion comment="libtiff6 DPKG is earlier than 4.5.0-6" test_ref="oval:org.debian.oval:tst:4"/>
+					</criteria>
+					<criteria comment="Architecture independent section" operator="AND">
+						<criterion comment="all architecture" test_ref="oval:org.debian.oval:tst:2"/>
+						<criterion comment="tiff DPKG is earlier than 4.5.0-6" test_ref="oval:org.debian.oval:tst:3"/>
+					</criteria>
+				</criteria>
+				<criterion comment="Debian 12 is installed" test_ref="oval:org.debian.oval:tst:1"/>
+			</criteria>
+		</definition>
+	</definitions>
+	<tests>
+		<dpkginfo_test check="all" check_existence="at_least_one_exists" comment="tiff is earlier than 4.5.0-6" id="oval:org.debian.oval:tst:3" version="1">
+			<object object_ref="oval:org.debian.oval:obj:1"/>
+			<state state_ref="oval:org.debian.oval:ste:1"/>
+		</dpkginfo_test>
+	</tests>
+	<objects>
+		<dpkginfo_object id="oval:org.debian.oval:obj:1" version="1">
+			<name>tiff</name>
+		</dpkginfo_object>
+	</objects>
+	<states>
+		<dpkginfo_state id="oval:org.debian.oval:ste:1" version="1">
+			<evr datatype="debian_evr_string" operation="less than">4.5.0-6</evr>
+		</dpkginfo_state>
+	</states>
+</oval_definitions>
+`
+
+func TestCollectDebianPacksOfTests(t *testing.T) {
+	var root *Root
+	if err := xml.Unmarshal([]byte(testRefDebianOVAL), &root); err != nil {
+		t.Fatalf("marshall error")
+	}
+	// the version of the test rather than the stale comment, once, and the comment of the criterion whose test is not found,
+	// of the release criterion after the architecture section
+	expected := []models.Package{
+		{
+			Name:    "tiff",
+			Version: "4.5.0-6",
+		},
+		{
+			Name:    "libtiff6",
+			Version: "4.5.0-6",
+		},
+	}
+	actual := collectDebianPacks("12", root.Definitions.Definitions[0].Criteria, parseTests(*root))
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %s\n, actual: %s\n", pp.Sprintf("%v", expected), pp.Sprintf("%v", actual))
+	}
+
+	expected = []models.Package{
+		{
+			Name:        "tiff",
+			NotFixedYet: true,
+		},
+		{
+			Name:        "libtiff6",
+			NotFixedYet: true,
+		},
+	}
+	actual = collectDebianPacks("11", root.Definitions.Definitions[0].Criteria, parseTests(*root))
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %s\n, actual: %s\n", pp.Sprintf("%v", expected), pp.Sprintf("%v", actual))
+	}
+}
+
+func TestWalkDebianVersions(t *testing.T) {
+	tests := []struct {
+		comment  string
+		expected []distroPackage
+	}{
+		{
+			comment:  "openssl DPKG is earlier than 3.0.9-1",
+			expected: []distroPackage{{osVer: "12", pack: models.Package{Name: "openssl", Version: "3.0.9-1"}}},
+		},
+		{
+			comment:  "apache2 DPKG is earlier than 0:2.4.38-3+deb10u1",
+			expected: []distroPackage{{osVer: "12", pack: models.Package{Name: "apache2", Version: "2.4.38-3+deb10u1", RawVersion: "0:2.4.38-3+deb10u1"}}},
+		},
+		{
+			comment:  "bind9 DPKG is earlier than 1:9.16.42-1~deb11u1",
+			expected: []distroPackage{{osVer: "12", pack: models.Package{Name: "bind9", Version: "1:9.16.42-1~deb11u1"}}},
+		},
+		{
+			comment:  "libxml2 DPKG is earlier than 2.9.10+dfsg-6.7+deb11u4",
+			expected: []distroPackage{{osVer: "12", pack: models.Package{Name: "libxml2", Version: "2.9.10+dfsg-6.7+deb11u4"}}},
+		},
+		{
+			comment:  "firefox-esr DPKG is earlier than 102.11.0esr-1~deb12u1",
+			expected: []distroPackage{{osVer: "12", pack: models.Package{Name: "firefox-esr", Version: "102.11.0esr-1~deb12u1"}}},
+		},
+		{
+			comment:  "tzdata DPKG is earlier than 2020.1+deb11u1",
+			expected: []distroPackage{{osVer: "12", pack: models.Package{Name: "tzdata", Version: "2020.1+deb11u1"}}},
+		},
+		{
+			comment: "mysql-5.5 DPKG is earlier than 0",
+		},
+		{
+			comment: "mysql-5.5 DPKG is earlier than 0:0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.comment, func(t *testing.T) {
+			actual := walkDebian(Criteria{Criterions: []Criterion{{Comment: tt.comment}}}, "12", nil, nil)
+			if !reflect.DeepEqual(tt.expected, actual) {
+				t.Errorf("expected: %s\n, actual: %s\n", pp.Sprintf("%v", tt.expected), pp.Sprintf("%v", actual))
+			}
+		})
+	}
+}
+
+func TestConvertToModelCves(t *testing.T) {
+	oval := `<?xml version="1.0" ?>
+<oval_definitions>
+  <definitions>
+    <definition class="vulnerability" id="oval:org.debian:def:20161234" version="1">
+      <metadata>
+        <title>CVE-2016-1234</title>
+        <reference ref_id="CVE-2016-1234 CVE-2016-5678" ref_url="https://security-tracker.debian.org/tracker/CVE-2016-1234" source="CVE"/>
+        <reference ref_id="cve-2015-0001" ref_url="https://security-tracker.debian.org/tracker/cve-2015-0001" source="CVE"/>
+        <reference ref_id="TEMP-0000000-1A2B3C" ref_url="https://security-tracker.debian.org/tracker/TEMP-0000000-1A2B3C" source="CVE"/>
+        <reference ref_id="XSA-123" source="CVE"/>
+        <reference ref_id="CVE-2016-5678" ref_url="https://security-tracker.debian.org/tracker/CVE-2016-5678" source="CVE"/>
+      </metadata>
+    </definition>
+  </definitions>
+</oval_definitions>`
+	var root *Root
+	if err := xml.Unmarshal([]byte(oval), &root); err != nil {
+		t.Fatalf("Failed to unmarshal. err: %s", err)
+	}
+	defs, stat := ConvertToModel("12", root)
+	if len(defs) != 1 {
+		t.Fatalf("expected: 1 definition, actual: %d", len(defs))
+	}
+
+	// the IDs split, uppercased and kept once, where the one split of another takes the Href of its own reference
+	wantCves := []models.Cve{
+		{CveID: "CVE-2016-1234", Href: "https://security-tracker.debian.org/tracker/CVE-2016-1234"},
+		{CveID: "CVE-2016-5678", Href: "https://security-tracker.debian.org/tracker/CVE-2016-5678"},
+		{CveID: "CVE-2015-0001", Href: "https://security-tracker.debian.org/tracker/cve-2015-0001"},
+	}
+	if !reflect.DeepEqual(defs[0].Advisory.Cves, wantCves) {
+		t.Errorf("expected: %+v, actual: %+v", wantCves, defs[0].Advisory.Cves)
+	}
+
+	// the IDs not of CVE are in the references of their source only
+	wantRefs := []models.Reference{
+		{Source: "CVE", RefID: "CVE-2016-1234 CVE-2016-5678", RefURL: "https://security-tracker.debian.org/tracker/CVE-2016-1234"},
+		{Source: "CVE", RefID: "cve-2015-0001", RefURL: "https://security-tracker.debian.org/tracker/cve-2015-0001"},
+		{Source: "CVE", RefID: "TEMP-0000000-1A2B3C", RefURL: "https://security-tracker.debian.org/tracker/TEMP-0000000-1A2B3C"},
+		{Source: "CVE", RefID: "XSA-123"},
+		{Source: "CVE", RefID: "CVE-2016-5678", RefURL: "https://security-tracker.debian.org/tracker/CVE-2016-5678"},
+	}
+	if !reflect.DeepEqual(defs[0].References, wantRefs) {
+		t.Errorf("expected: %+v, actual: %+v", wantRefs, defs[0].References)
+	}
+
+	if stat.CvesNormalized != 3 || stat.CvesRerouted != 2 {
+		t.Errorf("expected: 3 normalized and 2 rerouted, actual: %+v", stat)
+	}
+}
+
+func TestDsaID(t *testing.T) {
+	tests := []struct {
+		name string
+		def  Definition
+		want string
+	}{
+		{
+			name: "dsa of the metadata",
+			def:  Definition{Debian: Debian{DSA: "DSA-3051-1"}, References: []Reference{{Source: "DSA", RefID: "DSA-3000-1"}}},
+			want: "DSA-3051-1",
+		},
+		{
+			name: "reference",
+			def:  Definition{References: []Reference{{Source: "CVE", RefID: "CVE-2014-3704"}, {Source: "DSA", RefID: "dsa-3051-1"}}},
+			want: "DSA-3051-1",
+		},
+		{
+			name: "moreinfo without the revision",
+			def:  Definition{Debian: Debian{MoreInfo: "Fixed by DSA-2919, see the advisory."}, Description: "DSA-3000-1"},
+			want: "DSA-2919",
+		},
+		{
+			name: "description",
+			def:  Definition{Description: "drupal7 - DSA-3051-1 SQL injection"},
+			want: "DSA-3051-1",
+		},
+		{
+			name: "none",
+			def:  Definition{Description: "ODSA-3051-1 is not of DSA", References: []Reference{{Source: "CVE", RefID: "CVE-2014-3704"}}},
+		},
+	}
+	for _, tt := range tests {
+		if got := dsaID(tt.def); got != tt.want {
+			t.Errorf("%s: expected: %q, actual: %q", tt.name, tt.want, got)
+		}
+	}
+}
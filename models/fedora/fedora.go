@@ -3,18 +3,16 @@ package fedora
 import (
 	"fmt"
 	"strings"
-	"time"
-
-	"github.com/spf13/viper"
 
 	"github.com/vulsio/goval-dictionary/models"
 	"github.com/vulsio/goval-dictionary/models/util"
 )
 
-// ConvertToModel Convert OVAL to models
-func ConvertToModel(data *Updates) (defs []models.Definition) {
+// ConvertToModel Convert OVAL to models, with the stat of the updates
+func ConvertToModel(data *Updates) (defs []models.Definition, stat models.ConvertStat) {
 	for _, update := range data.UpdateList {
 		if strings.Contains(update.Description, "** REJECT **") {
+			stat.Skip("def-"+update.ID, models.SkipRejected)
 			continue
 		}
 
@@ -30,7 +28,7 @@ func ConvertToModel(data *Updates) (defs []models.Definition) {
 		for _, pack := range update.Packages {
 			packs = append(packs, models.Package{
 				Name:            pack.Name,
-				Version:         fmt.Sprintf("%s:%s-%s", pack.Epoch, pack.Version, pack.Release),
+				Version:         util.NormalizeEVR(fmt.Sprintf("%s:%s-%s", pack.Epoch, pack.Version, pack.Release)),
 				Arch:            pack.Arch,
 				ModularityLabel: update.ModularityLabel,
 			})
@@ -53,13 +51,20 @@ func ConvertToModel(data *Updates) (defs []models.Definition) {
 			}
 		}
 
+		cves, rerouted := util.NormalizeCves(cves, &stat)
+		refs = append(refs, rerouted...)
+
 		issuedAt := util.ParsedOrDefaultTime([]string{"2006-01-02 15:04:05"}, update.Issued.Date)
 		updatedAt := util.ParsedOrDefaultTime([]string{"2006-01-02 15:04:05"}, update.Updated.Date)
+		normalized := util.NormalizeReferences(refs)
 		def := models.Definition{
 			DefinitionID: "def-" + update.ID,
+			Class:        models.ClassPatch,
 			Title:        update.ID,
-			Description:  update.Description,
+			Description:  strings.TrimSpace(update.Description),
 			Advisory: models.Advisory{
+				AdvisoryID:      update.ID,
+				AdvisoryURL:     util.AdvisoryURL(update.ID, normalized, bodhiURL),
 				Severity:        update.Severity,
 				Cves:            cves,
 				Bugzillas:       bs,
@@ -69,21 +74,16 @@ func ConvertToModel(data *Updates) (defs []models.Definition) {
 			},
 			Debian:        nil,
 			AffectedPacks: packs,
-			References:    refs,
-		}
-
-		if viper.GetBool("no-details") {
-			def.Title = ""
-			def.Description = ""
-			def.Advisory.Severity = ""
-			def.Advisory.Bugzillas = []models.Bugzilla{}
-			def.Advisory.AffectedCPEList = []models.Cpe{}
-			def.Advisory.Issued = time.Time{}
-			def.Advisory.Updated = time.Time{}
-			def.References = []models.Reference{}
+			References:    normalized,
 		}
 
+		stat.Convert()
 		defs = append(defs, def)
 	}
 	return
 }
+
+// bodhiURL returns the URL of the update id in Bodhi, e.g. https://bodhi.fedoraproject.org/updates/FEDORA-2023-0a1b2c3d4e
+func bodhiURL(id string) string {
+	return "https://bodhi.fedoraproject.org/updates/" + id
+}
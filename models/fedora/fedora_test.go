@@ -0,0 +1,42 @@
+package fedora
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+func TestConvertToModelAdvisoryURL(t *testing.T) {
+	in := `<updates>
+  <update type="security">
+    <id>FEDORA-2023-0a1b2c3d4e</id>
+    <references>
+      <reference href="https://bugzilla.redhat.com/show_bug.cgi?id=2170000" id="2170000" type="bugzilla" title="CVE-2023-0001 openssl: flaw"/>
+    </references>
+  </update>
+  <update type="security">
+    <id>FEDORA-2023-5f6a7b8c9d</id>
+    <references>
+      <reference href="https://bodhi.fedoraproject.org/updates/FEDORA-2023-5f6a7b8c9d/" id="FEDORA-2023-5f6a7b8c9d" type="self"/>
+    </references>
+  </update>
+</updates>`
+	var updates Updates
+	if err := xml.Unmarshal([]byte(in), &updates); err != nil {
+		t.Fatalf("Failed to unmarshal. err: %s", err)
+	}
+
+	got := map[string]string{}
+	defs, _ := ConvertToModel(&updates)
+	for _, d := range defs {
+		got[d.DefinitionID] = d.Advisory.AdvisoryURL
+	}
+	want := map[string]string{
+		"def-FEDORA-2023-0a1b2c3d4e": "https://bodhi.fedoraproject.org/updates/FEDORA-2023-0a1b2c3d4e",
+		// the reference of the advisory wins over bodhiURL
+		"def-FEDORA-2023-5f6a7b8c9d": "https://bodhi.fedoraproject.org/updates/FEDORA-2023-5f6a7b8c9d/",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
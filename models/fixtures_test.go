@@ -0,0 +1,225 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/internal/testutil"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+func TestConvertFixtures(t *testing.T) {
+	tests := []struct {
+		family string
+		// defs are the numbers of the definitions by OS version
+		defs  map[string]int
+		osVer string
+		defID string
+		// wantCves and wantPacks are of defID of osVer
+		wantCves  []string
+		wantPacks []models.Package
+	}{
+		{
+			family:    c.Alpine,
+			defs:      map[string]int{"3.18": 5},
+			osVer:     "3.18",
+			defID:     "def-main-v3.18-CVE-2021-22897",
+			wantCves:  []string{"CVE-2021-22897"},
+			wantPacks: []models.Package{{Name: "curl", Version: "0"}},
+		},
+		{
+			family:   c.Amazon,
+			defs:     map[string]int{"2": 2},
+			osVer:    "2",
+			defID:    "def-ALAS2-2023-2074",
+			wantCves: []string{"CVE-2023-0464", "CVE-2023-2650"},
+			wantPacks: []models.Package{
+				{Name: "openssl11", Version: "1:1.1.1g-2.amzn2.0.6", Arch: "aarch64"},
+				{Name: "openssl11", Version: "1:1.1.1g-2.amzn2.0.6", Arch: "x86_64"},
+			},
+		},
+		{
+			family:   c.Debian,
+			defs:     map[string]int{"12": 5},
+			osVer:    "12",
+			defID:    "oval:org.debian:def:139946837203823219738834476012315447582",
+			wantCves: []string{"CVE-2023-29469"},
+		},
+		{
+			// the packages of the branches of the definition, each paired with the fixed version of its test, once
+			family:   c.Debian,
+			defs:     map[string]int{"12": 5},
+			osVer:    "12",
+			defID:    "oval:org.debian:def:160442418283063913207066440339186371364",
+			wantCves: []string{"CVE-2023-32205"},
+			wantPacks: []models.Package{
+				{Name: "firefox-esr", Version: "102.11.0esr-1~deb12u1"},
+				{Name: "thunderbird", Version: "1:102.11.0-1~deb12u1"},
+			},
+		},
+		{
+			// only the versions of the branch of Debian 12, and not fixed yet of the package only of Debian 11
+			family:   c.Debian,
+			defs:     map[string]int{"12": 5},
+			osVer:    "12",
+			defID:    "oval:org.debian:def:207311254385436289431093404744104330391",
+			wantCves: []string{"CVE-2023-2731"},
+			wantPacks: []models.Package{
+				{Name: "libtiff-tools", NotFixedYet: true},
+				{Name: "tiff", Version: "4.5.0-6"},
+			},
+		},
+		{
+			family:   c.Fedora,
+			defs:     map[string]int{"38": 1},
+			osVer:    "38",
+			defID:    "def-FEDORA-2023-a5564c0a3f",
+			wantCves: []string{"CVE-2023-2650"},
+			wantPacks: []models.Package{
+				{Name: "openssl", Version: "1:3.0.9-2.fc38", Arch: "x86_64"},
+				{Name: "openssl-libs", Version: "1:3.0.9-2.fc38", Arch: "x86_64"},
+			},
+		},
+		{
+			family:   c.OpenSUSELeap,
+			defs:     map[string]int{"15.5": 1},
+			osVer:    "15.5",
+			defID:    "oval:org.opensuse.security:def:20232650",
+			wantCves: []string{"CVE-2023-2650"},
+			wantPacks: []models.Package{
+				{Name: "libopenssl3", Version: "0:3.0.8-150500.5.8.1"},
+				{Name: "openssl-3", Version: "0:3.0.8-150500.5.8.1"},
+			},
+		},
+		{
+			family:    c.Oracle,
+			defs:      map[string]int{"8": 3, "9": 1},
+			osVer:     "8",
+			defID:     "oval:com.oracle.elsa:def:20239603",
+			wantCves:  []string{"CVE-2023-4911"},
+			wantPacks: []models.Package{{Name: "glibc", Version: "2:2.28-225.0.4.el8_8.6.ksplice1", Arch: "x86_64", Ksplice: true}},
+		},
+		{
+			family:   c.RedHat,
+			defs:     map[string]int{"8": 4},
+			osVer:    "8",
+			defID:    "oval:com.redhat.rhsa:def:20231583",
+			wantCves: []string{"CVE-2023-23918", "CVE-2023-23919", "CVE-2023-23920"},
+			wantPacks: []models.Package{
+				{Name: "nodejs", Version: "1:18.14.2-2.module+el8.7.0+18113+bc7e31cd", ModularityLabel: "nodejs:18"},
+				{Name: "npm", Version: "1:9.3.1-1.18.14.2.2.module+el8.7.0+18113+bc7e31cd", ModularityLabel: "nodejs:18"},
+			},
+		},
+		{
+			family:    c.SUSEEnterpriseServer,
+			defs:      map[string]int{"15.4": 1, "15.5": 2},
+			osVer:     "15.5",
+			defID:     "oval:org.opensuse.security:def:20232650",
+			wantCves:  []string{"CVE-2023-2650"},
+			wantPacks: []models.Package{{Name: "libopenssl3", Version: "0:3.0.8-150500.5.8.1"}},
+		},
+		{
+			family:   c.Ubuntu,
+			defs:     map[string]int{"22.04": 3},
+			osVer:    "22.04",
+			defID:    "oval:com.ubuntu.jammy:def:202329469000000",
+			wantCves: []string{"CVE-2023-29469"},
+			wantPacks: []models.Package{
+				{Name: "libxml2", Version: "2.9.13+dfsg-1ubuntu0.3", RawVersion: "0:2.9.13+dfsg-1ubuntu0.3"},
+				{Name: "libxml2-utils", NotFixedYet: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.family, func(t *testing.T) {
+			defs := map[string]int{}
+			var root models.Root
+			for _, r := range testutil.Roots(t, tt.family) {
+				defs[r.OSVersion] = len(r.Definitions)
+				if r.OSVersion == tt.osVer {
+					root = r
+				}
+			}
+			if diff := cmp.Diff(tt.defs, defs); diff != "" {
+				t.Errorf("definitions by OS version (-want +got):\n%s", diff)
+			}
+
+			def := testutil.Normalize([]models.Definition{testutil.Definition(t, root.Definitions, tt.defID)})[0]
+			cves := []string{}
+			for _, cve := range def.Advisory.Cves {
+				cves = append(cves, cve.CveID)
+			}
+			if diff := cmp.Diff(tt.wantCves, cves); diff != "" {
+				t.Errorf("CVEs (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantPacks, def.AffectedPacks); diff != "" {
+				t.Errorf("packages (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConvertFixturesTitleDescription(t *testing.T) {
+	tests := []struct {
+		family string
+		// description is false of the family whose OVAL has no description, e.g. the secdb of Alpine
+		description bool
+	}{
+		{family: c.Alpine},
+		{family: c.Amazon, description: true},
+		{family: c.Debian, description: true},
+		{family: c.Fedora, description: true},
+		{family: c.OpenSUSELeap, description: true},
+		{family: c.Oracle, description: true},
+		{family: c.RedHat, description: true},
+		{family: c.SUSEEnterpriseServer, description: true},
+		{family: c.Ubuntu, description: true},
+	}
+	if len(tests) != len(testutil.Families()) {
+		t.Fatalf("expected: the cases of all the families %q, actual: %d cases", testutil.Families(), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.family, func(t *testing.T) {
+			for _, r := range testutil.Roots(t, tt.family) {
+				for _, d := range r.Definitions {
+					if d.Title == "" || d.Title != strings.TrimSpace(d.Title) {
+						t.Errorf("%s %s: expected: the title trimmed, not empty, actual: %q", r.OSVersion, d.DefinitionID, d.Title)
+					}
+					if tt.description && (d.Description == "" || d.Description != strings.TrimSpace(d.Description)) {
+						t.Errorf("%s %s: expected: the description trimmed, not empty, actual: %q", r.OSVersion, d.DefinitionID, d.Description)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	defs := testutil.Roots(t, c.RedHat)[0].Definitions
+	// as loaded from DB: of the IDs, in the reverse order, and the empty children of the empty slices
+	loaded := make([]models.Definition, 0, len(defs))
+	for i := len(defs) - 1; i >= 0; i-- {
+		d := defs[i]
+		d.ID, d.RootID = uint(i+1), 1
+		packs := make([]models.Package, 0, len(d.AffectedPacks))
+		for j := len(d.AffectedPacks) - 1; j >= 0; j-- {
+			p := d.AffectedPacks[j]
+			p.ID, p.DefinitionID = uint(j+1), d.ID
+			packs = append(packs, p)
+		}
+		d.AffectedPacks = packs
+		if d.Advisory.Cves == nil {
+			d.Advisory.Cves = []models.Cve{}
+		}
+		loaded = append(loaded, d)
+	}
+	testutil.AssertDefinitions(t, defs, loaded)
+
+	loaded[0].AffectedPacks[0].Version = "0:0-0.el8"
+	if diff := cmp.Diff(testutil.Normalize(defs), testutil.Normalize(loaded)); diff == "" {
+		t.Errorf("expected: the definitions of the changed package differ, actual: the same")
+	}
+}
@@ -1,9 +1,23 @@
 package models
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
 	"time"
 
+	"golang.org/x/xerrors"
 	"gorm.io/gorm"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/util/version"
 )
 
 // LatestSchemaVersion manages the Schema version used in the latest goval-dictionary.
@@ -12,9 +26,95 @@ const LatestSchemaVersion = 3
 // FetchMeta has DB information
 type FetchMeta struct {
 	gorm.Model        `json:"-"`
-	GovalDictRevision string
-	SchemaVersion     uint
-	LastFetchedAt     time.Time
+	GovalDictRevision string    `json:"govalDictRevision"`
+	SchemaVersion     uint      `json:"schemaVersion"`
+	LastFetchedAt     time.Time `json:"lastFetchedAt"`
+
+	CacheValidators map[string]CacheValidator `gorm:"type:text;serializer:json" json:"cacheValidators"` // by URL of the fetched files
+	SHA256          map[string]string         `gorm:"type:text;serializer:json" json:"sha256"`          // SHA-256 verified against the published checksum, by URL of the fetched files
+	Snapshots       map[string]time.Time      `gorm:"type:text;serializer:json" json:"snapshots"`       // snapshot of the rolling releases of no version number, e.g. openSUSE Tumbleweed, by URL of the fetched files
+}
+
+// CacheValidator has the HTTP cache validators of a fetched file, sent on the next fetch to skip downloading the unchanged file
+type CacheValidator struct {
+	ETag          string   `json:"etag"`
+	LastModified  string   `json:"lastModified"`            // Last-Modified header as is
+	ContentLength int64    `json:"contentLength,omitempty"` // Content-Length of the file, 0 if unknown, compared with the one of HEAD along with LastModified
+	OSVersions    []string `json:"osVersions"`              // OS versions inserted from the file
+}
+
+// FetchFile is a fetched OVAL file stored by --store-source, for the provenance of the OVAL converted from it after the mirror has rotated it.
+// The latest fetched one of each file name is stored, decompressed as fetched and compressed again by gzip.
+type FetchFile struct {
+	ID         uint      `gorm:"primary_key" json:"-"`
+	FileName   string    `gorm:"type:varchar(255);uniqueIndex:idx_fetch_files_file_name" json:"fileName"` // the name without the suffix of the compression, e.g. rhel-8.oval.xml
+	URL        string    `gorm:"type:text" json:"url"`
+	Family     string    `gorm:"type:varchar(255)" json:"family"`
+	OSVersions []string  `gorm:"type:text;serializer:json" json:"osVersions"` // OS versions inserted from the file
+	SHA256     string    `gorm:"type:varchar(255)" json:"sha256"`             // SHA-256 of the file decompressed, the one of the Root converted from it alone
+	Size       int64     `json:"size"`                                        // size of the file decompressed
+	FetchedAt  time.Time `json:"fetchedAt"`
+	Data       []byte    `json:"-"` // the file compressed by gzip, empty if larger than --store-source-max-size
+}
+
+// FetchHistory is the record of a refresh of the OVAL of a family and a version, appended by every InsertOval and MergeOval of RDB succeeded,
+// e.g. for the trend of the new advisories a week, with the counts of the stored OVAL after it and the changes of it
+type FetchHistory struct {
+	ID          uint      `gorm:"primary_key" json:"-"`
+	Family      string    `gorm:"type:varchar(255);index:idx_fetch_history_family_os_version_refreshed_at,priority:1" json:"family"`
+	OSVersion   string    `gorm:"type:varchar(255);index:idx_fetch_history_family_os_version_refreshed_at,priority:2" json:"osVersion"`
+	RefreshedAt time.Time `gorm:"index:idx_fetch_history_family_os_version_refreshed_at,priority:3" json:"refreshedAt"`
+	Timestamp   time.Time `json:"timestamp"` // the timestamp of the OVAL
+	Definitions int       `json:"definitions"`
+	Advisories  int       `json:"advisories"` // the distinct advisory IDs, zero of the families of no advisory ID, e.g. Debian
+	Cves        int       `json:"cves"`       // the distinct CVE IDs
+	New         int       `json:"new"`
+	Updated     int       `json:"updated"`
+	Unchanged   int       `json:"unchanged"`
+	Removed     int       `json:"removed"`
+}
+
+// TableName returns fetch_history, a table of the history of all the refreshes rather than of the histories
+func (FetchHistory) TableName() string {
+	return "fetch_history"
+}
+
+// NewFetchFile returns the FetchFile of body, decompressed as fetched from rawURL, compressing it by gzip. Its OS versions are set once inserted.
+func NewFetchFile(fileName, rawURL, family string, body []byte, fetchedAt time.Time) (FetchFile, error) {
+	buf := bytes.Buffer{}
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return FetchFile{}, xerrors.Errorf("Failed to compress %s. err: %w", fileName, err)
+	}
+	if err := zw.Close(); err != nil {
+		return FetchFile{}, xerrors.Errorf("Failed to compress %s. err: %w", fileName, err)
+	}
+	sum := sha256.Sum256(body)
+	return FetchFile{
+		FileName:  fileName,
+		URL:       rawURL,
+		Family:    family,
+		SHA256:    hex.EncodeToString(sum[:]),
+		Size:      int64(len(body)),
+		FetchedAt: fetchedAt,
+		Data:      buf.Bytes(),
+	}, nil
+}
+
+// Decompress returns the file as fetched, verified against SHA256
+func (f FetchFile) Decompress() ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(f.Data))
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to decompress %s. err: %w", f.FileName, err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to decompress %s. err: %w", f.FileName, err)
+	}
+	if sum := sha256.Sum256(body); hex.EncodeToString(sum[:]) != f.SHA256 {
+		return nil, xerrors.Errorf("Failed to verify %s. expected: %s, actual: %s", f.FileName, f.SHA256, hex.EncodeToString(sum[:]))
+	}
+	return body, nil
 }
 
 // OutDated checks whether last fetched feed is out dated
@@ -24,11 +124,89 @@ func (f FetchMeta) OutDated() bool {
 
 // Root is root struct
 type Root struct {
-	ID          uint   `gorm:"primary_key"`
-	Family      string `gorm:"type:varchar(255)"`
-	OSVersion   string `gorm:"type:varchar(255)"`
-	Definitions []Definition
-	Timestamp   time.Time
+	ID          uint         `gorm:"primary_key" json:"-"`
+	Family      string       `gorm:"type:varchar(255);index:idx_roots_family_release_key,priority:1" json:"family"`
+	OSVersion   string       `gorm:"type:varchar(255)" json:"osVersion"`
+	Definitions []Definition `json:"definitions"`
+	Timestamp   time.Time    `json:"timestamp"`
+	FileSize    int64        `json:"fileSize"`                        // size of the fetched OVAL files
+	SHA256      string       `gorm:"type:varchar(255)" json:"sha256"` // SHA-256 of the fetched OVAL files, empty if unknown
+	// ConvertDigest is the digest of the revision of goval-dictionary and the options the OVAL was converted by, e.g. --issued-years and --no-details,
+	// which the refresh compares with SHA256 to skip the unchanged OVAL, so that the same files converted by another binary or options are refreshed
+	ConvertDigest string `gorm:"type:varchar(255)" json:"convertDigest,omitempty"`
+	// Source is the names of the fetched OVAL files, e.g. rhel-7.oval.xml.bz2, to tell the OVAL replaced by the one of another file, empty if unknown
+	Source string `gorm:"type:text" json:"source,omitempty"`
+	// Active is false of the root being inserted by the refresh of RDB, or of the old one replaced by it and not yet deleted,
+	// which the lookups never see. The roots stored before the column are active by its default.
+	Active bool `gorm:"not null;default:true" json:"-"`
+	// ReleaseKey is the key of OSVersion by config.ReleaseKey, e.g. 7 of 7Server of redhat, set by the insert, on which the lookups match
+	// the release of the caller normalized by the same function, e.g. 7 of 7.4 and 9 of stretch of debian. The roots stored before the column
+	// are backfilled by the migration.
+	ReleaseKey string `gorm:"type:varchar(255);not null;default:'';index:idx_roots_family_release_key,priority:2" json:"-"`
+}
+
+// StripDetails drops the details of the definitions of r not used for the detection, e.g. the titles and the references, by --no-details
+func (r *Root) StripDetails() {
+	for i := range r.Definitions {
+		d := &r.Definitions[i]
+		d.Title = ""
+		d.Description = ""
+		d.Severity = ""
+		d.Advisory.Severity = ""
+		d.Advisory.AffectedCPEList = []Cpe{}
+		d.Advisory.Bugzillas = []Bugzilla{}
+		d.Advisory.Issued = time.Time{}
+		d.Advisory.Updated = time.Time{}
+		d.Debian = nil
+		d.References = []Reference{}
+	}
+}
+
+// ErrInvalidOVAL is returned by Root.Validate for the OVAL not sane enough to be stored
+var ErrInvalidOVAL = errors.New("invalid OVAL")
+
+// ValidateOption is the option of Root.Validate
+type ValidateOption struct {
+	MinDefinitions int  // the minimum number of definitions, no check if 0
+	NoDetails      bool // references are dropped with --no-details, so definitions may have neither CVEs nor references
+}
+
+// Validate checks that the converted Root is sane enough to replace the stored one, e.g. not parsed from a truncated file
+func (r Root) Validate(opt ValidateOption) error {
+	errs := []string{}
+	if r.Family == "" {
+		errs = append(errs, "empty family")
+	}
+	if r.OSVersion == "" {
+		errs = append(errs, "empty OS version")
+	}
+	if len(r.Definitions) < opt.MinDefinitions {
+		errs = append(errs, fmt.Sprintf("too few definitions: %d, expected at least %d", len(r.Definitions), opt.MinDefinitions))
+	}
+
+	noRefs, noPackNames := []string{}, []string{}
+	for _, d := range r.Definitions {
+		if !opt.NoDetails && len(d.Advisory.Cves) == 0 && len(d.References) == 0 {
+			noRefs = append(noRefs, d.DefinitionID)
+		}
+		for _, p := range d.AffectedPacks {
+			if p.Name == "" {
+				noPackNames = append(noPackNames, d.DefinitionID)
+				break
+			}
+		}
+	}
+	if len(noRefs) > 0 {
+		errs = append(errs, fmt.Sprintf("definitions without CVEs and references: %s", strings.Join(noRefs, ", ")))
+	}
+	if len(noPackNames) > 0 {
+		errs = append(errs, fmt.Sprintf("definitions with empty package names: %s", strings.Join(noPackNames, ", ")))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w. family: %s, osVer: %s, %s", ErrInvalidOVAL, r.Family, r.OSVersion, strings.Join(errs, "; "))
+	}
+	return nil
 }
 
 // Definition : >definitions>definition
@@ -36,25 +214,117 @@ type Definition struct {
 	ID     uint `gorm:"primary_key" json:"-"`
 	RootID uint `gorm:"index:idx_definition_root_id" json:"-" xml:"-"`
 
-	DefinitionID  string `gorm:"type:varchar(255)"`
-	Title         string `gorm:"type:text"`
-	Description   string // If the type:text, varchar(255) is specified, MySQL overflows and gives an error. No problem in GORMv2. (https://github.com/go-gorm/mysql/tree/15e2cbc6fd072be99215a82292e025dab25e2e16#configuration)
-	Advisory      Advisory
-	Debian        *Debian
-	AffectedPacks []Package
-	References    []Reference
+	DefinitionID  string      `gorm:"type:varchar(255);index:idx_definition_definition_id" json:"definitionID"`
+	Class         string      `gorm:"type:varchar(255)" json:"class"` // e.g. patch, vulnerability
+	Title         string      `gorm:"type:text" json:"title"`
+	Description   string      `json:"description"`                                 // If the type:text, varchar(255) is specified, MySQL overflows and gives an error. No problem in GORMv2. (https://github.com/go-gorm/mysql/tree/15e2cbc6fd072be99215a82292e025dab25e2e16#configuration)
+	Severity      string      `gorm:"type:varchar(255)" json:"severity,omitempty"` // of the definition itself, e.g. metadata>severity, apart from the one of Advisory
+	Advisory      Advisory    `json:"advisory"`
+	Debian        *Debian     `json:"debian"`
+	AffectedPacks []Package   `json:"affectedPacks"`
+	References    []Reference `json:"references"`
+}
+
+// ContentHash returns the SHA-256 of the content of the definition without the IDs of DB,
+// to tell whether the definition of the same DefinitionID has been changed since stored
+func (d Definition) ContentHash() string {
+	// the empty children are loaded from DB as the empty slices, the children in the order of the DB, and the times in the location of DB
+	d.Advisory.Cves = sortedByJSON(cvesInUTC(d.Advisory.Cves))
+	d.Advisory.Bugzillas = sortedByJSON(d.Advisory.Bugzillas)
+	d.Advisory.AffectedCPEList = sortedByJSON(d.Advisory.AffectedCPEList)
+	d.AffectedPacks = sortedByJSON(d.AffectedPacks)
+	d.References = sortedByJSON(d.References)
+	d.Advisory.Issued, d.Advisory.Updated = d.Advisory.Issued.UTC(), d.Advisory.Updated.UTC()
+	if d.Debian != nil {
+		debian := *d.Debian
+		debian.Date = debian.Date.UTC()
+		d.Debian = &debian
+	}
+
+	// the definition of the plain fields never fails to be marshaled
+	b, _ := json.Marshal(d)
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
+// cvesInUTC returns the copy of cves with PublicDate in UTC, or cves as is if none has it
+func cvesInUTC(cves []Cve) []Cve {
+	var utc []Cve
+	for i, cve := range cves {
+		if cve.PublicDate == nil {
+			continue
+		}
+		if utc == nil {
+			utc = append([]Cve{}, cves...)
+		}
+		t := cve.PublicDate.UTC()
+		utc[i].PublicDate = &t
+	}
+	if utc == nil {
+		return cves
+	}
+	return utc
+}
+
+// sortedByJSON returns the copy of s sorted by the JSON of the elements without the IDs of DB, or nil for the empty one
+// so that it is marshaled as null as the nil one
+func sortedByJSON[T any](s []T) []T {
+	if len(s) == 0 {
+		return nil
+	}
+	keys := make([]string, len(s))
+	idx := make([]int, len(s))
+	for i, e := range s {
+		// the children of the plain fields never fail to be marshaled
+		b, _ := json.Marshal(e)
+		keys[i], idx[i] = string(b), i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return keys[idx[i]] < keys[idx[j]] })
+	sorted := make([]T, len(s))
+	for i, j := range idx {
+		sorted[i] = s[j]
+	}
+	return sorted
 }
 
+// Classes of definitions
+const (
+	ClassPatch         = "patch"
+	ClassVulnerability = "vulnerability"
+)
+
 // Package affected
 type Package struct {
 	ID           uint `gorm:"primary_key" json:"-"`
 	DefinitionID uint `gorm:"index:idx_packages_definition_id" json:"-" xml:"-"`
 
-	Name            string `gorm:"index:idx_packages_name"` // If the type:text, varchar(255) is specified, MySQL overflows and gives an error. No problem in GORMv2. (https://github.com/go-gorm/mysql/tree/15e2cbc6fd072be99215a82292e025dab25e2e16#configuration)
-	Version         string `gorm:"type:varchar(255)"`       // affected earlier than this version
-	Arch            string `gorm:"type:varchar(255)"`       // Used for Amazon Linux, Oracle Linux and Fedora
-	NotFixedYet     bool   // Ubuntu Only
-	ModularityLabel string `gorm:"type:varchar(255)"` // RHEL 8 or later only
+	Name            string `gorm:"index:idx_packages_name" json:"name"`           // If the type:text, varchar(255) is specified, MySQL overflows and gives an error. No problem in GORMv2. (https://github.com/go-gorm/mysql/tree/15e2cbc6fd072be99215a82292e025dab25e2e16#configuration)
+	Version         string `gorm:"type:varchar(255)" json:"version"`              // affected earlier than this version
+	RawVersion      string `gorm:"type:varchar(255)" json:"rawVersion,omitempty"` // the version as in the OVAL if Version is normalized from it, e.g. 2.17-157.el7 of 0:2.17-157.el7, none of the updateinfo of Amazon and Fedora
+	Arch            string `gorm:"type:varchar(255)" json:"arch"`                 // Used for Amazon Linux, Oracle Linux and Fedora
+	NotFixedYet     bool   `json:"notFixedYet"`                                   // Ubuntu, Debian and Red Hat only
+	ModularityLabel string `gorm:"type:varchar(255)" json:"modularityLabel"`      // RHEL 8 or later only
+	Ksplice         bool   `json:"ksplice"`                                       // Oracle Linux only, fixed by Ksplice (kernel or userspace)
+}
+
+// IsFixedIn reports whether the installed version of the package of family is the fixed Version or later, compared by version.CompareDEB
+// for Debian, Ubuntu and Raspbian and by version.CompareRPM for the RPM-based families. It is false for the package not fixed yet,
+// and for the family neither of them, e.g. Alpine, of which the versions are compared by neither algorithm.
+func (p Package) IsFixedIn(installed, family string) bool {
+	if p.NotFixedYet || p.Version == "" {
+		return false
+	}
+	family, err := c.NormalizeFamily(family)
+	if err != nil {
+		return false
+	}
+	switch family {
+	case c.Debian, c.Ubuntu, c.Raspbian:
+		return version.CompareDEB(installed, p.Version) >= 0
+	case c.RedHat, c.Oracle, c.Amazon, c.Fedora, c.OpenSUSE, c.OpenSUSELeap, c.SUSEEnterpriseServer, c.SUSEEnterpriseDesktop:
+		return version.CompareRPM(installed, p.Version) >= 0
+	default:
+		return false
+	}
 }
 
 // Reference : >definitions>definition>metadata>reference
@@ -62,9 +332,9 @@ type Reference struct {
 	ID           uint `gorm:"primary_key" json:"-"`
 	DefinitionID uint `gorm:"index:idx_reference_definition_id" json:"-" xml:"-"`
 
-	Source string `gorm:"type:varchar(255)"`
-	RefID  string `gorm:"type:varchar(255)"`
-	RefURL string `gorm:"type:text"`
+	Source string `gorm:"type:varchar(255)" json:"source"`
+	RefID  string `gorm:"type:varchar(255)" json:"refID"`
+	RefURL string `gorm:"type:text" json:"refURL"`
 }
 
 // Advisory : >definitions>definition>metadata>advisory
@@ -72,27 +342,46 @@ type Advisory struct {
 	ID           uint `gorm:"primary_key" json:"-"`
 	DefinitionID uint `gorm:"index:idx_advisories_definition_id" json:"-" xml:"-"`
 
-	Severity           string `gorm:"type:varchar(255)"`
-	Cves               []Cve
-	Bugzillas          []Bugzilla
-	AffectedCPEList    []Cpe
-	AffectedRepository string `gorm:"type:varchar(255)"` // Amazon Linux 2 Only
-	Issued             time.Time
-	Updated            time.Time
+	AdvisoryID         string     `gorm:"type:varchar(255)" json:"advisoryID"`    // e.g. RHSA-2017:0933, ELSA-2017-0933-1, DSA-3981-1, SUSE-SU-2021:0857-1, empty of Ubuntu and Alpine
+	AdvisoryURL        string     `gorm:"type:text" json:"advisoryURL,omitempty"` // the vendor advisory, e.g. https://access.redhat.com/errata/RHSA-2017:0933, empty if unknown
+	Revision           int        `json:"revision,omitempty"`                     // Oracle Only, e.g. 1 of ELSA-2017-0933-1, 0 of the original ELSA-2017-0933
+	Class              string     `gorm:"type:varchar(255)" json:"class"`         // Red Hat Only, security, bugfix or enhancement
+	Severity           string     `gorm:"type:varchar(255)" json:"severity"`
+	Cves               []Cve      `json:"cves"`
+	Bugzillas          []Bugzilla `json:"bugzillas"`
+	AffectedCPEList    []Cpe      `json:"affectedCPEList"`
+	AffectedRepository string     `gorm:"type:varchar(255)" json:"affectedRepository"`                             // Amazon Linux 2 Only
+	State              string     `gorm:"type:varchar(255)" json:"state"`                                          // Red Hat Only, resolution state of unpatched definitions, empty if fixed
+	RebootRequired     bool       `gorm:"not null;default:false" json:"rebootRequired,omitempty"`                  // SUSE Only, the patch requires a reboot to take effect
+	RestartSuggested   string     `gorm:"type:varchar(255);not null;default:''" json:"restartSuggested,omitempty"` // SUSE Only, the restart suggested by the patch, e.g. the services to restart or true, empty if none
+	Issued             time.Time  `json:"issued"`
+	Updated            time.Time  `json:"updated"`
 }
 
+// Resolution states of Red Hat unpatched definitions
+const (
+	StateAffected           = "Affected"
+	StateFixDeferred        = "Fix deferred"
+	StateWillNotFix         = "Will not fix"
+	StateOutOfSupportScope  = "Out of support scope"
+	StateUnderInvestigation = "Under investigation"
+)
+
 // Cve : >definitions>definition>metadata>advisory>cve
 type Cve struct {
 	ID         uint `gorm:"primary_key" json:"-"`
 	AdvisoryID uint `gorm:"index:idx_cves_advisory_id" json:"-" xml:"-"`
 
-	CveID  string `gorm:"type:varchar(255)"`
-	Cvss2  string `gorm:"type:varchar(255)"`
-	Cvss3  string `gorm:"type:varchar(255)"`
-	Cwe    string `gorm:"type:varchar(255)"`
-	Impact string `gorm:"type:varchar(255)"`
-	Href   string `gorm:"type:varchar(255)"`
-	Public string `gorm:"type:varchar(255)"`
+	CveID  string `gorm:"type:varchar(255)" json:"cveID"`
+	Cvss2  string `gorm:"type:varchar(255)" json:"cvss2"`
+	Cvss3  string `gorm:"type:varchar(255)" json:"cvss3"`
+	Cwe    string `gorm:"type:varchar(255)" json:"cwe"`
+	Impact string `gorm:"type:varchar(255)" json:"impact"`
+	Href   string `gorm:"type:varchar(255)" json:"href"`
+	Public string `gorm:"type:varchar(255)" json:"public"`
+	// Red Hat only, the date the CVE was made public parsed from Public, nil if missing or unparsable, e.g. for the SLA from the disclosure.
+	// Impact is of the CVE as well, which differs from the severity of the advisory rolling up the CVEs of the different impacts.
+	PublicDate *time.Time `json:"publicDate,omitempty"`
 }
 
 // Bugzilla : >definitions>definition>metadata>advisory>bugzilla
@@ -100,9 +389,9 @@ type Bugzilla struct {
 	ID         uint `gorm:"primary_key" json:"-"`
 	AdvisoryID uint `gorm:"index:idx_bugzillas_advisory_id" json:"-" xml:"-"`
 
-	BugzillaID string `gorm:"type:varchar(255)"`
-	URL        string `gorm:"type:varchar(255)"`
-	Title      string `gorm:"type:varchar(255)"`
+	BugzillaID string `gorm:"type:varchar(255)" json:"bugzillaID"`
+	URL        string `gorm:"type:varchar(255)" json:"url"`
+	Title      string `gorm:"type:varchar(255)" json:"title"`
 }
 
 // Cpe : >definitions>definition>metadata>advisory>affected_cpe_list
@@ -110,7 +399,7 @@ type Cpe struct {
 	ID         uint `gorm:"primary_key" json:"-"`
 	AdvisoryID uint `gorm:"index:idx_cpes_advisory_id" json:"-" xml:"-"`
 
-	Cpe string `gorm:"type:varchar(255)"`
+	Cpe string `gorm:"type:varchar(255)" json:"cpe"`
 }
 
 // Debian : >definitions>definition>metadata>debian
@@ -118,7 +407,150 @@ type Debian struct {
 	ID           uint `gorm:"primary_key" json:"-"`
 	DefinitionID uint `gorm:"index:idx_debian_definition_id" json:"-" xml:"-"`
 
-	MoreInfo string `gorm:"type:text"`
+	DSA      string `gorm:"type:varchar(255)" json:"dsa"`
+	MoreInfo string `gorm:"type:text" json:"moreInfo"`
+
+	Date time.Time `json:"date"`
+}
+
+// PackInfo is a flattened result of a package query: one row per affected package and CVE
+type PackInfo struct {
+	CveID        string `json:"cveID"`
+	DefinitionID string `json:"definitionID"`
+	AdvisoryID   string `json:"advisoryID"`
+	FixedVersion string `json:"fixedVersion"`
+	NotFixedYet  bool   `json:"notFixedYet"`
+	Severity     string `json:"severity"`
+}
+
+// ChangeStat is the numbers of the definitions of a family and a version by the change from the stored ones,
+// compared by DefinitionID and ContentHash when inserted, e.g. for the summary of the fetch
+type ChangeStat struct {
+	New       int `json:"new"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Removed   int `json:"removed"` // stored, but no longer in the inserted OVAL
+
+	NewIDs []string `json:"newIDs,omitempty"` // DefinitionIDs of the new definitions, e.g. for their advisories in the summary of the fetch
+
+	// SourceChange is the change of Root.Source from the replaced OVAL, nil if the same or unknown
+	SourceChange *SourceChange `json:"sourceChange,omitempty"`
+}
+
+// SourceChange is the OVAL of a family and a version replaced by the one of another source file, e.g. RedHat 7 of rhel-7.oval.xml.bz2
+// replaced by the one of the file including the unpatched definitions, with the numbers of the definitions of both
+type SourceChange struct {
+	From            string `json:"from"`
+	To              string `json:"to"`
+	FromDefinitions int    `json:"fromDefinitions"`
+	ToDefinitions   int    `json:"toDefinitions"`
+}
+
+// Add returns the sum of the numbers of s and o, with the DefinitionIDs of the new definitions of both,
+// but without SourceChange, which is of a version
+func (s ChangeStat) Add(o ChangeStat) ChangeStat {
+	sum := ChangeStat{New: s.New + o.New, Updated: s.Updated + o.Updated, Unchanged: s.Unchanged + o.Unchanged, Removed: s.Removed + o.Removed}
+	if len(s.NewIDs)+len(o.NewIDs) > 0 {
+		sum.NewIDs = append(append(make([]string, 0, len(s.NewIDs)+len(o.NewIDs)), s.NewIDs...), o.NewIDs...)
+	}
+	return sum
+}
+
+// the reasons of the definitions skipped by the converters in ConvertStat
+const (
+	SkipRejected   = "rejected"     // ** REJECT ** in the description
+	SkipNoRelease  = "no-release"   // no package of any release in the criteria of Oracle and SUSE OVAL
+	SkipOutOfYears = "out-of-years" // issued out of --issued-years
+	SkipNotCVE     = "not-cve"      // the fix of Alpine secdb of other than CVE, e.g. XSA-1
+)
+
+// MaxSkippedIDs is the number of the IDs of the skipped definitions sampled in ConvertStat
+const MaxSkippedIDs = 10
+
+// ConvertStat is the numbers of the definitions of an OVAL seen, converted and skipped by the reason by the converter of a family,
+// e.g. for the summary of the fetch to tell the definitions lost in the conversion. A definition converted into several releases is counted once.
+type ConvertStat struct {
+	Seen      int            `json:"seen"`
+	Converted int            `json:"converted"`
+	Skipped   map[string]int `json:"skipped,omitempty"` // by the reason, e.g. SkipRejected
+
+	SkippedIDs []string `json:"skippedIDs,omitempty"` // the first MaxSkippedIDs IDs of the skipped definitions, or their titles without ID
+
+	// the CVE IDs of the definitions split of several in one or uppercased, and the ones not of CVE moved to the references,
+	// e.g. TEMP- of Debian, by util.NormalizeCves
+	CvesNormalized int `json:"cvesNormalized,omitempty"`
+	CvesRerouted   int `json:"cvesRerouted,omitempty"`
+
+	// IDsDerived is the number of the definitions without ID converted by the ID derived of their titles, by util.DefinitionID
+	IDsDerived int `json:"idsDerived,omitempty"`
+}
+
+// Convert counts a definition converted
+func (s *ConvertStat) Convert() {
+	s.Seen++
+	s.Converted++
+}
+
+// Skip counts the definition of id skipped by reason, sampling id up to MaxSkippedIDs
+func (s *ConvertStat) Skip(id, reason string) {
+	s.Seen++
+	if s.Skipped == nil {
+		s.Skipped = map[string]int{}
+	}
+	s.Skipped[reason]++
+	if len(s.SkippedIDs) < MaxSkippedIDs {
+		s.SkippedIDs = append(s.SkippedIDs, id)
+	}
+}
+
+// SkippedTotal returns the number of the skipped definitions of all the reasons
+func (s ConvertStat) SkippedTotal() int {
+	n := 0
+	for _, c := range s.Skipped {
+		n += c
+	}
+	return n
+}
+
+// Add returns the sum of the numbers of s and o, with the IDs of the skipped definitions of both up to MaxSkippedIDs
+func (s ConvertStat) Add(o ConvertStat) ConvertStat {
+	sum := ConvertStat{Seen: s.Seen + o.Seen, Converted: s.Converted + o.Converted, CvesNormalized: s.CvesNormalized + o.CvesNormalized, CvesRerouted: s.CvesRerouted + o.CvesRerouted,
+		IDsDerived: s.IDsDerived + o.IDsDerived}
+	for _, m := range []map[string]int{s.Skipped, o.Skipped} {
+		for reason, n := range m {
+			if sum.Skipped == nil {
+				sum.Skipped = map[string]int{}
+			}
+			sum.Skipped[reason] += n
+		}
+	}
+	for _, id := range append(append([]string{}, s.SkippedIDs...), o.SkippedIDs...) {
+		if len(sum.SkippedIDs) == MaxSkippedIDs {
+			break
+		}
+		sum.SkippedIDs = append(sum.SkippedIDs, id)
+	}
+	return sum
+}
+
+// RootTimestamp is the timestamp of the stored OVAL of a family and a version, without counting its definitions unlike RootStat,
+// e.g. for the freshness reported by /health and the cache validators of the lookups of the server
+type RootTimestamp struct {
+	Family    string    `json:"family"`
+	OSVersion string    `json:"osVersion"`
+	Timestamp time.Time `json:"timestamp"`
+	SHA256    string    `json:"sha256"` // SHA-256 of the fetched OVAL files, empty if unknown
+	// ConvertDigest is the one of Root, of the binary and the options the OVAL was converted by, empty if unknown
+	ConvertDigest string `json:"convertDigest,omitempty"`
+}
 
-	Date time.Time
+// RootStat is the stats of the stored OVAL of a family and a version, e.g. for the status subcommand
+type RootStat struct {
+	Family      string    `json:"family"`
+	OSVersion   string    `json:"osVersion"`
+	Timestamp   time.Time `json:"timestamp"` // the timestamp of the OVAL, updated by every fetch even if unchanged
+	Definitions int       `json:"definitions"`
+	Packages    int       `json:"packages"` // the affected packages of the definitions
+	FileSize    int64     `json:"fileSize"` // size of the fetched OVAL files, zero if unknown
+	SHA256      string    `json:"sha256"`   // SHA-256 of the fetched OVAL files, empty if unknown
 }
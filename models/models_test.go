@@ -1,9 +1,19 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
+var update = flag.Bool("update", false, "update golden files")
+
 func Test_FetchMeta(t *testing.T) {
 	var tests = []struct {
 		in       FetchMeta
@@ -29,3 +39,337 @@ func Test_FetchMeta(t *testing.T) {
 		}
 	}
 }
+
+func TestRoot_Validate(t *testing.T) {
+	valid := Definition{
+		DefinitionID:  "oval:org.debian:def:100",
+		Advisory:      Advisory{Cves: []Cve{{CveID: "CVE-2014-3704"}}},
+		AffectedPacks: []Package{{Name: "drupal7", Version: "7.32-1+deb7u1"}},
+	}
+
+	var tests = []struct {
+		name    string
+		in      Root
+		opt     ValidateOption
+		wantErr string
+	}{
+		{
+			name: "valid",
+			in:   Root{Family: "debian", OSVersion: "7", Definitions: []Definition{valid}},
+			opt:  ValidateOption{MinDefinitions: 1},
+		},
+		{
+			name:    "truncated file",
+			in:      Root{Family: "debian", OSVersion: "7"},
+			opt:     ValidateOption{MinDefinitions: 1},
+			wantErr: "too few definitions: 0, expected at least 1",
+		},
+		{
+			name: "empty allowed",
+			in:   Root{Family: "debian", OSVersion: "7"},
+			opt:  ValidateOption{MinDefinitions: 0},
+		},
+		{
+			name:    "below floor",
+			in:      Root{Family: "debian", OSVersion: "7", Definitions: []Definition{valid}},
+			opt:     ValidateOption{MinDefinitions: 100},
+			wantErr: "too few definitions: 1, expected at least 100",
+		},
+		{
+			name:    "empty family and OS version",
+			in:      Root{Definitions: []Definition{valid}},
+			wantErr: "empty family; empty OS version",
+		},
+		{
+			name: "without CVEs and references",
+			in: Root{Family: "debian", OSVersion: "7", Definitions: []Definition{
+				valid,
+				{DefinitionID: "oval:org.debian:def:101", AffectedPacks: []Package{{Name: "bash"}}},
+			}},
+			wantErr: "definitions without CVEs and references: oval:org.debian:def:101",
+		},
+		{
+			name: "without CVEs and references with no details",
+			in: Root{Family: "debian", OSVersion: "7", Definitions: []Definition{
+				{DefinitionID: "oval:org.debian:def:101", AffectedPacks: []Package{{Name: "bash"}}},
+			}},
+			opt: ValidateOption{NoDetails: true},
+		},
+		{
+			name: "empty package name",
+			in: Root{Family: "debian", OSVersion: "7", Definitions: []Definition{
+				{DefinitionID: "oval:org.debian:def:102", References: []Reference{{Source: "CVE", RefID: "CVE-2014-3704"}}, AffectedPacks: []Package{{Version: "1.0"}}},
+			}},
+			wantErr: "definitions with empty package names: oval:org.debian:def:102",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.in.Validate(tt.opt)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %s", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("expected error containing: %q, actual: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDefinitionJSON(t *testing.T) {
+	def := Definition{
+		ID:           1,
+		RootID:       1,
+		DefinitionID: "oval:com.redhat.rhsa:def:20170933",
+		Title:        "RHSA-2017:0933: kernel security update (Important)",
+		Description:  "The kernel packages contain the Linux kernel, the core of any Linux operating system.",
+		Advisory: Advisory{
+			ID:           1,
+			DefinitionID: 1,
+			AdvisoryID:   "RHSA-2017:0933",
+			Class:        "security",
+			Severity:     "Important",
+			Cves: []Cve{
+				{
+					ID:         1,
+					AdvisoryID: 1,
+					CveID:      "CVE-2016-8650",
+					Cvss2:      "4.9/AV:L/AC:L/Au:N/C:N/I:N/A:C",
+					Cvss3:      "5.5/CVSS:3.0/AV:L/AC:L/PR:L/UI:N/S:U/C:N/I:N/A:H",
+					Cwe:        "CWE-476",
+					Impact:     "moderate",
+					Href:       "https://access.redhat.com/security/cve/CVE-2016-8650",
+					Public:     "20161115",
+				},
+			},
+			Bugzillas: []Bugzilla{
+				{
+					ID:         1,
+					AdvisoryID: 1,
+					BugzillaID: "1395187",
+					URL:        "https://bugzilla.redhat.com/1395187",
+					Title:      "CVE-2016-8650 kernel: Null pointer dereference via keyctl",
+				},
+			},
+			AffectedCPEList: []Cpe{
+				{
+					ID:         1,
+					AdvisoryID: 1,
+					Cpe:        "cpe:/o:redhat:enterprise_linux:7",
+				},
+			},
+			AffectedRepository: "",
+			Issued:             time.Date(2017, time.April, 12, 0, 0, 0, 0, time.UTC),
+			Updated:            time.Date(2017, time.April, 12, 0, 0, 0, 0, time.UTC),
+		},
+		Debian: &Debian{
+			ID:           1,
+			DefinitionID: 1,
+			DSA:          "DSA-3051-1",
+			MoreInfo:     "more info",
+			Date:         time.Date(2014, time.October, 15, 0, 0, 0, 0, time.UTC),
+		},
+		AffectedPacks: []Package{
+			{
+				ID:              1,
+				DefinitionID:    1,
+				Name:            "kernel",
+				Version:         "0:3.10.0-514.16.1.el7",
+				Arch:            "x86_64",
+				NotFixedYet:     false,
+				ModularityLabel: "",
+				Ksplice:         false,
+			},
+		},
+		References: []Reference{
+			{
+				ID:           1,
+				DefinitionID: 1,
+				Source:       "RHSA",
+				RefID:        "RHSA-2017:0933",
+				RefURL:       "https://access.redhat.com/errata/RHSA-2017:0933",
+			},
+		},
+	}
+
+	actual, err := json.MarshalIndent(def, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal. err: %s", err)
+	}
+
+	golden := filepath.Join("testdata", "definition.json")
+	if *update {
+		if err := os.WriteFile(golden, actual, 0644); err != nil {
+			t.Fatalf("Failed to update golden file. err: %s", err)
+		}
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read golden file. err: %s", err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(expected), bytes.TrimSpace(actual)) {
+		t.Errorf("expected: %s\n  actual: %s\n", expected, actual)
+	}
+}
+
+func TestDefinition_ContentHash(t *testing.T) {
+	def := Definition{
+		DefinitionID: "oval:com.redhat.rhsa:def:20231583",
+		AffectedPacks: []Package{
+			{Name: "nodejs", Version: "1:18.14.2-2.module+el8.7.0+18113+bc7e31cd", ModularityLabel: "nodejs:18"},
+			{Name: "npm", Version: "1:9.3.1-1.18.14.2.2.module+el8.7.0+18113+bc7e31cd", ModularityLabel: "nodejs:18"},
+		},
+		References: []Reference{{Source: "RHSA", RefID: "RHSA-2023:1583"}, {Source: "CVE", RefID: "CVE-2023-23918"}},
+	}
+	// as loaded from DB: of the IDs, the children in another order, and the empty children of the empty slices
+	loaded := def
+	loaded.ID = 1
+	loaded.AffectedPacks = []Package{{ID: 2, DefinitionID: 1, Name: "npm", Version: "1:9.3.1-1.18.14.2.2.module+el8.7.0+18113+bc7e31cd", ModularityLabel: "nodejs:18"}, {ID: 1, DefinitionID: 1, Name: "nodejs", Version: "1:18.14.2-2.module+el8.7.0+18113+bc7e31cd", ModularityLabel: "nodejs:18"}}
+	loaded.References = []Reference{def.References[1], def.References[0]}
+	loaded.Advisory.Cves = []Cve{}
+	if def.ContentHash() != loaded.ContentHash() {
+		t.Errorf("expected: the same hash of the definition loaded from DB, actual: %s and %s", def.ContentHash(), loaded.ContentHash())
+	}
+
+	changed := loaded
+	changed.AffectedPacks = append([]Package{}, loaded.AffectedPacks...)
+	changed.AffectedPacks[0].Version = "1:9.3.1-1.18.14.2.3.module+el8.7.0+18113+bc7e31cd"
+	if def.ContentHash() == changed.ContentHash() {
+		t.Errorf("expected: the hash of the changed package differs, actual: the same %s", def.ContentHash())
+	}
+}
+
+func TestRoot_StripDetails(t *testing.T) {
+	root := Root{Definitions: []Definition{{
+		DefinitionID:  "oval:org.debian:def:100",
+		Title:         "CVE-2023-0001",
+		Description:   "description",
+		Advisory:      Advisory{Severity: "High", Cves: []Cve{{CveID: "CVE-2023-0001"}}, Issued: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		Debian:        &Debian{DSA: "DSA-0001"},
+		AffectedPacks: []Package{{Name: "curl", Version: "1.0"}},
+		References:    []Reference{{Source: "CVE", RefID: "CVE-2023-0001"}},
+	}}}
+	root.StripDetails()
+
+	d := root.Definitions[0]
+	if d.Title != "" || d.Description != "" || d.Advisory.Severity != "" || !d.Advisory.Issued.IsZero() || d.Debian != nil || len(d.References) != 0 {
+		t.Errorf("expected: the details stripped, actual: %+v", d)
+	}
+	if d.DefinitionID == "" || len(d.Advisory.Cves) != 1 || len(d.AffectedPacks) != 1 {
+		t.Errorf("expected: the ID, the CVEs and the packages kept, actual: %+v", d)
+	}
+}
+
+func TestPackage_IsFixedIn(t *testing.T) {
+	tests := []struct {
+		name      string
+		pack      Package
+		installed string
+		family    string
+		want      bool
+	}{
+		{
+			name:      "rpm older",
+			pack:      Package{Name: "nodejs", Version: "1:18.14.2-2.module+el8.7.0+18113+bc7e31cd"},
+			installed: "1:18.14.2-1.module+el8.7.0+18113+bc7e31cd",
+			family:    "redhat",
+			want:      false,
+		},
+		{
+			name:      "rpm fixed",
+			pack:      Package{Name: "nodejs", Version: "1:18.14.2-2.module+el8.7.0+18113+bc7e31cd"},
+			installed: "1:18.14.2-2.module+el8.7.0+18113+bc7e31cd",
+			family:    "redhat",
+			want:      true,
+		},
+		{
+			name:      "rpm newer of the alias",
+			pack:      Package{Name: "openssl", Version: "1:3.0.9-2.fc38"},
+			installed: "1:3.0.9-10.fc38",
+			family:    "Fedora",
+			want:      true,
+		},
+		{
+			name:      "rpm older without epoch",
+			pack:      Package{Name: "openssl11", Version: "1:1.1.1g-2.amzn2.0.6"},
+			installed: "1.1.1g-2.amzn2.0.6",
+			family:    "amzn",
+			want:      false,
+		},
+		{
+			name:      "rpm of SUSE",
+			pack:      Package{Name: "libopenssl3", Version: "0:3.0.8-150500.5.8.1"},
+			installed: "3.0.8-150500.5.8.1",
+			family:    "sles",
+			want:      true,
+		},
+		{
+			name:      "deb older by tilde",
+			pack:      Package{Name: "libxml2", Version: "2.9.14+dfsg-1.3"},
+			installed: "2.9.14+dfsg-1.3~deb12u1",
+			family:    "debian",
+			want:      false,
+		},
+		{
+			name:      "deb fixed",
+			pack:      Package{Name: "libxml2", Version: "0:2.9.13+dfsg-1ubuntu0.3"},
+			installed: "2.9.13+dfsg-1ubuntu0.3",
+			family:    "ubuntu",
+			want:      true,
+		},
+		{
+			name:      "not fixed yet",
+			pack:      Package{Name: "libxml2-utils", NotFixedYet: true},
+			installed: "2.9.13+dfsg-1ubuntu0.3",
+			family:    "ubuntu",
+			want:      false,
+		},
+		{
+			name:      "alpine",
+			pack:      Package{Name: "curl", Version: "7.77.0-r0"},
+			installed: "8.1.2-r0",
+			family:    "alpine",
+			want:      false,
+		},
+		{
+			name:      "unknown family",
+			pack:      Package{Name: "curl", Version: "7.77.0-1"},
+			installed: "8.1.2-1",
+			family:    "windows",
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pack.IsFixedIn(tt.installed, tt.family); got != tt.want {
+				t.Errorf("expected: %t, actual: %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConvertStat_Add(t *testing.T) {
+	var a, b ConvertStat
+	for i := 0; i < MaxSkippedIDs; i++ {
+		a.Skip(fmt.Sprintf("oval:com.redhat.rhsa:def:%d", i), SkipRejected)
+	}
+	a.Convert()
+	b.Skip("oval:com.redhat.rhsa:def:100", SkipNoRelease)
+	b.Convert()
+	b.Convert()
+	b.IDsDerived++
+
+	sum := a.Add(b)
+	if sum.Seen != 14 || sum.Converted != 3 || sum.SkippedTotal() != 11 || sum.Skipped[SkipRejected] != 10 || sum.Skipped[SkipNoRelease] != 1 || sum.IDsDerived != 1 {
+		t.Errorf("expected: 14 seen, 3 converted and 11 skipped, actual: %+v", sum)
+	}
+	// the IDs are sampled up to MaxSkippedIDs, those of a first
+	if len(sum.SkippedIDs) != MaxSkippedIDs || sum.SkippedIDs[MaxSkippedIDs-1] != "oval:com.redhat.rhsa:def:9" {
+		t.Errorf("expected: the first %d IDs, actual: %q", MaxSkippedIDs, sum.SkippedIDs)
+	}
+	if a.Seen != 11 || len(a.Skipped) != 1 {
+		t.Errorf("expected: a unchanged, actual: %+v", a)
+	}
+}
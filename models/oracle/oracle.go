@@ -1,12 +1,15 @@
 package oracle
 
 import (
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
-	"time"
 
-	"github.com/spf13/viper"
+	"github.com/inconshreveable/log15"
 
 	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/util"
 )
 
 type distroPackage struct {
@@ -14,14 +17,23 @@ type distroPackage struct {
 	pack  models.Package
 }
 
-// ConvertToModel Convert OVAL to models
-func ConvertToModel(root *Root) (defs map[string][]models.Definition) {
+// ConvertToModel Convert OVAL to models, only of the advisories issued in years, with the stat of the definitions of all the releases
+func ConvertToModel(root *Root, years util.YearRange) (defs map[string][]models.Definition, stat models.ConvertStat) {
+	// the revised advisory may share the ID of the definition with the original one, e.g. ELSA-2017-0933-1 of ELSA-2017-0933
+	idCounts := map[string]int{}
+	for _, ovaldef := range root.Definitions.Definitions {
+		idCounts[ovaldef.ID]++
+	}
+
 	osVerDefs := map[string][]models.Definition{}
 	for _, ovaldef := range root.Definitions.Definitions {
 		if strings.Contains(ovaldef.Description, "** REJECT **") {
+			stat.Skip(ovaldef.ID, models.SkipRejected)
 			continue
 		}
 
+		id := util.DefinitionID(ovaldef.ID, ovaldef.Title, &stat)
+
 		cves := []models.Cve{}
 		for _, c := range ovaldef.Advisory.Cves {
 			cves = append(cves, models.Cve{
@@ -30,6 +42,8 @@ func ConvertToModel(root *Root) (defs map[string][]models.Definition) {
 			})
 		}
 
+		cves, rerouted := util.NormalizeCves(cves, &stat)
+
 		rs := []models.Reference{}
 		for _, r := range ovaldef.References {
 			rs = append(rs, models.Reference{
@@ -38,88 +52,212 @@ func ConvertToModel(root *Root) (defs map[string][]models.Definition) {
 				RefURL: r.RefURL,
 			})
 		}
+		rs = append(rs, rerouted...)
+
+		refs := util.NormalizeReferences(rs)
+		elsaID, revision := parseAdvisoryID(ovaldef.Title)
+		advisoryURL := util.AdvisoryURL(elsaID, refs, errataURL)
+
+		severity := ovaldef.Advisory.Severity
+		if strings.TrimSpace(severity) == "" {
+			severity = titleSeverity(ovaldef.Title)
+		}
+
+		// keep both the original and the revised one, rather than the first of the same DefinitionID stored
+		defID := id
+		if idCounts[ovaldef.ID] > 1 && revision > 0 {
+			defID = fmt.Sprintf("%s-%d", id, revision)
+		}
+
+		issued := util.ParsedOrDefaultTime([]string{"2006-01-02"}, ovaldef.Advisory.Issued.Date)
+		if !years.Contains(issued) {
+			stat.Skip(id, models.SkipOutOfYears)
+			continue
+		}
 
 		osVerPacks := map[string][]models.Package{}
 		for _, distPack := range collectOraclePacks(ovaldef.Criteria) {
 			osVerPacks[distPack.osVer] = append(osVerPacks[distPack.osVer], distPack.pack)
 		}
+		if len(osVerPacks) == 0 {
+			stat.Skip(id, models.SkipNoRelease)
+			continue
+		}
+		stat.Convert()
 
 		for osVer, packs := range osVerPacks {
 			def := models.Definition{
-				DefinitionID: ovaldef.ID,
+				DefinitionID: defID,
+				Class:        strings.TrimSpace(ovaldef.Class),
 				Title:        strings.TrimSpace(ovaldef.Title),
 				Description:  strings.TrimSpace(ovaldef.Description),
+				Severity:     util.NormalizeSeverity(ovaldef.Severity),
 				Advisory: models.Advisory{
-					Severity:        ovaldef.Advisory.Severity,
+					AdvisoryID:      elsaID,
+					AdvisoryURL:     advisoryURL,
+					Revision:        revision,
+					Severity:        util.NormalizeSeverity(severity),
 					Cves:            append([]models.Cve{}, cves...), // If the same slice is used, it will only be stored once in the DB
 					Bugzillas:       []models.Bugzilla{},
 					AffectedCPEList: []models.Cpe{},
-					Issued:          time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC),
-					Updated:         time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC),
+					Issued:          issued,
+					Updated:         issued, // Oracle OVAL does not have an updated date
 				},
 				Debian:        nil,
-				AffectedPacks: append([]models.Package{}, packs...), // If the same slice is used, it will only be stored once in the DB
-				References:    append([]models.Reference{}, rs...),  // If the same slice is used, it will only be stored once in the DB
-			}
-
-			if viper.GetBool("no-details") {
-				def.Title = ""
-				def.Description = ""
-				def.Advisory.Severity = ""
-				def.Advisory.Bugzillas = []models.Bugzilla{}
-				def.Advisory.AffectedCPEList = []models.Cpe{}
-				def.Advisory.Issued = time.Time{}
-				def.Advisory.Updated = time.Time{}
-				def.References = []models.Reference{}
+				AffectedPacks: append([]models.Package{}, packs...),  // If the same slice is used, it will only be stored once in the DB
+				References:    append([]models.Reference{}, refs...), // If the same slice is used, it will only be stored once in the DB
 			}
 
 			osVerDefs[osVer] = append(osVerDefs[osVer], def)
 		}
 	}
+	if !years.IsZero() {
+		log15.Info("Filtered by the issued year", "From", years.From, "To", years.To, "Filtered", stat.Skipped[models.SkipOutOfYears])
+	}
+
+	return osVerDefs, stat
+}
+
+var (
+	// e.g. "ELSA-2017-0933:  kernel security update (IMPORTANT)" and "ELSA-2017-0933-1:  kernel security update (IMPORTANT)" of the revised one
+	elsaIDPattern = regexp.MustCompile(`(?i)^ELSA-(\d{4})-(\d+)(?:-(\d+))?\s*:`)
+	// e.g. "(IMPORTANT)", "( Moderate )" at the end of the title
+	titleSeverityPattern = regexp.MustCompile(`(?i)\(\s*(critical|important|moderate|low|none|n/a)\s*\)$`)
+)
+
+// parseAdvisoryID returns the ID of the advisory with its revision and the revision from the title, or "" and 0 if not of ELSA,
+// e.g. "ELSA-2018-4250:  Unbreakable Enterprise kernel security update (IMPORTANT)" -> ("ELSA-2018-4250", 0),
+// "ELSA-2017-0933-1:  kernel security update (IMPORTANT)" -> ("ELSA-2017-0933-1", 1)
+func parseAdvisoryID(title string) (string, int) {
+	m := elsaIDPattern.FindStringSubmatch(strings.TrimSpace(title))
+	if m == nil {
+		return "", 0
+	}
+	if m[3] == "" {
+		return fmt.Sprintf("ELSA-%s-%s", m[1], m[2]), 0
+	}
+	revision, err := strconv.Atoi(m[3])
+	if err != nil {
+		return "", 0
+	}
+	return fmt.Sprintf("ELSA-%s-%s-%d", m[1], m[2], revision), revision
+}
+
+// titleSeverity returns the severity at the end of the title, or "" if none, e.g. "ELSA-2023-3349:  openssl security update (MODERATE)" -> "MODERATE"
+func titleSeverity(title string) string {
+	m := titleSeverityPattern.FindStringSubmatch(strings.TrimSpace(title))
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
 
-	return osVerDefs
+// errataURL returns the URL of the errata of the advisory id, e.g. https://linux.oracle.com/errata/ELSA-2018-4250.html
+func errataURL(id string) string {
+	return "https://linux.oracle.com/errata/" + id + ".html"
 }
 
 func collectOraclePacks(cri Criteria) []distroPackage {
-	return walkOracle(cri, "", "", []distroPackage{})
+	return walkOracle(cri, oracleConditions{}, []distroPackage{})
 }
 
-func walkOracle(cri Criteria, osVer, arch string, acc []distroPackage) []distroPackage {
+// oracleConditions are the conditions the packages of a branch are affected on, of its criterions and of the outer branches
+type oracleConditions struct {
+	osVer   string
+	arch    string
+	ksplice bool
+}
+
+// apply sets the condition of the criterion, which is not of a package
+func (cond *oracleConditions) apply(c Criterion) {
+	switch {
+	// <criterion test_ref="oval:com.oracle.elsa:tst:20110498001" comment="Oracle Linux 6 is installed"/>
+	case strings.HasPrefix(c.Comment, "Oracle Linux ") && strings.HasSuffix(c.Comment, " is installed"):
+		cond.osVer = strings.TrimSuffix(strings.TrimPrefix(c.Comment, "Oracle Linux "), " is installed")
+	// <criterion test_ref="oval:com.oracle.elsa:tst:20110498002" comment="Oracle Linux arch is x86_64"/>
+	case strings.HasPrefix(c.Comment, "Oracle Linux arch is "):
+		cond.arch = strings.TrimSpace(strings.TrimPrefix(c.Comment, "Oracle Linux arch is "))
+	// <criterion test_ref="oval:com.oracle.elsa:tst:20200112003" comment="kernel-uek ksplice is installed"/>
+	case strings.Contains(strings.ToLower(c.Comment), "ksplice"):
+		cond.ksplice = true
+	}
+}
+
+// oraclePackage returns the package and its fixed version of the criterion, e.g. "kernel-uek is earlier than 0:4.14.35-1902.10.8.el7uek"
+func oraclePackage(c Criterion) (name, version string, ok bool) {
+	ss := strings.Split(c.Comment, " is earlier than ")
+	if len(ss) != 2 {
+		return "", "", false
+	}
+	return ss[0], ss[1], true
+}
+
+// hasOraclePackage reports whether the criterions of cri or of its branches have a package
+func hasOraclePackage(cri Criteria) bool {
 	for _, c := range cri.Criterions {
-		// <criterion test_ref="oval:com.oracle.elsa:tst:20110498001" comment="Oracle Linux 6 is installed"/>
-		if strings.HasPrefix(c.Comment, "Oracle Linux ") &&
-			strings.HasSuffix(c.Comment, " is installed") {
-			osVer = strings.TrimSuffix(strings.TrimPrefix(c.Comment, "Oracle Linux "), " is installed")
+		if _, _, ok := oraclePackage(c); ok {
+			return true
 		}
-
-		// <criterion test_ref="oval:com.oracle.elsa:tst:20110498002" comment="Oracle Linux arch is x86_64"/>
-		const archPrefix = "Oracle Linux arch is "
-		if strings.HasPrefix(c.Comment, archPrefix) {
-			arch = strings.TrimSpace(strings.TrimPrefix(c.Comment, archPrefix))
+	}
+	for _, c := range cri.Criterias {
+		if hasOraclePackage(c) {
+			return true
 		}
+	}
+	return false
+}
 
-		ss := strings.Split(c.Comment, " is earlier than ")
-		if len(ss) != 2 {
-			continue
+// applyOracleConditions sets the conditions of all the criterions of cri and its branches, which have no package
+func applyOracleConditions(cri Criteria, cond *oracleConditions) {
+	for _, c := range cri.Criterions {
+		cond.apply(c)
+	}
+	for _, c := range cri.Criterias {
+		applyOracleConditions(c, cond)
+	}
+}
+
+// walkOracle returns the packages of the criterions of cri and its branches, affected on the conditions of cond and of cri.
+// The conditions of cri are of all its criterions wherever they are among the packages, and of its branches without packages if it is AND,
+// e.g. AND[AND[arch is x86_64, ksplice is installed], OR[packages]], so that neither the order nor the nesting loses them.
+func walkOracle(cri Criteria, cond oracleConditions, acc []distroPackage) []distroPackage {
+	for _, c := range cri.Criterions {
+		if _, _, ok := oraclePackage(c); !ok {
+			cond.apply(c)
+		}
+	}
+	if strings.EqualFold(cri.Operator, "AND") {
+		for _, c := range cri.Criterias {
+			if !hasOraclePackage(c) {
+				applyOracleConditions(c, &cond)
+			}
 		}
-		if ss[1] == "0" {
+	}
+
+	for _, c := range cri.Criterions {
+		name, fixed, ok := oraclePackage(c)
+		if !ok || fixed == "0" {
 			continue
 		}
+		// e.g. glibc is earlier than 2:2.17-317.0.1.el7.ksplice1 (userspace ksplice)
+		version := strings.Split(fixed, " ")[0]
+		normalized, raw := util.NormalizedVersion(version, util.NormalizeEVR)
 		acc = append(acc, distroPackage{
-			osVer: osVer,
+			osVer: cond.osVer,
 			pack: models.Package{
-				Name:    ss[0],
-				Version: strings.Split(ss[1], " ")[0],
-				Arch:    arch,
+				Name:       name,
+				Version:    normalized,
+				RawVersion: raw,
+				Arch:       cond.arch,
+				Ksplice:    cond.ksplice || strings.Contains(version, ".ksplice"),
 			},
 		})
 	}
 
-	if len(cri.Criterias) == 0 {
-		return acc
-	}
 	for _, c := range cri.Criterias {
-		acc = walkOracle(c, osVer, arch, acc)
+		if hasOraclePackage(c) {
+			acc = walkOracle(c, cond, acc)
+		}
 	}
 	return acc
 }
@@ -0,0 +1,615 @@
+package oracle
+
+import (
+	"context"
+	"encoding/xml"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/k0kubun/pp"
+	"github.com/spf13/viper"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/util"
+)
+
+func TestWalkOracle(t *testing.T) {
+	var tests = []struct {
+		oval     string
+		expected []distroPackage
+	}{
+		{
+			oval: `<?xml version="1.0" ?>
+<oval_definitions>
+  <definitions>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20200112" version="501">
+      <criteria operator="AND">
+        <criterion test_ref="oval:com.oracle.elsa:tst:20200112001" comment="Oracle Linux 7 is installed"/>
+        <criteria operator="OR">
+          <criteria operator="AND">
+            <criterion test_ref="oval:com.oracle.elsa:tst:20200112002" comment="Oracle Linux arch is x86_64"/>
+            <criterion test_ref="oval:com.oracle.elsa:tst:20200112003" comment="kernel-uek is earlier than 0:4.14.35-1902.10.8.el7uek"/>
+          </criteria>
+          <criteria operator="AND">
+            <criterion test_ref="oval:com.oracle.elsa:tst:20200112002" comment="Oracle Linux arch is x86_64"/>
+            <criterion test_ref="oval:com.oracle.elsa:tst:20200112004" comment="kernel-uek ksplice is installed"/>
+            <criterion test_ref="oval:com.oracle.elsa:tst:20200112005" comment="kernel-uek is earlier than 0:4.14.35-1902.10.4.el7uek"/>
+          </criteria>
+          <criteria operator="AND">
+            <criterion test_ref="oval:com.oracle.elsa:tst:20200112002" comment="Oracle Linux arch is x86_64"/>
+            <criterion test_ref="oval:com.oracle.elsa:tst:20200112006" comment="glibc is earlier than 2:2.17-292.0.1.el7.ksplice1"/>
+          </criteria>
+        </criteria>
+      </criteria>
+    </definition>
+  </definitions>
+</oval_definitions>`,
+			expected: []distroPackage{
+				{
+					osVer: "7",
+					pack: models.Package{
+						Name:    "kernel-uek",
+						Version: "0:4.14.35-1902.10.8.el7uek",
+						Arch:    "x86_64",
+					},
+				},
+				{
+					osVer: "7",
+					pack: models.Package{
+						Name:    "kernel-uek",
+						Version: "0:4.14.35-1902.10.4.el7uek",
+						Arch:    "x86_64",
+						Ksplice: true,
+					},
+				},
+				{
+					osVer: "7",
+					pack: models.Package{
+						Name:    "glibc",
+						Version: "2:2.17-292.0.1.el7.ksplice1",
+						Arch:    "x86_64",
+						Ksplice: true,
+					},
+				},
+			},
+		},
+		{
+			// the criterion of ksplice after the package
+			oval: `<?xml version="1.0" ?>
+<oval_definitions>
+  <definitions>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20200112" version="501">
+      <criteria operator="AND">
+        <criterion test_ref="oval:com.oracle.elsa:tst:20200112001" comment="Oracle Linux 7 is installed"/>
+        <criteria operator="AND">
+          <criterion test_ref="oval:com.oracle.elsa:tst:20200112005" comment="kernel-uek is earlier than 0:4.14.35-1902.10.4.el7uek"/>
+          <criterion test_ref="oval:com.oracle.elsa:tst:20200112002" comment="Oracle Linux arch is x86_64"/>
+          <criterion test_ref="oval:com.oracle.elsa:tst:20200112004" comment="kernel-uek ksplice is installed"/>
+        </criteria>
+      </criteria>
+    </definition>
+  </definitions>
+</oval_definitions>`,
+			expected: []distroPackage{
+				{
+					osVer: "7",
+					pack: models.Package{
+						Name:    "kernel-uek",
+						Version: "0:4.14.35-1902.10.4.el7uek",
+						Arch:    "x86_64",
+						Ksplice: true,
+					},
+				},
+			},
+		},
+		{
+			// the conditions of the sibling branch without packages of AND, and none of the branches of OR to the others
+			oval: `<?xml version="1.0" ?>
+<oval_definitions>
+  <definitions>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230001" version="501">
+      <criteria operator="AND">
+        <criterion test_ref="oval:com.oracle.elsa:tst:20230001001" comment="Oracle Linux 8 is installed"/>
+        <criteria operator="OR">
+          <criteria operator="AND">
+            <criteria operator="AND">
+              <criterion test_ref="oval:com.oracle.elsa:tst:20230001002" comment="Oracle Linux arch is x86_64"/>
+              <criterion test_ref="oval:com.oracle.elsa:tst:20230001003" comment="kernel-uek ksplice is installed"/>
+            </criteria>
+            <criteria operator="OR">
+              <criterion test_ref="oval:com.oracle.elsa:tst:20230001004" comment="kernel-uek is earlier than 0:5.4.17-2136.320.7.el8uek"/>
+              <criterion test_ref="oval:com.oracle.elsa:tst:20230001005" comment="kernel-uek-devel is earlier than 0:5.4.17-2136.320.7.el8uek"/>
+            </criteria>
+          </criteria>
+          <criteria operator="AND">
+            <criterion test_ref="oval:com.oracle.elsa:tst:20230001006" comment="Oracle Linux arch is aarch64"/>
+            <criteria operator="OR">
+              <criterion test_ref="oval:com.oracle.elsa:tst:20230001007" comment="kernel-uek is earlier than 0:5.4.17-2136.321.4.el8uek"/>
+            </criteria>
+          </criteria>
+        </criteria>
+      </criteria>
+    </definition>
+  </definitions>
+</oval_definitions>`,
+			expected: []distroPackage{
+				{
+					osVer: "8",
+					pack: models.Package{
+						Name:    "kernel-uek",
+						Version: "0:5.4.17-2136.320.7.el8uek",
+						Arch:    "x86_64",
+						Ksplice: true,
+					},
+				},
+				{
+					osVer: "8",
+					pack: models.Package{
+						Name:    "kernel-uek-devel",
+						Version: "0:5.4.17-2136.320.7.el8uek",
+						Arch:    "x86_64",
+						Ksplice: true,
+					},
+				},
+				{
+					osVer: "8",
+					pack: models.Package{
+						Name:    "kernel-uek",
+						Version: "0:5.4.17-2136.321.4.el8uek",
+						Arch:    "aarch64",
+					},
+				},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		var root *Root
+		if err := xml.Unmarshal([]byte(tt.oval), &root); err != nil {
+			t.Errorf("[%d] marshall error", i)
+		}
+		actual := collectOraclePacks(root.Definitions.Definitions[0].Criteria)
+
+		if !reflect.DeepEqual(tt.expected, actual) {
+			e := pp.Sprintf("%v", tt.expected)
+			a := pp.Sprintf("%v", actual)
+			t.Errorf("[%d]: expected: %s\n, actual: %s\n", i, e, a)
+		}
+	}
+}
+
+func TestConvertToModelIssuedYears(t *testing.T) {
+	oval := `<?xml version="1.0" ?>
+<oval_definitions>
+  <definitions>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20140001" version="501">
+      <metadata><advisory><issued date="2014-01-02"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.45-5.el7_0.4"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20160001" version="501">
+      <metadata><advisory><issued date="2016-01-02"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="glibc is earlier than 0:2.17-106.el7_2.1"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20180001" version="501">
+      <metadata><advisory><issued date="2018-01-02"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="kernel is earlier than 0:3.10.0-693.11.6.el7"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20200001" version="501">
+      <metadata><advisory><issued date="2020-01-02"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="sudo is earlier than 0:1.8.23-9.el7"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:00000001" version="501">
+      <metadata><advisory><issued date=""/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="openssl is earlier than 1:1.0.2k-8.el7"/>
+      </criteria>
+    </definition>
+  </definitions>
+</oval_definitions>`
+	var root Root
+	if err := xml.Unmarshal([]byte(oval), &root); err != nil {
+		t.Fatalf("Failed to unmarshal. err: %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		years util.YearRange
+		want  []string
+	}{
+		{
+			name: "unbounded",
+			want: []string{"oval:com.oracle.elsa:def:20140001", "oval:com.oracle.elsa:def:20160001", "oval:com.oracle.elsa:def:20180001", "oval:com.oracle.elsa:def:20200001", "oval:com.oracle.elsa:def:00000001"},
+		},
+		{
+			name:  "since 2016",
+			years: util.YearRange{From: 2016},
+			want:  []string{"oval:com.oracle.elsa:def:20160001", "oval:com.oracle.elsa:def:20180001", "oval:com.oracle.elsa:def:20200001", "oval:com.oracle.elsa:def:00000001"},
+		},
+		{
+			name:  "2015-2018",
+			years: util.YearRange{From: 2015, To: 2018},
+			want:  []string{"oval:com.oracle.elsa:def:20160001", "oval:com.oracle.elsa:def:20180001", "oval:com.oracle.elsa:def:00000001"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			osVerDefs, stat := ConvertToModel(&root, tt.years)
+			for _, d := range osVerDefs["7"] {
+				got = append(got, d.DefinitionID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+			// the definitions filtered out are counted as skipped
+			if stat.Seen != 5 || stat.Converted != len(tt.want) || stat.Skipped[models.SkipOutOfYears] != 5-len(tt.want) {
+				t.Errorf("got stat: %+v, want: %d converted of 5", stat, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestConvertToModelAdvisoryURL(t *testing.T) {
+	oval := `<?xml version="1.0" ?>
+<oval_definitions>
+  <definitions>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20184250" version="501">
+      <metadata>
+        <title>ELSA-2018-4250:  Unbreakable Enterprise kernel security update (IMPORTANT)</title>
+        <reference source="elsa" ref_id="ELSA-2018-4250" ref_url="https://linux.oracle.com/errata/ELSA-2018-4250.html"/>
+      </metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="kernel-uek is earlier than 0:4.14.35-1818.2.1.el7uek"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230001" version="501">
+      <metadata>
+        <title>ELSA-2023-0001:  bash security update (MODERATE)</title>
+        <reference source="elsa" ref_id="ELSA-2023-0001" ref_url="https://linux.oracle.com/errata/ELSA-2023-0001-mirror.html"/>
+      </metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230002" version="501">
+      <metadata>
+        <title>ELSA-2023-0002:  sudo security update (IMPORTANT)</title>
+        <reference source="CVE" ref_id="CVE-2023-0002" ref_url="https://linux.oracle.com/cve/CVE-2023-0002.html"/>
+      </metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="sudo is earlier than 0:1.8.23-10.el7_9.3"/>
+      </criteria>
+    </definition>
+  </definitions>
+</oval_definitions>`
+	var root Root
+	if err := xml.Unmarshal([]byte(oval), &root); err != nil {
+		t.Fatalf("Failed to unmarshal. err: %s", err)
+	}
+
+	got := map[string]string{}
+	osVerDefs, _ := ConvertToModel(&root, util.YearRange{})
+	for _, d := range osVerDefs["7"] {
+		got[d.DefinitionID] = d.Advisory.AdvisoryURL
+	}
+	want := map[string]string{
+		"oval:com.oracle.elsa:def:20184250": "https://linux.oracle.com/errata/ELSA-2018-4250.html",
+		// the reference of the advisory wins over errataURL
+		"oval:com.oracle.elsa:def:20230001": "https://linux.oracle.com/errata/ELSA-2023-0001-mirror.html",
+		"oval:com.oracle.elsa:def:20230002": "https://linux.oracle.com/errata/ELSA-2023-0002.html",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestParseAdvisoryID(t *testing.T) {
+	tests := []struct {
+		title        string
+		wantID       string
+		wantRevision int
+		wantSeverity string
+	}{
+		{title: "ELSA-2018-4250:  Unbreakable Enterprise kernel security update (IMPORTANT)", wantID: "ELSA-2018-4250", wantSeverity: "IMPORTANT"},
+		{title: "\nELSA-2017-0933-1:  kernel security update (IMPORTANT)\n        ", wantID: "ELSA-2017-0933-1", wantRevision: 1, wantSeverity: "IMPORTANT"},
+		{title: "ELSA-2017-0933-2 : kernel security update ( Moderate )", wantID: "ELSA-2017-0933-2", wantRevision: 2, wantSeverity: "Moderate"},
+		{title: "elsa-2023-0001:  bash security update", wantID: "ELSA-2023-0001"},
+		{title: "ELSA-2023-0002:  Unbreakable Enterprise kernel security update (UEK R5)", wantID: "ELSA-2023-0002"},
+		{title: "CVE-2023-0001:  bash security update (LOW)", wantSeverity: "LOW"},
+	}
+	for _, tt := range tests {
+		id, revision := parseAdvisoryID(tt.title)
+		if id != tt.wantID || revision != tt.wantRevision {
+			t.Errorf("parseAdvisoryID(%q): expected: (%q, %d), actual: (%q, %d)", tt.title, tt.wantID, tt.wantRevision, id, revision)
+		}
+		if severity := titleSeverity(tt.title); severity != tt.wantSeverity {
+			t.Errorf("titleSeverity(%q): expected: %q, actual: %q", tt.title, tt.wantSeverity, severity)
+		}
+	}
+}
+
+func TestConvertToModelRevision(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	// ELSA-2017-0933-1 revises ELSA-2017-0933 under the same ID of the definition with another package, and has no advisory>severity
+	oval := `<?xml version="1.0" ?>
+<oval_definitions>
+  <definitions>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20170933" version="501">
+      <metadata>
+        <title>ELSA-2017-0933:  kernel security update (IMPORTANT)</title>
+        <advisory>
+          <severity>IMPORTANT</severity>
+          <issued date="2017-04-12"/>
+          <cve href="https://linux.oracle.com/cve/CVE-2016-8650.html">CVE-2016-8650</cve>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="kernel is earlier than 0:3.10.0-514.16.1.el7"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20170933" version="502">
+      <metadata>
+        <title>ELSA-2017-0933-1:  kernel security update (IMPORTANT)</title>
+        <advisory>
+          <issued date="2017-04-20"/>
+          <cve href="https://linux.oracle.com/cve/CVE-2016-8650.html">CVE-2016-8650</cve>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="kernel-uek is earlier than 0:4.1.12-94.3.1.el7uek"/>
+      </criteria>
+    </definition>
+  </definitions>
+</oval_definitions>`
+	var root Root
+	if err := xml.Unmarshal([]byte(oval), &root); err != nil {
+		t.Fatalf("Failed to unmarshal. err: %s", err)
+	}
+	osVerDefs, _ := ConvertToModel(&root, util.YearRange{})
+
+	type advisory struct {
+		definitionID, advisoryID, advisoryURL, severity string
+		revision                                        int
+	}
+	want := []advisory{
+		{definitionID: "oval:com.oracle.elsa:def:20170933", advisoryID: "ELSA-2017-0933", advisoryURL: "https://linux.oracle.com/errata/ELSA-2017-0933.html", severity: "Important"},
+		{definitionID: "oval:com.oracle.elsa:def:20170933-1", advisoryID: "ELSA-2017-0933-1", advisoryURL: "https://linux.oracle.com/errata/ELSA-2017-0933-1.html", severity: "Important", revision: 1},
+	}
+	got := []advisory{}
+	for _, d := range osVerDefs["7"] {
+		got = append(got, advisory{definitionID: d.DefinitionID, advisoryID: d.Advisory.AdvisoryID, advisoryURL: d.Advisory.AdvisoryURL, severity: d.Advisory.Severity, revision: d.Advisory.Revision})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected: %+v, actual: %+v", want, got)
+	}
+
+	// both are stored, and found by the CVE
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	if _, err := driver.InsertOval(context.Background(), &models.Root{Family: c.Oracle, OSVersion: "7", Timestamp: time.Now(), Definitions: osVerDefs["7"]}); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	defs, err := driver.GetByCveID(context.Background(), c.Oracle, "7", "CVE-2016-8650", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByCveID. err: %s", err)
+	}
+	got = []advisory{}
+	for _, d := range defs {
+		got = append(got, advisory{definitionID: d.DefinitionID, advisoryID: d.Advisory.AdvisoryID, advisoryURL: d.Advisory.AdvisoryURL, severity: d.Advisory.Severity, revision: d.Advisory.Revision})
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].definitionID < got[j].definitionID })
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetByCveID: expected: %+v, actual: %+v", want, got)
+	}
+}
+
+func TestConvertToModelDates(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	// the issued date missing, empty or malformed falls back to the default time of ParsedOrDefaultTime, and Updated follows Issued
+	oval := `<?xml version="1.0" ?>
+<oval_definitions>
+  <definitions>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230001" version="501">
+      <metadata><advisory><issued date="2023-01-02"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230002" version="501">
+      <metadata><advisory></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230003" version="501">
+      <metadata><advisory><issued date=""/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230004" version="501">
+      <metadata><advisory><issued date="2023-13-45"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230005" version="501">
+      <metadata><advisory><issued date="garbage"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+  </definitions>
+</oval_definitions>`
+	var root Root
+	if err := xml.Unmarshal([]byte(oval), &root); err != nil {
+		t.Fatalf("Failed to unmarshal. err: %s", err)
+	}
+
+	fallback := time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	want := map[string]time.Time{
+		"oval:com.oracle.elsa:def:20230001": time.Date(2023, time.January, 2, 0, 0, 0, 0, time.UTC),
+		"oval:com.oracle.elsa:def:20230002": fallback,
+		"oval:com.oracle.elsa:def:20230003": fallback,
+		"oval:com.oracle.elsa:def:20230004": fallback,
+		"oval:com.oracle.elsa:def:20230005": fallback,
+	}
+	check := func(name string, defs []models.Definition) {
+		t.Helper()
+		if len(defs) != len(want) {
+			t.Fatalf("%s: expected: %d definitions, actual: %d", name, len(want), len(defs))
+		}
+		for _, d := range defs {
+			if !d.Advisory.Issued.Equal(want[d.DefinitionID]) || !d.Advisory.Updated.Equal(want[d.DefinitionID]) {
+				t.Errorf("%s: %s: expected: issued and updated %s, actual: %s and %s", name, d.DefinitionID, want[d.DefinitionID], d.Advisory.Issued, d.Advisory.Updated)
+			}
+		}
+	}
+
+	osVerDefs, _ := ConvertToModel(&root, util.YearRange{})
+	check("ConvertToModel", osVerDefs["7"])
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	if _, err := driver.InsertOval(context.Background(), &models.Root{Family: c.Oracle, OSVersion: "7", Timestamp: time.Now(), Definitions: osVerDefs["7"]}); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	defs, err := driver.GetByPackName(context.Background(), c.Oracle, "7", "bash", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	check("GetByPackName", defs)
+}
+
+func TestConvertToModelSeverity(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	// the upper case severities of Oracle are stored capitalized as the ones of RedHat, and the unknown one as it is
+	oval := `<?xml version="1.0" ?>
+<oval_definitions>
+  <definitions>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230001" version="501">
+      <metadata><advisory><severity>IMPORTANT</severity><issued date="2023-01-02"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230002" version="501">
+      <metadata><advisory><severity>MODERATE</severity><issued date="2023-01-02"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230003" version="501">
+      <metadata><advisory><severity>low</severity><issued date="2023-01-02"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230004" version="501">
+      <metadata><advisory><severity>Critical</severity><issued date="2023-01-02"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230005" version="501">
+      <metadata><advisory><severity>N/A</severity><issued date="2023-01-02"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+    <definition class="patch" id="oval:com.oracle.elsa:def:20230006" version="501">
+      <metadata><advisory><severity>Unknown-Vendor</severity><issued date="2023-01-02"/></advisory></metadata>
+      <criteria operator="AND">
+        <criterion comment="Oracle Linux 7 is installed"/>
+        <criterion comment="bash is earlier than 0:4.2.46-35.el7_9"/>
+      </criteria>
+    </definition>
+  </definitions>
+</oval_definitions>`
+	var root Root
+	if err := xml.Unmarshal([]byte(oval), &root); err != nil {
+		t.Fatalf("Failed to unmarshal. err: %s", err)
+	}
+
+	want := map[string]string{
+		"oval:com.oracle.elsa:def:20230001": "Important",
+		"oval:com.oracle.elsa:def:20230002": "Moderate",
+		"oval:com.oracle.elsa:def:20230003": "Low",
+		"oval:com.oracle.elsa:def:20230004": "Critical",
+		"oval:com.oracle.elsa:def:20230005": "N/A",
+		"oval:com.oracle.elsa:def:20230006": "Unknown-Vendor",
+	}
+	check := func(name string, defs []models.Definition) {
+		t.Helper()
+		if len(defs) != len(want) {
+			t.Fatalf("%s: expected: %d definitions, actual: %d", name, len(want), len(defs))
+		}
+		for _, d := range defs {
+			if w := want[d.DefinitionID]; d.Advisory.Severity != w {
+				t.Errorf("%s: %s: expected: %q, actual: %q", name, d.DefinitionID, w, d.Advisory.Severity)
+			}
+		}
+	}
+
+	osVerDefs, _ := ConvertToModel(&root, util.YearRange{})
+	check("ConvertToModel", osVerDefs["7"])
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	if _, err := driver.InsertOval(context.Background(), &models.Root{Family: c.Oracle, OSVersion: "7", Timestamp: time.Now(), Definitions: osVerDefs["7"]}); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	defs, err := driver.GetByPackName(context.Background(), c.Oracle, "7", "bash", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	check("GetByPackName", defs)
+}
@@ -1,96 +1,95 @@
 package redhat
 
 import (
+	"encoding/xml"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
+	"github.com/inconshreveable/log15"
 	version "github.com/knqyf263/go-rpm-version"
-	"github.com/spf13/viper"
 	"golang.org/x/exp/maps"
+	"golang.org/x/xerrors"
 
 	"github.com/vulsio/goval-dictionary/models"
 	"github.com/vulsio/goval-dictionary/models/util"
 )
 
-// ConvertToModel Convert OVAL to models
-func ConvertToModel(v string, roots []Root) []models.Definition {
-	defs := map[string]models.Definition{}
+// ConvertToModel Convert OVAL to models, with the stat of the definitions of all the roots
+func ConvertToModel(v string, roots []Root) ([]models.Definition, models.ConvertStat) {
+	var stat models.ConvertStat
+	defss := make([][]models.Definition, 0, len(roots))
 	for _, root := range roots {
+		defs := make([]models.Definition, 0, len(root.Definitions.Definitions))
 		for _, d := range root.Definitions.Definitions {
-			if strings.Contains(d.Description, "** REJECT **") {
+			def, skipped := convertDefinition(v, d, &stat)
+			if skipped != "" {
+				stat.Skip(skippedID(d), skipped)
 				continue
 			}
+			stat.Convert()
+			defs = append(defs, def)
+		}
+		defss = append(defss, defs)
+	}
+	return MergeDefinitions(defss...), stat
+}
 
-			cves := []models.Cve{}
-			for _, c := range d.Advisory.Cves {
-				cves = append(cves, models.Cve{
-					CveID:  c.CveID,
-					Cvss2:  c.Cvss2,
-					Cvss3:  c.Cvss3,
-					Cwe:    c.Cwe,
-					Impact: c.Impact,
-					Href:   c.Href,
-					Public: c.Public,
-				})
-			}
-
-			rs := []models.Reference{}
-			for _, r := range d.References {
-				rs = append(rs, models.Reference{
-					Source: r.Source,
-					RefID:  r.RefID,
-					RefURL: r.RefURL,
-				})
-			}
+// Decode decodes the OVAL from r one definition at a time and converts each to models as it goes,
+// so that the whole OVAL is never held in memory as one Root
+func Decode(v string, r io.Reader) (Generator, []models.Definition, models.ConvertStat, error) {
+	var (
+		gen  Generator
+		defs []models.Definition
+		stat models.ConvertStat
+	)
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Generator{}, nil, models.ConvertStat{}, xerrors.Errorf("Failed to decode xml at offset %d. err: %w", d.InputOffset(), err)
+		}
 
-			cl := []models.Cpe{}
-			for _, cpe := range d.Advisory.AffectedCPEList {
-				cl = append(cl, models.Cpe{
-					Cpe: cpe,
-				})
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "generator":
+			if err := d.DecodeElement(&gen, &se); err != nil {
+				return Generator{}, nil, models.ConvertStat{}, xerrors.Errorf("Failed to decode generator at offset %d. err: %w", d.InputOffset(), err)
 			}
-
-			bs := []models.Bugzilla{}
-			for _, b := range d.Advisory.Bugzillas {
-				bs = append(bs, models.Bugzilla{
-					BugzillaID: b.ID,
-					URL:        b.URL,
-					Title:      b.Title,
-				})
+		case "definition":
+			var def Definition
+			if err := d.DecodeElement(&def, &se); err != nil {
+				return Generator{}, nil, models.ConvertStat{}, xerrors.Errorf("Failed to decode definition at offset %d. err: %w", d.InputOffset(), err)
 			}
-
-			issued := util.ParsedOrDefaultTime([]string{"2006-01-02"}, d.Advisory.Issued.Date)
-			updated := util.ParsedOrDefaultTime([]string{"2006-01-02"}, d.Advisory.Updated.Date)
-
-			def := models.Definition{
-				DefinitionID: d.ID,
-				Title:        d.Title,
-				Description:  d.Description,
-				Advisory: models.Advisory{
-					Severity:        d.Advisory.Severity,
-					Cves:            cves,
-					Bugzillas:       bs,
-					AffectedCPEList: cl,
-					Issued:          issued,
-					Updated:         updated,
-				},
-				Debian:        nil,
-				AffectedPacks: collectRedHatPacks(v, d.Criteria),
-				References:    rs,
+			m, skipped := convertDefinition(v, def, &stat)
+			if skipped != "" {
+				stat.Skip(skippedID(def), skipped)
+				continue
 			}
-
-			if viper.GetBool("no-details") {
-				def.Title = ""
-				def.Description = ""
-				def.Advisory.Severity = ""
-				def.Advisory.AffectedCPEList = []models.Cpe{}
-				def.Advisory.Bugzillas = []models.Bugzilla{}
-				def.Advisory.Issued = time.Time{}
-				def.Advisory.Updated = time.Time{}
-				def.References = []models.Reference{}
+			stat.Convert()
+			defs = append(defs, m)
+		case "tests", "objects", "states":
+			// ConvertToModel only needs the definitions, the rest is skipped without being built
+			if err := d.Skip(); err != nil {
+				return Generator{}, nil, models.ConvertStat{}, xerrors.Errorf("Failed to skip %s at offset %d. err: %w", se.Name.Local, d.InputOffset(), err)
 			}
+		}
+	}
+	return gen, defs, stat, nil
+}
 
+// MergeDefinitions merges the converted definitions, where the first one wins for the same definition ID
+func MergeDefinitions(defss ...[]models.Definition) []models.Definition {
+	defs := map[string]models.Definition{}
+	for _, ds := range defss {
+		for _, def := range ds {
 			if _, ok := defs[def.DefinitionID]; !ok {
 				defs[def.DefinitionID] = def
 			}
@@ -99,6 +98,177 @@ func ConvertToModel(v string, roots []Root) []models.Definition {
 	return maps.Values(defs)
 }
 
+// convertDefinition converts d, counting its CVE IDs normalized in stat, or returns the reason it is skipped, e.g. models.SkipRejected
+func convertDefinition(v string, d Definition, stat *models.ConvertStat) (models.Definition, string) {
+	if strings.Contains(d.Description, "** REJECT **") {
+		return models.Definition{}, models.SkipRejected
+	}
+
+	cves := []models.Cve{}
+	for _, c := range d.Advisory.Cves {
+		cves = append(cves, models.Cve{
+			CveID:  c.CveID,
+			Cvss2:  c.Cvss2,
+			Cvss3:  c.Cvss3,
+			Cwe:    c.Cwe,
+			Impact: c.Impact,
+			Href:   c.Href,
+			Public: c.Public,
+
+			PublicDate: publicDate(c.Public),
+		})
+	}
+	cves, rerouted := util.NormalizeCves(cves, stat)
+
+	rs := []models.Reference{}
+	for _, r := range d.References {
+		rs = append(rs, models.Reference{
+			Source: r.Source,
+			RefID:  r.RefID,
+			RefURL: r.RefURL,
+		})
+	}
+	rs = append(rs, rerouted...)
+
+	cl := []models.Cpe{}
+	for _, cpe := range d.Advisory.AffectedCPEList {
+		cl = append(cl, models.Cpe{
+			Cpe: cpe,
+		})
+	}
+
+	bs := []models.Bugzilla{}
+	for _, b := range d.Advisory.Bugzillas {
+		bs = append(bs, models.Bugzilla{
+			BugzillaID: b.ID,
+			URL:        b.URL,
+			Title:      b.Title,
+		})
+	}
+
+	issued := util.ParsedOrDefaultTime([]string{"2006-01-02"}, d.Advisory.Issued.Date)
+	updated := util.ParsedOrDefaultTime([]string{"2006-01-02"}, d.Advisory.Updated.Date)
+
+	state := resolutionState(d.Advisory.Affected.Resolution.State)
+	packs := collectRedHatPacks(v, d.Criteria)
+	if state != "" {
+		packs = append(packs, collectUnfixedPacks(d.Advisory.Affected.Resolution.Component)...)
+	}
+
+	refs := util.NormalizeReferences(rs)
+	id := advisoryID(d.Title)
+	def := models.Definition{
+		DefinitionID: util.DefinitionID(d.ID, d.Title, stat),
+		Class:        strings.TrimSpace(d.Class),
+		Title:        strings.TrimSpace(d.Title),
+		Description:  strings.TrimSpace(d.Description),
+		Severity:     util.NormalizeSeverity(d.Severity),
+		Advisory: models.Advisory{
+			AdvisoryID:      id,
+			AdvisoryURL:     util.AdvisoryURL(id, refs, errataURL),
+			Class:           advisoryClass(d.ID),
+			Severity:        util.NormalizeSeverity(d.Advisory.Severity),
+			Cves:            cves,
+			Bugzillas:       bs,
+			AffectedCPEList: cl,
+			Issued:          issued,
+			Updated:         updated,
+			State:           state,
+		},
+		Debian:        nil,
+		AffectedPacks: packs,
+		References:    refs,
+	}
+
+	return def, ""
+}
+
+// skippedID returns the ID of the skipped definition d in models.ConvertStat, or its title without ID
+func skippedID(d Definition) string {
+	if d.ID != "" {
+		return d.ID
+	}
+	return strings.TrimSpace(d.Title)
+}
+
+// publicDateLayouts are the layouts of the public date of the CVEs, e.g. 20230216 of the most files and 2023-02-16T00:00:00 of the others
+var publicDateLayouts = []string{"20060102", "2006-01-02", "2006-01-02T15:04:05", time.RFC3339}
+
+// publicDate parses the public date of the CVE, nil if missing, or unparsable not to fail the conversion
+func publicDate(public string) *time.Time {
+	public = strings.TrimSpace(public)
+	if public == "" {
+		return nil
+	}
+	for _, layout := range publicDateLayouts {
+		if t, err := time.Parse(layout, public); err == nil {
+			return &t
+		}
+	}
+	log15.Warn("Failed to parse the public date of CVE", "public", public)
+	return nil
+}
+
+// advisoryID extracts the advisory ID from the title, e.g. "RHSA-2017:0933: kernel security update (Important)" -> "RHSA-2017:0933"
+func advisoryID(title string) string {
+	id, _, found := strings.Cut(strings.TrimSpace(title), ": ")
+	if !found {
+		return ""
+	}
+	for _, prefix := range []string{"RHSA-", "RHBA-", "RHEA-"} {
+		if strings.HasPrefix(id, prefix) {
+			return id
+		}
+	}
+	return ""
+}
+
+// errataURL returns the URL of the errata of the advisory id, e.g. https://access.redhat.com/errata/RHSA-2017:0933
+func errataURL(id string) string {
+	return "https://access.redhat.com/errata/" + id
+}
+
+// advisoryClass returns the class of advisory from the definition ID, e.g. oval:com.redhat.rhba:def:20191234 -> bugfix
+func advisoryClass(defID string) string {
+	switch {
+	case strings.HasPrefix(defID, "oval:com.redhat.rhsa:"):
+		return "security"
+	case strings.HasPrefix(defID, "oval:com.redhat.rhba:"):
+		return "bugfix"
+	case strings.HasPrefix(defID, "oval:com.redhat.rhea:"):
+		return "enhancement"
+	default:
+		return ""
+	}
+}
+
+// resolutionState normalizes the resolution state of unpatched definitions, e.g. "will not fix" -> "Will not fix"
+func resolutionState(s string) string {
+	s = strings.TrimSpace(s)
+	for _, state := range []string{models.StateAffected, models.StateFixDeferred, models.StateWillNotFix, models.StateOutOfSupportScope, models.StateUnderInvestigation} {
+		if strings.EqualFold(s, state) {
+			return state
+		}
+	}
+	return s
+}
+
+// collectUnfixedPacks returns the packages listed in the resolution of unpatched definitions, which have no fixed version
+func collectUnfixedPacks(components []string) []models.Package {
+	pkgs := map[string]models.Package{}
+	for _, c := range components {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		pkgs[c] = models.Package{
+			Name:        c,
+			NotFixedYet: true,
+		}
+	}
+	return maps.Values(pkgs)
+}
+
 func collectRedHatPacks(v string, cri Criteria) []models.Package {
 	ps := walkRedHat(cri, []models.Package{}, "")
 	pkgs := map[string]models.Package{}
@@ -138,9 +308,11 @@ func walkRedHat(cri Criteria, acc []models.Package, label string) []models.Packa
 		if len(ss) != 2 {
 			continue
 		}
+		version, raw := util.NormalizedVersion(strings.Split(ss[1], " ")[0], util.NormalizeEVR)
 		acc = append(acc, models.Package{
 			Name:            ss[0],
-			Version:         strings.Split(ss[1], " ")[0],
+			Version:         version,
+			RawVersion:      raw,
 			ModularityLabel: label,
 		})
 	}
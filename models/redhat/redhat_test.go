@@ -1,9 +1,14 @@
 package redhat
 
 import (
+	"encoding/xml"
+	"fmt"
+	"io"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/k0kubun/pp"
 
@@ -253,6 +258,21 @@ func TestWalkRedHat(t *testing.T) {
 				},
 			},
 		},
+		{
+			version: "7",
+			cri: Criteria{
+				Criterions: []Criterion{
+					{Comment: "glibc is earlier than 2.17-157.el7"},
+				},
+			},
+			expected: []models.Package{
+				{
+					Name:       "glibc",
+					Version:    "0:2.17-157.el7",
+					RawVersion: "2.17-157.el7",
+				},
+			},
+		},
 	}
 
 	for i, tt := range tests {
@@ -277,3 +297,275 @@ func TestWalkRedHat(t *testing.T) {
 		}
 	}
 }
+
+func TestConvertToModel(t *testing.T) {
+	var tests = []struct {
+		in       string
+		expected []models.Definition
+	}{
+		{
+			in: `<oval_definitions>
+  <definitions>
+    <definition class="patch" id="oval:com.redhat.rhsa:def:20170933" version="637">
+      <metadata>
+        <title>
+          RHSA-2017:0933: kernel security update (Important)
+        </title>
+        <description>
+The kernel packages contain the Linux kernel.
+        </description>
+        <reference ref_id="RHSA-2017:0933" ref_url="https://rhn.redhat.com/errata/RHSA-2017-0933.html" source="RHSA"/>
+        <reference ref_id="CVE-2016-8650" ref_url="https://access.redhat.com/security/cve/CVE-2016-8650" source="CVE"/>
+        <advisory from="secalert@redhat.com">
+          <severity>Important</severity>
+          <issued date="2017-04-12"/>
+          <updated date="2017-04-12"/>
+        </advisory>
+      </metadata>
+    </definition>
+  </definitions>
+</oval_definitions>`,
+			expected: []models.Definition{
+				{
+					DefinitionID: "oval:com.redhat.rhsa:def:20170933",
+					Title:        "RHSA-2017:0933: kernel security update (Important)",
+					Description:  "The kernel packages contain the Linux kernel.",
+					Advisory: models.Advisory{
+						AdvisoryID: "RHSA-2017:0933",
+						// the reference of the advisory wins over errataURL
+						AdvisoryURL: "https://rhn.redhat.com/errata/RHSA-2017-0933.html",
+						Class:       "security",
+						Severity:    "Important",
+					},
+				},
+			},
+		},
+		{
+			in: `<oval_definitions>
+  <definitions>
+    <definition class="patch" id="oval:com.redhat.rhba:def:20191992" version="635">
+      <metadata>
+        <title>RHBA-2019:1992: cloud-init bug fix and enhancement update (Moderate)</title>
+        <description>The cloud-init packages provide a set of init scripts for cloud instances.</description>
+        <severity>important</severity>
+        <advisory from="secalert@redhat.com">
+          <severity>Moderate</severity>
+          <cve>CVE-2019-0816</cve>
+        </advisory>
+      </metadata>
+    </definition>
+    <definition class="patch" id="oval:com.redhat.rhea:def:20191236" version="635">
+      <metadata>
+        <title>RHEA-2019:1236: new module: container-tools (Moderate)</title>
+        <description>The container-tools module contains stable versions of podman, buildah, skopeo, runc, conmon, CRIU, Udica, etc.</description>
+      </metadata>
+    </definition>
+  </definitions>
+</oval_definitions>`,
+			expected: []models.Definition{
+				{
+					DefinitionID: "oval:com.redhat.rhba:def:20191992",
+					Title:        "RHBA-2019:1992: cloud-init bug fix and enhancement update (Moderate)",
+					Description:  "The cloud-init packages provide a set of init scripts for cloud instances.",
+					Severity:     "Important",
+					Advisory: models.Advisory{
+						AdvisoryID:  "RHBA-2019:1992",
+						AdvisoryURL: "https://access.redhat.com/errata/RHBA-2019:1992",
+						Class:       "bugfix",
+						Severity:    "Moderate",
+					},
+				},
+				{
+					DefinitionID: "oval:com.redhat.rhea:def:20191236",
+					Title:        "RHEA-2019:1236: new module: container-tools (Moderate)",
+					Description:  "The container-tools module contains stable versions of podman, buildah, skopeo, runc, conmon, CRIU, Udica, etc.",
+					Advisory: models.Advisory{
+						AdvisoryID:  "RHEA-2019:1236",
+						AdvisoryURL: "https://access.redhat.com/errata/RHEA-2019:1236",
+						Class:       "enhancement",
+					},
+				},
+			},
+		},
+		{
+			in: `<oval_definitions>
+  <definitions>
+    <definition class="vulnerability" id="oval:com.redhat.cve:def:20163695" version="636">
+      <metadata>
+        <title>CVE-2016-3695 kernel: Mishandling of the einj_error_inject in the APEI (low)</title>
+        <description>The einj_error_inject function in drivers/acpi/apei/einj.c in the Linux kernel allows local users to simulate hardware errors.</description>
+        <advisory from="secalert@redhat.com">
+          <severity>Low</severity>
+          <cve>CVE-2016-3695</cve>
+          <affected>
+            <resolution state="Will not fix">
+              <component>kernel</component>
+              <component>kernel-rt</component>
+            </resolution>
+          </affected>
+        </advisory>
+        <criteria operator="OR">
+          <criterion comment="kernel is installed" test_ref="oval:com.redhat.cve:tst:20163695001"/>
+          <criterion comment="kernel-rt is installed" test_ref="oval:com.redhat.cve:tst:20163695003"/>
+        </criteria>
+      </metadata>
+    </definition>
+  </definitions>
+</oval_definitions>`,
+			expected: []models.Definition{
+				{
+					DefinitionID: "oval:com.redhat.cve:def:20163695",
+					Title:        "CVE-2016-3695 kernel: Mishandling of the einj_error_inject in the APEI (low)",
+					Description:  "The einj_error_inject function in drivers/acpi/apei/einj.c in the Linux kernel allows local users to simulate hardware errors.",
+					Advisory: models.Advisory{
+						Severity: "Low",
+						State:    models.StateWillNotFix,
+					},
+					AffectedPacks: []models.Package{
+						{Name: "kernel", NotFixedYet: true},
+						{Name: "kernel-rt", NotFixedYet: true},
+					},
+				},
+			},
+		},
+		{
+			in: `<oval_definitions>
+  <definitions>
+    <definition class="patch" version="637">
+      <metadata>
+        <title>RHSA-2017:0933: kernel security update (Important)</title>
+      </metadata>
+    </definition>
+  </definitions>
+</oval_definitions>`,
+			// converted by the ID derived of the title, rather than lost
+			expected: []models.Definition{
+				{
+					DefinitionID: "no-id:RHSA-2017:0933: kernel security update (Important)",
+					Title:        "RHSA-2017:0933: kernel security update (Important)",
+					Advisory: models.Advisory{
+						AdvisoryID:  "RHSA-2017:0933",
+						AdvisoryURL: "https://access.redhat.com/errata/RHSA-2017:0933",
+					},
+				},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		var root Root
+		if err := xml.Unmarshal([]byte(tt.in), &root); err != nil {
+			t.Fatalf("[%d]: failed to unmarshal. err: %s", i, err)
+		}
+		defs, _ := ConvertToModel("7", []Root{root})
+		_, decoded, _, err := Decode("7", strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatalf("[%d]: failed to decode. err: %s", i, err)
+		}
+		if len(decoded) != len(defs) {
+			t.Errorf("[%d]: expected: %d decoded definitions, actual: %d", i, len(defs), len(decoded))
+		}
+		if len(defs) != len(tt.expected) {
+			t.Fatalf("[%d]: expected: %d definitions, actual: %d", i, len(tt.expected), len(defs))
+		}
+		sort.Slice(defs, func(i, j int) bool { return defs[i].DefinitionID < defs[j].DefinitionID })
+		for j, d := range defs {
+			e := tt.expected[j]
+			if d.DefinitionID != e.DefinitionID || d.Title != e.Title || d.Description != e.Description || d.Advisory.AdvisoryID != e.Advisory.AdvisoryID || d.Advisory.Class != e.Advisory.Class {
+				t.Errorf("[%d]: expected: %q %q %q %q %q\n, actual: %q %q %q %q %q\n", i, e.DefinitionID, e.Title, e.Description, e.Advisory.AdvisoryID, e.Advisory.Class, d.DefinitionID, d.Title, d.Description, d.Advisory.AdvisoryID, d.Advisory.Class)
+			}
+			// the severities of the definition and the advisory are apart, neither copied to the other
+			if d.Severity != e.Severity || d.Advisory.Severity != e.Advisory.Severity {
+				t.Errorf("[%d]: expected severities: %q %q, actual: %q %q", i, e.Severity, e.Advisory.Severity, d.Severity, d.Advisory.Severity)
+			}
+			if d.Advisory.AdvisoryURL != e.Advisory.AdvisoryURL {
+				t.Errorf("[%d]: expected advisory URL: %q, actual: %q", i, e.Advisory.AdvisoryURL, d.Advisory.AdvisoryURL)
+			}
+			if d.Advisory.State != e.Advisory.State {
+				t.Errorf("[%d]: expected state: %q, actual: %q", i, e.Advisory.State, d.Advisory.State)
+			}
+			if e.AffectedPacks != nil {
+				sort.Slice(d.AffectedPacks, func(i, j int) bool { return d.AffectedPacks[i].Name < d.AffectedPacks[j].Name })
+				if !reflect.DeepEqual(d.AffectedPacks, e.AffectedPacks) {
+					t.Errorf("[%d]: expected packs: %v, actual: %v", i, e.AffectedPacks, d.AffectedPacks)
+				}
+			}
+		}
+	}
+}
+
+func TestConvertToModelSeverity(t *testing.T) {
+	tests := []struct {
+		severity, advisorySeverity string
+		expected, advisoryExpected string
+	}{
+		{severity: "Important", advisorySeverity: "Important", expected: "Important", advisoryExpected: "Important"},
+		{severity: "IMPORTANT", advisorySeverity: "moderate", expected: "Important", advisoryExpected: "Moderate"},
+		{severity: " low ", advisorySeverity: "CRITICAL", expected: "Low", advisoryExpected: "Critical"},
+		{severity: "None", advisorySeverity: "n/a", expected: "None", advisoryExpected: "N/A"},
+		// unknown ones are kept as they are, and the missing ones stay empty
+		{severity: "Unknown-Vendor", advisorySeverity: "", expected: "Unknown-Vendor", advisoryExpected: ""},
+	}
+	for i, tt := range tests {
+		d := Definition{ID: "oval:com.redhat.rhsa:def:20170933", Class: "patch", Title: "RHSA-2017:0933: kernel security update", Severity: tt.severity}
+		d.Advisory.Severity = tt.advisorySeverity
+		defs, _ := ConvertToModel("7", []Root{{Definitions: Definitions{Definitions: []Definition{d}}}})
+		if len(defs) != 1 {
+			t.Fatalf("[%d]: expected: 1 definition, actual: %d", i, len(defs))
+		}
+		if defs[0].Severity != tt.expected || defs[0].Advisory.Severity != tt.advisoryExpected {
+			t.Errorf("[%d]: expected severities: %q %q, actual: %q %q", i, tt.expected, tt.advisoryExpected, defs[0].Severity, defs[0].Advisory.Severity)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	const n = 10000
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = io.WriteString(pw, `<oval_definitions><generator><timestamp>2023-07-06T04:00:10</timestamp></generator><definitions>`)
+		for i := 0; i < n; i++ {
+			_, _ = fmt.Fprintf(pw, `<definition class="patch" id="oval:com.redhat.rhsa:def:%d"><metadata><title>RHSA-2017:%04d: kernel security update (Important)</title></metadata></definition>`, i, i)
+		}
+		_, _ = io.WriteString(pw, `</definitions><tests><rpminfo_test id="oval:com.redhat.rhsa:tst:1"/></tests></oval_definitions>`)
+		_ = pw.Close()
+	}()
+
+	gen, defs, _, err := Decode("7", pr)
+	if err != nil {
+		t.Fatalf("failed to decode. err: %s", err)
+	}
+	if gen.Timestamp != "2023-07-06T04:00:10" || len(defs) != n {
+		t.Errorf("expected: %d definitions at 2023-07-06T04:00:10, actual: %d definitions at %s", n, len(defs), gen.Timestamp)
+	}
+
+	// the offset points right after the mismatched end element
+	malformed := `<oval_definitions><definitions><definition id="oval:com.redhat.rhsa:def:1"></definition><definition id="oval:com.redhat.rhsa:def:2"></defin></definitions></oval_definitions>`
+	if _, _, _, err := Decode("7", strings.NewReader(malformed)); err == nil || !strings.Contains(err.Error(), "at offset 140") {
+		t.Errorf("expected: the error at offset 140, actual: %v", err)
+	}
+}
+
+func TestPublicDate(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{in: "20230216", expected: "2023-02-16T00:00:00Z"},
+		{in: "2023-02-16", expected: "2023-02-16T00:00:00Z"},
+		{in: "2023-02-16T12:30:00", expected: "2023-02-16T12:30:00Z"},
+		{in: "2023-02-16T12:30:00+09:00", expected: "2023-02-16T03:30:00Z"},
+		{in: " 20230216 ", expected: "2023-02-16T00:00:00Z"},
+		{in: ""},
+		{in: "unknown"},
+	}
+	for _, tt := range tests {
+		got := publicDate(tt.in)
+		switch {
+		case tt.expected == "" && got != nil:
+			t.Errorf("%q: expected: nil, actual: %s", tt.in, got)
+		case tt.expected != "" && (got == nil || got.UTC().Format(time.RFC3339) != tt.expected):
+			t.Errorf("%q: expected: %s, actual: %v", tt.in, tt.expected, got)
+		}
+	}
+}
@@ -2,16 +2,18 @@ package suse
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/go-version"
 	"github.com/inconshreveable/log15"
-	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
 	"golang.org/x/xerrors"
 
 	"github.com/vulsio/goval-dictionary/models"
+	"github.com/vulsio/goval-dictionary/models/util"
 )
 
 type distroPackage struct {
@@ -19,13 +21,14 @@ type distroPackage struct {
 	pack  models.Package
 }
 
-// ConvertToModel Convert OVAL to models
-func ConvertToModel(xmlName string, root *Root) (map[string][]models.Definition, error) {
+// ConvertToModel Convert OVAL to models, with the stat of the definitions of all the releases
+func ConvertToModel(xmlName string, root *Root) (map[string][]models.Definition, models.ConvertStat, error) {
 	tests, err := parseTests(*root)
 	if err != nil {
-		return nil, xerrors.Errorf("Failed to parse oval.Tests. err: %w", err)
+		return nil, models.ConvertStat{}, xerrors.Errorf("Failed to parse oval.Tests. err: %w", err)
 	}
-	return parseDefinitions(xmlName, root.Definitions, tests), nil
+	defs, stat := parseDefinitions(xmlName, root.Definitions, tests)
+	return defs, stat, nil
 }
 
 type rpmInfoTest struct {
@@ -103,14 +106,18 @@ func followTestRefs(test RpminfoTest, objects map[string]string, states map[stri
 	return t, nil
 }
 
-func parseDefinitions(xmlName string, ovalDefs Definitions, tests map[string]rpmInfoTest) map[string][]models.Definition {
+func parseDefinitions(xmlName string, ovalDefs Definitions, tests map[string]rpmInfoTest) (map[string][]models.Definition, models.ConvertStat) {
 	defs := map[string][]models.Definition{}
+	var stat models.ConvertStat
 
 	for _, d := range ovalDefs.Definitions {
 		if strings.Contains(d.Description, "** REJECT **") {
+			stat.Skip(d.ID, models.SkipRejected)
 			continue
 		}
 
+		defID := util.DefinitionID(d.ID, d.Title, &stat)
+
 		cves := []models.Cve{}
 		if strings.Contains(xmlName, "opensuse.1") || strings.Contains(xmlName, "suse.linux.enterprise.desktop.10") || strings.Contains(xmlName, "suse.linux.enterprise.server.9") || strings.Contains(xmlName, "suse.linux.enterprise.server.10") {
 			if strings.HasPrefix(d.Title, "CVE-") {
@@ -130,6 +137,8 @@ func parseDefinitions(xmlName string, ovalDefs Definitions, tests map[string]rpm
 			}
 		}
 
+		cves, rerouted := util.NormalizeCves(cves, &stat)
+
 		references := []models.Reference{}
 		for _, r := range d.References {
 			references = append(references, models.Reference{
@@ -138,6 +147,11 @@ func parseDefinitions(xmlName string, ovalDefs Definitions, tests map[string]rpm
 				RefURL: r.RefURL,
 			})
 		}
+		references = append(references, rerouted...)
+
+		refs := util.NormalizeReferences(references)
+		id := advisoryID(refs)
+		advisoryURL := util.AdvisoryURL(id, refs, nil)
 
 		cpes := []models.Cpe{}
 		for _, cpe := range d.Advisory.AffectedCPEList {
@@ -154,45 +168,82 @@ func parseDefinitions(xmlName string, ovalDefs Definitions, tests map[string]rpm
 			})
 		}
 
+		// e.g. 2021-03-18, 2021-03-18 12:34:56, 2021-03-18T12:34:56Z
+		issued := util.ParsedOrDefaultTime([]string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339}, d.Advisory.Issued.Date)
+		updated := util.ParsedOrDefaultTime([]string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339}, d.Advisory.Updated.Date)
+
 		osVerPackages := map[string][]models.Package{}
 		for _, distPack := range collectSUSEPacks(xmlName, d.Criteria, tests) {
 			osVerPackages[distPack.osVer] = append(osVerPackages[distPack.osVer], distPack.pack)
 		}
+		if len(osVerPackages) == 0 {
+			stat.Skip(d.ID, models.SkipNoRelease)
+			continue
+		}
+		stat.Convert()
 
 		for osVer, packs := range osVerPackages {
 			def := models.Definition{
-				DefinitionID: d.ID,
-				Title:        d.Title,
-				Description:  d.Description,
+				DefinitionID: defID,
+				Class:        strings.TrimSpace(d.Class),
+				Title:        strings.TrimSpace(d.Title),
+				Description:  strings.TrimSpace(d.Description),
+				Severity:     util.NormalizeSeverity(d.Severity),
 				Advisory: models.Advisory{
-					Severity:        d.Advisory.Severity,
-					Cves:            append([]models.Cve{}, cves...),           // If the same slice is used, it will only be stored once in the DB
-					Bugzillas:       append([]models.Bugzilla{}, bugzillas...), // If the same slice is used, it will only be stored once in the DB
-					AffectedCPEList: append([]models.Cpe{}, cpes...),           // If the same slice is used, it will only be stored once in the DB
-					Issued:          time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC),
-					Updated:         time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC),
+					AdvisoryID:       id,
+					AdvisoryURL:      advisoryURL,
+					Severity:         util.NormalizeSeverity(d.Advisory.Severity),
+					Cves:             append([]models.Cve{}, cves...),           // If the same slice is used, it will only be stored once in the DB
+					Bugzillas:        append([]models.Bugzilla{}, bugzillas...), // If the same slice is used, it will only be stored once in the DB
+					AffectedCPEList:  append([]models.Cpe{}, cpes...),           // If the same slice is used, it will only be stored once in the DB
+					Issued:           issued,
+					Updated:          updated,
+					RebootRequired:   rebootRequired(d.Advisory.RebootSuggested),
+					RestartSuggested: restartSuggested(d.Advisory.RestartSuggested),
 				},
 				Debian:        nil,
 				AffectedPacks: packs,
-				References:    append([]models.Reference{}, references...), // If the same slice is used, it will only be stored once in the DB
-			}
-
-			if viper.GetBool("no-details") {
-				def.Title = ""
-				def.Description = ""
-				def.Advisory.Severity = ""
-				def.Advisory.AffectedCPEList = []models.Cpe{}
-				def.Advisory.Bugzillas = []models.Bugzilla{}
-				def.Advisory.Issued = time.Time{}
-				def.Advisory.Updated = time.Time{}
-				def.References = []models.Reference{}
+				References:    append([]models.Reference{}, refs...), // If the same slice is used, it will only be stored once in the DB
 			}
 
 			defs[osVer] = append(defs[osVer], def)
 		}
 	}
 
-	return defs
+	return defs, stat
+}
+
+// rebootRequired returns whether the patch requires a reboot by its reboot_suggested, e.g. true or True, false if none
+func rebootRequired(s string) bool {
+	b, _ := strconv.ParseBool(strings.TrimSpace(s))
+	return b
+}
+
+// restartSuggested returns the restart suggested by the patch by its restart_suggested, true or the services to restart as they are,
+// or empty if false or none
+func restartSuggested(s string) string {
+	s = strings.TrimSpace(s)
+	if b, err := strconv.ParseBool(s); err == nil {
+		if !b {
+			return ""
+		}
+		return "true"
+	}
+	return s
+}
+
+// advisorySource matches the source of the reference of the advisory of SUSE, e.g. SUSE-SU, SUSE-RU and openSUSE-SU
+var advisorySource = regexp.MustCompile(`(?i)^(open)?suse-[a-z]{2}$`)
+
+// advisoryID returns the ID of the advisory of SUSE from refs, e.g. SUSE-SU-2021:0857-1, which has no URL template,
+// e.g. of the announcement of lists.suse.com numbered by the mailing list, or empty if none, e.g. of the CVE
+func advisoryID(refs []models.Reference) string {
+	for _, r := range refs {
+		if advisorySource.MatchString(r.Source) {
+			return r.RefID
+		}
+	}
+	return ""
 }
 
 func collectSUSEPacks(xmlName string, cri Criteria, tests map[string]rpmInfoTest) []distroPackage {
@@ -208,61 +259,140 @@ func collectSUSEPacks(xmlName string, cri Criteria, tests map[string]rpmInfoTest
 		}
 		return verPkgs
 	}
-	return walkCriteria(cri, []distroPackage{}, tests)
-}
 
-func walkCriteria(cri Criteria, acc []distroPackage, tests map[string]rpmInfoTest) []distroPackage {
-	if cri.Operator == "AND" {
-		vs, pkgs := walkCriterion(cri, []string{}, []models.Package{}, tests)
-		for _, v := range vs {
-			for _, pkg := range pkgs {
-				acc = append(acc, distroPackage{
+	verPkgs := []distroPackage{}
+	for _, b := range walkCriteria(cri, tests) {
+		for _, v := range b.versions {
+			for _, pkg := range b.packages {
+				verPkgs = append(verPkgs, distroPackage{
 					osVer: v,
 					pack:  pkg,
 				})
 			}
 		}
-		return acc
-	}
-	for _, criteria := range cri.Criterias {
-		acc = walkCriteria(criteria, acc, tests)
 	}
-	return acc
+	return verPkgs
 }
 
-func walkCriterion(cri Criteria, versions []string, packages []models.Package, tests map[string]rpmInfoTest) ([]string, []models.Package) {
+// criteriaBranch is one of the alternatives that satisfies the criteria: all packages are affected on any of versions
+type criteriaBranch struct {
+	versions []string
+	packages []models.Package
+}
+
+// walkCriteria expands the criteria tree into the alternatives, e.g.
+// release-A AND (pkg-a OR pkg-b) -> [{A: pkg-a, pkg-b}]
+// (release-A AND pkg-a) OR (release-B AND pkg-b) -> [{A: pkg-a}, {B: pkg-b}]
+func walkCriteria(cri Criteria, tests map[string]rpmInfoTest) []criteriaBranch {
+	children := [][]criteriaBranch{}
 	for _, c := range cri.Criterions {
-		if isOSComment(c.Comment) {
-			comment := strings.TrimSuffix(c.Comment, " is installed")
-			v, err := getOSVersion(comment)
-			if err != nil {
-				log15.Warn("Failed to getOSVersion", "comment", comment, "err", err)
-				continue
+		v, pkg, ok := parseCriterion(c, tests)
+		if !ok {
+			continue
+		}
+		b := criteriaBranch{}
+		if v != "" {
+			b.versions = []string{v}
+		}
+		if pkg != nil {
+			b.packages = []models.Package{*pkg}
+		}
+		children = append(children, []criteriaBranch{b})
+	}
+	for _, c := range cri.Criterias {
+		if bs := walkCriteria(c, tests); len(bs) > 0 {
+			children = append(children, bs)
+		}
+	}
+
+	if cri.Operator == "OR" {
+		return mergeOrBranches(children)
+	}
+	return mergeAndBranches(children)
+}
+
+// mergeOrBranches merges the alternatives having the same versions, so that the number of branches does not explode
+func mergeOrBranches(children [][]criteriaBranch) []criteriaBranch {
+	merged := []criteriaBranch{}
+	index := map[string]int{}
+	for _, bs := range children {
+		for _, b := range bs {
+			key := strings.Join(b.versions, "\x00")
+			if len(b.packages) == 0 {
+				// alternatives of versions only, e.g. release-A OR release-B
+				key = "\x00versions"
 			}
-			if v != "" {
-				versions = append(versions, v)
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(merged)
+				merged = append(merged, criteriaBranch{})
+				i = len(merged) - 1
+			}
+			if len(b.packages) == 0 {
+				merged[i].versions = append(merged[i].versions, b.versions...)
+			} else {
+				if !ok {
+					merged[i].versions = append([]string{}, b.versions...)
+				}
+				merged[i].packages = append(merged[i].packages, b.packages...)
 			}
-			continue
 		}
+	}
+	return merged
+}
 
-		if strings.HasSuffix(c.Comment, "is not affected") {
-			continue
+// mergeAndBranches combines every alternative of each child, since all of them must be satisfied
+func mergeAndBranches(children [][]criteriaBranch) []criteriaBranch {
+	if len(children) == 0 {
+		return nil
+	}
+
+	acc := []criteriaBranch{{}}
+	for _, bs := range children {
+		next := make([]criteriaBranch, 0, len(acc)*len(bs))
+		for _, a := range acc {
+			for _, b := range bs {
+				vs := append(append([]string{}, a.versions...), b.versions...)
+				if len(a.versions) > 0 && len(b.versions) > 0 {
+					// both releases must be installed, e.g. (release-A OR release-B) AND release-B -> release-B
+					vs = intersect(a.versions, b.versions)
+					if len(vs) == 0 {
+						continue
+					}
+				}
+				next = append(next, criteriaBranch{
+					versions: vs,
+					packages: append(append([]models.Package{}, a.packages...), b.packages...),
+				})
+			}
 		}
+		acc = next
+	}
+	return acc
+}
 
-		t, ok := tests[c.TestRef]
-		if !ok {
-			continue
+func intersect(xs, ys []string) []string {
+	vs := []string{}
+	for _, x := range xs {
+		if slices.Contains(ys, x) && !slices.Contains(vs, x) {
+			vs = append(vs, x)
 		}
+	}
+	return vs
+}
 
-		// Skip red-def:signature_keyid
-		if t.SignatureKeyID.Text != "" {
+func walkCriterion(cri Criteria, versions []string, packages []models.Package, tests map[string]rpmInfoTest) ([]string, []models.Package) {
+	for _, c := range cri.Criterions {
+		v, pkg, ok := parseCriterion(c, tests)
+		if !ok {
 			continue
 		}
-
-		packages = append(packages, models.Package{
-			Name:    t.Name,
-			Version: t.FixedVersion,
-		})
+		if v != "" {
+			versions = append(versions, v)
+		}
+		if pkg != nil {
+			packages = append(packages, *pkg)
+		}
 	}
 
 	if len(cri.Criterias) == 0 {
@@ -274,6 +404,40 @@ func walkCriterion(cri Criteria, versions []string, packages []models.Package, t
 	return versions, packages
 }
 
+// parseCriterion returns the OS version or the affected package of the criterion. ok is false if the criterion is not used.
+func parseCriterion(c Criterion, tests map[string]rpmInfoTest) (string, *models.Package, bool) {
+	if isOSComment(c.Comment) {
+		comment := strings.TrimSuffix(c.Comment, " is installed")
+		v, err := getOSVersion(comment)
+		if err != nil {
+			log15.Warn("Failed to getOSVersion", "comment", comment, "err", err)
+			return "", nil, false
+		}
+		return v, nil, true
+	}
+
+	if strings.HasSuffix(c.Comment, "is not affected") {
+		return "", nil, false
+	}
+
+	t, ok := tests[c.TestRef]
+	if !ok {
+		return "", nil, false
+	}
+
+	// Skip red-def:signature_keyid
+	if t.SignatureKeyID.Text != "" {
+		return "", nil, false
+	}
+
+	version, raw := util.NormalizedVersion(t.FixedVersion, util.NormalizeEVR)
+	return "", &models.Package{
+		Name:       t.Name,
+		Version:    version,
+		RawVersion: raw,
+	}, true
+}
+
 func isOSComment(comment string) bool {
 	if !strings.HasSuffix(comment, "is installed") {
 		return false
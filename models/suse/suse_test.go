@@ -1,11 +1,19 @@
 package suse
 
 import (
+	"context"
+	"encoding/xml"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/k0kubun/pp"
+	"github.com/spf13/viper"
 
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
 	"github.com/vulsio/goval-dictionary/models"
 )
 
@@ -380,6 +388,191 @@ func TestWalkSUSE(t *testing.T) {
 			},
 			expected: []distroPackage{},
 		},
+		{
+			cri: Criteria{
+				Operator: "OR",
+				Criterias: []Criteria{
+					{
+						Operator: "AND",
+						Criterions: []Criterion{
+							{
+								Comment: "SUSE Linux Enterprise Server 12 SP5 is installed",
+							},
+						},
+						Criterias: []Criteria{
+							{
+								Operator: "OR",
+								Criterions: []Criterion{
+									{
+										TestRef: "oval:org.opensuse.security:tst:99999999999",
+										Comment: "kernel-default-4.12.14-122.37.1 is installed",
+									},
+									{
+										TestRef: "oval:org.opensuse.security:tst:99999999998",
+										Comment: "kernel-source-4.12.14-122.37.1 is installed",
+									},
+								},
+							},
+						},
+					},
+					{
+						Operator: "AND",
+						Criterions: []Criterion{
+							{
+								Comment: "SUSE Linux Enterprise Server 15 SP2 is installed",
+							},
+						},
+						Criterias: []Criteria{
+							{
+								Operator: "OR",
+								Criterions: []Criterion{
+									{
+										TestRef: "oval:org.opensuse.security:tst:99999999997",
+										Comment: "kernel-default-5.3.18-24.9.1 is installed",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			tests: map[string]rpmInfoTest{
+				"oval:org.opensuse.security:tst:99999999999": {
+					Name:         "kernel-default",
+					FixedVersion: "0:4.12.14-122.37.1",
+				},
+				"oval:org.opensuse.security:tst:99999999998": {
+					Name:         "kernel-source",
+					FixedVersion: "0:4.12.14-122.37.1",
+				},
+				"oval:org.opensuse.security:tst:99999999997": {
+					Name:         "kernel-default",
+					FixedVersion: "0:5.3.18-24.9.1",
+				},
+			},
+			expected: []distroPackage{
+				{
+					osVer: "12.5",
+					pack: models.Package{
+						Name:    "kernel-default",
+						Version: "0:4.12.14-122.37.1",
+					},
+				},
+				{
+					osVer: "12.5",
+					pack: models.Package{
+						Name:    "kernel-source",
+						Version: "0:4.12.14-122.37.1",
+					},
+				},
+				{
+					osVer: "15.2",
+					pack: models.Package{
+						Name:    "kernel-default",
+						Version: "0:5.3.18-24.9.1",
+					},
+				},
+			},
+		},
+		{
+			cri: Criteria{
+				Operator: "AND",
+				Criterias: []Criteria{
+					{
+						Operator: "OR",
+						Criterions: []Criterion{
+							{
+								Comment: "SUSE Linux Enterprise Server 12 SP4 is installed",
+							},
+							{
+								Comment: "SUSE Linux Enterprise Server 12 SP5 is installed",
+							},
+						},
+					},
+					{
+						Operator: "OR",
+						Criterias: []Criteria{
+							{
+								Operator: "AND",
+								Criterions: []Criterion{
+									{
+										Comment: "SUSE Linux Enterprise Server 12 SP5 is installed",
+									},
+									{
+										TestRef: "oval:org.opensuse.security:tst:99999999999",
+										Comment: "libopenssl1_0_0-1.0.2p-3.22.1 is installed",
+									},
+								},
+							},
+							{
+								Operator: "AND",
+								Criterions: []Criterion{
+									{
+										TestRef: "oval:org.opensuse.security:tst:99999999998",
+										Comment: "openssl-1_0_0-1.0.2p-3.22.1 is installed",
+									},
+									{
+										TestRef: "oval:org.opensuse.security:tst:99999999997",
+										Comment: "openssl-1_0_0-doc-1.0.2p-3.22.1 is installed",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			tests: map[string]rpmInfoTest{
+				"oval:org.opensuse.security:tst:99999999999": {
+					Name:         "libopenssl1_0_0",
+					FixedVersion: "0:1.0.2p-3.22.1",
+				},
+				"oval:org.opensuse.security:tst:99999999998": {
+					Name:         "openssl-1_0_0",
+					FixedVersion: "0:1.0.2p-3.22.1",
+				},
+				"oval:org.opensuse.security:tst:99999999997": {
+					Name:         "openssl-1_0_0-doc",
+					FixedVersion: "0:1.0.2p-3.22.1",
+				},
+			},
+			expected: []distroPackage{
+				{
+					osVer: "12.5",
+					pack: models.Package{
+						Name:    "libopenssl1_0_0",
+						Version: "0:1.0.2p-3.22.1",
+					},
+				},
+				{
+					osVer: "12.4",
+					pack: models.Package{
+						Name:    "openssl-1_0_0",
+						Version: "0:1.0.2p-3.22.1",
+					},
+				},
+				{
+					osVer: "12.4",
+					pack: models.Package{
+						Name:    "openssl-1_0_0-doc",
+						Version: "0:1.0.2p-3.22.1",
+					},
+				},
+				{
+					osVer: "12.5",
+					pack: models.Package{
+						Name:    "openssl-1_0_0",
+						Version: "0:1.0.2p-3.22.1",
+					},
+				},
+				{
+					osVer: "12.5",
+					pack: models.Package{
+						Name:    "openssl-1_0_0-doc",
+						Version: "0:1.0.2p-3.22.1",
+					},
+				},
+			},
+		},
 	}
 
 	for i, tt := range tests {
@@ -392,6 +585,520 @@ func TestWalkSUSE(t *testing.T) {
 	}
 }
 
+func TestConvertToModelClass(t *testing.T) {
+	in := `<oval_definitions>
+  <definitions>
+    <definition id="oval:org.opensuse.security:def:20210857" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2 (Important)</title>
+        <reference ref_id="SUSE-SU-2021:0857-1" ref_url="https://lists.suse.com/pipermail/sle-security-updates/2021-March/008520.html" source="SUSE-SU"/>
+        <advisory from="security@suse.de">
+          <severity>Important</severity>
+          <cve impact="important" href="https://www.suse.com/security/cve/CVE-2021-27218/">CVE-2021-27218</cve>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:202127218" version="1" class="vulnerability">
+      <metadata>
+        <title>CVE-2021-27218</title>
+        <reference ref_id="CVE-2021-27218" ref_url="https://www.suse.com/security/cve/CVE-2021-27218/" source="CVE"/>
+        <advisory from="security@suse.de">
+          <cve impact="important" href="https://www.suse.com/security/cve/CVE-2021-27218/">CVE-2021-27218</cve>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+  </definitions>
+  <tests>
+    <rpminfo_test id="oval:org.opensuse.security:tst:2009000002" version="1" comment="glib2-tools is &lt;2.54.3-4.24.1" check="at least one">
+      <object object_ref="oval:org.opensuse.security:obj:2009000002"/>
+      <state state_ref="oval:org.opensuse.security:ste:2009000002"/>
+    </rpminfo_test>
+  </tests>
+  <objects>
+    <rpminfo_object id="oval:org.opensuse.security:obj:2009000002" version="1">
+      <name>glib2-tools</name>
+    </rpminfo_object>
+  </objects>
+  <states>
+    <rpminfo_state id="oval:org.opensuse.security:ste:2009000002" version="1">
+      <evr datatype="evr_string" operation="less than">0:2.54.3-4.24.1</evr>
+    </rpminfo_state>
+  </states>
+</oval_definitions>`
+
+	var root Root
+	if err := xml.Unmarshal([]byte(in), &root); err != nil {
+		t.Fatalf("failed to unmarshal. err: %s", err)
+	}
+	osVerDefs, _, err := ConvertToModel("suse.linux.enterprise.server.15.xml", &root)
+	if err != nil {
+		t.Fatalf("failed to convert. err: %s", err)
+	}
+
+	defs := osVerDefs["15.1"]
+	if len(defs) != 2 {
+		t.Fatalf("expected: 2 definitions, actual: %d", len(defs))
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].DefinitionID < defs[j].DefinitionID })
+	for i, expected := range []string{models.ClassPatch, models.ClassVulnerability} {
+		if defs[i].Class != expected {
+			t.Errorf("[%d]: expected class: %q, actual: %q", i, expected, defs[i].Class)
+		}
+		if expected := []models.Package{{Name: "glib2-tools", Version: "0:2.54.3-4.24.1"}}; !reflect.DeepEqual(defs[i].AffectedPacks, expected) {
+			t.Errorf("[%d]: expected: %v, actual: %v", i, expected, defs[i].AffectedPacks)
+		}
+	}
+	// the URL of the advisory is only of its reference, and none of the CVE
+	for i, expected := range []string{"https://lists.suse.com/pipermail/sle-security-updates/2021-March/008520.html", ""} {
+		if defs[i].Advisory.AdvisoryURL != expected {
+			t.Errorf("[%d]: expected advisory URL: %q, actual: %q", i, expected, defs[i].Advisory.AdvisoryURL)
+		}
+	}
+}
+
+func TestConvertToModelDates(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	// the dates of SUSE are of the day or with the time, and the ones missing, empty or malformed fall back to the default time of ParsedOrDefaultTime
+	in := `<oval_definitions>
+  <definitions>
+    <definition id="oval:org.opensuse.security:def:20230001" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2 (Important)</title>
+        <advisory from="security@suse.de">
+          <issued date="2023-01-02"/>
+          <updated date="2023-01-03 04:05:06"/>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20230002" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2 (Important)</title>
+        <advisory from="security@suse.de"></advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20230003" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2 (Important)</title>
+        <advisory from="security@suse.de">
+          <issued date=""/>
+          <updated date="unknown"/>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20230004" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2 (Important)</title>
+        <advisory from="security@suse.de">
+          <issued date="2023-13-45"/>
+          <updated date="garbage"/>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20230005" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2 (Important)</title>
+        <advisory from="security@suse.de">
+          <issued date="2023-01-02T03:04:05Z"/>
+          <updated date="2023/01/03"/>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+  </definitions>
+  <tests>
+    <rpminfo_test id="oval:org.opensuse.security:tst:2009000002" version="1" comment="glib2-tools is &lt;2.54.3-4.24.1" check="at least one">
+      <object object_ref="oval:org.opensuse.security:obj:2009000002"/>
+      <state state_ref="oval:org.opensuse.security:ste:2009000002"/>
+    </rpminfo_test>
+  </tests>
+  <objects>
+    <rpminfo_object id="oval:org.opensuse.security:obj:2009000002" version="1">
+      <name>glib2-tools</name>
+    </rpminfo_object>
+  </objects>
+  <states>
+    <rpminfo_state id="oval:org.opensuse.security:ste:2009000002" version="1">
+      <evr datatype="evr_string" operation="less than">0:2.54.3-4.24.1</evr>
+    </rpminfo_state>
+  </states>
+</oval_definitions>`
+
+	var root Root
+	if err := xml.Unmarshal([]byte(in), &root); err != nil {
+		t.Fatalf("failed to unmarshal. err: %s", err)
+	}
+
+	fallback := time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	type dates struct {
+		issued, updated time.Time
+	}
+	want := map[string]dates{
+		"oval:org.opensuse.security:def:20230001": {issued: time.Date(2023, time.January, 2, 0, 0, 0, 0, time.UTC), updated: time.Date(2023, time.January, 3, 4, 5, 6, 0, time.UTC)},
+		"oval:org.opensuse.security:def:20230002": {issued: fallback, updated: fallback},
+		"oval:org.opensuse.security:def:20230003": {issued: fallback, updated: fallback},
+		"oval:org.opensuse.security:def:20230004": {issued: fallback, updated: fallback},
+		"oval:org.opensuse.security:def:20230005": {issued: time.Date(2023, time.January, 2, 3, 4, 5, 0, time.UTC), updated: fallback},
+	}
+	check := func(name string, defs []models.Definition) {
+		t.Helper()
+		if len(defs) != len(want) {
+			t.Fatalf("%s: expected: %d definitions, actual: %d", name, len(want), len(defs))
+		}
+		for _, d := range defs {
+			w := want[d.DefinitionID]
+			if !d.Advisory.Issued.Equal(w.issued) || !d.Advisory.Updated.Equal(w.updated) {
+				t.Errorf("%s: %s: expected: issued %s and updated %s, actual: %s and %s", name, d.DefinitionID, w.issued, w.updated, d.Advisory.Issued, d.Advisory.Updated)
+			}
+		}
+	}
+
+	osVerDefs, _, err := ConvertToModel("suse.linux.enterprise.server.15.xml", &root)
+	if err != nil {
+		t.Fatalf("failed to convert. err: %s", err)
+	}
+	check("ConvertToModel", osVerDefs["15.1"])
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	if _, err := driver.InsertOval(context.Background(), &models.Root{Family: c.SUSEEnterpriseServer, OSVersion: "15.1", Timestamp: time.Now(), Definitions: osVerDefs["15.1"]}); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	defs, err := driver.GetByPackName(context.Background(), c.SUSEEnterpriseServer, "15.1", "glib2-tools", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	check("GetByPackName", defs)
+}
+
+func TestConvertToModelSeverity(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	// the severities of the definition and the advisory are stored capitalized, and the unknown one as it is
+	in := `<oval_definitions>
+  <definitions>
+    <definition id="oval:org.opensuse.security:def:20230001" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2</title>
+        <severity>critical</severity>
+        <advisory from="security@suse.de">
+          <severity>important</severity>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20230002" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2</title>
+        <severity>moderate</severity>
+        <advisory from="security@suse.de">
+          <severity>MODERATE</severity>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20230003" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2</title>
+        <severity>LOW</severity>
+        <advisory from="security@suse.de">
+          <severity> Low </severity>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20230004" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2</title>
+        <advisory from="security@suse.de">
+          <severity>Unknown-Vendor</severity>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+  </definitions>
+  <tests>
+    <rpminfo_test id="oval:org.opensuse.security:tst:2009000002" version="1" comment="glib2-tools is &lt;2.54.3-4.24.1" check="at least one">
+      <object object_ref="oval:org.opensuse.security:obj:2009000002"/>
+      <state state_ref="oval:org.opensuse.security:ste:2009000002"/>
+    </rpminfo_test>
+  </tests>
+  <objects>
+    <rpminfo_object id="oval:org.opensuse.security:obj:2009000002" version="1">
+      <name>glib2-tools</name>
+    </rpminfo_object>
+  </objects>
+  <states>
+    <rpminfo_state id="oval:org.opensuse.security:ste:2009000002" version="1">
+      <evr datatype="evr_string" operation="less than">0:2.54.3-4.24.1</evr>
+    </rpminfo_state>
+  </states>
+</oval_definitions>`
+
+	var root Root
+	if err := xml.Unmarshal([]byte(in), &root); err != nil {
+		t.Fatalf("failed to unmarshal. err: %s", err)
+	}
+
+	type severities struct {
+		severity, advisory string
+	}
+	want := map[string]severities{
+		"oval:org.opensuse.security:def:20230001": {severity: "Critical", advisory: "Important"},
+		"oval:org.opensuse.security:def:20230002": {severity: "Moderate", advisory: "Moderate"},
+		"oval:org.opensuse.security:def:20230003": {severity: "Low", advisory: "Low"},
+		"oval:org.opensuse.security:def:20230004": {severity: "", advisory: "Unknown-Vendor"},
+	}
+	check := func(name string, defs []models.Definition) {
+		t.Helper()
+		if len(defs) != len(want) {
+			t.Fatalf("%s: expected: %d definitions, actual: %d", name, len(want), len(defs))
+		}
+		for _, d := range defs {
+			if w := want[d.DefinitionID]; d.Severity != w.severity || d.Advisory.Severity != w.advisory {
+				t.Errorf("%s: %s: expected: %q and %q of the advisory, actual: %q and %q", name, d.DefinitionID, w.severity, w.advisory, d.Severity, d.Advisory.Severity)
+			}
+		}
+	}
+
+	osVerDefs, _, err := ConvertToModel("suse.linux.enterprise.server.15.xml", &root)
+	if err != nil {
+		t.Fatalf("failed to convert. err: %s", err)
+	}
+	check("ConvertToModel", osVerDefs["15.1"])
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	if _, err := driver.InsertOval(context.Background(), &models.Root{Family: c.SUSEEnterpriseServer, OSVersion: "15.1", Timestamp: time.Now(), Definitions: osVerDefs["15.1"]}); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	defs, err := driver.GetByPackName(context.Background(), c.SUSEEnterpriseServer, "15.1", "glib2-tools", "")
+	if err != nil {
+		t.Fatalf("Failed to GetByPackName. err: %s", err)
+	}
+	check("GetByPackName", defs)
+}
+
+func TestConvertToModelRestartHints(t *testing.T) {
+	in := `<oval_definitions>
+  <definitions>
+    <definition id="oval:org.opensuse.security:def:20233001" version="1" class="patch">
+      <metadata>
+        <title>Security update for the Linux Kernel (Important)</title>
+        <advisory from="security@suse.de">
+          <reboot_suggested>True</reboot_suggested>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP5 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20233002" version="1" class="patch">
+      <metadata>
+        <title>Security update for openssh (Moderate)</title>
+        <advisory from="security@suse.de">
+          <reboot_suggested>false</reboot_suggested>
+          <restart_suggested>sshd</restart_suggested>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP5 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20233003" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2 (Low)</title>
+        <advisory from="security@suse.de">
+          <restart_suggested>False</restart_suggested>
+        </advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP5 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+  </definitions>
+  <tests>
+    <rpminfo_test id="oval:org.opensuse.security:tst:2009000002" version="1" comment="glib2-tools is &lt;2.54.3-4.24.1" check="at least one">
+      <object object_ref="oval:org.opensuse.security:obj:2009000002"/>
+      <state state_ref="oval:org.opensuse.security:ste:2009000002"/>
+    </rpminfo_test>
+  </tests>
+  <objects>
+    <rpminfo_object id="oval:org.opensuse.security:obj:2009000002" version="1">
+      <name>glib2-tools</name>
+    </rpminfo_object>
+  </objects>
+  <states>
+    <rpminfo_state id="oval:org.opensuse.security:ste:2009000002" version="1">
+      <evr datatype="evr_string" operation="less than">0:2.54.3-4.24.1</evr>
+    </rpminfo_state>
+  </states>
+</oval_definitions>`
+
+	var root Root
+	if err := xml.Unmarshal([]byte(in), &root); err != nil {
+		t.Fatalf("failed to unmarshal. err: %s", err)
+	}
+	osVerDefs, _, err := ConvertToModel("suse.linux.enterprise.server.15.xml", &root)
+	if err != nil {
+		t.Fatalf("failed to convert. err: %s", err)
+	}
+
+	defs := osVerDefs["15.5"]
+	sort.Slice(defs, func(i, j int) bool { return defs[i].DefinitionID < defs[j].DefinitionID })
+	expected := []struct {
+		reboot  bool
+		restart string
+	}{
+		{reboot: true},
+		{restart: "sshd"},
+		{},
+	}
+	if len(defs) != len(expected) {
+		t.Fatalf("expected: %d definitions, actual: %d", len(expected), len(defs))
+	}
+	for i, e := range expected {
+		if defs[i].Advisory.RebootRequired != e.reboot || defs[i].Advisory.RestartSuggested != e.restart {
+			t.Errorf("[%d]: expected: %+v, actual: reboot %t, restart %q", i, e, defs[i].Advisory.RebootRequired, defs[i].Advisory.RestartSuggested)
+		}
+	}
+}
+
+func TestConvertToModelStat(t *testing.T) {
+	in := `<oval_definitions>
+  <definitions>
+    <definition id="oval:org.opensuse.security:def:20210857" version="1" class="patch">
+      <metadata>
+        <title>Security update for glib2 (Important)</title>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20210001" version="1" class="vulnerability">
+      <metadata>
+        <title>CVE-2021-0001</title>
+        <description>** REJECT ** DO NOT USE THIS CANDIDATE NUMBER.</description>
+      </metadata>
+    </definition>
+    <definition version="1" class="vulnerability">
+      <metadata>
+        <title>CVE-2021-0002</title>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000001" comment="SUSE Linux Enterprise Server 15 SP1 is installed"/>
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+    <definition id="oval:org.opensuse.security:def:20210003" version="1" class="vulnerability">
+      <metadata>
+        <title>CVE-2021-0003</title>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:org.opensuse.security:tst:2009000002" comment="glib2-tools-2.54.3-4.24.1 is installed"/>
+      </criteria>
+    </definition>
+  </definitions>
+  <tests>
+    <rpminfo_test id="oval:org.opensuse.security:tst:2009000002" version="1" comment="glib2-tools is &lt;2.54.3-4.24.1" check="at least one">
+      <object object_ref="oval:org.opensuse.security:obj:2009000002"/>
+      <state state_ref="oval:org.opensuse.security:ste:2009000002"/>
+    </rpminfo_test>
+  </tests>
+  <objects>
+    <rpminfo_object id="oval:org.opensuse.security:obj:2009000002" version="1">
+      <name>glib2-tools</name>
+    </rpminfo_object>
+  </objects>
+  <states>
+    <rpminfo_state id="oval:org.opensuse.security:ste:2009000002" version="1">
+      <evr datatype="evr_string" operation="less than">0:2.54.3-4.24.1</evr>
+    </rpminfo_state>
+  </states>
+</oval_definitions>`
+
+	var root Root
+	if err := xml.Unmarshal([]byte(in), &root); err != nil {
+		t.Fatalf("failed to unmarshal. err: %s", err)
+	}
+	osVerDefs, stat, err := ConvertToModel("suse.linux.enterprise.server.15.xml", &root)
+	if err != nil {
+		t.Fatalf("failed to convert. err: %s", err)
+	}
+	// the definition without ID is converted by the ID derived of its title
+	ids := []string{}
+	for _, d := range osVerDefs["15.1"] {
+		ids = append(ids, d.DefinitionID)
+	}
+	sort.Strings(ids)
+	if expected := []string{"no-id:CVE-2021-0002", "oval:org.opensuse.security:def:20210857"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected: the definitions %q of 15.1, actual: %q", expected, ids)
+	}
+
+	// the definition of the package without the installed release is skipped rather than lost silently
+	expected := models.ConvertStat{
+		Seen:       4,
+		Converted:  2,
+		Skipped:    map[string]int{models.SkipRejected: 1, models.SkipNoRelease: 1},
+		SkippedIDs: []string{"oval:org.opensuse.security:def:20210001", "oval:org.opensuse.security:def:20210003"},
+		IDsDerived: 1,
+	}
+	if !reflect.DeepEqual(stat, expected) {
+		t.Errorf("expected: %+v, actual: %+v", expected, stat)
+	}
+}
+
 func TestGetOSVersion(t *testing.T) {
 	var tests = []struct {
 		s        string
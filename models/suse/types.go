@@ -35,6 +35,7 @@ type Definition struct {
 	Affecteds   []Affected  `xml:"metadata>affected"`
 	References  []Reference `xml:"metadata>reference"`
 	Description string      `xml:"metadata>description"`
+	Severity    string      `xml:"metadata>severity"`
 	Advisory    Advisory    `xml:"metadata>advisory"`
 	Criteria    Criteria    `xml:"criteria"`
 }
@@ -83,6 +84,8 @@ type Advisory struct {
 	Updated struct {
 		Date string `xml:"date,attr"`
 	} `xml:"updated"`
+	RebootSuggested  string `xml:"reboot_suggested"`  // SUSE patch, e.g. true
+	RestartSuggested string `xml:"restart_suggested"` // SUSE patch, e.g. true or the services to restart
 }
 
 // Cve : >definitions>definition>metadata>advisory>cve
@@ -81,10 +81,20 @@ type Advisory struct {
 	Severity   string   `xml:"severity"`
 	Rights     string   `xml:"rights"`
 	PublicDate string   `xml:"public_date"`
+	Cves       []Cve    `xml:"cve"`
 	Refs       []Ref    `xml:"ref"`
 	Bugs       []Bug    `xml:"bug"`
 }
 
+// Cve : >definitions>definition>metadata>advisory>cve
+type Cve struct {
+	XMLName  xml.Name `xml:"cve"`
+	CveID    string   `xml:",chardata"`
+	Href     string   `xml:"href,attr"`
+	Priority string   `xml:"priority,attr"`
+	Public   string   `xml:"public,attr"`
+}
+
 // Ref : >definitions>definition>metadata>advisory>ref
 type Ref struct {
 	XMLName xml.Name `xml:"ref"`
@@ -3,23 +3,22 @@ package ubuntu
 import (
 	"regexp"
 	"strings"
-	"time"
 
 	"github.com/inconshreveable/log15"
-	"github.com/spf13/viper"
 	"golang.org/x/xerrors"
 
 	"github.com/vulsio/goval-dictionary/models"
 	"github.com/vulsio/goval-dictionary/models/util"
 )
 
-// ConvertToModel Convert OVAL to models
-func ConvertToModel(root *Root) ([]models.Definition, error) {
+// ConvertToModel Convert OVAL to models, with the stat of the definitions
+func ConvertToModel(root *Root) ([]models.Definition, models.ConvertStat, error) {
 	tests, err := parseTests(*root)
 	if err != nil {
-		return nil, xerrors.Errorf("Failed to parse oval.Tests. err: %w", err)
+		return nil, models.ConvertStat{}, xerrors.Errorf("Failed to parse oval.Tests. err: %w", err)
 	}
-	return parseDefinitions(root.Definitions.Definitions, tests), nil
+	defs, stat := parseDefinitions(root.Definitions.Definitions, tests)
+	return defs, stat, nil
 }
 
 var rePkgComment = regexp.MustCompile(`The '(.*)' package binar.+`)
@@ -89,21 +88,34 @@ func followTestRefs(test Textfilecontent54Test, objects map[string]string, state
 	return t, nil
 }
 
-func parseDefinitions(ovalDefs []Definition, tests map[string]dpkgInfoTest) []models.Definition {
+func parseDefinitions(ovalDefs []Definition, tests map[string]dpkgInfoTest) ([]models.Definition, models.ConvertStat) {
 	defs := []models.Definition{}
+	var stat models.ConvertStat
 
 	for _, d := range ovalDefs {
 		if strings.Contains(d.Description, "** REJECT **") {
+			stat.Skip(d.ID, models.SkipRejected)
 			continue
 		}
 
+		defID := util.DefinitionID(d.ID, d.Title, &stat)
+
+		// per CVE priority, e.g. <cve href="https://ubuntu.com/security/CVE-2023-1234" priority="medium" public="20230101">CVE-2023-1234</cve>
+		advCves := map[string]Cve{}
+		for _, c := range d.Advisory.Cves {
+			advCves[strings.TrimSpace(c.CveID)] = c
+		}
+
 		cves := []models.Cve{}
 		rs := []models.Reference{}
 		for _, r := range d.References {
 			if r.Source == "CVE" {
+				c := advCves[r.RefID]
 				cves = append(cves, models.Cve{
-					CveID: r.RefID,
-					Href:  r.RefURL,
+					CveID:  r.RefID,
+					Impact: util.NormalizeSeverity(c.Priority),
+					Href:   r.RefURL,
+					Public: c.Public,
 				})
 			}
 
@@ -127,15 +139,18 @@ func parseDefinitions(ovalDefs []Definition, tests map[string]dpkgInfoTest) []mo
 				RefURL: r.URL,
 			})
 		}
+		cves, rerouted := util.NormalizeCves(cves, &stat)
+		rs = append(rs, rerouted...)
 
 		date := util.ParsedOrDefaultTime([]string{"2006-01-02", "2006-01-02 15:04:05", "2006-01-02 15:04:05 +0000", "2006-01-02 15:04:05 UTC"}, d.Advisory.PublicDate)
 
 		def := models.Definition{
-			DefinitionID: d.ID,
-			Title:        d.Title,
-			Description:  d.Description,
+			DefinitionID: defID,
+			Class:        strings.TrimSpace(d.Class),
+			Title:        strings.TrimSpace(d.Title),
+			Description:  strings.TrimSpace(d.Description),
 			Advisory: models.Advisory{
-				Severity:        d.Advisory.Severity,
+				Severity:        util.NormalizeSeverity(d.Advisory.Severity),
 				Cves:            cves,
 				Bugzillas:       []models.Bugzilla{},
 				AffectedCPEList: []models.Cpe{},
@@ -144,24 +159,14 @@ func parseDefinitions(ovalDefs []Definition, tests map[string]dpkgInfoTest) []mo
 			},
 			Debian:        nil,
 			AffectedPacks: collectUbuntuPacks(d.Criteria, tests),
-			References:    rs,
-		}
-
-		if viper.GetBool("no-details") {
-			def.Title = ""
-			def.Description = ""
-			def.Advisory.Severity = ""
-			def.Advisory.AffectedCPEList = []models.Cpe{}
-			def.Advisory.Bugzillas = []models.Bugzilla{}
-			def.Advisory.Issued = time.Time{}
-			def.Advisory.Updated = time.Time{}
-			def.References = []models.Reference{}
+			References:    util.NormalizeReferences(rs),
 		}
 
+		stat.Convert()
 		defs = append(defs, def)
 	}
 
-	return defs
+	return defs, stat
 }
 
 func collectUbuntuPacks(cri Criteria, tests map[string]dpkgInfoTest) []models.Package {
@@ -191,9 +196,11 @@ func walkCriterion(cri Criteria, tests map[string]dpkgInfoTest) []models.Package
 			})
 		} else if strings.Contains(c.Comment, "was vulnerable but has been fixed") || // status: released
 			strings.Contains(c.Comment, "was vulnerable and has been fixed") { // status: released, only this comment: "firefox package in $RELEASE_NAME was vulnerable and has been fixed, but no release version available for it."
+			version, raw := util.NormalizedVersion(t.FixedVersion, util.NormalizeDebianVersion)
 			pkgs = append(pkgs, models.Package{
 				Name:        t.Name,
-				Version:     t.FixedVersion,
+				Version:     version,
+				RawVersion:  raw,
 				NotFixedYet: false,
 			})
 		} else {
@@ -143,7 +143,8 @@ func TestCollectUbuntuPacks(t *testing.T) {
 			expected: []models.Package{
 				{
 					Name:        "subversion",
-					Version:     "0:1.14.1-3ubuntu0.22.04.1",
+					Version:     "1.14.1-3ubuntu0.22.04.1",
+					RawVersion:  "0:1.14.1-3ubuntu0.22.04.1",
 					NotFixedYet: false,
 				},
 			},
@@ -206,7 +207,8 @@ func TestCollectUbuntuPacks(t *testing.T) {
 			expected: []models.Package{
 				{
 					Name:        "poppler",
-					Version:     "0:0.10.5-1ubuntu2",
+					Version:     "0.10.5-1ubuntu2",
+					RawVersion:  "0:0.10.5-1ubuntu2",
 					NotFixedYet: false,
 				},
 			},
@@ -221,3 +223,80 @@ func TestCollectUbuntuPacks(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDefinitionsPriority(t *testing.T) {
+	cve := func(id string) Reference {
+		return Reference{Source: "CVE", RefID: id, RefURL: "https://ubuntu.com/security/" + id}
+	}
+	def := Definition{
+		ID:       "oval:com.ubuntu.jammy:def:202312340000000",
+		Title:    "CVE-2023-1234 on Ubuntu 22.04 LTS (jammy) - medium.",
+		Advisory: Advisory{Severity: "medium"},
+		References: []Reference{
+			cve("CVE-2023-0001"), cve("CVE-2023-0002"), cve("CVE-2023-0003"), cve("CVE-2023-0004"), cve("CVE-2023-0005"), cve("CVE-2023-0006"),
+		},
+	}
+	def.Advisory.Cves = []Cve{
+		{CveID: "CVE-2023-0001", Priority: "negligible"},
+		{CveID: "CVE-2023-0002", Priority: "low"},
+		{CveID: "CVE-2023-0003", Priority: "medium"},
+		{CveID: "CVE-2023-0004", Priority: "high"},
+		{CveID: "CVE-2023-0005", Priority: "critical", Public: "20230101"},
+	}
+
+	defs, _ := parseDefinitions([]Definition{def}, map[string]dpkgInfoTest{})
+	if len(defs) != 1 {
+		t.Fatalf("expected: 1 definition, actual: %d", len(defs))
+	}
+	if defs[0].Advisory.Severity != "Medium" {
+		t.Errorf("expected: Medium, actual: %s", defs[0].Advisory.Severity)
+	}
+
+	expected := []models.Cve{
+		{CveID: "CVE-2023-0001", Impact: "Negligible", Href: "https://ubuntu.com/security/CVE-2023-0001"},
+		{CveID: "CVE-2023-0002", Impact: "Low", Href: "https://ubuntu.com/security/CVE-2023-0002"},
+		{CveID: "CVE-2023-0003", Impact: "Medium", Href: "https://ubuntu.com/security/CVE-2023-0003"},
+		{CveID: "CVE-2023-0004", Impact: "High", Href: "https://ubuntu.com/security/CVE-2023-0004"},
+		{CveID: "CVE-2023-0005", Impact: "Critical", Href: "https://ubuntu.com/security/CVE-2023-0005", Public: "20230101"},
+		{CveID: "CVE-2023-0006", Href: "https://ubuntu.com/security/CVE-2023-0006"},
+	}
+	if !reflect.DeepEqual(expected, defs[0].Advisory.Cves) {
+		e := pp.Sprintf("%v", expected)
+		a := pp.Sprintf("%v", defs[0].Advisory.Cves)
+		t.Errorf("expected: %s\n, actual: %s\n", e, a)
+	}
+}
+
+func TestParseDefinitionsSeverity(t *testing.T) {
+	tests := []struct {
+		severity string
+		expected string
+	}{
+		{severity: "negligible", expected: "Negligible"},
+		{severity: "untriaged", expected: "Untriaged"},
+		{severity: "LOW", expected: "Low"},
+		{severity: " medium ", expected: "Medium"},
+		{severity: "High", expected: "High"},
+		{severity: "critical", expected: "Critical"},
+		// unknown ones are kept as they are, and the missing ones stay empty
+		{severity: "unknown-vendor", expected: "unknown-vendor"},
+		{severity: "", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.severity, func(t *testing.T) {
+			def := Definition{
+				ID:         "oval:com.ubuntu.jammy:def:202312340000000",
+				Title:      "CVE-2023-1234 on Ubuntu 22.04 LTS (jammy)",
+				Advisory:   Advisory{Severity: tt.severity, Cves: []Cve{{CveID: "CVE-2023-1234", Priority: tt.severity}}},
+				References: []Reference{{Source: "CVE", RefID: "CVE-2023-1234", RefURL: "https://ubuntu.com/security/CVE-2023-1234"}},
+			}
+			defs, _ := parseDefinitions([]Definition{def}, map[string]dpkgInfoTest{})
+			if len(defs) != 1 || len(defs[0].Advisory.Cves) != 1 {
+				t.Fatalf("expected: 1 definition of 1 CVE, actual: %v", defs)
+			}
+			if defs[0].Advisory.Severity != tt.expected || defs[0].Advisory.Cves[0].Impact != tt.expected {
+				t.Errorf("expected: %q of the advisory and the CVE, actual: %q and %q", tt.expected, defs[0].Advisory.Severity, defs[0].Advisory.Cves[0].Impact)
+			}
+		})
+	}
+}
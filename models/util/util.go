@@ -1,9 +1,15 @@
 package util
 
 import (
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+
+	"github.com/vulsio/goval-dictionary/models"
 )
 
 // ParsedOrDefaultTime returns time.Parse(layout, value), or time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC) if it failed to parse
@@ -21,3 +27,281 @@ func ParsedOrDefaultTime(layouts []string, value string) time.Time {
 	log15.Warn("Failed to parse string", "timeformat", layouts, "target string", value)
 	return defaultTime
 }
+
+// YearRange is the range of the years From to To inclusive, unbounded on the side of 0
+type YearRange struct {
+	From int
+	To   int
+}
+
+// ParseYearRange parses the range of years, e.g. 2015-2018, 2015- or 2015, and the empty string as the unbounded range
+func ParseYearRange(s string) (YearRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return YearRange{}, nil
+	}
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		to = from
+	}
+	var r YearRange
+	for _, x := range []struct {
+		s string
+		y *int
+	}{{s: from, y: &r.From}, {s: to, y: &r.To}} {
+		if x.s = strings.TrimSpace(x.s); x.s == "" {
+			continue
+		}
+		y, err := strconv.Atoi(x.s)
+		if err != nil || y <= 0 {
+			return YearRange{}, xerrors.Errorf("Failed to parse year range: %q. e.g. 2015-2018, 2015- or 2015", s)
+		}
+		*x.y = y
+	}
+	if r.To != 0 && r.From > r.To {
+		return YearRange{}, xerrors.Errorf("Failed to parse year range: %q. The first year is after the last one", s)
+	}
+	return r, nil
+}
+
+// IsZero reports whether the range is unbounded on both sides
+func (r YearRange) IsZero() bool {
+	return r.From == 0 && r.To == 0
+}
+
+// Contains reports whether the year of t is in the range.
+// The time failed to parse by ParsedOrDefaultTime is always contained, so that the advisory without the date is not dropped.
+func (r YearRange) Contains(t time.Time) bool {
+	if t.Year() <= 1000 {
+		return true
+	}
+	return (r.From == 0 || t.Year() >= r.From) && (r.To == 0 || t.Year() <= r.To)
+}
+
+var severities = map[string]string{
+	"critical":   "Critical",
+	"important":  "Important",
+	"high":       "High",
+	"moderate":   "Moderate",
+	"medium":     "Medium",
+	"low":        "Low",
+	"negligible": "Negligible", // Ubuntu
+	"untriaged":  "Untriaged",  // Ubuntu
+	"none":       "None",
+	"n/a":        "N/A",
+}
+
+// NormalizeSeverity normalizes the capitalization of vendor severity, e.g. IMPORTANT(Oracle) -> Important
+// Unknown values are returned as they are, except for surrounding white spaces.
+func NormalizeSeverity(severity string) string {
+	s := strings.TrimSpace(severity)
+	if n, ok := severities[strings.ToLower(s)]; ok {
+		return n
+	}
+	return s
+}
+
+// ParseEVR splits the version string into epoch, version and release, e.g. 1:1.0.2k-8.el7 -> (1, 1.0.2k, 8.el7)
+// The release is what follows the last hyphen, so a dpkg style version like 1:2.4.38-3+deb10u1 gives (1, 2.4.38, 3+deb10u1).
+// Missing parts are returned as empty strings.
+func ParseEVR(v string) (epoch, version, release string) {
+	version = strings.TrimSpace(v)
+	if e, rest, found := strings.Cut(version, ":"); found {
+		epoch, version = e, rest
+	}
+	if i := strings.LastIndex(version, "-"); i >= 0 {
+		version, release = version[:i], version[i+1:]
+	}
+	return epoch, version, release
+}
+
+// NormalizeEVR returns the RPM version string always prefixed with an epoch, e.g. 2.17-157.el7 -> 0:2.17-157.el7
+func NormalizeEVR(v string) string {
+	epoch, version, release := ParseEVR(v)
+	if version == "" {
+		return strings.TrimSpace(v)
+	}
+	if epoch == "" {
+		epoch = "0"
+	}
+	if release == "" {
+		return epoch + ":" + version
+	}
+	return epoch + ":" + version + "-" + release
+}
+
+// NormalizeDebianVersion returns the dpkg version string without the epoch of 0, which dpkg compares as no epoch and Debian omits,
+// e.g. 0:2.4.38-3+deb10u1 -> 2.4.38-3+deb10u1. The revision is kept as is, e.g. +deb10u1 of the security updates and ~deb12u1 of the backports.
+func NormalizeDebianVersion(v string) string {
+	v = strings.TrimSpace(v)
+	if epoch, rest, found := strings.Cut(v, ":"); found && strings.Trim(epoch, "0") == "" && rest != "" {
+		return rest
+	}
+	return v
+}
+
+// NormalizedVersion returns v normalized by normalize, e.g. NormalizeEVR, and v as the raw version to store in models.Package.RawVersion
+// if normalize changed it, or empty
+func NormalizedVersion(v string, normalize func(string) string) (version, raw string) {
+	version = normalize(v)
+	if version != v {
+		raw = v
+	}
+	return version, raw
+}
+
+var (
+	referenceSources = map[string]string{
+		"cve":     "CVE",
+		"rhsa":    "RHSA",
+		"rhba":    "RHBA",
+		"rhea":    "RHEA",
+		"elsa":    "ELSA",
+		"dsa":     "DSA",
+		"dla":     "DLA",
+		"usn":     "USN",
+		"alas":    "ALAS",
+		"suse":    "SUSE",
+		"suse-su": "SUSE-SU",
+	}
+	referenceIDPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`CVE-\d{4}-\d{4,}`),
+		regexp.MustCompile(`RH[SBE]A-\d{4}:\d+`),
+		regexp.MustCompile(`ELSA-\d{4}-\d+`),
+		regexp.MustCompile(`D[SL]A-\d+(-\d+)?`),
+		regexp.MustCompile(`USN-\d+-\d+`),
+		regexp.MustCompile(`ALAS\d*-\d{4}-\d+`),
+		regexp.MustCompile(`SUSE-SU-\d{4}:\d+-\d+`),
+	}
+)
+
+// NormalizeReferences normalizes the references shared by all converters:
+// well-known sources are uppercased, RefID holds the bare identifier and RefURL holds the link, and exact duplicates are dropped.
+func NormalizeReferences(refs []models.Reference) []models.Reference {
+	normalized := []models.Reference{}
+	seen := map[models.Reference]struct{}{}
+	for _, r := range refs {
+		r.Source = strings.TrimSpace(r.Source)
+		if s, ok := referenceSources[strings.ToLower(r.Source)]; ok {
+			r.Source = s
+		}
+
+		r.RefID = strings.TrimSpace(r.RefID)
+		r.RefURL = strings.TrimSpace(r.RefURL)
+		if strings.HasPrefix(r.RefID, "http://") || strings.HasPrefix(r.RefID, "https://") {
+			if r.RefURL == "" {
+				r.RefURL = r.RefID
+			}
+			r.RefID = ""
+		}
+		if r.RefID == "" {
+			// e.g. https://www.debian.org/security/2014/dsa-3051 -> DSA-3051
+			for _, p := range referenceIDPatterns {
+				if id := p.FindString(strings.ToUpper(r.RefURL)); id != "" {
+					r.RefID = id
+					break
+				}
+			}
+		}
+
+		if _, ok := seen[r]; ok {
+			continue
+		}
+		seen[r] = struct{}{}
+		normalized = append(normalized, r)
+	}
+	return normalized
+}
+
+// AdvisoryURL returns the URL of the advisory id: the RefURL of the reference of refs whose RefID is id, or template of id if none,
+// e.g. of the errata of the vendor. It is empty for the empty id or the nil template without the reference, rather than guessed.
+func AdvisoryURL(id string, refs []models.Reference, template func(id string) string) string {
+	if id == "" {
+		return ""
+	}
+	for _, r := range refs {
+		if strings.EqualFold(r.RefID, id) && r.RefURL != "" {
+			return r.RefURL
+		}
+	}
+	if template == nil {
+		return ""
+	}
+	return template(id)
+}
+
+// NoIDPrefix is the prefix of the DefinitionID derived of the title of the definition without ID, e.g. "no-id:CVE-2023-1234"
+const NoIDPrefix = "no-id:"
+
+// DefinitionID returns id trimmed, or the one derived of title by NoIDPrefix if id is empty, warned and counted in stat,
+// so that the definition without ID is still converted rather than lost. It is empty if title is empty as well.
+func DefinitionID(id, title string, stat *models.ConvertStat) string {
+	if id = strings.TrimSpace(id); id != "" {
+		return id
+	}
+	stat.IDsDerived++
+	title = strings.TrimSpace(title)
+	if title == "" {
+		log15.Warn("Convert definition without ID nor title, by the empty ID")
+		return ""
+	}
+	id = NoIDPrefix + title
+	log15.Warn("Convert definition without ID, by the ID derived of its title", "title", title, "definitionID", id)
+	return id
+}
+
+// cveIDPattern is the format of the CVE IDs stored as models.Cve, of the sequence number of 4 digits or more
+var cveIDPattern = regexp.MustCompile(`^CVE-\d{4}-\d{4,}$`)
+
+// cveIDSeparators splits the several IDs in a CVE of the upstream, e.g. "CVE-2016-1234 CVE-2016-5678" and "CVE-2016-1234,CVE-2016-5678"
+var cveIDSeparators = regexp.MustCompile(`[\s,;]+`)
+
+// NormalizeCveID returns id trimmed and uppercased, e.g. CVE-2015-1234 of "cve-2015-1234 ", and whether it is of the format of the CVE ID
+func NormalizeCveID(id string) (string, bool) {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	return id, cveIDPattern.MatchString(id)
+}
+
+// NormalizeCves returns the CVEs of cves split by the IDs of each, uppercased, and the references of the IDs in them which are not of CVE,
+// e.g. TEMP-0000000-1A2B3C of Debian and XSA-123, with the source CVE of the OVAL references they are of, not to break the exact match of
+// GetByCveID. The CVE split keeps Href only if it is of the ID, and the same ID in cves is kept once with the Href of any of them.
+// The IDs normalized, i.e. split or uppercased, and rerouted to the references are counted in stat.
+func NormalizeCves(cves []models.Cve, stat *models.ConvertStat) ([]models.Cve, []models.Reference) {
+	normalized := []models.Cve{}
+	rerouted := []models.Reference{}
+	seen := map[string]int{} // the index in normalized by ID
+	for _, c := range cves {
+		ids := cveIDSeparators.Split(strings.TrimSpace(c.CveID), -1)
+		for _, raw := range ids {
+			if raw == "" {
+				continue
+			}
+			id, ok := NormalizeCveID(raw)
+			if !ok {
+				rerouted = append(rerouted, models.Reference{Source: "CVE", RefID: raw, RefURL: c.Href})
+				stat.CvesRerouted++
+				continue
+			}
+
+			n := c
+			n.CveID = id
+			if len(ids) > 1 {
+				stat.CvesNormalized++
+				if !strings.Contains(strings.ToUpper(n.Href), id) {
+					n.Href = ""
+				}
+			} else if id != c.CveID {
+				stat.CvesNormalized++
+			}
+			if i, ok := seen[id]; ok {
+				if normalized[i].Href == "" {
+					normalized[i].Href = n.Href
+				}
+				continue
+			}
+			seen[id] = len(normalized)
+			normalized = append(normalized, n)
+		}
+	}
+	return normalized, rerouted
+}
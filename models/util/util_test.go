@@ -1,8 +1,11 @@
 package util
 
 import (
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/vulsio/goval-dictionary/models"
 )
 
 func TestParsedOrDefaultTime(t *testing.T) {
@@ -24,6 +27,12 @@ func TestParsedOrDefaultTime(t *testing.T) {
 			layouts: []string{"2006-01-02", "2006-01-02 15:04:05"},
 			want:    time.Date(2021, time.January, 2, 15, 0, 0, 0, time.UTC),
 		},
+		{
+			name:    "success to parse(RFC3339)",
+			in:      "2021-01-02T15:00:00Z",
+			layouts: []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339},
+			want:    time.Date(2021, time.January, 2, 15, 0, 0, 0, time.UTC),
+		},
 		{
 			name:    "failed to parse",
 			in:      "2021/01/02",
@@ -51,3 +60,440 @@ func TestParsedOrDefaultTime(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeSeverity(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{
+			in:   "Important",
+			want: "Important",
+		},
+		{
+			in:   "IMPORTANT",
+			want: "Important",
+		},
+		{
+			in:   "moderate",
+			want: "Moderate",
+		},
+		{
+			in:   " Low\n",
+			want: "Low",
+		},
+		{
+			in:   "CRITICAL",
+			want: "Critical",
+		},
+		{
+			in:   "n/a",
+			want: "N/A",
+		},
+		{
+			in:   "negligible",
+			want: "Negligible",
+		},
+		{
+			in:   "",
+			want: "",
+		},
+		{
+			in:   "Unknown Severity",
+			want: "Unknown Severity",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := NormalizeSeverity(tt.in); got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEVR(t *testing.T) {
+	tests := []struct {
+		in      string
+		epoch   string
+		version string
+		release string
+	}{
+		{in: "0:2.17-157.el7", epoch: "0", version: "2.17", release: "157.el7"},
+		{in: "1:1.0.2k-8.el7", epoch: "1", version: "1.0.2k", release: "8.el7"},
+		{in: "2.17-157.el7", version: "2.17", release: "157.el7"},
+		{in: "0:4.5.0-42.module+el8.2.0+6024+15a2423f", epoch: "0", version: "4.5.0", release: "42.module+el8.2.0+6024+15a2423f"},
+		{in: "0:2.6.32-754.el6_10.1.0.1", epoch: "0", version: "2.6.32", release: "754.el6_10.1.0.1"},
+		{in: "1:2.4.38-3+deb10u1", epoch: "1", version: "2.4.38", release: "3+deb10u1"},
+		{in: "7.14-2+deb7u7", version: "7.14", release: "2+deb7u7"},
+		{in: "1:9.16.42-1~deb11u1", epoch: "1", version: "9.16.42", release: "1~deb11u1"},
+		{in: "2.9.10+dfsg-6.7+deb11u4", version: "2.9.10+dfsg", release: "6.7+deb11u4"},
+		{in: "0.9.8c-4etch9+lenny1", version: "0.9.8c", release: "4etch9+lenny1"},
+		{in: "2020.1+deb11u1", version: "2020.1+deb11u1"},
+		{in: "1.2.3-0ubuntu0.18.04.1", version: "1.2.3", release: "0ubuntu0.18.04.1"},
+		{in: "2.0.4-beta-1", version: "2.0.4-beta", release: "1"},
+		{in: "1.16.0", version: "1.16.0"},
+		{in: " 1.1.1k-r0 ", version: "1.1.1k", release: "r0"},
+		{in: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			epoch, version, release := ParseEVR(tt.in)
+			if epoch != tt.epoch || version != tt.version || release != tt.release {
+				t.Errorf("got: (%q, %q, %q), want: (%q, %q, %q)", epoch, version, release, tt.epoch, tt.version, tt.release)
+			}
+		})
+	}
+}
+
+func TestNormalizeEVR(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "0:2.17-157.el7", want: "0:2.17-157.el7"},
+		{in: "2.17-157.el7", want: "0:2.17-157.el7"},
+		{in: ":2.17-157.el7", want: "0:2.17-157.el7"},
+		{in: "1:1.0.2k-8.el7", want: "1:1.0.2k-8.el7"},
+		{in: "1.0.2k", want: "0:1.0.2k"},
+		{in: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := NormalizeEVR(tt.in); got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeDebianVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "3.0.9-1", want: "3.0.9-1"},
+		{in: "0:3.0.9-1", want: "3.0.9-1"},
+		{in: "00:3.0.9-1", want: "3.0.9-1"},
+		{in: "1:2.4.38-3+deb10u1", want: "1:2.4.38-3+deb10u1"},
+		{in: "0:2.4.38-3+deb10u1", want: "2.4.38-3+deb10u1"},
+		{in: "2.9.10+dfsg-6.7+deb11u4", want: "2.9.10+dfsg-6.7+deb11u4"},
+		{in: "102.11.0esr-1~deb12u1", want: "102.11.0esr-1~deb12u1"},
+		{in: "1:102.11.0-1~deb12u1", want: "1:102.11.0-1~deb12u1"},
+		{in: "2020.1+deb11u1", want: "2020.1+deb11u1"},
+		{in: "1.2.3-0ubuntu0.18.04.1", want: "1.2.3-0ubuntu0.18.04.1"},
+		{in: " 3.0.9-1 ", want: "3.0.9-1"},
+		// not fixed, see models/debian
+		{in: "0", want: "0"},
+		{in: "0:", want: "0:"},
+		{in: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := NormalizeDebianVersion(tt.in); got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizedVersion(t *testing.T) {
+	tests := []struct {
+		in        string
+		normalize func(string) string
+		version   string
+		raw       string
+	}{
+		{in: "0:2.17-157.el7", normalize: NormalizeEVR, version: "0:2.17-157.el7"},
+		{in: "2.17-157.el7", normalize: NormalizeEVR, version: "0:2.17-157.el7", raw: "2.17-157.el7"},
+		{in: "3.0.9-1", normalize: NormalizeDebianVersion, version: "3.0.9-1"},
+		{in: "0:2.4.38-3+deb10u1", normalize: NormalizeDebianVersion, version: "2.4.38-3+deb10u1", raw: "0:2.4.38-3+deb10u1"},
+		// SUSE
+		{in: "0:3.0.8-150500.5.8.1", normalize: NormalizeEVR, version: "0:3.0.8-150500.5.8.1"},
+		{in: "2.54.3-4.24.1", normalize: NormalizeEVR, version: "0:2.54.3-4.24.1", raw: "2.54.3-4.24.1"},
+		{in: "1:2.4.48-150400.3.3.1", normalize: NormalizeEVR, version: "1:2.4.48-150400.3.3.1"},
+		// Ubuntu
+		{in: "0:2.9.13+dfsg-1ubuntu0.3", normalize: NormalizeDebianVersion, version: "2.9.13+dfsg-1ubuntu0.3", raw: "0:2.9.13+dfsg-1ubuntu0.3"},
+		{in: "1:9.4p1-1ubuntu0.22.04.1", normalize: NormalizeDebianVersion, version: "1:9.4p1-1ubuntu0.22.04.1"},
+		{in: "0:3.0.2-0ubuntu1.10", normalize: NormalizeDebianVersion, version: "3.0.2-0ubuntu1.10", raw: "0:3.0.2-0ubuntu1.10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			version, raw := NormalizedVersion(tt.in, tt.normalize)
+			if version != tt.version || raw != tt.raw {
+				t.Errorf("got: (%q, %q), want: (%q, %q)", version, raw, tt.version, tt.raw)
+			}
+		})
+	}
+}
+
+func TestNormalizeReferences(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []models.Reference
+		want []models.Reference
+	}{
+		{
+			name: "RedHat",
+			in: []models.Reference{
+				{Source: "RHSA", RefID: "RHSA-2017:0933", RefURL: "https://access.redhat.com/errata/RHSA-2017:0933"},
+				{Source: "CVE", RefID: "CVE-2016-8650", RefURL: "https://access.redhat.com/security/cve/CVE-2016-8650"},
+				{Source: "CVE", RefID: "CVE-2016-8650", RefURL: "https://access.redhat.com/security/cve/CVE-2016-8650"},
+			},
+			want: []models.Reference{
+				{Source: "RHSA", RefID: "RHSA-2017:0933", RefURL: "https://access.redhat.com/errata/RHSA-2017:0933"},
+				{Source: "CVE", RefID: "CVE-2016-8650", RefURL: "https://access.redhat.com/security/cve/CVE-2016-8650"},
+			},
+		},
+		{
+			name: "Oracle",
+			in: []models.Reference{
+				{Source: "elsa", RefID: "ELSA-2020-0112", RefURL: "https://linux.oracle.com/errata/ELSA-2020-0112.html"},
+				{Source: "cve", RefID: "CVE-2019-17666 ", RefURL: "https://linux.oracle.com/cve/CVE-2019-17666.html"},
+			},
+			want: []models.Reference{
+				{Source: "ELSA", RefID: "ELSA-2020-0112", RefURL: "https://linux.oracle.com/errata/ELSA-2020-0112.html"},
+				{Source: "CVE", RefID: "CVE-2019-17666", RefURL: "https://linux.oracle.com/cve/CVE-2019-17666.html"},
+			},
+		},
+		{
+			name: "Debian",
+			in: []models.Reference{
+				{Source: "CVE", RefID: "CVE-2014-3704", RefURL: "https://security-tracker.debian.org/tracker/CVE-2014-3704"},
+				{Source: "DSA", RefID: "https://www.debian.org/security/2014/dsa-3051"},
+			},
+			want: []models.Reference{
+				{Source: "CVE", RefID: "CVE-2014-3704", RefURL: "https://security-tracker.debian.org/tracker/CVE-2014-3704"},
+				{Source: "DSA", RefID: "DSA-3051", RefURL: "https://www.debian.org/security/2014/dsa-3051"},
+			},
+		},
+		{
+			name: "Ubuntu",
+			in: []models.Reference{
+				{Source: "Ref", RefURL: "https://ubuntu.com/security/notices/USN-3294-1"},
+				{Source: "Bug", RefURL: "https://bugs.launchpad.net/ubuntu/+source/bash/+bug/1507025"},
+				{Source: "Bug", RefURL: "https://bugs.launchpad.net/ubuntu/+source/bash/+bug/1507025"},
+			},
+			want: []models.Reference{
+				{Source: "Ref", RefID: "USN-3294-1", RefURL: "https://ubuntu.com/security/notices/USN-3294-1"},
+				{Source: "Bug", RefURL: "https://bugs.launchpad.net/ubuntu/+source/bash/+bug/1507025"},
+			},
+		},
+		{
+			name: "SUSE",
+			in: []models.Reference{
+				{Source: "suse-su", RefID: "SUSE-SU-2021:0857-1", RefURL: "https://lists.suse.com/pipermail/sle-security-updates/2021-March/008520.html"},
+				{Source: "CVE", RefID: "CVE-2021-27218", RefURL: "https://www.suse.com/security/cve/CVE-2021-27218/"},
+			},
+			want: []models.Reference{
+				{Source: "SUSE-SU", RefID: "SUSE-SU-2021:0857-1", RefURL: "https://lists.suse.com/pipermail/sle-security-updates/2021-March/008520.html"},
+				{Source: "CVE", RefID: "CVE-2021-27218", RefURL: "https://www.suse.com/security/cve/CVE-2021-27218/"},
+			},
+		},
+		{
+			name: "Amazon",
+			in: []models.Reference{
+				{Source: "cve", RefID: "CVE-2023-1234", RefURL: "http://cve.mitre.org/cgi-bin/cvename.cgi?name=CVE-2023-1234"},
+			},
+			want: []models.Reference{
+				{Source: "CVE", RefID: "CVE-2023-1234", RefURL: "http://cve.mitre.org/cgi-bin/cvename.cgi?name=CVE-2023-1234"},
+			},
+		},
+		{
+			name: "empty",
+			in:   nil,
+			want: []models.Reference{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeReferences(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got: %+v, want: %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdvisoryURL(t *testing.T) {
+	refs := []models.Reference{
+		{Source: "CVE", RefID: "CVE-2016-8650", RefURL: "https://access.redhat.com/security/cve/CVE-2016-8650"},
+		{Source: "RHSA", RefID: "RHSA-2017:0933", RefURL: "https://rhn.redhat.com/errata/RHSA-2017-0933.html"},
+		{Source: "RHSA", RefID: "RHSA-2017:0934"},
+	}
+	template := func(id string) string { return "https://access.redhat.com/errata/" + id }
+	tests := []struct {
+		name     string
+		id       string
+		template func(string) string
+		want     string
+	}{
+		{name: "reference wins over template", id: "RHSA-2017:0933", template: template, want: "https://rhn.redhat.com/errata/RHSA-2017-0933.html"},
+		{name: "reference case-insensitive", id: "rhsa-2017:0933", want: "https://rhn.redhat.com/errata/RHSA-2017-0933.html"},
+		{name: "reference without URL", id: "RHSA-2017:0934", template: template, want: "https://access.redhat.com/errata/RHSA-2017:0934"},
+		{name: "template", id: "RHBA-2019:1992", template: template, want: "https://access.redhat.com/errata/RHBA-2019:1992"},
+		{name: "no template", id: "RHBA-2019:1992"},
+		{name: "no ID", template: template},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AdvisoryURL(tt.id, refs, tt.template); got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYearRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    YearRange
+		wantErr bool
+	}{
+		{in: "", want: YearRange{}},
+		{in: "2015-2018", want: YearRange{From: 2015, To: 2018}},
+		{in: " 2015 - 2018 ", want: YearRange{From: 2015, To: 2018}},
+		{in: "2015-", want: YearRange{From: 2015}},
+		{in: "-2018", want: YearRange{To: 2018}},
+		{in: "2015", want: YearRange{From: 2015, To: 2015}},
+		{in: "2018-2015", wantErr: true},
+		{in: "2015,2018", wantErr: true},
+		{in: "0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseYearRange(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got: %+v, want: %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestYearRangeContains(t *testing.T) {
+	r := YearRange{From: 2015, To: 2018}
+	tests := []struct {
+		in   time.Time
+		want bool
+	}{
+		{in: time.Date(2014, time.December, 31, 0, 0, 0, 0, time.UTC), want: false},
+		{in: time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC), want: true},
+		{in: time.Date(2018, time.December, 31, 0, 0, 0, 0, time.UTC), want: true},
+		{in: time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC), want: false},
+		{in: ParsedOrDefaultTime([]string{"2006-01-02"}, ""), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in.String(), func(t *testing.T) {
+			if got := r.Contains(tt.in); got != tt.want {
+				t.Errorf("got: %t, want: %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCves(t *testing.T) {
+	tests := []struct {
+		name           string
+		in             []models.Cve
+		want           []models.Cve
+		wantRefs       []models.Reference
+		wantNormalized int
+		wantRerouted   int
+	}{
+		{
+			name: "valid",
+			in:   []models.Cve{{CveID: "CVE-2016-1234", Href: "https://access.redhat.com/security/cve/CVE-2016-1234", Impact: "Important"}, {CveID: "CVE-2021-1000158"}},
+			want: []models.Cve{{CveID: "CVE-2016-1234", Href: "https://access.redhat.com/security/cve/CVE-2016-1234", Impact: "Important"}, {CveID: "CVE-2021-1000158"}},
+		},
+		{
+			name:           "lowercase",
+			in:             []models.Cve{{CveID: " cve-2015-0001"}},
+			want:           []models.Cve{{CveID: "CVE-2015-0001"}},
+			wantNormalized: 1,
+		},
+		{
+			name:           "several IDs",
+			in:             []models.Cve{{CveID: "CVE-2016-1234 CVE-2016-5678,cve-2016-9012", Href: "https://www.suse.com/security/cve/CVE-2016-5678/", Impact: "moderate"}},
+			want:           []models.Cve{{CveID: "CVE-2016-1234", Impact: "moderate"}, {CveID: "CVE-2016-5678", Href: "https://www.suse.com/security/cve/CVE-2016-5678/", Impact: "moderate"}, {CveID: "CVE-2016-9012", Impact: "moderate"}},
+			wantNormalized: 3,
+		},
+		{
+			name:           "duplicate",
+			in:             []models.Cve{{CveID: "CVE-2016-1234 CVE-2016-5678"}, {CveID: "CVE-2016-5678", Href: "https://security-tracker.debian.org/tracker/CVE-2016-5678"}},
+			want:           []models.Cve{{CveID: "CVE-2016-1234"}, {CveID: "CVE-2016-5678", Href: "https://security-tracker.debian.org/tracker/CVE-2016-5678"}},
+			wantNormalized: 2,
+		},
+		{
+			name: "not CVE",
+			in:   []models.Cve{{CveID: "TEMP-0000000-1A2B3C", Href: "https://security-tracker.debian.org/tracker/TEMP-0000000-1A2B3C"}, {CveID: "XSA-123 CVE-2016-1234"}, {CveID: "CVE-2016-12"}, {CveID: " "}},
+			want: []models.Cve{{CveID: "CVE-2016-1234"}},
+			wantRefs: []models.Reference{
+				{Source: "CVE", RefID: "TEMP-0000000-1A2B3C", RefURL: "https://security-tracker.debian.org/tracker/TEMP-0000000-1A2B3C"},
+				{Source: "CVE", RefID: "XSA-123"},
+				{Source: "CVE", RefID: "CVE-2016-12"},
+			},
+			wantNormalized: 1,
+			wantRerouted:   3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stat models.ConvertStat
+			got, refs := NormalizeCves(tt.in, &stat)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got: %+v, want: %+v", got, tt.want)
+			}
+			if tt.wantRefs == nil {
+				tt.wantRefs = []models.Reference{}
+			}
+			if !reflect.DeepEqual(refs, tt.wantRefs) {
+				t.Errorf("got: %+v, want: %+v", refs, tt.wantRefs)
+			}
+			if stat.CvesNormalized != tt.wantNormalized || stat.CvesRerouted != tt.wantRerouted {
+				t.Errorf("got: %d normalized, %d rerouted, want: %d, %d", stat.CvesNormalized, stat.CvesRerouted, tt.wantNormalized, tt.wantRerouted)
+			}
+		})
+	}
+}
+
+func TestDefinitionID(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		title       string
+		want        string
+		wantDerived int
+	}{
+		{
+			name:  "ID",
+			id:    " oval:com.redhat.rhsa:def:20170933 ",
+			title: "RHSA-2017:0933: kernel security update (Important)",
+			want:  "oval:com.redhat.rhsa:def:20170933",
+		},
+		{
+			name:        "no ID",
+			title:       " RHSA-2017:0933: kernel security update (Important)\n",
+			want:        "no-id:RHSA-2017:0933: kernel security update (Important)",
+			wantDerived: 1,
+		},
+		{
+			name:        "no ID nor title",
+			id:          " ",
+			want:        "",
+			wantDerived: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stat models.ConvertStat
+			if got := DefinitionID(tt.id, tt.title, &stat); got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+			if stat.IDsDerived != tt.wantDerived {
+				t.Errorf("got: %d derived, want: %d", stat.IDsDerived, tt.wantDerived)
+			}
+		})
+	}
+}
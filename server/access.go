@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/xerrors"
+)
+
+// latencyBuckets are the upper bounds of the buckets of the latencies of the requests, logged by the access log
+var latencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// latencyBucket returns the label of the smallest bucket of latencyBuckets the latency falls in, e.g. "100ms", or "+Inf" beyond all of them
+func latencyBucket(latency time.Duration) string {
+	for _, b := range latencyBuckets {
+		if latency <= b {
+			return b.String()
+		}
+	}
+	return "+Inf"
+}
+
+// accessLog logs a line per request in the format of the other logs with the method, the path, the family, the release and the package
+// of the route if any, the status, the bytes of the body before compressed and the latency, as Error if the status is 5xx.
+// The errors are handled inside, so that their status is logged.
+func accessLog() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			latency := time.Since(start)
+
+			req, res := c.Request(), c.Response()
+			ctx := []interface{}{"Method", req.Method, "Path", req.URL.Path, "Route", c.Path()}
+			for _, p := range []struct{ key, param string }{{"Family", "family"}, {"Release", "release"}, {"Package", "pack"}, {"CVE", "id"}, {"CPE", "cpe"}} {
+				v, err := pathParam(c, p.param)
+				if err != nil {
+					v = c.Param(p.param)
+				}
+				if v != "" {
+					ctx = append(ctx, p.key, v)
+				}
+			}
+			if name, ok := c.Get(authNameKey).(string); ok {
+				ctx = append(ctx, "Auth", name)
+			}
+			ctx = append(ctx, "Status", res.Status, "Bytes", res.Size, "Latency", latency, "LatencyBucket", latencyBucket(latency), "RemoteIP", c.RealIP())
+			if res.Status >= http.StatusInternalServerError {
+				log15.Error("Access", ctx...)
+			} else {
+				log15.Info("Access", ctx...)
+			}
+			return nil
+		}
+	}
+}
+
+// recoverPanic recovers the panics of the handlers, logging them with the stack and responding 500, instead of killing the server
+func recoverPanic() echo.MiddlewareFunc {
+	return middleware.RecoverWithConfig(middleware.RecoverConfig{
+		DisableStackAll: true,
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			log15.Error("Recovered from panic", "Method", c.Request().Method, "Path", c.Request().URL.Path, "err", err, "stack", string(stack))
+			return xerrors.Errorf("Recovered from panic. err: %w", err)
+		},
+	})
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/xerrors"
+)
+
+// authNameKey is the key of the name of the token authenticating the request in echo.Context, logged by the access log
+const authNameKey = "authName"
+
+// authToken is a token allowed by --auth-token or --auth-tokens-file, named to tell the clients in the access log without the token
+type authToken struct {
+	name string
+	sum  [sha256.Size]byte
+}
+
+// loadAuthTokens returns the tokens of --auth-token named "default" and of the lines of "name:token" in --auth-tokens-file, where the blank lines
+// and the ones starting with "#" are ignored, and none if neither is given
+func loadAuthTokens(token, path string) ([]authToken, error) {
+	var tokens []authToken
+	if token != "" {
+		tokens = append(tokens, authToken{name: "default", sum: sha256.Sum256([]byte(token))})
+	}
+	if path == "" {
+		return tokens, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to open --auth-tokens-file. err: %w", err)
+	}
+	defer f.Close()
+	names := map[string]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, token, ok := strings.Cut(line, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !ok || name == "" || token == "" {
+			return nil, xerrors.Errorf("Failed to parse --auth-tokens-file, expected name:token. path: %s, line: %d", path, n)
+		}
+		if _, ok := names[name]; ok {
+			return nil, xerrors.Errorf("Failed to parse --auth-tokens-file, duplicate name. path: %s, line: %d, name: %s", path, n, name)
+		}
+		names[name] = struct{}{}
+		tokens = append(tokens, authToken{name: name, sum: sha256.Sum256([]byte(token))})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, xerrors.Errorf("Failed to read --auth-tokens-file. err: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, xerrors.Errorf("Failed to load --auth-tokens-file, no token. path: %s", path)
+	}
+	return tokens, nil
+}
+
+// authenticate responds 401 to the requests without the bearer token of tokens in Authorization, except /health for the load balancer.
+// The token is compared with every one of tokens in constant time in SHA-256, not to tell how much of it or its length matches.
+func authenticate(tokens []authToken) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Path() == "/health" {
+				return next(c)
+			}
+
+			scheme, token, _ := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " ")
+			sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+			name := ""
+			for _, t := range tokens {
+				if subtle.ConstantTimeCompare(sum[:], t.sum[:]) == 1 {
+					name = t.name
+				}
+			}
+			if !strings.EqualFold(scheme, "Bearer") || token == "" || name == "" {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return c.JSON(http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+			}
+			c.Set(authNameKey, name)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vulsio/goval-dictionary/metrics"
+)
+
+// cacheLookups counts the hits and the misses of the caches of the server by their name for /metrics, as cacheStats does for expvar
+var cacheLookups = metrics.Default.NewCounter("goval_dictionary_cache_lookups_total", "The lookups of the caches of the server by the cache and the result, hit or miss.", "cache", "result")
+
+// countCache counts the hit or the miss of the cache of name in cacheStats and cacheLookups
+func countCache(name string, hit bool) {
+	if hit {
+		cacheStats.Add(name+"Hits", 1)
+		cacheLookups.Inc(name, "hit")
+		return
+	}
+	cacheStats.Add(name+"Misses", 1)
+	cacheLookups.Inc(name, "miss")
+}
+
+// cache caches the value loaded from DB for ttl, e.g. of the aggregate queries, not to query DB on every request.
+// ttl is read on every get, so that the tests change it. The errors are not cached. The hits and the misses are counted in cacheStats by name.
+type cache[T any] struct {
+	name string
+	ttl  *time.Duration
+	load func() (T, error)
+
+	mu       sync.Mutex
+	loaded   bool
+	loadedAt time.Time
+	value    T
+}
+
+// get returns the cached value, or the one loaded again if expired, serializing the loads
+func (c *cache[T]) get() (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.loaded && time.Since(c.loadedAt) < *c.ttl {
+		countCache(c.name, true)
+		return c.value, nil
+	}
+	countCache(c.name, false)
+	v, err := c.load()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	c.value, c.loaded, c.loadedAt = v, true, time.Now()
+	return v, nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/labstack/echo/v4"
+
+	"github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// validators returns Last-Modified and the weak ETag of the lookups of the OVAL of family and release, false if it is not stored.
+// The ETag is of the SHA-256 of the fetched OVAL files, which stays the same over the fetches of the unchanged OVAL unlike the timestamp,
+// or of the timestamp if unknown, of the digest of the binary and the options it was converted by, e.g. refreshed by --force with another
+// --no-details, and of the revision of the server, whose responses may differ.
+func validators(roots []models.RootTimestamp, family, release string) (time.Time, string, bool) {
+	family, release, err := db.FormatFamilyAndOSVer(family, release)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	for _, r := range roots {
+		if r.Family != family || r.OSVersion != release {
+			continue
+		}
+		version := r.SHA256
+		if version == "" {
+			version = r.Timestamp.UTC().Format(time.RFC3339Nano)
+		}
+		sum := sha256.Sum256([]byte(strings.Join([]string{config.Revision, r.Family, r.OSVersion, version, r.ConvertDigest}, "\n")))
+		return r.Timestamp, `W/"` + hex.EncodeToString(sum[:16]) + `"`, true
+	}
+	return time.Time{}, "", false
+}
+
+// notModified sets Last-Modified and ETag of the OVAL of family and release from the cached timestamps, and reports whether the request is
+// conditional on them and they match, to respond 304 without querying DB. It reports false, responding in full, if the timestamps fail.
+func notModified(c echo.Context, fresh *cache[[]models.RootTimestamp], family, release string) bool {
+	roots, err := fresh.get()
+	if err != nil {
+		log15.Error("Failed to get the timestamps of OVAL", "err", err)
+		return false
+	}
+	lastModified, etag, ok := validators(roots, family, release)
+	if !ok {
+		return false
+	}
+	h := c.Response().Header()
+	h.Set(echo.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	h.Set("ETag", etag)
+
+	// If-None-Match takes precedence over If-Modified-Since, as in RFC 7232
+	req := c.Request()
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, etag)
+	}
+	if ims, err := http.ParseTime(req.Header.Get(echo.HeaderIfModifiedSince)); err == nil {
+		return !lastModified.Truncate(time.Second).After(ims)
+	}
+	return false
+}
+
+// etagMatch reports whether the ETags of If-None-Match match etag in the weak comparison, i.e. regardless of W/, or it is "*"
+func etagMatch(inm, etag string) bool {
+	for _, t := range strings.Split(inm, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
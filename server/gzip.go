@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/xerrors"
+)
+
+// gzipMinLength is the length of the body from which the response is compressed, the smaller ones are not worth the overhead of gzip
+var gzipMinLength = 1024
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// gzipResponse compresses the responses in gzip for the clients accepting it, e.g. the definitions of kernel of several MB.
+// The errors are handled inside, so that the error responses are also compressed and the response is complete when it returns.
+func gzipResponse() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			res := c.Response()
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+			if !acceptsGzip(c.Request()) {
+				return next(c)
+			}
+
+			w := &gzipResponseWriter{ResponseWriter: res.Writer, status: http.StatusOK}
+			res.Writer = w
+			defer func() { res.Writer = w.ResponseWriter }()
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			if err := w.close(); err != nil {
+				return xerrors.Errorf("Failed to write gzip response. err: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
+// acceptsGzip reports whether Accept-Encoding of req accepts gzip, which is not if its q is 0
+func acceptsGzip(req *http.Request) bool {
+	for _, enc := range strings.Split(req.Header.Get(echo.HeaderAcceptEncoding), ",") {
+		coding, params, _ := strings.Cut(enc, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if q, err := strconv.ParseFloat(v, 64); strings.EqualFold(k, "q") && err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the body until gzipMinLength, then compresses it and the rest, or writes it as it is at close if shorter
+type gzipResponseWriter struct {
+	http.ResponseWriter
+
+	status      int
+	wroteHeader bool
+	buf         []byte
+	gz          *gzip.Writer
+	plain       bool
+}
+
+// WriteHeader holds the status until it is decided whether the body is compressed
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	w.status, w.wroteHeader = code, true
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(b)
+	case w.plain:
+		return w.ResponseWriter.Write(b)
+	}
+	w.wroteHeader = true
+	w.buf = append(w.buf, b...)
+	if len(w.buf) < gzipMinLength {
+		return len(b), nil
+	}
+	if err := w.startGzip(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// startGzip writes the header with Content-Encoding and the buffered body compressed, unless the handler encoded it by itself
+func (w *gzipResponseWriter) startGzip() error {
+	h := w.Header()
+	if h.Get(echo.HeaderContentEncoding) != "" || w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return w.writePlain()
+	}
+	h.Set(echo.HeaderContentEncoding, "gzip")
+	h.Del(echo.HeaderContentLength)
+	w.ResponseWriter.WriteHeader(w.status)
+
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+	buf := w.buf
+	w.buf = nil
+	if _, err := w.gz.Write(buf); err != nil {
+		return xerrors.Errorf("Failed to compress response. err: %w", err)
+	}
+	return nil
+}
+
+// writePlain writes the header and the buffered body as they are, and the rest of the body is passed through
+func (w *gzipResponseWriter) writePlain() error {
+	w.plain = true
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if _, err := w.ResponseWriter.Write(buf); err != nil {
+		return xerrors.Errorf("Failed to write response. err: %w", err)
+	}
+	return nil
+}
+
+// close flushes the compressed body, or writes the body shorter than gzipMinLength as it is, and nothing if no response is written
+func (w *gzipResponseWriter) close() error {
+	switch {
+	case w.gz != nil:
+		defer gzipWriters.Put(w.gz)
+		if err := w.gz.Close(); err != nil {
+			return xerrors.Errorf("Failed to close gzip writer. err: %w", err)
+		}
+		return nil
+	case w.plain, !w.wroteHeader:
+		return nil
+	default:
+		return w.writePlain()
+	}
+}
+
+// Flush sends the body written so far, as it is if it is still shorter than gzipMinLength
+func (w *gzipResponseWriter) Flush() {
+	switch {
+	case w.gz != nil:
+		_ = w.gz.Flush()
+	case !w.plain:
+		_ = w.writePlain()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the connection of the underlying writer, e.g. for the websocket
+func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, xerrors.New("ResponseWriter does not implement http.Hijacker")
+	}
+	return h.Hijack()
+}
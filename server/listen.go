@@ -0,0 +1,141 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/exp/slices"
+	"golang.org/x/xerrors"
+)
+
+// the schemes of the addresses of --listen, where the address without the scheme is of TCP
+const (
+	unixScheme = "unix://"
+	tcpScheme  = "tcp://"
+)
+
+// listenAddr is an address listened on, of the network of net.Listen, i.e. "tcp" or "unix"
+type listenAddr struct {
+	network string
+	address string
+}
+
+// listenAddrs returns the addresses of --listen, comma-separated unix:///path/to/socket and tcp://host:port or host:port, e.g. [::1]:1324,
+// or else the TCP one of --bind and --port, whose IPv6 address is either bare or bracketed, e.g. :: or [::]
+func listenAddrs(listen, bind, port string) ([]listenAddr, error) {
+	if strings.TrimSpace(listen) == "" {
+		host := strings.TrimSuffix(strings.TrimPrefix(bind, "["), "]")
+		return []listenAddr{{network: "tcp", address: net.JoinHostPort(host, port)}}, nil
+	}
+
+	var addrs []listenAddr
+	for _, s := range strings.Split(listen, ",") {
+		s = strings.TrimSpace(s)
+		a := listenAddr{network: "tcp", address: strings.TrimPrefix(s, tcpScheme)}
+		if strings.HasPrefix(s, unixScheme) {
+			path, err := socketPath(s)
+			if err != nil {
+				return nil, err
+			}
+			a = listenAddr{network: "unix", address: path}
+		} else if _, _, err := net.SplitHostPort(a.address); err != nil || a.address == "" {
+			return nil, xerrors.Errorf("Failed to parse --listen. err: %q is neither unix:///path/to/socket nor tcp://host:port, e.g. tcp://[::1]:1324", s)
+		}
+		if slices.Contains(addrs, a) {
+			return nil, xerrors.Errorf("Failed to parse --listen. err: %q is duplicated", s)
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs, nil
+}
+
+// socketPath returns the path of the socket of --listen, e.g. /var/run/goval-dictionary.sock of unix:///var/run/goval-dictionary.sock
+func socketPath(listen string) (string, error) {
+	path, ok := strings.CutPrefix(listen, unixScheme)
+	if !ok || path == "" {
+		return "", xerrors.Errorf("Failed to parse --listen. err: %q is not unix:///path/to/socket", listen)
+	}
+	return path, nil
+}
+
+// listenAll listens on addrs, the sockets with the permissions of socketMode, closing the ones listened on if any of them fails
+func listenAll(addrs []listenAddr, socketMode string) ([]net.Listener, error) {
+	var ls []net.Listener
+	closeAll := func() {
+		for _, l := range ls {
+			_ = l.Close()
+		}
+	}
+	for _, a := range addrs {
+		if a.network == "unix" {
+			mode, err := parseSocketMode(socketMode)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			l, err := listenUnix(a.address, mode)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			ls = append(ls, l)
+			continue
+		}
+		l, err := net.Listen(a.network, a.address)
+		if err != nil {
+			closeAll()
+			return nil, xerrors.Errorf("Failed to listen. address: %s, err: %w", a.address, err)
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
+
+// listenURL returns the URL of the address listened on by l, e.g. tcp://[::1]:1324 with the port resolved for :0, or unix:///path/to/socket
+func listenURL(l net.Listener) string {
+	if l.Addr().Network() == "unix" {
+		return unixScheme + l.Addr().String()
+	}
+	return tcpScheme + l.Addr().String()
+}
+
+// parseSocketMode parses the permissions of the socket in octal, e.g. 0660
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, xerrors.Errorf("Failed to parse --socket-mode. err: %q is not the permissions in octal, e.g. 0660", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// listenUnix listens on the socket of path with the permissions of mode, removing the stale socket nobody listens on,
+// e.g. left by the server killed. The socket is removed when the listener is closed.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, xerrors.Errorf("Failed to listen on socket. path: %s, err: not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = conn.Close()
+			return nil, xerrors.Errorf("Failed to listen on socket. path: %s, err: another server is listening on it", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, xerrors.Errorf("Failed to remove stale socket. path: %s, err: %w", path, err)
+		}
+		log15.Info("Removed stale socket", "Path", path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to listen on socket. path: %s, err: %w", path, err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		_ = l.Close()
+		return nil, xerrors.Errorf("Failed to chmod socket. path: %s, mode: %04o, err: %w", path, mode, err)
+	}
+	return l, nil
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+// packKey is the key of the lookups of a package cached by packCache, of the parameters normalized by lookupParams, e.g. redhat of centos
+// and 12 of bookworm, so that the same query in another form hits as well
+type packKey struct {
+	family  string
+	release string
+	pack    string
+	arch    string
+	classes string
+	page    db.Page
+	omit    db.Omit
+	// collapse of the packages of more than one arch, as the lookup of the same other keys returns the packages apart if not
+	collapse bool
+}
+
+// packResult is the result of a lookup of a package cached by packCache
+type packResult struct {
+	defs  []models.Definition
+	total int64
+}
+
+type packEntry struct {
+	key     packKey
+	result  packResult
+	expires time.Time
+}
+
+// packCache is the LRU cache of the lookups of the packages, e.g. of the same packages of the hosts of a fleet looked up again and again,
+// keeping size entries at most for ttl each. It is dropped wholesale once the timestamp of the OVAL of the family and the release looked up
+// changes in fresh, i.e. the OVAL is refreshed, checked lazily on get. The errors are not cached. The hits and the misses are counted as packs.
+type packCache struct {
+	size  int
+	ttl   time.Duration
+	fresh *cache[[]models.RootTimestamp]
+	now   func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[packKey]*list.Element
+	// stamps are the timestamps of the OVAL of the family and the release of the entries when they were loaded
+	stamps map[[2]string]time.Time
+}
+
+// newPackCache returns the cache of size entries at most for ttl each, dropped once the timestamps of fresh change
+func newPackCache(size int, ttl time.Duration, fresh *cache[[]models.RootTimestamp]) *packCache {
+	return &packCache{
+		size:    size,
+		ttl:     ttl,
+		fresh:   fresh,
+		now:     time.Now,
+		lru:     list.New(),
+		entries: map[packKey]*list.Element{},
+		stamps:  map[[2]string]time.Time{},
+	}
+}
+
+// lookup returns the cached result of key, or the one of load cached unless it fails. Without the cache, e.g. of --pack-cache-size 0,
+// or if the timestamps fail, it returns the one of load as it is.
+func (c *packCache) lookup(key packKey, load func() (packResult, error)) (packResult, error) {
+	if c == nil {
+		return load()
+	}
+	roots, err := c.fresh.get()
+	if err != nil {
+		return load()
+	}
+	stamp, _ := rootTimestamp(roots, key.family, key.release)
+	if result, ok := c.get(key, stamp); ok {
+		return result, nil
+	}
+	result, err := load()
+	if err != nil {
+		return packResult{}, err
+	}
+	c.put(key, stamp, result)
+	return result, nil
+}
+
+// get returns the cached result of key, dropping the cache first if stamp, the timestamp of the OVAL of key, has changed since cached
+func (c *packCache) get(key packKey, stamp time.Time) (packResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fr := [2]string{key.family, key.release}
+	if old, ok := c.stamps[fr]; ok && !old.Equal(stamp) {
+		c.lru.Init()
+		c.entries = map[packKey]*list.Element{}
+		c.stamps = map[[2]string]time.Time{}
+	}
+	c.stamps[fr] = stamp
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*packEntry)
+		if c.now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			countCache("packs", true)
+			return e.result, true
+		}
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+	countCache("packs", false)
+	return packResult{}, false
+}
+
+// put caches result of key loaded at stamp, unless the OVAL has been refreshed since, evicting the least recently used one over size
+func (c *packCache) put(key packKey, stamp time.Time, result packResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cur, ok := c.stamps[[2]string{key.family, key.release}]; !ok || !cur.Equal(stamp) {
+		return
+	}
+	e := &packEntry{key: key, result: result, expires: c.now().Add(c.ttl)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*packEntry).key)
+	}
+}
+
+// rootTimestamp returns the timestamp of the OVAL of family and release in roots, false if it is not stored
+func rootTimestamp(roots []models.RootTimestamp, family, release string) (time.Time, bool) {
+	family, release, err := db.FormatFamilyAndOSVer(family, release)
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, r := range roots {
+		if r.Family == family && r.OSVersion == release {
+			return r.Timestamp, true
+		}
+	}
+	return time.Time{}, false
+}
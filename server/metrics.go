@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/labstack/echo/v4"
+
+	"github.com/vulsio/goval-dictionary/metrics"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+var (
+	requests        = metrics.Default.NewCounter("goval_dictionary_http_requests_total", "The requests by the method, the route and the status.", "method", "route", "status")
+	requestDuration = metrics.Default.NewHistogram("goval_dictionary_http_request_duration_seconds", "The latencies of the requests by the method, the route and the status.", metrics.DefaultBuckets, "method", "route", "status")
+	definitions     = metrics.Default.NewGauge("goval_dictionary_definitions", "The definitions of the stored OVAL by the family and the release.", "family", "release")
+	ovalAge         = metrics.Default.NewGauge("goval_dictionary_oval_age_seconds", "The seconds since the stored OVAL was fetched by the family and the release.", "family", "release")
+)
+
+// instrument counts the requests and observes their latencies by the route, e.g. /packs/:family/:release/:pack, rather than the path,
+// not to make a series per package. The errors are handled inside, so that their status is counted.
+func instrument() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			method, status := c.Request().Method, strconv.Itoa(c.Response().Status)
+			requests.Inc(method, route, status)
+			requestDuration.Observe(time.Since(start).Seconds(), method, route, status)
+			return nil
+		}
+	}
+}
+
+// getMetrics responds the metrics to the scrapes of Prometheus, setting the gauges of the stored OVAL from the cached stats and timestamps,
+// which keep the last ones if DB fails
+func getMetrics(stats *cache[[]models.RootStat], fresh *cache[[]models.RootTimestamp]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if ss, err := stats.get(); err != nil {
+			log15.Error("Failed to count OVAL defs.", "err", err)
+		} else {
+			definitions.Reset()
+			for _, s := range ss {
+				definitions.Set(float64(s.Definitions), s.Family, s.OSVersion)
+			}
+		}
+		if roots, err := fresh.get(); err != nil {
+			log15.Error("Failed to get the timestamps of OVAL", "err", err)
+		} else {
+			ovalAge.Reset()
+			for _, r := range roots {
+				ovalAge.Set(time.Since(r.Timestamp).Seconds(), r.Family, r.OSVersion)
+			}
+		}
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, metrics.ContentType)
+		res.WriteHeader(http.StatusOK)
+		return metrics.Default.Write(res)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+)
+
+// cacheStats counts the hits and the misses of the caches of the server by their name, e.g. rootStatsHits, published as server.cache
+var cacheStats = expvar.NewMap("server.cache")
+
+// newProfileHandler returns the handler of pprof and expvar under /debug, on its own mux rather than http.DefaultServeMux,
+// which the imports of net/http/pprof and expvar register them on but the server never serves
+func newProfileHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// startProfiler serves pprof and expvar on addr of --profile apart from the lookups until ctx is canceled,
+// returning its listener, or nil if addr is empty, as it is by default
+func startProfiler(ctx context.Context, addr string) (net.Listener, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to listen for --profile. addr: %s, err: %w", addr, err)
+	}
+	s := &http.Server{Handler: newProfileHandler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = s.Close()
+	}()
+	go func() {
+		if err := s.Serve(l); err != nil && !xerrors.Is(err, http.ErrServerClosed) {
+			log15.Error("Failed to serve --profile", "err", err)
+		}
+	}()
+	log15.Warn("Serving pprof and expvar, which expose the internals of the server, not to be reachable by the clients", "URL", "http://"+l.Addr().String()+"/debug/pprof/")
+	return l, nil
+}
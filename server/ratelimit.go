@@ -0,0 +1,107 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// rateLimiter limits the requests of each client to rate per second with up to burst at once, in the token bucket of the client.
+// The clients idle until their buckets are full again are evicted, as they are the same as the new ones, so that the clients are
+// only the ones requesting recently however many have ever requested.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	idle  time.Duration
+	now   func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket is the tokens of a client at last, each of which allows a request
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns the limiter of rate per second and burst, which is the rate rounded up, at least 1, if not positive
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	idle := time.Duration(float64(burst) / rate * float64(time.Second))
+	if idle < time.Second {
+		idle = time.Second
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), idle: idle, now: time.Now, clients: map[string]*bucket{}}
+}
+
+// allow reports whether the request of client is allowed, taking a token of its bucket, or else how long until the next token
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= l.idle {
+		l.sweep(now)
+	}
+	b, ok := l.clients[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.clients[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep evicts the clients idle for l.idle, whose buckets are full again
+func (l *rateLimiter) sweep(now time.Time) {
+	for client, b := range l.clients {
+		if now.Sub(b.last) >= l.idle {
+			delete(l.clients, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// rateLimit responds 429 with Retry-After in seconds to the requests of the client over the limit, told by the IP of c.RealIP,
+// except /health not to take the server out of the load balancer probing it
+func rateLimit(l *rateLimiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Path() == "/health" {
+				return next(c)
+			}
+			client := c.RealIP()
+			ok, wait := l.allow(client)
+			if ok {
+				return next(c)
+			}
+			log15.Debug("Rate limited", "RemoteIP", client, "RetryAfter", wait)
+			c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return c.JSON(http.StatusTooManyRequests, errorResponse{Error: "rate limit exceeded"})
+		}
+	}
+}
+
+// ipExtractor returns how the IP of the client is told, from X-Forwarded-For set by the proxies in the loopback and the private networks
+// with --trust-proxy-headers, or else from the connection, which the client cannot forge
+func ipExtractor() echo.IPExtractor {
+	if viper.GetBool("trust-proxy-headers") {
+		return echo.ExtractIPFromXFFHeader()
+	}
+	return echo.ExtractIPDirect()
+}
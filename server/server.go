@@ -1,126 +1,891 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/inconshreveable/log15"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
 	"golang.org/x/xerrors"
 
+	"github.com/vulsio/goval-dictionary/config"
 	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/models"
 )
 
-// Start starts CVE dictionary HTTP Server.
-func Start(logToFile bool, logDir string, driver db.DB) error {
-	e := echo.New()
+// Start starts CVE dictionary HTTP Server until ctx is canceled. lastRefresh returns the result of the last refresh of the OVAL reported by /health, nil if not refreshing.
+func Start(ctx context.Context, driver db.DB, lastRefresh func() *Refresh) error {
+	tlsConfig, err := newTLSConfig(viper.GetString("tls-cert"), viper.GetString("tls-key"), viper.GetString("tls-client-ca"))
+	if err != nil {
+		return err
+	}
+
+	// canceling ctx, e.g. by SIGINT/SIGTERM, shuts the server down gracefully, and closing the listener removes the socket
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if _, err := startProfiler(ctx, viper.GetString("profile")); err != nil {
+		return err
+	}
+
+	e, err := newEcho(driver, lastRefresh)
+	if err != nil {
+		return err
+	}
 	e.Debug = viper.GetBool("debug")
+	// stdout is reserved for the data, so neither the banner nor the port is printed, "Listening..." is logged instead
+	e.HideBanner = true
+	e.HidePort = true
 
-	// Middleware
-	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{Output: os.Stderr}))
-	e.Use(middleware.Recover())
+	addrs, err := listenAddrs(viper.GetString("listen"), viper.GetString("bind"), viper.GetString("port"))
+	if err != nil {
+		return err
+	}
+	listeners, err := listenAll(addrs, viper.GetString("socket-mode"))
+	if err != nil {
+		return err
+	}
 
-	// setup access logger
-	if logToFile {
-		logPath := filepath.Join(logDir, "access.log")
-		f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			return xerrors.Errorf("Failed to open a log file. err: %w", err)
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdown <- shutdownServer(e, viper.GetDuration("shutdown-timeout"))
+	}()
+
+	// the listeners are served by the same server, so that the shutdown stops all of them
+	srv := e.Server
+	if tlsConfig != nil {
+		srv = e.TLSServer
+		srv.TLSConfig = tlsConfig
+	}
+	srv.Handler, srv.ErrorLog = e, e.StdLogger
+	served := make(chan error, len(listeners))
+	for _, l := range listeners {
+		if tlsConfig != nil {
+			log15.Info("Listening...", "URL", listenURL(l), "TLS", true, "ClientAuth", tlsConfig.ClientCAs != nil)
+			l = tls.NewListener(l, tlsConfig)
+		} else {
+			log15.Info("Listening...", "URL", listenURL(l))
+		}
+		go func(l net.Listener) { served <- srv.Serve(l) }(l)
+	}
+
+	// Serve returns as soon as the shutdown starts, which waits for the requests in progress, or on the failure of the listener,
+	// which shuts the others down
+	var serveErr error
+	for range listeners {
+		if err := <-served; !xerrors.Is(err, http.ErrServerClosed) && serveErr == nil {
+			serveErr = xerrors.Errorf("Failed to serve. err: %w", err)
+			cancel()
 		}
-		defer f.Close()
-		e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{Output: f}))
 	}
+	if err := <-shutdown; serveErr == nil {
+		return err
+	}
+	return serveErr
+}
+
+// shutdownServer stops accepting the connections and waits for the requests in progress to finish up to timeout,
+// after which it closes the connections left and returns the error wrapping context.DeadlineExceeded
+func shutdownServer(e *echo.Echo, timeout time.Duration) error {
+	log15.Info("Shutting down the server...", "Timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		_ = e.Close()
+		return xerrors.Errorf("Failed to shut down the server in --shutdown-timeout, closed the connections of the requests in progress. err: %w", err)
+	}
+	log15.Info("Shut down the server")
+	return nil
+}
+
+// NewHandler returns the handler of the routes of the lookups in driver configured by the flags of the server, as Start serves them,
+// e.g. for the tests of the clients to run the real server in httptest
+func NewHandler(driver db.DB) (http.Handler, error) {
+	return newEcho(driver, nil)
+}
+
+// newEcho returns the server with the routes of the lookups in driver, failing if the tokens of --auth-tokens-file fail to load
+func newEcho(driver db.DB, lastRefresh func() *Refresh) (*echo.Echo, error) {
+	tokens, err := loadAuthTokens(viper.GetString("auth-token"), viper.GetString("auth-tokens-file"))
+	if err != nil {
+		return nil, err
+	}
+
+	e := echo.New()
+	e.IPExtractor = ipExtractor()
+	// the access log and the recovery come first to log the responses of the others and recover their panics
+	if viper.GetBool("access-log") {
+		e.Use(accessLog())
+	}
+	if viper.GetBool("metrics") {
+		e.Use(instrument())
+	}
+	e.Use(recoverPanic())
+	if rate := viper.GetFloat64("rate-limit"); rate > 0 {
+		e.Use(rateLimit(newRateLimiter(rate, viper.GetInt("rate-burst"))))
+	}
+	if origins := corsAllowOrigins(); len(origins) > 0 {
+		e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+			AllowOrigins: origins,
+			AllowMethods: []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions},
+			AllowHeaders: []string{echo.HeaderAccept, echo.HeaderAcceptEncoding, echo.HeaderAuthorization, echo.HeaderContentType},
+		}))
+	}
+	// after CORS, which answers the preflight requests without Authorization
+	if len(tokens) > 0 {
+		e.Use(authenticate(tokens))
+	}
+	e.Use(gzipResponse())
 
 	// Routes
-	e.GET("/health", health())
-	e.GET("/packs/:family/:release/:pack/:arch", getByPackName(driver))
-	e.GET("/packs/:family/:release/:pack", getByPackName(driver))
-	e.GET("/cves/:family/:release/:id/:arch", getByCveID(driver))
-	e.GET("/cves/:family/:release/:id", getByCveID(driver))
-	e.GET("/count/:family/:release", countOvalDefs(driver))
+	stats := &cache[[]models.RootStat]{name: "rootStats", ttl: &statsTTL, load: driver.GetRootStats}
+	fresh := &cache[[]models.RootTimestamp]{name: "rootTimestamps", ttl: &freshnessTTL, load: driver.GetRootTimestamps}
+	var packs *packCache
+	if size := viper.GetInt("pack-cache-size"); size > 0 {
+		packs = newPackCache(size, viper.GetDuration("pack-cache-ttl"), fresh)
+	}
+	e.GET("/health", health(driver, fresh, lastRefresh))
+	e.GET("/packs/:family/:release/:pack/:arch", getByPackName(driver, fresh, packs))
+	e.GET("/packs/:family/:release/:pack", getByPackName(driver, fresh, packs))
+	e.POST("/packs/:family/:release", postPacks(driver))
+	e.GET("/cves/:family/:release/:id/:arch", getByCveID(driver, fresh))
+	e.GET("/cves/:family/:release/:id", getByCveID(driver, fresh))
+	e.GET("/cpes/:family/:release/:cpe/:arch", getByCpe(driver, fresh))
+	e.GET("/cpes/:family/:release/:cpe", getByCpe(driver, fresh))
+	e.GET("/advisories/:family/:release/:id/:arch", getByAdvisoryID(driver, fresh))
+	e.GET("/advisories/:family/:release/:id", getByAdvisoryID(driver, fresh))
+	e.GET("/packages/:family/:release", getPackages(driver, fresh))
+	e.GET("/history/:family/:release", getHistory(driver))
+	e.GET("/families", getFamilies(stats))
+	e.GET("/capabilities", getCapabilities(stats))
+	e.GET("/count/:family/:release", countOvalDefs(stats))
 	e.GET("/lastmodified/:family/:release", getLastModified(driver))
-	//  e.Post("/cpes", getByPackName(driver))
+	if viper.GetBool("metrics") {
+		e.GET("/metrics", getMetrics(stats, fresh))
+	}
+
+	return e, nil
+}
+
+// corsAllowOrigins returns the origins of --cors-allow-origins allowed to query the server from the browser, none if empty,
+// where "*" allows any origin only if given explicitly
+func corsAllowOrigins() []string {
+	var origins []string
+	for _, o := range strings.Split(viper.GetString("cors-allow-origins"), ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
+
+// errorResponse is the JSON body of the errors
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// lookupError responds 400 for the family not supported, 503 for the lookup timed out by --query-timeout, and 500 for the others
+func lookupError(c echo.Context, err error) error {
+	if xerrors.Is(err, db.ErrUnknownFamily) {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("unknown family: %s", c.Param("family"))})
+	}
+	if xerrors.Is(err, db.ErrQueryTimeout) || xerrors.Is(err, context.DeadlineExceeded) {
+		return c.JSON(http.StatusServiceUnavailable, errorResponse{Error: fmt.Sprintf("query timed out after %s", viper.GetDuration("query-timeout"))})
+	}
+	return c.JSON(http.StatusInternalServerError, errorResponse{Error: err.Error()})
+}
 
-	bindURL := fmt.Sprintf("%s:%s", viper.GetString("bind"), viper.GetString("port"))
-	log15.Info("Listening...", "URL", bindURL)
-	return e.Start(bindURL)
+// releaseWarning returns the warning of err of the lookup of the release not fetched into DB, responded with nothing found and the warning,
+// e.g. for the scanner to tell it from the release affected by nothing looked up, set to the Warning header as well for the responses
+// without the field of it, or err as is of the other errors
+func releaseWarning(c echo.Context, err error) (string, error) {
+	if !xerrors.Is(err, db.ErrNoSuchRelease) {
+		return "", err
+	}
+	log15.Warn("Looked up the release not fetched", "err", err)
+	c.Response().Header().Set("Warning", fmt.Sprintf("199 goval-dictionary %s", strconv.Quote(err.Error())))
+	return err.Error(), nil
+}
+
+// healthResponse is the JSON body of /health, with the version to tell which build is serving, the timestamps of the stored OVAL,
+// the last refresh if refreshing, and the report of the integrity of DB with ?deep=true
+type healthResponse struct {
+	Status      string      `json:"status"` // ok, or unavailable, stale, inconsistent or error responded with the error status
+	Version     string      `json:"version"`
+	Revision    string      `json:"revision"`
+	DBType      string      `json:"dbType"`
+	LastFetch   []LastFetch `json:"lastFetch,omitempty"`
+	LastRefresh *Refresh    `json:"lastRefresh,omitempty"`
+	Integrity   *db.Report  `json:"integrity,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// the statuses of /health
+const (
+	healthOK           = "ok"
+	healthUnavailable  = "unavailable"
+	healthStale        = "stale"
+	healthInconsistent = "inconsistent"
+	healthError        = "error"
+)
+
+// LastFetch is the timestamp of the stored OVAL of a family and a version, stale if older than --stale-age
+type LastFetch struct {
+	Family    string    `json:"family"`
+	OSVersion string    `json:"osVersion"`
+	Timestamp time.Time `json:"timestamp"`
+	Stale     bool      `json:"stale,omitempty"`
 }
 
+// Refresh is the result of a refresh of the OVAL in DB by the server refreshing it every interval
+type Refresh struct {
+	Count      int             `json:"count"` // the number of the refreshes since the start, including this one
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt time.Time       `json:"finishedAt"`
+	Status     string          `json:"status"`          // succeeded, or failed if the refresh or any of the families failed
+	Error      string          `json:"error,omitempty"` // the error failing the refresh before or across the families, e.g. of the config
+	Families   []RefreshFamily `json:"families"`
+}
+
+// RefreshFamily is the result of a family in a refresh
+type RefreshFamily struct {
+	Family string `json:"family"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// freshnessTTL is how long the timestamps of the stored OVAL are cached by /health and the cache validators of the lookups,
+// not to query DB on every probe and every request
+var freshnessTTL = 5 * time.Second
+
 // Handler
-func health() echo.HandlerFunc {
+// health responds 200, or 503 if DB is down, with ?strict=true if any OVAL of the families of ?family=, or of all if none, is older than --stale-age,
+// and with ?deep=true if the integrity check of DB finds any problem, 501 if the DB type does not support it, and 500 if it fails,
+// e.g. for the load balancer to take the server out and the monitoring to alert on the stale OVAL and the orphaned rows
+func health(driver db.DB, fresh *cache[[]models.RootTimestamp], lastRefresh func() *Refresh) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		return c.String(http.StatusOK, "")
+		res := healthResponse{Status: healthOK, Version: config.DisplayVersion(), Revision: config.Revision, DBType: driver.Name()}
+		if lastRefresh != nil {
+			res.LastRefresh = lastRefresh()
+		}
+
+		if err := driver.Ping(); err != nil {
+			log15.Error("Failed to ping DB", "err", err)
+			res.Status, res.Error = healthUnavailable, err.Error()
+			return c.JSON(http.StatusServiceUnavailable, res)
+		}
+		roots, err := fresh.get()
+		if err != nil {
+			log15.Error("Failed to get the timestamps of OVAL", "err", err)
+			res.Status, res.Error = healthUnavailable, err.Error()
+			return c.JSON(http.StatusServiceUnavailable, res)
+		}
+		staleAge, families := viper.GetDuration("stale-age"), c.QueryParams()["family"]
+		stale := false
+		for _, r := range roots {
+			f := LastFetch{Family: r.Family, OSVersion: r.OSVersion, Timestamp: r.Timestamp}
+			if staleAge > 0 && time.Since(r.Timestamp) > staleAge && (len(families) == 0 || slices.Contains(families, r.Family)) {
+				f.Stale, stale = true, true
+			}
+			res.LastFetch = append(res.LastFetch, f)
+		}
+
+		if c.QueryParam("deep") == "true" {
+			report, err := driver.CheckIntegrity()
+			if err != nil {
+				res.Error = err.Error()
+				if xerrors.Is(err, db.ErrNotSupported) {
+					return c.JSON(http.StatusNotImplemented, res)
+				}
+				res.Status = healthError
+				return c.JSON(http.StatusInternalServerError, res)
+			}
+			res.Integrity = &report
+			if report.Total() > 0 {
+				res.Status = healthInconsistent
+				return c.JSON(http.StatusServiceUnavailable, res)
+			}
+		}
+		if c.QueryParam("strict") == "true" && stale {
+			res.Status = healthStale
+			return c.JSON(http.StatusServiceUnavailable, res)
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+// pathParam returns the path parameter of name decoded. echo matches the escaped path if it has any escape other than the default one,
+// e.g. libstdc%2B%2B, leaving the parameter escaped, and the decoded path otherwise, e.g. libstdc++, which must not be decoded twice.
+// PathUnescape keeps "+" in the names, which QueryUnescape turns into the spaces.
+func pathParam(c echo.Context, name string) (string, error) {
+	p := c.Param(name)
+	if c.Request().URL.RawPath == "" {
+		return p, nil
+	}
+	return url.PathUnescape(p)
+}
+
+// packsResponse is the JSON body of /packs, with the family and the release looked up and the decoded package name,
+// to tell which query the definitions are of
+type packsResponse struct {
+	Family      string              `json:"family"`
+	Release     string              `json:"release"`
+	Package     string              `json:"package"`
+	Arch        string              `json:"arch,omitempty"`
+	Definitions []models.Definition `json:"definitions"`
+	Total       int64               `json:"total"`
+	NextOffset  *int                `json:"nextOffset,omitempty"`
+	Warning     string              `json:"warning,omitempty"` // of the release not fetched, responded with no definitions
+}
+
+// cvesResponse is the JSON body of /cves, with the family and the release looked up and the normalized CVE ID,
+// and the definitions of the CVE with their advisories, affected packages and references
+type cvesResponse struct {
+	Family      string              `json:"family"`
+	Release     string              `json:"release"`
+	CveID       string              `json:"cveID"`
+	Arch        string              `json:"arch,omitempty"`
+	Definitions []models.Definition `json:"definitions"`
+	Total       int64               `json:"total"`
+	NextOffset  *int                `json:"nextOffset,omitempty"`
+	Warning     string              `json:"warning,omitempty"` // of the release not fetched, responded with no definitions
+}
+
+// cveIDPattern is the format of the CVE IDs looked up by /cves, matched case-insensitively
+var cveIDPattern = regexp.MustCompile(`^CVE-\d{4}-\d+$`)
+
+// lookupParams returns the family, the release and the arch of the lookups, where the release may be the codename of Debian and Ubuntu,
+// e.g. bookworm, and the arch is given by the path or ?arch=. The family is normalized by config.NormalizeFamily, e.g. redhat of RedHat and centos,
+// before opening DB, failing with db.ErrUnknownFamily.
+func lookupParams(c echo.Context) (family, release, arch string, err error) {
+	family, err = config.NormalizeFamily(c.Param("family"))
+	if err != nil {
+		return "", "", "", xerrors.Errorf("Failed to look up. err: %w", err)
+	}
+	arch = c.Param("arch")
+	if arch == "" {
+		arch = c.QueryParam("arch")
+	}
+	return family, config.ReleaseOfCodename(family, c.Param("release")), arch, nil
+}
+
+// pageParams returns the page of ?limit= and ?offset=, limited to --max-limit if set, all the definitions by default
+func pageParams(c echo.Context) (db.Page, error) {
+	var page db.Page
+	for _, p := range []struct {
+		name string
+		v    *int
+	}{{"limit", &page.Limit}, {"offset", &page.Offset}} {
+		s := c.QueryParam(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return db.Page{}, xerrors.Errorf("invalid %s: %s", p.name, s)
+		}
+		*p.v = n
+	}
+	if max := viper.GetInt("max-limit"); max > 0 && (page.Limit == 0 || page.Limit > max) {
+		page.Limit = max
+	}
+	return page, nil
+}
+
+// omitParam returns the children of the definitions not loaded by ?omit=, e.g. ?omit=packages,references, all of them loaded by default
+func omitParam(c echo.Context) (db.Omit, error) {
+	return db.ParseOmit(c.QueryParam("omit"))
+}
+
+// collapseArchParam returns whether the lookup without the arch collapses the packages of more than one arch, by ?collapse_arch=, true if not given
+func collapseArchParam(c echo.Context) (bool, error) {
+	s := c.QueryParam("collapse_arch")
+	if s == "" {
+		return true, nil
+	}
+	collapse, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, xerrors.Errorf("invalid collapse_arch: %s, expected true or false", s)
 	}
+	return collapse, nil
 }
 
-func getByPackName(driver db.DB) echo.HandlerFunc {
+// nextOffset returns the offset of the page following the one of n definitions of total, nil if it is the last
+func nextOffset(page db.Page, n int, total int64) *int {
+	next := page.Offset + n
+	if n == 0 || int64(next) >= total {
+		return nil
+	}
+	return &next
+}
+
+// queryContext returns the context of the request bounded by --query-timeout, not bounded if 0, for the lookups of DB to be abandoned
+// once it is done, e.g. of the slow query or of the client gone, instead of tying up the handler
+func queryContext(c echo.Context) (context.Context, context.CancelFunc) {
+	if timeout := viper.GetDuration("query-timeout"); timeout > 0 {
+		return context.WithTimeout(c.Request().Context(), timeout)
+	}
+	return context.WithCancel(c.Request().Context())
+}
+
+// getByPackName responds the definitions affecting the package of the family and the release, 304 if not modified since the request,
+// cached in packs if not nil
+func getByPackName(driver db.DB, fresh *cache[[]models.RootTimestamp], packs *packCache) echo.HandlerFunc {
 	return func(c echo.Context) (err error) {
-		family := strings.ToLower(c.Param("family"))
-		release := c.Param("release")
-		pack := c.Param("pack")
-		arch := c.Param("arch")
-		decodePack, err := url.QueryUnescape(pack)
+		family, release, arch, err := lookupParams(c)
+		if err != nil {
+			return lookupError(c, err)
+		}
+		classes := c.QueryParams()["class"]
+		pack, err := pathParam(c, "pack")
 		if err != nil {
-			log15.Error(fmt.Sprintf("Failed to Decode Package Name: %s", err))
-			return c.JSON(http.StatusBadRequest, nil)
+			log15.Error("Failed to decode package name", "Pack", c.Param("pack"), "err", err)
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid package name: %s", c.Param("pack"))})
 		}
 
-		log15.Debug("Params", "Family", family, "Release", release, "Pack", pack, "DecodePack", decodePack, "arch", arch)
+		page, err := pageParams(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
+		omit, err := omitParam(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
+		collapse, err := collapseArchParam(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
 
-		defs, err := driver.GetByPackName(family, release, decodePack, arch)
+		log15.Debug("Params", "Family", family, "Release", release, "Pack", pack, "arch", arch, "classes", classes, "page", page, "omit", omit)
+		if notModified(c, fresh, family, release) {
+			return c.NoContent(http.StatusNotModified)
+		}
+
+		ctx, cancel := queryContext(c)
+		defer cancel()
+		ctx = db.WithCollapseArch(db.WithOmit(ctx, omit), collapse)
+		key := packKey{family: family, release: release, pack: pack, arch: arch, classes: strings.Join(classes, ","), page: page, omit: omit, collapse: collapse}
+		result, err := packs.lookup(key, func() (packResult, error) {
+			defs, total, err := driver.GetByPackNamePage(ctx, family, release, pack, arch, page, classes...)
+			return packResult{defs: defs, total: total}, err
+		})
+		warning, err := releaseWarning(c, err)
 		if err != nil {
 			log15.Error("Failed to get by Package Name.", "err", err)
+			return lookupError(c, err)
+		}
+		defs, total := result.defs, result.total
+		if defs == nil {
+			defs = []models.Definition{}
 		}
-		return c.JSON(http.StatusOK, defs)
+		return c.JSON(http.StatusOK, packsResponse{Family: family, Release: release, Package: pack, Arch: arch, Definitions: defs, Total: total, NextOffset: nextOffset(page, len(defs), total), Warning: warning})
 	}
 }
 
-func getByCveID(driver db.DB) echo.HandlerFunc {
+// maxBatchPackages is the number of the packages looked up at most by a request of POST /packs, and maxBatchBody the bytes of its body at most
+const (
+	maxBatchPackages = 5000
+	maxBatchBody     = 1 << 20
+)
+
+// packsBatchRequest is the JSON body of POST /packs
+type packsBatchRequest struct {
+	Packages []string `json:"packages"`
+}
+
+// packsBatchResponse is the JSON body of POST /packs, with the definitions by package, an empty array for the package affected by none
+type packsBatchResponse struct {
+	Family   string                         `json:"family"`
+	Release  string                         `json:"release"`
+	Arch     string                         `json:"arch,omitempty"`
+	Packages map[string][]models.Definition `json:"packages"`
+	Warning  string                         `json:"warning,omitempty"`
+}
+
+// postPacks responds the definitions affecting each of the packages in the body of the family and the release,
+// looked up at once, e.g. for the scanner not to request every package of the host, with 413 for more than maxBatchPackages
+func postPacks(driver db.DB) echo.HandlerFunc {
 	return func(c echo.Context) (err error) {
-		family := strings.ToLower(c.Param("family"))
-		release := c.Param("release")
-		cveID := c.Param("id")
-		arch := c.Param("arch")
-		log15.Debug("Params", "Family", family, "Release", release, "CveID", cveID, "arch", arch)
+		family, release, arch, err := lookupParams(c)
+		if err != nil {
+			return lookupError(c, err)
+		}
+		classes := c.QueryParams()["class"]
+		omit, err := omitParam(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
+		collapse, err := collapseArchParam(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
 
-		defs, err := driver.GetByCveID(family, release, cveID, arch)
+		var body packsBatchRequest
+		if err := json.NewDecoder(http.MaxBytesReader(c.Response(), c.Request().Body, maxBatchBody)).Decode(&body); err != nil {
+			var tooLarge *http.MaxBytesError
+			if xerrors.As(err, &tooLarge) {
+				return c.JSON(http.StatusRequestEntityTooLarge, errorResponse{Error: fmt.Sprintf("body larger than %d bytes", maxBatchBody)})
+			}
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid body: %s", err)})
+		}
+		if len(body.Packages) > maxBatchPackages {
+			return c.JSON(http.StatusRequestEntityTooLarge, errorResponse{Error: fmt.Sprintf("%d packages requested, up to %d at once", len(body.Packages), maxBatchPackages)})
+		}
+		if slices.Contains(body.Packages, "") {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: "invalid package name: empty"})
+		}
+		log15.Debug("Params", "Family", family, "Release", release, "Packages", len(body.Packages), "arch", arch, "classes", classes, "omit", omit)
+
+		ctx, cancel := queryContext(c)
+		defer cancel()
+		defs, err := driver.GetByPackNames(db.WithCollapseArch(db.WithOmit(ctx, omit), collapse), family, release, body.Packages, arch, classes...)
+		warning, err := releaseWarning(c, err)
+		if err != nil {
+			log15.Error("Failed to get by Package Names.", "err", err)
+			return lookupError(c, err)
+		}
+		if defs == nil {
+			defs = map[string][]models.Definition{}
+		}
+		return c.JSON(http.StatusOK, packsBatchResponse{Family: family, Release: release, Arch: arch, Packages: defs, Warning: warning})
+	}
+}
+
+// getByCveID responds the definitions of the CVE of the family and the release, accepting the CVE ID in lowercase as well, e.g. cve-2023-0001,
+// and 304 if not modified since the request
+func getByCveID(driver db.DB, fresh *cache[[]models.RootTimestamp]) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		family, release, arch, err := lookupParams(c)
+		if err != nil {
+			return lookupError(c, err)
+		}
+		cveID := strings.ToUpper(c.Param("id"))
+		if !cveIDPattern.MatchString(cveID) {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid CVE ID: %s", c.Param("id"))})
+		}
+		page, err := pageParams(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
+		omit, err := omitParam(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
+		collapse, err := collapseArchParam(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
+		log15.Debug("Params", "Family", family, "Release", release, "CveID", cveID, "arch", arch, "page", page, "omit", omit)
+		if notModified(c, fresh, family, release) {
+			return c.NoContent(http.StatusNotModified)
+		}
+
+		ctx, cancel := queryContext(c)
+		defer cancel()
+		defs, total, err := driver.GetByCveIDPage(db.WithCollapseArch(db.WithOmit(ctx, omit), collapse), family, release, cveID, arch, page)
+		warning, err := releaseWarning(c, err)
 		if err != nil {
 			log15.Error("Failed to get by CveID.", "err", err)
+			return lookupError(c, err)
+		}
+		if defs == nil {
+			defs = []models.Definition{}
+		}
+		return c.JSON(http.StatusOK, cvesResponse{Family: family, Release: release, CveID: cveID, Arch: arch, Definitions: defs, Total: total, NextOffset: nextOffset(page, len(defs), total), Warning: warning})
+	}
+}
+
+// cpesResponse is the JSON body of /cpes, with the family and the release looked up and the decoded CPE
+type cpesResponse struct {
+	Family      string              `json:"family"`
+	Release     string              `json:"release"`
+	Cpe         string              `json:"cpe"`
+	Arch        string              `json:"arch,omitempty"`
+	Definitions []models.Definition `json:"definitions"`
+	Warning     string              `json:"warning,omitempty"`
+}
+
+// getByCpe responds the definitions whose affected CPEs start with the CPE of the family and the release, and 304 if not modified since the request
+func getByCpe(driver db.DB, fresh *cache[[]models.RootTimestamp]) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		family, release, arch, err := lookupParams(c)
+		if err != nil {
+			return lookupError(c, err)
+		}
+		cpe := c.Param("cpe")
+		// the CPE is URL-encoded, e.g. cpe:%2Fo:redhat:enterprise_linux:7, as it has "/"
+		decodeCpe, err := pathParam(c, "cpe")
+		if err != nil {
+			log15.Error("Failed to decode CPE", "Cpe", cpe, "err", err)
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid CPE: %s", cpe)})
+		}
+		omit, err := omitParam(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
+		collapse, err := collapseArchParam(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
+		log15.Debug("Params", "Family", family, "Release", release, "Cpe", cpe, "DecodeCpe", decodeCpe, "arch", arch, "omit", omit)
+		if notModified(c, fresh, family, release) {
+			return c.NoContent(http.StatusNotModified)
+		}
+
+		ctx, cancel := queryContext(c)
+		defer cancel()
+		defs, err := driver.GetByCpe(db.WithCollapseArch(db.WithOmit(ctx, omit), collapse), family, release, decodeCpe, arch)
+		warning, err := releaseWarning(c, err)
+		if err != nil {
+			log15.Error("Failed to get by CPE.", "err", err)
+			return lookupError(c, err)
+		}
+		if defs == nil {
+			defs = []models.Definition{}
+		}
+		return c.JSON(http.StatusOK, cpesResponse{Family: family, Release: release, Cpe: decodeCpe, Arch: arch, Definitions: defs, Warning: warning})
+	}
+}
+
+// advisoriesResponse is the JSON body of /advisories, with the family and the release looked up and the decoded advisory ID
+type advisoriesResponse struct {
+	Family      string              `json:"family"`
+	Release     string              `json:"release"`
+	AdvisoryID  string              `json:"advisoryID"`
+	Arch        string              `json:"arch,omitempty"`
+	Definitions []models.Definition `json:"definitions"`
+	Warning     string              `json:"warning,omitempty"`
+}
+
+func getByAdvisoryID(driver db.DB, fresh *cache[[]models.RootTimestamp]) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		family, release, arch, err := lookupParams(c)
+		if err != nil {
+			return lookupError(c, err)
+		}
+		// the advisory ID may be URL-encoded, e.g. RHSA-2017%3A0933
+		advisoryID, err := pathParam(c, "id")
+		if err != nil || strings.TrimSpace(advisoryID) == "" {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid advisory ID: %s", c.Param("id"))})
+		}
+		omit, err := omitParam(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
+		collapse, err := collapseArchParam(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
+		log15.Debug("Params", "Family", family, "Release", release, "AdvisoryID", advisoryID, "arch", arch, "omit", omit)
+		if notModified(c, fresh, family, release) {
+			return c.NoContent(http.StatusNotModified)
+		}
+
+		ctx, cancel := queryContext(c)
+		defer cancel()
+		defs, err := driver.GetByAdvisoryID(db.WithCollapseArch(db.WithOmit(ctx, omit), collapse), family, release, advisoryID, arch)
+		warning, err := releaseWarning(c, err)
+		if err != nil {
+			log15.Error("Failed to get by advisory ID.", "err", err)
+			return lookupError(c, err)
 		}
-		return c.JSON(http.StatusOK, defs)
+		if defs == nil {
+			defs = []models.Definition{}
+		}
+		return c.JSON(http.StatusOK, advisoriesResponse{Family: family, Release: release, AdvisoryID: advisoryID, Arch: arch, Definitions: defs, Warning: warning})
 	}
 }
 
-func countOvalDefs(driver db.DB) echo.HandlerFunc {
+// packagesResponse is the JSON body of /packages, with the family and the release looked up
+type packagesResponse struct {
+	Family   string   `json:"family"`
+	Release  string   `json:"release"`
+	Packages []string `json:"packages"`
+	Warning  string   `json:"warning,omitempty"`
+}
+
+// getPackages responds the distinct names of the affected packages of the family and the release, sorted, and 304 if not modified since the request,
+// e.g. for the scanner to look up only the installed packages in it
+func getPackages(driver db.DB, fresh *cache[[]models.RootTimestamp]) echo.HandlerFunc {
 	return func(c echo.Context) (err error) {
-		family := strings.ToLower(c.Param("family"))
-		release := c.Param("release")
+		family, release, _, err := lookupParams(c)
+		if err != nil {
+			return lookupError(c, err)
+		}
 		log15.Debug("Params", "Family", family, "Release", release)
+		if notModified(c, fresh, family, release) {
+			return c.NoContent(http.StatusNotModified)
+		}
+
+		ctx, cancel := queryContext(c)
+		defer cancel()
+		names, err := driver.ListPackages(ctx, family, release)
+		warning, err := releaseWarning(c, err)
+		if err != nil {
+			log15.Error("Failed to list packages.", "err", err)
+			return lookupError(c, err)
+		}
+		if names == nil {
+			names = []string{}
+		}
+		return c.JSON(http.StatusOK, packagesResponse{Family: family, Release: release, Packages: names, Warning: warning})
+	}
+}
+
+// historyResponse is the JSON body of /history, with the family and the release looked up
+type historyResponse struct {
+	Family  string                `json:"family"`
+	Release string                `json:"release"`
+	History []models.FetchHistory `json:"history"`
+}
+
+// sinceParam returns the time of ?since= in RFC 3339 or of the date, e.g. 2023-07-06, the zero time if not given
+func sinceParam(c echo.Context) (time.Time, error) {
+	s := c.QueryParam("since")
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, xerrors.Errorf("invalid since: %s, expected RFC 3339 or YYYY-MM-DD", s)
+}
 
-		count, err := driver.CountDefs(family, release)
+// getHistory responds the refreshes of the OVAL of the family and the release since ?since=, all of them kept by --history-retention if not given,
+// with the counts of the stored OVAL after each and the changes of it, e.g. for the trend of the new advisories a week, and 501 for Redis
+func getHistory(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		family, release, _, err := lookupParams(c)
+		if err != nil {
+			return lookupError(c, err)
+		}
+		since, err := sinceParam(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		}
+		log15.Debug("Params", "Family", family, "Release", release, "since", since)
+
+		ctx, cancel := queryContext(c)
+		defer cancel()
+		hs, err := driver.GetFetchHistory(ctx, family, release, since)
+		if err != nil {
+			if xerrors.Is(err, db.ErrNotSupported) {
+				return c.JSON(http.StatusNotImplemented, errorResponse{Error: err.Error()})
+			}
+			log15.Error("Failed to get the fetch history.", "err", err)
+			return lookupError(c, err)
+		}
+		if hs == nil {
+			hs = []models.FetchHistory{}
+		}
+		return c.JSON(http.StatusOK, historyResponse{Family: family, Release: release, History: hs})
+	}
+}
+
+// statsTTL is how long the stats of the stored OVAL are cached by /families and /count, which count the rows of all of them
+var statsTTL = 30 * time.Second
+
+// rootResponse is the JSON of the stored OVAL of a family and a release by /families and /count, with the time it was last fetched,
+// omitted if not fetched
+type rootResponse struct {
+	Family      string     `json:"family"`
+	Release     string     `json:"release"`
+	Definitions int        `json:"definitions"`
+	Packages    int        `json:"packages"`
+	LastFetched *time.Time `json:"lastFetched,omitempty"`
+}
+
+func newRootResponse(stat models.RootStat) rootResponse {
+	ts := stat.Timestamp
+	return rootResponse{Family: stat.Family, Release: stat.OSVersion, Definitions: stat.Definitions, Packages: stat.Packages, LastFetched: &ts}
+}
+
+// getFamilies responds the stored OVAL of all the families and the releases the server can answer, e.g. for the clients to discover them
+func getFamilies(stats *cache[[]models.RootStat]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ss, err := stats.get()
+		if err != nil {
+			log15.Error("Failed to get the stats of OVAL", "err", err)
+			return c.JSON(http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		}
+		res := make([]rootResponse, 0, len(ss))
+		for _, stat := range ss {
+			res = append(res, newRootResponse(stat))
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+// getCapabilities responds the families this binary can serve and the stored OVAL of them, with the version of the JSON and of the schema of DB,
+// e.g. for the scanner to tell in a request which families to look up elsewhere and whether it understands this server
+func getCapabilities(stats *cache[[]models.RootStat]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ss, err := stats.get()
+		if err != nil {
+			log15.Error("Failed to get the stats of OVAL", "err", err)
+			return c.JSON(http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, db.NewCapabilities(ss))
+	}
+}
+
+// countOvalDefs responds the counts of the stored OVAL of the family and the release as it is stored, e.g. debian 12 of raspbian 12.1,
+// with zero counts if not fetched
+func countOvalDefs(stats *cache[[]models.RootStat]) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		family, release, _, err := lookupParams(c)
+		if err != nil {
+			return lookupError(c, err)
+		}
+		log15.Debug("Params", "Family", family, "Release", release)
+
+		family, release, err = db.FormatFamilyAndOSVer(family, release)
+		if err != nil {
+			return lookupError(c, err)
+		}
+		ss, err := stats.get()
 		if err != nil {
 			log15.Error("Failed to count OVAL defs.", "err", err)
+			return c.JSON(http.StatusInternalServerError, errorResponse{Error: err.Error()})
 		}
-		return c.JSON(http.StatusOK, count)
+		for _, stat := range ss {
+			if stat.Family == family && stat.OSVersion == release {
+				return c.JSON(http.StatusOK, newRootResponse(stat))
+			}
+		}
+		return c.JSON(http.StatusOK, rootResponse{Family: family, Release: release})
 	}
 }
 
+// getLastModified responds the timestamp of the OVAL of the family and the release, accepting the aliases of the family and the codenames
+// of the release as the lookups do, e.g. rhel and bookworm
 func getLastModified(driver db.DB) echo.HandlerFunc {
 	return func(c echo.Context) (err error) {
-		family := strings.ToLower(c.Param("family"))
-		release := c.Param("release")
+		family, release, _, err := lookupParams(c)
+		if err != nil {
+			return lookupError(c, err)
+		}
 		log15.Debug("Params", "Family", family, "Release", release)
 
 		t, err := driver.GetLastModified(family, release)
 		if err != nil {
-			log15.Error(fmt.Sprintf("Failed to GetLastModified: %s", err))
-			return c.JSON(http.StatusInternalServerError, nil)
+			log15.Error("Failed to GetLastModified", "Family", family, "Release", release, "err", err)
+			return lookupError(c, err)
 		}
 
 		return c.JSON(http.StatusOK, t)
@@ -0,0 +1,2890 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"expvar"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+
+	c "github.com/vulsio/goval-dictionary/config"
+	"github.com/vulsio/goval-dictionary/db"
+	"github.com/vulsio/goval-dictionary/metrics"
+	"github.com/vulsio/goval-dictionary/models"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// newTestEcho returns the server of newEcho, failing the test if it fails
+func newTestEcho(t *testing.T, driver db.DB, lastRefresh func() *Refresh) *echo.Echo {
+	t.Helper()
+
+	e, err := newEcho(driver, lastRefresh)
+	if err != nil {
+		t.Fatalf("Failed to newEcho. err: %s", err)
+	}
+	return e
+}
+
+// newTestServer serves the lookups over the DB of newTestDB
+func newTestServer(t *testing.T, releases map[string]string) *httptest.Server {
+	t.Helper()
+
+	ts := httptest.NewServer(newTestEcho(t, newTestDB(t, releases), nil))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// newTestDB returns the DB opened read-only, which has a definition of libstdc++ and python3.11 for each of releases,
+// affecting the CPEs of its server and workstation
+func newTestDB(t *testing.T, releases map[string]string) db.DB {
+	t.Helper()
+
+	viper.Set("batch-size", 10)
+	t.Cleanup(func() { viper.Set("batch-size", nil) })
+
+	dbPath := filepath.Join(t.TempDir(), "oval.sqlite3")
+	driver, err := db.NewDB("sqlite3", dbPath, false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	for family, release := range releases {
+		version := "2.0-1"
+		if family == c.RedHat {
+			version = fmt.Sprintf("0:2.0-1.el%s", release)
+		}
+		root := &models.Root{
+			Family:    family,
+			OSVersion: release,
+			Timestamp: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC),
+			Definitions: []models.Definition{{
+				DefinitionID: fmt.Sprintf("oval:%s:def:1", family),
+				Advisory: models.Advisory{
+					Cves: []models.Cve{{CveID: "CVE-2023-0001"}},
+					AffectedCPEList: []models.Cpe{
+						{Cpe: fmt.Sprintf("cpe:/o:%s:%s::server", family, release)},
+						{Cpe: fmt.Sprintf("cpe:/o:%s:%s::workstation", family, release)},
+					},
+				},
+				AffectedPacks: []models.Package{
+					{Name: "libstdc++", Version: version},
+					{Name: "python3.11", Version: version},
+				},
+			}},
+		}
+		if _, err := driver.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+	if err := driver.CloseDB(); err != nil {
+		t.Fatalf("Failed to CloseDB. err: %s", err)
+	}
+
+	driver, err = db.NewDB("sqlite3", dbPath, false, db.Option{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	t.Cleanup(func() { _ = driver.CloseDB() })
+	return driver
+}
+
+func TestLookups(t *testing.T) {
+	releases := map[string]string{
+		c.Alpine:                "3.18",
+		c.Amazon:                "2",
+		c.Debian:                "12",
+		c.Fedora:                "38",
+		c.OpenSUSE:              "tumbleweed",
+		c.OpenSUSELeap:          "15.5",
+		c.Oracle:                "8",
+		c.RedHat:                "8",
+		c.SUSEEnterpriseDesktop: "15",
+		c.SUSEEnterpriseServer:  "15",
+		c.Ubuntu:                "22.04",
+	}
+	ts := newTestServer(t, releases)
+
+	type test struct {
+		path       string
+		wantStatus int
+		wantIDs    []string
+	}
+	tests := []test{}
+	for family, release := range releases {
+		id := []string{fmt.Sprintf("oval:%s:def:1", family)}
+		tests = append(tests,
+			test{path: fmt.Sprintf("/packs/%s/%s/libstdc++", family, release), wantStatus: http.StatusOK, wantIDs: id},
+			test{path: fmt.Sprintf("/packs/%s/%s/libstdc%%2B%%2B", family, release), wantStatus: http.StatusOK, wantIDs: id},
+			test{path: fmt.Sprintf("/packs/%s/%s/python3.11", family, release), wantStatus: http.StatusOK, wantIDs: id},
+			test{path: fmt.Sprintf("/packs/%s/%s/libc6", family, release), wantStatus: http.StatusOK, wantIDs: []string{}},
+			test{path: fmt.Sprintf("/cves/%s/%s/CVE-2023-0001", family, release), wantStatus: http.StatusOK, wantIDs: id},
+			test{path: fmt.Sprintf("/cves/%s/%s/CVE-2023-0002", family, release), wantStatus: http.StatusOK, wantIDs: []string{}},
+			test{path: fmt.Sprintf("/cpes/%s/%s/%s", family, release, url.PathEscape(fmt.Sprintf("cpe:/o:%s:%s::server", family, release))), wantStatus: http.StatusOK, wantIDs: id},
+			test{path: fmt.Sprintf("/cpes/%s/%s/%s", family, release, url.PathEscape(fmt.Sprintf("cpe:/o:%s:%s", family, release))), wantStatus: http.StatusOK, wantIDs: id},
+			test{path: fmt.Sprintf("/cpes/%s/%s/%s", family, release, url.PathEscape("cpe:/o:unknown")), wantStatus: http.StatusOK, wantIDs: []string{}},
+		)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, err := http.Get(ts.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Failed to GET. err: %s", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("expected: %d, actual: %d", tt.wantStatus, res.StatusCode)
+			}
+
+			// the definitions are in the envelope of the query
+			var body struct {
+				Definitions []models.Definition `json:"definitions"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode. err: %s", err)
+			}
+			defs := body.Definitions
+			// empty results are [], not null
+			if defs == nil {
+				t.Fatalf("expected: [], actual: null")
+			}
+			ids := []string{}
+			for _, d := range defs {
+				ids = append(ids, d.DefinitionID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("expected: %q, actual: %q", tt.wantIDs, ids)
+			}
+		})
+	}
+}
+
+func TestGetByPackName(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	root := &models.Root{
+		Family:    c.Debian,
+		OSVersion: "12",
+		Definitions: []models.Definition{
+			{DefinitionID: "oval:g++", AffectedPacks: []models.Package{{Name: "g++", Version: "4:12.2.0-3~deb12u1"}}},
+			{DefinitionID: "oval:libstdc++6", AffectedPacks: []models.Package{{Name: "libstdc++6", Version: "12.2.0-14"}}},
+			{DefinitionID: "oval:python3.11", AffectedPacks: []models.Package{{Name: "python3.11", Version: "3.11.2-6+deb12u1"}}},
+			{DefinitionID: "oval:a%b", AffectedPacks: []models.Package{{Name: "a%b", Version: "1.0"}}},
+		},
+	}
+	if _, err := driver.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	e := newTestEcho(t, driver, nil)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       packsResponse
+		wantVer    string
+		wantErr    string
+	}{
+		{path: "/packs/debian/12/g++", wantStatus: http.StatusOK, want: packsResponse{Family: c.Debian, Release: "12", Package: "g++"}, wantVer: "4:12.2.0-3~deb12u1"},
+		{path: "/packs/debian/12/g%2B%2B", wantStatus: http.StatusOK, want: packsResponse{Family: c.Debian, Release: "12", Package: "g++"}, wantVer: "4:12.2.0-3~deb12u1"},
+		{path: "/packs/Debian/bookworm/libstdc%2B%2B6", wantStatus: http.StatusOK, want: packsResponse{Family: c.Debian, Release: "12", Package: "libstdc++6"}, wantVer: "12.2.0-14"},
+		{path: "/packs/raspbian/bookworm/python3.11?arch=arm64", wantStatus: http.StatusOK, want: packsResponse{Family: c.Raspbian, Release: "12", Package: "python3.11", Arch: "arm64"}, wantVer: "3.11.2-6+deb12u1"},
+		// the escaped "%" is decoded once, in the decoded path as well as in the escaped one
+		{path: "/packs/debian/12/a%25b", wantStatus: http.StatusOK, want: packsResponse{Family: c.Debian, Release: "12", Package: "a%b"}, wantVer: "1.0"},
+		{path: "/packs/debian/12/a%25b%2B", wantStatus: http.StatusOK, want: packsResponse{Family: c.Debian, Release: "12", Package: "a%b+"}},
+		{path: "/packs/debian/12/g%20%20", wantStatus: http.StatusOK, want: packsResponse{Family: c.Debian, Release: "12", Package: "g  "}},
+		{path: "/packs/ubuntu/jammy/g++", wantStatus: http.StatusOK, want: packsResponse{Family: c.Ubuntu, Release: "22.04", Package: "g++", Warning: "release not fetched: ubuntu 22.04 is not in DB, fetch it first. No releases of ubuntu in DB"}},
+		// the family normalized by config.NormalizeFamily
+		{path: "/packs/DEBIAN/12/g++", wantStatus: http.StatusOK, want: packsResponse{Family: c.Debian, Release: "12", Package: "g++"}, wantVer: "4:12.2.0-3~deb12u1"},
+		{path: "/packs/windows/10/g++", wantStatus: http.StatusBadRequest, wantErr: "unknown family: windows"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected: %d, actual: %d, body: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantErr != "" {
+				var body errorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("Failed to unmarshal. err: %s", err)
+				}
+				if body.Error != tt.wantErr {
+					t.Errorf("expected: %s, actual: %s", tt.wantErr, body.Error)
+				}
+				return
+			}
+
+			var body packsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to unmarshal. err: %s", err)
+			}
+			if body.Definitions == nil {
+				t.Fatalf("expected: [], actual: null")
+			}
+			vers := []string{}
+			for _, d := range body.Definitions {
+				for _, p := range d.AffectedPacks {
+					vers = append(vers, p.Version)
+				}
+			}
+			wantVers := []string{}
+			if tt.wantVer != "" {
+				wantVers = append(wantVers, tt.wantVer)
+			}
+			if !reflect.DeepEqual(vers, wantVers) {
+				t.Errorf("expected: %q, actual: %q", wantVers, vers)
+			}
+			if body.Total != int64(len(body.Definitions)) || body.NextOffset != nil {
+				t.Errorf("expected: total %d without nextOffset, actual: %d, %v", len(body.Definitions), body.Total, body.NextOffset)
+			}
+			body.Definitions, body.Total = nil, 0
+			if !reflect.DeepEqual(body, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, body)
+			}
+			// the release not fetched is warned of in the header as well, but not the one fetched with nothing found
+			if warning := rec.Header().Get("Warning"); (warning != "") != (tt.want.Warning != "") || !strings.Contains(warning, tt.want.Warning) {
+				t.Errorf("expected: %q in Warning header, actual: %q", tt.want.Warning, warning)
+			}
+		})
+	}
+}
+
+func TestGetByPackNameCollapseArch(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	root := &models.Root{
+		Family:    c.Oracle,
+		OSVersion: "8",
+		Definitions: []models.Definition{{
+			DefinitionID: "oval:com.oracle.elsa:def:20233349",
+			AffectedPacks: []models.Package{
+				{Name: "openssl", Version: "1:1.1.1k-9.el8_7", Arch: "x86_64"},
+				{Name: "openssl", Version: "1:1.1.1k-9.el8_7", Arch: "aarch64"},
+			},
+		}},
+	}
+	if _, err := driver.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	e := newTestEcho(t, driver, nil)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantArches []string
+	}{
+		{path: "/packs/oracle/8/openssl", wantStatus: http.StatusOK, wantArches: []string{""}},
+		{path: "/packs/oracle/8/openssl?collapse_arch=false", wantStatus: http.StatusOK, wantArches: []string{"x86_64", "aarch64"}},
+		{path: "/packs/oracle/8/openssl/aarch64", wantStatus: http.StatusOK, wantArches: []string{"aarch64"}},
+		{path: "/cves/oracle/8/CVE-2023-0464?collapse_arch=no", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected: %d, actual: %d, body: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var body packsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to unmarshal. err: %s", err)
+			}
+			if len(body.Definitions) != 1 {
+				t.Fatalf("expected: 1 definition, actual: %+v", body.Definitions)
+			}
+			arches := []string{}
+			for _, p := range body.Definitions[0].AffectedPacks {
+				arches = append(arches, p.Arch)
+			}
+			if !reflect.DeepEqual(arches, tt.wantArches) {
+				t.Errorf("expected: %q, actual: %q", tt.wantArches, arches)
+			}
+		})
+	}
+}
+
+func TestPostPacks(t *testing.T) {
+	ts := newTestServer(t, map[string]string{c.RedHat: "8"})
+
+	// the 50 packages of a host, 2 of which are affected
+	packages := []string{"libstdc++", "python3.11"}
+	for i := len(packages); i < 50; i++ {
+		packages = append(packages, fmt.Sprintf("package%02d", i))
+	}
+	tooMany := make([]string, maxBatchPackages+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("package%d", i)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		body       interface{}
+		wantStatus int
+		wantError  string
+	}{
+		{name: "50 packages", path: "/packs/redhat/8", body: packsBatchRequest{Packages: packages}, wantStatus: http.StatusOK},
+		{name: "arch", path: "/packs/redhat/8?arch=x86_64", body: packsBatchRequest{Packages: packages}, wantStatus: http.StatusOK},
+		{name: "too many packages", path: "/packs/redhat/8", body: packsBatchRequest{Packages: tooMany}, wantStatus: http.StatusRequestEntityTooLarge, wantError: "5001 packages requested, up to 5000 at once"},
+		{name: "too large body", path: "/packs/redhat/8", body: packsBatchRequest{Packages: []string{strings.Repeat("a", maxBatchBody)}}, wantStatus: http.StatusRequestEntityTooLarge, wantError: "body larger than 1048576 bytes"},
+		{name: "invalid body", path: "/packs/redhat/8", body: "libstdc++", wantStatus: http.StatusBadRequest, wantError: "invalid body: json: cannot unmarshal string into Go value of type server.packsBatchRequest"},
+		{name: "empty package name", path: "/packs/redhat/8", body: packsBatchRequest{Packages: []string{""}}, wantStatus: http.StatusBadRequest, wantError: "invalid package name: empty"},
+		{name: "unknown family", path: "/packs/windows/10", body: packsBatchRequest{Packages: packages}, wantStatus: http.StatusBadRequest, wantError: "unknown family: windows"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bs, err := json.Marshal(tt.body)
+			if err != nil {
+				t.Fatalf("Failed to marshal body. err: %s", err)
+			}
+			queries := func(method string) int64 {
+				if v, ok := db.Queries.Get(method).(*expvar.Int); ok {
+					return v.Value()
+				}
+				return 0
+			}
+			batch, single := queries("GetByPackNames"), queries("GetByPackName")
+
+			res, err := http.Post(ts.URL+tt.path, "application/json", bytes.NewReader(bs))
+			if err != nil {
+				t.Fatalf("Failed to POST. err: %s", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("status: expected: %d, actual: %d", tt.wantStatus, res.StatusCode)
+			}
+			if tt.wantError != "" {
+				var body errorResponse
+				if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+					t.Fatalf("Failed to decode body. err: %s", err)
+				}
+				if body.Error != tt.wantError {
+					t.Errorf("expected: %q, actual: %q", tt.wantError, body.Error)
+				}
+				return
+			}
+
+			// looked up at once
+			if n := queries("GetByPackNames") - batch; n != 1 {
+				t.Errorf("GetByPackNames: expected: 1, actual: %d", n)
+			}
+			if n := queries("GetByPackName") - single; n != 0 {
+				t.Errorf("GetByPackName: expected: 0, actual: %d", n)
+			}
+
+			var body struct {
+				Family   string                       `json:"family"`
+				Release  string                       `json:"release"`
+				Arch     string                       `json:"arch"`
+				Packages map[string][]json.RawMessage `json:"packages"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode body. err: %s", err)
+			}
+			if body.Family != c.RedHat || body.Release != "8" {
+				t.Errorf("expected: redhat 8, actual: %s %s", body.Family, body.Release)
+			}
+			if len(body.Packages) != len(packages) {
+				t.Fatalf("packages: expected: %d, actual: %d", len(packages), len(body.Packages))
+			}
+			for _, name := range packages {
+				defs, ok := body.Packages[name]
+				want := 0
+				if name == "libstdc++" || name == "python3.11" {
+					want = 1
+				}
+				if !ok || defs == nil || len(defs) != want {
+					t.Errorf("%s: expected: %d definitions, actual: %v", name, want, defs)
+				}
+			}
+		})
+	}
+}
+
+func TestGetPage(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	root := &models.Root{Family: c.RedHat, OSVersion: "8"}
+	all := []string{}
+	for i := 7; i > 0; i-- {
+		id := fmt.Sprintf("oval:com.redhat.rhsa:def:2023000%d", i)
+		root.Definitions = append(root.Definitions, models.Definition{
+			DefinitionID:  id,
+			Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2023-0001"}}},
+			AffectedPacks: []models.Package{{Name: "kernel", Version: fmt.Sprintf("0:4.18.0-%d.el8", i)}},
+		})
+		all = append([]string{id}, all...)
+	}
+	if _, err := driver.InsertOval(context.Background(), root); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	e := newTestEcho(t, driver, nil)
+
+	type page struct {
+		Definitions []models.Definition `json:"definitions"`
+		Total       int64               `json:"total"`
+		NextOffset  *int                `json:"nextOffset"`
+	}
+	get := func(path string) (int, page, string) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body page
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to unmarshal. err: %s", err)
+			}
+		}
+		return rec.Code, body, rec.Body.String()
+	}
+
+	tests := []struct {
+		path     string
+		limit    int
+		maxLimit int
+		want     int
+	}{
+		{path: "/packs/redhat/8/kernel", limit: 3, want: 3},
+		{path: "/cves/redhat/8/CVE-2023-0001", limit: 2, want: 2},
+		{path: "/packs/redhat/8/kernel", limit: 7, want: 7},
+		// --max-limit caps the limit requested and pages the definitions without it
+		{path: "/packs/redhat/8/kernel", limit: 5, maxLimit: 4, want: 4},
+		{path: "/cves/redhat/8/CVE-2023-0001", maxLimit: 3, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s?limit=%d,max-limit=%d", tt.path, tt.limit, tt.maxLimit), func(t *testing.T) {
+			viper.Set("max-limit", tt.maxLimit)
+			defer viper.Set("max-limit", nil)
+
+			actual := []string{}
+			offset := 0
+			for pages := 0; ; pages++ {
+				if pages > len(all) {
+					t.Fatalf("expected the last page within %d pages", len(all))
+				}
+				path := fmt.Sprintf("%s?offset=%d", tt.path, offset)
+				if tt.limit > 0 {
+					path += fmt.Sprintf("&limit=%d", tt.limit)
+				}
+				status, body, raw := get(path)
+				if status != http.StatusOK {
+					t.Fatalf("%s: expected: %d, actual: %d, body: %s", path, http.StatusOK, status, raw)
+				}
+				if body.Total != int64(len(all)) {
+					t.Errorf("%s: total: expected: %d, actual: %d", path, len(all), body.Total)
+				}
+				if len(body.Definitions) > tt.want {
+					t.Errorf("%s: expected up to %d definitions, actual: %d", path, tt.want, len(body.Definitions))
+				}
+				for _, d := range body.Definitions {
+					actual = append(actual, d.DefinitionID)
+				}
+				if body.NextOffset == nil {
+					break
+				}
+				offset = *body.NextOffset
+			}
+			if !reflect.DeepEqual(actual, all) {
+				t.Errorf("expected: %q, actual: %q", all, actual)
+			}
+		})
+	}
+
+	for _, path := range []string{"/packs/redhat/8/kernel?limit=-1", "/packs/redhat/8/kernel?offset=x", "/cves/redhat/8/CVE-2023-0001?limit=1.5"} {
+		if status, _, raw := get(path); status != http.StatusBadRequest {
+			t.Errorf("%s: expected: %d, actual: %d, body: %s", path, http.StatusBadRequest, status, raw)
+		}
+	}
+}
+
+func TestLookupsOmit(t *testing.T) {
+	ts := newTestServer(t, map[string]string{c.RedHat: "8"})
+
+	tests := []struct {
+		path         string
+		method       string
+		wantPacks    bool
+		wantStatus   int
+		wantPackKeys int
+	}{
+		{path: "/packs/redhat/8/libstdc++", wantPacks: true},
+		{path: "/packs/redhat/8/libstdc++?omit=packages"},
+		{path: "/packs/redhat/8/libstdc++?omit=packages,references"},
+		{path: "/packs/redhat/8/libstdc++?omit=references", wantPacks: true},
+		{path: "/cves/redhat/8/CVE-2023-0001?omit=packages"},
+		{path: "/cpes/redhat/8/" + url.PathEscape("cpe:/o:redhat:8::server") + "?omit=packages"},
+		{path: "/packs/redhat/8?omit=packages", method: http.MethodPost},
+		{path: "/packs/redhat/8/libstdc++?omit=cves", wantStatus: http.StatusBadRequest},
+		{path: "/cves/redhat/8/CVE-2023-0001?omit=bugzillas", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var resp *http.Response
+			var err error
+			if tt.method == http.MethodPost {
+				resp, err = http.Post(ts.URL+tt.path, "application/json", strings.NewReader(`{"packages": ["libstdc++"]}`))
+			} else {
+				resp, err = http.Get(ts.URL + tt.path)
+			}
+			if err != nil {
+				t.Fatalf("Failed to request. err: %s", err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Failed to read body. err: %s", err)
+			}
+			wantStatus := tt.wantStatus
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			if resp.StatusCode != wantStatus {
+				t.Fatalf("expected: %d, actual: %d, body: %s", wantStatus, resp.StatusCode, body)
+			}
+			if wantStatus != http.StatusOK {
+				return
+			}
+
+			var defs []models.Definition
+			switch {
+			case tt.method == http.MethodPost:
+				var res struct {
+					Packages map[string][]models.Definition `json:"packages"`
+				}
+				if err := json.Unmarshal(body, &res); err != nil {
+					t.Fatalf("Failed to unmarshal %s. err: %s", body, err)
+				}
+				defs = res.Packages["libstdc++"]
+			default:
+				var res struct {
+					Definitions []models.Definition `json:"definitions"`
+				}
+				if err := json.Unmarshal(body, &res); err != nil {
+					t.Fatalf("Failed to unmarshal %s. err: %s", body, err)
+				}
+				defs = res.Definitions
+			}
+			// the advisory and its CVEs are kept, and the packages omitted are null
+			if len(defs) != 1 || len(defs[0].Advisory.Cves) != 1 {
+				t.Fatalf("expected: 1 definition with the CVE, actual: %s", body)
+			}
+			if got := defs[0].AffectedPacks != nil; got != tt.wantPacks {
+				t.Errorf("packages: expected: %t, actual: %s", tt.wantPacks, body)
+			}
+		})
+	}
+}
+
+func TestGetByCveID(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	// CVE-2023-0001 is in both of redhat and debian
+	for _, root := range []*models.Root{
+		{
+			Family:    c.RedHat,
+			OSVersion: "7",
+			Definitions: []models.Definition{{
+				DefinitionID:  "oval:com.redhat.rhsa:def:20230001",
+				Advisory:      models.Advisory{AdvisoryID: "RHSA-2023:0001", AdvisoryURL: "https://access.redhat.com/errata/RHSA-2023:0001", Severity: "Important", Cves: []models.Cve{{CveID: "CVE-2023-0001"}}},
+				AffectedPacks: []models.Package{{Name: "openssl", Version: "1:1.0.2k-26.el7_9"}},
+				References:    []models.Reference{{Source: "CVE", RefID: "CVE-2023-0001", RefURL: "https://access.redhat.com/security/cve/CVE-2023-0001"}},
+			}},
+		},
+		{
+			Family:    c.Debian,
+			OSVersion: "12",
+			Definitions: []models.Definition{{
+				DefinitionID:  "oval:org.debian:def:20230001",
+				Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2023-0001"}}},
+				AffectedPacks: []models.Package{{Name: "openssl", Version: "3.0.9-1"}},
+			}},
+		},
+	} {
+		if _, err := driver.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+	e := newTestEcho(t, driver, nil)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       cvesResponse
+		wantIDs    []string
+		wantErr    string
+	}{
+		{path: "/cves/redhat/7/CVE-2023-0001", wantStatus: http.StatusOK, want: cvesResponse{Family: c.RedHat, Release: "7", CveID: "CVE-2023-0001"}, wantIDs: []string{"oval:com.redhat.rhsa:def:20230001"}},
+		{path: "/cves/redhat/7/cve-2023-0001", wantStatus: http.StatusOK, want: cvesResponse{Family: c.RedHat, Release: "7", CveID: "CVE-2023-0001"}, wantIDs: []string{"oval:com.redhat.rhsa:def:20230001"}},
+		{path: "/cves/debian/bookworm/CVE-2023-0001?arch=amd64", wantStatus: http.StatusOK, want: cvesResponse{Family: c.Debian, Release: "12", CveID: "CVE-2023-0001", Arch: "amd64"}, wantIDs: []string{"oval:org.debian:def:20230001"}},
+		{path: "/cves/ubuntu/22.04/CVE-2023-0001", wantStatus: http.StatusOK, want: cvesResponse{Family: c.Ubuntu, Release: "22.04", CveID: "CVE-2023-0001", Warning: "release not fetched: ubuntu 22.04 is not in DB, fetch it first. No releases of ubuntu in DB"}, wantIDs: []string{}},
+		{path: "/cves/redhat/7/CVE-2023-99999", wantStatus: http.StatusOK, want: cvesResponse{Family: c.RedHat, Release: "7", CveID: "CVE-2023-99999"}, wantIDs: []string{}},
+		{path: "/cves/redhat/7/CVE-23-0001", wantStatus: http.StatusBadRequest, wantErr: "invalid CVE ID: CVE-23-0001"},
+		{path: "/cves/redhat/7/RHSA-2023:0001", wantStatus: http.StatusBadRequest, wantErr: "invalid CVE ID: RHSA-2023:0001"},
+		{path: "/cves/windows/10/CVE-2023-0001", wantStatus: http.StatusBadRequest, wantErr: "unknown family: windows"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected: %d, actual: %d, body: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantErr != "" {
+				var body errorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("Failed to unmarshal. err: %s", err)
+				}
+				if body.Error != tt.wantErr {
+					t.Errorf("expected: %s, actual: %s", tt.wantErr, body.Error)
+				}
+				return
+			}
+
+			var body cvesResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to unmarshal. err: %s", err)
+			}
+			if body.Definitions == nil {
+				t.Fatalf("expected: [], actual: null")
+			}
+			ids := []string{}
+			for _, d := range body.Definitions {
+				ids = append(ids, d.DefinitionID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("expected: %q, actual: %q", tt.wantIDs, ids)
+			}
+			// the advisory, the affected packages and the references answer which versions fix it
+			if tt.want.Family == c.RedHat && len(body.Definitions) == 1 {
+				d := body.Definitions[0]
+				if d.Advisory.AdvisoryID != "RHSA-2023:0001" || d.Advisory.AdvisoryURL != "https://access.redhat.com/errata/RHSA-2023:0001" || len(d.AffectedPacks) != 1 || d.AffectedPacks[0].Version != "1:1.0.2k-26.el7_9" || len(d.References) != 1 {
+					t.Errorf("expected: the advisory, the package and the reference of RHSA-2023:0001, actual: %+v", d)
+				}
+			}
+			if body.Total != int64(len(body.Definitions)) || body.NextOffset != nil {
+				t.Errorf("expected: total %d without nextOffset, actual: %d, %v", len(body.Definitions), body.Total, body.NextOffset)
+			}
+			body.Definitions, body.Total = nil, 0
+			if !reflect.DeepEqual(body, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, body)
+			}
+		})
+	}
+}
+
+func TestGetByAdvisoryID(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	for _, root := range []*models.Root{
+		{
+			Family:    c.RedHat,
+			OSVersion: "7",
+			Definitions: []models.Definition{{
+				DefinitionID:  "oval:com.redhat.rhsa:def:20230001",
+				Advisory:      models.Advisory{AdvisoryID: "RHSA-2023:0001", Cves: []models.Cve{{CveID: "CVE-2023-0001"}}},
+				AffectedPacks: []models.Package{{Name: "openssl", Version: "1:1.0.2k-26.el7_9"}},
+			}},
+		},
+		{
+			Family:    c.Debian,
+			OSVersion: "12",
+			Definitions: []models.Definition{{
+				DefinitionID:  "oval:org.debian:def:20230001",
+				Advisory:      models.Advisory{AdvisoryID: "DSA-5417-1", Cves: []models.Cve{{CveID: "CVE-2023-0001"}}},
+				AffectedPacks: []models.Package{{Name: "openssl", Version: "3.0.9-1"}},
+			}},
+		},
+	} {
+		if _, err := driver.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+	e := newTestEcho(t, driver, nil)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       advisoriesResponse
+		wantIDs    []string
+		wantErr    string
+	}{
+		{path: "/advisories/redhat/7/RHSA-2023:0001", wantStatus: http.StatusOK, want: advisoriesResponse{Family: c.RedHat, Release: "7", AdvisoryID: "RHSA-2023:0001"}, wantIDs: []string{"oval:com.redhat.rhsa:def:20230001"}},
+		{path: "/advisories/redhat/7/RHSA-2023%3A0001", wantStatus: http.StatusOK, want: advisoriesResponse{Family: c.RedHat, Release: "7", AdvisoryID: "RHSA-2023:0001"}, wantIDs: []string{"oval:com.redhat.rhsa:def:20230001"}},
+		{path: "/advisories/debian/bookworm/dsa-5417", wantStatus: http.StatusOK, want: advisoriesResponse{Family: c.Debian, Release: "12", AdvisoryID: "dsa-5417"}, wantIDs: []string{"oval:org.debian:def:20230001"}},
+		{path: "/advisories/debian/12/DSA-5417-1?arch=amd64", wantStatus: http.StatusOK, want: advisoriesResponse{Family: c.Debian, Release: "12", AdvisoryID: "DSA-5417-1", Arch: "amd64"}, wantIDs: []string{"oval:org.debian:def:20230001"}},
+		{path: "/advisories/debian/12/DSA-5418-1", wantStatus: http.StatusOK, want: advisoriesResponse{Family: c.Debian, Release: "12", AdvisoryID: "DSA-5418-1"}, wantIDs: []string{}},
+		{path: "/advisories/windows/10/DSA-5417-1", wantStatus: http.StatusBadRequest, wantErr: "unknown family: windows"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected: %d, actual: %d, body: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantErr != "" {
+				var body errorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("Failed to unmarshal. err: %s", err)
+				}
+				if body.Error != tt.wantErr {
+					t.Errorf("expected: %s, actual: %s", tt.wantErr, body.Error)
+				}
+				return
+			}
+
+			var body advisoriesResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to unmarshal. err: %s", err)
+			}
+			if body.Definitions == nil {
+				t.Fatalf("expected: [], actual: null")
+			}
+			ids := []string{}
+			for _, d := range body.Definitions {
+				ids = append(ids, d.DefinitionID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("expected: %q, actual: %q", tt.wantIDs, ids)
+			}
+			body.Definitions = nil
+			if !reflect.DeepEqual(body, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, body)
+			}
+		})
+	}
+}
+
+func TestGetByCpe(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	for _, root := range []*models.Root{
+		{
+			Family:    c.Oracle,
+			OSVersion: "8",
+			Definitions: []models.Definition{{
+				DefinitionID: "oval:com.oracle.elsa:def:20230001",
+				Advisory:     models.Advisory{AdvisoryID: "ELSA-2023-0001", AffectedCPEList: []models.Cpe{{Cpe: "cpe:/o:oracle:linux:8"}}},
+				AffectedPacks: []models.Package{
+					{Name: "openssl", Version: "1:1.1.1k-9.el8_7", Arch: "x86_64"},
+					{Name: "openssl", Version: "1:1.1.1k-9.el8_7", Arch: "aarch64"},
+				},
+			}},
+		},
+		{
+			Family:    c.Debian,
+			OSVersion: "12",
+			Definitions: []models.Definition{{
+				DefinitionID:  "oval:org.debian:def:20230001",
+				Advisory:      models.Advisory{AdvisoryID: "DSA-5417-1", AffectedCPEList: []models.Cpe{{Cpe: "cpe:/o:debian:debian_linux:12"}}},
+				AffectedPacks: []models.Package{{Name: "openssl", Version: "3.0.9-1"}},
+			}},
+		},
+	} {
+		if _, err := driver.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+	e := newTestEcho(t, driver, nil)
+
+	tests := []struct {
+		path      string
+		want      cpesResponse
+		wantIDs   []string
+		wantArchs []string
+	}{
+		{path: "/cpes/debian/bookworm/cpe:%2Fo:debian:debian_linux", want: cpesResponse{Family: c.Debian, Release: "12", Cpe: "cpe:/o:debian:debian_linux"}, wantIDs: []string{"oval:org.debian:def:20230001"}, wantArchs: []string{""}},
+		{path: "/cpes/oracle/8/cpe:%2Fo:oracle:linux:8?collapse_arch=false", want: cpesResponse{Family: c.Oracle, Release: "8", Cpe: "cpe:/o:oracle:linux:8"}, wantIDs: []string{"oval:com.oracle.elsa:def:20230001"}, wantArchs: []string{"aarch64", "x86_64"}},
+		{path: "/cpes/oracle/8/cpe:%2Fo:oracle:linux:8?arch=x86_64", want: cpesResponse{Family: c.Oracle, Release: "8", Cpe: "cpe:/o:oracle:linux:8", Arch: "x86_64"}, wantIDs: []string{"oval:com.oracle.elsa:def:20230001"}, wantArchs: []string{"x86_64"}},
+		{path: "/cpes/oracle/8/cpe:%2Fo:oracle:linux:8/aarch64", want: cpesResponse{Family: c.Oracle, Release: "8", Cpe: "cpe:/o:oracle:linux:8", Arch: "aarch64"}, wantIDs: []string{"oval:com.oracle.elsa:def:20230001"}, wantArchs: []string{"aarch64"}},
+		{path: "/cpes/oracle/9/cpe:%2Fo:oracle:linux:9", want: cpesResponse{Family: c.Oracle, Release: "9", Cpe: "cpe:/o:oracle:linux:9", Warning: "release not fetched: oracle 9 is not in DB, fetch it first. Releases of oracle in DB: 8"}, wantIDs: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected: %d, actual: %d, body: %s", http.StatusOK, rec.Code, rec.Body)
+			}
+
+			var body cpesResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to unmarshal. err: %s", err)
+			}
+			if body.Definitions == nil {
+				t.Fatalf("expected: [], actual: null")
+			}
+			ids, archs := []string{}, []string{}
+			for _, d := range body.Definitions {
+				ids = append(ids, d.DefinitionID)
+				for _, p := range d.AffectedPacks {
+					archs = append(archs, p.Arch)
+				}
+			}
+			sort.Strings(archs)
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("expected: %q, actual: %q", tt.wantIDs, ids)
+			}
+			if len(tt.wantArchs) > 0 && !reflect.DeepEqual(archs, tt.wantArchs) {
+				t.Errorf("expected the packages of %q, actual: %q", tt.wantArchs, archs)
+			}
+			body.Definitions = nil
+			if !reflect.DeepEqual(body, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, body)
+			}
+		})
+	}
+}
+
+func TestFamiliesAndCount(t *testing.T) {
+	ts := newTestServer(t, map[string]string{c.RedHat: "8", c.Debian: "12"})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       string
+	}{
+		{
+			path:       "/families",
+			wantStatus: http.StatusOK,
+			want: `[{"family":"debian","release":"12","definitions":1,"packages":2,"lastFetched":"2023-07-06T00:00:00Z"},` +
+				`{"family":"redhat","release":"8","definitions":1,"packages":2,"lastFetched":"2023-07-06T00:00:00Z"}]`,
+		},
+		{
+			path:       "/count/redhat/8.6",
+			wantStatus: http.StatusOK,
+			want:       `{"family":"redhat","release":"8","definitions":1,"packages":2,"lastFetched":"2023-07-06T00:00:00Z"}`,
+		},
+		{
+			path:       "/count/raspbian/bookworm",
+			wantStatus: http.StatusOK,
+			want:       `{"family":"debian","release":"12","definitions":1,"packages":2,"lastFetched":"2023-07-06T00:00:00Z"}`,
+		},
+		{
+			path:       "/count/ubuntu/22.04",
+			wantStatus: http.StatusOK,
+			want:       `{"family":"ubuntu","release":"22.04","definitions":0,"packages":0}`,
+		},
+		{
+			path:       "/count/windows/10",
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":"unknown family: windows"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, err := http.Get(ts.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Failed to GET. err: %s", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("expected: %d, actual: %d", tt.wantStatus, res.StatusCode)
+			}
+			bs, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("Failed to read body. err: %s", err)
+			}
+			if strings.TrimSpace(string(bs)) != tt.want {
+				t.Errorf("expected: %s, actual: %s", tt.want, bs)
+			}
+		})
+	}
+}
+
+func TestGetPackages(t *testing.T) {
+	ts := newTestServer(t, map[string]string{c.RedHat: "8", c.Debian: "12"})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       string
+	}{
+		{
+			path:       "/packages/redhat/8.6",
+			wantStatus: http.StatusOK,
+			want:       `{"family":"redhat","release":"8.6","packages":["libstdc++","python3.11"]}`,
+		},
+		{
+			path:       "/packages/debian/bookworm",
+			wantStatus: http.StatusOK,
+			want:       `{"family":"debian","release":"12","packages":["libstdc++","python3.11"]}`,
+		},
+		{
+			path:       "/packages/ubuntu/22.04",
+			wantStatus: http.StatusOK,
+			want:       `{"family":"ubuntu","release":"22.04","packages":[],"warning":"release not fetched: ubuntu 22.04 is not in DB, fetch it first. No releases of ubuntu in DB"}`,
+		},
+		{
+			path:       "/packages/windows/10",
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":"unknown family: windows"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, err := http.Get(ts.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Failed to GET. err: %s", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("expected: %d, actual: %d", tt.wantStatus, res.StatusCode)
+			}
+			bs, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("Failed to read body. err: %s", err)
+			}
+			if strings.TrimSpace(string(bs)) != tt.want {
+				t.Errorf("expected: %s, actual: %s", tt.want, bs)
+			}
+		})
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	ts := newTestServer(t, map[string]string{c.RedHat: "8", c.Debian: "12"})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       []models.FetchHistory
+	}{
+		{
+			path:       "/history/redhat/8.6",
+			wantStatus: http.StatusOK,
+			want:       []models.FetchHistory{{Family: c.RedHat, OSVersion: "8", Timestamp: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC), Definitions: 1, Cves: 1, New: 1}},
+		},
+		{
+			path:       "/history/debian/bookworm?since=2023-07-06",
+			wantStatus: http.StatusOK,
+			want:       []models.FetchHistory{{Family: c.Debian, OSVersion: "12", Timestamp: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC), Definitions: 1, Cves: 1, New: 1}},
+		},
+		{
+			path:       "/history/redhat/8?since=" + url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)),
+			wantStatus: http.StatusOK,
+			want:       []models.FetchHistory{},
+		},
+		{
+			path:       "/history/ubuntu/22.04",
+			wantStatus: http.StatusOK,
+			want:       []models.FetchHistory{},
+		},
+		{
+			path:       "/history/redhat/8?since=yesterday",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			path:       "/history/windows/10",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, err := http.Get(ts.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Failed to GET. err: %s", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("expected: %d, actual: %d", tt.wantStatus, res.StatusCode)
+			}
+			if tt.want == nil {
+				return
+			}
+			var body historyResponse
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode. err: %s", err)
+			}
+			for i := range body.History {
+				if body.History[i].RefreshedAt.IsZero() {
+					t.Errorf("expected: refreshedAt, actual: zero")
+				}
+				body.History[i].RefreshedAt = time.Time{}
+			}
+			if !reflect.DeepEqual(body.History, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, body.History)
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	ts := newTestServer(t, map[string]string{c.RedHat: "8", c.Debian: "12"})
+
+	res, err := http.Get(ts.URL + "/capabilities")
+	if err != nil {
+		t.Fatalf("Failed to GET. err: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected: %d, actual: %d", http.StatusOK, res.StatusCode)
+	}
+	bs, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Failed to read body. err: %s", err)
+	}
+	var actual bytes.Buffer
+	if err := json.Indent(&actual, bs, "", "  "); err != nil {
+		t.Fatalf("Failed to indent. err: %s", err)
+	}
+
+	golden := filepath.Join("testdata", "capabilities.json")
+	if *update {
+		if err := os.WriteFile(golden, actual.Bytes(), 0644); err != nil {
+			t.Fatalf("Failed to update golden file. err: %s", err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read golden file. err: %s", err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(expected), bytes.TrimSpace(actual.Bytes())) {
+		t.Errorf("expected: %s\n  actual: %s\n", expected, actual.Bytes())
+	}
+}
+
+func TestLookupsUnknownFamily(t *testing.T) {
+	ts := newTestServer(t, map[string]string{c.Debian: "12"})
+
+	for _, path := range []string{"/packs/windows/10/libstdc++", "/cves/windows/10/CVE-2023-0001", "/cpes/windows/10/cpe:%2Fo:microsoft:windows_10", "/lastmodified/windows/10"} {
+		t.Run(path, func(t *testing.T) {
+			res, err := http.Get(ts.URL + path)
+			if err != nil {
+				t.Fatalf("Failed to GET. err: %s", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusBadRequest {
+				t.Errorf("expected: %d, actual: %d", http.StatusBadRequest, res.StatusCode)
+			}
+			bs, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("Failed to read body. err: %s", err)
+			}
+			if want := `{"error":"unknown family: windows"}`; strings.TrimSpace(string(bs)) != want {
+				t.Errorf("expected: %s, actual: %s", want, bs)
+			}
+		})
+	}
+}
+
+func TestGetLastModified(t *testing.T) {
+	ts := newTestServer(t, map[string]string{c.RedHat: "8", c.Debian: "12"})
+
+	for _, path := range []string{"/lastmodified/redhat/8", "/lastmodified/rhel/8", "/lastmodified/centos/8", "/lastmodified/debian/bookworm"} {
+		t.Run(path, func(t *testing.T) {
+			res, err := http.Get(ts.URL + path)
+			if err != nil {
+				t.Fatalf("Failed to GET. err: %s", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("expected: %d, actual: %d", http.StatusOK, res.StatusCode)
+			}
+			var got time.Time
+			if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode. err: %s", err)
+			}
+			if want := time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+				t.Errorf("expected: %s, actual: %s", want, got)
+			}
+		})
+	}
+}
+
+// blockingDB blocks the lookups until their context is done, e.g. of the slow query
+type blockingDB struct {
+	db.DB
+}
+
+func (blockingDB) GetByPackNamePage(ctx context.Context, _, _, _, _ string, _ db.Page, _ ...string) ([]models.Definition, int64, error) {
+	<-ctx.Done()
+	return nil, 0, ctx.Err()
+}
+
+func (blockingDB) GetByPackNames(ctx context.Context, _, _ string, _ []string, _ string, _ ...string) (map[string][]models.Definition, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingDB) GetByCveIDPage(ctx context.Context, _, _, _, _ string, _ db.Page) ([]models.Definition, int64, error) {
+	<-ctx.Done()
+	return nil, 0, ctx.Err()
+}
+
+func (blockingDB) GetByCpe(ctx context.Context, _, _, _, _ string) ([]models.Definition, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestLookupsQueryTimeout(t *testing.T) {
+	viper.Set("query-timeout", 100*time.Millisecond)
+	defer viper.Set("query-timeout", nil)
+	ts := httptest.NewServer(newTestEcho(t, blockingDB{DB: newTestDB(t, map[string]string{c.RedHat: "8"})}, nil))
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodGet, path: "/packs/redhat/8/libstdc++"},
+		{method: http.MethodPost, path: "/packs/redhat/8", body: `{"packages":["libstdc++"]}`},
+		{method: http.MethodGet, path: "/cves/redhat/8/CVE-2023-0001"},
+		{method: http.MethodGet, path: "/cpes/redhat/8/cpe:%2Fo:redhat:enterprise_linux:8"},
+	} {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to NewRequest. err: %s", err)
+			}
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			start := time.Now()
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to request. err: %s", err)
+			}
+			defer res.Body.Close()
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected: abandoned after the timeout, actual: %s", elapsed)
+			}
+			if res.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("expected: %d, actual: %d", http.StatusServiceUnavailable, res.StatusCode)
+			}
+			bs, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("Failed to read body. err: %s", err)
+			}
+			if want := `{"error":"query timed out after 100ms"}`; strings.TrimSpace(string(bs)) != want {
+				t.Errorf("expected: %s, actual: %s", want, bs)
+			}
+		})
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	ts := newTestServer(t, map[string]string{c.RedHat: "8"})
+	// the transport neither adds Accept-Encoding nor decompresses the response by itself
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	get := func(t *testing.T, path, acceptEncoding string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if err != nil {
+			t.Fatalf("Failed to NewRequest. err: %s", err)
+		}
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to GET. err: %s", err)
+		}
+		defer res.Body.Close()
+		bs, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("Failed to read body. err: %s", err)
+		}
+		return res, bs
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		minLength      int
+		wantStatus     int
+		wantGzip       bool
+	}{
+		{name: "gzip", path: "/packs/redhat/8/libstdc%2B%2B", acceptEncoding: "gzip, deflate", minLength: 64, wantStatus: http.StatusOK, wantGzip: true},
+		{name: "no Accept-Encoding", path: "/packs/redhat/8/libstdc%2B%2B", minLength: 64, wantStatus: http.StatusOK},
+		{name: "gzip refused by q=0", path: "/packs/redhat/8/libstdc%2B%2B", acceptEncoding: "br, gzip;q=0", minLength: 64, wantStatus: http.StatusOK},
+		{name: "tiny body", path: "/packs/redhat/8/libstdc%2B%2B", acceptEncoding: "gzip", minLength: 1 << 20, wantStatus: http.StatusOK},
+		{name: "error", path: "/packs/windows/10/libstdc%2B%2B", acceptEncoding: "gzip", minLength: 16, wantStatus: http.StatusBadRequest, wantGzip: true},
+		{name: "not found", path: "/unknown", acceptEncoding: "gzip", minLength: 16, wantStatus: http.StatusNotFound, wantGzip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(l int) { gzipMinLength = l }(gzipMinLength)
+			gzipMinLength = tt.minLength
+
+			_, plain := get(t, tt.path, "")
+			res, bs := get(t, tt.path, tt.acceptEncoding)
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status: expected: %d, actual: %d", tt.wantStatus, res.StatusCode)
+			}
+			if vary := res.Header.Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("Vary: expected: Accept-Encoding, actual: %q", vary)
+			}
+			if encoding := res.Header.Get("Content-Encoding"); (encoding == "gzip") != tt.wantGzip {
+				t.Fatalf("Content-Encoding: expected gzip: %t, actual: %q", tt.wantGzip, encoding)
+			}
+			if tt.wantGzip {
+				r, err := gzip.NewReader(bytes.NewReader(bs))
+				if err != nil {
+					t.Fatalf("Failed to gzip.NewReader. err: %s", err)
+				}
+				if bs, err = io.ReadAll(r); err != nil {
+					t.Fatalf("Failed to decompress body. err: %s", err)
+				}
+			}
+			if !json.Valid(bs) || !bytes.Equal(bs, plain) {
+				t.Errorf("expected: %s, actual: %s", plain, bs)
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     string
+		method      string
+		origin      string
+		wantStatus  int
+		wantOrigin  string
+		wantMethods string
+		wantHeaders string
+	}{
+		{
+			name:        "preflight of allowed origin",
+			origins:     "https://ui.example.com, https://ui.example.org",
+			method:      http.MethodOptions,
+			origin:      "https://ui.example.org",
+			wantStatus:  http.StatusNoContent,
+			wantOrigin:  "https://ui.example.org",
+			wantMethods: "GET,HEAD,POST,OPTIONS",
+			wantHeaders: "Accept,Accept-Encoding,Authorization,Content-Type",
+		},
+		{
+			name:       "preflight of disallowed origin",
+			origins:    "https://ui.example.com",
+			method:     http.MethodOptions,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "simple request of allowed origin",
+			origins:    "https://ui.example.com",
+			method:     http.MethodGet,
+			origin:     "https://ui.example.com",
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://ui.example.com",
+		},
+		{
+			name:       "simple request of disallowed origin",
+			origins:    "https://ui.example.com",
+			method:     http.MethodGet,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "wildcard",
+			origins:    "*",
+			method:     http.MethodGet,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusOK,
+			wantOrigin: "*",
+		},
+		{
+			name:       "none by default",
+			method:     http.MethodGet,
+			origin:     "https://ui.example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "preflight without CORS",
+			method:     http.MethodOptions,
+			origin:     "https://ui.example.com",
+			wantStatus: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("cors-allow-origins", tt.origins)
+			defer viper.Set("cors-allow-origins", nil)
+			ts := newTestServer(t, map[string]string{c.RedHat: "8"})
+
+			req, err := http.NewRequest(tt.method, ts.URL+"/packs/redhat/8/libstdc%2B%2B", nil)
+			if err != nil {
+				t.Fatalf("Failed to NewRequest. err: %s", err)
+			}
+			req.Header.Set("Origin", tt.origin)
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to request. err: %s", err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status: expected: %d, actual: %d", tt.wantStatus, res.StatusCode)
+			}
+			for h, want := range map[string]string{
+				"Access-Control-Allow-Origin":  tt.wantOrigin,
+				"Access-Control-Allow-Methods": tt.wantMethods,
+				"Access-Control-Allow-Headers": tt.wantHeaders,
+			} {
+				if actual := res.Header.Get(h); actual != want {
+					t.Errorf("%s: expected: %q, actual: %q", h, want, actual)
+				}
+			}
+		})
+	}
+}
+
+// writeTestCert writes the certificate of template signed by the parent, self-signed if nil, and its key in PEM to dir/name.{crt,key}
+func writeTestCert(t *testing.T, dir, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key. err: %s", err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate. err: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate. err: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key. err: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate. err: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key. err: %s", err)
+	}
+	return cert, key
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	notBefore, notAfter := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	ca, caKey := writeTestCert(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "goval-dictionary test CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+	writeTestCert(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	writeTestCert(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "scanner"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert, err := tls.LoadX509KeyPair(path("client.crt"), path("client.key"))
+	if err != nil {
+		t.Fatalf("Failed to load client certificate. err: %s", err)
+	}
+
+	tests := []struct {
+		name       string
+		clientCA   string
+		clientCert bool
+		wantErr    bool
+	}{
+		{name: "HTTPS"},
+		{name: "mutual TLS", clientCA: path("ca.crt"), clientCert: true},
+		{name: "client certificate required", clientCA: path("ca.crt"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := newTLSConfig(path("server.crt"), path("server.key"), tt.clientCA)
+			if err != nil {
+				t.Fatalf("Failed to newTLSConfig. err: %s", err)
+			}
+			plain := newTestServer(t, map[string]string{c.RedHat: "8"})
+			ts := httptest.NewUnstartedServer(plain.Config.Handler)
+			ts.TLS = tlsConfig
+			ts.StartTLS()
+			defer ts.Close()
+
+			clientConfig := &tls.Config{RootCAs: roots}
+			if tt.clientCert {
+				clientConfig.Certificates = []tls.Certificate{clientCert}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig, ForceAttemptHTTP2: true}}
+			res, err := client.Get(ts.URL + "/packs/redhat/8/libstdc%2B%2B")
+			if tt.wantErr {
+				if err == nil {
+					res.Body.Close()
+					t.Fatal("expected error, actual: nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to GET. err: %s", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("status: expected: %d, actual: %d", http.StatusOK, res.StatusCode)
+			}
+			if res.ProtoMajor != 2 {
+				t.Errorf("protocol: expected: HTTP/2, actual: %s", res.Proto)
+			}
+			var body packsResponse
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode body. err: %s", err)
+			}
+			if len(body.Definitions) != 1 {
+				t.Errorf("definitions: expected: 1, actual: %d", len(body.Definitions))
+			}
+		})
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCert(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, nil, nil)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name                    string
+		cert, key, clientCA     string
+		wantNil, wantClientAuth bool
+		wantErr                 string
+	}{
+		{name: "HTTP", wantNil: true},
+		{name: "HTTPS", cert: path("server.crt"), key: path("server.key")},
+		{name: "mutual TLS", cert: path("server.crt"), key: path("server.key"), clientCA: path("server.crt"), wantClientAuth: true},
+		{name: "cert only", cert: path("server.crt"), wantErr: "both --tls-cert and --tls-key are required"},
+		{name: "key only", key: path("server.key"), wantErr: "both --tls-cert and --tls-key are required"},
+		{name: "client CA only", clientCA: path("server.crt"), wantErr: "both --tls-cert and --tls-key are required"},
+		{name: "unreadable cert", cert: path("missing.crt"), key: path("server.key"), wantErr: "Failed to load TLS certificate"},
+		{name: "unreadable client CA", cert: path("server.crt"), key: path("server.key"), clientCA: path("missing.crt"), wantErr: "Failed to read TLS client CA"},
+		{name: "client CA not PEM", cert: path("server.crt"), key: path("server.key"), clientCA: path("server.key"), wantErr: "no certificate in PEM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := newTLSConfig(tt.cert, tt.key, tt.clientCA)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error: %q, actual: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to newTLSConfig. err: %s", err)
+			}
+			if (tlsConfig == nil) != tt.wantNil {
+				t.Fatalf("expected nil: %t, actual: %v", tt.wantNil, tlsConfig)
+			}
+			if tlsConfig != nil && (tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert) != tt.wantClientAuth {
+				t.Errorf("expected client auth: %t, actual: %s", tt.wantClientAuth, tlsConfig.ClientAuth)
+			}
+		})
+	}
+}
+
+func TestStartUnixSocket(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, path string)
+		wantErr string
+	}{
+		{name: "new socket"},
+		{
+			name: "stale socket",
+			prepare: func(t *testing.T, path string) {
+				l, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatalf("Failed to listen. err: %s", err)
+				}
+				// left as the server killed leaves it
+				l.(*net.UnixListener).SetUnlinkOnClose(false)
+				l.Close()
+			},
+		},
+		{
+			name: "socket in use",
+			prepare: func(t *testing.T, path string) {
+				l, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatalf("Failed to listen. err: %s", err)
+				}
+				t.Cleanup(func() { l.Close() })
+			},
+			wantErr: "another server is listening on it",
+		},
+		{
+			name: "not a socket",
+			prepare: func(t *testing.T, path string) {
+				if err := os.WriteFile(path, nil, 0600); err != nil {
+					t.Fatalf("Failed to write file. err: %s", err)
+				}
+			},
+			wantErr: "not a socket",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := newTestDB(t, map[string]string{c.RedHat: "8"})
+			path := filepath.Join(t.TempDir(), "goval-dictionary.sock")
+			if tt.prepare != nil {
+				tt.prepare(t, path)
+			}
+			for k, v := range map[string]any{"listen": "unix://" + path, "socket-mode": "0600", "quiet": true} {
+				viper.Set(k, v)
+				defer viper.Set(k, nil)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errc := make(chan error, 1)
+			go func() { errc <- Start(ctx, driver, nil) }()
+
+			if tt.wantErr != "" {
+				if err := <-errc; err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error: %q, actual: %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", path)
+				},
+			}}
+			var res *http.Response
+			for i := 0; ; i++ {
+				var err error
+				if res, err = client.Get("http://unix/packs/redhat/8/libstdc%2B%2B"); err == nil {
+					break
+				}
+				if i == 50 {
+					t.Fatalf("Failed to GET. err: %s", err)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("status: expected: %d, actual: %d", http.StatusOK, res.StatusCode)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Failed to stat socket. err: %s", err)
+			}
+			if fi.Mode().Perm() != 0600 {
+				t.Errorf("mode: expected: 0600, actual: %04o", fi.Mode().Perm())
+			}
+
+			cancel()
+			if err := <-errc; err != nil {
+				t.Fatalf("Failed to Start. err: %s", err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("expected the socket removed on shutdown, actual: %v", err)
+			}
+		})
+	}
+}
+
+// slowDB delays the lookups by the package names, e.g. of kernel of several MB, telling started when one starts
+type slowDB struct {
+	db.DB
+	delay   time.Duration
+	started chan struct{}
+}
+
+func (d slowDB) GetByPackNamePage(ctx context.Context, family string, osVer string, packName string, arch string, page db.Page, classes ...string) ([]models.Definition, int64, error) {
+	d.started <- struct{}{}
+	time.Sleep(d.delay)
+	return d.DB.GetByPackNamePage(ctx, family, osVer, packName, arch, page, classes...)
+}
+
+func TestListenAddrs(t *testing.T) {
+	tests := []struct {
+		name    string
+		listen  string
+		bind    string
+		want    []listenAddr
+		wantErr string
+	}{
+		{name: "IPv4 bind", bind: "127.0.0.1", want: []listenAddr{{network: "tcp", address: "127.0.0.1:1324"}}},
+		{name: "IPv6 bind", bind: "::", want: []listenAddr{{network: "tcp", address: "[::]:1324"}}},
+		{name: "bracketed IPv6 bind", bind: "[fd00::1]", want: []listenAddr{{network: "tcp", address: "[fd00::1]:1324"}}},
+		{name: "socket", listen: "unix:///run/goval.sock", bind: "::", want: []listenAddr{{network: "unix", address: "/run/goval.sock"}}},
+		{
+			name:   "several",
+			listen: "tcp://[::1]:1324, 127.0.0.1:1324,unix:///run/goval.sock",
+			want: []listenAddr{
+				{network: "tcp", address: "[::1]:1324"},
+				{network: "tcp", address: "127.0.0.1:1324"},
+				{network: "unix", address: "/run/goval.sock"},
+			},
+		},
+		{name: "IPv6 without brackets", listen: "tcp://fd00::1:1324", wantErr: "neither unix:///path/to/socket nor tcp://host:port"},
+		{name: "no port", listen: "127.0.0.1", wantErr: "neither unix:///path/to/socket nor tcp://host:port"},
+		{name: "empty address", listen: "127.0.0.1:1324,", wantErr: "neither unix:///path/to/socket nor tcp://host:port"},
+		{name: "no socket path", listen: "unix://", wantErr: "is not unix:///path/to/socket"},
+		{name: "duplicate", listen: "127.0.0.1:1324,tcp://127.0.0.1:1324", wantErr: "is duplicated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, err := listenAddrs(tt.listen, tt.bind, "1324")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error: %q, actual: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(addrs, tt.want) {
+				t.Errorf("expected: %+v, actual: %+v", tt.want, addrs)
+			}
+		})
+	}
+}
+
+func TestStartListeners(t *testing.T) {
+	listen := []string{"tcp://127.0.0.1:0", "unix://" + filepath.Join(t.TempDir(), "goval-dictionary.sock")}
+	if l, err := net.Listen("tcp", "[::1]:0"); err != nil {
+		t.Logf("Skipped IPv6 without [::1]. err: %s", err)
+	} else {
+		l.Close()
+		listen = append(listen, "tcp://[::1]:0")
+	}
+	for k, v := range map[string]any{"listen": strings.Join(listen, ","), "socket-mode": "0600", "access-log": false} {
+		viper.Set(k, v)
+		defer viper.Set(k, nil)
+	}
+	urls := make(chan string, len(listen))
+	log15.Root().SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		if r.Msg == "Listening..." {
+			urls <- r.Ctx[1].(string)
+		}
+		return nil
+	}))
+	defer log15.Root().SetHandler(log15.StderrHandler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- Start(ctx, newTestDB(t, map[string]string{c.RedHat: "8"}), nil) }()
+
+	// every listener is logged with the port resolved, and serves the lookups
+	for range listen {
+		var u string
+		select {
+		case u = <-urls:
+		case err := <-errc:
+			t.Fatalf("Failed to start. err: %v", err)
+		}
+		network, address, _ := strings.Cut(u, "://")
+		if strings.HasSuffix(address, ":0") {
+			t.Errorf("expected: the port resolved, actual: %s", u)
+		}
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, address)
+			},
+		}}
+		res, err := client.Get("http://goval-dictionary/packs/redhat/8/libstdc%2B%2B")
+		if err != nil {
+			t.Errorf("%s: Failed to GET. err: %s", u, err)
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s: status: expected: %d, actual: %d", u, http.StatusOK, res.StatusCode)
+		}
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("Failed to shut down. err: %s", err)
+	}
+	if _, err := os.Stat(strings.TrimPrefix(listen[1], "unix://")); !os.IsNotExist(err) {
+		t.Errorf("expected: the socket removed, actual: %v", err)
+	}
+}
+
+func TestStartListenFailure(t *testing.T) {
+	// the address in use fails to start, closing the socket listened on before it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen. err: %s", err)
+	}
+	defer l.Close()
+	path := filepath.Join(t.TempDir(), "goval-dictionary.sock")
+	for k, v := range map[string]any{"listen": "unix://" + path + ",tcp://" + l.Addr().String(), "socket-mode": "0600", "quiet": true} {
+		viper.Set(k, v)
+		defer viper.Set(k, nil)
+	}
+	if err := Start(context.Background(), newTestDB(t, map[string]string{c.RedHat: "8"}), nil); err == nil || !strings.Contains(err.Error(), "Failed to listen") {
+		t.Errorf("expected error: %q, actual: %v", "Failed to listen", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected: the socket removed, actual: %v", err)
+	}
+}
+
+func TestStartShutdown(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		wantInFlight bool
+		wantErr      error
+	}{
+		{name: "in-flight request finishes", timeout: 10 * time.Second, wantInFlight: true},
+		{name: "in-flight request closed after timeout", timeout: 100 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := slowDB{DB: newTestDB(t, map[string]string{c.RedHat: "8"}), delay: time.Second, started: make(chan struct{}, 1)}
+			path := filepath.Join(t.TempDir(), "goval-dictionary.sock")
+			for k, v := range map[string]any{"listen": "unix://" + path, "socket-mode": "0600", "shutdown-timeout": tt.timeout, "quiet": true} {
+				viper.Set(k, v)
+				defer viper.Set(k, nil)
+			}
+
+			// as main cancels the context of the commands
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+			defer stop()
+			errc := make(chan error, 1)
+			go func() { errc <- Start(ctx, driver, nil) }()
+
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", path)
+				},
+				DisableKeepAlives: true,
+			}}
+			get := func(path string) (int, error) {
+				res, err := client.Get("http://unix" + path)
+				if err != nil {
+					return 0, err
+				}
+				defer res.Body.Close()
+				if _, err := io.Copy(io.Discard, res.Body); err != nil {
+					return 0, err
+				}
+				return res.StatusCode, nil
+			}
+			for i := 0; ; i++ {
+				if _, err := get("/health"); err == nil {
+					break
+				} else if i == 50 {
+					t.Fatalf("Failed to GET. err: %s", err)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			type result struct {
+				status int
+				err    error
+			}
+			inFlight := make(chan result, 1)
+			go func() {
+				status, err := get("/packs/redhat/8/libstdc%2B%2B")
+				inFlight <- result{status: status, err: err}
+			}()
+			<-driver.started
+
+			p, err := os.FindProcess(os.Getpid())
+			if err != nil {
+				t.Fatalf("Failed to FindProcess. err: %s", err)
+			}
+			if err := p.Signal(syscall.SIGTERM); err != nil {
+				t.Fatalf("Failed to send SIGTERM. err: %s", err)
+			}
+
+			// the new requests are refused while the one in flight is served
+			for i := 0; ; i++ {
+				if _, err := get("/health"); err != nil {
+					break
+				} else if i == 50 {
+					t.Fatal("expected the new request refused after SIGTERM, actual: served")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			r := <-inFlight
+			if tt.wantInFlight {
+				if r.err != nil || r.status != http.StatusOK {
+					t.Errorf("expected the in-flight request served, actual: status: %d, err: %v", r.status, r.err)
+				}
+			} else if r.err == nil {
+				t.Errorf("expected the in-flight request closed, actual: status: %d", r.status)
+			}
+
+			err = <-errc
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("Failed to shut down. err: %s", err)
+			case tt.wantErr != nil && !xerrors.Is(err, tt.wantErr):
+				t.Errorf("expected error: %v, actual: %v", tt.wantErr, err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("expected the socket removed on shutdown, actual: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuth(t *testing.T) {
+	dir := t.TempDir()
+	tokensFile := filepath.Join(dir, "tokens")
+	if err := os.WriteFile(tokensFile, []byte("# the scanners\nscanner-a: token-a\n\nscanner-b:token-b\n"), 0600); err != nil {
+		t.Fatalf("Failed to write tokens file. err: %s", err)
+	}
+	for k, v := range map[string]any{"auth-token": "token-default", "auth-tokens-file": tokensFile, "access-log": true} {
+		viper.Set(k, v)
+		defer viper.Set(k, nil)
+	}
+	records := make(chan *log15.Record, 100)
+	log15.Root().SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		records <- r
+		return nil
+	}))
+	defer log15.Root().SetHandler(log15.StderrHandler)
+
+	e := newTestEcho(t, newTestDB(t, map[string]string{c.RedHat: "8"}), nil)
+	paths := []string{"/packs/redhat/8/libstdc++", "/cves/redhat/8/CVE-2023-0001", "/cpes/redhat/8/cpe:%2Fo:redhat:8", "/families", "/count/redhat/8"}
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantName      string
+	}{
+		{name: "default", authorization: "Bearer token-default", wantStatus: http.StatusOK, wantName: "default"},
+		{name: "named", authorization: "Bearer token-a", wantStatus: http.StatusOK, wantName: "scanner-a"},
+		{name: "case-insensitive scheme", authorization: "bearer token-b", wantStatus: http.StatusOK, wantName: "scanner-b"},
+		{name: "invalid", authorization: "Bearer token-c", wantStatus: http.StatusUnauthorized},
+		{name: "prefix of token", authorization: "Bearer token-", wantStatus: http.StatusUnauthorized},
+		{name: "not bearer", authorization: "Basic token-a", wantStatus: http.StatusUnauthorized},
+		{name: "no token", authorization: "Bearer ", wantStatus: http.StatusUnauthorized},
+		{name: "missing", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, path := range paths {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				if tt.authorization != "" {
+					req.Header.Set(echo.HeaderAuthorization, tt.authorization)
+				}
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				if rec.Code != tt.wantStatus {
+					t.Errorf("%s: expected: %d, actual: %d", path, tt.wantStatus, rec.Code)
+				}
+				if tt.wantStatus == http.StatusUnauthorized {
+					if body := strings.TrimSpace(rec.Body.String()); body != `{"error":"unauthorized"}` || rec.Header().Get(echo.HeaderWWWAuthenticate) != "Bearer" {
+						t.Errorf("%s: expected: the body without detail and WWW-Authenticate, actual: %s, %q", path, body, rec.Header().Get(echo.HeaderWWWAuthenticate))
+					}
+				}
+
+				// the access log has the name of the token, never the token
+				var access *log15.Record
+				for access == nil {
+					if r := <-records; r.Msg == "Access" {
+						access = r
+					}
+				}
+				name := ""
+				for i := 0; i+1 < len(access.Ctx); i += 2 {
+					if access.Ctx[i] == "Auth" {
+						name, _ = access.Ctx[i+1].(string)
+					}
+					if v, ok := access.Ctx[i+1].(string); ok && strings.Contains(v, "token-") {
+						t.Errorf("%s: expected: no token in the access log, actual: %v", path, access.Ctx)
+					}
+				}
+				if name != tt.wantName {
+					t.Errorf("%s: Auth: expected: %q, actual: %q", path, tt.wantName, name)
+				}
+			}
+		})
+	}
+
+	// /health is exempt for the load balancer
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/health: expected: %d, actual: %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestLoadAuthTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		file      string
+		wantNames []string
+		wantErr   string
+	}{
+		{name: "none"},
+		{name: "token only", token: "t", wantNames: []string{"default"}},
+		{name: "file", token: "t", file: "a:1\n# b:2\n c : 3 \n", wantNames: []string{"default", "a", "c"}},
+		{name: "no colon", file: "a\n", wantErr: "line: 1"},
+		{name: "no token", file: "a:1\nb:\n", wantErr: "line: 2"},
+		{name: "duplicate name", file: "a:1\na:2\n", wantErr: "duplicate name"},
+		{name: "empty file", file: "# none\n", wantErr: "no token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), "tokens")
+				if err := os.WriteFile(path, []byte(tt.file), 0600); err != nil {
+					t.Fatalf("Failed to write tokens file. err: %s", err)
+				}
+			}
+			tokens, err := loadAuthTokens(tt.token, path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected: the error of %q, actual: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var names []string
+			for _, token := range tokens {
+				names = append(names, token.name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("expected: %q, actual: %q", tt.wantNames, names)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		accessLog bool
+		path      string
+		want      map[string]interface{}
+		wantLvl   log15.Lvl
+		wantPanic bool
+	}{
+		{
+			name:      "lookup",
+			accessLog: true,
+			path:      "/packs/redhat/8/libstdc%2B%2B",
+			want:      map[string]interface{}{"Method": "GET", "Path": "/packs/redhat/8/libstdc++", "Route": "/packs/:family/:release/:pack", "Family": "redhat", "Release": "8", "Package": "libstdc++", "Status": 200},
+			wantLvl:   log15.LvlInfo,
+		},
+		{
+			name:      "not found",
+			accessLog: true,
+			path:      "/unknown",
+			want:      map[string]interface{}{"Method": "GET", "Path": "/unknown", "Status": 404},
+			wantLvl:   log15.LvlInfo,
+		},
+		{
+			name:      "panic",
+			accessLog: true,
+			path:      "/panic/redhat",
+			want:      map[string]interface{}{"Method": "GET", "Path": "/panic/redhat", "Route": "/panic/:family", "Family": "redhat", "Status": 500},
+			wantLvl:   log15.LvlError,
+			wantPanic: true,
+		},
+		{
+			name:      "panic without access log",
+			path:      "/panic/redhat",
+			wantPanic: true,
+		},
+		{
+			name: "without access log",
+			path: "/packs/redhat/8/libstdc%2B%2B",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := make(chan *log15.Record, 10)
+			log15.Root().SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+				records <- r
+				return nil
+			}))
+			defer log15.Root().SetHandler(log15.StderrHandler)
+			viper.Set("access-log", tt.accessLog)
+			defer viper.Set("access-log", nil)
+
+			ts := newTestServer(t, map[string]string{c.RedHat: "8"})
+			ts.Config.Handler.(*echo.Echo).GET("/panic/:family", func(echo.Context) error { panic("nil map") })
+
+			res, err := http.Get(ts.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Failed to GET. err: %s", err)
+			}
+			res.Body.Close()
+			if tt.wantPanic && res.StatusCode != http.StatusInternalServerError {
+				t.Errorf("status: expected: %d, actual: %d", http.StatusInternalServerError, res.StatusCode)
+			}
+
+			// the access log is written after the response
+			var access, recovered []*log15.Record
+			timeout := time.After(200 * time.Millisecond)
+		loop:
+			for {
+				select {
+				case r := <-records:
+					switch r.Msg {
+					case "Access":
+						access = append(access, r)
+					case "Recovered from panic":
+						recovered = append(recovered, r)
+					}
+				case <-timeout:
+					break loop
+				}
+			}
+
+			if tt.wantPanic {
+				if len(recovered) != 1 || !strings.Contains(fmt.Sprint(recordContext(recovered[0])["stack"]), "TestAccessLog") {
+					t.Errorf("expected the panic logged with the stack, actual: %v", recovered)
+				}
+			}
+			if !tt.accessLog {
+				if len(access) != 0 {
+					t.Errorf("expected no access log, actual: %d lines", len(access))
+				}
+				return
+			}
+			if len(access) != 1 {
+				t.Fatalf("expected 1 line of access log, actual: %d", len(access))
+			}
+			if access[0].Lvl != tt.wantLvl {
+				t.Errorf("level: expected: %s, actual: %s", tt.wantLvl, access[0].Lvl)
+			}
+			ctx := recordContext(access[0])
+			for k, want := range tt.want {
+				if ctx[k] != want {
+					t.Errorf("%s: expected: %v, actual: %v", k, want, ctx[k])
+				}
+			}
+			for _, k := range []string{"Bytes", "Latency", "LatencyBucket", "RemoteIP"} {
+				if _, ok := ctx[k]; !ok {
+					t.Errorf("expected %s logged, actual: %v", k, ctx)
+				}
+			}
+		})
+	}
+}
+
+// recordContext returns the fields of r by the keys
+func recordContext(r *log15.Record) map[string]interface{} {
+	m := map[string]interface{}{}
+	for i := 0; i+1 < len(r.Ctx); i += 2 {
+		m[fmt.Sprint(r.Ctx[i])] = r.Ctx[i+1]
+	}
+	return m
+}
+
+func TestLatencyBucket(t *testing.T) {
+	tests := []struct {
+		latency time.Duration
+		want    string
+	}{
+		{latency: 0, want: "5ms"},
+		{latency: 5 * time.Millisecond, want: "5ms"},
+		{latency: 5*time.Millisecond + 1, want: "10ms"},
+		{latency: 2 * time.Second, want: "2.5s"},
+		{latency: time.Minute, want: "+Inf"},
+	}
+	for _, tt := range tests {
+		if got := latencyBucket(tt.latency); got != tt.want {
+			t.Errorf("latencyBucket(%s): expected: %s, actual: %s", tt.latency, tt.want, got)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(10, 20)
+	l.now = func() time.Time { return now }
+
+	hammer := func(client string, n int) (allowed, denied int, wait time.Duration) {
+		for i := 0; i < n; i++ {
+			if ok, w := l.allow(client); ok {
+				allowed++
+			} else {
+				denied++
+				wait = w
+			}
+		}
+		return allowed, denied, wait
+	}
+
+	// the burst at once, then the rate per second
+	if allowed, denied, wait := hammer("192.0.2.1", 100); allowed != 20 || denied != 80 || wait != 100*time.Millisecond {
+		t.Errorf("burst: expected: 20 allowed, 80 denied, retry after 100ms, actual: %d, %d, %s", allowed, denied, wait)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if allowed, denied, _ := hammer("192.0.2.1", 100); allowed != 5 || denied != 95 {
+		t.Errorf("500ms later: expected: 5 allowed, 95 denied, actual: %d, %d", allowed, denied)
+	}
+	// the other clients have their own buckets
+	if allowed, denied, _ := hammer("192.0.2.2", 30); allowed != 20 || denied != 10 {
+		t.Errorf("the other client: expected: 20 allowed, 10 denied, actual: %d, %d", allowed, denied)
+	}
+	if len(l.clients) != 2 {
+		t.Errorf("expected: 2 clients, actual: %d", len(l.clients))
+	}
+
+	// the clients idle until their buckets are full are evicted by the next request, which is allowed the burst as before
+	now = now.Add(l.idle)
+	if allowed, denied, _ := hammer("192.0.2.3", 1); allowed != 1 || denied != 0 {
+		t.Errorf("the new client: expected: 1 allowed, actual: %d, %d", allowed, denied)
+	}
+	if len(l.clients) != 1 {
+		t.Errorf("expected: the idle clients evicted, actual: %d clients", len(l.clients))
+	}
+	if allowed, denied, _ := hammer("192.0.2.1", 30); allowed != 20 || denied != 10 {
+		t.Errorf("the evicted client: expected: 20 allowed, 10 denied, actual: %d, %d", allowed, denied)
+	}
+
+	// a client per request never grows the clients beyond the ones within the idle duration
+	for i := 0; i < 10000; i++ {
+		now = now.Add(time.Millisecond)
+		l.allow(fmt.Sprintf("198.51.100.%d:%d", i%256, i))
+	}
+	if max := int(l.idle/time.Millisecond) + 1; len(l.clients) > max {
+		t.Errorf("expected: up to %d clients, actual: %d", max, len(l.clients))
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		trust     bool
+		wantOther int // the status of the request of the other client forwarded by the same proxy
+	}{
+		{name: "the proxy is the client", wantOther: http.StatusTooManyRequests},
+		{name: "X-Forwarded-For of the trusted proxy", trust: true, wantOther: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range map[string]any{"rate-limit": 0.5, "rate-burst": 2, "trust-proxy-headers": tt.trust} {
+				viper.Set(k, v)
+				defer viper.Set(k, nil)
+			}
+			e := newTestEcho(t, newTestDB(t, map[string]string{c.RedHat: "8"}), nil)
+			get := func(path, client string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.RemoteAddr = "10.0.0.1:12345"
+				req.Header.Set(echo.HeaderXForwardedFor, client)
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				return rec
+			}
+
+			for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+				rec := get("/packs/redhat/8/libstdc++", "203.0.113.1")
+				if rec.Code != want {
+					t.Errorf("[%d] expected: %d, actual: %d", i, want, rec.Code)
+				}
+				if want == http.StatusTooManyRequests && rec.Header().Get(echo.HeaderRetryAfter) != "2" {
+					t.Errorf("[%d] Retry-After: expected: 2, actual: %q", i, rec.Header().Get(echo.HeaderRetryAfter))
+				}
+			}
+			if rec := get("/packs/redhat/8/libstdc++", "203.0.113.2"); rec.Code != tt.wantOther {
+				t.Errorf("the other client: expected: %d, actual: %d", tt.wantOther, rec.Code)
+			}
+			// never of /health
+			if rec := get("/health", "203.0.113.1"); rec.Code != http.StatusOK {
+				t.Errorf("/health: expected: %d, actual: %d", http.StatusOK, rec.Code)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	// never without --metrics
+	ts := newTestServer(t, map[string]string{c.RedHat: "8"})
+	res, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to GET. err: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected: %d without --metrics, actual: %d", http.StatusNotFound, res.StatusCode)
+	}
+
+	viper.Set("metrics", true)
+	defer viper.Set("metrics", nil)
+	ts = newTestServer(t, map[string]string{c.RedHat: "8", c.Debian: "12"})
+	for _, path := range []string{"/packs/redhat/8/libstdc%2B%2B", "/packs/redhat/8/python3.11", "/cves/redhat/8/CVE-2023-0001", "/packs/windows/10/g++"} {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to GET. err: %s", err)
+		}
+		res.Body.Close()
+	}
+
+	res, err = http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to GET. err: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get(echo.HeaderContentType) != metrics.ContentType {
+		t.Fatalf("expected: %d in %s, actual: %d in %s", http.StatusOK, metrics.ContentType, res.StatusCode, res.Header.Get(echo.HeaderContentType))
+	}
+	// the series by the name with the labels, e.g. goval_dictionary_definitions{family="redhat",release="8"}
+	samples := map[string]float64{}
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("Failed to parse sample %q. err: %s", line, err)
+		}
+		samples[line[:i]] = v
+	}
+
+	for name, want := range map[string]float64{
+		`goval_dictionary_http_requests_total{method="GET",route="/packs/:family/:release/:pack",status="200"}`:                            2,
+		`goval_dictionary_http_requests_total{method="GET",route="/packs/:family/:release/:pack",status="400"}`:                            1,
+		`goval_dictionary_http_requests_total{method="GET",route="/cves/:family/:release/:id",status="200"}`:                               1,
+		`goval_dictionary_http_request_duration_seconds_count{method="GET",route="/packs/:family/:release/:pack",status="200"}`:            2,
+		`goval_dictionary_http_request_duration_seconds_bucket{method="GET",route="/packs/:family/:release/:pack",status="200",le="+Inf"}`: 2,
+		`goval_dictionary_db_query_duration_seconds_count{method="GetByPackNamePage"}`:                                                     2,
+		`goval_dictionary_db_query_duration_seconds_count{method="GetByCveIDPage"}`:                                                        1,
+	} {
+		// the counters of the process count the requests of the other tests as well
+		if v, ok := samples[name]; !ok || v < want {
+			t.Errorf("%s: expected: %v or more, actual: %v", name, want, v)
+		}
+	}
+	for _, release := range []string{`family="debian",release="12"`, `family="redhat",release="8"`} {
+		if v := samples["goval_dictionary_definitions{"+release+"}"]; v != 1 {
+			t.Errorf("definitions of %s: expected: 1, actual: %v", release, v)
+		}
+		// the OVAL of the test DB was fetched on 2023-07-06
+		if v := samples["goval_dictionary_oval_age_seconds{"+release+"}"]; v < time.Since(time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)).Seconds()-60 {
+			t.Errorf("age of %s: expected: the seconds since 2023-07-06, actual: %v", release, v)
+		}
+	}
+	if v := samples["goval_dictionary_http_request_duration_seconds_sum{method=\"GET\",route=\"/packs/:family/:release/:pack\",status=\"200\"}"]; v <= 0 || v > 60 {
+		t.Errorf("expected: the sum of the latencies within a minute, actual: %v", v)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	ts := newTestServer(t, map[string]string{c.RedHat: "8"})
+	for _, path := range []string{"/packs/redhat/8/libstdc%2B%2B", "/families", "/families"} {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to GET. err: %s", err)
+		}
+		res.Body.Close()
+	}
+
+	// never on the server of the lookups
+	res, err := http.Get(ts.URL + "/debug/pprof/")
+	if err != nil {
+		t.Fatalf("Failed to GET. err: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("/debug/pprof/ of the server: expected: %d, actual: %d", http.StatusNotFound, res.StatusCode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := startProfiler(ctx, "")
+	if err != nil || l != nil {
+		t.Fatalf("expected no profiler without --profile, actual: %v, err: %v", l, err)
+	}
+	if l, err = startProfiler(ctx, "127.0.0.1:0"); err != nil {
+		t.Fatalf("Failed to startProfiler. err: %s", err)
+	}
+	profileURL := "http://" + l.Addr().String()
+
+	res, err = http.Get(profileURL + "/debug/pprof/")
+	if err != nil {
+		t.Fatalf("Failed to GET. err: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("/debug/pprof/: expected: %d, actual: %d", http.StatusOK, res.StatusCode)
+	}
+
+	res, err = http.Get(profileURL + "/debug/vars")
+	if err != nil {
+		t.Fatalf("Failed to GET. err: %s", err)
+	}
+	defer res.Body.Close()
+	var vars struct {
+		Queries map[string]int `json:"db.queries"`
+		Cache   map[string]int `json:"server.cache"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&vars); err != nil {
+		t.Fatalf("Failed to decode /debug/vars. err: %s", err)
+	}
+	if vars.Queries["GetByPackNamePage"] < 1 || vars.Queries["GetRootStats"] < 1 {
+		t.Errorf("expected the lookups counted in db.queries, actual: %v", vars.Queries)
+	}
+	if vars.Cache["rootStatsHits"] < 1 || vars.Cache["rootStatsMisses"] < 1 {
+		t.Errorf("expected the hits and the misses counted in server.cache, actual: %v", vars.Cache)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	version, revision := c.Version, c.Revision
+	c.Version, c.Revision = "v1.2.3", "abc1234"
+	t.Cleanup(func() { c.Version, c.Revision = version, revision })
+
+	ts := newTestServer(t, nil)
+	res, err := http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatalf("Failed to GET. err: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected: %d, actual: %d", http.StatusOK, res.StatusCode)
+	}
+	bs, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Failed to read body. err: %s", err)
+	}
+	if want := `{"status":"ok","version":"v1.2.3","revision":"abc1234","dbType":"sqlite3"}`; strings.TrimSpace(string(bs)) != want {
+		t.Errorf("expected: %s, actual: %s", want, bs)
+	}
+
+	// with the last refresh of the server refreshing the OVAL
+	refresh := &Refresh{
+		Count:      2,
+		StartedAt:  time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2023, time.July, 6, 0, 1, 0, 0, time.UTC),
+		Status:     "failed",
+		Families:   []RefreshFamily{{Family: "debian", Status: "succeeded"}, {Family: "redhat", Status: "failed", Error: "9: Failed to fetch"}},
+	}
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	rts := httptest.NewServer(newTestEcho(t, driver, func() *Refresh { return refresh }))
+	defer rts.Close()
+	res, err = http.Get(rts.URL + "/health")
+	if err != nil {
+		t.Fatalf("Failed to GET. err: %s", err)
+	}
+	defer res.Body.Close()
+	if bs, err = io.ReadAll(res.Body); err != nil {
+		t.Fatalf("Failed to read body. err: %s", err)
+	}
+	want := `{"status":"ok","version":"v1.2.3","revision":"abc1234","dbType":"sqlite3","lastRefresh":{"count":2,"startedAt":"2023-07-06T00:00:00Z","finishedAt":"2023-07-06T00:01:00Z","status":"failed",` +
+		`"families":[{"family":"debian","status":"succeeded"},{"family":"redhat","status":"failed","error":"9: Failed to fetch"}]}}`
+	if strings.TrimSpace(string(bs)) != want {
+		t.Errorf("expected: %s, actual: %s", want, bs)
+	}
+}
+
+func TestHealthFreshness(t *testing.T) {
+	viper.Set("batch-size", 10)
+	viper.Set("stale-age", 7*24*time.Hour)
+	ttl := freshnessTTL
+	defer func() {
+		viper.Set("batch-size", nil)
+		viper.Set("stale-age", nil)
+		freshnessTTL = ttl
+	}()
+	freshnessTTL = time.Hour
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	// redhat 8 is fresh, while debian 12 has not been fetched for 30 days
+	fresh, stale := time.Now().Add(-time.Hour).UTC().Truncate(time.Second), time.Now().AddDate(0, 0, -30).UTC().Truncate(time.Second)
+	insert := func(family, osVer string, ts time.Time) {
+		root := &models.Root{Family: family, OSVersion: osVer, Timestamp: ts, Definitions: []models.Definition{{DefinitionID: fmt.Sprintf("oval:%s:def:1", family)}}}
+		if _, err := driver.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+	insert(c.RedHat, "8", fresh)
+	insert(c.Debian, "12", stale)
+	e := newTestEcho(t, driver, nil)
+
+	get := func(path string) (int, healthResponse) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body healthResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to unmarshal. err: %s", err)
+		}
+		return rec.Code, body
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantHealth string
+		wantStale  bool // debian 12 is reported as stale, unless the other families are given
+	}{
+		{path: "/health", wantStatus: http.StatusOK, wantHealth: healthOK, wantStale: true},
+		{path: "/health?strict=true", wantStatus: http.StatusServiceUnavailable, wantHealth: healthStale, wantStale: true},
+		{path: "/health?strict=true&family=debian", wantStatus: http.StatusServiceUnavailable, wantHealth: healthStale, wantStale: true},
+		{path: "/health?strict=true&family=redhat", wantStatus: http.StatusOK, wantHealth: healthOK},
+	}
+	for _, tt := range tests {
+		status, body := get(tt.path)
+		if status != tt.wantStatus || body.Status != tt.wantHealth {
+			t.Errorf("[%s] expected: %d %s, actual: %d %s", tt.path, tt.wantStatus, tt.wantHealth, status, body.Status)
+		}
+		want := []LastFetch{
+			{Family: c.Debian, OSVersion: "12", Timestamp: stale, Stale: tt.wantStale},
+			{Family: c.RedHat, OSVersion: "8", Timestamp: fresh},
+		}
+		if !reflect.DeepEqual(body.LastFetch, want) {
+			t.Errorf("[%s] expected: %+v, actual: %+v", tt.path, want, body.LastFetch)
+		}
+	}
+
+	// the timestamps are cached until freshnessTTL passes
+	insert(c.Ubuntu, "22.04", fresh)
+	if _, body := get("/health"); len(body.LastFetch) != 2 {
+		t.Errorf("expected: the cached 2 OVAL, actual: %+v", body.LastFetch)
+	}
+	freshnessTTL = 0
+	if _, body := get("/health"); len(body.LastFetch) != 3 {
+		t.Errorf("expected: 3 OVAL queried again, actual: %+v", body.LastFetch)
+	}
+
+	// DB is down
+	if err := driver.CloseDB(); err != nil {
+		t.Fatalf("Failed to CloseDB. err: %s", err)
+	}
+	status, body := get("/health")
+	if status != http.StatusServiceUnavailable || body.Status != healthUnavailable || !strings.Contains(body.Error, "Failed to ping DB") {
+		t.Errorf("expected: 503 of the closed DB, actual: %d %+v", status, body)
+	}
+}
+
+func TestConditional(t *testing.T) {
+	viper.Set("batch-size", 10)
+	ttl := freshnessTTL
+	defer func() {
+		viper.Set("batch-size", nil)
+		freshnessTTL = ttl
+	}()
+	freshnessTTL = time.Hour
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	insert := func(ts time.Time, sum string) {
+		root := &models.Root{
+			Family:    c.RedHat,
+			OSVersion: "8",
+			Timestamp: ts,
+			SHA256:    sum,
+			Definitions: []models.Definition{{
+				DefinitionID:  "oval:com.redhat.rhsa:def:20230001",
+				Advisory:      models.Advisory{Cves: []models.Cve{{CveID: "CVE-2023-0001"}}},
+				AffectedPacks: []models.Package{{Name: "openssl", Version: "1:1.1.1k-9.el8_7"}},
+			}},
+		}
+		if _, err := driver.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+	fetched := time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)
+	e := newTestEcho(t, driver, nil)
+
+	queries := func(method string) int64 {
+		if v, ok := db.Queries.Get(method).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, path := range []string{"/packs/redhat/8/openssl", "/cves/redhat/8/CVE-2023-0001", "/cpes/redhat/8/cpe:%2Fo:redhat:enterprise_linux:8"} {
+		t.Run(path, func(t *testing.T) {
+			// the OVAL refreshed by the previous path is restored, and its timestamps cached by the first request
+			insert(fetched, "0f")
+			freshnessTTL = 0
+			rec := get(path, nil)
+			freshnessTTL = time.Hour
+			lastModified, etag := rec.Header().Get(echo.HeaderLastModified), rec.Header().Get("ETag")
+			if rec.Code != http.StatusOK || lastModified != "Thu, 06 Jul 2023 00:00:00 GMT" || !strings.HasPrefix(etag, `W/"`) {
+				t.Fatalf("expected: 200 with Last-Modified and the weak ETag, actual: %d, %q, %q", rec.Code, lastModified, etag)
+			}
+
+			// the conditional requests respond 304 with neither the body nor the queries of DB, but the validators
+			timestamps, lookups := queries("GetRootTimestamps"), queries("GetByPackNamePage")+queries("GetByCveIDPage")+queries("GetByCpe")
+			for _, header := range []map[string]string{
+				{"If-None-Match": etag},
+				{"If-None-Match": `"other", ` + strings.TrimPrefix(etag, "W/")},
+				{"If-Modified-Since": lastModified},
+				{"If-Modified-Since": "Fri, 07 Jul 2023 00:00:00 GMT"},
+			} {
+				rec := get(path, header)
+				if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+					t.Errorf("%v: expected: 304 without the body, actual: %d, %q, %q", header, rec.Code, rec.Body, rec.Header().Get("ETag"))
+				}
+			}
+			if n := queries("GetRootTimestamps") - timestamps; n != 0 {
+				t.Errorf("GetRootTimestamps: expected: 0 with the cache, actual: %d", n)
+			}
+			if n := queries("GetByPackNamePage") + queries("GetByCveIDPage") + queries("GetByCpe") - lookups; n != 0 {
+				t.Errorf("lookups: expected: 0, actual: %d", n)
+			}
+
+			// If-None-Match takes precedence over If-Modified-Since
+			for _, header := range []map[string]string{
+				{"If-None-Match": `W/"other"`},
+				{"If-None-Match": `W/"other"`, "If-Modified-Since": lastModified},
+				{"If-Modified-Since": "Wed, 05 Jul 2023 00:00:00 GMT"},
+			} {
+				if rec := get(path, header); rec.Code != http.StatusOK {
+					t.Errorf("%v: expected: 200, actual: %d", header, rec.Code)
+				}
+			}
+
+			// the refresh changing the OVAL modifies them, once the cached timestamps expire
+			insert(fetched.Add(24*time.Hour), "1f")
+			freshnessTTL = 0
+			for _, header := range []map[string]string{{"If-None-Match": etag}, {"If-Modified-Since": lastModified}} {
+				rec := get(path, header)
+				if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag || rec.Header().Get(echo.HeaderLastModified) != "Fri, 07 Jul 2023 00:00:00 GMT" {
+					t.Errorf("%v: expected: 200 with the new validators, actual: %d, %q, %q", header, rec.Code, rec.Header().Get("ETag"), rec.Header().Get(echo.HeaderLastModified))
+				}
+			}
+		})
+	}
+
+	// the OVAL not stored has no validators
+	if rec := get("/packs/debian/12/openssl", map[string]string{"If-Modified-Since": "Fri, 07 Jul 2023 00:00:00 GMT"}); rec.Code != http.StatusOK || rec.Header().Get("ETag") != "" {
+		t.Errorf("expected: 200 without ETag, actual: %d, %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestValidatorsConvertDigest(t *testing.T) {
+	ts := time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)
+	etag := func(convertDigest string) string {
+		_, etag, ok := validators([]models.RootTimestamp{{Family: c.RedHat, OSVersion: "8", Timestamp: ts, SHA256: "0f", ConvertDigest: convertDigest}}, c.RedHat, "8")
+		if !ok {
+			t.Fatalf("expected: the validators of redhat 8")
+		}
+		return etag
+	}
+	// the same files refreshed by --force with other options are served under another ETag
+	if etag("aa") == etag("bb") {
+		t.Errorf("expected: the ETags of the conversions apart, actual: %s of both", etag("aa"))
+	}
+	if etag("aa") != etag("aa") {
+		t.Errorf("expected: the same ETag of the same conversion")
+	}
+}
+
+func TestPackCache(t *testing.T) {
+	ts := time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)
+	roots := []models.RootTimestamp{{Family: c.RedHat, OSVersion: "8", Timestamp: ts}}
+	var ttl time.Duration
+	fresh := &cache[[]models.RootTimestamp]{name: "testRootTimestamps", ttl: &ttl, load: func() ([]models.RootTimestamp, error) { return roots, nil }}
+	now := ts
+	packs := newPackCache(2, time.Hour, fresh)
+	packs.now = func() time.Time { return now }
+
+	loads := 0
+	lookup := func(pack string, err error) (packResult, error) {
+		return packs.lookup(packKey{family: c.RedHat, release: "8", pack: pack}, func() (packResult, error) {
+			loads++
+			return packResult{defs: []models.Definition{{DefinitionID: fmt.Sprintf("oval:%s:%d", pack, loads)}}, total: 1}, err
+		})
+	}
+	expect := func(step, pack string, wantLoads int) {
+		t.Helper()
+		result, err := lookup(pack, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", step, err)
+		}
+		if loads != wantLoads {
+			t.Errorf("%s: expected: %d loads, actual: %d", step, wantLoads, loads)
+		}
+		if !strings.HasPrefix(result.defs[0].DefinitionID, "oval:"+pack+":") {
+			t.Errorf("%s: expected: the result of %s, actual: %s", step, pack, result.defs[0].DefinitionID)
+		}
+	}
+
+	expect("miss", "kernel", 1)
+	expect("hit", "kernel", 1)
+
+	// the errors are not cached
+	if _, err := lookup("glibc", xerrors.New("DB is down")); err == nil {
+		t.Errorf("expected: the error of load, actual: nil")
+	}
+	expect("miss after error", "glibc", 3)
+	expect("hit after error", "glibc", 3)
+
+	// kernel is used more recently than glibc, which is dropped for openssl over the size of 2
+	expect("hit before eviction", "kernel", 3)
+	expect("miss of the third", "openssl", 4)
+	expect("evicted", "glibc", 5)
+	expect("kept", "openssl", 5)
+
+	// expired after ttl
+	now = now.Add(time.Hour)
+	expect("expired", "openssl", 6)
+	expect("hit after expired", "openssl", 6)
+
+	// dropped wholesale once the OVAL is refreshed
+	roots = []models.RootTimestamp{{Family: c.RedHat, OSVersion: "8", Timestamp: ts.Add(24 * time.Hour)}}
+	expect("refreshed", "openssl", 7)
+	expect("other refreshed", "glibc", 8)
+	expect("hit after refreshed", "openssl", 8)
+
+	// nil caches nothing
+	var none *packCache
+	for i := 0; i < 2; i++ {
+		if _, err := none.lookup(packKey{}, func() (packResult, error) { loads++; return packResult{}, nil }); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if loads != 10 {
+		t.Errorf("expected: 10 loads without the cache, actual: %d", loads)
+	}
+}
+
+func TestGetByPackNameCache(t *testing.T) {
+	viper.Set("batch-size", 10)
+	viper.Set("pack-cache-size", 100)
+	viper.Set("pack-cache-ttl", time.Hour)
+	ttl := freshnessTTL
+	defer func() {
+		viper.Set("batch-size", nil)
+		viper.Set("pack-cache-size", nil)
+		viper.Set("pack-cache-ttl", nil)
+		freshnessTTL = ttl
+	}()
+	freshnessTTL = 0
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	insert := func(ts time.Time, ids ...string) {
+		root := &models.Root{Family: c.RedHat, OSVersion: "8", Timestamp: ts}
+		for _, id := range ids {
+			root.Definitions = append(root.Definitions, models.Definition{DefinitionID: id, AffectedPacks: []models.Package{{Name: "kernel", Version: "0:4.18.0-477.el8"}}})
+		}
+		if _, err := driver.InsertOval(context.Background(), root); err != nil {
+			t.Fatalf("Failed to InsertOval. err: %s", err)
+		}
+	}
+	ts := time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC)
+	insert(ts, "oval:com.redhat.rhsa:def:20230001")
+	e := newTestEcho(t, driver, nil)
+
+	get := func(path string) packsResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected: 200, actual: %d %s", path, rec.Code, rec.Body)
+		}
+		var body packsResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to unmarshal. err: %s", err)
+		}
+		return body
+	}
+	counts := func() (int64, int64) {
+		hits, _ := cacheStats.Get("packsHits").(*expvar.Int)
+		misses, _ := cacheStats.Get("packsMisses").(*expvar.Int)
+		if hits == nil || misses == nil {
+			return 0, 0
+		}
+		return hits.Value(), misses.Value()
+	}
+
+	hits, misses := counts()
+	// the same query of the alias of the family hits as well
+	for _, path := range []string{"/packs/redhat/8/kernel", "/packs/redhat/8/kernel", "/packs/centos/8/kernel"} {
+		if body := get(path); body.Total != 1 {
+			t.Errorf("%s: expected: 1 definition, actual: %+v", path, body)
+		}
+	}
+	if h, m := counts(); h-hits != 2 || m-misses != 1 {
+		t.Errorf("expected: 2 hits and 1 miss, actual: %d hits and %d misses", h-hits, m-misses)
+	}
+
+	// the refresh is answered at once, as freshnessTTL is 0
+	insert(ts.Add(24*time.Hour), "oval:com.redhat.rhsa:def:20230001", "oval:com.redhat.rhsa:def:20230002")
+	if body := get("/packs/redhat/8/kernel"); body.Total != 2 {
+		t.Errorf("expected: 2 definitions after the refresh, actual: %+v", body)
+	}
+}
+
+func TestHealthDeep(t *testing.T) {
+	viper.Set("batch-size", 10)
+	defer viper.Set("batch-size", nil)
+
+	driver, err := db.NewDB("sqlite3", filepath.Join(t.TempDir(), "oval.sqlite3"), false, db.Option{})
+	if err != nil {
+		t.Fatalf("Failed to NewDB. err: %s", err)
+	}
+	defer driver.CloseDB()
+	if _, err := driver.InsertOval(context.Background(), &models.Root{Family: c.RedHat, OSVersion: "8", Definitions: []models.Definition{{DefinitionID: "oval:redhat:def:1"}}}); err != nil {
+		t.Fatalf("Failed to InsertOval. err: %s", err)
+	}
+	ts := httptest.NewServer(newTestEcho(t, driver, nil))
+	defer ts.Close()
+
+	get := func() (int, healthResponse) {
+		res, err := http.Get(ts.URL + "/health?deep=true")
+		if err != nil {
+			t.Fatalf("Failed to GET. err: %s", err)
+		}
+		defer res.Body.Close()
+		var body healthResponse
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode body. err: %s", err)
+		}
+		return res.StatusCode, body
+	}
+
+	status, body := get()
+	if status != http.StatusOK {
+		t.Errorf("expected: %d, actual: %d", http.StatusOK, status)
+	}
+	if body.Integrity == nil || body.Integrity.Total() != 0 {
+		t.Errorf("expected: the report of no problem, actual: %+v", body.Integrity)
+	}
+
+	// the cache validator of redhat 9, which has no root
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		t.Fatalf("Failed to GetFetchMeta. err: %s", err)
+	}
+	fetchMeta.CacheValidators = map[string]models.CacheValidator{"https://example.com/rhel-9.oval.xml.bz2": {ETag: `"9"`, OSVersions: []string{"9"}}}
+	if err := driver.UpsertFetchMeta(fetchMeta); err != nil {
+		t.Fatalf("Failed to UpsertFetchMeta. err: %s", err)
+	}
+	status, body = get()
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("expected: %d, actual: %d", http.StatusServiceUnavailable, status)
+	}
+	if body.Integrity == nil || body.Integrity.StaleFetchMeta != 1 || !reflect.DeepEqual(body.Integrity.Samples[db.SampleStaleFetchMeta], []string{"https://example.com/rhel-9.oval.xml.bz2"}) {
+		t.Errorf("expected: the stale fetch meta of redhat 9, actual: %+v", body.Integrity)
+	}
+}
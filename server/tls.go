@@ -0,0 +1,46 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+// newTLSConfig returns the config of HTTPS by the certificate and the key, nil for HTTP if neither is given,
+// requiring the client certificates signed by clientCAFile if given, i.e. mutual TLS
+func newTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	switch {
+	case certFile == "" && keyFile == "" && clientCAFile == "":
+		return nil, nil
+	case certFile == "" || keyFile == "":
+		return nil, xerrors.New("Failed to configure TLS. err: both --tls-cert and --tls-key are required to serve HTTPS")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to load TLS certificate. cert: %s, key: %s, err: %w", certFile, keyFile, err)
+	}
+	// HTTP/2 is negotiated by ALPN, falling back to HTTP/1.1
+	c := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if clientCAFile == "" {
+		return c, nil
+	}
+
+	bs, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to read TLS client CA. path: %s, err: %w", clientCAFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bs) {
+		return nil, xerrors.Errorf("Failed to read TLS client CA. path: %s, err: no certificate in PEM", clientCAFile)
+	}
+	c.ClientCAs = pool
+	c.ClientAuth = tls.RequireAndVerifyClientCert
+	return c, nil
+}
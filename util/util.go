@@ -1,12 +1,40 @@
 package util
 
-import "golang.org/x/exp/maps"
+import (
+	"time"
 
-// Unique return unique elements
+	"golang.org/x/xerrors"
+)
+
+// Unique return unique elements in the order of their first appearance
 func Unique[T comparable](s []T) []T {
 	m := map[T]struct{}{}
+	uniq := make([]T, 0, len(s))
 	for _, v := range s {
+		if _, ok := m[v]; ok {
+			continue
+		}
 		m[v] = struct{}{}
+		uniq = append(uniq, v)
+	}
+	return uniq
+}
+
+var ovalTimestampLayouts = []string{
+	"2006-01-02T15:04:05",       // RedHat, Oracle, SUSE, Ubuntu: 2023-07-06T04:00:10 (fractional seconds are also accepted)
+	time.RFC3339,                // 2023-07-06T04:00:10Z, Debian: 2023-07-06T04:40:25.188-04:00
+	"2006-01-02T15:04:05-0700",  // 2023-07-06T04:00:10+0000
+	"2006-01-02 15:04:05",       // 2023-07-06 04:00:10
+	"2006-01-02 15:04:05 -0700", // 2023-07-06 04:00:10 +0000
+	"2006-01-02",                // 2023-07-06
+}
+
+// ParseOvalTimestamp parses the timestamp of OVAL generator in the formats seen in each distribution
+func ParseOvalTimestamp(s string) (time.Time, error) {
+	for _, layout := range ovalTimestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
 	}
-	return maps.Keys(m)
+	return time.Time{}, xerrors.Errorf("Failed to parse OVAL timestamp. timestamp: %q", s)
 }
@@ -0,0 +1,88 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseOvalTimestamp(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name: "RedHat, Oracle, Ubuntu",
+			in:   "2023-07-06T04:00:10",
+			want: time.Date(2023, time.July, 6, 4, 0, 10, 0, time.UTC),
+		},
+		{
+			name: "SUSE with fractional seconds",
+			in:   "2023-07-06T04:00:10.123",
+			want: time.Date(2023, time.July, 6, 4, 0, 10, 123000000, time.UTC),
+		},
+		{
+			name: "Debian",
+			in:   "2023-07-06T04:40:25.188-04:00",
+			want: time.Date(2023, time.July, 6, 8, 40, 25, 188000000, time.UTC),
+		},
+		{
+			name: "trailing Z",
+			in:   "2023-07-06T04:00:10Z",
+			want: time.Date(2023, time.July, 6, 4, 0, 10, 0, time.UTC),
+		},
+		{
+			name: "numeric zone",
+			in:   "2023-07-06T04:00:10+0900",
+			want: time.Date(2023, time.July, 5, 19, 0, 10, 0, time.UTC),
+		},
+		{
+			name: "space separated",
+			in:   "2023-07-06 04:00:10",
+			want: time.Date(2023, time.July, 6, 4, 0, 10, 0, time.UTC),
+		},
+		{
+			name: "date only",
+			in:   "2023-07-06",
+			want: time.Date(2023, time.July, 6, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "empty",
+			in:      "",
+			wantErr: true,
+		},
+		{
+			name:    "unknown format",
+			in:      "Thu, 06 Jul 2023 04:00:10 GMT",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOvalTimestamp(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got = %v, want = %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnique(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+	}{
+		{in: []string{"7", "5", "7", "6", "5"}, want: []string{"7", "5", "6"}},
+		{in: nil, want: []string{}},
+	}
+	for i, tt := range tests {
+		if got := Unique(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("[%d] expected: %v, actual: %v", i, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Package version compares the versions of the packages by the algorithms of rpm and dpkg, e.g. the installed version with the fixed one
+// of the definitions, which the converters store as they are in OVAL, e.g. 1:18.14.2-2.module+el8.7.0+18113+bc7e31cd and 2.9.13+dfsg-1ubuntu0.3
+package version
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareRPM compares the EVRs [epoch:]version[-release] a and b as rpm does, returning -1 if a is older, 1 if newer and 0 if equal.
+// The missing epoch is 0, and the release is compared only if both have it, e.g. 1.0 is equal to 1.0-1.
+func CompareRPM(a, b string) int {
+	ae, av, ar := parseEVR(a)
+	be, bv, br := parseEVR(b)
+	if c := rpmvercmp(ae, be); c != 0 {
+		return c
+	}
+	if c := rpmvercmp(av, bv); c != 0 {
+		return c
+	}
+	if ar == "" || br == "" {
+		return 0
+	}
+	return rpmvercmp(ar, br)
+}
+
+// parseEVR splits the EVR of rpm into the epoch, 0 if missing, the version and the release after the last -
+func parseEVR(evr string) (epoch, version, release string) {
+	epoch = "0"
+	if i := strings.IndexByte(evr, ':'); i >= 0 && isDigits(evr[:i]) {
+		if i > 0 {
+			epoch = evr[:i]
+		}
+		evr = evr[i+1:]
+	}
+	version = evr
+	if i := strings.LastIndexByte(evr, '-'); i >= 0 {
+		version, release = evr[:i], evr[i+1:]
+	}
+	return epoch, version, release
+}
+
+// rpmvercmp compares the versions or the releases a and b by the segments of the digits and the letters, skipping the other characters,
+// where ~ sorts before anything, even the end, and ^ after the end but before anything else, as rpmvercmp of rpm does
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	for len(a) > 0 || len(b) > 0 {
+		a = strings.TrimLeftFunc(a, isRPMSeparator)
+		b = strings.TrimLeftFunc(b, isRPMSeparator)
+
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+			if b == "" {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if a == "" || b == "" {
+			break
+		}
+
+		isNum := isDigit(a[0])
+		segment := isAlpha
+		if isNum {
+			segment = isDigit
+		}
+		as, bs := leading(a, segment), leading(b, segment)
+		a, b = a[len(as):], b[len(bs):]
+		if as == "" {
+			// unreachable, as a starts with the digit or the letter
+			return -1
+		}
+		if bs == "" {
+			// the numeric segment is newer than the alphabetic one
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+		if isNum {
+			as, bs = strings.TrimLeft(as, "0"), strings.TrimLeft(bs, "0")
+			if len(as) != len(bs) {
+				return sign(len(as) - len(bs))
+			}
+		}
+		if c := strings.Compare(as, bs); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+// isRPMSeparator reports whether r is skipped between the segments by rpmvercmp, i.e. neither the alphanumeric nor ~ nor ^
+func isRPMSeparator(r rune) bool {
+	return r > 0x7f || !isDigit(byte(r)) && !isAlpha(byte(r)) && r != '~' && r != '^'
+}
+
+// CompareDEB compares the versions [epoch:]upstream_version[-debian_revision] a and b as dpkg does, returning -1 if a is older, 1 if newer
+// and 0 if equal. The missing epoch is 0 and the missing revision is empty, equal to 0, e.g. 1.0 is equal to 0:1.0-0.
+func CompareDEB(a, b string) int {
+	ae, av, ar := parseDEB(a)
+	be, bv, br := parseDEB(b)
+	if ae != be {
+		if ae < be {
+			return -1
+		}
+		return 1
+	}
+	if c := verrevcmp(av, bv); c != 0 {
+		return c
+	}
+	return verrevcmp(ar, br)
+}
+
+// parseDEB splits the version of dpkg into the epoch, 0 if missing or not numeric, the upstream version and the revision after the last -
+func parseDEB(v string) (epoch int, upstream, revision string) {
+	v = strings.TrimSpace(v)
+	if i := strings.IndexByte(v, ':'); i >= 0 {
+		if e, err := strconv.Atoi(v[:i]); err == nil {
+			epoch, v = e, v[i+1:]
+		}
+	}
+	upstream = v
+	if i := strings.LastIndexByte(v, '-'); i >= 0 {
+		upstream, revision = v[:i], v[i+1:]
+	}
+	return epoch, upstream, revision
+}
+
+// verrevcmp compares the upstream versions or the revisions a and b by the non-digit parts in the order of order
+// and the numeric parts by their values, as verrevcmp of dpkg does
+func verrevcmp(a, b string) int {
+	for len(a) > 0 || len(b) > 0 {
+		firstDiff := 0
+		for len(a) > 0 && !isDigit(a[0]) || len(b) > 0 && !isDigit(b[0]) {
+			ac, bc := order(a), order(b)
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			a, b = a[1:], b[1:]
+		}
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		for len(a) > 0 && isDigit(a[0]) && len(b) > 0 && isDigit(b[0]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[0]) - int(b[0])
+			}
+			a, b = a[1:], b[1:]
+		}
+		if len(a) > 0 && isDigit(a[0]) {
+			return 1
+		}
+		if len(b) > 0 && isDigit(b[0]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+// order returns the weight of the first character of s in verrevcmp: ~ before the end and the digits, then the letters, then the others
+func order(s string) int {
+	switch {
+	case s == "" || isDigit(s[0]):
+		return 0
+	case isAlpha(s[0]):
+		return int(s[0])
+	case s[0] == '~':
+		return -1
+	default:
+		return int(s[0]) + 256
+	}
+}
+
+// leading returns the longest prefix of s of the characters of f
+func leading(s string, f func(byte) bool) string {
+	i := 0
+	for i < len(s) && f(s[i]) {
+		i++
+	}
+	return s[:i]
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigits(s string) bool {
+	return leading(s, isDigit) == s
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,210 @@
+package version
+
+import "testing"
+
+func TestCompareRPM(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		// rpmvercmp of the test suite of rpm, tests/rpmvercmp.at
+		{a: "1.0", b: "1.0", want: 0},
+		{a: "1.0", b: "2.0", want: -1},
+		{a: "2.0", b: "1.0", want: 1},
+		{a: "2.0.1", b: "2.0.1", want: 0},
+		{a: "2.0", b: "2.0.1", want: -1},
+		{a: "2.0.1", b: "2.0", want: 1},
+		{a: "2.0.1a", b: "2.0.1a", want: 0},
+		{a: "2.0.1a", b: "2.0.1", want: 1},
+		{a: "2.0.1", b: "2.0.1a", want: -1},
+		{a: "5.5p1", b: "5.5p1", want: 0},
+		{a: "5.5p1", b: "5.5p2", want: -1},
+		{a: "5.5p2", b: "5.5p1", want: 1},
+		{a: "5.5p10", b: "5.5p10", want: 0},
+		{a: "5.5p1", b: "5.5p10", want: -1},
+		{a: "5.5p10", b: "5.5p1", want: 1},
+		{a: "10xyz", b: "10.1xyz", want: -1},
+		{a: "10.1xyz", b: "10xyz", want: 1},
+		{a: "xyz10", b: "xyz10", want: 0},
+		{a: "xyz10", b: "xyz10.1", want: -1},
+		{a: "xyz10.1", b: "xyz10", want: 1},
+		{a: "xyz.4", b: "xyz.4", want: 0},
+		{a: "xyz.4", b: "8", want: -1},
+		{a: "8", b: "xyz.4", want: 1},
+		{a: "xyz.4", b: "2", want: -1},
+		{a: "2", b: "xyz.4", want: 1},
+		{a: "5.5p2", b: "5.6p1", want: -1},
+		{a: "5.6p1", b: "5.5p2", want: 1},
+		{a: "5.6p1", b: "6.5p1", want: -1},
+		{a: "6.5p1", b: "5.6p1", want: 1},
+		{a: "6.0.rc1", b: "6.0", want: 1},
+		{a: "6.0", b: "6.0.rc1", want: -1},
+		{a: "10b2", b: "10a1", want: 1},
+		{a: "10a2", b: "10b2", want: -1},
+		{a: "1.0aa", b: "1.0aa", want: 0},
+		{a: "1.0a", b: "1.0aa", want: -1},
+		{a: "1.0aa", b: "1.0a", want: 1},
+		{a: "10.0001", b: "10.0001", want: 0},
+		{a: "10.0001", b: "10.1", want: 0},
+		{a: "10.1", b: "10.0001", want: 0},
+		{a: "10.0001", b: "10.0039", want: -1},
+		{a: "10.0039", b: "10.0001", want: 1},
+		{a: "4.999.9", b: "5.0", want: -1},
+		{a: "5.0", b: "4.999.9", want: 1},
+		{a: "20101121", b: "20101121", want: 0},
+		{a: "20101121", b: "20101122", want: -1},
+		{a: "20101122", b: "20101121", want: 1},
+		{a: "2_0", b: "2_0", want: 0},
+		{a: "2.0", b: "2_0", want: 0},
+		{a: "2_0", b: "2.0", want: 0},
+		{a: "a", b: "a", want: 0},
+		{a: "a+", b: "a+", want: 0},
+		{a: "a+", b: "a_", want: 0},
+		{a: "a_", b: "a+", want: 0},
+		{a: "+a", b: "+a", want: 0},
+		{a: "+a", b: "_a", want: 0},
+		{a: "_a", b: "+a", want: 0},
+		{a: "+_", b: "+_", want: 0},
+		{a: "_+", b: "+_", want: 0},
+		{a: "_+", b: "_+", want: 0},
+		{a: "+", b: "_", want: 0},
+		{a: "_", b: "+", want: 0},
+		{a: "1.0~rc1", b: "1.0~rc1", want: 0},
+		{a: "1.0~rc1", b: "1.0", want: -1},
+		{a: "1.0", b: "1.0~rc1", want: 1},
+		{a: "1.0~rc1", b: "1.0~rc2", want: -1},
+		{a: "1.0~rc2", b: "1.0~rc1", want: 1},
+		{a: "1.0~rc1~git123", b: "1.0~rc1~git123", want: 0},
+		{a: "1.0~rc1~git123", b: "1.0~rc1", want: -1},
+		{a: "1.0~rc1", b: "1.0~rc1~git123", want: 1},
+		{a: "1.0^", b: "1.0^", want: 0},
+		{a: "1.0^", b: "1.0", want: 1},
+		{a: "1.0", b: "1.0^", want: -1},
+		{a: "1.0^git1", b: "1.0^git1", want: 0},
+		{a: "1.0^git1", b: "1.0", want: 1},
+		{a: "1.0", b: "1.0^git1", want: -1},
+		{a: "1.0^git1", b: "1.0^git2", want: -1},
+		{a: "1.0^git2", b: "1.0^git1", want: 1},
+		{a: "1.0^git1", b: "1.01", want: -1},
+		{a: "1.01", b: "1.0^git1", want: 1},
+		{a: "1.0^20160101", b: "1.0^20160101", want: 0},
+		{a: "1.0^20160101", b: "1.0.1", want: -1},
+		{a: "1.0.1", b: "1.0^20160101", want: 1},
+		{a: "1.0^20160101^git1", b: "1.0^20160101^git1", want: 0},
+		{a: "1.0^20160102", b: "1.0^20160101^git1", want: 1},
+		{a: "1.0^20160101^git1", b: "1.0^20160102", want: -1},
+		{a: "1.0~rc1^git1", b: "1.0~rc1^git1", want: 0},
+		{a: "1.0~rc1^git1", b: "1.0~rc1", want: 1},
+		{a: "1.0~rc1", b: "1.0~rc1^git1", want: -1},
+		{a: "1.0^git1~pre", b: "1.0^git1~pre", want: 0},
+		{a: "1.0^git1", b: "1.0^git1~pre", want: 1},
+		{a: "1.0^git1~pre", b: "1.0^git1", want: -1},
+
+		// epoch and release
+		{a: "1:1.0-1", b: "1.0-1", want: 1},
+		{a: "0:1.0-1", b: "1.0-1", want: 0},
+		{a: "1:1.0-1", b: "2:0.1-1", want: -1},
+		{a: "10:1.0-1", b: "9:1.0-1", want: 1},
+		{a: "1.0-1", b: "1.0-2", want: -1},
+		{a: "1.0-10", b: "1.0-9", want: 1},
+		{a: "1.0", b: "1.0-1", want: 0},
+		{a: "1.0-1", b: "1.1", want: -1},
+		{a: "2.28-225.0.4.el8_8.6", b: "2.28-225.0.4.el8_8.6", want: 0},
+		{a: "2.28-225.0.4.el8", b: "2.28-225.0.4.el8_8.6", want: -1},
+		{a: "1:3.0.7-16.el9_2", b: "1:3.0.7-6.el9_2", want: 1},
+		{a: "1:18.14.2-2.module+el8.7.0+18113+bc7e31cd", b: "1:18.14.2-2.module+el8.7.0+18113+bc7e31cd", want: 0},
+		{a: "1:18.14.2-1.module+el8.7.0+18113+bc7e31cd", b: "1:18.14.2-2.module+el8.7.0+18113+bc7e31cd", want: -1},
+		{a: "1:1.1.1g-2.amzn2.0.6", b: "1:1.1.1g-2.amzn2.0.5", want: 1},
+		{a: "0:4.18.0-425.13.1.el8_7", b: "4.18.0-425.3.1.el8", want: 1},
+		{a: "2.3.0-150500.5.8.1", b: "2.3.0~git-150500.5.8.1", want: 1},
+	}
+	for _, tt := range tests {
+		if got := CompareRPM(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareRPM(%q, %q): expected: %d, actual: %d", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+func TestCompareDEB(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		// dpkg_version_compare of the test suite of dpkg, lib/dpkg/t/t-version.c
+		{a: "0:0-0", b: "0:0-0", want: 0},
+		{a: "0:0-00", b: "0:00-0", want: 0},
+		{a: "1:2-3", b: "1:2-3", want: 0},
+		{a: "0:0-0", b: "1:0-0", want: -1},
+		{a: "1:0-0", b: "0:0-0", want: 1},
+		{a: "0:a-0", b: "0:b-0", want: -1},
+		{a: "0:b-0", b: "0:a-0", want: 1},
+		{a: "0:0-a", b: "0:0-b", want: -1},
+		{a: "0:0-b", b: "0:0-a", want: 1},
+
+		// the versions of the test data of dpkg, t/Dpkg_Version/versions, and of apt, test/libapt/compareversion_test.cc
+		{a: "1.0", b: "1.0", want: 0},
+		{a: "1.0", b: "1.1", want: -1},
+		{a: "1.0-1", b: "1.0-2", want: -1},
+		{a: "1:1.0", b: "2.0", want: 1},
+		{a: "0:1.0", b: "1.0", want: 0},
+		{a: "1.0-0", b: "1.0", want: 0},
+		{a: "00", b: "0", want: 0},
+		{a: "1.00", b: "1.0", want: 0},
+		{a: "1.0", b: "1.0.0", want: -1},
+		{a: "1.0.0", b: "1.0", want: 1},
+		{a: "a", b: "b", want: -1},
+		{a: "7.6p2-4", b: "7.6-0", want: 1},
+		{a: "1.0.3-3", b: "1.0-1", want: 1},
+		{a: "1.3", b: "1.2.2-2", want: 1},
+		{a: "1.3", b: "1.2.2", want: 1},
+		{a: "0-pre", b: "0-pre", want: 0},
+		{a: "0-pre", b: "0-pree", want: -1},
+		{a: "1.1.6r2-2", b: "1.1.6r-1", want: 1},
+		{a: "2.6b2-1", b: "2.6b-2", want: 1},
+		{a: "98.1p5-1", b: "98.1-pre2-b6-2", want: -1},
+		{a: "0.4a6-2", b: "0.4-1", want: 1},
+		{a: "1:3.0.5-2", b: "1:3.0.5.1", want: -1},
+		{a: "10.3", b: "1:0.4", want: -1},
+		{a: "1:1.25-4", b: "1:1.25-8", want: -1},
+		{a: "0:1.18.36", b: "1.18.36", want: 0},
+		{a: "1.18.36", b: "1.18.35", want: 1},
+		{a: "0:1.18.36", b: "1.18.35", want: 1},
+		{a: "9:1.18.36:5.4-20", b: "10:0.5.1-22", want: -1},
+		{a: "9:1.18.36:5.4-20", b: "9:1.18.36:5.5-1", want: -1},
+		{a: "9:1.18.36:5.4-20", b: " 9:1.18.37:4.3-22", want: -1},
+		{a: "1.18.36-0.17.35-18", b: "1.18.36-19", want: 1},
+		{a: "1:1.2.13-3", b: "1:1.2.13-3.1", want: -1},
+		{a: "2.0.7pre1-4", b: "2.0.7r-1", want: -1},
+		{a: "0.2", b: "1.0-0", want: -1},
+		{a: "1.0", b: "1.0-0+b1", want: -1},
+		{a: "1.0-1-1", b: "1.0-1", want: 1},
+
+		// ~ before the end, the end before the letters, and the letters before the others
+		{a: "1.0~rc1", b: "1.0", want: -1},
+		{a: "1.0~rc1", b: "1.0~rc2", want: -1},
+		{a: "1.0~~", b: "1.0~~a", want: -1},
+		{a: "1.0~~a", b: "1.0~", want: -1},
+		{a: "1.0~", b: "1.0", want: -1},
+		{a: "1.0", b: "1.0a", want: -1},
+		{a: "1.0a", b: "1.0+", want: -1},
+		{a: "1.0+", b: "1.0.", want: -1},
+		{a: "1.0Z", b: "1.0a", want: -1},
+
+		// of the distributions
+		{a: "2.6.32-5", b: "2.6.32-41", want: -1},
+		{a: "1.2.3-1ubuntu1", b: "1.2.3-1", want: 1},
+		{a: "1.2.3-1ubuntu0.1", b: "1.2.3-1ubuntu1", want: -1},
+		{a: "1.2.3-1~bpo11+1", b: "1.2.3-1", want: -1},
+		{a: "2.9.13+dfsg-1ubuntu0.3", b: "2.9.13+dfsg-1ubuntu0.2", want: 1},
+		{a: "2.9.13+dfsg-1ubuntu0.3", b: "2.9.13+dfsg-1ubuntu0.3", want: 0},
+		{a: "2.9.14+dfsg-1.2", b: "2.9.14+dfsg-1.3", want: -1},
+		{a: "1:2.9.0-1", b: "2.9.13-1", want: 1},
+		{a: "3.0.9-1+deb12u1", b: "3.0.9-1", want: 1},
+		{a: "3.0.9-1+deb12u1", b: "3.0.11-1~deb12u1", want: -1},
+	}
+	for _, tt := range tests {
+		if got := CompareDEB(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareDEB(%q, %q): expected: %d, actual: %d", tt.a, tt.b, tt.want, got)
+		}
+	}
+}